@@ -0,0 +1,4 @@
+// Package controlpb contains the gRPC control service of zdts3, generated from control.proto.
+package controlpb
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative control.proto
@@ -0,0 +1,353 @@
+package archiver
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-co-op/gocron/v2"
+	"github.com/rs/zerolog"
+)
+
+// apiRunsKept is the number of triggered runs kept for polling.
+const apiRunsKept = 100
+
+var (
+	// errUnknownJob is returned when triggering a job which is not scheduled.
+	errUnknownJob = errors.New("unknown job")
+	// errJobRunning is returned when triggering a job which is already running.
+	errJobRunning = errors.New("job is already running")
+)
+
+// Triggered run states.
+const (
+	// runQueued is the state of a triggered run waiting to start.
+	runQueued = "queued"
+	// runRunning is the state of a triggered run in progress.
+	runRunning = "running"
+	// runSucceeded is the state of a triggered run that succeeded.
+	runSucceeded = "succeeded"
+	// runFailed is the state of a triggered run that failed.
+	runFailed = "failed"
+)
+
+// triggeredRun is a run triggered through the API.
+type triggeredRun struct {
+	ID          string     `json:"id"`
+	Job         string     `json:"job"`
+	Status      string     `json:"status"`
+	Triggered   time.Time  `json:"triggered"`
+	Start       *time.Time `json:"start,omitempty"`
+	Duration    string     `json:"duration,omitempty"`
+	Files       int        `json:"files,omitempty"`
+	ArchiveSize int64      `json:"archiveSize,omitempty"`
+	Key         string     `json:"key,omitempty"`
+	Error       string     `json:"error,omitempty"`
+}
+
+// runAPI serves the endpoints triggering immediate archive runs and polling their state.
+// It is a run reporter following the progress of runs: the next run of a job starting
+// after a trigger is the triggered run. The runs of the subdirectories of a job together
+// are a run of the job.
+type runAPI struct {
+	s      gocron.Scheduler
+	token  string
+	logger *zerolog.Logger
+
+	mtx     sync.Mutex
+	runs    map[string]*triggeredRun
+	order   []string
+	active  map[string]bool
+	subdirs map[string]bool
+}
+
+// newRunAPI creates the run API of the jobs of the provided scheduler, authenticating
+// requests with the provided bearer token.
+func newRunAPI(s gocron.Scheduler, token string, logger *zerolog.Logger) *runAPI {
+	return &runAPI{
+		s:       s,
+		token:   token,
+		logger:  logger,
+		runs:    make(map[string]*triggeredRun),
+		active:  make(map[string]bool),
+		subdirs: make(map[string]bool),
+	}
+}
+
+// newRunID returns a random run ID.
+func newRunID() string {
+	id := make([]byte, 8)
+	rand.Read(id)
+	return hex.EncodeToString(id)
+}
+
+// name returns the name of the reporter.
+func (a *runAPI) name() string {
+	return "api"
+}
+
+// runJob returns the name of the job of the run with the provided name, runs of the
+// subdirectories of a job being named after the job and the subdirectory.
+func runJob(name string) string {
+	job, _, _ := strings.Cut(name, "/")
+	return job
+}
+
+// find returns the oldest triggered run of the provided job in the provided state. The
+// caller must hold the mutex.
+func (a *runAPI) find(job string, status string) *triggeredRun {
+	for _, id := range a.order {
+		run := a.runs[id]
+		if run.Job == job && run.Status == status {
+			return run
+		}
+	}
+
+	return nil
+}
+
+// markRunning marks the queued runs of the provided job as running since the provided time.
+// The caller must hold the mutex.
+func (a *runAPI) markRunning(job string, start time.Time) {
+	a.active[job] = true
+
+	// Triggers received while a run was queued are served by the same run.
+	for {
+		triggered := a.find(job, runQueued)
+		if triggered == nil {
+			return
+		}
+
+		triggered.Status = runRunning
+		triggered.Start = &start
+	}
+}
+
+// start marks the queued runs of the job of the provided run as running.
+func (a *runAPI) start(_ context.Context, run *runResult) error {
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+
+	job := runJob(run.Job)
+	if !a.subdirs[job] {
+		a.markRunning(job, run.Start)
+	}
+
+	return nil
+}
+
+// report records the outcome of the running triggered runs of the job of the provided run.
+// The outcomes of subdirectory runs are added up until every subdirectory run finished.
+func (a *runAPI) report(_ context.Context, result *runResult) error {
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+
+	job := runJob(result.Job)
+	if a.subdirs[job] {
+		for _, id := range a.order {
+			triggered := a.runs[id]
+			if triggered.Job != job || triggered.Status != runRunning {
+				continue
+			}
+
+			if result.Err != nil {
+				if triggered.Error != "" {
+					triggered.Error += "; "
+				}
+				triggered.Error += result.Job + ": " + result.Err.Error()
+			}
+			triggered.Files += result.Files
+			triggered.ArchiveSize += result.Size
+		}
+		return nil
+	}
+
+	delete(a.active, job)
+
+	for {
+		triggered := a.find(job, runRunning)
+		if triggered == nil {
+			return nil
+		}
+
+		triggered.Status = runSucceeded
+		if result.Err != nil {
+			triggered.Status = runFailed
+			triggered.Error = result.Err.Error()
+		}
+		triggered.Duration = result.Duration.Round(time.Millisecond).String()
+		triggered.Files = result.Files
+		triggered.ArchiveSize = result.Size
+		triggered.Key = result.Key
+	}
+}
+
+// startSubdirs marks the queued runs of the provided job as running while its
+// subdirectories are archived.
+func (a *runAPI) startSubdirs(job string, start time.Time) {
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+
+	a.subdirs[job] = true
+	a.markRunning(job, start)
+}
+
+// finishSubdirs records the outcome of the running triggered runs of the provided job once
+// its subdirectories are archived. They failed if any subdirectory run failed.
+func (a *runAPI) finishSubdirs(job string) {
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+
+	delete(a.subdirs, job)
+	delete(a.active, job)
+
+	for {
+		triggered := a.find(job, runRunning)
+		if triggered == nil {
+			return
+		}
+
+		triggered.Status = runSucceeded
+		if triggered.Error != "" {
+			triggered.Status = runFailed
+		}
+		triggered.Duration = time.Since(*triggered.Start).Round(time.Millisecond).String()
+	}
+}
+
+// authorized returns whether the provided request carries the API token.
+func (a *runAPI) authorized(r *http.Request) bool {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return ok && subtle.ConstantTimeCompare([]byte(token), []byte(a.token)) == 1
+}
+
+// writeJSON writes the provided value as a JSON response with the provided status.
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// writeAPIError writes a JSON error response.
+func writeAPIError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{"error": message})
+}
+
+// triggerJob starts an immediate run of the provided job and returns the triggered run. The
+// job name can be omitted when a single job is scheduled.
+func (a *runAPI) triggerJob(name string) (triggeredRun, error) {
+	jobs := a.s.Jobs()
+	if name == "" && len(jobs) == 1 {
+		name = jobs[0].Name()
+	}
+
+	job := findJob(a.s, name)
+	if job == nil {
+		return triggeredRun{}, fmt.Errorf("%w %q", errUnknownJob, name)
+	}
+
+	// Triggers of running jobs would be skipped, the job runs in singleton mode.
+	a.mtx.Lock()
+	if a.active[name] {
+		a.mtx.Unlock()
+		return triggeredRun{}, fmt.Errorf("%w: %s", errJobRunning, name)
+	}
+
+	run := &triggeredRun{
+		ID:        newRunID(),
+		Job:       name,
+		Status:    runQueued,
+		Triggered: time.Now(),
+	}
+	a.runs[run.ID] = run
+	a.order = append(a.order, run.ID)
+
+	// Forget the oldest triggered runs.
+	for len(a.order) > apiRunsKept {
+		delete(a.runs, a.order[0])
+		a.order = a.order[1:]
+	}
+	triggered := *run
+	a.mtx.Unlock()
+
+	err := job.RunNow()
+	if err != nil {
+		a.mtx.Lock()
+		run.Status = runFailed
+		run.Error = err.Error()
+		a.mtx.Unlock()
+
+		a.logger.Error().Err(err).Str("job", name).Msg("Triggering run")
+		return triggeredRun{}, fmt.Errorf("triggering job %s: %w", name, err)
+	}
+
+	a.logger.Info().Str("job", name).Str("run", run.ID).Msg("Triggered run")
+	return triggered, nil
+}
+
+// triggered returns the state of the triggered run with the provided ID.
+func (a *runAPI) triggered(id string) (triggeredRun, bool) {
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+
+	run, ok := a.runs[id]
+	if !ok {
+		return triggeredRun{}, false
+	}
+
+	return *run, true
+}
+
+// trigger starts an immediate run of the requested job.
+func (a *runAPI) trigger(w http.ResponseWriter, r *http.Request) {
+	run, err := a.triggerJob(r.FormValue("job"))
+	switch {
+	case errors.Is(err, errUnknownJob):
+		writeAPIError(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, errJobRunning):
+		writeAPIError(w, http.StatusConflict, err.Error())
+	case err != nil:
+		writeAPIError(w, http.StatusInternalServerError, err.Error())
+	default:
+		w.Header().Set("Location", "/runs/"+run.ID)
+		writeJSON(w, http.StatusAccepted, run)
+	}
+}
+
+// get writes the state of the requested triggered run.
+func (a *runAPI) get(w http.ResponseWriter, r *http.Request) {
+	run, ok := a.triggered(r.PathValue("id"))
+	if !ok {
+		writeAPIError(w, http.StatusNotFound, "unknown run")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, run)
+}
+
+// protect wraps the provided handler with the token authentication.
+func (a *runAPI) protect(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !a.authorized(r) {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="zdts3"`)
+			writeAPIError(w, http.StatusUnauthorized, "unauthorized")
+			return
+		}
+
+		next(w, r)
+	}
+}
+
+// register registers the API routes with the provided mux.
+func (a *runAPI) register(mux *http.ServeMux) {
+	mux.HandleFunc("POST /run", a.protect(a.trigger))
+	mux.HandleFunc("GET /runs/{id}", a.protect(a.get))
+}
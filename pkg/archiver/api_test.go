@@ -0,0 +1,149 @@
+package archiver
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-co-op/gocron/v2"
+	"github.com/peterldowns/testy/assert"
+	"github.com/rs/zerolog"
+)
+
+func TestRunAPI(t *testing.T) {
+	s, err := gocron.NewScheduler()
+	assert.NoError(t, err)
+	defer s.Shutdown()
+
+	logger := zerolog.Nop()
+	api := newRunAPI(s, "test-token", &logger)
+
+	// The task reports to the API like archive runs do, finishing once released.
+	release := make(chan struct{})
+	ctx := context.Background()
+	task := func() {
+		run := &runResult{Job: "db", Start: time.Now()}
+		api.start(ctx, run)
+		<-release
+		run.Duration = time.Second
+		run.Files = 3
+		run.Key = "dump-20260101235000.zip"
+		api.report(ctx, run)
+	}
+	_, err = s.NewJob(gocron.DurationJob(time.Hour), gocron.NewTask(task), gocron.WithName("db"),
+		gocron.WithSingletonMode(gocron.LimitModeReschedule))
+	assert.NoError(t, err)
+	s.Start()
+
+	srv := httptest.NewServer(newHealthHandler(s, newStatusTracker(), nil, nil, nil, api, false))
+	defer srv.Close()
+
+	do := func(method string, path string, token string) (int, triggeredRun) {
+		req, err := http.NewRequest(method, srv.URL+path, nil)
+		assert.NoError(t, err)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+
+		resp, err := http.DefaultClient.Do(req)
+		assert.NoError(t, err)
+		defer resp.Body.Close()
+
+		var run triggeredRun
+		json.NewDecoder(resp.Body).Decode(&run)
+		return resp.StatusCode, run
+	}
+
+	poll := func(id string, status string) triggeredRun {
+		deadline := time.Now().Add(5 * time.Second)
+		for {
+			code, run := do(http.MethodGet, "/runs/"+id, "test-token")
+			assert.Equal(t, http.StatusOK, code)
+			if run.Status == status || time.Now().After(deadline) {
+				return run
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+
+	// Ensure requests require the token.
+	code, _ := do(http.MethodPost, "/run", "")
+	assert.Equal(t, http.StatusUnauthorized, code)
+	code, _ = do(http.MethodPost, "/run", "other-token")
+	assert.Equal(t, http.StatusUnauthorized, code)
+
+	// Ensure unknown jobs are rejected.
+	code, _ = do(http.MethodPost, "/run?job=logs", "test-token")
+	assert.Equal(t, http.StatusNotFound, code)
+
+	// Ensure the only job is triggered and its run can be polled until it finishes.
+	code, run := do(http.MethodPost, "/run", "test-token")
+	assert.Equal(t, http.StatusAccepted, code)
+	assert.Equal(t, "db", run.Job)
+	assert.Equal(t, runQueued, run.Status)
+	assert.True(t, run.ID != "")
+
+	running := poll(run.ID, runRunning)
+	assert.Equal(t, runRunning, running.Status)
+	assert.True(t, running.Start != nil)
+
+	// Ensure running jobs can't be triggered again.
+	code, _ = do(http.MethodPost, "/run?job=db", "test-token")
+	assert.Equal(t, http.StatusConflict, code)
+
+	close(release)
+	finished := poll(run.ID, runSucceeded)
+	assert.Equal(t, runSucceeded, finished.Status)
+	assert.Equal(t, 3, finished.Files)
+	assert.True(t, strings.HasSuffix(finished.Key, ".zip"))
+
+	code, _ = do(http.MethodGet, "/runs/unknown", "test-token")
+	assert.Equal(t, http.StatusNotFound, code)
+}
+
+func TestRunAPISubdirs(t *testing.T) {
+	s, err := gocron.NewScheduler()
+	assert.NoError(t, err)
+	defer s.Shutdown()
+
+	logger := zerolog.Nop()
+	api := newRunAPI(s, "test-token", &logger)
+	fake := newFakeS3(t, "test-bucket")
+	s3Cfg := fake.s3Config("test-bucket")
+
+	dir := t.TempDir()
+	for _, name := range []string{"app1/users.sql", "app2/orders.sql"} {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		assert.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		assert.NoError(t, os.WriteFile(path, []byte(name), 0644))
+	}
+	job := jobConfig{Name: "db", SourceDir: dir, Retention: "720h", Subdirs: true}
+
+	_, err = s.NewJob(gocron.DurationJob(time.Hour), gocron.NewTask(func() {
+		archive(context.Background(), job, s3Cfg, []runReporter{api}, &logger)
+	}), gocron.WithName("db"), gocron.WithSingletonMode(gocron.LimitModeReschedule))
+	assert.NoError(t, err)
+	s.Start()
+
+	// Ensure triggered runs of subdirectory jobs finish once every subdirectory is archived.
+	run, err := api.triggerJob("db")
+	assert.NoError(t, err)
+	deadline := time.Now().Add(5 * time.Second)
+	for run.Status != runSucceeded && run.Status != runFailed && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+		run, _ = api.triggered(run.ID)
+	}
+	assert.Equal(t, runSucceeded, run.Status)
+	assert.Equal(t, 2, run.Files)
+	assert.True(t, run.Start != nil)
+
+	// Ensure the job can be triggered again once finished.
+	_, err = api.triggerJob("db")
+	assert.NoError(t, err)
+}
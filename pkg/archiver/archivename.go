@@ -0,0 +1,60 @@
+package archiver
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// labelPattern matches valid labels of archive names, e.g. environments.
+var labelPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// validateEnvironment validates the provided environment label of archive names.
+func validateEnvironment(environment string) error {
+	if environment != "" && !labelPattern.MatchString(environment) {
+		return fmt.Errorf("invalid environment %q, expected letters, digits, dots, dashes and underscores", environment)
+	}
+
+	return nil
+}
+
+// nameLabel returns the provided value as a label of archive names, lowercased with the
+// characters other than letters, digits, dots and underscores replaced by dashes.
+func nameLabel(value string) string {
+	label := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9', r == '.', r == '_':
+			return r
+		default:
+			return '-'
+		}
+	}, strings.ToLower(value))
+
+	return strings.Trim(label, "-.")
+}
+
+// archiveFileName returns the name of the zip file of a run at the provided time, the
+// provided name followed by the instance name, the environment label if any and the run's
+// timestamp, e.g. dump-db1-prod-20260101235000.zip. Archives uploaded to a shared bucket by
+// many machines are told apart by their name. The timestamp stays last, staged archives are
+// recognized by it.
+func archiveFileName(name, environment string, now time.Time) string {
+	parts := []string{name}
+	if label := nameLabel(instanceName()); label != "" {
+		parts = append(parts, label)
+	}
+	if environment != "" {
+		parts = append(parts, environment)
+	}
+	parts = append(parts, now.Format("20060102150405"))
+
+	return strings.Join(parts, "-") + ".zip"
+}
+
+// archivePath returns the path of the zip file of a run of the provided job at the provided
+// time within the provided directory, see archiveFileName.
+func (j *jobConfig) archivePath(dir, name string, now time.Time) string {
+	return filepath.Join(dir, archiveFileName(name, j.Environment, now))
+}
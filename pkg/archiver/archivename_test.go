@@ -0,0 +1,36 @@
+package archiver
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/peterldowns/testy/assert"
+)
+
+func TestArchiveFileName(t *testing.T) {
+	hostname, err := os.Hostname()
+	assert.NoError(t, err)
+	now := time.Date(2026, time.January, 1, 23, 50, 0, 0, time.UTC)
+
+	// Ensure archive names carry the hostname and the environment label if any, followed by
+	// the run's timestamp.
+	host := nameLabel(hostname)
+	assert.Equal(t, "dump-"+host+"-20260101235000.zip", archiveFileName("dump", "", now))
+	assert.Equal(t, "dump-"+host+"-prod-20260101235000.zip", archiveFileName("dump", "prod", now))
+
+	// Ensure the names are recognized as staged archives and ignored by watched directories.
+	name := archiveFileName("dump", "prod", now)
+	assert.True(t, isStagedArchive(name))
+	watcher := &dirWatcher{job: jobConfig{SourceDir: "/srv/dumps"}}
+	assert.True(t, watcher.ignored(filepath.Join("/srv/dumps", name)))
+
+	// Ensure hostnames are sanitized and environment labels validated.
+	assert.Equal(t, "db-1.example.com", nameLabel("DB 1.example.com."))
+	assert.Equal(t, "web_2", nameLabel("web_2"))
+	assert.NoError(t, validateEnvironment(""))
+	assert.NoError(t, validateEnvironment("prod-eu_1"))
+	assert.Error(t, validateEnvironment("prod/eu"))
+	assert.Error(t, validateEnvironment("-prod"))
+}
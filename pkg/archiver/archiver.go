@@ -0,0 +1,209 @@
+package archiver
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/dnldd/zdts3/pkg/storage"
+	"github.com/rs/zerolog"
+)
+
+// Archiver runs the archive jobs of a configuration on demand, for services embedding the
+// archiving behavior of zdts3 instead of running the binary. It schedules nothing, every run
+// is triggered by the embedding service. Runs are reported to the reporters of the
+// configuration, e.g. notifications and metrics, like the runs of the daemon.
+type Archiver struct {
+	cfg       *Config
+	jobs      *jobResolver
+	reporters []runReporter
+	logger    *zerolog.Logger
+}
+
+// RunResult is the outcome of an archive run of a job, or of one of its subdirectories.
+type RunResult struct {
+	// Job is the name of the job, <job>/<subdirectory> for the runs of subdirectories.
+	Job      string
+	Start    time.Time
+	Duration time.Duration
+	// Bucket and Key locate the uploaded archive.
+	Bucket string
+	Key    string
+	Files  int
+	Size   int64
+	// Unchanged indicates the archive was identical to the previous one and not uploaded.
+	Unchanged bool
+	// Skipped indicates the run found no files to archive and uploaded nothing.
+	Skipped bool
+	Err     error
+}
+
+// RestoreResult is the outcome of restoring an archive.
+type RestoreResult struct {
+	Key string
+	// Chain holds the keys of the archives extracted, the base archive first.
+	Chain []string
+	Files int
+	Bytes int64
+}
+
+// New creates an archiver of the jobs of the provided configuration, logging to the provided
+// logger. Settings not set are filled in from the config file at ConfigPath, if any, before
+// the configuration is validated. The process wide settings of the configuration, such as
+// the timezone and the maximum number of concurrent runs, are applied, a process embeds a
+// single archiver.
+func New(cfg Config, logger *zerolog.Logger) (*Archiver, error) {
+	if logger == nil {
+		nop := zerolog.Nop()
+		logger = &nop
+	}
+
+	if cfg.ConfigPath != "" {
+		fileCfg, err := readConfigFile(cfg.ConfigPath)
+		if err != nil {
+			return nil, err
+		}
+
+		fileCfg.apply(&cfg)
+	}
+
+	// The log level only applies to the logger of the binary, the provided logger logs at
+	// its own level.
+	if cfg.LogLevel == "" {
+		cfg.LogLevel = zerolog.InfoLevel.String()
+	}
+
+	err := cfg.validate()
+	if err != nil {
+		return nil, err
+	}
+
+	setCopyBufferSize(cfg.copyBufferSize())
+	setLocation(cfg.location())
+	setInstanceID(cfg.InstanceID)
+	setMaxJobs(cfg.maxJobs())
+
+	return &Archiver{
+		cfg:       &cfg,
+		jobs:      newJobResolver(func() *Config { return &cfg }, logger),
+		reporters: cfg.reporters(),
+		logger:    logger,
+	}, nil
+}
+
+// Jobs returns the names of the configured jobs.
+func (a *Archiver) Jobs() []string {
+	var names []string
+	for _, job := range a.cfg.jobs() {
+		names = append(names, job.Name)
+	}
+
+	return names
+}
+
+// resultCollector is a run reporter collecting the results of the runs it is sent.
+type resultCollector struct {
+	mtx     sync.Mutex
+	results []RunResult
+}
+
+// name returns the name of the collector for log entries.
+func (c *resultCollector) name() string {
+	return "archiver"
+}
+
+// report collects the provided run result.
+func (c *resultCollector) report(_ context.Context, result *runResult) error {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	c.results = append(c.results, RunResult{
+		Job:       result.Job,
+		Start:     result.Start,
+		Duration:  result.Duration,
+		Bucket:    result.Bucket,
+		Key:       result.Key,
+		Files:     result.Files,
+		Size:      result.Size,
+		Unchanged: result.Unchanged,
+		Skipped:   result.Skipped,
+		Err:       result.Err,
+	})
+
+	return nil
+}
+
+// Run archives the provided job and returns the results of its run, one per subdirectory
+// for jobs archiving their subdirectories separately. The job name can be omitted when a
+// single job is configured. The returned error joins the errors of the failed runs, and is
+// also returned when the job is unknown or its previous run is still in progress.
+func (a *Archiver) Run(ctx context.Context, job string) ([]RunResult, error) {
+	jobCfg, s3Cfg, err := a.jobs.job(job)
+	if err != nil {
+		return nil, err
+	}
+
+	collector := &resultCollector{}
+	reporters := append(a.reporters[:len(a.reporters):len(a.reporters)], collector)
+	logger := a.logger.With().Str("job", jobCfg.Name).Logger()
+	err = runArchive(ctx, jobCfg, s3Cfg, reporters, &logger)
+	if err != nil {
+		return nil, err
+	}
+
+	var errs error
+	for _, result := range collector.results {
+		errs = errors.Join(errs, result.Err)
+	}
+
+	return collector.results, errs
+}
+
+// List returns the archives of the provided job, newest first.
+func (a *Archiver) List(ctx context.Context, job string) ([]storage.Object, error) {
+	_, s3Cfg, err := a.jobs.job(job)
+	if err != nil {
+		return nil, err
+	}
+
+	return listArchives(ctx, s3Cfg)
+}
+
+// Prune deletes the archives of the provided job older than the provided time beyond the
+// provided number of newest archives, and returns the deleted archives. Archives under
+// object lock retention or legal hold, and the base archives of archives kept, are kept.
+func (a *Archiver) Prune(ctx context.Context, job string, before time.Time, keep int) ([]storage.Object, error) {
+	_, s3Cfg, err := a.jobs.job(job)
+	if err != nil {
+		return nil, err
+	}
+
+	return pruneArchives(ctx, s3Cfg, before, keep, false)
+}
+
+// Restore extracts the archive of the provided job with the provided key, the newest one if
+// empty, into the provided directory, the job's source directory if empty. Existing files
+// are never overwritten.
+func (a *Archiver) Restore(ctx context.Context, job string, key string, targetDir string) (*RestoreResult, error) {
+	jobCfg, s3Cfg, err := a.jobs.job(job)
+	if err != nil {
+		return nil, err
+	}
+
+	if targetDir == "" {
+		targetDir = jobCfg.SourceDir
+	}
+
+	result, err := restoreArchiveFiles(ctx, s3Cfg, key, targetDir, extractOptions{Overwrite: overwriteNever})
+	if err != nil {
+		return nil, err
+	}
+
+	return &RestoreResult{
+		Key:   result.Key,
+		Chain: result.Chain,
+		Files: result.Files,
+		Bytes: result.Bytes,
+	}, nil
+}
@@ -0,0 +1,65 @@
+package archiver
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/peterldowns/testy/assert"
+)
+
+func TestArchiver(t *testing.T) {
+	source := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(source, "users.sql"), []byte("users"), 0600))
+	ctx := context.Background()
+
+	// Ensure invalid configurations are rejected.
+	_, err := New(Config{Backend: backendLocalDir}, nil)
+	assert.Error(t, err)
+
+	a, err := New(Config{Backend: backendLocalDir, LocalDir: t.TempDir(), SourceDir: source}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(a.Jobs()))
+
+	// Ensure runs archive the job and return their results.
+	results, err := a.Run(ctx, "")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(results))
+	assert.Equal(t, 1, results[0].Files)
+	assert.NotEqual(t, "", results[0].Key)
+
+	_, err = a.Run(ctx, "missing")
+	assert.Error(t, err)
+
+	archives, err := a.List(ctx, "")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(archives))
+	assert.Equal(t, results[0].Key, archives[0].Key)
+
+	// Ensure the newest archive is restored by default.
+	target := t.TempDir()
+	restored, err := a.Restore(ctx, "", "", target)
+	assert.NoError(t, err)
+	assert.Equal(t, results[0].Key, restored.Key)
+	assert.Equal(t, 1, restored.Files)
+	data, err := os.ReadFile(filepath.Join(target, "users.sql"))
+	assert.NoError(t, err)
+	assert.Equal(t, "users", string(data))
+
+	// Ensure existing files are kept.
+	assert.NoError(t, os.WriteFile(filepath.Join(target, "users.sql"), []byte("local"), 0600))
+	_, err = a.Restore(ctx, "", "", target)
+	assert.NoError(t, err)
+	data, err = os.ReadFile(filepath.Join(target, "users.sql"))
+	assert.NoError(t, err)
+	assert.Equal(t, "local", string(data))
+
+	pruned, err := a.Prune(ctx, "", time.Now().Add(time.Hour), 0)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(pruned))
+	archives, err = a.List(ctx, "")
+	assert.NoError(t, err)
+	assert.Equal(t, 0, len(archives))
+}
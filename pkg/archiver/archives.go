@@ -0,0 +1,741 @@
+package archiver
+
+import (
+	"archive/zip"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dnldd/zdts3/pkg/storage"
+	"github.com/dustin/go-humanize"
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+	"github.com/rs/zerolog"
+)
+
+// restoreResult is the outcome of restoring an archive.
+type restoreResult struct {
+	Key   string
+	Chain []string
+	Files int
+	Bytes int64
+	// Repaired holds the keys of the archives repaired with their parity data.
+	Repaired []string
+}
+
+// jobResolver resolves jobs of the active configuration, which changes on reloads, to the
+// access configuration of their buckets.
+type jobResolver struct {
+	config func() *Config
+	logger *zerolog.Logger
+
+	mtx      sync.Mutex
+	credsCfg *Config
+	creds    *credentials.Credentials
+}
+
+// newJobResolver creates a resolver of the jobs of the configuration returned by the
+// provided function.
+func newJobResolver(config func() *Config, logger *zerolog.Logger) *jobResolver {
+	return &jobResolver{config: config, logger: logger}
+}
+
+// credentials returns the storage credentials of the provided configuration, reusing them
+// until the configuration changes.
+func (r *jobResolver) credentials(cfg *Config) *credentials.Credentials {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	if r.credsCfg != cfg {
+		r.credsCfg = cfg
+		r.creds = cfg.credentials(r.logger)
+	}
+
+	return r.creds
+}
+
+// job returns the configuration of the provided job and the access configuration of its
+// bucket. The job name can be omitted when a single job is configured.
+func (r *jobResolver) job(name string) (jobConfig, *s3Config, error) {
+	cfg := r.config()
+	jobs := cfg.jobs()
+	if name == "" && len(jobs) == 1 {
+		name = jobs[0].Name
+	}
+
+	for _, job := range jobs {
+		if job.Name == name {
+			return job, cfg.s3Config(job, r.credentials(cfg)), nil
+		}
+	}
+
+	return jobConfig{}, nil, fmt.Errorf("unknown job %q", name)
+}
+
+// archivePrefix returns the object prefix of the archives in the provided bucket.
+func archivePrefix(cfg *s3Config) string {
+	if cfg.Prefix == "" {
+		return ""
+	}
+
+	return strings.TrimSuffix(cfg.Prefix, "/") + "/"
+}
+
+// isArchiveKey returns whether the provided object key is an archive under the archive
+// prefix of the provided bucket, as opposed to other objects such as catalog indexes. The
+// recipes of deduplicated archives and delta archives are archives as well.
+func isArchiveKey(cfg *s3Config, key string) bool {
+	return path.Dir(key) == path.Join(".", cfg.Prefix) &&
+		(strings.HasSuffix(key, ".zip") || isRecipeKey(key) || isDeltaKey(key))
+}
+
+// listArchives returns the archives in the provided bucket, newest first.
+func listArchives(ctx context.Context, cfg *s3Config) ([]storage.Object, error) {
+	store, err := cfg.openStorage(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer store.Close()
+
+	files, err := store.List(ctx, archivePrefix(cfg))
+	if err != nil {
+		return nil, fmt.Errorf("listing archives: %w", err)
+	}
+
+	var archives []storage.Object
+	for _, file := range files {
+		if isArchiveKey(cfg, file.Key) {
+			archives = append(archives, file)
+		}
+	}
+
+	// Archive names embed their creation time, newer archives sort last.
+	sort.Slice(archives, func(i, j int) bool { return archives[i].Key > archives[j].Key })
+
+	return archives, nil
+}
+
+// asOfLayouts are the layouts of restore points in time, besides RFC 3339 timestamps, in
+// the timezone of the configuration.
+var asOfLayouts = []string{"2006-01-02 15:04:05", "2006-01-02T15:04:05", "2006-01-02 15:04", "2006-01-02T15:04"}
+
+// parseAsOf parses a restore point in time, an RFC 3339 timestamp, a date and time or a date
+// in the provided timezone. A date stands for the end of the day.
+func parseAsOf(value string, loc *time.Location) (time.Time, error) {
+	asOf, err := time.Parse(time.RFC3339, value)
+	if err == nil {
+		return asOf, nil
+	}
+
+	for _, layout := range asOfLayouts {
+		asOf, err := time.ParseInLocation(layout, value, loc)
+		if err == nil {
+			return asOf, nil
+		}
+	}
+
+	day, err := time.ParseInLocation(time.DateOnly, value, loc)
+	if err == nil {
+		return day.AddDate(0, 0, 1).Add(-time.Nanosecond), nil
+	}
+
+	return time.Time{}, fmt.Errorf("invalid point in time %q, expected an RFC 3339 timestamp, YYYY-MM-DD HH:MM[:SS] or YYYY-MM-DD", value)
+}
+
+// archiveAsOf returns the key of the newest archive in the provided bucket uploaded at or
+// before the provided time. Restoring it restores the backup chain it builds on.
+func archiveAsOf(ctx context.Context, cfg *s3Config, asOf time.Time) (string, error) {
+	archives, err := listArchives(ctx, cfg)
+	if err != nil {
+		return "", err
+	}
+
+	// Archive keys sort by creation time, which their upload time follows.
+	for _, archive := range archives {
+		if !archive.Modified.After(asOf) {
+			return archive.Key, nil
+		}
+	}
+
+	return "", fmt.Errorf("no archive uploaded as of %s", asOf.Format(time.RFC3339))
+}
+
+// pruneArchives deletes the archives in the provided bucket uploaded before the provided
+// time, always keeping the provided number of newest archives. It returns the deleted
+// archives, or the archives which would be deleted on a dry run. Archives still under object
+// lock retention or under legal hold are kept, as are the archives kept archives build on,
+// so every backup chain left stays restorable.
+func pruneArchives(ctx context.Context, cfg *s3Config, before time.Time, keep int, dryRun bool) ([]storage.Object, error) {
+	archives, err := listArchives(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	store, err := cfg.openStorage(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer store.Close()
+
+	// Archives under legal hold are kept, only buckets hold archives.
+	var mnc *minio.Client
+	if cfg.OpenStorage == nil {
+		mnc, err = minio.New(cfg.Endpoint, cfg.Options)
+		if err != nil {
+			return nil, fmt.Errorf("creating minio client: %w", err)
+		}
+	}
+
+	now := time.Now()
+	kept := make(map[string]bool)
+	for i, archive := range archives {
+		if i < keep || !archive.Modified.Before(before) {
+			kept[archive.Key] = true
+			continue
+		}
+
+		protected, err := protectedArchive(ctx, mnc, cfg, archive, now)
+		if err != nil {
+			return nil, err
+		}
+		if protected {
+			kept[archive.Key] = true
+		}
+	}
+
+	bases, err := archiveBases(ctx, store, archives)
+	if err != nil {
+		return nil, err
+	}
+	keepBases(kept, bases)
+
+	// Archives are listed newest first, archives are deleted before the bases they build on.
+	var pruned []storage.Object
+	for _, archive := range archives {
+		if kept[archive.Key] {
+			continue
+		}
+
+		if !dryRun {
+			err := removeArchive(ctx, store, archive.Key)
+			if err != nil {
+				return pruned, err
+			}
+		}
+
+		pruned = append(pruned, archive)
+	}
+
+	// Delete the chunks only referenced by pruned deduplicated archives.
+	if !dryRun && slices.ContainsFunc(pruned, func(archive storage.Object) bool { return isRecipeKey(archive.Key) }) {
+		err = pruneChunks(ctx, mnc, cfg, before)
+		if err != nil {
+			return pruned, err
+		}
+	}
+
+	return pruned, nil
+}
+
+// archiveBases returns the keys of the archives the provided archives build on, read from
+// their manifests, by the keys of the incremental, differential and delta archives.
+func archiveBases(ctx context.Context, store storage.Storage, archives []storage.Object) (map[string]string, error) {
+	bases := make(map[string]string)
+	for _, archive := range archives {
+		manifest, err := readStoreManifest(ctx, store, archive.Key)
+		if err != nil {
+			return nil, err
+		}
+
+		if manifest != nil && manifest.Base != "" {
+			bases[archive.Key] = manifest.Base
+		}
+	}
+
+	return bases, nil
+}
+
+// archiveChains groups the provided archives, listed newest first, into backup chains: an
+// archive along with every archive building on it, directly or through other archives.
+// Chains are returned oldest first and hold their archives newest first, so archives precede
+// the bases they build on.
+func archiveChains(archives []storage.Object, bases map[string]string) [][]storage.Object {
+	listed := make(map[string]bool, len(archives))
+	for _, archive := range archives {
+		listed[archive.Key] = true
+	}
+
+	// Archives whose base is gone start their own chain.
+	root := func(key string) string {
+		for n := 0; n < maxChainLength; n++ {
+			base, ok := bases[key]
+			if !ok || !listed[base] {
+				break
+			}
+			key = base
+		}
+
+		return key
+	}
+
+	var chains [][]storage.Object
+	chainIndex := make(map[string]int)
+	for i := len(archives) - 1; i >= 0; i-- {
+		key := root(archives[i].Key)
+		index, ok := chainIndex[key]
+		if !ok {
+			index = len(chains)
+			chainIndex[key] = index
+			chains = append(chains, nil)
+		}
+		chains[index] = append(chains[index], archives[i])
+	}
+
+	for _, chain := range chains {
+		slices.Reverse(chain)
+	}
+
+	return chains
+}
+
+// keepBases adds the archives the provided kept archives build on, directly or through
+// other archives, to the kept archives.
+func keepBases(kept map[string]bool, bases map[string]string) {
+	for key := range kept {
+		base := bases[key]
+		for n := 0; base != "" && !kept[base] && n < maxChainLength; n++ {
+			kept[base] = true
+			base = bases[base]
+		}
+	}
+}
+
+// protectedArchive returns whether the provided archive cannot be deleted, because it is
+// still under object lock retention or under legal hold. Legal holds are only checked with a
+// client of the bucket.
+func protectedArchive(ctx context.Context, mnc *minio.Client, cfg *s3Config, archive storage.Object, now time.Time) (bool, error) {
+	if cfg.Retention.locked(archive.Modified, now) {
+		return true, nil
+	}
+
+	if mnc == nil {
+		return false, nil
+	}
+
+	return legalHold(ctx, mnc, cfg.Bucket, archive.Key)
+}
+
+// removeArchive deletes the archive with the provided key along with its manifest and parity
+// data.
+func removeArchive(ctx context.Context, store storage.Storage, key string) error {
+	err := store.Remove(ctx, key)
+	if err != nil {
+		return fmt.Errorf("deleting archive %s: %w", key, err)
+	}
+
+	err = store.Remove(ctx, manifestKey(key))
+	if err != nil {
+		return fmt.Errorf("deleting manifest of %s: %w", key, err)
+	}
+
+	err = store.Remove(ctx, parityKey(key))
+	if err != nil {
+		return fmt.Errorf("deleting parity data of %s: %w", key, err)
+	}
+
+	return nil
+}
+
+// extractZip extracts the entries of the provided zip file into the provided directory with
+// the provided options.
+func extractZip(zipPath string, targetDir string, opts extractOptions) (int, int64, error) {
+	reader, err := zip.OpenReader(zipPath)
+	if err != nil {
+		return 0, 0, fmt.Errorf("opening archive: %w", err)
+	}
+	defer reader.Close()
+
+	return extractZipReader(&reader.Reader, targetDir, opts)
+}
+
+// extractZipReader extracts the entries of the provided zip archive into the provided
+// directory with the provided options. Entries escaping the directory are rejected. Hard
+// links to files which are not extracted get a copy of the file's content.
+func extractZipReader(reader *zip.Reader, targetDir string, opts extractOptions) (int, int64, error) {
+	if opts.extracted == nil {
+		opts.extracted = make(map[string]bool)
+	}
+
+	entries := make(map[string]*zip.File, len(reader.File))
+	for _, entry := range reader.File {
+		entries[entry.Name] = entry
+	}
+
+	var files int
+	var size int64
+	for _, entry := range reader.File {
+		if !filepath.IsLocal(entry.Name) {
+			return files, size, fmt.Errorf("archive entry %q escapes the target directory", entry.Name)
+		}
+
+		name, ok := opts.targetName(entry.Name)
+		if !ok {
+			continue
+		}
+
+		target := filepath.Join(targetDir, filepath.FromSlash(name))
+		if entry.FileInfo().IsDir() {
+			err := checkNoLinks(targetDir, target)
+			if err != nil {
+				return files, size, fmt.Errorf("extracting %s: %w", entry.Name, err)
+			}
+			err = os.MkdirAll(target, 0755)
+			if err == nil {
+				err = restoreOwner(target, entry)
+			}
+			if err == nil {
+				err = restoreXattrs(target, entry)
+			}
+			if err != nil {
+				return files, size, err
+			}
+			continue
+		}
+
+		err := checkNoLinks(targetDir, filepath.Dir(target))
+		if err != nil {
+			return files, size, fmt.Errorf("extracting %s: %w", entry.Name, err)
+		}
+
+		keep, err := opts.keep(target, entry.Modified)
+		if err != nil {
+			return files, size, fmt.Errorf("extracting %s: %w", entry.Name, err)
+		}
+		if keep {
+			continue
+		}
+
+		err = os.MkdirAll(filepath.Dir(target), 0755)
+		if err != nil {
+			return files, size, err
+		}
+
+		var n int64
+		switch {
+		case strings.HasPrefix(entry.Comment, hardLinkComment):
+			// Links to files which are not extracted get a copy of their content instead.
+			linkedName := strings.TrimPrefix(entry.Comment, hardLinkComment)
+			name, extracted := opts.targetName(linkedName)
+			linked, ok := entries[linkedName]
+			if ok && !extracted {
+				n, err = extractZipEntry(linked, target)
+			} else {
+				err = extractHardLink(name, target, targetDir)
+			}
+
+		case entry.Mode()&os.ModeSymlink != 0:
+			err = extractZipLink(entry, target, targetDir)
+
+		default:
+			n, err = extractZipEntry(entry, target)
+		}
+		if err == nil {
+			err = restoreOwner(target, entry)
+		}
+		// Extended attributes are set once owned, changing the owner clears capabilities.
+		if err == nil {
+			err = restoreXattrs(target, entry)
+		}
+		if err != nil {
+			return files, size, fmt.Errorf("extracting %s: %w", entry.Name, err)
+		}
+
+		opts.extracted[target] = true
+		files++
+		size += n
+	}
+
+	return files, size, nil
+}
+
+// zipCreatorUnix is the creator host system of zip entries with POSIX mode bits.
+const zipCreatorUnix = 3
+
+// extractZipEntry writes the contents of the provided zip entry to the provided path. The
+// modification time and permissions of the entry are restored, if the archive recorded them.
+// Symbolic links at the path are replaced rather than written through.
+func extractZipEntry(entry *zip.File, target string) (int64, error) {
+	info, err := os.Lstat(target)
+	if err == nil && info.Mode()&os.ModeSymlink != 0 {
+		err = os.Remove(target)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	src, err := entry.Open()
+	if err != nil {
+		return 0, err
+	}
+	defer src.Close()
+
+	dst, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return 0, err
+	}
+	defer dst.Close()
+
+	n, err := copyBuffers().copy(dst, src)
+	if err != nil {
+		return n, err
+	}
+
+	err = dst.Close()
+	if err != nil {
+		return n, err
+	}
+
+	// Set the permissions explicitly, existing files keep theirs when opened and new ones
+	// are subject to the umask.
+	if entry.CreatorVersion>>8 == zipCreatorUnix {
+		err = os.Chmod(target, entry.Mode().Perm())
+		if err != nil {
+			return n, err
+		}
+	}
+
+	// Entries of archives made without modification times have no MS-DOS date either.
+	if entry.ModifiedDate != 0 || entry.ModifiedTime != 0 {
+		err = os.Chtimes(target, entry.Modified, entry.Modified)
+	}
+
+	return n, err
+}
+
+// downloadArchive downloads the zip file of the archive with the provided key into the
+// provided directory and returns its path. Delta archives are applied to the zip file at the
+// provided base path.
+func downloadArchive(ctx context.Context, mnc *minio.Client, bucket string, key string, basePath string, targetDir string) (string, error) {
+	// Download next to the target directory, the zip format requires random access.
+	tmp, err := os.CreateTemp(targetDir, ".restore-*.zip")
+	if err != nil {
+		return "", fmt.Errorf("creating download file: %w", err)
+	}
+
+	switch {
+	// Deduplicated archives are reassembled from their chunks.
+	case isRecipeKey(key):
+		err = downloadRecipe(ctx, mnc, bucket, key, tmp)
+		err = errors.Join(err, tmp.Close())
+
+	case isDeltaKey(key):
+		var base *os.File
+		base, err = os.Open(basePath)
+		if err == nil {
+			err = downloadDelta(ctx, mnc, bucket, key, base, tmp)
+			base.Close()
+		}
+		err = errors.Join(err, tmp.Close())
+
+	default:
+		tmp.Close()
+		err = mnc.FGetObject(ctx, bucket, key, tmp.Name(), minio.GetObjectOptions{})
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return "", fmt.Errorf("downloading archive %s: %w", key, err)
+	}
+
+	return tmp.Name(), nil
+}
+
+// restoreArchive downloads the archive with the provided key from the provided bucket and
+// extracts it into the provided directory. Without a key, the newest archive is restored.
+// Incremental and differential archives are restored by extracting the archives of their
+// backup chain, oldest first. Delta archives are applied to the archive they follow.
+func restoreArchive(ctx context.Context, cfg *s3Config, key string, targetDir string) (*restoreResult, error) {
+	return restoreArchiveFiles(ctx, cfg, key, targetDir, extractOptions{})
+}
+
+// restoreArchiveFiles restores the archive with the provided key like restoreArchive, with
+// the provided extract options. When only some entries are extracted, only those of zip
+// archives in S3 are downloaded, other archives are downloaded whole.
+func restoreArchiveFiles(ctx context.Context, cfg *s3Config, key string, targetDir string, opts extractOptions) (*restoreResult, error) {
+	if key == "" {
+		archives, err := listArchives(ctx, cfg)
+		if err != nil {
+			return nil, err
+		}
+		if len(archives) == 0 {
+			return nil, errors.New("no archives to restore")
+		}
+		key = archives[0].Key
+	}
+
+	// Only archives can be restored, not arbitrary objects of the bucket.
+	if !isArchiveKey(cfg, key) {
+		return nil, fmt.Errorf("%s is not an archive", key)
+	}
+
+	// Backup chains and delta archives are only stored in S3.
+	if cfg.OpenStorage != nil {
+		return restoreStoreArchive(ctx, cfg, key, targetDir, opts)
+	}
+
+	mnc, err := minio.New(cfg.Endpoint, cfg.Options)
+	if err != nil {
+		return nil, fmt.Errorf("creating minio client: %w", err)
+	}
+
+	err = os.MkdirAll(targetDir, 0755)
+	if err != nil {
+		return nil, fmt.Errorf("creating target directory: %w", err)
+	}
+
+	chain, err := backupChain(ctx, mnc, cfg.Bucket, key)
+	if err != nil {
+		return nil, err
+	}
+
+	if isDeltaKey(chain[0]) {
+		return nil, fmt.Errorf("base of delta archive %s not found", chain[0])
+	}
+
+	// Files extracted from earlier archives of the chain are replaced by later ones.
+	opts.extracted = make(map[string]bool)
+	result := &restoreResult{Key: key, Chain: chain}
+	var basePath string
+	defer func() { os.Remove(basePath) }()
+	for i, archive := range chain {
+		if !isArchiveKey(cfg, archive) {
+			return nil, fmt.Errorf("%s is not an archive", archive)
+		}
+
+		// Selected entries of zip archives are read in place.
+		deltaBase := i+1 < len(chain) && isDeltaKey(chain[i+1])
+		if opts.selective() && !deltaBase && !isRecipeKey(archive) && !isDeltaKey(archive) {
+			files, size, err := extractRemoteZip(ctx, mnc, cfg.Bucket, archive, targetDir, opts)
+			if err != nil {
+				return nil, err
+			}
+
+			result.Files += files
+			result.Bytes += size
+			continue
+		}
+
+		zipPath, err := downloadArchive(ctx, mnc, cfg.Bucket, archive, basePath, targetDir)
+		os.Remove(basePath)
+		basePath = ""
+		if err != nil {
+			return nil, err
+		}
+
+		// Damaged zip archives are repaired with their parity data.
+		if !isRecipeKey(archive) && !isDeltaKey(archive) {
+			repaired, err := repairDownload(ctx, &s3Storage{mnc: mnc, bucket: cfg.Bucket}, archive, zipPath)
+			if err != nil {
+				os.Remove(zipPath)
+				return nil, err
+			}
+			if repaired > 0 {
+				result.Repaired = append(result.Repaired, archive)
+			}
+		}
+
+		// Archives followed by a delta are its base rather than extracted.
+		if deltaBase {
+			basePath = zipPath
+			continue
+		}
+
+		files, size, err := extractZip(zipPath, targetDir, opts)
+		os.Remove(zipPath)
+		if err != nil {
+			return nil, err
+		}
+
+		result.Files += files
+		result.Bytes += size
+	}
+
+	return result, nil
+}
+
+// runRestoreCommand restores a remote archive of a job into a local directory.
+func runRestoreCommand(cfg *Config, args []string, out io.Writer) error {
+	fs := flag.NewFlagSet("restore", flag.ContinueOnError)
+	job := fs.String("job", "", "Job to restore an archive of, optional when a single job is configured")
+	key := fs.String("key", "", "Key of the archive to restore (defaults to the newest archive)")
+	targetDir := fs.String("target", "", "Directory to extract the archive into (defaults to the job's source directory)")
+	fs.StringVar(targetDir, "target-dir", "", "Alias of -target")
+	asOf := fs.String("as-of", "", "Restore the newest archive uploaded at or before this time, e.g. 2026-01-05 12:00")
+	var opts extractOptions
+	fs.Var(&opts.Include, "include", "Only restore the files matching this pattern, e.g. 'customers/acme/**' (repeatable)")
+	fs.StringVar(&opts.Overwrite, "overwrite", overwriteAlways, "Policy for files which already exist: never, newer or always")
+	stripPrefix := fs.String("strip-prefix", "", "Directory removed from the restored paths, files outside it are not restored")
+	err := fs.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	if *key != "" && *asOf != "" {
+		return errors.New("-key and -as-of are exclusive")
+	}
+
+	err = validateOverwritePolicy(opts.Overwrite)
+	if err != nil {
+		return err
+	}
+
+	opts.StripPrefix = strings.Trim(*stripPrefix, "/")
+	if *stripPrefix != "" && !filepath.IsLocal(opts.StripPrefix) {
+		return fmt.Errorf("invalid strip prefix %q", *stripPrefix)
+	}
+
+	logger := zerolog.Nop()
+	resolver := newJobResolver(func() *Config { return cfg }, &logger)
+	jobCfg, s3Cfg, err := resolver.job(*job)
+	if err != nil {
+		return err
+	}
+
+	if *targetDir == "" {
+		*targetDir = jobCfg.SourceDir
+	}
+
+	ctx := context.Background()
+	if *asOf != "" {
+		pointInTime, err := parseAsOf(*asOf, cfg.location())
+		if err != nil {
+			return err
+		}
+
+		*key, err = archiveAsOf(ctx, s3Cfg, pointInTime)
+		if err != nil {
+			return err
+		}
+	}
+
+	result, err := restoreArchiveFiles(ctx, s3Cfg, *key, *targetDir, opts)
+	if err != nil {
+		return err
+	}
+
+	for _, repaired := range result.Repaired {
+		fmt.Fprintf(out, "Repaired damaged archive %s with its parity data\n", repaired)
+	}
+	fmt.Fprintf(out, "Restored %s from %d archives: %d files, %s into %s\n", result.Key, len(result.Chain),
+		result.Files, humanize.IBytes(uint64(result.Bytes)), *targetDir)
+	return nil
+}
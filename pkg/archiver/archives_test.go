@@ -0,0 +1,262 @@
+package archiver
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/peterldowns/testy/assert"
+)
+
+// zipBytes returns a zip archive of the provided files.
+func zipBytes(t *testing.T, files map[string]string) []byte {
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	for name, content := range files {
+		f, err := w.Create(name)
+		assert.NoError(t, err)
+		_, err = f.Write([]byte(content))
+		assert.NoError(t, err)
+	}
+	assert.NoError(t, w.Close())
+
+	return buf.Bytes()
+}
+
+// putArchives uploads the provided archives to the fake server.
+func putArchives(t *testing.T, cfg *s3Config, archives map[string][]byte) {
+	mnc, err := minio.New(cfg.Endpoint, cfg.Options)
+	assert.NoError(t, err)
+
+	for key, data := range archives {
+		_, err = mnc.PutObject(context.Background(), cfg.Bucket, key, bytes.NewReader(data), int64(len(data)), minio.PutObjectOptions{})
+		assert.NoError(t, err)
+	}
+}
+
+func TestArchives(t *testing.T) {
+	fake := newFakeS3(t, "test-bucket")
+	cfg := fake.s3Config("test-bucket")
+	cfg.Prefix = "backups"
+	ctx := context.Background()
+
+	putArchives(t, cfg, map[string][]byte{
+		"backups/dump-20260101235000.zip": zipBytes(t, map[string]string{"users.sql": "old"}),
+		"backups/dump-20260102235000.zip": zipBytes(t, map[string]string{"users.sql": "new", "orders/2026.csv": "1,2"}),
+		"backups/catalog/db.jsonl.gz":     []byte("index"),
+		"other/dump-20260101235000.zip":   []byte("other"),
+	})
+
+	// Ensure only archives of the prefix are listed, newest first.
+	archives, err := listArchives(ctx, cfg)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(archives))
+	assert.Equal(t, "backups/dump-20260102235000.zip", archives[0].Key)
+
+	// Ensure the newest archive is restored by default.
+	target := t.TempDir()
+	result, err := restoreArchive(ctx, cfg, "", target)
+	assert.NoError(t, err)
+	assert.Equal(t, "backups/dump-20260102235000.zip", result.Key)
+	assert.Equal(t, 2, result.Files)
+	data, err := os.ReadFile(filepath.Join(target, "orders", "2026.csv"))
+	assert.NoError(t, err)
+	assert.Equal(t, "1,2", string(data))
+
+	// Ensure objects other than archives are not restored.
+	_, err = restoreArchive(ctx, cfg, "backups/catalog/db.jsonl.gz", target)
+	assert.Error(t, err)
+
+	// Ensure the newest archives are kept when pruning, and dry runs delete nothing.
+	pruned, err := pruneArchives(ctx, cfg, time.Now().Add(time.Hour), 1, true)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(pruned))
+	assert.True(t, fake.object("test-bucket", "backups/dump-20260101235000.zip") != nil)
+
+	pruned, err = pruneArchives(ctx, cfg, time.Now().Add(time.Hour), 1, false)
+	assert.NoError(t, err)
+	assert.Equal(t, "backups/dump-20260101235000.zip", pruned[0].Key)
+	assert.True(t, fake.object("test-bucket", "backups/dump-20260101235000.zip") == nil)
+	assert.True(t, fake.object("test-bucket", "backups/dump-20260102235000.zip") != nil)
+
+	// Ensure recent archives are not pruned.
+	pruned, err = pruneArchives(ctx, cfg, time.Now().Add(-time.Hour), 0, false)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, len(pruned))
+}
+
+// chainArchives returns archives with manifests building on the provided bases, by key.
+func chainArchives(t *testing.T, bases map[string]string) map[string][]byte {
+	archives := make(map[string][]byte)
+	for key, base := range bases {
+		archives[key] = zipBytes(t, map[string]string{"users.sql": key})
+		manifest, err := json.Marshal(archiveManifest{Key: key, Type: backupFull, Base: base})
+		assert.NoError(t, err)
+		if base != "" {
+			manifest, err = json.Marshal(archiveManifest{Key: key, Type: backupDifferential, Base: base})
+			assert.NoError(t, err)
+		}
+		archives[manifestKey(key)] = manifest
+	}
+
+	return archives
+}
+
+func TestPruneArchivesChains(t *testing.T) {
+	fake := newFakeS3(t, "test-bucket")
+	cfg := fake.s3Config("test-bucket")
+	ctx := context.Background()
+	future := time.Now().Add(time.Hour)
+
+	// orphans returns the remaining archives whose base was deleted.
+	orphans := func() []string {
+		archives, err := listArchives(ctx, cfg)
+		assert.NoError(t, err)
+		var orphaned []string
+		for _, archive := range archives {
+			manifest := fake.object("test-bucket", manifestKey(archive.Key))
+			var decoded archiveManifest
+			assert.NoError(t, json.Unmarshal(manifest.data, &decoded))
+			if decoded.Base != "" && fake.object("test-bucket", decoded.Base) == nil {
+				orphaned = append(orphaned, archive.Key)
+			}
+		}
+
+		return orphaned
+	}
+
+	putArchives(t, cfg, chainArchives(t, map[string]string{
+		"dump-20260104235000.zip": "",
+		"dump-20260105235000.zip": "dump-20260104235000.zip",
+		"dump-20260106235000.zip": "dump-20260104235000.zip",
+	}))
+
+	// Ensure the full archive kept differentials build on is kept.
+	pruned, err := pruneArchives(ctx, cfg, future, 1, false)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(pruned))
+	assert.Equal(t, "dump-20260105235000.zip", pruned[0].Key)
+	assert.True(t, fake.object("test-bucket", "dump-20260104235000.zip") != nil)
+	assert.Equal(t, 0, len(orphans()))
+
+	// Ensure incremental chains keep every archive in between, and older chains are pruned
+	// as a whole.
+	putArchives(t, cfg, chainArchives(t, map[string]string{
+		"dump-20260111235000.zip": "",
+		"dump-20260112235000.zip": "dump-20260111235000.zip",
+		"dump-20260113235000.zip": "dump-20260112235000.zip",
+	}))
+	pruned, err = pruneArchives(ctx, cfg, future, 1, false)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(pruned))
+	assert.Equal(t, "dump-20260106235000.zip", pruned[0].Key)
+	assert.Equal(t, "dump-20260104235000.zip", pruned[1].Key)
+	archives, err := listArchives(ctx, cfg)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, len(archives))
+	assert.Equal(t, 0, len(orphans()))
+}
+
+func TestExtractZip(t *testing.T) {
+	// Ensure entries escaping the target directory are rejected.
+	zipPath := filepath.Join(t.TempDir(), "evil.zip")
+	err := os.WriteFile(zipPath, zipBytes(t, map[string]string{"../evil.txt": "evil"}), 0600)
+	assert.NoError(t, err)
+
+	target := t.TempDir()
+	_, _, err = extractZip(zipPath, target, extractOptions{})
+	assert.Error(t, err)
+	_, err = os.Stat(filepath.Join(filepath.Dir(target), "evil.txt"))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestRestoreCommand(t *testing.T) {
+	fake := newFakeS3(t, "test-bucket")
+	s3Cfg := fake.s3Config("test-bucket")
+	putArchives(t, s3Cfg, map[string][]byte{
+		"dump-20260101235000.zip": zipBytes(t, map[string]string{"users.sql": "data"}),
+	})
+
+	sourceDir := t.TempDir()
+	cfg := &Config{
+		Endpoint:        s3Cfg.Endpoint,
+		AccessKeyID:     "test-accesskeyid",
+		SecretAccessKey: "test-secretaccesskey",
+		Jobs:            []jobConfig{{Name: "db", SourceDir: sourceDir, Bucket: "test-bucket"}},
+		staticCreds:     true,
+		transport:       s3Cfg.Options.Transport,
+	}
+
+	// Ensure the archive is restored into the job's source directory by default.
+	var out bytes.Buffer
+	err := runCommand(cfg, []string{"restore"}, &out)
+	assert.NoError(t, err)
+	assert.True(t, strings.Contains(out.String(), "dump-20260101235000.zip"))
+	data, err := os.ReadFile(filepath.Join(sourceDir, "users.sql"))
+	assert.NoError(t, err)
+	assert.Equal(t, "data", string(data))
+
+	// Ensure unknown jobs are rejected.
+	err = runCommand(cfg, []string{"restore", "-job", "logs"}, &out)
+	assert.Error(t, err)
+}
+
+func TestRestoreAsOf(t *testing.T) {
+	fake := newFakeS3(t, "test-bucket")
+	s3Cfg := fake.s3Config("test-bucket")
+	incremental := archiveManifest{Key: "dump-20260102235000.zip", Type: backupIncremental, Base: "dump-20260101235000.zip"}
+	manifest, err := json.Marshal(incremental)
+	assert.NoError(t, err)
+	putArchives(t, s3Cfg, map[string][]byte{
+		"dump-20260101235000.zip":           zipBytes(t, map[string]string{"users.sql": "v1", "orders.sql": "v1"}),
+		"dump-20260102235000.zip":           zipBytes(t, map[string]string{"users.sql": "v2"}),
+		"dump-20260102235000.manifest.json": manifest,
+		"dump-20260103235000.zip":           zipBytes(t, map[string]string{"users.sql": "v3"}),
+	})
+	for i, key := range []string{"dump-20260101235000.zip", "dump-20260102235000.zip", "dump-20260103235000.zip"} {
+		fake.object("test-bucket", key).modified = time.Date(2026, time.January, 1+i, 23, 55, 0, 0, time.UTC)
+	}
+
+	cfg := &Config{
+		Endpoint:        s3Cfg.Endpoint,
+		AccessKeyID:     "test-accesskeyid",
+		SecretAccessKey: "test-secretaccesskey",
+		Timezone:        "UTC",
+		Jobs:            []jobConfig{{Name: "db", SourceDir: t.TempDir(), Bucket: "test-bucket"}},
+		staticCreds:     true,
+		transport:       s3Cfg.Options.Transport,
+	}
+
+	// Ensure the newest archive uploaded as of the point in time is restored with its chain.
+	target := t.TempDir()
+	var out bytes.Buffer
+	err = runCommand(cfg, []string{"restore", "-as-of", "2026-01-03 12:00", "-target", target}, &out)
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(out.String(), "Restored dump-20260102235000.zip from 2 archives"))
+	for name, want := range map[string]string{"users.sql": "v2", "orders.sql": "v1"} {
+		data, err := os.ReadFile(filepath.Join(target, name))
+		assert.NoError(t, err)
+		assert.Equal(t, want, string(data))
+	}
+
+	// Ensure dates include the whole day.
+	out.Reset()
+	err = runCommand(cfg, []string{"restore", "-as-of", "2026-01-03", "-target", t.TempDir()}, &out)
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(out.String(), "Restored dump-20260103235000.zip from 1 archives"))
+
+	// Ensure points in time before the first archive, invalid times and keys are rejected.
+	err = runCommand(cfg, []string{"restore", "-as-of", "2026-01-01T12:00:00Z", "-target", t.TempDir()}, &out)
+	assert.Error(t, err)
+	err = runCommand(cfg, []string{"restore", "-as-of", "yesterday"}, &out)
+	assert.Error(t, err)
+	err = runCommand(cfg, []string{"restore", "-as-of", "2026-01-03", "-key", "dump-20260101235000.zip"}, &out)
+	assert.Error(t, err)
+}
@@ -0,0 +1,553 @@
+package archiver
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dnldd/zdts3/pkg/storage"
+)
+
+const (
+	// b2AuthURL is the URL of the B2 native API's account authorization.
+	b2AuthURL = "https://api.backblazeb2.com/b2api/v2/b2_authorize_account"
+	// b2UploadAttempts is the number of attempts of uploading a file or part, B2 asks clients
+	// to retry failed uploads with a new upload URL.
+	b2UploadAttempts = 3
+	// b2RequestTimeout is the maximum duration of B2 API requests other than uploads and
+	// downloads.
+	b2RequestTimeout = time.Minute
+	// b2ListCount is the maximum number of files listed per request.
+	b2ListCount = 1000
+)
+
+// b2Config is the access configuration of a B2 bucket through the B2 native API.
+type b2Config struct {
+	// KeyID is the ID of the application key.
+	KeyID string
+	// ApplicationKey is the secret of the application key.
+	ApplicationKey string
+	// BucketID is the ID of the bucket archives are stored in.
+	BucketID string
+	// AuthURL is the URL of the account authorization, the B2 production API unless set.
+	AuthURL string
+	// Transport is the HTTP transport of B2 requests, the default one if nil.
+	Transport http.RoundTripper
+}
+
+// b2Auth is the subset of the account authorization response used by the store.
+type b2Auth struct {
+	AuthorizationToken  string `json:"authorizationToken"`
+	APIURL              string `json:"apiUrl"`
+	DownloadURL         string `json:"downloadUrl"`
+	RecommendedPartSize int64  `json:"recommendedPartSize"`
+}
+
+// b2Error is the error response of the B2 native API.
+type b2Error struct {
+	Status  int    `json:"status"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// Error returns the message of the error.
+func (e *b2Error) Error() string {
+	return fmt.Sprintf("b2 %d %s: %s", e.Status, e.Code, e.Message)
+}
+
+// Is reports missing files as fs.ErrNotExist.
+func (e *b2Error) Is(target error) bool {
+	return target == fs.ErrNotExist && e.Status == http.StatusNotFound
+}
+
+// retryable returns whether the upload should be retried with a new upload URL.
+func (e *b2Error) retryable() bool {
+	return e.Status == http.StatusUnauthorized || e.Status == http.StatusRequestTimeout ||
+		e.Status == http.StatusTooManyRequests || e.Status >= 500
+}
+
+// b2File is the subset of a B2 file description used by the store.
+type b2File struct {
+	FileID          string            `json:"fileId"`
+	FileName        string            `json:"fileName"`
+	Action          string            `json:"action"`
+	ContentLength   int64             `json:"contentLength"`
+	ContentSha1     string            `json:"contentSha1"`
+	FileInfo        map[string]string `json:"fileInfo"`
+	UploadTimestamp int64             `json:"uploadTimestamp"`
+}
+
+// b2UploadURL is an upload URL of a file or of the parts of a large file.
+type b2UploadURL struct {
+	UploadURL          string `json:"uploadUrl"`
+	AuthorizationToken string `json:"authorizationToken"`
+}
+
+// open authorizes the account. The authorization token is registered for redaction.
+func (c *b2Config) open(ctx context.Context) (storage.Storage, error) {
+	authURL := c.AuthURL
+	if authURL == "" {
+		authURL = b2AuthURL
+	}
+
+	s := &b2Store{
+		bucketID: c.BucketID,
+		client:   &http.Client{Transport: c.Transport},
+	}
+
+	authCtx, cancel := context.WithTimeout(ctx, b2RequestTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(authCtx, http.MethodGet, authURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("creating b2 authorization request: %w", err)
+	}
+	req.SetBasicAuth(c.KeyID, c.ApplicationKey)
+
+	err = s.do(req, &s.auth)
+	if err != nil {
+		return nil, fmt.Errorf("authorizing b2 account: %w", err)
+	}
+	addSecrets(s.auth.AuthorizationToken)
+
+	return s, nil
+}
+
+// b2Store is an archive store in a B2 bucket, accessed through the B2 native API. Files are
+// uploaded with their SHA-1 checksums, which B2 verifies before storing them.
+type b2Store struct {
+	bucketID string
+	client   *http.Client
+	auth     b2Auth
+}
+
+// do performs the provided request and decodes its JSON response into the provided value.
+func (s *b2Store) do(req *http.Request, value any) error {
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		return decodeB2Error(resp)
+	}
+
+	if value == nil {
+		return nil
+	}
+
+	return json.NewDecoder(resp.Body).Decode(value)
+}
+
+// call calls the provided B2 API operation with the provided JSON body and decodes its
+// response into the provided value.
+func (s *b2Store) call(ctx context.Context, operation string, body any, value any) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, b2RequestTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.auth.APIURL+"/b2api/v2/"+operation, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", s.auth.AuthorizationToken)
+	req.Header.Set("Content-Type", "application/json")
+
+	err = s.do(req, value)
+	if err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	return nil
+}
+
+// decodeB2Error returns the error of the provided failed response.
+func decodeB2Error(resp *http.Response) error {
+	b2Err := &b2Error{Status: resp.StatusCode}
+	err := json.NewDecoder(resp.Body).Decode(b2Err)
+	if err != nil || b2Err.Code == "" {
+		b2Err.Code, b2Err.Message = "unknown", resp.Status
+	}
+	b2Err.Status = resp.StatusCode
+
+	return b2Err
+}
+
+// fileNameHeader encodes the provided file name for the X-Bz-File-Name header.
+func fileNameHeader(name string) string {
+	segments := strings.Split(name, "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+
+	return strings.Join(segments, "/")
+}
+
+// partSize returns the size of the parts of large files, files larger than a single part
+// are uploaded as large files.
+func (s *b2Store) partSize() int64 {
+	return s.auth.RecommendedPartSize
+}
+
+// PutFile uploads the file at the provided path as the provided key, as a large file of
+// several parts if it exceeds the recommended part size.
+func (s *b2Store) PutFile(ctx context.Context, key string, localPath string) (int64, error) {
+	f, err := os.Open(localPath)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return 0, err
+	}
+
+	if s.partSize() > 0 && info.Size() > s.partSize() {
+		err := s.putLargeFile(ctx, key, f, info.Size())
+		if err != nil {
+			return 0, err
+		}
+
+		return info.Size(), nil
+	}
+
+	hash, err := fileSHA1(f, 0, info.Size())
+	if err != nil {
+		return 0, err
+	}
+
+	err = s.upload(ctx, key, "application/zip", io.NewSectionReader(f, 0, info.Size()), info.Size(), hash)
+	if err != nil {
+		return 0, err
+	}
+	progressFrom(ctx).addBytes(info.Size())
+
+	return info.Size(), nil
+}
+
+// Put uploads the provided data as the provided key.
+func (s *b2Store) Put(ctx context.Context, key string, data []byte) error {
+	sum := sha1.Sum(data)
+	return s.upload(ctx, key, "application/json", bytes.NewReader(data), int64(len(data)), hex.EncodeToString(sum[:]))
+}
+
+// upload uploads the provided content with the provided SHA-1 checksum as the provided key,
+// retrying with a new upload URL as B2 requires.
+func (s *b2Store) upload(ctx context.Context, key string, contentType string, content io.ReadSeeker, size int64, hash string) error {
+	var err error
+	for attempt := 1; attempt <= b2UploadAttempts; attempt++ {
+		var uploadURL b2UploadURL
+		err = s.call(ctx, "b2_get_upload_url", map[string]string{"bucketId": s.bucketID}, &uploadURL)
+		if err != nil {
+			return err
+		}
+
+		_, err = content.Seek(0, io.SeekStart)
+		if err != nil {
+			return err
+		}
+
+		var file b2File
+		err = s.send(ctx, uploadURL, content, size, hash, map[string]string{
+			"X-Bz-File-Name": fileNameHeader(key),
+			"Content-Type":   contentType,
+		}, &file)
+		if err == nil {
+			if file.ContentSha1 != hash {
+				return fmt.Errorf("uploading %s: stored checksum %s does not match %s", key, file.ContentSha1, hash)
+			}
+			return nil
+		}
+
+		var b2Err *b2Error
+		if !errors.As(err, &b2Err) || !b2Err.retryable() {
+			break
+		}
+	}
+
+	return fmt.Errorf("uploading %s: %w", key, err)
+}
+
+// send sends the provided content with the provided SHA-1 checksum to the provided upload
+// URL. B2 rejects content not matching the checksum.
+func (s *b2Store) send(ctx context.Context, uploadURL b2UploadURL, content io.Reader, size int64, hash string, headers map[string]string, value any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, uploadURL.UploadURL, content)
+	if err != nil {
+		return err
+	}
+	req.ContentLength = size
+	req.Header.Set("Authorization", uploadURL.AuthorizationToken)
+	req.Header.Set("X-Bz-Content-Sha1", hash)
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+	addSecrets(uploadURL.AuthorizationToken)
+
+	return s.do(req, value)
+}
+
+// putLargeFile uploads the provided file of the provided size as a large file of several
+// parts. B2 verifies every part against its checksum, and the checksum of the whole file is
+// recorded in its large_file_sha1 info. Unfinished large files are cancelled.
+func (s *b2Store) putLargeFile(ctx context.Context, key string, f *os.File, size int64) error {
+	hash, err := fileSHA1(f, 0, size)
+	if err != nil {
+		return err
+	}
+
+	var file b2File
+	err = s.call(ctx, "b2_start_large_file", map[string]any{
+		"bucketId":    s.bucketID,
+		"fileName":    key,
+		"contentType": "application/zip",
+		"fileInfo":    map[string]string{"large_file_sha1": hash},
+	}, &file)
+	if err != nil {
+		return fmt.Errorf("uploading %s: %w", key, err)
+	}
+
+	err = s.uploadParts(ctx, file.FileID, f, size)
+	if err != nil {
+		// Release the uploaded parts, cancelling may fail for the same reason.
+		cancelErr := s.call(context.WithoutCancel(ctx), "b2_cancel_large_file", map[string]string{"fileId": file.FileID}, nil)
+		return fmt.Errorf("uploading %s: %w", key, errors.Join(err, cancelErr))
+	}
+
+	return nil
+}
+
+// uploadParts uploads the provided file of the provided size as the parts of the large file
+// with the provided ID and finishes the large file.
+func (s *b2Store) uploadParts(ctx context.Context, fileID string, f *os.File, size int64) error {
+	var hashes []string
+	for offset := int64(0); offset < size; offset += s.partSize() {
+		partSize := min(s.partSize(), size-offset)
+		hash, err := fileSHA1(f, offset, partSize)
+		if err != nil {
+			return err
+		}
+
+		err = s.uploadPart(ctx, fileID, len(hashes)+1, io.NewSectionReader(f, offset, partSize), partSize, hash)
+		if err != nil {
+			return err
+		}
+		hashes = append(hashes, hash)
+		progressFrom(ctx).addBytes(partSize)
+	}
+
+	return s.call(ctx, "b2_finish_large_file", map[string]any{"fileId": fileID, "partSha1Array": hashes}, nil)
+}
+
+// uploadPart uploads the provided part of a large file, retrying with a new upload URL as B2
+// requires.
+func (s *b2Store) uploadPart(ctx context.Context, fileID string, number int, part *io.SectionReader, size int64, hash string) error {
+	var err error
+	for attempt := 1; attempt <= b2UploadAttempts; attempt++ {
+		var uploadURL b2UploadURL
+		err = s.call(ctx, "b2_get_upload_part_url", map[string]string{"fileId": fileID}, &uploadURL)
+		if err != nil {
+			return err
+		}
+
+		_, err = part.Seek(0, io.SeekStart)
+		if err != nil {
+			return err
+		}
+
+		err = s.send(ctx, uploadURL, part, size, hash, map[string]string{
+			"X-Bz-Part-Number": strconv.Itoa(number),
+		}, nil)
+		if err == nil {
+			return nil
+		}
+
+		var b2Err *b2Error
+		if !errors.As(err, &b2Err) || !b2Err.retryable() {
+			break
+		}
+	}
+
+	return fmt.Errorf("part %d: %w", number, err)
+}
+
+// fileSHA1 returns the hex encoded SHA-1 checksum of the provided section of the provided
+// file.
+func fileSHA1(f *os.File, offset int64, size int64) (string, error) {
+	hash := sha1.New()
+	_, err := copyBuffers().copy(hash, io.NewSectionReader(f, offset, size))
+	if err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// listFiles lists up to the provided number of files whose names start with the provided
+// prefix, starting at the provided name, or every file without a limit. Without a delimiter,
+// files of nested folders are listed as well.
+func (s *b2Store) listFiles(ctx context.Context, operation string, prefix string, start string, delimiter string, limit int) ([]b2File, error) {
+	count := b2ListCount
+	if limit > 0 {
+		count = min(limit, b2ListCount)
+	}
+
+	var files []b2File
+	for {
+		body := map[string]any{"bucketId": s.bucketID, "prefix": prefix, "maxFileCount": count}
+		if start != "" {
+			body["startFileName"] = start
+		}
+		if delimiter != "" {
+			body["delimiter"] = delimiter
+		}
+
+		var resp struct {
+			Files        []b2File `json:"files"`
+			NextFileName *string  `json:"nextFileName"`
+		}
+		err := s.call(ctx, operation, body, &resp)
+		if err != nil {
+			return nil, err
+		}
+
+		files = append(files, resp.Files...)
+		if resp.NextFileName == nil || (limit > 0 && len(files) >= limit) {
+			return files, nil
+		}
+		start = *resp.NextFileName
+	}
+}
+
+// lookup returns the stored file with the provided key.
+func (s *b2Store) lookup(ctx context.Context, key string) (*b2File, error) {
+	files, err := s.listFiles(ctx, "b2_list_file_names", key, key, "", 1)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(files) == 0 || files[0].FileName != key {
+		return nil, &b2Error{Status: http.StatusNotFound, Code: "not_found", Message: key}
+	}
+
+	return &files[0], nil
+}
+
+// Get opens the stored file with the provided key.
+func (s *b2Store) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	file, err := s.lookup(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+
+	downloadURL := s.auth.DownloadURL + "/b2api/v2/b2_download_file_by_id?fileId=" + url.QueryEscape(file.FileID)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, downloadURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", s.auth.AuthorizationToken)
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		return nil, decodeB2Error(resp)
+	}
+
+	return resp.Body, nil
+}
+
+// Stat returns the size of the stored file with the provided key.
+func (s *b2Store) Stat(ctx context.Context, key string) (int64, error) {
+	file, err := s.lookup(ctx, key)
+	if err != nil {
+		return 0, err
+	}
+
+	return file.ContentLength, nil
+}
+
+// List returns the files stored directly under the provided prefix.
+func (s *b2Store) List(ctx context.Context, prefix string) ([]storage.Object, error) {
+	files, err := s.listFiles(ctx, "b2_list_file_names", prefix, "", "/", 0)
+	if err != nil {
+		return nil, err
+	}
+
+	var archives []storage.Object
+	for _, file := range files {
+		// Folders of nested files are listed as well.
+		if file.Action != "upload" {
+			continue
+		}
+
+		archives = append(archives, storage.Object{
+			Key:      file.FileName,
+			Size:     file.ContentLength,
+			Modified: time.UnixMilli(file.UploadTimestamp),
+		})
+	}
+
+	return archives, nil
+}
+
+// Remove deletes every version of the stored file with the provided key, if any.
+func (s *b2Store) Remove(ctx context.Context, key string) error {
+	versions, err := s.listFiles(ctx, "b2_list_file_versions", key, key, "", 0)
+	if err != nil {
+		return err
+	}
+
+	for _, version := range versions {
+		if version.FileName != key {
+			continue
+		}
+
+		err := s.call(ctx, "b2_delete_file_version", map[string]string{
+			"fileName": version.FileName,
+			"fileId":   version.FileID,
+		}, nil)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Presign returns storage.ErrNoLinks, private B2 buckets only share files through download
+// authorizations.
+func (s *b2Store) Presign(context.Context, string, time.Duration) (string, error) {
+	return "", storage.ErrNoLinks
+}
+
+// Check ensures the bucket's files can be listed with the application key.
+func (s *b2Store) Check(ctx context.Context) error {
+	_, err := s.listFiles(ctx, "b2_list_file_names", "", "", "", 1)
+	return err
+}
+
+// Close releases nothing, B2 authorizations expire on their own.
+func (s *b2Store) Close() error {
+	return nil
+}
@@ -0,0 +1,337 @@
+package archiver
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/peterldowns/testy/assert"
+	"github.com/rs/zerolog"
+)
+
+// fakeB2 is an in-memory B2 native API server of a single bucket. Like B2, it rejects
+// uploads not matching their SHA-1 checksum.
+type fakeB2 struct {
+	server   *httptest.Server
+	partSize int64
+
+	mtx     sync.Mutex
+	files   map[string]*b2File
+	content map[string][]byte
+	large   map[string]*fakeLargeFile
+	nextID  int
+	// failUploads is the number of upload requests failing with a retryable error.
+	failUploads int
+	// corrupt corrupts the content of the next upload, as a network fault would.
+	corrupt bool
+}
+
+// fakeLargeFile is an unfinished large file of the fake server.
+type fakeLargeFile struct {
+	file  b2File
+	parts map[int][]byte
+}
+
+// newFakeB2 starts a fake B2 server for the duration of the test.
+func newFakeB2(t *testing.T, partSize int64) *fakeB2 {
+	f := &fakeB2{
+		partSize: partSize,
+		files:    make(map[string]*b2File),
+		content:  make(map[string][]byte),
+		large:    make(map[string]*fakeLargeFile),
+	}
+	f.server = httptest.NewServer(http.HandlerFunc(f.handle))
+	t.Cleanup(f.server.Close)
+
+	return f
+}
+
+// config returns the access configuration of the fake bucket.
+func (f *fakeB2) config() *b2Config {
+	return &b2Config{
+		KeyID:          "test-keyid",
+		ApplicationKey: "test-applicationkey",
+		BucketID:       "test-bucketid",
+		AuthURL:        f.server.URL + "/b2api/v2/b2_authorize_account",
+	}
+}
+
+// fail writes a B2 error response.
+func (f *fakeB2) fail(w http.ResponseWriter, status int, code string) {
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(b2Error{Status: status, Code: code, Message: code})
+}
+
+// handle serves the B2 API operations used by the store.
+func (f *fakeB2) handle(w http.ResponseWriter, r *http.Request) {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+
+	operation := strings.TrimPrefix(r.URL.Path, "/b2api/v2/")
+	if operation == "b2_authorize_account" {
+		keyID, key, _ := r.BasicAuth()
+		if keyID != "test-keyid" || key != "test-applicationkey" {
+			f.fail(w, http.StatusUnauthorized, "bad_auth_token")
+			return
+		}
+
+		json.NewEncoder(w).Encode(b2Auth{
+			AuthorizationToken:  "test-account-token",
+			APIURL:              f.server.URL,
+			DownloadURL:         f.server.URL,
+			RecommendedPartSize: f.partSize,
+		})
+		return
+	}
+
+	if r.Header.Get("Authorization") != "test-account-token" && !strings.HasPrefix(r.URL.Path, "/upload/") {
+		f.fail(w, http.StatusUnauthorized, "bad_auth_token")
+		return
+	}
+
+	if strings.HasPrefix(r.URL.Path, "/upload/") {
+		f.upload(w, r)
+		return
+	}
+
+	if operation == "b2_download_file_by_id" {
+		for _, file := range f.files {
+			if file.FileID == r.URL.Query().Get("fileId") {
+				w.Write(f.content[file.FileName])
+				return
+			}
+		}
+		f.fail(w, http.StatusNotFound, "not_found")
+		return
+	}
+
+	var req struct {
+		BucketID      string            `json:"bucketId"`
+		FileID        string            `json:"fileId"`
+		FileName      string            `json:"fileName"`
+		FileInfo      map[string]string `json:"fileInfo"`
+		Prefix        string            `json:"prefix"`
+		Delimiter     string            `json:"delimiter"`
+		StartFileName string            `json:"startFileName"`
+		MaxFileCount  int               `json:"maxFileCount"`
+		PartSha1Array []string          `json:"partSha1Array"`
+	}
+	json.NewDecoder(r.Body).Decode(&req)
+
+	switch operation {
+	case "b2_get_upload_url":
+		json.NewEncoder(w).Encode(b2UploadURL{UploadURL: f.server.URL + "/upload/file", AuthorizationToken: "test-upload-token"})
+
+	case "b2_get_upload_part_url":
+		json.NewEncoder(w).Encode(b2UploadURL{UploadURL: f.server.URL + "/upload/part/" + req.FileID, AuthorizationToken: "test-upload-token"})
+
+	case "b2_start_large_file":
+		f.nextID++
+		file := b2File{FileID: fmt.Sprintf("large-%d", f.nextID), FileName: req.FileName, FileInfo: req.FileInfo}
+		f.large[file.FileID] = &fakeLargeFile{file: file, parts: make(map[int][]byte)}
+		json.NewEncoder(w).Encode(file)
+
+	case "b2_finish_large_file":
+		large := f.large[req.FileID]
+		var content []byte
+		for i, hash := range req.PartSha1Array {
+			part := large.parts[i+1]
+			sum := sha1.Sum(part)
+			if hex.EncodeToString(sum[:]) != hash {
+				f.fail(w, http.StatusBadRequest, "bad_request")
+				return
+			}
+			content = append(content, part...)
+		}
+		delete(f.large, req.FileID)
+		file := large.file
+		file.ContentSha1 = "none"
+		f.store(&file, content)
+		json.NewEncoder(w).Encode(file)
+
+	case "b2_cancel_large_file":
+		delete(f.large, req.FileID)
+		w.Write([]byte("{}"))
+
+	case "b2_list_file_names", "b2_list_file_versions":
+		var names []string
+		for name := range f.files {
+			if strings.HasPrefix(name, req.Prefix) && name >= req.StartFileName {
+				rest := strings.TrimPrefix(name, req.Prefix)
+				if req.Delimiter != "" && strings.Contains(rest, req.Delimiter) {
+					continue
+				}
+				names = append(names, name)
+			}
+		}
+		sort.Strings(names)
+		files := make([]b2File, 0, len(names))
+		for _, name := range names {
+			files = append(files, *f.files[name])
+		}
+		var next *string
+		if len(files) > req.MaxFileCount {
+			next = &files[req.MaxFileCount].FileName
+			files = files[:req.MaxFileCount]
+		}
+		json.NewEncoder(w).Encode(map[string]any{"files": files, "nextFileName": next})
+
+	case "b2_delete_file_version":
+		file := f.files[req.FileName]
+		if file == nil || file.FileID != req.FileID {
+			f.fail(w, http.StatusBadRequest, "file_not_present")
+			return
+		}
+		delete(f.files, req.FileName)
+		delete(f.content, req.FileName)
+		w.Write([]byte("{}"))
+
+	default:
+		f.fail(w, http.StatusBadRequest, "bad_request")
+	}
+}
+
+// upload serves file and part uploads, verifying their checksums.
+func (f *fakeB2) upload(w http.ResponseWriter, r *http.Request) {
+	if f.failUploads > 0 {
+		f.failUploads--
+		f.fail(w, http.StatusServiceUnavailable, "service_unavailable")
+		return
+	}
+
+	content, _ := io.ReadAll(r.Body)
+	if f.corrupt {
+		f.corrupt = false
+		content[0] ^= 0xff
+	}
+
+	sum := sha1.Sum(content)
+	hash := hex.EncodeToString(sum[:])
+	if r.Header.Get("X-Bz-Content-Sha1") != hash {
+		f.fail(w, http.StatusBadRequest, "bad_request")
+		return
+	}
+
+	if fileID, ok := strings.CutPrefix(r.URL.Path, "/upload/part/"); ok {
+		var number int
+		fmt.Sscan(r.Header.Get("X-Bz-Part-Number"), &number)
+		f.large[fileID].parts[number] = content
+		json.NewEncoder(w).Encode(map[string]any{"fileId": fileID, "partNumber": number})
+		return
+	}
+
+	name, _ := url.PathUnescape(r.Header.Get("X-Bz-File-Name"))
+	f.nextID++
+	file := b2File{FileID: fmt.Sprintf("file-%d", f.nextID), FileName: name, ContentSha1: hash}
+	f.store(&file, content)
+	json.NewEncoder(w).Encode(file)
+}
+
+// store stores the provided file, replacing earlier versions.
+func (f *fakeB2) store(file *b2File, content []byte) {
+	file.Action = "upload"
+	file.ContentLength = int64(len(content))
+	file.UploadTimestamp = time.Now().UnixMilli()
+	f.files[file.FileName] = file
+	f.content[file.FileName] = content
+}
+
+func TestB2Store(t *testing.T) {
+	fake := newFakeB2(t, 1<<20)
+	cfg := &s3Config{Prefix: "backups", OpenStorage: fake.config().open}
+	ctx := context.Background()
+	logger := zerolog.Nop()
+
+	// Ensure archives are uploaded under the job's prefix after a retried upload.
+	fake.failUploads = 1
+	for _, name := range []string{"dump-20260101235000.zip", "dump-20260102235000.zip"} {
+		zipPath := filepath.Join(t.TempDir(), name)
+		assert.NoError(t, os.WriteFile(zipPath, zipBytes(t, map[string]string{"users.sql": name}), 0600))
+
+		info, err := uploadZip(ctx, zipPath, cfg, &logger)
+		assert.NoError(t, err)
+		assert.Equal(t, "backups/"+name, info.Key)
+		_, err = os.Stat(zipPath)
+		assert.True(t, os.IsNotExist(err))
+	}
+
+	err := writeManifest(ctx, cfg, &archiveManifest{Key: "backups/dump-20260101235000.zip"})
+	assert.NoError(t, err)
+
+	archives, err := listArchives(ctx, cfg)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(archives))
+	assert.Equal(t, "backups/dump-20260102235000.zip", archives[0].Key)
+
+	// Ensure the newest archive is restored by default.
+	target := t.TempDir()
+	_, err = restoreArchive(ctx, cfg, "", target)
+	assert.NoError(t, err)
+	data, err := os.ReadFile(filepath.Join(target, "users.sql"))
+	assert.NoError(t, err)
+	assert.Equal(t, "dump-20260102235000.zip", string(data))
+
+	// Ensure pruning deletes old archives along with their manifests.
+	pruned, err := pruneArchives(ctx, cfg, time.Now().Add(time.Hour), 1, false)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(pruned))
+	assert.True(t, fake.files["backups/dump-20260101235000.zip"] == nil)
+	assert.True(t, fake.files[manifestKey("backups/dump-20260101235000.zip")] == nil)
+	assert.True(t, fake.files["backups/dump-20260102235000.zip"] != nil)
+
+	// Ensure uploads corrupted in transit are rejected and the zip file is kept.
+	fake.corrupt = true
+	zipPath := filepath.Join(t.TempDir(), "dump-20260103235000.zip")
+	assert.NoError(t, os.WriteFile(zipPath, zipBytes(t, map[string]string{"users.sql": "data"}), 0600))
+	_, err = uploadZip(ctx, zipPath, cfg, &logger)
+	assert.Error(t, err)
+	_, err = os.Stat(zipPath)
+	assert.NoError(t, err)
+
+	// Ensure invalid application keys are rejected.
+	b2 := fake.config()
+	b2.ApplicationKey = "wrong"
+	assert.Error(t, checkBucket(ctx, &s3Config{OpenStorage: b2.open}))
+}
+
+func TestB2LargeFile(t *testing.T) {
+	fake := newFakeB2(t, 100)
+	cfg := &s3Config{OpenStorage: fake.config().open}
+	ctx := context.Background()
+	logger := zerolog.Nop()
+
+	// Ensure files larger than a part are uploaded in verified parts.
+	content := strings.Repeat("0123456789", 25)
+	zipPath := filepath.Join(t.TempDir(), "dump-20260101235000.zip")
+	assert.NoError(t, os.WriteFile(zipPath, []byte(content), 0600))
+
+	info, err := uploadZip(ctx, zipPath, cfg, &logger)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(250), info.Size)
+	assert.Equal(t, content, string(fake.content["dump-20260101235000.zip"]))
+	sum := sha1.Sum([]byte(content))
+	assert.Equal(t, hex.EncodeToString(sum[:]), fake.files["dump-20260101235000.zip"].FileInfo["large_file_sha1"])
+
+	// Ensure large files with a corrupted part are cancelled.
+	fake.corrupt = true
+	fake.failUploads = 0
+	zipPath = filepath.Join(t.TempDir(), "dump-20260102235000.zip")
+	assert.NoError(t, os.WriteFile(zipPath, []byte(content), 0600))
+	_, err = uploadZip(ctx, zipPath, cfg, &logger)
+	assert.Error(t, err)
+	assert.Equal(t, 0, len(fake.large))
+	assert.True(t, fake.files["dump-20260102235000.zip"] == nil)
+}
@@ -0,0 +1,196 @@
+package archiver
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+)
+
+// Backup types.
+const (
+	// backupFull is the type of archives of every file of the source directory.
+	backupFull = "full"
+	// backupIncremental is the type of archives of the files modified since the previous
+	// archive.
+	backupIncremental = "incremental"
+	// backupDifferential is the type of archives of the files modified since the last full
+	// archive.
+	backupDifferential = "differential"
+	// backupDelta is the type of archives stored as a binary delta against the previous
+	// archive.
+	backupDelta = "delta"
+)
+
+// fullBackupInterval is the maximum age of the full archive differential archives are
+// based on, a full archive is made if the scheduled one was missed.
+const fullBackupInterval = 7 * 24 * time.Hour
+
+// backupState is the state of the incremental and differential backups of a job, stored as
+// a marker object in its bucket so every instance archiving the job shares it.
+type backupState struct {
+	// LastSuccess is the start time of the last successful run, files modified since then
+	// are archived by the next incremental run.
+	LastSuccess time.Time `json:"lastSuccess"`
+	// Key is the key of the archive uploaded by the last successful run.
+	Key string `json:"key"`
+	// LastFull is the start time of the last successful full run, files modified since
+	// then are archived by the next differential run.
+	LastFull time.Time `json:"lastFull,omitempty"`
+	// FullKey is the key of the archive uploaded by the last successful full run.
+	FullKey string `json:"fullKey,omitempty"`
+	// ContentHash is the content hash of the archive uploaded by the last successful run,
+	// archives with the same hash are not uploaded again by jobs skipping unchanged archives.
+	ContentHash string `json:"contentHash,omitempty"`
+	// Deltas is the number of delta archives uploaded since the last full archive.
+	Deltas int `json:"deltas,omitempty"`
+}
+
+// backupPlan is the kind of archive a run makes.
+type backupPlan struct {
+	// Type is the backup type of the archive.
+	Type string
+	// Since is the time since which modified files are archived, zero for full archives.
+	Since time.Time
+	// Base is the key of the archive the archive builds on, empty for full archives.
+	Base string
+}
+
+// parseWeekday parses the name of a weekday, e.g. sunday or sun.
+func parseWeekday(value string) (time.Weekday, error) {
+	name := strings.ToLower(strings.TrimSpace(value))
+	for day := time.Sunday; day <= time.Saturday; day++ {
+		full := strings.ToLower(day.String())
+		if name == full || (len(name) == 3 && strings.HasPrefix(full, name)) {
+			return day, nil
+		}
+	}
+
+	return 0, fmt.Errorf("invalid weekday %q", value)
+}
+
+// chained returns whether the archives of the job build on previous archives.
+func (j *jobConfig) chained() bool {
+	return j.Incremental || j.Differential != "" || j.Delta > 0
+}
+
+// stateful returns whether the job keeps a backup state.
+func (j *jobConfig) stateful() bool {
+	return j.chained() || j.SkipUnchanged
+}
+
+// unchanged returns whether an archive with the provided content hash is identical to the
+// last archive uploaded by the job.
+func (j *jobConfig) unchanged(state *backupState, hash string) bool {
+	return j.SkipUnchanged && state != nil && state.ContentHash == hash
+}
+
+// planBackup returns the kind of archive a run of the job started at the provided time makes,
+// given the job's backup state. Without a previous archive to build on, runs make full
+// archives. Differential jobs make full archives on their full backup weekday and whenever
+// their last full archive is older than a week, delta jobs after their maximum number of
+// deltas.
+func (j *jobConfig) planBackup(state *backupState, now time.Time) backupPlan {
+	switch {
+	case state == nil:
+		return backupPlan{Type: backupFull}
+
+	case j.Differential != "":
+		fullDay, _ := parseWeekday(j.Differential)
+		sameDay := state.LastFull.In(now.Location()).Format(time.DateOnly) == now.Format(time.DateOnly)
+		if state.FullKey == "" || (now.Weekday() == fullDay && !sameDay) ||
+			now.Sub(state.LastFull) >= fullBackupInterval {
+			return backupPlan{Type: backupFull}
+		}
+
+		return backupPlan{Type: backupDifferential, Since: state.LastFull, Base: state.FullKey}
+
+	case j.Delta > 0:
+		if state.Key == "" || state.Deltas >= j.Delta {
+			return backupPlan{Type: backupFull}
+		}
+
+		return backupPlan{Type: backupDelta, Base: state.Key}
+
+	case j.Incremental:
+		return backupPlan{Type: backupIncremental, Since: state.LastSuccess, Base: state.Key}
+
+	default:
+		return backupPlan{Type: backupFull}
+	}
+}
+
+// next returns the backup state after a successful run started at the provided time which
+// uploaded the archive with the provided key and content hash.
+func (s *backupState) next(plan backupPlan, now time.Time, key string, hash string) *backupState {
+	next := &backupState{LastSuccess: now, Key: key, ContentHash: hash}
+	if plan.Type == backupFull {
+		next.LastFull, next.FullKey = now, key
+	} else if s != nil {
+		next.LastFull, next.FullKey = s.LastFull, s.FullKey
+	}
+	if plan.Type == backupDelta && s != nil {
+		next.Deltas = s.Deltas + 1
+	}
+
+	return next
+}
+
+// backupStateKey returns the object name of the backup state of the provided job.
+func backupStateKey(cfg *s3Config, job string) string {
+	return path.Join(cfg.Prefix, "state", job+".json")
+}
+
+// readBackupState reads the backup state of the provided job from its bucket. It returns no
+// state if the job has not completed a run yet.
+func readBackupState(ctx context.Context, cfg *s3Config, job string) (*backupState, error) {
+	mnc, err := minio.New(cfg.Endpoint, cfg.Options)
+	if err != nil {
+		return nil, fmt.Errorf("creating minio client: %w", err)
+	}
+
+	key := backupStateKey(cfg, job)
+	obj, err := mnc.GetObject(ctx, cfg.Bucket, key, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("reading backup state %s: %w", key, err)
+	}
+	defer obj.Close()
+
+	var state backupState
+	err = json.NewDecoder(obj).Decode(&state)
+	if err != nil {
+		if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("reading backup state %s: %w", key, err)
+	}
+
+	return &state, nil
+}
+
+// writeBackupState writes the backup state of the provided job to its bucket.
+func writeBackupState(ctx context.Context, cfg *s3Config, job string, state *backupState) error {
+	mnc, err := minio.New(cfg.Endpoint, cfg.Options)
+	if err != nil {
+		return fmt.Errorf("creating minio client: %w", err)
+	}
+
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+
+	key := backupStateKey(cfg, job)
+	_, err = mnc.PutObject(ctx, cfg.Bucket, key, bytes.NewReader(data), int64(len(data)),
+		minio.PutObjectOptions{ContentType: "application/json"})
+	if err != nil {
+		return fmt.Errorf("writing backup state %s: %w", key, err)
+	}
+
+	return nil
+}
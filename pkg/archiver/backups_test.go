@@ -0,0 +1,302 @@
+package archiver
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/peterldowns/testy/assert"
+	"github.com/rs/zerolog"
+)
+
+func TestBackupState(t *testing.T) {
+	fake := newFakeS3(t, "test-bucket")
+	s3Cfg := fake.s3Config("test-bucket")
+	s3Cfg.Prefix = "db"
+	ctx := context.Background()
+
+	// Ensure jobs without a completed run have no state.
+	state, err := readBackupState(ctx, s3Cfg, "db")
+	assert.NoError(t, err)
+	assert.Equal(t, nil, state)
+
+	// Ensure written states are read back.
+	lastSuccess := time.Date(2025, 3, 10, 23, 50, 0, 0, time.UTC)
+	err = writeBackupState(ctx, s3Cfg, "db", &backupState{LastSuccess: lastSuccess, Key: "db/dump-20250310235000.zip"})
+	assert.NoError(t, err)
+	assert.NotEqual(t, nil, fake.object("test-bucket", "db/state/db.json"))
+
+	state, err = readBackupState(ctx, s3Cfg, "db")
+	assert.NoError(t, err)
+	assert.True(t, lastSuccess.Equal(state.LastSuccess))
+	assert.Equal(t, "db/dump-20250310235000.zip", state.Key)
+
+	// Ensure the state is not mistaken for an archive.
+	assert.False(t, isArchiveKey(s3Cfg, backupStateKey(s3Cfg, "db")))
+}
+
+func TestParseWeekday(t *testing.T) {
+	day, err := parseWeekday("Sunday")
+	assert.NoError(t, err)
+	assert.Equal(t, time.Sunday, day)
+
+	day, err = parseWeekday("sat")
+	assert.NoError(t, err)
+	assert.Equal(t, time.Saturday, day)
+
+	_, err = parseWeekday("someday")
+	assert.Error(t, err)
+	_, err = parseWeekday("su")
+	assert.Error(t, err)
+}
+
+func TestPlanBackup(t *testing.T) {
+	// 2025-03-12 is a Wednesday.
+	now := time.Date(2025, 3, 12, 23, 50, 0, 0, time.UTC)
+	lastFull := now.Add(-48 * time.Hour)
+	state := &backupState{
+		LastSuccess: now.Add(-24 * time.Hour),
+		Key:         "dump-20250311235000.zip",
+		LastFull:    lastFull,
+		FullKey:     "dump-20250310235000.zip",
+	}
+
+	// Ensure jobs without a previous archive make full archives.
+	job := jobConfig{Name: "db", Incremental: true}
+	assert.Equal(t, backupPlan{Type: backupFull}, job.planBackup(nil, now))
+
+	// Ensure incremental archives build on the previous archive.
+	plan := job.planBackup(state, now)
+	assert.Equal(t, backupIncremental, plan.Type)
+	assert.Equal(t, "dump-20250311235000.zip", plan.Base)
+	assert.True(t, state.LastSuccess.Equal(plan.Since))
+
+	// Ensure differential archives build on the last full archive.
+	job = jobConfig{Name: "db", Differential: "sunday"}
+	plan = job.planBackup(state, now)
+	assert.Equal(t, backupDifferential, plan.Type)
+	assert.Equal(t, "dump-20250310235000.zip", plan.Base)
+	assert.True(t, lastFull.Equal(plan.Since))
+
+	// Ensure full archives are made on the full backup weekday.
+	job.Differential = "wed"
+	assert.Equal(t, backupFull, job.planBackup(state, now).Type)
+
+	// Ensure only one full archive is made on the full backup weekday.
+	sameDay := *state
+	sameDay.LastFull = now.Add(-time.Hour)
+	assert.Equal(t, backupDifferential, job.planBackup(&sameDay, now).Type)
+
+	// Ensure full archives are made when the scheduled one was missed.
+	job.Differential = "sunday"
+	stale := *state
+	stale.LastFull = now.Add(-fullBackupInterval)
+	assert.Equal(t, backupFull, job.planBackup(&stale, now).Type)
+
+	// Ensure delta archives build on the previous archive until the maximum number of deltas.
+	job = jobConfig{Name: "db", Delta: 2}
+	plan = job.planBackup(state, now)
+	assert.Equal(t, backupPlan{Type: backupDelta, Base: "dump-20250311235000.zip"}, plan)
+	assert.Equal(t, 1, state.next(plan, now, "dump-20250312235000.delta", "").Deltas)
+
+	rebase := *state
+	rebase.Deltas = 2
+	assert.Equal(t, backupFull, job.planBackup(&rebase, now).Type)
+
+	// Ensure the state tracks the last full archive.
+	next := state.next(backupPlan{Type: backupDifferential}, now, "dump-20250312235000.zip", "")
+	assert.Equal(t, "dump-20250312235000.zip", next.Key)
+	assert.Equal(t, "dump-20250310235000.zip", next.FullKey)
+
+	next = (*backupState)(nil).next(backupPlan{Type: backupFull}, now, "dump-20250312235000.zip", "")
+	assert.Equal(t, "dump-20250312235000.zip", next.FullKey)
+	assert.True(t, now.Equal(next.LastFull))
+}
+
+// archivedPaths returns the paths of the files archived by the provided run.
+func archivedPaths(result runResult) map[string]bool {
+	paths := make(map[string]bool)
+	for _, file := range result.Contents {
+		paths[file.Path] = true
+	}
+
+	return paths
+}
+
+func TestArchiveIncremental(t *testing.T) {
+	dir := t.TempDir()
+	logger := zerolog.Nop()
+	tracker := newStatusTracker()
+	fake := newFakeS3(t, "test-bucket")
+	s3Cfg := fake.s3Config("test-bucket")
+	job := jobConfig{Name: "db", SourceDir: dir, Retention: "720h", Incremental: true}
+
+	old := filepath.Join(dir, "old.sql")
+	assert.NoError(t, os.WriteFile(old, []byte("old"), 0644))
+	modified := time.Now().Add(-time.Hour)
+	assert.NoError(t, os.Chtimes(old, modified, modified))
+
+	// Ensure the first run archives every file.
+	archive(context.Background(), job, s3Cfg, []runReporter{tracker}, &logger)
+	assert.NoError(t, tracker.runs["db"].Err)
+	assert.True(t, archivedPaths(tracker.runs["db"])["old.sql"])
+
+	state, err := readBackupState(context.Background(), s3Cfg, "db")
+	assert.NoError(t, err)
+	assert.Equal(t, tracker.runs["db"].Key, state.Key)
+
+	// Ensure the next run only archives the files modified since.
+	time.Sleep(10 * time.Millisecond)
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "new.sql"), []byte("new"), 0644))
+	archive(context.Background(), job, s3Cfg, []runReporter{tracker}, &logger)
+	assert.NoError(t, tracker.runs["db"].Err)
+	paths := archivedPaths(tracker.runs["db"])
+	assert.False(t, paths["old.sql"])
+	assert.True(t, paths["new.sql"])
+
+	// Ensure full runs still archive every file.
+	job.Incremental = false
+	archive(context.Background(), job, s3Cfg, []runReporter{tracker}, &logger)
+	paths = archivedPaths(tracker.runs["db"])
+	assert.True(t, paths["old.sql"])
+	assert.True(t, paths["new.sql"])
+}
+
+func TestArchiveDifferential(t *testing.T) {
+	dir := t.TempDir()
+	logger := zerolog.Nop()
+	tracker := newStatusTracker()
+	fake := newFakeS3(t, "test-bucket")
+	s3Cfg := fake.s3Config("test-bucket")
+	fullDay := (time.Now().Weekday() + 1) % 7
+	job := jobConfig{Name: "db", SourceDir: dir, Retention: "720h", Differential: fullDay.String()}
+
+	old := filepath.Join(dir, "old.sql")
+	assert.NoError(t, os.WriteFile(old, []byte("old"), 0644))
+	modified := time.Now().Add(-time.Hour)
+	assert.NoError(t, os.Chtimes(old, modified, modified))
+
+	// Ensure the first run makes a full archive.
+	archive(context.Background(), job, s3Cfg, []runReporter{tracker}, &logger)
+	assert.NoError(t, tracker.runs["db"].Err)
+	full := tracker.runs["db"].Key
+	assert.True(t, archivedPaths(tracker.runs["db"])["old.sql"])
+
+	// Ensure differential runs archive every file modified since the full archive.
+	time.Sleep(time.Second)
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "first.sql"), []byte("first"), 0644))
+	archive(context.Background(), job, s3Cfg, []runReporter{tracker}, &logger)
+	assert.NoError(t, tracker.runs["db"].Err)
+
+	time.Sleep(time.Second)
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "second.sql"), []byte("second"), 0644))
+	archive(context.Background(), job, s3Cfg, []runReporter{tracker}, &logger)
+	assert.NoError(t, tracker.runs["db"].Err)
+	paths := archivedPaths(tracker.runs["db"])
+	assert.False(t, paths["old.sql"])
+	assert.True(t, paths["first.sql"])
+	assert.True(t, paths["second.sql"])
+
+	state, err := readBackupState(context.Background(), s3Cfg, "db")
+	assert.NoError(t, err)
+	assert.Equal(t, full, state.FullKey)
+	assert.Equal(t, tracker.runs["db"].Key, state.Key)
+
+	// Ensure restores extract the full archive before the differential one.
+	target := t.TempDir()
+	result, err := restoreArchive(context.Background(), s3Cfg, state.Key, target)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{full, state.Key}, result.Chain)
+
+	for _, name := range []string{"old.sql", "first.sql", "second.sql"} {
+		_, err := os.Stat(filepath.Join(target, name))
+		assert.NoError(t, err)
+	}
+}
+
+func TestArchiveUnchanged(t *testing.T) {
+	dir := t.TempDir()
+	logger := zerolog.Nop()
+	tracker := newStatusTracker()
+	fake := newFakeS3(t, "test-bucket")
+	s3Cfg := fake.s3Config("test-bucket")
+	job := jobConfig{Name: "db", SourceDir: dir, Retention: "720h", SkipUnchanged: true}
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "db.sql"), []byte("dump"), 0644))
+
+	// Ensure the first archive is uploaded.
+	archive(context.Background(), job, s3Cfg, []runReporter{tracker}, &logger)
+	assert.NoError(t, tracker.runs["db"].Err)
+	assert.False(t, tracker.runs["db"].Unchanged)
+
+	archives, err := listArchives(context.Background(), s3Cfg)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(archives))
+
+	// Ensure identical archives are not uploaded, even if files were touched.
+	time.Sleep(time.Second)
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "db.sql"), []byte("dump"), 0644))
+	archive(context.Background(), job, s3Cfg, []runReporter{tracker}, &logger)
+	result := tracker.runs["db"]
+	assert.NoError(t, result.Err)
+	assert.True(t, result.Unchanged)
+	assert.Equal(t, "", result.Key)
+
+	archives, err = listArchives(context.Background(), s3Cfg)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(archives))
+
+	entries, err := os.ReadDir(dir)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(entries))
+
+	// Ensure changed archives are uploaded.
+	time.Sleep(time.Second)
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "db.sql"), []byte("changed dump"), 0644))
+	archive(context.Background(), job, s3Cfg, []runReporter{tracker}, &logger)
+	assert.NoError(t, tracker.runs["db"].Err)
+	assert.False(t, tracker.runs["db"].Unchanged)
+
+	archives, err = listArchives(context.Background(), s3Cfg)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(archives))
+}
+
+func TestArchiveEmpty(t *testing.T) {
+	dir := t.TempDir()
+	logger := zerolog.Nop()
+	tracker := newStatusTracker()
+	fake := newFakeS3(t, "test-bucket")
+	s3Cfg := fake.s3Config("test-bucket")
+	job := jobConfig{Name: "db", SourceDir: dir, Retention: "720h", SkipEmpty: true}
+
+	// Ensure runs without files to archive upload nothing and leave no zip file behind.
+	archive(context.Background(), job, s3Cfg, []runReporter{tracker}, &logger)
+	result := tracker.runs["db"]
+	assert.NoError(t, result.Err)
+	assert.True(t, result.Skipped)
+	assert.Equal(t, "", result.Key)
+	assert.True(t, strings.HasSuffix(runSummary(&result), "found no files to archive, skipped the upload"))
+	assert.True(t, strings.Contains(string(newPushgateway("http://localhost:9091").metrics(&result)), "zdts3_last_run_skipped 1\n"))
+	assert.True(t, strings.Contains(string(newStatsd("localhost:8125", "", nil).metrics(&result)), "zdts3.run.skipped:1|c"))
+
+	archives, err := listArchives(context.Background(), s3Cfg)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, len(archives))
+
+	entries, err := os.ReadDir(dir)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, len(entries))
+
+	// Ensure runs with files are uploaded.
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "db.sql"), []byte("dump"), 0644))
+	archive(context.Background(), job, s3Cfg, []runReporter{tracker}, &logger)
+	assert.NoError(t, tracker.runs["db"].Err)
+	assert.False(t, tracker.runs["db"].Skipped)
+
+	archives, err = listArchives(context.Background(), s3Cfg)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(archives))
+}
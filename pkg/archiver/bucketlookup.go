@@ -0,0 +1,42 @@
+package archiver
+
+import (
+	"fmt"
+
+	"github.com/minio/minio-go/v7"
+)
+
+// Bucket lookups.
+const (
+	// bucketLookupPath addresses buckets in the request path, as https://endpoint/bucket.
+	bucketLookupPath = "path"
+	// bucketLookupDNS addresses buckets as a subdomain of the endpoint, as
+	// https://bucket.endpoint.
+	bucketLookupDNS = "dns"
+	// bucketLookupAuto addresses buckets as a subdomain of endpoints known to support it, and
+	// in the request path otherwise.
+	bucketLookupAuto = "auto"
+)
+
+// validateBucketLookup validates the provided bucket lookup.
+func validateBucketLookup(lookup string) error {
+	switch lookup {
+	case "", bucketLookupPath, bucketLookupDNS, bucketLookupAuto:
+		return nil
+
+	default:
+		return fmt.Errorf("invalid bucket lookup %q, expected %s, %s or %s", lookup, bucketLookupPath, bucketLookupDNS, bucketLookupAuto)
+	}
+}
+
+// bucketLookup returns how buckets are addressed in storage requests.
+func (c *Config) bucketLookup() minio.BucketLookupType {
+	switch c.BucketLookup {
+	case bucketLookupPath:
+		return minio.BucketLookupPath
+	case bucketLookupDNS:
+		return minio.BucketLookupDNS
+	default:
+		return minio.BucketLookupAuto
+	}
+}
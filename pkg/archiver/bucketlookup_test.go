@@ -0,0 +1,57 @@
+package archiver
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"testing"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/peterldowns/testy/assert"
+)
+
+// urlRecorder is a transport recording the URLs of requests without sending them.
+type urlRecorder struct {
+	mtx  sync.Mutex
+	urls []string
+}
+
+func (r *urlRecorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	r.urls = append(r.urls, req.URL.Host+req.URL.Path)
+	return nil, errors.New("not sent")
+}
+
+func TestBucketLookup(t *testing.T) {
+	// Ensure the configured addressing maps to the client's bucket lookup.
+	for lookup, expected := range map[string]minio.BucketLookupType{
+		"":               minio.BucketLookupAuto,
+		bucketLookupAuto: minio.BucketLookupAuto,
+		bucketLookupPath: minio.BucketLookupPath,
+		bucketLookupDNS:  minio.BucketLookupDNS,
+	} {
+		cfg := &Config{Endpoint: "s3.example.com", BucketLookup: lookup}
+		assert.Equal(t, expected, cfg.s3Config(jobConfig{Bucket: "test-bucket"}, nil).Options.BucketLookup)
+	}
+
+	// Ensure buckets are addressed in the request path or as a subdomain of the endpoint.
+	for lookup, expected := range map[string]string{
+		bucketLookupPath: "s3.example.com/test-bucket/dump.zip",
+		bucketLookupDNS:  "test-bucket.s3.example.com/dump.zip",
+	} {
+		recorder := &urlRecorder{}
+		cfg := &Config{Endpoint: "s3.example.com", Region: "us-east-1", BucketLookup: lookup}
+		s3Cfg := cfg.s3Config(jobConfig{Bucket: "test-bucket"}, nil)
+		s3Cfg.Options.Transport = recorder
+		s3Cfg.Options.MaxRetries = 1
+
+		mnc, err := minio.New(s3Cfg.Endpoint, s3Cfg.Options)
+		assert.NoError(t, err)
+		_, err = mnc.StatObject(context.Background(), s3Cfg.Bucket, "dump.zip", minio.StatObjectOptions{})
+		assert.Error(t, err)
+		assert.Equal(t, []string{expected}, recorder.urls)
+	}
+}
@@ -0,0 +1,110 @@
+package archiver
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+const (
+	// defaultCopyBufferSize is the size of the copy buffers unless configured otherwise.
+	defaultCopyBufferSize = 32 << 10
+	// minCopyBufferSize and maxCopyBufferSize bound the configurable copy buffer size.
+	minCopyBufferSize = 4 << 10
+	maxCopyBufferSize = 64 << 20
+)
+
+// copyBufferPool is the pool of copy buffers, replaced when the buffer size is configured.
+var copyBufferPool atomic.Pointer[bufferPool]
+
+// bufferPool is a pool of byte buffers of a fixed size.
+type bufferPool struct {
+	size int
+	pool sync.Pool
+}
+
+// newBufferPool creates a pool of buffers of the provided size.
+func newBufferPool(size int) *bufferPool {
+	p := &bufferPool{size: size}
+	p.pool.New = func() any {
+		buf := make([]byte, p.size)
+		return &buf
+	}
+
+	return p
+}
+
+// get returns a buffer of the pool's size.
+func (p *bufferPool) get() *[]byte {
+	return p.pool.Get().(*[]byte)
+}
+
+// put returns the provided buffer to the pool.
+func (p *bufferPool) put(buf *[]byte) {
+	if len(*buf) != p.size {
+		return
+	}
+
+	p.pool.Put(buf)
+}
+
+// copy copies the provided reader to the provided writer through a pooled buffer. The
+// reader and writer are wrapped so their own copy methods, which allocate buffers of their
+// own, are not used.
+func (p *bufferPool) copy(dst io.Writer, src io.Reader) (int64, error) {
+	buf := p.get()
+	defer p.put(buf)
+
+	return io.CopyBuffer(struct{ io.Writer }{dst}, struct{ io.Reader }{src}, *buf)
+}
+
+// copyBuffers returns the pool of the buffers files are copied through when zipping,
+// restoring and uploading. Sharing them keeps the memory of copies bounded by the number of
+// concurrent copies rather than the number of files.
+func copyBuffers() *bufferPool {
+	p := copyBufferPool.Load()
+	if p == nil {
+		copyBufferPool.CompareAndSwap(nil, newBufferPool(defaultCopyBufferSize))
+		p = copyBufferPool.Load()
+	}
+
+	return p
+}
+
+// setCopyBufferSize replaces the copy buffers with buffers of the provided size. Copies in
+// progress return their buffers to the previous pool.
+func setCopyBufferSize(size int) {
+	if size == copyBuffers().size {
+		return
+	}
+
+	copyBufferPool.Store(newBufferPool(size))
+}
+
+// parseSize parses a size in bytes with an optional KiB, MiB or GiB suffix.
+func parseSize(value string) (int64, error) {
+	number := strings.TrimSpace(value)
+	units := []struct {
+		suffix string
+		size   int64
+	}{{"KiB", 1 << 10}, {"MiB", 1 << 20}, {"GiB", 1 << 30}, {"B", 1}}
+
+	unit := int64(1)
+	for _, u := range units {
+		if n, ok := strings.CutSuffix(number, u.suffix); ok {
+			number, unit = strings.TrimSpace(n), u.size
+			break
+		}
+	}
+
+	n, err := strconv.ParseInt(number, 10, 64)
+	if err != nil || n < 0 || n > math.MaxInt64/unit {
+		return 0, fmt.Errorf("invalid size %q, expected bytes or a KiB, MiB or GiB size", value)
+	}
+
+	return n * unit, nil
+}
@@ -0,0 +1,51 @@
+package archiver
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/peterldowns/testy/assert"
+)
+
+func TestParseSize(t *testing.T) {
+	for value, expected := range map[string]int64{
+		"4096":    4096,
+		"512B":    512,
+		"256KiB":  256 << 10,
+		"16 MiB":  16 << 20,
+		" 1GiB ":  1 << 30,
+		"0":       0,
+		"1048576": 1 << 20,
+	} {
+		size, err := parseSize(value)
+		assert.NoError(t, err)
+		assert.Equal(t, expected, size)
+	}
+
+	for _, value := range []string{"", "KiB", "1.5MiB", "-1", "10MB", "ten", "9000000000GiB"} {
+		_, err := parseSize(value)
+		assert.Error(t, err)
+	}
+}
+
+func TestBufferPool(t *testing.T) {
+	pool := newBufferPool(8)
+	data := strings.Repeat("copy through a small buffer ", 10)
+
+	var buf bytes.Buffer
+	n, err := pool.copy(&buf, strings.NewReader(data))
+	assert.NoError(t, err)
+	assert.Equal(t, int64(len(data)), n)
+	assert.Equal(t, data, buf.String())
+
+	// Buffers of another size are not pooled.
+	other := make([]byte, 16)
+	pool.put(&other)
+	assert.Equal(t, 8, len(*pool.get()))
+
+	// Ensure the copy buffer size is configurable.
+	defer setCopyBufferSize(defaultCopyBufferSize)
+	setCopyBufferSize(256 << 10)
+	assert.Equal(t, 256<<10, len(*copyBuffers().get()))
+}
@@ -0,0 +1,331 @@
+package archiver
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"path"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/dustin/go-humanize"
+	"github.com/minio/minio-go/v7"
+	"github.com/rs/zerolog"
+)
+
+// catalogPrefix is the object prefix of the catalog index objects.
+const catalogPrefix = "catalog"
+
+// catalogIndexAttempts is the number of attempts of updating a catalog index object which
+// was concurrently modified.
+const catalogIndexAttempts = 3
+
+// archivedFile is a file added to an archive.
+type archivedFile struct {
+	Path    string    `json:"path"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"modTime"`
+	SHA256  string    `json:"sha256,omitempty"`
+}
+
+// contentHash returns a hash of the paths and contents of the provided archived files. It
+// does not depend on modification times or the archive format, identical directory contents
+// always have the same hash.
+func contentHash(files []archivedFile) string {
+	sorted := slices.Clone(files)
+	slices.SortFunc(sorted, func(a, b archivedFile) int { return strings.Compare(a.Path, b.Path) })
+
+	hash := sha256.New()
+	for _, file := range sorted {
+		fmt.Fprintf(hash, "%s\x00%s\n", file.Path, file.SHA256)
+	}
+
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// catalogEntry is a file of an uploaded archive recorded in the backup catalog.
+type catalogEntry struct {
+	Job      string    `json:"job"`
+	Bucket   string    `json:"bucket"`
+	Archive  string    `json:"archive"`
+	Archived time.Time `json:"archived"`
+	Path     string    `json:"path"`
+	Size     int64     `json:"size"`
+	ModTime  time.Time `json:"modTime"`
+}
+
+// catalogEntries returns the catalog entries of the files of the provided run. Only
+// uploaded archives are cataloged.
+func catalogEntries(result *runResult) []catalogEntry {
+	if result.Err != nil || result.Key == "" {
+		return nil
+	}
+
+	entries := make([]catalogEntry, 0, len(result.Contents))
+	for _, file := range result.Contents {
+		entries = append(entries, catalogEntry{
+			Job:      result.Job,
+			Bucket:   result.Bucket,
+			Archive:  result.Key,
+			Archived: result.Start.UTC(),
+			Path:     file.Path,
+			Size:     file.Size,
+			ModTime:  file.ModTime.UTC(),
+		})
+	}
+
+	return entries
+}
+
+// matchCatalogPath returns whether the provided archived file path matches the provided
+// pattern. Glob patterns are matched against the full path and the file name, other
+// patterns are matched as a substring of the path.
+func matchCatalogPath(pattern string, filePath string) bool {
+	if !strings.ContainsAny(pattern, "*?[") {
+		return strings.Contains(filePath, pattern)
+	}
+
+	matched, _ := path.Match(pattern, filePath)
+	if matched {
+		return true
+	}
+
+	matched, _ = path.Match(pattern, path.Base(filePath))
+	return matched
+}
+
+// catalogIndex is a run reporter maintaining the catalog index object of a job in its
+// bucket. The index lists the files of every uploaded archive of the job as gzipped JSON
+// lines, so archives can be searched without a local catalog.
+type catalogIndex struct {
+	cfg *s3Config
+	job string
+}
+
+// newCatalogIndex creates a reporter maintaining the catalog index object of the provided
+// job.
+func newCatalogIndex(job string, cfg *s3Config) *catalogIndex {
+	return &catalogIndex{cfg: cfg, job: job}
+}
+
+// catalogIndexName returns the name of the catalog index object of the provided job.
+func catalogIndexName(cfg *s3Config, job string) string {
+	return path.Join(cfg.Prefix, catalogPrefix, job+".jsonl.gz")
+}
+
+// name returns the name of the reporter.
+func (c *catalogIndex) name() string {
+	return "catalog"
+}
+
+// readCatalogIndex returns the entries of the provided catalog index object and its etag.
+// A missing index object has no entries and no etag.
+func readCatalogIndex(ctx context.Context, mnc *minio.Client, bucket string, objectName string) ([]catalogEntry, string, error) {
+	obj, err := mnc.GetObject(ctx, bucket, objectName, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, "", err
+	}
+	defer obj.Close()
+
+	info, err := obj.Stat()
+	if err != nil {
+		if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+			return nil, "", nil
+		}
+		return nil, "", err
+	}
+
+	gz, err := gzip.NewReader(obj)
+	if err != nil {
+		return nil, "", fmt.Errorf("decompressing catalog index %s: %w", objectName, err)
+	}
+	defer gz.Close()
+
+	var entries []catalogEntry
+	scanner := bufio.NewScanner(gz)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var entry catalogEntry
+		err := json.Unmarshal(scanner.Bytes(), &entry)
+		if err != nil {
+			return nil, "", fmt.Errorf("decoding catalog index %s: %w", objectName, err)
+		}
+		entries = append(entries, entry)
+	}
+
+	err = scanner.Err()
+	if err != nil {
+		return nil, "", fmt.Errorf("reading catalog index %s: %w", objectName, err)
+	}
+
+	return entries, info.ETag, nil
+}
+
+// encodeCatalogIndex encodes the provided entries as gzipped JSON lines.
+func encodeCatalogIndex(entries []catalogEntry) ([]byte, error) {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	enc := json.NewEncoder(gz)
+	for i := range entries {
+		err := enc.Encode(&entries[i])
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err := gz.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// report adds the files of the provided run to the catalog index object. The index is
+// updated with a conditional write and retried when it was concurrently modified.
+func (c *catalogIndex) report(ctx context.Context, result *runResult) error {
+	added := catalogEntries(result)
+	if len(added) == 0 {
+		return nil
+	}
+
+	mnc, err := minio.New(c.cfg.Endpoint, c.cfg.Options)
+	if err != nil {
+		return fmt.Errorf("creating minio client: %w", err)
+	}
+
+	objectName := catalogIndexName(c.cfg, c.job)
+	for attempt := 1; ; attempt++ {
+		entries, etag, err := readCatalogIndex(ctx, mnc, c.cfg.Bucket, objectName)
+		if err != nil {
+			return fmt.Errorf("reading catalog index: %w", err)
+		}
+
+		data, err := encodeCatalogIndex(append(entries, added...))
+		if err != nil {
+			return fmt.Errorf("encoding catalog index: %w", err)
+		}
+
+		opts := minio.PutObjectOptions{ContentType: "application/gzip"}
+		if etag == "" {
+			opts.SetMatchETagExcept("*")
+		} else {
+			opts.SetMatchETag(etag)
+		}
+
+		_, err = mnc.PutObject(ctx, c.cfg.Bucket, objectName, bytes.NewReader(data), int64(len(data)), opts)
+		if err == nil {
+			return nil
+		}
+
+		if !isPreconditionFailed(err) || attempt == catalogIndexAttempts {
+			return fmt.Errorf("writing catalog index: %w", err)
+		}
+	}
+}
+
+// findRemote returns the entries of the catalog index objects of the provided jobs
+// matching the provided pattern.
+func findRemote(ctx context.Context, cfg *Config, jobs []jobConfig, pattern string) ([]catalogEntry, error) {
+	logger := zerolog.Nop()
+	creds := cfg.credentials(&logger)
+
+	var found []catalogEntry
+	for _, job := range jobs {
+		s3Cfg := cfg.s3Config(job, creds)
+		mnc, err := minio.New(s3Cfg.Endpoint, s3Cfg.Options)
+		if err != nil {
+			return nil, fmt.Errorf("creating minio client: %w", err)
+		}
+
+		entries, _, err := readCatalogIndex(ctx, mnc, s3Cfg.Bucket, catalogIndexName(s3Cfg, job.Name))
+		if err != nil {
+			return nil, fmt.Errorf("reading catalog index of job %s: %w", job.Name, err)
+		}
+
+		for _, entry := range entries {
+			if matchCatalogPath(pattern, entry.Path) {
+				found = append(found, entry)
+			}
+		}
+	}
+
+	return found, nil
+}
+
+// runFindCommand lists the archives containing files matching a pattern.
+func runFindCommand(cfg *Config, args []string, out io.Writer) error {
+	fs := flag.NewFlagSet("find", flag.ContinueOnError)
+	job := fs.String("job", "", "Only search archives of the provided job")
+	remote := fs.Bool("remote", false, "Search the catalog index objects in the bucket instead of the local catalog")
+	err := fs.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	if fs.NArg() != 1 {
+		return errors.New("find requires a single file name, path or glob pattern")
+	}
+	pattern := fs.Arg(0)
+
+	var found []catalogEntry
+	ctx := context.Background()
+	switch {
+	case *remote || cfg.HistoryDB == "":
+		jobs := cfg.jobs()
+		if *job != "" {
+			var selected []jobConfig
+			for _, j := range jobs {
+				if j.Name == *job {
+					selected = append(selected, j)
+				}
+			}
+			if len(selected) == 0 {
+				return fmt.Errorf("unknown job %q", *job)
+			}
+			jobs = selected
+		}
+
+		found, err = findRemote(ctx, cfg, jobs, pattern)
+		if err != nil {
+			return err
+		}
+
+	default:
+		history, err := openHistory(cfg.HistoryDB)
+		if err != nil {
+			return err
+		}
+		defer history.Close()
+
+		found, err = history.find(ctx, *job, pattern)
+		if err != nil {
+			return err
+		}
+	}
+
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ARCHIVED\tJOB\tBUCKET\tARCHIVE\tPATH\tSIZE")
+	for _, entry := range found {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n",
+			entry.Archived.Local().Format(time.DateTime),
+			entry.Job,
+			entry.Bucket,
+			entry.Archive,
+			entry.Path,
+			humanize.IBytes(uint64(entry.Size)),
+		)
+	}
+
+	return w.Flush()
+}
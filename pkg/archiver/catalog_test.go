@@ -0,0 +1,135 @@
+package archiver
+
+import (
+	"bytes"
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/peterldowns/testy/assert"
+)
+
+func TestMatchCatalogPath(t *testing.T) {
+	assert.True(t, matchCatalogPath("users", "db/users.sql"))
+	assert.True(t, matchCatalogPath("*.sql", "db/users.sql"))
+	assert.True(t, matchCatalogPath("db/*.sql", "db/users.sql"))
+	assert.False(t, matchCatalogPath("*.csv", "db/users.sql"))
+	assert.False(t, matchCatalogPath("orders", "db/users.sql"))
+}
+
+func TestContentHash(t *testing.T) {
+	files := []archivedFile{
+		{Path: "a.sql", SHA256: "aa", ModTime: time.Now()},
+		{Path: "b.sql", SHA256: "bb"},
+	}
+
+	// Ensure the hash does not depend on the order or modification times of files.
+	reordered := []archivedFile{files[1], {Path: "a.sql", SHA256: "aa"}}
+	assert.Equal(t, contentHash(files), contentHash(reordered))
+
+	// Ensure changed contents and paths change the hash.
+	assert.NotEqual(t, contentHash(files), contentHash([]archivedFile{files[0], {Path: "b.sql", SHA256: "cc"}}))
+	assert.NotEqual(t, contentHash(files), contentHash([]archivedFile{files[0], {Path: "c.sql", SHA256: "bb"}}))
+}
+
+func TestCatalog(t *testing.T) {
+	ctx := context.Background()
+	start := time.Date(2026, 1, 1, 23, 50, 0, 0, time.UTC)
+	runs := []*runResult{
+		{
+			Job: "db", Start: start, Bucket: "test-bucket", Key: "backups/dump-20260101235000.zip",
+			Contents: []archivedFile{
+				{Path: "users.sql", Size: 10, ModTime: start},
+				{Path: "orders/2026.csv", Size: 20, ModTime: start},
+			},
+		},
+		{
+			Job: "db", Start: start.Add(24 * time.Hour), Bucket: "test-bucket", Key: "backups/dump-20260102235000.zip",
+			Contents: []archivedFile{
+				{Path: "users.sql", Size: 30, ModTime: start.Add(24 * time.Hour)},
+			},
+		},
+	}
+	failed := &runResult{
+		Job: "db", Start: start.Add(48 * time.Hour), Err: context.DeadlineExceeded,
+		Contents: []archivedFile{{Path: "users.sql", Size: 40}},
+	}
+
+	t.Run("local", func(t *testing.T) {
+		history, err := openHistory(filepath.Join(t.TempDir(), "history.db"))
+		assert.NoError(t, err)
+		defer history.Close()
+
+		for _, run := range append(runs, failed) {
+			assert.NoError(t, history.report(ctx, run))
+		}
+
+		// Ensure only uploaded archives are found, newest first.
+		found, err := history.find(ctx, "", "users.sql")
+		assert.NoError(t, err)
+		assert.Equal(t, 2, len(found))
+		assert.Equal(t, "backups/dump-20260102235000.zip", found[0].Archive)
+		assert.Equal(t, int64(30), found[0].Size)
+		assert.Equal(t, "backups/dump-20260101235000.zip", found[1].Archive)
+
+		found, err = history.find(ctx, "", "*.csv")
+		assert.NoError(t, err)
+		assert.Equal(t, 1, len(found))
+		assert.Equal(t, "orders/2026.csv", found[0].Path)
+
+		found, err = history.find(ctx, "logs", "users.sql")
+		assert.NoError(t, err)
+		assert.Equal(t, 0, len(found))
+	})
+
+	t.Run("index", func(t *testing.T) {
+		fake := newFakeS3(t, "test-bucket")
+		cfg := fake.s3Config("test-bucket")
+		cfg.Prefix = "backups"
+		index := newCatalogIndex("db", cfg)
+
+		for _, run := range append(runs, failed) {
+			assert.NoError(t, index.report(ctx, run))
+		}
+
+		// Ensure the index object accumulates the files of uploaded archives.
+		mnc, err := minio.New(cfg.Endpoint, cfg.Options)
+		assert.NoError(t, err)
+		entries, etag, err := readCatalogIndex(ctx, mnc, cfg.Bucket, "backups/catalog/db.jsonl.gz")
+		assert.NoError(t, err)
+		assert.True(t, etag != "")
+		assert.Equal(t, 3, len(entries))
+		assert.Equal(t, "orders/2026.csv", entries[1].Path)
+		assert.Equal(t, "backups/dump-20260102235000.zip", entries[2].Archive)
+
+		// Ensure a missing index has no entries.
+		entries, etag, err = readCatalogIndex(ctx, mnc, cfg.Bucket, "backups/catalog/logs.jsonl.gz")
+		assert.NoError(t, err)
+		assert.Equal(t, "", etag)
+		assert.Equal(t, 0, len(entries))
+	})
+
+	t.Run("command", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "history.db")
+		history, err := openHistory(path)
+		assert.NoError(t, err)
+		for _, run := range runs {
+			assert.NoError(t, history.report(ctx, run))
+		}
+		assert.NoError(t, history.Close())
+
+		var out bytes.Buffer
+		err = runCommand(&Config{HistoryDB: path}, []string{"find", "-job", "db", "*.csv"}, &out)
+		assert.NoError(t, err)
+		lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+		assert.Equal(t, 2, len(lines))
+		assert.True(t, strings.Contains(lines[1], "backups/dump-20260101235000.zip"))
+
+		// Ensure a pattern is required.
+		err = runCommand(&Config{HistoryDB: path}, []string{"find"}, &out)
+		assert.Error(t, err)
+	})
+}
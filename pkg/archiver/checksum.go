@@ -0,0 +1,48 @@
+package archiver
+
+import (
+	"fmt"
+
+	"github.com/minio/minio-go/v7"
+)
+
+// uploadChecksum is the checksum sent along uploads, so the storage verifies them end to
+// end. Uploads carry no checksum of their own when it is empty.
+type uploadChecksum string
+
+// Upload checksums.
+const (
+	// checksumSHA256 sends the SHA-256 checksum of uploads as a trailing header.
+	checksumSHA256 uploadChecksum = "sha256"
+	// checksumMD5 sends the MD5 digest of uploads, and of every part of multipart uploads,
+	// as a Content-MD5 header, for S3-compatibles ignoring the newer checksum headers.
+	checksumMD5 uploadChecksum = "md5"
+)
+
+// validateChecksum validates the provided upload checksum.
+func validateChecksum(checksum string) error {
+	switch uploadChecksum(checksum) {
+	case "", checksumSHA256, checksumMD5:
+		return nil
+
+	default:
+		return fmt.Errorf("invalid upload checksum %q, expected %s or %s", checksum, checksumSHA256, checksumMD5)
+	}
+}
+
+// trailingHeaders returns whether the checksum is sent as a trailing header, which minio
+// clients must be created for.
+func (c uploadChecksum) trailingHeaders() bool {
+	return c == checksumSHA256
+}
+
+// setOptions sets the checksum on the provided upload options.
+func (c uploadChecksum) setOptions(opts *minio.PutObjectOptions) {
+	switch c {
+	case checksumSHA256:
+		opts.Checksum = minio.ChecksumSHA256
+
+	case checksumMD5:
+		opts.SendContentMd5 = true
+	}
+}
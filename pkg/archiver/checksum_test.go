@@ -0,0 +1,96 @@
+package archiver
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/peterldowns/testy/assert"
+	"github.com/rs/zerolog"
+)
+
+func TestUploadChecksum(t *testing.T) {
+	fake := newFakeS3(t, "test-bucket")
+	cfg := fake.s3Config("test-bucket")
+	cfg.Checksum = checksumSHA256
+	cfg.Options.TrailingHeaders = cfg.Checksum.trailingHeaders()
+
+	content := []byte("archive")
+	zipPath := filepath.Join(t.TempDir(), "dump-20260101000000.zip")
+	assert.NoError(t, os.WriteFile(zipPath, content, 0644))
+
+	// Ensure uploads carry their SHA-256 checksum and return the one the bucket verified.
+	logger := zerolog.Nop()
+	info, err := uploadZip(context.Background(), zipPath, cfg, &logger)
+	assert.NoError(t, err)
+	sum := sha256.Sum256(content)
+	assert.Equal(t, base64.StdEncoding.EncodeToString(sum[:]), info.ChecksumSHA256)
+
+	// Ensure uploads corrupted in transit are rejected.
+	fake.mtx.Lock()
+	fake.corrupt = true
+	fake.mtx.Unlock()
+	assert.NoError(t, os.WriteFile(zipPath, content, 0644))
+	_, err = uploadZip(context.Background(), zipPath, cfg, &logger)
+	assert.Error(t, err)
+
+	// Ensure uploads without a checksum return none.
+	cfg = fake.s3Config("test-bucket")
+	info, err = uploadZip(context.Background(), zipPath, cfg, &logger)
+	assert.NoError(t, err)
+	assert.Equal(t, "", info.ChecksumSHA256)
+}
+
+func TestUploadContentMD5(t *testing.T) {
+	fake := newFakeS3(t, "test-bucket")
+	cfg := fake.s3Config("test-bucket")
+	cfg.Checksum = checksumMD5
+
+	content := []byte("archive")
+	zipPath := filepath.Join(t.TempDir(), "dump-20260101000000.zip")
+	assert.NoError(t, os.WriteFile(zipPath, content, 0644))
+
+	// Ensure uploads carry their MD5 digest.
+	logger := zerolog.Nop()
+	_, err := uploadZip(context.Background(), zipPath, cfg, &logger)
+	assert.NoError(t, err)
+	sum := md5.Sum(content)
+	assert.Equal(t, base64.StdEncoding.EncodeToString(sum[:]),
+		fake.object("test-bucket", "dump-20260101000000.zip").header.Get("Content-Md5"))
+
+	// Ensure uploads corrupted in transit are rejected.
+	fake.mtx.Lock()
+	fake.corrupt = true
+	fake.mtx.Unlock()
+	assert.NoError(t, os.WriteFile(zipPath, content, 0644))
+	_, err = uploadZip(context.Background(), zipPath, cfg, &logger)
+	assert.Error(t, err)
+}
+
+func TestDestinationChecksum(t *testing.T) {
+	dest := destinationConfig{
+		Name:            "offsite",
+		Endpoint:        "s3.example.com",
+		AccessKeyID:     "test-accesskeyid",
+		SecretAccessKey: "test-secretaccesskey",
+		Bucket:          "test-bucket",
+	}
+	md5Dest := dest
+	md5Dest.Name, md5Dest.Checksum = "legacy", "md5"
+	cfg := &Config{Checksum: "sha256", Destinations: []destinationConfig{dest, md5Dest}}
+
+	// Ensure destinations inherit the checksum of the bucket unless they select their own.
+	copies := cfg.copyDestinations()
+	assert.Equal(t, checksumSHA256, copies[0].Checksum)
+	assert.True(t, copies[0].Options.TrailingHeaders)
+	assert.Equal(t, checksumMD5, copies[1].Checksum)
+	assert.False(t, copies[1].Options.TrailingHeaders)
+
+	// Ensure unknown checksums are rejected.
+	md5Dest.Checksum = "crc32"
+	assert.Error(t, md5Dest.validate())
+}
@@ -0,0 +1,189 @@
+package archiver
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// defaultCircuitProbe is the default interval at which the storage of an open circuit is
+// probed.
+const defaultCircuitProbe = 5 * time.Minute
+
+// circuitPolicy is the circuit breaker policy of uploads to a storage.
+type circuitPolicy struct {
+	// Threshold is the number of consecutive failed uploads opening the circuit.
+	Threshold int
+	// Probe is the interval at which the storage is probed while the circuit is open.
+	Probe time.Duration
+}
+
+// circuitThreshold returns the number of consecutive failed uploads pausing uploads to the
+// storage, zero if uploads are never paused.
+func (c *Config) circuitThreshold() int {
+	threshold, err := strconv.Atoi(c.CircuitThreshold)
+	if err != nil || threshold < 0 {
+		return 0
+	}
+
+	return threshold
+}
+
+// circuitPolicy returns the circuit breaker policy of uploads to the storage, nil if uploads
+// are never paused.
+func (c *Config) circuitPolicy() *circuitPolicy {
+	threshold := c.circuitThreshold()
+	if threshold == 0 {
+		return nil
+	}
+
+	probe, err := time.ParseDuration(c.CircuitProbe)
+	if err != nil || probe <= 0 {
+		probe = defaultCircuitProbe
+	}
+
+	return &circuitPolicy{Threshold: threshold, Probe: probe}
+}
+
+// spooledArchive is an archive kept staged while the circuit of its storage was open.
+type spooledArchive struct {
+	job  jobConfig
+	path string
+	cfg  *s3Config
+}
+
+// circuits holds the circuitBreaker of every storage endpoint uploads were sent to, by
+// endpoint. Backends other than S3 have a single storage, under the empty endpoint.
+var circuits sync.Map
+
+// circuitBreaker pauses uploads to a storage after consecutive failed uploads, so a provider
+// which is down is not retried by every run. The storage is probed while the circuit is
+// open, and uploads resume once it is accessible again.
+type circuitBreaker struct {
+	mtx      sync.Mutex
+	failures int
+	opened   time.Time
+	probed   time.Time
+	spooled  []spooledArchive
+}
+
+// circuitFor returns the circuit breaker of the storage of the provided configuration, nil
+// if its uploads are never paused.
+func circuitFor(cfg *s3Config) *circuitBreaker {
+	if cfg.Circuit == nil {
+		return nil
+	}
+
+	value, _ := circuits.LoadOrStore(cfg.Endpoint, &circuitBreaker{})
+	return value.(*circuitBreaker)
+}
+
+// open returns whether the circuit is open, uploads are paused.
+func (b *circuitBreaker) open() bool {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	return !b.opened.IsZero()
+}
+
+// admit returns whether uploads to the storage of the provided configuration may proceed
+// at the provided time. While the circuit is open the storage is probed every probe
+// interval, and the circuit is closed once the storage is accessible again. The archives
+// spooled while the circuit was open are returned when it closes.
+func (b *circuitBreaker) admit(ctx context.Context, cfg *s3Config, now time.Time, logger *zerolog.Logger) ([]spooledArchive, error) {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	if b.opened.IsZero() {
+		return nil, nil
+	}
+
+	paused := fmt.Errorf("uploads paused since %s after %d consecutive failed uploads",
+		b.opened.Format(time.RFC3339), cfg.Circuit.Threshold)
+	if now.Sub(b.probed) < cfg.Circuit.Probe {
+		return nil, paused
+	}
+	b.probed = now
+
+	err := probeStorage(ctx, cfg)
+	if err != nil {
+		logger.Warn().Err(err).Str("bucket", cfg.Bucket).Msg("Storage probe failed, uploads stay paused")
+		return nil, paused
+	}
+
+	logger.Info().Str("bucket", cfg.Bucket).Dur("paused", now.Sub(b.opened)).Int("spooled", len(b.spooled)).
+		Msg("Storage accessible again, resuming uploads")
+	spooled := b.spooled
+	b.failures, b.opened, b.spooled = 0, time.Time{}, nil
+	return spooled, nil
+}
+
+// record records the outcome of an upload at the provided time and returns whether its
+// failure opened the circuit.
+func (b *circuitBreaker) record(policy *circuitPolicy, err error, now time.Time) bool {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	if err == nil {
+		b.failures = 0
+		return false
+	}
+
+	b.failures++
+	if !b.opened.IsZero() || b.failures < policy.Threshold {
+		return false
+	}
+
+	b.opened, b.probed = now, now
+	return true
+}
+
+// spool records the provided archive as kept staged while the circuit is open, to upload
+// it once the circuit closes.
+func (b *circuitBreaker) spool(archive spooledArchive) {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	b.spooled = append(b.spooled, archive)
+}
+
+// probeStorage ensures the storage of the provided configuration is accessible.
+func probeStorage(ctx context.Context, cfg *s3Config) error {
+	store, err := cfg.openStorage(ctx)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	return store.Check(ctx)
+}
+
+// uploadSpooled uploads the provided archives spooled while the circuit of their storage was
+// open, as they are and without a manifest, like stale archives. Archives which are no
+// longer staged are skipped, failed uploads keep the archive for the stale archive policy.
+func uploadSpooled(ctx context.Context, spooled []spooledArchive, logger *zerolog.Logger) {
+	for _, archive := range spooled {
+		if ctx.Err() != nil {
+			return
+		}
+
+		info, err := os.Stat(archive.path)
+		if err != nil {
+			continue
+		}
+
+		err = enforceQuota(ctx, archive.job, archive.cfg, info.Size(), logger)
+		if err != nil {
+			logger.Error().Err(err).Str("path", archive.path).Msg("Enforcing bucket usage quota, keeping spooled archive")
+			continue
+		}
+
+		logger.Info().Str("path", archive.path).Msg("Uploading spooled archive")
+		_, _ = uploadZip(ctx, archive.path, archive.cfg, logger)
+	}
+}
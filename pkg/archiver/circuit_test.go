@@ -0,0 +1,76 @@
+package archiver
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/peterldowns/testy/assert"
+	"github.com/rs/zerolog"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	dir := t.TempDir()
+	logger := zerolog.Nop()
+	tracker := newStatusTracker()
+	fake := newFakeS3(t)
+	s3Cfg := fake.s3Config("test-bucket")
+	s3Cfg.Circuit = &circuitPolicy{Threshold: 2, Probe: time.Hour}
+	job := jobConfig{Name: "db", SourceDir: dir, Retention: "720h", StaleArchives: staleDelete}
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "db.sql"), []byte("dump"), 0644))
+	run := func(name string) runResult {
+		archiveDir(context.Background(), job, name, newRunID(), s3Cfg, []runReporter{tracker}, &logger)
+		return tracker.runs["db"]
+	}
+	stageFailed := func(result runResult, stage string) bool {
+		for _, err := range result.Errors {
+			if err.Stage == stage {
+				return true
+			}
+		}
+		return false
+	}
+
+	// Ensure uploads to a failing storage open the circuit once they reach the threshold.
+	result := run("first")
+	assert.Error(t, result.Err)
+	assert.False(t, stageFailed(result, "circuit"))
+	result = run("second")
+	assert.Error(t, result.Err)
+	assert.True(t, stageFailed(result, "circuit"))
+	assert.True(t, circuitFor(s3Cfg).open())
+
+	// Ensure archives are spooled while the circuit is open, without being uploaded or
+	// removed as stale archives like the archive of the first run.
+	result = run("third")
+	assert.Error(t, result.Err)
+	assert.True(t, stageFailed(result, "circuit"))
+	staged, err := filepath.Glob(filepath.Join(dir, "*.zip"))
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(staged))
+
+	// Ensure the circuit stays open while the storage probe fails.
+	s3Cfg.Circuit.Probe = time.Nanosecond
+	result = run("fourth")
+	assert.Error(t, result.Err)
+	assert.True(t, circuitFor(s3Cfg).open())
+
+	// Ensure the circuit closes once the storage is accessible again, and the spooled
+	// archives are uploaded along the archive of the run.
+	fake.mtx.Lock()
+	fake.buckets["test-bucket"] = make(map[string]*fakeObject)
+	fake.mtx.Unlock()
+	result = run("fifth")
+	assert.NoError(t, result.Err)
+	assert.False(t, circuitFor(s3Cfg).open())
+	fake.mtx.Lock()
+	uploaded := len(fake.buckets["test-bucket"])
+	fake.mtx.Unlock()
+	// The archives of the second to fifth runs and the manifest of the fifth.
+	assert.Equal(t, 5, uploaded)
+	staged, err = filepath.Glob(filepath.Join(dir, "*.zip"))
+	assert.NoError(t, err)
+	assert.Equal(t, 0, len(staged))
+}
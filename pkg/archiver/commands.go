@@ -0,0 +1,77 @@
+package archiver
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+)
+
+// runCommand executes the subcommand described by the provided arguments.
+func runCommand(cfg *Config, args []string, out io.Writer) error {
+	switch args[0] {
+	case "config":
+		return runConfigCommand(cfg, args[1:], out)
+	case "history":
+		return runHistoryCommand(cfg, args[1:], out)
+	case "find":
+		return runFindCommand(cfg, args[1:], out)
+	case "restore":
+		return runRestoreCommand(cfg, args[1:], out)
+	case "hold":
+		return runHoldCommand(cfg, args[1:], out)
+	case "report":
+		return runReportCommand(cfg, args[1:], out)
+	case "scrub":
+		return runScrubCommand(cfg, args[1:], out)
+	case "drill":
+		return runDrillCommand(cfg, args[1:], out)
+	case "ctl":
+		return runCtlCommand(cfg, args[1:], out)
+	case "service":
+		return runServiceCommand(args[1:], out)
+	case "healthcheck":
+		return runHealthcheckCommand(cfg, args[1:], out)
+	case "doctor":
+		return runDoctorCommand(cfg, nil, args[1:], out)
+	default:
+		return fmt.Errorf("unknown command %q", args[0])
+	}
+}
+
+// runConfigCommand executes configuration subcommands.
+func runConfigCommand(cfg *Config, args []string, out io.Writer) error {
+	if len(args) == 0 {
+		return fmt.Errorf("config command required (migrate)")
+	}
+
+	switch args[0] {
+	case "migrate":
+		fs := flag.NewFlagSet("config migrate", flag.ContinueOnError)
+		outPath := fs.String("out", "", "Path to write the migrated config file to, TOML for a .toml extension (defaults to YAML on stdout)")
+		err := fs.Parse(args[1:])
+		if err != nil {
+			return err
+		}
+
+		if *outPath == "" {
+			return migrateConfig(cfg, out, formatYAML)
+		}
+
+		// The migrated config carries credentials, restrict access to the owner.
+		file, err := os.OpenFile(*outPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+		if err != nil {
+			return fmt.Errorf("creating config file: %w", err)
+		}
+		defer file.Close()
+
+		err = migrateConfig(cfg, file, configFormat(*outPath))
+		if err != nil {
+			return err
+		}
+
+		return file.Close()
+	default:
+		return fmt.Errorf("unknown config command %q", args[0])
+	}
+}
@@ -0,0 +1,21 @@
+package archiver
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// archiveComment returns the zip comment of the archive of the provided source directory made
+// by the provided run at the provided time. It describes the tool, host and source the
+// archive was made with, so an archive found years later is self-describing.
+func archiveComment(dir, runID string, now time.Time) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "zdts3 %s\n", getBuildInfo().Version)
+	fmt.Fprintf(&b, "host: %s\n", instanceName())
+	fmt.Fprintf(&b, "source: %s\n", dir)
+	fmt.Fprintf(&b, "run: %s\n", runID)
+	fmt.Fprintf(&b, "created: %s\n", now.UTC().Format(time.RFC3339))
+
+	return b.String()
+}
@@ -0,0 +1,44 @@
+package archiver
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/peterldowns/testy/assert"
+	"github.com/rs/zerolog"
+)
+
+func TestArchiveComment(t *testing.T) {
+	now := time.Date(2026, 1, 1, 23, 50, 0, 0, time.FixedZone("CET", 3600))
+	comment := archiveComment("/var/backups/db", "run1", now)
+	assert.True(t, strings.HasPrefix(comment, "zdts3 "+getBuildInfo().Version+"\n"))
+	assert.True(t, strings.Contains(comment, "\nhost: "+instanceName()+"\n"))
+	assert.True(t, strings.Contains(comment, "\nsource: /var/backups/db\n"))
+	assert.True(t, strings.Contains(comment, "\nrun: run1\n"))
+	assert.True(t, strings.HasSuffix(comment, "\ncreated: 2026-01-01T22:50:00Z\n"))
+
+	// Ensure uploaded archives carry the comment of their run.
+	dir := t.TempDir()
+	logger := zerolog.Nop()
+	tracker := newStatusTracker()
+	fake := newFakeS3(t, "test-bucket")
+	s3Cfg := fake.s3Config("test-bucket")
+	job := jobConfig{Name: "db", SourceDir: dir, Retention: "720h"}
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "db.sql"), []byte("dump"), 0644))
+
+	archive(context.Background(), job, s3Cfg, []runReporter{tracker}, &logger)
+	result := tracker.runs["db"]
+	assert.NoError(t, result.Err)
+
+	data := fake.object("test-bucket", result.Key).data
+	r, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	assert.NoError(t, err)
+	assert.True(t, strings.Contains(r.Comment, "\nsource: "+dir+"\n"))
+	assert.True(t, strings.Contains(r.Comment, "\nrun: "+result.ID+"\n"))
+}
@@ -0,0 +1,205 @@
+package archiver
+
+import (
+	"archive/zip"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"math"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/klauspost/compress/flate"
+	"github.com/klauspost/compress/zstd"
+)
+
+const (
+	// zipMethodZstd is the zip method of zstd compressed entries.
+	zipMethodZstd uint16 = 93
+	// zipVersionZstd is the zip version needed to extract zstd compressed entries.
+	zipVersionZstd = 63
+)
+
+func init() {
+	zip.RegisterDecompressor(zipMethodZstd, newZstdReader)
+}
+
+// newZstdReader returns a reader decompressing the provided zstd compressed entry.
+func newZstdReader(r io.Reader) io.ReadCloser {
+	dec, err := zstd.NewReader(r, zstd.WithDecoderConcurrency(1))
+	if err != nil {
+		return io.NopCloser(&errorReader{err: err})
+	}
+
+	return dec.IOReadCloser()
+}
+
+// errorReader fails every read with its error.
+type errorReader struct {
+	err error
+}
+
+// Read returns the error of the reader.
+func (e *errorReader) Read([]byte) (int, error) {
+	return 0, e.err
+}
+
+// compressionRule compresses the archived files matching its pattern with its method. Patterns
+// without a slash match file names, e.g. *.sql, other patterns match slash separated paths
+// relative to the source directory, with ** matching any number of directories.
+type compressionRule struct {
+	Pattern string `yaml:"pattern" toml:"pattern"`
+	// Method is store, deflate or zstd, optionally followed by a compression level, e.g.
+	// deflate-1 or zstd-19.
+	Method string `yaml:"method" toml:"method"`
+}
+
+// matches returns whether the rule applies to the archived file with the provided name.
+func (r compressionRule) matches(name string) bool {
+	if !strings.Contains(r.Pattern, "/") {
+		matched, _ := path.Match(r.Pattern, path.Base(name))
+		return matched
+	}
+
+	return matchGlob(strings.Split(strings.Trim(r.Pattern, "/"), "/"), strings.Split(name, "/"))
+}
+
+// zipCompression is the zip method and level archived files are compressed with.
+type zipCompression struct {
+	Method uint16
+	// Level is the compression level of the method, zero for its default level.
+	Level int
+}
+
+// parseCompression parses the provided compression method, optionally followed by a level.
+func parseCompression(method string) (zipCompression, error) {
+	name, level, leveled := strings.Cut(method, "-")
+	var compression zipCompression
+	var maxLevel int
+	switch name {
+	case "store":
+		if leveled {
+			return compression, fmt.Errorf("invalid compression method %q, store has no levels", method)
+		}
+		return zipCompression{Method: zip.Store}, nil
+
+	case "deflate":
+		compression.Method, maxLevel = zip.Deflate, flate.BestCompression
+
+	case "zstd":
+		compression.Method, maxLevel = zipMethodZstd, 22
+
+	default:
+		return compression, fmt.Errorf("invalid compression method %q, expected store, deflate or zstd", method)
+	}
+
+	if leveled {
+		n, err := strconv.Atoi(level)
+		if err != nil || n < 1 || n > maxLevel {
+			return compression, fmt.Errorf("invalid compression level of %q, expected 1 to %d", method, maxLevel)
+		}
+		compression.Level = n
+	}
+
+	return compression, nil
+}
+
+// validateCompression validates the provided compression rules.
+func validateCompression(rules []compressionRule) error {
+	var errs error
+	for _, rule := range rules {
+		_, err := path.Match(strings.ReplaceAll(rule.Pattern, "**", "*"), "")
+		if err != nil || rule.Pattern == "" {
+			errs = errors.Join(errs, fmt.Errorf("invalid compression pattern %q", rule.Pattern))
+		}
+
+		_, err = parseCompression(rule.Method)
+		errs = errors.Join(errs, err)
+	}
+
+	return errs
+}
+
+// compressionFor returns the compression of the first of the provided rules matching the
+// archived file with the provided name, false if none matches.
+func compressionFor(rules []compressionRule, name string) (zipCompression, bool) {
+	for _, rule := range rules {
+		if rule.matches(name) {
+			compression, err := parseCompression(rule.Method)
+			return compression, err == nil
+		}
+	}
+
+	return zipCompression{}, false
+}
+
+// newCompressor returns a writer compressing to the provided writer with the provided
+// compression.
+func newCompressor(w io.Writer, compression zipCompression) (io.WriteCloser, error) {
+	switch compression.Method {
+	case zip.Deflate:
+		level := compression.Level
+		if level == 0 {
+			level = flate.DefaultCompression
+		}
+		return flate.NewWriter(w, level)
+
+	case zipMethodZstd:
+		level := zstd.SpeedDefault
+		if compression.Level != 0 {
+			level = zstd.EncoderLevelFromZstd(compression.Level)
+		}
+		return zstd.NewWriter(w, zstd.WithEncoderLevel(level), zstd.WithEncoderConcurrency(1))
+
+	default:
+		return nil, fmt.Errorf("unsupported zip method %d", compression.Method)
+	}
+}
+
+// addCompressed writes the provided content to the zip as the entry of the provided header,
+// compressed with the provided compression, and returns the size of the content.
+func (z *dirZipper) addCompressed(header *zip.FileHeader, compression zipCompression, content io.Reader) (int64, error) {
+	// The sizes and checksum follow the content, they are only known once it is written.
+	header.Method = compression.Method
+	header.Flags |= zipDataDescriptor
+	markUTF8(header)
+	header.CompressedSize64, header.UncompressedSize64 = 0, 0
+	if compression.Method == zipMethodZstd {
+		header.ReaderVersion = zipVersionZstd
+	}
+	w, err := z.w.CreateRaw(header)
+	if err != nil {
+		return 0, err
+	}
+
+	counter := &countingWriter{w: w}
+	compressor, err := newCompressor(counter, compression)
+	if err != nil {
+		return 0, err
+	}
+
+	crc := crc32.NewIEEE()
+	size, err := copyBuffers().copy(io.MultiWriter(compressor, crc), content)
+	if err != nil {
+		return size, err
+	}
+
+	err = compressor.Close()
+	if err != nil {
+		return size, err
+	}
+
+	header.CRC32 = crc.Sum32()
+	header.CompressedSize64 = uint64(counter.n)
+	header.UncompressedSize64 = uint64(size)
+	header.CompressedSize = uint32(min(header.CompressedSize64, math.MaxUint32))
+	header.UncompressedSize = uint32(min(header.UncompressedSize64, math.MaxUint32))
+	if header.CompressedSize64 >= math.MaxUint32 || header.UncompressedSize64 >= math.MaxUint32 {
+		// Zip64 extensions require version 4.5.
+		header.ReaderVersion = max(header.ReaderVersion, 45)
+	}
+
+	return size, nil
+}
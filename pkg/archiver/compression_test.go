@@ -0,0 +1,76 @@
+package archiver
+
+import (
+	"archive/zip"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/peterldowns/testy/assert"
+	"github.com/rs/zerolog"
+)
+
+func TestCompressionRules(t *testing.T) {
+	dir := t.TempDir()
+	err := os.MkdirAll(filepath.Join(dir, "logs"), 0755)
+	assert.NoError(t, err)
+	files := map[string]string{
+		"users.sql":      strings.Repeat("insert into users values (1);\n", 100),
+		"logs/app.log":   strings.Repeat("started\n", 100),
+		"logs/app.log.1": strings.Repeat("stopped\n", 100),
+		"notes.txt":      strings.Repeat("notes\n", 100),
+		"photo.jpg":      strings.Repeat("jpeg", 100),
+	}
+	for name, content := range files {
+		err = os.WriteFile(filepath.Join(dir, filepath.FromSlash(name)), []byte(content), 0644)
+		assert.NoError(t, err)
+	}
+
+	// Ensure the first matching rule selects the compression of each file, falling back to
+	// the method of the archive and storing compressed file types.
+	logger := zerolog.Nop()
+	zipPath := filepath.Join(t.TempDir(), "dump.zip")
+	opts := zipOptions{Method: zip.Deflate, Compression: []compressionRule{
+		{Pattern: "*.sql", Method: "zstd-19"},
+		{Pattern: "logs/**", Method: "deflate-1"},
+		{Pattern: "*.1", Method: "store"},
+	}}
+	_, err = zipDir(context.Background(), dir, zipPath, opts, &logger)
+	assert.NoError(t, err)
+
+	reader, err := zip.OpenReader(zipPath)
+	assert.NoError(t, err)
+	defer reader.Close()
+
+	methods := make(map[string]uint16)
+	for _, file := range reader.File {
+		methods[file.Name] = file.Method
+
+		// Ensure every entry, zstd compressed ones included, extracts to its content.
+		src, err := file.Open()
+		assert.NoError(t, err)
+		content, err := io.ReadAll(src)
+		assert.NoError(t, err)
+		src.Close()
+		assert.Equal(t, files[file.Name], string(content))
+	}
+	assert.Equal(t, map[string]uint16{
+		"users.sql":      zipMethodZstd,
+		"logs/app.log":   zip.Deflate,
+		"logs/app.log.1": zip.Deflate,
+		"notes.txt":      zip.Deflate,
+		"photo.jpg":      zip.Store,
+	}, methods)
+	assert.NoError(t, verifyZip(zipPath, nil))
+
+	// Ensure invalid patterns, methods and levels are rejected.
+	assert.NoError(t, validateCompression([]compressionRule{{Pattern: "*.gz", Method: "store"}, {Pattern: "*.log", Method: "deflate-9"}}))
+	assert.Error(t, validateCompression([]compressionRule{{Pattern: "", Method: "store"}}))
+	assert.Error(t, validateCompression([]compressionRule{{Pattern: "[", Method: "store"}}))
+	assert.Error(t, validateCompression([]compressionRule{{Pattern: "*.gz", Method: "store-1"}}))
+	assert.Error(t, validateCompression([]compressionRule{{Pattern: "*.gz", Method: "brotli"}}))
+	assert.Error(t, validateCompression([]compressionRule{{Pattern: "*.log", Method: "deflate-10"}}))
+}
@@ -0,0 +1,1803 @@
+package archiver
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/joho/godotenv"
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+	"github.com/rs/zerolog"
+)
+
+const (
+	// envFileFlag is the command line flag selecting the .env file to load.
+	envFileFlag = "env-file"
+	// envFileEnv is the environment variable selecting the .env file to load.
+	envFileEnv = "ZDTS3_ENV_FILE"
+)
+
+var registeredFlags = make(map[string]bool)
+
+// logLevels are the supported log level names.
+var logLevels = map[string]bool{
+	"debug": true,
+	"info":  true,
+	"warn":  true,
+	"error": true,
+	"fatal": true,
+}
+
+// Log formats.
+const (
+	// logFormatJSON writes log entries as JSON lines.
+	logFormatJSON = "json"
+	// logFormatConsole writes human readable, colorized log entries.
+	logFormatConsole = "console"
+)
+
+// showVersion indicates the build information was requested on the command line.
+var showVersion bool
+
+// dotenvValues holds the values read from the loaded .env file. They are kept apart from the
+// process environment so the file can be re-read when it changes.
+var dotenvValues = make(map[string]string)
+
+// lookupEnv returns the value of the provided variable from the process environment, falling
+// back to the loaded .env file.
+func lookupEnv(name string) string {
+	value := os.Getenv(name)
+	if value != "" {
+		return value
+	}
+
+	return dotenvValues[name]
+}
+
+// envPrefix namespaces the environment variables of the service to avoid collisions with
+// other software sharing the environment.
+const envPrefix = "ZDTS3_"
+
+// envNames returns the environment variable names of the provided setting in order of
+// precedence, the namespaced name (e.g. ZDTS3_BUCKET) followed by the bare name.
+func envNames(name string) []string {
+	return []string{envPrefix + strings.ToUpper(name), name}
+}
+
+// fileEnvNames returns the names of the _FILE counterparts of the provided setting in order
+// of precedence.
+func fileEnvNames(name string) []string {
+	return []string{envPrefix + strings.ToUpper(name) + "_FILE", name + "_file", strings.ToUpper(name) + "_FILE"}
+}
+
+// readDotenv reads the values of the .env file at the provided path, returning no values if
+// the file does not exist.
+func readDotenv(path string) (map[string]string, error) {
+	_, err := os.Stat(path)
+	if err != nil {
+		return make(map[string]string), nil
+	}
+
+	values, err := godotenv.Read(path)
+	if err != nil {
+		return nil, fmt.Errorf("loading .env file: %w", err)
+	}
+
+	return values, nil
+}
+
+// envValue returns the value of the provided setting from its environment variables. If it is
+// not set, the value is read from the file referenced by its _FILE counterpart (e.g.
+// accesskeyid_file or ACCESSKEYID_FILE), which allows credentials to be sourced from mounted
+// secrets.
+func envValue(name string) (string, error) {
+	return resolveEnv(name, lookupEnv)
+}
+
+// resolveEnv returns the value of the provided setting using the provided lookup, falling
+// back to the file referenced by its _FILE counterpart.
+func resolveEnv(name string, lookup func(string) string) (string, error) {
+	for _, envName := range envNames(name) {
+		value := lookup(envName)
+		if value != "" {
+			return value, nil
+		}
+	}
+
+	for _, fileVar := range fileEnvNames(name) {
+		path := lookup(fileVar)
+		if path == "" {
+			continue
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return "", fmt.Errorf("reading %s: %w", fileVar, err)
+		}
+
+		// Secret files commonly end with a newline which is not part of the value.
+		return strings.TrimRight(string(data), "\r\n"), nil
+	}
+
+	return "", nil
+}
+
+// registeredFlag registers command line arguments and tracks them to avoid reregistration.
+func registerFlag(name string, value *string, usage string) error {
+	defaultValue, err := envValue(name)
+	if err != nil {
+		return err
+	}
+
+	if !registeredFlags[name] {
+		flag.StringVar(value, name, defaultValue, usage)
+		registeredFlags[name] = true
+	}
+
+	if registeredFlags[name] && defaultValue != "" {
+		*value = defaultValue
+	}
+
+	// When loading the configuration again (e.g. on reload), the flag is bound to the
+	// previously loaded configuration. Carry over its command line value instead.
+	if flagPassed(name) {
+		*value = flag.Lookup(name).Value.String()
+	}
+
+	return nil
+}
+
+// s3Config is the access configuration for an S3 or S3-compatible bucket.
+type s3Config struct {
+	Endpoint string
+	Bucket   string
+	Prefix   string
+	Options  *minio.Options
+	// Copies are the additional destinations archives are uploaded to.
+	Copies []copyDestination
+	// Fallback is the destination archives are uploaded to when the upload to the bucket
+	// fails, if any.
+	Fallback *copyDestination
+	// OpenStorage connects to the storage of backends other than S3, nil for the bucket.
+	OpenStorage storageOpener
+	// Retention is the object lock retention of uploaded archives, nil if they are not
+	// locked.
+	Retention *objectRetention
+	// Create holds the options of creating the bucket on startup when it does not exist, nil
+	// if the bucket must exist.
+	Create *minio.MakeBucketOptions
+	// Checksum is the checksum sent along uploads for the storage to verify.
+	Checksum uploadChecksum
+	// Circuit is the circuit breaker policy pausing uploads to a failing storage, nil if
+	// uploads are never paused.
+	Circuit *circuitPolicy
+	// Parity is the size of the parity data uploaded alongside archives, in percent of their
+	// size, zero if archives have no parity data.
+	Parity int
+	// Middleware wraps the upload of archives, the first middleware being the outermost.
+	Middleware []uploadMiddleware
+}
+
+// Config is the configuration struct for the service.
+type Config struct {
+	Backend          string
+	Endpoint         string
+	AccessKeyID      string
+	SecretAccessKey  string
+	Bucket           string
+	Region           string
+	CreateBucket     string
+	BucketLock       string
+	Checksum         string
+	Signature        string
+	BucketLookup     string
+	UserAgent        string
+	CircuitThreshold string
+	CircuitProbe     string
+	UploadMiddleware string
+	SFTPHost         string
+	SFTPUser         string
+	SFTPKey          string
+	SFTPKnownHosts   string
+	SFTPPath         string
+	LocalDir         string
+	B2KeyID          string
+	B2AppKey         string
+	B2BucketID       string
+	StorageCommand   string
+	SourceDir        string
+	WatchFiles       string
+	WatchQuiet       string
+	Jitter           string
+	Environment      string
+	InstanceID       string
+	Catchup          string
+	PreRun           string
+	PostRun          string
+	DumpCommand      string
+	DumpFile         string
+	Incremental      string
+	Differential     string
+	Dedup            string
+	SkipUnchanged    string
+	SkipEmpty        string
+	Delta            string
+	Symlinks         string
+	EmptyDirs        string
+	HardLinks        string
+	Xattrs           string
+	SQLite           string
+	Snapshot         string
+	SnapshotDir      string
+	FSSnapshot       string
+	RequireMount     string
+	Sentinel         string
+	FileChecksums    string
+	Subdirs          string
+	Workers          string
+	Parity           string
+	MaxJobs          string
+	CopyBuffer       string
+	DiskRatio        string
+	DiskMargin       string
+	MaxStagingSize   string
+	MinFiles         string
+	MinBytes         string
+	VerifySample     string
+	MaxFileSize      string
+	MaxBucketUsage   string
+	QuotaPolicy      string
+	StaleArchives    string
+	ObjectLockMode   string
+	ObjectLockPeriod string
+	LogLevel         string
+	LogFormat        string
+	LogFile          string
+	LogMaxSize       string
+	LogMaxBackups    string
+	Syslog           string
+	Timezone         string
+	VaultAddr        string
+	VaultAuth        string
+	VaultToken       string
+	VaultRoleID      string
+	VaultSecretID    string
+	VaultSecretPath  string
+	ConfigPath       string
+	PIDFile          string
+	HistoryDB        string
+	StateFile        string
+	Catalog          string
+	RunReports       string
+	DistributedLock  string
+	LeaderElection   string
+	LockBucket       string
+	LockTTL          string
+	Pushgateway      string
+	Statsd           string
+	StatsdPrefix     string
+	StatsdTags       string
+	HealthAddr       string
+	Pprof            string
+	APIToken         string
+	GRPCAddr         string
+	GRPCCert         string
+	GRPCKey          string
+	GRPCRestoreRoot  string
+	Dashboard        string
+	DashboardUser    string
+	DashboardPass    string
+	PingURL          string
+	MaxBackupAge     string
+	UsageInterval    string
+	StorageCost      string
+	ScrubInterval    string
+	DrillInterval    string
+	NotifyOn         string
+	SlackWebhook     string
+	DiscordWebhook   string
+	SMTPHost         string
+	SMTPPort         string
+	SMTPTLS          string
+	SMTPUsername     string
+	SMTPPassword     string
+	SMTPFrom         string
+	SMTPTo           string
+	TelegramToken    string
+	TelegramChatID   string
+	WebhookURL       string
+	WebhookSecret    string
+	EventsURL        string
+	EventsPrefix     string
+	Jobs             []jobConfig
+	Destinations     []destinationConfig
+	Fallback         *destinationConfig
+	Lifecycle        []lifecycleRule
+	Compression      []compressionRule
+
+	// envPath is the path of the .env file the configuration was loaded from.
+	envPath string
+	// staticCreds indicates the access keys were read from the config file.
+	staticCreds bool
+	// transport is the HTTP transport of storage requests, the default one if nil.
+	transport http.RoundTripper
+}
+
+// validate ensures that the configuration is valid.
+func (c *Config) validate() error {
+	var errs error
+
+	errs = errors.Join(errs, c.validateBackend())
+	s3 := c.backend() == backendS3
+
+	if s3 && c.Endpoint == "" {
+		errs = errors.Join(errs, fmt.Errorf("s3/s3-compatible endpoint required"))
+	} else if s3 {
+		_, _, err := parseEndpoint(c.Endpoint)
+		errs = errors.Join(errs, err)
+	}
+
+	if c.VaultAddr != "" {
+		errs = errors.Join(errs, c.validateVault())
+	} else if s3 {
+		if c.AccessKeyID == "" {
+			errs = errors.Join(errs, fmt.Errorf("access key ID required"))
+		}
+
+		if c.SecretAccessKey == "" {
+			errs = errors.Join(errs, fmt.Errorf("secret access key required"))
+		}
+	}
+
+	errs = errors.Join(errs, validateDestinations(c.Destinations, c.Fallback, c.jobs()))
+	errs = errors.Join(errs, validateLifecycle(c.Lifecycle))
+	errs = errors.Join(errs, validateCompression(c.Compression))
+
+	if len(c.Jobs) == 0 {
+		if s3 && c.Bucket == "" {
+			errs = errors.Join(errs, fmt.Errorf("bucket required"))
+		}
+
+		// Stream uploads do not archive a source directory.
+		if c.SourceDir == "" && !streamStdin {
+			errs = errors.Join(errs, fmt.Errorf("source directory required"))
+		}
+
+		if c.DumpCommand != "" || c.DumpFile != "" {
+			dump := dumpConfig{Command: c.DumpCommand, File: c.DumpFile}
+			errs = errors.Join(errs, dump.validate())
+		}
+	} else {
+		errs = errors.Join(errs, c.validateJobs())
+
+		// Jobs configure their own dumps.
+		if c.DumpCommand != "" || c.DumpFile != "" {
+			errs = errors.Join(errs, errors.New("dump command requires the flat source directory, configure the dump of jobs instead"))
+		}
+	}
+
+	errs = errors.Join(errs, c.validateLock())
+
+	if c.Pushgateway != "" {
+		errs = errors.Join(errs, validateURL("pushgateway", c.Pushgateway))
+	}
+
+	if c.PingURL != "" {
+		errs = errors.Join(errs, validateURL("ping", c.PingURL))
+	}
+
+	if c.MaxJobs != "" {
+		jobs, err := strconv.Atoi(c.MaxJobs)
+		if err != nil || jobs < 0 {
+			errs = errors.Join(errs, fmt.Errorf("invalid job limit %q", c.MaxJobs))
+		}
+	}
+
+	if c.Workers != "" {
+		workers, err := strconv.Atoi(c.Workers)
+		if err != nil || workers < 0 {
+			errs = errors.Join(errs, fmt.Errorf("invalid worker count %q", c.Workers))
+		}
+	}
+
+	if c.Parity != "" {
+		parity, err := strconv.Atoi(c.Parity)
+		if err != nil || parity < 0 || parity > 100 {
+			errs = errors.Join(errs, fmt.Errorf("invalid parity percentage %q, expected 0 to 100", c.Parity))
+		}
+	}
+
+	if c.WatchFiles != "" {
+		files, err := strconv.Atoi(c.WatchFiles)
+		if err != nil || files < 0 {
+			errs = errors.Join(errs, fmt.Errorf("invalid watch file count %q", c.WatchFiles))
+		}
+	}
+
+	if c.WatchQuiet != "" {
+		errs = errors.Join(errs, validateWatchQuiet(c.WatchQuiet))
+	}
+
+	if c.Jitter != "" {
+		errs = errors.Join(errs, validateJitter(c.Jitter))
+	}
+
+	errs = errors.Join(errs, validateEnvironment(c.Environment))
+	errs = errors.Join(errs, validateInstanceID(c.InstanceID))
+
+	errs = errors.Join(errs, c.validateNotifications())
+
+	if c.MaxBackupAge != "" {
+		age, err := time.ParseDuration(c.MaxBackupAge)
+		if err != nil || age <= 0 {
+			errs = errors.Join(errs, fmt.Errorf("invalid maximum backup age %q", c.MaxBackupAge))
+		}
+	}
+
+	if c.UsageInterval != "" {
+		interval, err := time.ParseDuration(c.UsageInterval)
+		if err != nil || interval < usageCheckInterval {
+			errs = errors.Join(errs, fmt.Errorf("invalid usage report interval %q, expected a duration of at least 1m", c.UsageInterval))
+		}
+	}
+
+	if c.StorageCost != "" {
+		cost, err := strconv.ParseFloat(c.StorageCost, 64)
+		if err != nil || cost < 0 {
+			errs = errors.Join(errs, fmt.Errorf("invalid storage cost %q", c.StorageCost))
+		}
+	}
+
+	errs = errors.Join(errs, validateChecksum(c.Checksum))
+	errs = errors.Join(errs, validateSignature(c.Signature))
+	errs = errors.Join(errs, validateBucketLookup(c.BucketLookup))
+	if c.Signature == signatureV2 && uploadChecksum(c.Checksum).trailingHeaders() {
+		errs = errors.Join(errs, fmt.Errorf("%s upload checksums require %s request signatures", c.Checksum, signatureV4))
+	}
+
+	if c.CircuitThreshold != "" {
+		threshold, err := strconv.Atoi(c.CircuitThreshold)
+		if err != nil || threshold < 0 {
+			errs = errors.Join(errs, fmt.Errorf("invalid circuit breaker threshold %q", c.CircuitThreshold))
+		}
+	}
+
+	_, err := parseUploadMiddleware(c.UploadMiddleware)
+	errs = errors.Join(errs, err)
+
+	if c.CircuitProbe != "" {
+		interval, err := time.ParseDuration(c.CircuitProbe)
+		if err != nil || interval <= 0 {
+			errs = errors.Join(errs, fmt.Errorf("invalid circuit breaker probe interval %q", c.CircuitProbe))
+		}
+	}
+
+	if c.ScrubInterval != "" {
+		interval, err := time.ParseDuration(c.ScrubInterval)
+		if err != nil || interval < scrubCheckInterval {
+			errs = errors.Join(errs, fmt.Errorf("invalid scrub interval %q, expected a duration of at least 1m", c.ScrubInterval))
+		}
+	}
+
+	if c.DrillInterval != "" {
+		interval, err := time.ParseDuration(c.DrillInterval)
+		if err != nil || interval < drillCheckInterval {
+			errs = errors.Join(errs, fmt.Errorf("invalid restore drill interval %q, expected a duration of at least 1m", c.DrillInterval))
+		}
+	}
+
+	if c.HealthAddr != "" {
+		_, _, err := net.SplitHostPort(c.HealthAddr)
+		if err != nil {
+			errs = errors.Join(errs, fmt.Errorf("invalid health address %q", c.HealthAddr))
+		}
+	}
+
+	if c.CreateBucket != "" {
+		_, err := strconv.ParseBool(c.CreateBucket)
+		if err != nil {
+			errs = errors.Join(errs, fmt.Errorf("invalid create bucket setting %q", c.CreateBucket))
+		}
+	}
+
+	if c.BucketLock != "" {
+		_, err := strconv.ParseBool(c.BucketLock)
+		if err != nil {
+			errs = errors.Join(errs, fmt.Errorf("invalid bucket object lock setting %q", c.BucketLock))
+		}
+	}
+
+	// Object lock can only be enabled when buckets are created.
+	if c.bucketLock() && !c.createBucket() {
+		errs = errors.Join(errs, errors.New("bucket object lock requires createbucket"))
+	}
+
+	if c.Catchup != "" {
+		_, err := strconv.ParseBool(c.Catchup)
+		if err != nil {
+			errs = errors.Join(errs, fmt.Errorf("invalid catch-up setting %q", c.Catchup))
+		}
+	}
+
+	// Catch-up runs need the last successful runs recorded in the state file.
+	catchup := slices.ContainsFunc(c.jobs(), func(job jobConfig) bool { return job.Catchup })
+	if catchup && c.StateFile == "" {
+		errs = errors.Join(errs, fmt.Errorf("catch-up runs require a state file"))
+	}
+
+	if c.Incremental != "" {
+		_, err := strconv.ParseBool(c.Incremental)
+		if err != nil {
+			errs = errors.Join(errs, fmt.Errorf("invalid incremental setting %q", c.Incremental))
+		}
+	}
+
+	if c.Differential != "" {
+		_, err := parseWeekday(c.Differential)
+		if err != nil {
+			errs = errors.Join(errs, fmt.Errorf("differential backups: %w", err))
+		}
+
+		if c.incremental() {
+			errs = errors.Join(errs, errors.New("incremental and differential backups are exclusive"))
+		}
+	}
+
+	if c.Dedup != "" {
+		_, err := strconv.ParseBool(c.Dedup)
+		if err != nil {
+			errs = errors.Join(errs, fmt.Errorf("invalid dedup setting %q", c.Dedup))
+		}
+	}
+
+	if c.Delta != "" {
+		deltas, err := strconv.Atoi(c.Delta)
+		if err != nil || deltas < 0 {
+			errs = errors.Join(errs, fmt.Errorf("invalid delta count %q", c.Delta))
+		}
+
+		if deltas > 0 && (c.incremental() || c.Differential != "" || c.dedup()) {
+			errs = errors.Join(errs, errors.New("delta archives are exclusive with incremental, differential and deduplicated backups"))
+		}
+	}
+
+	errs = errors.Join(errs, validateSymlinks(c.Symlinks))
+	errs = errors.Join(errs, validateSnapshot(c.Snapshot))
+	errs = errors.Join(errs, validateFSSnapshot(c.FSSnapshot))
+	if c.Snapshot != "" && c.FSSnapshot != "" {
+		errs = errors.Join(errs, errors.New("snapshot and fssnapshot are mutually exclusive"))
+	}
+	errs = errors.Join(errs, validateStaleArchives(c.StaleArchives))
+	errs = errors.Join(errs, validateObjectLock(c.ObjectLockMode, c.ObjectLockPeriod))
+	if c.ObjectLockMode != "" && c.dedup() {
+		errs = errors.Join(errs, errors.New("object lock and deduplicated backups are exclusive"))
+	}
+
+	if c.EmptyDirs != "" {
+		_, err := strconv.ParseBool(c.EmptyDirs)
+		if err != nil {
+			errs = errors.Join(errs, fmt.Errorf("invalid empty directories setting %q", c.EmptyDirs))
+		}
+	}
+
+	if c.HardLinks != "" {
+		_, err := strconv.ParseBool(c.HardLinks)
+		if err != nil {
+			errs = errors.Join(errs, fmt.Errorf("invalid hard links setting %q", c.HardLinks))
+		}
+	}
+
+	if c.Xattrs != "" {
+		_, err := strconv.ParseBool(c.Xattrs)
+		if err != nil {
+			errs = errors.Join(errs, fmt.Errorf("invalid extended attributes setting %q", c.Xattrs))
+		}
+	}
+
+	if c.SQLite != "" {
+		_, err := strconv.ParseBool(c.SQLite)
+		if err != nil {
+			errs = errors.Join(errs, fmt.Errorf("invalid SQLite setting %q", c.SQLite))
+		}
+	}
+
+	if c.RequireMount != "" {
+		_, err := strconv.ParseBool(c.RequireMount)
+		if err != nil {
+			errs = errors.Join(errs, fmt.Errorf("invalid mount requirement setting %q", c.RequireMount))
+		}
+	}
+
+	errs = errors.Join(errs, validateSentinel(c.Sentinel))
+
+	if c.FileChecksums != "" {
+		_, err := strconv.ParseBool(c.FileChecksums)
+		if err != nil {
+			errs = errors.Join(errs, fmt.Errorf("invalid file checksums setting %q", c.FileChecksums))
+		}
+	}
+
+	if c.CopyBuffer != "" {
+		size, err := parseSize(c.CopyBuffer)
+		if err != nil {
+			errs = errors.Join(errs, fmt.Errorf("copy buffer: %w", err))
+		} else if size < minCopyBufferSize || size > maxCopyBufferSize {
+			errs = errors.Join(errs, fmt.Errorf("copy buffer size %q out of range (4KiB to 64MiB)", c.CopyBuffer))
+		}
+	}
+
+	if c.DiskRatio != "" {
+		ratio, err := strconv.ParseFloat(c.DiskRatio, 64)
+		if err != nil || ratio <= 0 {
+			errs = errors.Join(errs, fmt.Errorf("invalid disk ratio %q", c.DiskRatio))
+		}
+	}
+
+	if c.DiskMargin != "" {
+		_, err := parseSize(c.DiskMargin)
+		if err != nil {
+			errs = errors.Join(errs, fmt.Errorf("disk margin: %w", err))
+		}
+	}
+
+	if c.MaxStagingSize != "" {
+		_, err := parseSize(c.MaxStagingSize)
+		if err != nil {
+			errs = errors.Join(errs, fmt.Errorf("max staging size: %w", err))
+		}
+	}
+
+	if c.MinFiles != "" {
+		minFiles, err := strconv.Atoi(c.MinFiles)
+		if err != nil || minFiles < 0 {
+			errs = errors.Join(errs, fmt.Errorf("invalid minimum file count %q", c.MinFiles))
+		}
+	}
+
+	if c.MinBytes != "" {
+		_, err := parseSize(c.MinBytes)
+		if err != nil {
+			errs = errors.Join(errs, fmt.Errorf("minimum archive size: %w", err))
+		}
+	}
+
+	if c.VerifySample != "" {
+		verifySample, err := strconv.Atoi(c.VerifySample)
+		if err != nil || verifySample < 0 {
+			errs = errors.Join(errs, fmt.Errorf("invalid verification sample %q", c.VerifySample))
+		}
+	}
+
+	if c.MaxFileSize != "" {
+		_, err := parseSize(c.MaxFileSize)
+		if err != nil {
+			errs = errors.Join(errs, fmt.Errorf("max file size: %w", err))
+		}
+	}
+
+	if c.MaxBucketUsage != "" {
+		_, err := parseSize(c.MaxBucketUsage)
+		if err != nil {
+			errs = errors.Join(errs, fmt.Errorf("max bucket usage: %w", err))
+		}
+
+		if c.dedup() {
+			errs = errors.Join(errs, errors.New("max bucket usage and deduplicated backups are exclusive"))
+		}
+	}
+	errs = errors.Join(errs, validateQuotaPolicy(c.QuotaPolicy))
+
+	if c.Subdirs != "" {
+		_, err := strconv.ParseBool(c.Subdirs)
+		if err != nil {
+			errs = errors.Join(errs, fmt.Errorf("invalid subdirectories setting %q", c.Subdirs))
+		}
+
+		if c.subdirs() && (c.DumpCommand != "" || c.DumpFile != "") {
+			errs = errors.Join(errs, errors.New("subdirectory archives and database dumps are exclusive"))
+		}
+	}
+
+	if c.SkipUnchanged != "" {
+		_, err := strconv.ParseBool(c.SkipUnchanged)
+		if err != nil {
+			errs = errors.Join(errs, fmt.Errorf("invalid skip unchanged setting %q", c.SkipUnchanged))
+		}
+	}
+
+	if c.SkipEmpty != "" {
+		_, err := strconv.ParseBool(c.SkipEmpty)
+		if err != nil {
+			errs = errors.Join(errs, fmt.Errorf("invalid skip empty setting %q", c.SkipEmpty))
+		}
+	}
+
+	if c.RunReports != "" {
+		_, err := strconv.ParseBool(c.RunReports)
+		if err != nil {
+			errs = errors.Join(errs, fmt.Errorf("invalid run reports setting %q", c.RunReports))
+		}
+	}
+
+	if c.Catalog != "" {
+		_, err := strconv.ParseBool(c.Catalog)
+		if err != nil {
+			errs = errors.Join(errs, fmt.Errorf("invalid catalog setting %q", c.Catalog))
+		}
+	}
+
+	if c.Dashboard != "" {
+		_, err := strconv.ParseBool(c.Dashboard)
+		if err != nil {
+			errs = errors.Join(errs, fmt.Errorf("invalid dashboard setting %q", c.Dashboard))
+		}
+	}
+
+	if c.dashboard() && c.HealthAddr == "" {
+		errs = errors.Join(errs, errors.New("dashboard requires a health address"))
+	}
+
+	// The dashboard triggers runs and shares archives, it is never served without
+	// authentication.
+	if c.dashboard() && c.DashboardPass == "" {
+		errs = errors.Join(errs, errors.New("dashboard requires a username and password"))
+	}
+
+	if (c.DashboardUser == "") != (c.DashboardPass == "") {
+		errs = errors.Join(errs, errors.New("dashboard username and password must be set together"))
+	}
+
+	if c.APIToken != "" && c.HealthAddr == "" {
+		errs = errors.Join(errs, errors.New("api token requires a health address"))
+	}
+
+	if c.GRPCAddr != "" {
+		host, _, err := net.SplitHostPort(c.GRPCAddr)
+		if err != nil {
+			errs = errors.Join(errs, fmt.Errorf("invalid grpc address %q", c.GRPCAddr))
+		}
+
+		// Bearer tokens are only sent in plaintext over loopback connections.
+		if err == nil && c.GRPCCert == "" && !isLoopbackHost(host) {
+			errs = errors.Join(errs, fmt.Errorf("grpc address %q requires a certificate and key unless it is a loopback address", c.GRPCAddr))
+		}
+
+		if c.APIToken == "" {
+			errs = errors.Join(errs, errors.New("grpc address requires an api token"))
+		}
+	}
+
+	if (c.GRPCCert == "") != (c.GRPCKey == "") {
+		errs = errors.Join(errs, errors.New("grpc certificate and key must be set together"))
+	}
+
+	if c.GRPCRestoreRoot != "" && !filepath.IsAbs(c.GRPCRestoreRoot) {
+		errs = errors.Join(errs, fmt.Errorf("grpc restore root %q must be an absolute path", c.GRPCRestoreRoot))
+	}
+
+	if c.Pprof != "" {
+		_, err := strconv.ParseBool(c.Pprof)
+		if err != nil {
+			errs = errors.Join(errs, fmt.Errorf("invalid pprof setting %q", c.Pprof))
+		}
+	}
+
+	if c.profiling() && c.HealthAddr == "" {
+		errs = errors.Join(errs, errors.New("pprof requires a health address"))
+	}
+
+	if c.Statsd != "" {
+		_, _, err := net.SplitHostPort(c.Statsd)
+		if err != nil {
+			errs = errors.Join(errs, fmt.Errorf("invalid statsd address %q", c.Statsd))
+		}
+	}
+
+	if c.LogLevel == "" {
+		errs = errors.Join(errs, fmt.Errorf("log level required"))
+	} else if !logLevels[c.LogLevel] {
+		errs = errors.Join(errs, fmt.Errorf("unknown log level %q (debug, info, warn, error, fatal)", c.LogLevel))
+	}
+
+	switch c.LogFormat {
+	case "", logFormatJSON, logFormatConsole:
+	default:
+		errs = errors.Join(errs, fmt.Errorf("unknown log format %q (json, console)", c.LogFormat))
+	}
+
+	if c.LogMaxSize != "" {
+		size, err := parseSize(c.LogMaxSize)
+		if err != nil {
+			errs = errors.Join(errs, fmt.Errorf("log file size: %w", err))
+		} else if size == 0 {
+			errs = errors.Join(errs, fmt.Errorf("invalid log file size %q", c.LogMaxSize))
+		}
+	}
+
+	if c.LogMaxBackups != "" {
+		backups, err := strconv.Atoi(c.LogMaxBackups)
+		if err != nil || backups < 0 {
+			errs = errors.Join(errs, fmt.Errorf("invalid log file backup count %q", c.LogMaxBackups))
+		}
+	}
+
+	if c.Syslog != "" {
+		_, _, err := parseSyslogAddr(c.Syslog)
+		if err != nil {
+			errs = errors.Join(errs, err)
+		}
+	}
+
+	if c.Timezone != "" {
+		_, err := time.LoadLocation(c.Timezone)
+		if err != nil {
+			errs = errors.Join(errs, fmt.Errorf("invalid timezone %q", c.Timezone))
+		}
+	}
+
+	return errs
+}
+
+// validateJobs ensures that the configured archive jobs are valid.
+func (c *Config) validateJobs() error {
+	var errs error
+
+	names := make(map[string]bool)
+	for _, job := range c.jobs() {
+		errs = errors.Join(errs, job.validate())
+
+		if names[job.Name] {
+			errs = errors.Join(errs, fmt.Errorf("duplicate job name %q", job.Name))
+		}
+		names[job.Name] = true
+
+		if job.Bucket == "" && c.backend() == backendS3 {
+			errs = errors.Join(errs, fmt.Errorf("job %q: bucket required", job.Name))
+		}
+	}
+
+	return errs
+}
+
+// validateBackend ensures that the storage backend configuration is valid. Backends other
+// than S3 store plain archives and their manifests only, features keeping further objects
+// next to the archives require S3.
+func (c *Config) validateBackend() error {
+	var errs error
+	switch c.backend() {
+	case backendS3:
+		return nil
+
+	case backendSFTP:
+		if c.SFTPHost == "" || c.SFTPUser == "" || c.SFTPKey == "" || c.SFTPPath == "" {
+			errs = errors.Join(errs, errors.New("sftp backend requires a host, user, key and path"))
+		}
+
+	case backendLocalDir:
+		if c.LocalDir == "" {
+			errs = errors.Join(errs, errors.New("localdir backend requires a directory"))
+		} else if !filepath.IsAbs(c.LocalDir) {
+			errs = errors.Join(errs, fmt.Errorf("localdir %q must be an absolute path", c.LocalDir))
+		}
+
+	case backendB2:
+		if c.B2KeyID == "" || c.B2AppKey == "" || c.B2BucketID == "" {
+			errs = errors.Join(errs, errors.New("b2 backend requires an application key ID, application key and bucket ID"))
+		}
+
+	case backendExec:
+		if c.StorageCommand == "" {
+			errs = errors.Join(errs, errors.New("exec backend requires a storage command"))
+		}
+
+	default:
+		return fmt.Errorf("unknown backend %q (s3, sftp, localdir, b2, exec)", c.Backend)
+	}
+
+	if c.createBucket() {
+		errs = errors.Join(errs, fmt.Errorf("%s backend cannot create buckets", c.backend()))
+	}
+
+	for _, job := range c.jobs() {
+		if job.ObjectLockMode != "" {
+			errs = errors.Join(errs, fmt.Errorf("job %s: object lock requires the s3 backend", job.Name))
+		}
+
+		if job.chained() || job.SkipUnchanged || job.Dedup || job.Delta > 0 {
+			errs = errors.Join(errs, fmt.Errorf("job %s: %s backend requires plain archives, not incremental, differential, skipunchanged, dedup or delta", job.Name, c.backend()))
+		}
+	}
+
+	if c.catalog() || c.runReports() {
+		errs = errors.Join(errs, errors.New("catalog and run reports require the s3 backend"))
+	}
+
+	if c.distributedLock() || c.leaderElection() {
+		errs = errors.Join(errs, errors.New("distributed lock and leader election require the s3 backend"))
+	}
+
+	if len(c.Destinations) > 0 || c.Fallback != nil {
+		errs = errors.Join(errs, errors.New("additional and fallback destinations require the s3 backend"))
+	}
+
+	if len(c.Lifecycle) > 0 {
+		errs = errors.Join(errs, errors.New("lifecycle rules require the s3 backend"))
+	}
+
+	if streamStdin {
+		errs = errors.Join(errs, errors.New("stream uploads require the s3 backend"))
+	}
+
+	return errs
+}
+
+// validateLock ensures that the distributed lock and leader election configuration is valid.
+func (c *Config) validateLock() error {
+	var errs error
+
+	if c.DistributedLock != "" {
+		_, err := strconv.ParseBool(c.DistributedLock)
+		if err != nil {
+			errs = errors.Join(errs, fmt.Errorf("invalid distributed lock setting %q", c.DistributedLock))
+		}
+	}
+
+	if c.LeaderElection != "" {
+		_, err := strconv.ParseBool(c.LeaderElection)
+		if err != nil {
+			errs = errors.Join(errs, fmt.Errorf("invalid leader election setting %q", c.LeaderElection))
+		}
+	}
+
+	if !c.distributedLock() && !c.leaderElection() {
+		return errs
+	}
+
+	if c.lockBucket() == "" {
+		errs = errors.Join(errs, fmt.Errorf("lock bucket required for the distributed lock"))
+	}
+
+	if c.LockTTL != "" {
+		ttl, err := time.ParseDuration(c.LockTTL)
+		if err != nil || ttl <= 0 {
+			errs = errors.Join(errs, fmt.Errorf("invalid lock ttl %q", c.LockTTL))
+		}
+	}
+
+	return errs
+}
+
+// backend returns the storage backend archives are uploaded to, S3 unless configured.
+func (c *Config) backend() string {
+	if c.Backend == "" {
+		return backendS3
+	}
+
+	return c.Backend
+}
+
+// sftp returns the access configuration of the SFTP backend's directory.
+func (c *Config) sftp() *sftpConfig {
+	knownHosts := c.SFTPKnownHosts
+	if knownHosts == "" {
+		knownHosts = defaultKnownHosts()
+	}
+
+	return &sftpConfig{
+		Host:       c.SFTPHost,
+		User:       c.SFTPUser,
+		Key:        c.SFTPKey,
+		KnownHosts: knownHosts,
+		Path:       c.SFTPPath,
+	}
+}
+
+// distributedLock returns whether job runs are coordinated with other instances through
+// lock objects.
+func (c *Config) distributedLock() bool {
+	enabled, _ := strconv.ParseBool(c.DistributedLock)
+	return enabled
+}
+
+// createBucket returns whether missing buckets are created on startup.
+func (c *Config) createBucket() bool {
+	enabled, _ := strconv.ParseBool(c.CreateBucket)
+	return enabled
+}
+
+// bucketLock returns whether buckets created on startup have object lock enabled.
+func (c *Config) bucketLock() bool {
+	enabled, _ := strconv.ParseBool(c.BucketLock)
+	return enabled
+}
+
+// catchup returns whether jobs which missed a scheduled run while the service was down run
+// on startup.
+func (c *Config) catchup() bool {
+	enabled, _ := strconv.ParseBool(c.Catchup)
+	return enabled
+}
+
+// incremental returns whether jobs only archive the files modified since their last
+// successful run.
+func (c *Config) incremental() bool {
+	enabled, _ := strconv.ParseBool(c.Incremental)
+	return enabled
+}
+
+// dedup returns whether archives are uploaded as content-defined chunks, skipping the
+// chunks already in their bucket.
+func (c *Config) dedup() bool {
+	enabled, _ := strconv.ParseBool(c.Dedup)
+	return enabled
+}
+
+// skipUnchanged returns whether archives identical to the previous archive of their job are
+// not uploaded.
+func (c *Config) skipUnchanged() bool {
+	enabled, _ := strconv.ParseBool(c.SkipUnchanged)
+	return enabled
+}
+
+// skipEmpty returns whether runs without files to archive skip the upload.
+func (c *Config) skipEmpty() bool {
+	enabled, _ := strconv.ParseBool(c.SkipEmpty)
+	return enabled
+}
+
+// emptyDirs returns whether directories are added to archives, so restores recreate empty
+// directories.
+func (c *Config) emptyDirs() bool {
+	enabled, _ := strconv.ParseBool(c.EmptyDirs)
+	return enabled
+}
+
+// hardLinks returns whether the content of hard linked files is only archived once.
+func (c *Config) hardLinks() bool {
+	enabled, _ := strconv.ParseBool(c.HardLinks)
+	return enabled
+}
+
+// xattrs returns whether the extended attributes of files are archived.
+func (c *Config) xattrs() bool {
+	enabled, _ := strconv.ParseBool(c.Xattrs)
+	return enabled
+}
+
+// sqlite returns whether SQLite databases are archived from a consistent copy.
+func (c *Config) sqlite() bool {
+	enabled, _ := strconv.ParseBool(c.SQLite)
+	return enabled
+}
+
+// requireMount returns whether runs require their source directory to be a mount point.
+func (c *Config) requireMount() bool {
+	enabled, _ := strconv.ParseBool(c.RequireMount)
+	return enabled
+}
+
+// fileChecksums returns whether archives embed the SHA-256 checksums of their files.
+func (c *Config) fileChecksums() bool {
+	enabled, _ := strconv.ParseBool(c.FileChecksums)
+	return enabled
+}
+
+// location returns the timezone of schedules and purge windows, the host's local timezone
+// unless configured.
+func (c *Config) location() *time.Location {
+	if c.Timezone == "" {
+		return time.Local
+	}
+
+	loc, err := time.LoadLocation(c.Timezone)
+	if err != nil {
+		return time.Local
+	}
+
+	return loc
+}
+
+// copyBufferSize returns the size of the copy buffers.
+func (c *Config) copyBufferSize() int {
+	size, err := parseSize(c.CopyBuffer)
+	if err != nil || size == 0 {
+		return defaultCopyBufferSize
+	}
+
+	return int(size)
+}
+
+// logMaxSize returns the size of the log file at which it is rotated.
+func (c *Config) logMaxSize() int64 {
+	size, err := parseSize(c.LogMaxSize)
+	if err != nil || size == 0 {
+		return defaultLogMaxSize
+	}
+
+	return size
+}
+
+// logMaxBackups returns the number of rotated log files kept.
+func (c *Config) logMaxBackups() int {
+	backups, err := strconv.Atoi(c.LogMaxBackups)
+	if err != nil || backups < 0 {
+		return defaultLogMaxBackups
+	}
+
+	return backups
+}
+
+// subdirs returns whether every subdirectory of the source directory is archived separately.
+func (c *Config) subdirs() bool {
+	enabled, _ := strconv.ParseBool(c.Subdirs)
+	return enabled
+}
+
+// catalog returns whether the catalog index objects of jobs are maintained in their buckets.
+func (c *Config) catalog() bool {
+	enabled, _ := strconv.ParseBool(c.Catalog)
+	return enabled
+}
+
+// runReports returns whether a report of every run is uploaded to the bucket of its job.
+func (c *Config) runReports() bool {
+	enabled, _ := strconv.ParseBool(c.RunReports)
+	return enabled
+}
+
+// dashboard returns whether the web dashboard is served on the health listener.
+func (c *Config) dashboard() bool {
+	enabled, _ := strconv.ParseBool(c.Dashboard)
+	return enabled
+}
+
+// profiling returns whether the pprof endpoints are served on the health listener.
+func (c *Config) profiling() bool {
+	enabled, _ := strconv.ParseBool(c.Pprof)
+	return enabled
+}
+
+// leaderElection returns whether only the elected leader among instances runs jobs.
+func (c *Config) leaderElection() bool {
+	enabled, _ := strconv.ParseBool(c.LeaderElection)
+	return enabled
+}
+
+// lockBucket returns the bucket distributed lock objects are stored in.
+func (c *Config) lockBucket() string {
+	if c.LockBucket != "" {
+		return c.LockBucket
+	}
+
+	return c.Bucket
+}
+
+// lockTTL returns how long a distributed lock is held without being refreshed.
+func (c *Config) lockTTL() time.Duration {
+	ttl, err := time.ParseDuration(c.LockTTL)
+	if err != nil || ttl <= 0 {
+		return defaultLockTTL
+	}
+
+	return ttl
+}
+
+// validateURL ensures that the provided setting is an absolute http or https URL.
+func validateURL(setting string, value string) error {
+	u, err := url.Parse(value)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("invalid %s url %q", setting, value)
+	}
+
+	return nil
+}
+
+// validateNotifications ensures that the notification configuration is valid.
+func (c *Config) validateNotifications() error {
+	var errs error
+
+	_, err := parseEventFilter(c.NotifyOn)
+	if err != nil {
+		errs = errors.Join(errs, err)
+	}
+
+	if c.SlackWebhook != "" {
+		errs = errors.Join(errs, validateURL("slack webhook", c.SlackWebhook))
+	}
+
+	if c.DiscordWebhook != "" {
+		errs = errors.Join(errs, validateURL("discord webhook", c.DiscordWebhook))
+	}
+
+	if c.SMTPHost != "" {
+		errs = errors.Join(errs, c.validateSMTP())
+	}
+
+	if (c.TelegramToken == "") != (c.TelegramChatID == "") {
+		errs = errors.Join(errs, fmt.Errorf("telegram bot token and chat ID required"))
+	}
+
+	if c.WebhookURL != "" {
+		errs = errors.Join(errs, validateURL("webhook", c.WebhookURL))
+	}
+
+	if c.EventsURL != "" {
+		_, err := eventProtocol(c.EventsURL)
+		if err != nil {
+			errs = errors.Join(errs, err)
+		}
+	}
+
+	return errs
+}
+
+// validateSMTP ensures that the email notification configuration is valid.
+func (c *Config) validateSMTP() error {
+	var errs error
+
+	if c.SMTPPort != "" {
+		port, err := strconv.Atoi(c.SMTPPort)
+		if err != nil || port <= 0 || port > 65535 {
+			errs = errors.Join(errs, fmt.Errorf("invalid smtp port %q", c.SMTPPort))
+		}
+	}
+
+	switch c.SMTPTLS {
+	case "", smtpStartTLS, smtpTLS, smtpNone:
+	default:
+		errs = errors.Join(errs, fmt.Errorf("unknown smtp tls mode %q (starttls, tls, none)", c.SMTPTLS))
+	}
+
+	if c.SMTPFrom == "" {
+		errs = errors.Join(errs, fmt.Errorf("smtp sender address required"))
+	}
+
+	if len(parseAddressList(c.SMTPTo)) == 0 {
+		errs = errors.Join(errs, fmt.Errorf("smtp recipient address required"))
+	}
+
+	return errs
+}
+
+// eventFilter returns a filter of the runs to notify about. Every notification channel has
+// its own filter.
+func (c *Config) eventFilter() *eventFilter {
+	filter, err := parseEventFilter(c.NotifyOn)
+	if err != nil {
+		filter, _ = parseEventFilter(defaultNotifyOn)
+	}
+
+	return filter
+}
+
+// maxBackupAge returns the maximum age of the last successful archive of every job before
+// its backups are considered stale, zero if staleness is not checked.
+func (c *Config) maxBackupAge() time.Duration {
+	age, err := time.ParseDuration(c.MaxBackupAge)
+	if err != nil || age < 0 {
+		return 0
+	}
+
+	return age
+}
+
+// usageInterval returns the interval of storage usage reports, zero if disabled.
+func (c *Config) usageInterval() time.Duration {
+	interval, err := time.ParseDuration(c.UsageInterval)
+	if err != nil || interval < 0 {
+		return 0
+	}
+
+	return interval
+}
+
+// scrubInterval returns the interval of archive scrubs, zero if disabled.
+func (c *Config) scrubInterval() time.Duration {
+	interval, err := time.ParseDuration(c.ScrubInterval)
+	if err != nil || interval < 0 {
+		return 0
+	}
+
+	return interval
+}
+
+// drillInterval returns the interval of restore drills, zero if disabled.
+func (c *Config) drillInterval() time.Duration {
+	interval, err := time.ParseDuration(c.DrillInterval)
+	if err != nil || interval < 0 {
+		return 0
+	}
+
+	return interval
+}
+
+// storageCost returns the price of storing a GB for a month, which storage usage costs are
+// estimated with.
+func (c *Config) storageCost() float64 {
+	cost, _ := strconv.ParseFloat(c.StorageCost, 64)
+	return cost
+}
+
+// reporters returns the reporters archive run outcomes are sent to.
+func (c *Config) reporters() []runReporter {
+	var reporters []runReporter
+
+	if c.Pushgateway != "" {
+		reporters = append(reporters, newPushgateway(c.Pushgateway))
+	}
+
+	if c.Statsd != "" {
+		tags := parseStatsdTags(c.StatsdTags)
+		if c.InstanceID != "" {
+			tags = append(tags, "instance:"+c.InstanceID)
+		}
+		reporters = append(reporters, newStatsd(c.Statsd, c.StatsdPrefix, tags))
+	}
+
+	reporters = append(reporters, c.notifiers()...)
+
+	if c.WebhookURL != "" {
+		reporters = append(reporters, newWebhook(c.WebhookURL, c.WebhookSecret))
+	}
+
+	if c.EventsURL != "" {
+		bus, err := newEventBus(c.EventsURL, c.EventsPrefix)
+		if err == nil {
+			reporters = append(reporters, bus)
+		}
+	}
+
+	return reporters
+}
+
+// urlCredentials returns the credentials embedded in the provided URL, its password or, for
+// token authentication (e.g. nats://token@host), its username.
+func urlCredentials(rawURL string) []string {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.User == nil {
+		return nil
+	}
+
+	password, ok := u.User.Password()
+	if ok {
+		return []string{password}
+	}
+
+	return []string{u.User.Username()}
+}
+
+// secrets returns the secret values of the configuration, which are masked in log output
+// and reported errors. Webhook and ping URLs are secrets as well, they authorize posting,
+// as are the credentials embedded in the events URL.
+func (c *Config) secrets() []string {
+	secrets := []string{
+		c.SecretAccessKey, c.VaultToken, c.VaultSecretID, c.APIToken, c.DashboardPass,
+		c.SlackWebhook, c.DiscordWebhook, c.SMTPPassword, c.TelegramToken, c.WebhookSecret,
+		c.B2AppKey, c.PingURL,
+	}
+	secrets = append(secrets, urlCredentials(c.PingURL)...)
+	secrets = append(secrets, urlCredentials(c.EventsURL)...)
+	for _, job := range c.Jobs {
+		secrets = append(secrets, job.PingURL)
+		secrets = append(secrets, urlCredentials(job.PingURL)...)
+	}
+	for _, dest := range c.Destinations {
+		secrets = append(secrets, dest.SecretAccessKey)
+	}
+	if c.Fallback != nil {
+		secrets = append(secrets, c.Fallback.SecretAccessKey)
+	}
+
+	return secrets
+}
+
+// notifiers returns the notification channels, the reporters sending human readable run
+// summaries.
+func (c *Config) notifiers() []runReporter {
+	var reporters []runReporter
+
+	if c.SlackWebhook != "" {
+		reporters = append(reporters, newSlackWebhook(c.SlackWebhook, c.eventFilter()))
+	}
+
+	if c.DiscordWebhook != "" {
+		reporters = append(reporters, newDiscordWebhook(c.DiscordWebhook, c.eventFilter()))
+	}
+
+	if c.SMTPHost != "" {
+		port := c.SMTPPort
+		if port == "" {
+			port = defaultSMTPPort
+		}
+
+		reporters = append(reporters, &emailNotifier{
+			host:     c.SMTPHost,
+			port:     port,
+			security: c.SMTPTLS,
+			username: c.SMTPUsername,
+			password: c.SMTPPassword,
+			from:     c.SMTPFrom,
+			to:       parseAddressList(c.SMTPTo),
+			filter:   c.eventFilter(),
+		})
+	}
+
+	if c.TelegramToken != "" {
+		reporters = append(reporters, newTelegram(c.TelegramToken, c.TelegramChatID, c.eventFilter()))
+	}
+
+	return reporters
+}
+
+// validateVault ensures that the vault credentials configuration is valid.
+func (c *Config) validateVault() error {
+	var errs error
+
+	if c.VaultSecretPath == "" {
+		errs = errors.Join(errs, fmt.Errorf("vault secret path required"))
+	}
+
+	switch c.VaultAuth {
+	case "", vaultAuthToken:
+		if c.VaultToken == "" {
+			errs = errors.Join(errs, fmt.Errorf("vault token required"))
+		}
+	case vaultAuthAppRole:
+		if c.VaultRoleID == "" || c.VaultSecretID == "" {
+			errs = errors.Join(errs, fmt.Errorf("vault approle role ID and secret ID required"))
+		}
+	default:
+		errs = errors.Join(errs, fmt.Errorf("unknown vault auth method %q", c.VaultAuth))
+	}
+
+	return errs
+}
+
+// credentials returns the S3 credentials for the configuration, sourced from vault
+// when a vault address is configured. Access keys not set on the command line are reloaded
+// whenever the .env file or secret files they were read from change. Requests are signed
+// with the configured signature version.
+func (c *Config) credentials(logger *zerolog.Logger) *credentials.Credentials {
+	v2 := c.Signature == signatureV2
+	if c.VaultAddr != "" {
+		if v2 {
+			return credentials.New(&signerProvider{Provider: newVaultProvider(c), signer: credentials.SignatureV2})
+		}
+		return credentials.New(newVaultProvider(c))
+	}
+
+	if c.staticCreds || flagPassed("accesskeyid") || flagPassed("secretaccesskey") {
+		if v2 {
+			return credentials.NewStaticV2(c.AccessKeyID, c.SecretAccessKey, "")
+		}
+		return credentials.NewStaticV4(c.AccessKeyID, c.SecretAccessKey, "")
+	}
+
+	if v2 {
+		return credentials.New(&signerProvider{Provider: newReloadingProvider(c.envPath, logger), signer: credentials.SignatureV2})
+	}
+	return credentials.New(newReloadingProvider(c.envPath, logger))
+}
+
+// s3Config returns the access configuration for the provided job's bucket.
+func (c *Config) s3Config(job jobConfig, creds *credentials.Credentials) *s3Config {
+	switch c.backend() {
+	case backendSFTP:
+		return &s3Config{
+			Bucket:      job.Bucket,
+			Prefix:      job.Prefix,
+			OpenStorage: c.sftp().open,
+			Circuit:     c.circuitPolicy(),
+			Parity:      job.Parity,
+			Middleware:  c.uploadMiddleware(),
+		}
+
+	case backendLocalDir:
+		return &s3Config{
+			Bucket:      job.Bucket,
+			Prefix:      job.Prefix,
+			OpenStorage: openLocalDir(c.LocalDir),
+			Circuit:     c.circuitPolicy(),
+			Parity:      job.Parity,
+			Middleware:  c.uploadMiddleware(),
+		}
+
+	case backendB2:
+		b2 := &b2Config{
+			KeyID:          c.B2KeyID,
+			ApplicationKey: c.B2AppKey,
+			BucketID:       c.B2BucketID,
+			Transport:      c.storageTransport(),
+		}
+		return &s3Config{
+			Bucket:      job.Bucket,
+			Prefix:      job.Prefix,
+			OpenStorage: b2.open,
+			Circuit:     c.circuitPolicy(),
+			Parity:      job.Parity,
+			Middleware:  c.uploadMiddleware(),
+		}
+
+	case backendExec:
+		return &s3Config{
+			Bucket:      job.Bucket,
+			Prefix:      job.Prefix,
+			OpenStorage: openExec(c.StorageCommand),
+			Circuit:     c.circuitPolicy(),
+			Parity:      job.Parity,
+			Middleware:  c.uploadMiddleware(),
+		}
+	}
+
+	endpoint, secure := endpointHost(c.Endpoint)
+	cfg := &s3Config{
+		Endpoint: endpoint,
+		Bucket:   job.Bucket,
+		Prefix:   job.Prefix,
+		Options: &minio.Options{
+			Creds:           creds,
+			Secure:          secure,
+			Transport:       c.storageTransport(),
+			Region:          c.Region,
+			BucketLookup:    c.bucketLookup(),
+			TrailingHeaders: uploadChecksum(c.Checksum).trailingHeaders(),
+		},
+		Copies:     c.copyDestinations(),
+		Fallback:   c.fallbackDestination(),
+		Retention:  job.objectRetention(),
+		Checksum:   uploadChecksum(c.Checksum),
+		Circuit:    c.circuitPolicy(),
+		Parity:     job.Parity,
+		Middleware: c.uploadMiddleware(),
+	}
+
+	if c.createBucket() {
+		cfg.Create = &minio.MakeBucketOptions{Region: c.Region, ObjectLocking: c.bucketLock()}
+	}
+
+	return cfg
+}
+
+// envFilePath returns the .env file path selected by the -env-file command line flag or the
+// ZDTS3_ENV_FILE environment variable. It is resolved ahead of parsing the command line since
+// the .env file provides the defaults of the other flags.
+func envFilePath(args []string) string {
+	for i, arg := range args {
+		if arg == "--" {
+			break
+		}
+
+		if !strings.HasPrefix(arg, "-") {
+			continue
+		}
+
+		name, value, hasValue := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+		if name != envFileFlag {
+			continue
+		}
+
+		if hasValue {
+			return value
+		}
+
+		if i+1 < len(args) {
+			return args[i+1]
+		}
+	}
+
+	return os.Getenv(envFileEnv)
+}
+
+// flagPassed returns whether the provided flag was set on the command line.
+func flagPassed(name string) bool {
+	passed := false
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			passed = true
+		}
+	})
+
+	return passed
+}
+
+// loadConfig loads the configuration from environment variables and command line flags.
+func loadConfig(cfg *Config, path string) error {
+	if !registeredFlags[envFileFlag] {
+		flag.String(envFileFlag, "", "Path of the .env file to load (default .env)")
+		registeredFlags[envFileFlag] = true
+	}
+
+	if !registeredFlags["version"] {
+		flag.BoolVar(&showVersion, "version", false, "Print the build information and exit")
+		registeredFlags["version"] = true
+	}
+
+	if !registeredFlags["stream"] {
+		flag.BoolVar(&streamStdin, "stream", false, "Compress and upload stdin as -object instead of running the scheduler")
+		flag.StringVar(&streamObject, "object", "", "Object name of the stdin upload, compressed with gzip for a .gz extension and zstd otherwise")
+		registeredFlags["stream"] = true
+	}
+
+	if path == "" {
+		// A .env file selected on the command line or environment must exist.
+		path = envFilePath(os.Args[1:])
+		if path != "" {
+			_, err := os.Stat(path)
+			if err != nil {
+				return fmt.Errorf("loading .env file: %w", err)
+			}
+		}
+	}
+
+	if path == "" {
+		path = ".env"
+	}
+
+	// Load the .env file if it exists.
+	values, err := readDotenv(path)
+	if err != nil {
+		return err
+	}
+	dotenvValues = values
+	cfg.envPath = path
+
+	// Register command line arguments using loaded environment variables as defaults.
+	var errs error
+	errs = errors.Join(errs, registerFlag("config", &cfg.ConfigPath, "Path to a YAML or TOML config file"))
+	errs = errors.Join(errs, registerFlag("endpoint", &cfg.Endpoint, "S3 or S3-compatible endpoint, a host with an optional port accessed over TLS, or an http or https URL"))
+	errs = errors.Join(errs, registerFlag("accesskeyid", &cfg.AccessKeyID, "S3 access key ID"))
+	errs = errors.Join(errs, registerFlag("secretaccesskey", &cfg.SecretAccessKey, "S3 secret access key"))
+	errs = errors.Join(errs, registerFlag("bucket", &cfg.Bucket, "S3 or S3-compatible bucket name"))
+	errs = errors.Join(errs, registerFlag("region", &cfg.Region, "Region of the bucket, looked up if unset"))
+	errs = errors.Join(errs, registerFlag("createbucket", &cfg.CreateBucket, "Create the bucket on startup when it does not exist (true, false)"))
+	errs = errors.Join(errs, registerFlag("bucketobjectlock", &cfg.BucketLock, "Enable object lock on buckets created on startup (true, false)"))
+	errs = errors.Join(errs, registerFlag("useragent", &cfg.UserAgent, "User-Agent of storage requests (default zdts3/<version> host=<hostname>)"))
+	errs = errors.Join(errs, registerFlag("checksum", &cfg.Checksum, "Checksum sent along uploads for the storage to verify them end to end (sha256, md5)"))
+	errs = errors.Join(errs, registerFlag("signature", &cfg.Signature, "Signature version of storage requests (v2, v4) (default v4)"))
+	errs = errors.Join(errs, registerFlag("bucketlookup", &cfg.BucketLookup, "How buckets are addressed in storage requests (path, dns, auto) (default auto)"))
+	errs = errors.Join(errs, registerFlag("circuitthreshold", &cfg.CircuitThreshold, "Consecutive failed uploads pausing uploads to the storage, archives stay staged (0 disables)"))
+	errs = errors.Join(errs, registerFlag("circuitprobe", &cfg.CircuitProbe, "Interval at which paused storage is probed before resuming uploads (default 5m)"))
+	errs = errors.Join(errs, registerFlag("uploadmiddleware", &cfg.UploadMiddleware, "Middlewares wrapping archive uploads, outermost first (timing, retry, comma separated)"))
+	errs = errors.Join(errs, registerFlag("backend", &cfg.Backend, "Storage backend archives are uploaded to (s3, sftp, localdir, b2, exec)"))
+	errs = errors.Join(errs, registerFlag("sftphost", &cfg.SFTPHost, "Host of the sftp backend's server, with an optional port (default 22)"))
+	errs = errors.Join(errs, registerFlag("sftpuser", &cfg.SFTPUser, "User of the sftp backend's server"))
+	errs = errors.Join(errs, registerFlag("sftpkey", &cfg.SFTPKey, "Path of the private key authenticating with the sftp backend's server"))
+	errs = errors.Join(errs, registerFlag("sftpknownhosts", &cfg.SFTPKnownHosts, "Path of the known hosts file verifying the sftp backend's server (default ~/.ssh/known_hosts)"))
+	errs = errors.Join(errs, registerFlag("sftppath", &cfg.SFTPPath, "Directory of the sftp backend's server archives are stored in"))
+	errs = errors.Join(errs, registerFlag("localdir", &cfg.LocalDir, "Directory the localdir backend copies archives into, e.g. a mounted NAS share"))
+	errs = errors.Join(errs, registerFlag("b2keyid", &cfg.B2KeyID, "Application key ID of the b2 backend"))
+	errs = errors.Join(errs, registerFlag("b2applicationkey", &cfg.B2AppKey, "Application key of the b2 backend"))
+	errs = errors.Join(errs, registerFlag("b2bucketid", &cfg.B2BucketID, "ID of the b2 backend's bucket"))
+	errs = errors.Join(errs, registerFlag("storagecommand", &cfg.StorageCommand, "Command line of the exec backend's storage plugin, run through the system shell"))
+	errs = errors.Join(errs, registerFlag("sourcedir", &cfg.SourceDir, "Source directory to archive"))
+	errs = errors.Join(errs, registerFlag("watchfiles", &cfg.WatchFiles, "Trigger a run once this many files were added to the source directory"))
+	errs = errors.Join(errs, registerFlag("watchquiet", &cfg.WatchQuiet, "Trigger a run once the source directory saw no changes for this long (e.g. 10m)"))
+	errs = errors.Join(errs, registerFlag("jitter", &cfg.Jitter, "Move scheduled run times by a random offset within this window either way (e.g. 15m)"))
+	errs = errors.Join(errs, registerFlag("instanceid", &cfg.InstanceID, "ID of this instance in archive names, metadata, metrics and notifications, the hostname if unset"))
+	errs = errors.Join(errs, registerFlag("environment", &cfg.Environment, "Environment label included in archive names after the hostname (e.g. prod)"))
+	errs = errors.Join(errs, registerFlag("catchup", &cfg.Catchup, "Run jobs which missed a scheduled run while the service was down on startup, requires statefile (true, false)"))
+	errs = errors.Join(errs, registerFlag("prerun", &cfg.PreRun, "Shell command run in the source directory before zipping, failing the run on a non-zero exit status"))
+	errs = errors.Join(errs, registerFlag("postrun", &cfg.PostRun, "Shell command run in the source directory after the archive was uploaded"))
+	errs = errors.Join(errs, registerFlag("dumpcommand", &cfg.DumpCommand, "Template of a database dump command (e.g. pg_dump) whose output is written to the source directory before zipping"))
+	errs = errors.Join(errs, registerFlag("incremental", &cfg.Incremental, "Only archive files modified since the last successful run of a job (true, false)"))
+	errs = errors.Join(errs, registerFlag("differential", &cfg.Differential, "Weekday of the full backup of jobs archiving the files modified since their last full backup on other days (e.g. sunday)"))
+	errs = errors.Join(errs, registerFlag("dedup", &cfg.Dedup, "Upload archives as content-defined chunks, skipping chunks already in the bucket (true, false)"))
+	errs = errors.Join(errs, registerFlag("delta", &cfg.Delta, "Upload binary deltas against the previous archive, with a full archive after this many deltas"))
+	errs = errors.Join(errs, registerFlag("symlinks", &cfg.Symlinks, "Symlink policy of archives (skip, follow, preserve-as-link)"))
+	errs = errors.Join(errs, registerFlag("emptydirs", &cfg.EmptyDirs, "Add directories to archives, so restores recreate empty directories (true, false)"))
+	errs = errors.Join(errs, registerFlag("requiremount", &cfg.RequireMount, "Fail runs whose source directory is not a mount point, e.g. when its network filesystem is down (true, false)"))
+	errs = errors.Join(errs, registerFlag("sentinel", &cfg.Sentinel, "File which must exist in the source directory for runs to proceed, relative to it"))
+	errs = errors.Join(errs, registerFlag("hardlinks", &cfg.HardLinks, "Archive the content of hard linked files once, restoring them as hard links (true, false)"))
+	errs = errors.Join(errs, registerFlag("xattrs", &cfg.Xattrs, "Archive the extended attributes of files, including POSIX ACLs and SELinux contexts, restoring them on extract (true, false)"))
+	errs = errors.Join(errs, registerFlag("sqlite", &cfg.SQLite, "Archive SQLite databases from a consistent copy made with the SQLite backup API (true, false)"))
+	errs = errors.Join(errs, registerFlag("snapshot", &cfg.Snapshot, "Capture the files to archive in a snapshot zipped instead of the source directory (link, copy) (default none)"))
+	errs = errors.Join(errs, registerFlag("snapshotdir", &cfg.SnapshotDir, "Directory snapshots are kept in while they are zipped (default the system temporary directory)"))
+	errs = errors.Join(errs, registerFlag("fssnapshot", &cfg.FSSnapshot, "Filesystem snapshot provider archives are zipped from (btrfs, zfs, lvm) (default none)"))
+	errs = errors.Join(errs, registerFlag("filechecksums", &cfg.FileChecksums, "Embed a MANIFEST.sha256 entry listing the SHA-256 checksum of every archived file (true, false)"))
+	errs = errors.Join(errs, registerFlag("copybuffer", &cfg.CopyBuffer, "Size of the buffers files are copied through when zipping, restoring and uploading, e.g. 256KiB (default 32KiB)"))
+	errs = errors.Join(errs, registerFlag("diskratio", &cfg.DiskRatio, "Expected ratio of archive size to file size when checking free disk space before zipping (default 1)"))
+	errs = errors.Join(errs, registerFlag("diskmargin", &cfg.DiskMargin, "Disk space left free when checking free disk space before zipping, e.g. 1GiB (default 64MiB)"))
+	errs = errors.Join(errs, registerFlag("maxstagingsize", &cfg.MaxStagingSize, "Maximum total size of the archives left staged by failed uploads, e.g. 10GiB, the oldest are removed first (default unlimited)"))
+	errs = errors.Join(errs, registerFlag("minfiles", &cfg.MinFiles, "Minimum number of files a run must archive, failing the run otherwise (default no minimum)"))
+	errs = errors.Join(errs, registerFlag("minbytes", &cfg.MinBytes, "Minimum total size of the files a run must archive, e.g. 100MiB, failing the run otherwise (default no minimum)"))
+	errs = errors.Join(errs, registerFlag("verifysample", &cfg.VerifySample, "Number of archived files spot-checked against their source files before every upload (default none)"))
+	errs = errors.Join(errs, registerFlag("maxfilesize", &cfg.MaxFileSize, "Size of the largest files archived, e.g. 50GiB, larger files are skipped with a warning (default unlimited)"))
+	errs = errors.Join(errs, registerFlag("maxbucketusage", &cfg.MaxBucketUsage, "Maximum total size of the archives under the prefix of a job, e.g. 500GiB, checked before every upload (default unlimited)"))
+	errs = errors.Join(errs, registerFlag("quotapolicy", &cfg.QuotaPolicy, "Policy of uploads exceeding maxbucketusage (fail, prune)"))
+	errs = errors.Join(errs, registerFlag("stalearchives", &cfg.StaleArchives, "Policy of archives left staged by crashed or failed runs (keep, upload, delete)"))
+	errs = errors.Join(errs, registerFlag("objectlockmode", &cfg.ObjectLockMode, "Object lock retention mode of uploaded archives (governance, compliance)"))
+	errs = errors.Join(errs, registerFlag("objectlockperiod", &cfg.ObjectLockPeriod, "Object lock retention period of uploaded archives, e.g. 30d"))
+	errs = errors.Join(errs, registerFlag("subdirs", &cfg.Subdirs, "Upload a separate archive of every immediate subdirectory of the source directory (true, false)"))
+	errs = errors.Join(errs, registerFlag("workers", &cfg.Workers, "Number of subdirectories archived at a time with subdirs enabled (default 1)"))
+	errs = errors.Join(errs, registerFlag("parity", &cfg.Parity, "Size of the parity data uploaded alongside archives to repair them, in percent of their size (0 disables)"))
+	errs = errors.Join(errs, registerFlag("maxjobs", &cfg.MaxJobs, "Number of jobs running at a time, waiting runs start by job priority (0 for no limit)"))
+	errs = errors.Join(errs, registerFlag("skipunchanged", &cfg.SkipUnchanged, "Skip uploading archives identical to the previous archive of their job (true, false)"))
+	errs = errors.Join(errs, registerFlag("skipempty", &cfg.SkipEmpty, "Skip the upload of runs without files to archive instead of uploading an empty archive (true, false)"))
+	errs = errors.Join(errs, registerFlag("dumpfile", &cfg.DumpFile, "Template of the database dump's file name (default {{.Job}}-{{.Timestamp}}.sql)"))
+	errs = errors.Join(errs, registerFlag("loglevel", &cfg.LogLevel, "Log level (debug, info, warn, error, fatal)"))
+	errs = errors.Join(errs, registerFlag("logformat", &cfg.LogFormat, "Format of the log written to stderr (json, console)"))
+	errs = errors.Join(errs, registerFlag("logfile", &cfg.LogFile, "Path of a file the log is written to in addition to stderr, rotated by size"))
+	errs = errors.Join(errs, registerFlag("logmaxsize", &cfg.LogMaxSize, "Size of the log file at which it is rotated, e.g. 10MiB (default 100MiB)"))
+	errs = errors.Join(errs, registerFlag("logmaxbackups", &cfg.LogMaxBackups, "Number of rotated log files kept (default 5)"))
+	errs = errors.Join(errs, registerFlag("syslog", &cfg.Syslog, "Syslog server the log is sent to in addition to stderr, local or a udp:// or tcp:// URL"))
+	errs = errors.Join(errs, registerFlag("timezone", &cfg.Timezone, "IANA timezone of schedules and purge windows, e.g. Europe/Berlin (default host timezone)"))
+	errs = errors.Join(errs, registerFlag("pidfile", &cfg.PIDFile, "Path of the pid file locked to prevent concurrent instances"))
+	errs = errors.Join(errs, registerFlag("historydb", &cfg.HistoryDB, "Path of the SQLite database recording the run history and catalog"))
+	errs = errors.Join(errs, registerFlag("statefile", &cfg.StateFile, "Path of the file recording the last run, success, uploaded object and content hash of every job"))
+	errs = errors.Join(errs, registerFlag("catalog", &cfg.Catalog, "Maintain a catalog index object of the archived files of every job in its bucket (true, false)"))
+	errs = errors.Join(errs, registerFlag("runreports", &cfg.RunReports, "Upload a JSON report of every run to the bucket of its job (true, false)"))
+	errs = errors.Join(errs, registerFlag("distributedlock", &cfg.DistributedLock, "Coordinate job runs with other instances through S3 lock objects (true, false)"))
+	errs = errors.Join(errs, registerFlag("leaderelection", &cfg.LeaderElection, "Only run jobs while elected leader among instances sharing the lock bucket (true, false)"))
+	errs = errors.Join(errs, registerFlag("lockbucket", &cfg.LockBucket, "Bucket to store lock objects in (defaults to the bucket)"))
+	errs = errors.Join(errs, registerFlag("lockttl", &cfg.LockTTL, "Duration a lock is held without being refreshed before it can be taken over (default 5m)"))
+	errs = errors.Join(errs, registerFlag("dashboard", &cfg.Dashboard, "Serve the web dashboard under /dashboard on the health listener (true, false)"))
+	errs = errors.Join(errs, registerFlag("dashboarduser", &cfg.DashboardUser, "Username of the dashboard's HTTP basic authentication"))
+	errs = errors.Join(errs, registerFlag("dashboardpassword", &cfg.DashboardPass, "Password of the dashboard's HTTP basic authentication"))
+	errs = errors.Join(errs, registerFlag("apitoken", &cfg.APIToken, "Bearer token enabling the API triggering archive runs on the health listener"))
+	errs = errors.Join(errs, registerFlag("grpcaddr", &cfg.GRPCAddr, "Listen address of the gRPC control service (e.g. :9090), requires apitoken"))
+	errs = errors.Join(errs, registerFlag("grpccert", &cfg.GRPCCert, "Path of the TLS certificate of the gRPC control service"))
+	errs = errors.Join(errs, registerFlag("grpckey", &cfg.GRPCKey, "Path of the TLS key of the gRPC control service"))
+	errs = errors.Join(errs, registerFlag("grpcrestoreroot", &cfg.GRPCRestoreRoot, "Directory restores of the gRPC control service may target besides the source directories of jobs"))
+	errs = errors.Join(errs, registerFlag("pprof", &cfg.Pprof, "Serve pprof profiling endpoints under /debug/pprof/ on the health listener (true, false)"))
+	errs = errors.Join(errs, registerFlag("healthaddr", &cfg.HealthAddr, "Listen address of the health and status endpoints (e.g. :8080)"))
+	errs = errors.Join(errs, registerFlag("pingurl", &cfg.PingURL, "Dead man's switch URL pinged when runs start, succeed and fail (healthchecks.io compatible)"))
+	errs = errors.Join(errs, registerFlag("maxbackupage", &cfg.MaxBackupAge, "Alert and report unhealthy when a job has no successful archive for this long (e.g. 26h)"))
+	errs = errors.Join(errs, registerFlag("usageinterval", &cfg.UsageInterval, "Report the storage usage of the archives this often (e.g. 24h)"))
+	errs = errors.Join(errs, registerFlag("storagecost", &cfg.StorageCost, "Price of storing a GB for a month, e.g. 0.023, to estimate storage costs with"))
+	errs = errors.Join(errs, registerFlag("scrubinterval", &cfg.ScrubInterval, "Verify the stored archives against their manifests this often (e.g. 168h)"))
+	errs = errors.Join(errs, registerFlag("drillinterval", &cfg.DrillInterval, "Restore and verify the newest archive of every job this often (e.g. 168h)"))
+	errs = errors.Join(errs, registerFlag("notifyon", &cfg.NotifyOn, "Runs to send notifications about (always, on-failure, on-recovery, comma separated)"))
+	errs = errors.Join(errs, registerFlag("slackwebhook", &cfg.SlackWebhook, "Slack incoming webhook URL to send run notifications to"))
+	errs = errors.Join(errs, registerFlag("discordwebhook", &cfg.DiscordWebhook, "Discord webhook URL to send run notifications to"))
+	errs = errors.Join(errs, registerFlag("smtphost", &cfg.SMTPHost, "SMTP server host to send run reports by email through"))
+	errs = errors.Join(errs, registerFlag("smtpport", &cfg.SMTPPort, "SMTP server port (default 587)"))
+	errs = errors.Join(errs, registerFlag("smtptls", &cfg.SMTPTLS, "SMTP connection security (starttls, tls, none)"))
+	errs = errors.Join(errs, registerFlag("smtpusername", &cfg.SMTPUsername, "SMTP username"))
+	errs = errors.Join(errs, registerFlag("smtppassword", &cfg.SMTPPassword, "SMTP password"))
+	errs = errors.Join(errs, registerFlag("smtpfrom", &cfg.SMTPFrom, "Sender address of run report emails"))
+	errs = errors.Join(errs, registerFlag("smtpto", &cfg.SMTPTo, "Comma separated recipient addresses of run report emails"))
+	errs = errors.Join(errs, registerFlag("telegramtoken", &cfg.TelegramToken, "Telegram bot token to send run notifications with"))
+	errs = errors.Join(errs, registerFlag("telegramchatid", &cfg.TelegramChatID, "Telegram chat ID to send run notifications to"))
+	errs = errors.Join(errs, registerFlag("webhookurl", &cfg.WebhookURL, "URL to post signed JSON run events to"))
+	errs = errors.Join(errs, registerFlag("webhooksecret", &cfg.WebhookSecret, "Shared secret signing webhook events with HMAC-SHA256"))
+	errs = errors.Join(errs, registerFlag("eventsurl", &cfg.EventsURL, "NATS (nats://, tls://) or MQTT (mqtt://, mqtts://) URL to publish run events to"))
+	errs = errors.Join(errs, registerFlag("eventsprefix", &cfg.EventsPrefix, "Subject or topic prefix of published run events (default zdts3)"))
+	errs = errors.Join(errs, registerFlag("pushgateway", &cfg.Pushgateway, "Prometheus Pushgateway URL to push run metrics to"))
+	errs = errors.Join(errs, registerFlag("statsd", &cfg.Statsd, "StatsD or DogStatsD agent address (host:port) to send run metrics to"))
+	errs = errors.Join(errs, registerFlag("statsdprefix", &cfg.StatsdPrefix, "Name prefix of StatsD metrics (default zdts3.)"))
+	errs = errors.Join(errs, registerFlag("statsdtags", &cfg.StatsdTags, "Comma separated tags added to StatsD metrics (e.g. env:prod,team:ops)"))
+	errs = errors.Join(errs, registerFlag("vaultaddr", &cfg.VaultAddr, "Vault address to fetch S3 credentials from"))
+	errs = errors.Join(errs, registerFlag("vaultauth", &cfg.VaultAuth, "Vault auth method (token, approle)"))
+	errs = errors.Join(errs, registerFlag("vaulttoken", &cfg.VaultToken, "Vault token for the token auth method"))
+	errs = errors.Join(errs, registerFlag("vaultroleid", &cfg.VaultRoleID, "Vault approle role ID"))
+	errs = errors.Join(errs, registerFlag("vaultsecretid", &cfg.VaultSecretID, "Vault approle secret ID"))
+	errs = errors.Join(errs, registerFlag("vaultsecretpath", &cfg.VaultSecretPath, "Vault path of the S3 credentials secret"))
+	if errs != nil {
+		return errs
+	}
+
+	// Parse command-line flags.
+	flag.Parse()
+
+	// Fill in settings not provided by the environment or flags from the config file.
+	if cfg.ConfigPath != "" {
+		fileCfg, err := readConfigFile(cfg.ConfigPath)
+		if err != nil {
+			return err
+		}
+
+		fileCfg.apply(cfg)
+	}
+
+	return cfg.validate()
+}
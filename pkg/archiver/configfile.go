@@ -0,0 +1,936 @@
+package archiver
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// formatYAML is the YAML config file format.
+	formatYAML = "yaml"
+	// formatTOML is the TOML config file format.
+	formatTOML = "toml"
+)
+
+// vaultFileConfig is the vault credentials section of the structured configuration file.
+type vaultFileConfig struct {
+	Address    string `yaml:"address" toml:"address"`
+	Auth       string `yaml:"auth,omitempty" toml:"auth,omitempty"`
+	Token      string `yaml:"token,omitempty" toml:"token,omitempty"`
+	RoleID     string `yaml:"roleid,omitempty" toml:"roleid,omitempty"`
+	SecretID   string `yaml:"secretid,omitempty" toml:"secretid,omitempty"`
+	SecretPath string `yaml:"secretpath" toml:"secretpath"`
+}
+
+// lockFileConfig is the distributed lock section of the structured configuration file.
+type lockFileConfig struct {
+	Enabled bool   `yaml:"enabled" toml:"enabled"`
+	Leader  bool   `yaml:"leader,omitempty" toml:"leader,omitempty"`
+	Bucket  string `yaml:"bucket,omitempty" toml:"bucket,omitempty"`
+	TTL     string `yaml:"ttl,omitempty" toml:"ttl,omitempty"`
+}
+
+// statsdFileConfig is the StatsD section of the structured configuration file.
+type statsdFileConfig struct {
+	Address string   `yaml:"address" toml:"address"`
+	Prefix  string   `yaml:"prefix,omitempty" toml:"prefix,omitempty"`
+	Tags    []string `yaml:"tags,omitempty" toml:"tags,omitempty"`
+}
+
+// metricsFileConfig is the metrics section of the structured configuration file.
+type metricsFileConfig struct {
+	Pushgateway string            `yaml:"pushgateway,omitempty" toml:"pushgateway,omitempty"`
+	Statsd      *statsdFileConfig `yaml:"statsd,omitempty" toml:"statsd,omitempty"`
+}
+
+// webhookFileConfig is a chat webhook of the notifications section of the structured
+// configuration file.
+type webhookFileConfig struct {
+	Webhook string `yaml:"webhook" toml:"webhook"`
+}
+
+// emailFileConfig is the email section of the notifications section of the structured
+// configuration file.
+type emailFileConfig struct {
+	Host     string   `yaml:"host" toml:"host"`
+	Port     string   `yaml:"port,omitempty" toml:"port,omitempty"`
+	TLS      string   `yaml:"tls,omitempty" toml:"tls,omitempty"`
+	Username string   `yaml:"username,omitempty" toml:"username,omitempty"`
+	Password string   `yaml:"password,omitempty" toml:"password,omitempty"`
+	From     string   `yaml:"from" toml:"from"`
+	To       []string `yaml:"to" toml:"to"`
+}
+
+// telegramFileConfig is the Telegram section of the notifications section of the structured
+// configuration file.
+type telegramFileConfig struct {
+	Token  string `yaml:"token" toml:"token"`
+	ChatID string `yaml:"chatid" toml:"chatid"`
+}
+
+// eventWebhookFileConfig is the signed event webhook of the notifications section of the
+// structured configuration file.
+type eventWebhookFileConfig struct {
+	URL    string `yaml:"url" toml:"url"`
+	Secret string `yaml:"secret,omitempty" toml:"secret,omitempty"`
+}
+
+// eventsFileConfig is the event bus section of the notifications section of the structured
+// configuration file.
+type eventsFileConfig struct {
+	URL    string `yaml:"url" toml:"url"`
+	Prefix string `yaml:"prefix,omitempty" toml:"prefix,omitempty"`
+}
+
+// notificationsFileConfig is the notifications section of the structured configuration file.
+type notificationsFileConfig struct {
+	On       string                  `yaml:"on,omitempty" toml:"on,omitempty"`
+	Slack    *webhookFileConfig      `yaml:"slack,omitempty" toml:"slack,omitempty"`
+	Discord  *webhookFileConfig      `yaml:"discord,omitempty" toml:"discord,omitempty"`
+	Email    *emailFileConfig        `yaml:"email,omitempty" toml:"email,omitempty"`
+	Telegram *telegramFileConfig     `yaml:"telegram,omitempty" toml:"telegram,omitempty"`
+	Webhook  *eventWebhookFileConfig `yaml:"webhook,omitempty" toml:"webhook,omitempty"`
+	Events   *eventsFileConfig       `yaml:"events,omitempty" toml:"events,omitempty"`
+}
+
+// sftpFileConfig is the SFTP section of the storage section of the structured configuration
+// file.
+type sftpFileConfig struct {
+	Host       string `yaml:"host" toml:"host"`
+	User       string `yaml:"user" toml:"user"`
+	Key        string `yaml:"key" toml:"key"`
+	KnownHosts string `yaml:"knownhosts,omitempty" toml:"knownhosts,omitempty"`
+	Path       string `yaml:"path" toml:"path"`
+}
+
+// circuitFileConfig is the circuit breaker section of the storage section of the structured
+// configuration file.
+type circuitFileConfig struct {
+	Threshold int    `yaml:"threshold" toml:"threshold"`
+	Probe     string `yaml:"probe,omitempty" toml:"probe,omitempty"`
+}
+
+// b2FileConfig is the B2 section of the storage section of the structured configuration file.
+type b2FileConfig struct {
+	KeyID          string `yaml:"keyid" toml:"keyid"`
+	ApplicationKey string `yaml:"applicationkey" toml:"applicationkey"`
+	BucketID       string `yaml:"bucketid" toml:"bucketid"`
+}
+
+// storageFileConfig is the storage section of the structured configuration file.
+type storageFileConfig struct {
+	Backend         string              `yaml:"backend,omitempty" toml:"backend,omitempty"`
+	Endpoint        string              `yaml:"endpoint" toml:"endpoint"`
+	AccessKeyID     string              `yaml:"accesskeyid" toml:"accesskeyid"`
+	SecretAccessKey string              `yaml:"secretaccesskey" toml:"secretaccesskey"`
+	Bucket          string              `yaml:"bucket" toml:"bucket"`
+	Region          string              `yaml:"region,omitempty" toml:"region,omitempty"`
+	CreateBucket    bool                `yaml:"createbucket,omitempty" toml:"createbucket,omitempty"`
+	ObjectLock      bool                `yaml:"objectlock,omitempty" toml:"objectlock,omitempty"`
+	Checksum        string              `yaml:"checksum,omitempty" toml:"checksum,omitempty"`
+	Signature       string              `yaml:"signature,omitempty" toml:"signature,omitempty"`
+	BucketLookup    string              `yaml:"bucketlookup,omitempty" toml:"bucketlookup,omitempty"`
+	UserAgent       string              `yaml:"useragent,omitempty" toml:"useragent,omitempty"`
+	CircuitBreaker  *circuitFileConfig  `yaml:"circuitbreaker,omitempty" toml:"circuitbreaker,omitempty"`
+	Middleware      string              `yaml:"middleware,omitempty" toml:"middleware,omitempty"`
+	Vault           *vaultFileConfig    `yaml:"vault,omitempty" toml:"vault,omitempty"`
+	Destinations    []destinationConfig `yaml:"destinations,omitempty" toml:"destinations,omitempty"`
+	Fallback        *destinationConfig  `yaml:"fallback,omitempty" toml:"fallback,omitempty"`
+	Lifecycle       []lifecycleRule     `yaml:"lifecycle,omitempty" toml:"lifecycle,omitempty"`
+	SFTP            *sftpFileConfig     `yaml:"sftp,omitempty" toml:"sftp,omitempty"`
+	LocalDir        string              `yaml:"localdir,omitempty" toml:"localdir,omitempty"`
+	B2              *b2FileConfig       `yaml:"b2,omitempty" toml:"b2,omitempty"`
+	Command         string              `yaml:"command,omitempty" toml:"command,omitempty"`
+}
+
+// usageFileConfig is the storage usage report section of the structured configuration file.
+type usageFileConfig struct {
+	Interval  string  `yaml:"interval,omitempty" toml:"interval,omitempty"`
+	CostPerGB float64 `yaml:"costpergb,omitempty" toml:"costpergb,omitempty"`
+}
+
+// objectLockFileConfig is the object lock section of the structured configuration file.
+type objectLockFileConfig struct {
+	Mode   string `yaml:"mode" toml:"mode"`
+	Period string `yaml:"period" toml:"period"`
+}
+
+// dashboardFileConfig is the dashboard section of the structured configuration file.
+type dashboardFileConfig struct {
+	Enabled  bool   `yaml:"enabled" toml:"enabled"`
+	Username string `yaml:"username,omitempty" toml:"username,omitempty"`
+	Password string `yaml:"password,omitempty" toml:"password,omitempty"`
+}
+
+// grpcFileConfig is the gRPC control service section of the structured configuration file.
+type grpcFileConfig struct {
+	Address     string `yaml:"address" toml:"address"`
+	Cert        string `yaml:"cert,omitempty" toml:"cert,omitempty"`
+	Key         string `yaml:"key,omitempty" toml:"key,omitempty"`
+	RestoreRoot string `yaml:"restoreroot,omitempty" toml:"restoreroot,omitempty"`
+}
+
+// fileConfig is the structured configuration file format.
+type fileConfig struct {
+	LogLevel       string                   `yaml:"loglevel" toml:"loglevel"`
+	LogFormat      string                   `yaml:"logformat,omitempty" toml:"logformat,omitempty"`
+	LogFile        string                   `yaml:"logfile,omitempty" toml:"logfile,omitempty"`
+	LogMaxSize     string                   `yaml:"logmaxsize,omitempty" toml:"logmaxsize,omitempty"`
+	LogMaxBackups  int                      `yaml:"logmaxbackups,omitempty" toml:"logmaxbackups,omitempty"`
+	Syslog         string                   `yaml:"syslog,omitempty" toml:"syslog,omitempty"`
+	Timezone       string                   `yaml:"timezone,omitempty" toml:"timezone,omitempty"`
+	PIDFile        string                   `yaml:"pidfile,omitempty" toml:"pidfile,omitempty"`
+	HistoryDB      string                   `yaml:"historydb,omitempty" toml:"historydb,omitempty"`
+	StateFile      string                   `yaml:"statefile,omitempty" toml:"statefile,omitempty"`
+	Catalog        bool                     `yaml:"catalog,omitempty" toml:"catalog,omitempty"`
+	RunReports     bool                     `yaml:"runreports,omitempty" toml:"runreports,omitempty"`
+	Incremental    bool                     `yaml:"incremental,omitempty" toml:"incremental,omitempty"`
+	Differential   string                   `yaml:"differential,omitempty" toml:"differential,omitempty"`
+	Dedup          bool                     `yaml:"dedup,omitempty" toml:"dedup,omitempty"`
+	SkipUnchanged  bool                     `yaml:"skipunchanged,omitempty" toml:"skipunchanged,omitempty"`
+	SkipEmpty      bool                     `yaml:"skipempty,omitempty" toml:"skipempty,omitempty"`
+	Delta          int                      `yaml:"delta,omitempty" toml:"delta,omitempty"`
+	Symlinks       string                   `yaml:"symlinks,omitempty" toml:"symlinks,omitempty"`
+	EmptyDirs      bool                     `yaml:"emptydirs,omitempty" toml:"emptydirs,omitempty"`
+	HardLinks      bool                     `yaml:"hardlinks,omitempty" toml:"hardlinks,omitempty"`
+	Xattrs         bool                     `yaml:"xattrs,omitempty" toml:"xattrs,omitempty"`
+	SQLite         bool                     `yaml:"sqlite,omitempty" toml:"sqlite,omitempty"`
+	Snapshot       string                   `yaml:"snapshot,omitempty" toml:"snapshot,omitempty"`
+	SnapshotDir    string                   `yaml:"snapshotdir,omitempty" toml:"snapshotdir,omitempty"`
+	FSSnapshot     string                   `yaml:"fssnapshot,omitempty" toml:"fssnapshot,omitempty"`
+	RequireMount   bool                     `yaml:"requiremount,omitempty" toml:"requiremount,omitempty"`
+	Sentinel       string                   `yaml:"sentinel,omitempty" toml:"sentinel,omitempty"`
+	FileChecksums  bool                     `yaml:"filechecksums,omitempty" toml:"filechecksums,omitempty"`
+	Subdirs        bool                     `yaml:"subdirs,omitempty" toml:"subdirs,omitempty"`
+	CopyBuffer     string                   `yaml:"copybuffer,omitempty" toml:"copybuffer,omitempty"`
+	DiskRatio      float64                  `yaml:"diskratio,omitempty" toml:"diskratio,omitempty"`
+	DiskMargin     string                   `yaml:"diskmargin,omitempty" toml:"diskmargin,omitempty"`
+	MaxStagingSize string                   `yaml:"maxstagingsize,omitempty" toml:"maxstagingsize,omitempty"`
+	MinFiles       int                      `yaml:"minfiles,omitempty" toml:"minfiles,omitempty"`
+	MinBytes       string                   `yaml:"minbytes,omitempty" toml:"minbytes,omitempty"`
+	VerifySample   int                      `yaml:"verifysample,omitempty" toml:"verifysample,omitempty"`
+	MaxFileSize    string                   `yaml:"maxfilesize,omitempty" toml:"maxfilesize,omitempty"`
+	MaxBucketUsage string                   `yaml:"maxbucketusage,omitempty" toml:"maxbucketusage,omitempty"`
+	QuotaPolicy    string                   `yaml:"quotapolicy,omitempty" toml:"quotapolicy,omitempty"`
+	StaleArchives  string                   `yaml:"stalearchives,omitempty" toml:"stalearchives,omitempty"`
+	ObjectLock     *objectLockFileConfig    `yaml:"objectlock,omitempty" toml:"objectlock,omitempty"`
+	HealthAddr     string                   `yaml:"healthaddr,omitempty" toml:"healthaddr,omitempty"`
+	Pprof          bool                     `yaml:"pprof,omitempty" toml:"pprof,omitempty"`
+	APIToken       string                   `yaml:"apitoken,omitempty" toml:"apitoken,omitempty"`
+	GRPC           *grpcFileConfig          `yaml:"grpc,omitempty" toml:"grpc,omitempty"`
+	Dashboard      *dashboardFileConfig     `yaml:"dashboard,omitempty" toml:"dashboard,omitempty"`
+	PingURL        string                   `yaml:"pingurl,omitempty" toml:"pingurl,omitempty"`
+	MaxBackupAge   string                   `yaml:"maxbackupage,omitempty" toml:"maxbackupage,omitempty"`
+	ScrubInterval  string                   `yaml:"scrubinterval,omitempty" toml:"scrubinterval,omitempty"`
+	DrillInterval  string                   `yaml:"drillinterval,omitempty" toml:"drillinterval,omitempty"`
+	Usage          *usageFileConfig         `yaml:"usage,omitempty" toml:"usage,omitempty"`
+	SourceDir      string                   `yaml:"sourcedir,omitempty" toml:"sourcedir,omitempty"`
+	WatchFiles     int                      `yaml:"watchfiles,omitempty" toml:"watchfiles,omitempty"`
+	Workers        int                      `yaml:"workers,omitempty" toml:"workers,omitempty"`
+	Parity         int                      `yaml:"parity,omitempty" toml:"parity,omitempty"`
+	Compression    []compressionRule        `yaml:"compression,omitempty" toml:"compression,omitempty"`
+	MaxJobs        int                      `yaml:"maxjobs,omitempty" toml:"maxjobs,omitempty"`
+	WatchQuiet     string                   `yaml:"watchquiet,omitempty" toml:"watchquiet,omitempty"`
+	Jitter         string                   `yaml:"jitter,omitempty" toml:"jitter,omitempty"`
+	Environment    string                   `yaml:"environment,omitempty" toml:"environment,omitempty"`
+	InstanceID     string                   `yaml:"instanceid,omitempty" toml:"instanceid,omitempty"`
+	Catchup        bool                     `yaml:"catchup,omitempty" toml:"catchup,omitempty"`
+	PreRun         string                   `yaml:"prerun,omitempty" toml:"prerun,omitempty"`
+	PostRun        string                   `yaml:"postrun,omitempty" toml:"postrun,omitempty"`
+	Dump           *dumpConfig              `yaml:"dump,omitempty" toml:"dump,omitempty"`
+	Storage        storageFileConfig        `yaml:"storage" toml:"storage"`
+	Lock           *lockFileConfig          `yaml:"lock,omitempty" toml:"lock,omitempty"`
+	Metrics        *metricsFileConfig       `yaml:"metrics,omitempty" toml:"metrics,omitempty"`
+	Notifications  *notificationsFileConfig `yaml:"notifications,omitempty" toml:"notifications,omitempty"`
+	Jobs           []jobConfig              `yaml:"jobs,omitempty" toml:"jobs,omitempty"`
+}
+
+// newFileConfig creates a structured file configuration from the provided configuration.
+// The flat source directory setting is expressed as a single job.
+func newFileConfig(cfg *Config) *fileConfig {
+	watchFiles, _ := strconv.Atoi(cfg.WatchFiles)
+	workers, _ := strconv.Atoi(cfg.Workers)
+	minFiles, _ := strconv.Atoi(cfg.MinFiles)
+	verifySample, _ := strconv.Atoi(cfg.VerifySample)
+	parity, _ := strconv.Atoi(cfg.Parity)
+	deltas, _ := strconv.Atoi(cfg.Delta)
+	diskRatio, _ := strconv.ParseFloat(cfg.DiskRatio, 64)
+	logMaxBackups, _ := strconv.Atoi(cfg.LogMaxBackups)
+	jobs := cfg.jobs()
+	for i := range jobs {
+		if jobs[i].Bucket == cfg.Bucket {
+			jobs[i].Bucket = ""
+		}
+		if jobs[i].PingURL == cfg.PingURL {
+			jobs[i].PingURL = ""
+		}
+		// Watched jobs without a schedule only run when triggered.
+		if jobs[i].Schedule == "" && !jobs[i].watching() {
+			jobs[i].Schedule = defaultSchedule
+		}
+		if jobs[i].WatchFiles == watchFiles {
+			jobs[i].WatchFiles = 0
+		}
+		if jobs[i].Workers == workers {
+			jobs[i].Workers = 0
+		}
+		if jobs[i].Parity == parity {
+			jobs[i].Parity = 0
+		}
+		if slices.Equal(jobs[i].Compression, cfg.Compression) {
+			jobs[i].Compression = nil
+		}
+		if jobs[i].WatchQuiet == cfg.WatchQuiet {
+			jobs[i].WatchQuiet = ""
+		}
+		if jobs[i].Jitter == cfg.Jitter {
+			jobs[i].Jitter = ""
+		}
+		if jobs[i].Environment == cfg.Environment {
+			jobs[i].Environment = ""
+		}
+		if cfg.catchup() {
+			jobs[i].Catchup = false
+		}
+		if jobs[i].PreRun == cfg.PreRun {
+			jobs[i].PreRun = ""
+		}
+		if jobs[i].PostRun == cfg.PostRun {
+			jobs[i].PostRun = ""
+		}
+		if cfg.incremental() {
+			jobs[i].Incremental = false
+		}
+		if jobs[i].Differential == cfg.Differential {
+			jobs[i].Differential = ""
+		}
+		if cfg.dedup() {
+			jobs[i].Dedup = false
+		}
+		if cfg.skipUnchanged() {
+			jobs[i].SkipUnchanged = false
+		}
+		if cfg.skipEmpty() {
+			jobs[i].SkipEmpty = false
+		}
+		if jobs[i].Delta == deltas {
+			jobs[i].Delta = 0
+		}
+		if jobs[i].Symlinks == cfg.Symlinks {
+			jobs[i].Symlinks = ""
+		}
+		if cfg.emptyDirs() {
+			jobs[i].EmptyDirs = false
+		}
+		if cfg.hardLinks() {
+			jobs[i].HardLinks = false
+		}
+		if cfg.xattrs() {
+			jobs[i].Xattrs = false
+		}
+		if cfg.sqlite() {
+			jobs[i].SQLite = false
+		}
+		if jobs[i].Snapshot == cfg.Snapshot {
+			jobs[i].Snapshot = ""
+		}
+		if jobs[i].SnapshotDir == cfg.SnapshotDir {
+			jobs[i].SnapshotDir = ""
+		}
+		if jobs[i].FSSnapshot == cfg.FSSnapshot {
+			jobs[i].FSSnapshot = ""
+		}
+		if cfg.requireMount() {
+			jobs[i].RequireMount = false
+		}
+		if jobs[i].Sentinel == cfg.Sentinel {
+			jobs[i].Sentinel = ""
+		}
+		if cfg.fileChecksums() {
+			jobs[i].FileChecksums = false
+		}
+		if jobs[i].DiskRatio == diskRatio {
+			jobs[i].DiskRatio = 0
+		}
+		if jobs[i].DiskMargin == cfg.DiskMargin {
+			jobs[i].DiskMargin = ""
+		}
+		if jobs[i].MaxStagingSize == cfg.MaxStagingSize {
+			jobs[i].MaxStagingSize = ""
+		}
+		if jobs[i].MinFiles == minFiles {
+			jobs[i].MinFiles = 0
+		}
+		if jobs[i].MinBytes == cfg.MinBytes {
+			jobs[i].MinBytes = ""
+		}
+		if jobs[i].VerifySample == verifySample {
+			jobs[i].VerifySample = 0
+		}
+		if jobs[i].MaxFileSize == cfg.MaxFileSize {
+			jobs[i].MaxFileSize = ""
+		}
+		if jobs[i].MaxBucketUsage == cfg.MaxBucketUsage {
+			jobs[i].MaxBucketUsage = ""
+		}
+		if jobs[i].QuotaPolicy == cfg.QuotaPolicy {
+			jobs[i].QuotaPolicy = ""
+		}
+		if jobs[i].StaleArchives == cfg.StaleArchives {
+			jobs[i].StaleArchives = ""
+		}
+		if jobs[i].ObjectLockMode == cfg.ObjectLockMode && jobs[i].ObjectLockPeriod == cfg.ObjectLockPeriod {
+			jobs[i].ObjectLockMode, jobs[i].ObjectLockPeriod = "", ""
+		}
+		if cfg.subdirs() {
+			jobs[i].Subdirs = false
+		}
+	}
+
+	fileCfg := &fileConfig{
+		LogLevel:       cfg.LogLevel,
+		LogFormat:      cfg.LogFormat,
+		LogFile:        cfg.LogFile,
+		LogMaxSize:     cfg.LogMaxSize,
+		LogMaxBackups:  logMaxBackups,
+		Syslog:         cfg.Syslog,
+		Timezone:       cfg.Timezone,
+		PIDFile:        cfg.PIDFile,
+		HistoryDB:      cfg.HistoryDB,
+		StateFile:      cfg.StateFile,
+		Catalog:        cfg.catalog(),
+		RunReports:     cfg.runReports(),
+		Incremental:    cfg.incremental(),
+		Differential:   cfg.Differential,
+		Dedup:          cfg.dedup(),
+		SkipUnchanged:  cfg.skipUnchanged(),
+		SkipEmpty:      cfg.skipEmpty(),
+		Delta:          deltas,
+		Symlinks:       cfg.Symlinks,
+		EmptyDirs:      cfg.emptyDirs(),
+		HardLinks:      cfg.hardLinks(),
+		Xattrs:         cfg.xattrs(),
+		SQLite:         cfg.sqlite(),
+		Snapshot:       cfg.Snapshot,
+		SnapshotDir:    cfg.SnapshotDir,
+		FSSnapshot:     cfg.FSSnapshot,
+		RequireMount:   cfg.requireMount(),
+		Sentinel:       cfg.Sentinel,
+		FileChecksums:  cfg.fileChecksums(),
+		Subdirs:        cfg.subdirs(),
+		CopyBuffer:     cfg.CopyBuffer,
+		DiskRatio:      diskRatio,
+		DiskMargin:     cfg.DiskMargin,
+		MaxStagingSize: cfg.MaxStagingSize,
+		MinFiles:       minFiles,
+		MinBytes:       cfg.MinBytes,
+		VerifySample:   verifySample,
+		MaxFileSize:    cfg.MaxFileSize,
+		MaxBucketUsage: cfg.MaxBucketUsage,
+		QuotaPolicy:    cfg.QuotaPolicy,
+		StaleArchives:  cfg.StaleArchives,
+		HealthAddr:     cfg.HealthAddr,
+		Pprof:          cfg.profiling(),
+		APIToken:       cfg.APIToken,
+		PingURL:        cfg.PingURL,
+		MaxBackupAge:   cfg.MaxBackupAge,
+		ScrubInterval:  cfg.ScrubInterval,
+		DrillInterval:  cfg.DrillInterval,
+		WatchFiles:     watchFiles,
+		Workers:        workers,
+		Parity:         parity,
+		Compression:    cfg.Compression,
+		MaxJobs:        cfg.maxJobs(),
+		WatchQuiet:     cfg.WatchQuiet,
+		Jitter:         cfg.Jitter,
+		Environment:    cfg.Environment,
+		InstanceID:     cfg.InstanceID,
+		Catchup:        cfg.catchup(),
+		PreRun:         cfg.PreRun,
+		PostRun:        cfg.PostRun,
+		Jobs:           jobs,
+		Storage: storageFileConfig{
+			Backend:         cfg.Backend,
+			LocalDir:        cfg.LocalDir,
+			Command:         cfg.StorageCommand,
+			Endpoint:        cfg.Endpoint,
+			AccessKeyID:     cfg.AccessKeyID,
+			SecretAccessKey: cfg.SecretAccessKey,
+			Bucket:          cfg.Bucket,
+			Region:          cfg.Region,
+			Checksum:        cfg.Checksum,
+			Signature:       cfg.Signature,
+			BucketLookup:    cfg.BucketLookup,
+			UserAgent:       cfg.UserAgent,
+			Middleware:      cfg.UploadMiddleware,
+			CreateBucket:    cfg.createBucket(),
+			ObjectLock:      cfg.bucketLock(),
+			Destinations:    cfg.Destinations,
+			Lifecycle:       cfg.Lifecycle,
+			Fallback:        cfg.Fallback,
+		},
+	}
+
+	if cfg.UsageInterval != "" || cfg.StorageCost != "" {
+		fileCfg.Usage = &usageFileConfig{Interval: cfg.UsageInterval, CostPerGB: cfg.storageCost()}
+	}
+
+	if cfg.ObjectLockMode != "" || cfg.ObjectLockPeriod != "" {
+		fileCfg.ObjectLock = &objectLockFileConfig{Mode: cfg.ObjectLockMode, Period: cfg.ObjectLockPeriod}
+	}
+
+	if threshold := cfg.circuitThreshold(); threshold > 0 {
+		fileCfg.Storage.CircuitBreaker = &circuitFileConfig{Threshold: threshold, Probe: cfg.CircuitProbe}
+	}
+
+	if cfg.SFTPHost != "" {
+		fileCfg.Storage.SFTP = &sftpFileConfig{
+			Host:       cfg.SFTPHost,
+			User:       cfg.SFTPUser,
+			Key:        cfg.SFTPKey,
+			KnownHosts: cfg.SFTPKnownHosts,
+			Path:       cfg.SFTPPath,
+		}
+	}
+
+	if cfg.B2BucketID != "" {
+		fileCfg.Storage.B2 = &b2FileConfig{
+			KeyID:          cfg.B2KeyID,
+			ApplicationKey: cfg.B2AppKey,
+			BucketID:       cfg.B2BucketID,
+		}
+	}
+
+	if cfg.VaultAddr != "" {
+		fileCfg.Storage.Vault = &vaultFileConfig{
+			Address:    cfg.VaultAddr,
+			Auth:       cfg.VaultAuth,
+			Token:      cfg.VaultToken,
+			RoleID:     cfg.VaultRoleID,
+			SecretID:   cfg.VaultSecretID,
+			SecretPath: cfg.VaultSecretPath,
+		}
+	}
+
+	if cfg.GRPCAddr != "" {
+		fileCfg.GRPC = &grpcFileConfig{
+			Address:     cfg.GRPCAddr,
+			Cert:        cfg.GRPCCert,
+			Key:         cfg.GRPCKey,
+			RestoreRoot: cfg.GRPCRestoreRoot,
+		}
+	}
+
+	if cfg.Dashboard != "" || cfg.DashboardUser != "" {
+		fileCfg.Dashboard = &dashboardFileConfig{
+			Enabled:  cfg.dashboard(),
+			Username: cfg.DashboardUser,
+			Password: cfg.DashboardPass,
+		}
+	}
+
+	if cfg.DistributedLock != "" || cfg.LeaderElection != "" {
+		fileCfg.Lock = &lockFileConfig{
+			Enabled: cfg.distributedLock(),
+			Leader:  cfg.leaderElection(),
+			Bucket:  cfg.LockBucket,
+			TTL:     cfg.LockTTL,
+		}
+	}
+
+	if cfg.Pushgateway != "" || cfg.Statsd != "" {
+		fileCfg.Metrics = &metricsFileConfig{
+			Pushgateway: cfg.Pushgateway,
+		}
+
+		if cfg.Statsd != "" {
+			fileCfg.Metrics.Statsd = &statsdFileConfig{
+				Address: cfg.Statsd,
+				Prefix:  cfg.StatsdPrefix,
+				Tags:    parseStatsdTags(cfg.StatsdTags),
+			}
+		}
+	}
+
+	if cfg.NotifyOn != "" || cfg.SlackWebhook != "" || cfg.DiscordWebhook != "" || cfg.SMTPHost != "" ||
+		cfg.TelegramToken != "" || cfg.WebhookURL != "" || cfg.EventsURL != "" {
+		fileCfg.Notifications = &notificationsFileConfig{
+			On: cfg.NotifyOn,
+		}
+
+		if cfg.SlackWebhook != "" {
+			fileCfg.Notifications.Slack = &webhookFileConfig{Webhook: cfg.SlackWebhook}
+		}
+
+		if cfg.DiscordWebhook != "" {
+			fileCfg.Notifications.Discord = &webhookFileConfig{Webhook: cfg.DiscordWebhook}
+		}
+
+		if cfg.SMTPHost != "" {
+			fileCfg.Notifications.Email = &emailFileConfig{
+				Host:     cfg.SMTPHost,
+				Port:     cfg.SMTPPort,
+				TLS:      cfg.SMTPTLS,
+				Username: cfg.SMTPUsername,
+				Password: cfg.SMTPPassword,
+				From:     cfg.SMTPFrom,
+				To:       parseAddressList(cfg.SMTPTo),
+			}
+		}
+
+		if cfg.TelegramToken != "" {
+			fileCfg.Notifications.Telegram = &telegramFileConfig{
+				Token:  cfg.TelegramToken,
+				ChatID: cfg.TelegramChatID,
+			}
+		}
+
+		if cfg.WebhookURL != "" {
+			fileCfg.Notifications.Webhook = &eventWebhookFileConfig{
+				URL:    cfg.WebhookURL,
+				Secret: cfg.WebhookSecret,
+			}
+		}
+
+		if cfg.EventsURL != "" {
+			fileCfg.Notifications.Events = &eventsFileConfig{
+				URL:    cfg.EventsURL,
+				Prefix: cfg.EventsPrefix,
+			}
+		}
+	}
+
+	return fileCfg
+}
+
+// configFormat returns the config file format for the provided path based on its extension.
+func configFormat(path string) string {
+	if strings.EqualFold(filepath.Ext(path), ".toml") {
+		return formatTOML
+	}
+
+	return formatYAML
+}
+
+// readConfigFile reads the structured configuration file at the provided path.
+func readConfigFile(path string) (*fileConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading config file: %w", err)
+	}
+
+	var fileCfg fileConfig
+	switch configFormat(path) {
+	case formatTOML:
+		err = toml.Unmarshal(data, &fileCfg)
+	default:
+		err = yaml.Unmarshal(data, &fileCfg)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("parsing config file %s: %w", path, err)
+	}
+
+	return &fileCfg, nil
+}
+
+// setDefault sets the provided value to the file value if it is not already set.
+func setDefault(value *string, fileValue string) {
+	if *value == "" {
+		*value = fileValue
+	}
+}
+
+// apply fills in the settings of the provided configuration which were not set by
+// environment variables or command line flags.
+func (f *fileConfig) apply(cfg *Config) {
+	setDefault(&cfg.LogLevel, f.LogLevel)
+	setDefault(&cfg.LogFormat, f.LogFormat)
+	setDefault(&cfg.LogFile, f.LogFile)
+	setDefault(&cfg.LogMaxSize, f.LogMaxSize)
+	if f.LogMaxBackups != 0 {
+		setDefault(&cfg.LogMaxBackups, strconv.Itoa(f.LogMaxBackups))
+	}
+	setDefault(&cfg.Syslog, f.Syslog)
+	setDefault(&cfg.Timezone, f.Timezone)
+	setDefault(&cfg.PIDFile, f.PIDFile)
+	setDefault(&cfg.HistoryDB, f.HistoryDB)
+	setDefault(&cfg.StateFile, f.StateFile)
+	if f.Incremental {
+		setDefault(&cfg.Incremental, "true")
+	}
+	setDefault(&cfg.Differential, f.Differential)
+	if f.Dedup {
+		setDefault(&cfg.Dedup, "true")
+	}
+	if f.SkipUnchanged {
+		setDefault(&cfg.SkipUnchanged, "true")
+	}
+	if f.SkipEmpty {
+		setDefault(&cfg.SkipEmpty, "true")
+	}
+	if f.Delta != 0 {
+		setDefault(&cfg.Delta, strconv.Itoa(f.Delta))
+	}
+	setDefault(&cfg.Symlinks, f.Symlinks)
+	if f.EmptyDirs {
+		setDefault(&cfg.EmptyDirs, "true")
+	}
+	if f.HardLinks {
+		setDefault(&cfg.HardLinks, "true")
+	}
+	if f.Xattrs {
+		setDefault(&cfg.Xattrs, "true")
+	}
+	if f.SQLite {
+		setDefault(&cfg.SQLite, "true")
+	}
+	setDefault(&cfg.Snapshot, f.Snapshot)
+	setDefault(&cfg.SnapshotDir, f.SnapshotDir)
+	setDefault(&cfg.FSSnapshot, f.FSSnapshot)
+	if f.RequireMount {
+		setDefault(&cfg.RequireMount, "true")
+	}
+	setDefault(&cfg.Sentinel, f.Sentinel)
+	if f.FileChecksums {
+		setDefault(&cfg.FileChecksums, "true")
+	}
+	if f.Subdirs {
+		setDefault(&cfg.Subdirs, "true")
+	}
+	setDefault(&cfg.CopyBuffer, f.CopyBuffer)
+	if f.DiskRatio != 0 {
+		setDefault(&cfg.DiskRatio, strconv.FormatFloat(f.DiskRatio, 'g', -1, 64))
+	}
+	setDefault(&cfg.DiskMargin, f.DiskMargin)
+	setDefault(&cfg.MaxStagingSize, f.MaxStagingSize)
+	if f.MinFiles != 0 {
+		setDefault(&cfg.MinFiles, strconv.Itoa(f.MinFiles))
+	}
+	setDefault(&cfg.MinBytes, f.MinBytes)
+	if f.VerifySample != 0 {
+		setDefault(&cfg.VerifySample, strconv.Itoa(f.VerifySample))
+	}
+	setDefault(&cfg.MaxFileSize, f.MaxFileSize)
+	setDefault(&cfg.MaxBucketUsage, f.MaxBucketUsage)
+	setDefault(&cfg.QuotaPolicy, f.QuotaPolicy)
+	setDefault(&cfg.StaleArchives, f.StaleArchives)
+	if f.ObjectLock != nil {
+		setDefault(&cfg.ObjectLockMode, f.ObjectLock.Mode)
+		setDefault(&cfg.ObjectLockPeriod, f.ObjectLock.Period)
+	}
+	if f.Catalog {
+		setDefault(&cfg.Catalog, "true")
+	}
+	if f.RunReports {
+		setDefault(&cfg.RunReports, "true")
+	}
+	setDefault(&cfg.HealthAddr, f.HealthAddr)
+	if f.Pprof {
+		setDefault(&cfg.Pprof, "true")
+	}
+	setDefault(&cfg.APIToken, f.APIToken)
+
+	if f.GRPC != nil {
+		setDefault(&cfg.GRPCAddr, f.GRPC.Address)
+		setDefault(&cfg.GRPCCert, f.GRPC.Cert)
+		setDefault(&cfg.GRPCKey, f.GRPC.Key)
+		setDefault(&cfg.GRPCRestoreRoot, f.GRPC.RestoreRoot)
+	}
+
+	if f.Dashboard != nil {
+		setDefault(&cfg.Dashboard, strconv.FormatBool(f.Dashboard.Enabled))
+		setDefault(&cfg.DashboardUser, f.Dashboard.Username)
+		setDefault(&cfg.DashboardPass, f.Dashboard.Password)
+	}
+	setDefault(&cfg.PingURL, f.PingURL)
+	setDefault(&cfg.MaxBackupAge, f.MaxBackupAge)
+	setDefault(&cfg.ScrubInterval, f.ScrubInterval)
+	setDefault(&cfg.DrillInterval, f.DrillInterval)
+	if f.Usage != nil {
+		setDefault(&cfg.UsageInterval, f.Usage.Interval)
+		if f.Usage.CostPerGB != 0 {
+			setDefault(&cfg.StorageCost, strconv.FormatFloat(f.Usage.CostPerGB, 'f', -1, 64))
+		}
+	}
+	setDefault(&cfg.SourceDir, f.SourceDir)
+	if f.WatchFiles != 0 {
+		setDefault(&cfg.WatchFiles, strconv.Itoa(f.WatchFiles))
+	}
+	if f.Workers != 0 {
+		setDefault(&cfg.Workers, strconv.Itoa(f.Workers))
+	}
+	if f.Parity != 0 {
+		setDefault(&cfg.Parity, strconv.Itoa(f.Parity))
+	}
+	if f.MaxJobs != 0 {
+		setDefault(&cfg.MaxJobs, strconv.Itoa(f.MaxJobs))
+	}
+	setDefault(&cfg.WatchQuiet, f.WatchQuiet)
+	setDefault(&cfg.Jitter, f.Jitter)
+	setDefault(&cfg.Environment, f.Environment)
+	setDefault(&cfg.InstanceID, f.InstanceID)
+	if f.Catchup {
+		setDefault(&cfg.Catchup, "true")
+	}
+	setDefault(&cfg.PreRun, f.PreRun)
+	setDefault(&cfg.PostRun, f.PostRun)
+
+	if f.Dump != nil {
+		setDefault(&cfg.DumpCommand, f.Dump.Command)
+		setDefault(&cfg.DumpFile, f.Dump.File)
+	}
+	setDefault(&cfg.Backend, f.Storage.Backend)
+	setDefault(&cfg.LocalDir, f.Storage.LocalDir)
+	setDefault(&cfg.StorageCommand, f.Storage.Command)
+	if f.Storage.B2 != nil {
+		setDefault(&cfg.B2KeyID, f.Storage.B2.KeyID)
+		setDefault(&cfg.B2AppKey, f.Storage.B2.ApplicationKey)
+		setDefault(&cfg.B2BucketID, f.Storage.B2.BucketID)
+	}
+	setDefault(&cfg.Endpoint, f.Storage.Endpoint)
+	setDefault(&cfg.Bucket, f.Storage.Bucket)
+	setDefault(&cfg.Region, f.Storage.Region)
+	setDefault(&cfg.Checksum, f.Storage.Checksum)
+	setDefault(&cfg.Signature, f.Storage.Signature)
+	setDefault(&cfg.BucketLookup, f.Storage.BucketLookup)
+	setDefault(&cfg.UserAgent, f.Storage.UserAgent)
+	setDefault(&cfg.UploadMiddleware, f.Storage.Middleware)
+	if f.Storage.CircuitBreaker != nil {
+		setDefault(&cfg.CircuitThreshold, strconv.Itoa(f.Storage.CircuitBreaker.Threshold))
+		setDefault(&cfg.CircuitProbe, f.Storage.CircuitBreaker.Probe)
+	}
+	if f.Storage.CreateBucket {
+		setDefault(&cfg.CreateBucket, "true")
+	}
+	if f.Storage.ObjectLock {
+		setDefault(&cfg.BucketLock, "true")
+	}
+	if f.Storage.SFTP != nil {
+		setDefault(&cfg.SFTPHost, f.Storage.SFTP.Host)
+		setDefault(&cfg.SFTPUser, f.Storage.SFTP.User)
+		setDefault(&cfg.SFTPKey, f.Storage.SFTP.Key)
+		setDefault(&cfg.SFTPKnownHosts, f.Storage.SFTP.KnownHosts)
+		setDefault(&cfg.SFTPPath, f.Storage.SFTP.Path)
+	}
+
+	if len(cfg.Jobs) == 0 {
+		cfg.Jobs = f.Jobs
+	}
+	if len(cfg.Destinations) == 0 {
+		cfg.Destinations = f.Storage.Destinations
+	}
+	if cfg.Fallback == nil {
+		cfg.Fallback = f.Storage.Fallback
+	}
+	if len(cfg.Lifecycle) == 0 {
+		cfg.Lifecycle = f.Storage.Lifecycle
+	}
+	if len(cfg.Compression) == 0 {
+		cfg.Compression = f.Compression
+	}
+
+	if cfg.AccessKeyID == "" && cfg.SecretAccessKey == "" && f.Storage.AccessKeyID != "" {
+		cfg.AccessKeyID = f.Storage.AccessKeyID
+		cfg.SecretAccessKey = f.Storage.SecretAccessKey
+		cfg.staticCreds = true
+	}
+
+	if f.Lock != nil {
+		setDefault(&cfg.DistributedLock, strconv.FormatBool(f.Lock.Enabled))
+		setDefault(&cfg.LeaderElection, strconv.FormatBool(f.Lock.Leader))
+		setDefault(&cfg.LockBucket, f.Lock.Bucket)
+		setDefault(&cfg.LockTTL, f.Lock.TTL)
+	}
+
+	if f.Metrics != nil {
+		setDefault(&cfg.Pushgateway, f.Metrics.Pushgateway)
+
+		if f.Metrics.Statsd != nil {
+			setDefault(&cfg.Statsd, f.Metrics.Statsd.Address)
+			setDefault(&cfg.StatsdPrefix, f.Metrics.Statsd.Prefix)
+			setDefault(&cfg.StatsdTags, strings.Join(f.Metrics.Statsd.Tags, ","))
+		}
+	}
+
+	if f.Notifications != nil {
+		setDefault(&cfg.NotifyOn, f.Notifications.On)
+
+		if f.Notifications.Slack != nil {
+			setDefault(&cfg.SlackWebhook, f.Notifications.Slack.Webhook)
+		}
+
+		if f.Notifications.Discord != nil {
+			setDefault(&cfg.DiscordWebhook, f.Notifications.Discord.Webhook)
+		}
+
+		if f.Notifications.Email != nil {
+			email := f.Notifications.Email
+			setDefault(&cfg.SMTPHost, email.Host)
+			setDefault(&cfg.SMTPPort, email.Port)
+			setDefault(&cfg.SMTPTLS, email.TLS)
+			setDefault(&cfg.SMTPUsername, email.Username)
+			setDefault(&cfg.SMTPPassword, email.Password)
+			setDefault(&cfg.SMTPFrom, email.From)
+			setDefault(&cfg.SMTPTo, strings.Join(email.To, ","))
+		}
+
+		if f.Notifications.Telegram != nil {
+			setDefault(&cfg.TelegramToken, f.Notifications.Telegram.Token)
+			setDefault(&cfg.TelegramChatID, f.Notifications.Telegram.ChatID)
+		}
+
+		if f.Notifications.Webhook != nil {
+			setDefault(&cfg.WebhookURL, f.Notifications.Webhook.URL)
+			setDefault(&cfg.WebhookSecret, f.Notifications.Webhook.Secret)
+		}
+
+		if f.Notifications.Events != nil {
+			setDefault(&cfg.EventsURL, f.Notifications.Events.URL)
+			setDefault(&cfg.EventsPrefix, f.Notifications.Events.Prefix)
+		}
+	}
+
+	if f.Storage.Vault != nil {
+		setDefault(&cfg.VaultAddr, f.Storage.Vault.Address)
+		setDefault(&cfg.VaultAuth, f.Storage.Vault.Auth)
+		setDefault(&cfg.VaultToken, f.Storage.Vault.Token)
+		setDefault(&cfg.VaultRoleID, f.Storage.Vault.RoleID)
+		setDefault(&cfg.VaultSecretID, f.Storage.Vault.SecretID)
+		setDefault(&cfg.VaultSecretPath, f.Storage.Vault.SecretPath)
+	}
+}
+
+// migrateConfig writes the structured file equivalent of the provided configuration in the
+// provided format.
+func migrateConfig(cfg *Config, w io.Writer, format string) error {
+	fileCfg := newFileConfig(cfg)
+
+	switch format {
+	case formatTOML:
+		err := toml.NewEncoder(w).Encode(fileCfg)
+		if err != nil {
+			return fmt.Errorf("encoding config file: %w", err)
+		}
+
+		return nil
+
+	default:
+		enc := yaml.NewEncoder(w)
+		enc.SetIndent(2)
+
+		err := enc.Encode(fileCfg)
+		if err != nil {
+			return fmt.Errorf("encoding config file: %w", err)
+		}
+
+		return enc.Close()
+	}
+}
@@ -0,0 +1,88 @@
+package archiver
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/peterldowns/testy/assert"
+	"gopkg.in/yaml.v3"
+)
+
+func TestMigrateConfig(t *testing.T) {
+	cfg := Config{
+		Endpoint:        "test-endpoint",
+		AccessKeyID:     "test-accesskeyid",
+		SecretAccessKey: "test-secretaccesskey",
+		Bucket:          "test-bucket",
+		SourceDir:       "test-sourcedir",
+		LogLevel:        "debug",
+	}
+
+	// Ensure the migrated config carries over every setting.
+	var buf bytes.Buffer
+	err := migrateConfig(&cfg, &buf, formatYAML)
+	assert.NoError(t, err)
+
+	var fileCfg fileConfig
+	err = yaml.Unmarshal(buf.Bytes(), &fileCfg)
+	assert.NoError(t, err)
+	assert.Equal(t, *newFileConfig(&cfg), fileCfg)
+
+	// Ensure the migrate command writes the config file to the provided path.
+	outPath := filepath.Join(t.TempDir(), "config.yaml")
+	err = runCommand(&cfg, []string{"config", "migrate", "-out", outPath}, &buf)
+	assert.NoError(t, err)
+
+	data, err := os.ReadFile(outPath)
+	assert.NoError(t, err)
+	assert.Equal(t, buf.String()[:len(data)], string(data))
+
+	info, err := os.Stat(outPath)
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	// Ensure unknown commands are rejected.
+	err = runCommand(&cfg, []string{"config", "unknown"}, &buf)
+	assert.Error(t, err)
+}
+
+func TestReadConfigFile(t *testing.T) {
+	cfg := Config{
+		Endpoint:        "test-endpoint",
+		AccessKeyID:     "test-accesskeyid",
+		SecretAccessKey: "test-secretaccesskey",
+		Bucket:          "test-bucket",
+		SourceDir:       "test-sourcedir",
+		LogLevel:        "debug",
+	}
+
+	// Ensure migrated YAML and TOML config files read back to the same settings.
+	for _, name := range []string{"config.yaml", "config.toml"} {
+		path := filepath.Join(t.TempDir(), name)
+		err := runCommand(&cfg, []string{"config", "migrate", "-out", path}, &bytes.Buffer{})
+		assert.NoError(t, err)
+
+		fileCfg, err := readConfigFile(path)
+		assert.NoError(t, err)
+		assert.Equal(t, *newFileConfig(&cfg), *fileCfg)
+	}
+
+	// Ensure settings already provided by the environment or flags take precedence.
+	fileCfg := newFileConfig(&cfg)
+	loaded := Config{Bucket: "flag-bucket"}
+	fileCfg.apply(&loaded)
+	assert.Equal(t, "flag-bucket", loaded.Bucket)
+	assert.Equal(t, "test-endpoint", loaded.Endpoint)
+	assert.Equal(t, "test-accesskeyid", loaded.AccessKeyID)
+	assert.Equal(t, "test-secretaccesskey", loaded.SecretAccessKey)
+	assert.NoError(t, loaded.validate())
+
+	// Ensure invalid config files are rejected.
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	err := os.WriteFile(path, []byte("storage: [\n"), 0600)
+	assert.NoError(t, err)
+	_, err = readConfigFile(path)
+	assert.Error(t, err)
+}
@@ -0,0 +1,294 @@
+package archiver
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dnldd/zdts3/controlpb"
+	"github.com/dnldd/zdts3/pkg/storage"
+	"github.com/go-co-op/gocron/v2"
+	"github.com/rs/zerolog"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	grpccreds "google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// controlShutdownTimeout is the maximum duration of waiting for in-flight control requests
+// on shutdown.
+const controlShutdownTimeout = 5 * time.Second
+
+// controlServer implements the gRPC control service, letting fleet management tooling run,
+// inspect, prune and restore the jobs of an instance.
+type controlServer struct {
+	controlpb.UnimplementedControlServer
+
+	s           gocron.Scheduler
+	tracker     *statusTracker
+	api         *runAPI
+	jobs        *jobResolver
+	restoreRoot string
+	logger      *zerolog.Logger
+}
+
+// newControlServer creates the gRPC server of the control service. Requests must carry the
+// token of the provided run API as bearer token. TLS is used when a certificate and key
+// are provided. Restores may target the provided root directory besides the source
+// directories of jobs, none when empty.
+func newControlServer(s gocron.Scheduler, tracker *statusTracker, api *runAPI, config func() *Config, certFile string, keyFile string, restoreRoot string, logger *zerolog.Logger) (*grpc.Server, error) {
+	opts := []grpc.ServerOption{grpc.UnaryInterceptor(tokenInterceptor(api.token))}
+	if certFile != "" {
+		creds, err := grpccreds.NewServerTLSFromFile(certFile, keyFile)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, grpc.Creds(creds))
+	}
+
+	srv := grpc.NewServer(opts...)
+	controlpb.RegisterControlServer(srv, &controlServer{
+		s:           s,
+		tracker:     tracker,
+		api:         api,
+		jobs:        newJobResolver(config, logger),
+		restoreRoot: restoreRoot,
+		logger:      logger,
+	})
+
+	return srv, nil
+}
+
+// isLoopbackHost returns whether the provided listen host only accepts local connections.
+func isLoopbackHost(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// tokenInterceptor rejects requests not carrying the provided bearer token.
+func tokenInterceptor(token string) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		md, _ := metadata.FromIncomingContext(ctx)
+		for _, value := range md.Get("authorization") {
+			provided, ok := strings.CutPrefix(value, "Bearer ")
+			if ok && subtle.ConstantTimeCompare([]byte(provided), []byte(token)) == 1 {
+				return handler(ctx, req)
+			}
+		}
+
+		return nil, status.Error(codes.Unauthenticated, "invalid or missing token")
+	}
+}
+
+// serveControl serves the control service on the provided listener until the context is
+// cancelled.
+func serveControl(ctx context.Context, ln net.Listener, srv *grpc.Server, logger *zerolog.Logger, wg *sync.WaitGroup) {
+	defer wg.Done()
+
+	go func() {
+		<-ctx.Done()
+
+		// Cancel in-flight requests which do not finish in time.
+		timer := time.AfterFunc(controlShutdownTimeout, srv.Stop)
+		defer timer.Stop()
+		srv.GracefulStop()
+	}()
+
+	err := srv.Serve(ln)
+	if err != nil && !errors.Is(err, grpc.ErrServerStopped) {
+		logger.Error().Err(err).Msg("Serving control service")
+	}
+}
+
+// timestamp returns the protobuf timestamp of the provided time, nil for unset times.
+func timestamp(t *time.Time) *timestamppb.Timestamp {
+	if t == nil || t.IsZero() {
+		return nil
+	}
+
+	return timestamppb.New(*t)
+}
+
+// triggeredRunProto returns the protobuf representation of the provided triggered run.
+func triggeredRunProto(run *triggeredRun) *controlpb.TriggeredRun {
+	duration, _ := time.ParseDuration(run.Duration)
+
+	return &controlpb.TriggeredRun{
+		Id:              run.ID,
+		Job:             run.Job,
+		Status:          run.Status,
+		Triggered:       timestamp(&run.Triggered),
+		Start:           timestamp(run.Start),
+		DurationSeconds: duration.Seconds(),
+		Files:           int64(run.Files),
+		ArchiveSize:     run.ArchiveSize,
+		Key:             run.Key,
+		Error:           run.Error,
+	}
+}
+
+// archivesProto returns the protobuf representation of the provided archives.
+func archivesProto(archives []storage.Object) []*controlpb.Archive {
+	list := make([]*controlpb.Archive, 0, len(archives))
+	for _, archive := range archives {
+		list = append(list, &controlpb.Archive{
+			Key:      archive.Key,
+			Size:     archive.Size,
+			Modified: timestamp(&archive.Modified),
+		})
+	}
+
+	return list
+}
+
+// Run triggers an immediate run of a job.
+func (c *controlServer) Run(_ context.Context, req *controlpb.RunRequest) (*controlpb.RunResponse, error) {
+	run, err := c.api.triggerJob(req.GetJob())
+	switch {
+	case errors.Is(err, errUnknownJob):
+		return nil, status.Error(codes.NotFound, err.Error())
+	case errors.Is(err, errJobRunning):
+		return nil, status.Error(codes.FailedPrecondition, err.Error())
+	case err != nil:
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	return &controlpb.RunResponse{Run: triggeredRunProto(&run)}, nil
+}
+
+// Status returns the status of the jobs and, if requested, of a triggered run.
+func (c *controlServer) Status(_ context.Context, req *controlpb.StatusRequest) (*controlpb.StatusResponse, error) {
+	resp := &controlpb.StatusResponse{Version: getBuildInfo().Version}
+	for _, job := range c.tracker.status(c.s) {
+		duration, _ := time.ParseDuration(job.Duration)
+		resp.Jobs = append(resp.Jobs, &controlpb.JobStatus{
+			Job:             job.Job,
+			LastRun:         timestamp(job.LastRun),
+			Result:          job.Result,
+			Error:           job.Error,
+			DurationSeconds: duration.Seconds(),
+			Files:           int64(job.Files),
+			ArchiveSize:     job.ArchiveSize,
+			NextRun:         timestamp(job.NextRun),
+		})
+	}
+
+	if req.GetRunId() != "" {
+		run, ok := c.api.triggered(req.GetRunId())
+		if !ok {
+			return nil, status.Errorf(codes.NotFound, "unknown run %q", req.GetRunId())
+		}
+		resp.Run = triggeredRunProto(&run)
+	}
+
+	return resp, nil
+}
+
+// List lists the remote archives of a job, newest first.
+func (c *controlServer) List(ctx context.Context, req *controlpb.ListRequest) (*controlpb.ListResponse, error) {
+	_, s3Cfg, err := c.jobs.job(req.GetJob())
+	if err != nil {
+		return nil, status.Error(codes.NotFound, err.Error())
+	}
+
+	archives, err := listArchives(ctx, s3Cfg)
+	if err != nil {
+		return nil, status.Error(codes.Unavailable, err.Error())
+	}
+
+	return &controlpb.ListResponse{Bucket: s3Cfg.Bucket, Archives: archivesProto(archives)}, nil
+}
+
+// Prune deletes the remote archives of a job exceeding the requested retention.
+func (c *controlServer) Prune(ctx context.Context, req *controlpb.PruneRequest) (*controlpb.PruneResponse, error) {
+	if req.GetOlderThan() == "" && req.GetKeep() <= 0 {
+		return nil, status.Error(codes.InvalidArgument, "older_than or keep required")
+	}
+
+	before := time.Now()
+	if req.GetOlderThan() != "" {
+		retention, err := parseRetention(req.GetOlderThan())
+		if err != nil {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+		before = before.Add(-retention)
+	}
+
+	_, s3Cfg, err := c.jobs.job(req.GetJob())
+	if err != nil {
+		return nil, status.Error(codes.NotFound, err.Error())
+	}
+
+	pruned, err := pruneArchives(ctx, s3Cfg, before, int(req.GetKeep()), req.GetDryRun())
+	if err != nil {
+		return nil, status.Error(codes.Unavailable, err.Error())
+	}
+
+	if !req.GetDryRun() {
+		c.logger.Info().Str("bucket", s3Cfg.Bucket).Int("archives", len(pruned)).Msg("Pruned archives")
+	}
+
+	return &controlpb.PruneResponse{Deleted: archivesProto(pruned)}, nil
+}
+
+// Restore downloads and extracts a remote archive of a job on this host. Archives are
+// extracted into the job's source directory unless another target directory within the
+// restore root is requested. Existing files are never overwritten.
+func (c *controlServer) Restore(ctx context.Context, req *controlpb.RestoreRequest) (*controlpb.RestoreResponse, error) {
+	jobCfg, s3Cfg, err := c.jobs.job(req.GetJob())
+	if err != nil {
+		return nil, status.Error(codes.NotFound, err.Error())
+	}
+
+	targetDir := jobCfg.SourceDir
+	if req.GetTargetDir() != "" {
+		targetDir, err = c.restoreTarget(req.GetTargetDir())
+		if err != nil {
+			return nil, status.Error(codes.PermissionDenied, err.Error())
+		}
+	}
+
+	result, err := restoreArchiveFiles(ctx, s3Cfg, req.GetKey(), targetDir, extractOptions{Overwrite: overwriteNever})
+	if err != nil {
+		return nil, status.Error(codes.Unavailable, err.Error())
+	}
+
+	c.logger.Info().Str("object", result.Key).Str("path", targetDir).Int("files", result.Files).Msg("Restored archive")
+
+	return &controlpb.RestoreResponse{
+		Key:   result.Key,
+		Files: int64(result.Files),
+		Bytes: result.Bytes,
+	}, nil
+}
+
+// restoreTarget returns the path of the provided requested target directory, which must be
+// within the restore root. Relative directories are relative to the root.
+func (c *controlServer) restoreTarget(dir string) (string, error) {
+	if c.restoreRoot == "" {
+		return "", errors.New("target directories require a restore root")
+	}
+
+	target := dir
+	if !filepath.IsAbs(target) {
+		target = filepath.Join(c.restoreRoot, target)
+	}
+	rel, err := filepath.Rel(c.restoreRoot, target)
+	if err != nil || !filepath.IsLocal(rel) {
+		return "", fmt.Errorf("target directory %s is outside the restore root", dir)
+	}
+
+	return filepath.Clean(target), nil
+}
@@ -0,0 +1,135 @@
+package archiver
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dnldd/zdts3/controlpb"
+	"github.com/go-co-op/gocron/v2"
+	"github.com/peterldowns/testy/assert"
+	"github.com/rs/zerolog"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func TestControlServer(t *testing.T) {
+	fake := newFakeS3(t, "test-bucket")
+	s3Cfg := fake.s3Config("test-bucket")
+	putArchives(t, s3Cfg, map[string][]byte{
+		"backups/dump-20260101235000.zip": zipBytes(t, map[string]string{"users.sql": "old"}),
+		"backups/dump-20260102235000.zip": zipBytes(t, map[string]string{"users.sql": "new"}),
+	})
+
+	s, err := gocron.NewScheduler()
+	assert.NoError(t, err)
+	defer s.Shutdown()
+
+	logger := zerolog.Nop()
+	api := newRunAPI(s, "test-token", &logger)
+	tracker := newStatusTracker()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// The task reports to the API like archive runs do.
+	task := func() {
+		run := &runResult{Job: "db", Start: time.Now()}
+		api.start(ctx, run)
+		run.Files = 2
+		tracker.report(ctx, run)
+		api.report(ctx, run)
+	}
+	_, err = s.NewJob(gocron.DurationJob(time.Hour), gocron.NewTask(task), gocron.WithName("db"))
+	assert.NoError(t, err)
+	s.Start()
+
+	cfg := &Config{
+		Endpoint:        s3Cfg.Endpoint,
+		AccessKeyID:     "test-accesskeyid",
+		SecretAccessKey: "test-secretaccesskey",
+		Jobs:            []jobConfig{{Name: "db", SourceDir: t.TempDir(), Bucket: "test-bucket", Prefix: "backups"}},
+		staticCreds:     true,
+		transport:       s3Cfg.Options.Transport,
+	}
+	restoreRoot := t.TempDir()
+	srv, err := newControlServer(s, tracker, api, func() *Config { return cfg }, "", "", restoreRoot, &logger)
+	assert.NoError(t, err)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go serveControl(ctx, ln, srv, &logger, &wg)
+	defer wg.Wait()
+	defer cancel()
+
+	conn, err := grpc.NewClient(ln.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	assert.NoError(t, err)
+	defer conn.Close()
+	client := controlpb.NewControlClient(conn)
+
+	// Ensure requests require the token.
+	_, err = client.Status(ctx, &controlpb.StatusRequest{})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	authCtx := metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer test-token")
+	ctl := func(args ...string) (string, error) {
+		var out bytes.Buffer
+		err := runCtl(authCtx, client, args, &out)
+		return out.String(), err
+	}
+
+	// Ensure runs can be triggered and awaited.
+	out, err := ctl("run", "-wait")
+	assert.NoError(t, err)
+	assert.True(t, strings.Contains(out, "of job db: succeeded"))
+
+	out, err = ctl("status")
+	assert.NoError(t, err)
+	assert.True(t, strings.Contains(out, "db"))
+	assert.True(t, strings.Contains(out, "success"))
+
+	_, err = client.Run(authCtx, &controlpb.RunRequest{Job: "logs"})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+
+	// Ensure archives can be listed, pruned and restored.
+	out, err = ctl("list")
+	assert.NoError(t, err)
+	assert.True(t, strings.Index(out, "dump-20260102235000.zip") < strings.Index(out, "dump-20260101235000.zip"))
+
+	_, err = client.Prune(authCtx, &controlpb.PruneRequest{})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	out, err = ctl("prune", "-keep", "1")
+	assert.NoError(t, err)
+	assert.True(t, strings.Contains(out, "dump-20260101235000.zip"))
+	assert.True(t, fake.object("test-bucket", "backups/dump-20260101235000.zip") == nil)
+
+	target := filepath.Join(restoreRoot, "db")
+	out, err = ctl("restore", "-target", target)
+	assert.NoError(t, err)
+	assert.True(t, strings.Contains(out, "dump-20260102235000.zip: 1 files"))
+
+	// Ensure restores never overwrite existing files.
+	assert.NoError(t, os.WriteFile(filepath.Join(target, "users.sql"), []byte("local"), 0644))
+	_, err = ctl("restore", "-target", "db")
+	assert.NoError(t, err)
+	data, err := os.ReadFile(filepath.Join(target, "users.sql"))
+	assert.NoError(t, err)
+	assert.Equal(t, "local", string(data))
+
+	// Ensure restores outside the restore root are rejected.
+	for _, dir := range []string{t.TempDir(), "../escape"} {
+		_, err = client.Restore(authCtx, &controlpb.RestoreRequest{TargetDir: dir})
+		assert.Equal(t, codes.PermissionDenied, status.Code(err))
+	}
+}
@@ -0,0 +1,113 @@
+package archiver
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/minio/minio-go/v7/pkg/credentials"
+	"github.com/rs/zerolog"
+)
+
+// reloadingProvider is a minio credentials provider for access keys sourced from the
+// environment, the .env file or _FILE secret references. The keys are read again whenever
+// one of those files changes, so rotated credentials are used by the next upload without
+// restarting the daemon.
+type reloadingProvider struct {
+	envPath  string
+	logger   *zerolog.Logger
+	modTimes map[string]time.Time
+}
+
+// newReloadingProvider creates a reloading credentials provider for the provided .env file.
+func newReloadingProvider(envPath string, logger *zerolog.Logger) *reloadingProvider {
+	return &reloadingProvider{
+		envPath: envPath,
+		logger:  logger,
+	}
+}
+
+// modTime returns the modification time of the file at the provided path, or the zero time
+// if it does not exist.
+func modTime(path string) time.Time {
+	info, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}
+	}
+
+	return info.ModTime()
+}
+
+// IsExpired returns whether any of the files the credentials were read from changed.
+func (p *reloadingProvider) IsExpired() bool {
+	if p.modTimes == nil {
+		return true
+	}
+
+	for path, recorded := range p.modTimes {
+		if !modTime(path).Equal(recorded) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// RetrieveWithCredContext reads the access keys from their current sources.
+func (p *reloadingProvider) RetrieveWithCredContext(_ *credentials.CredContext) (credentials.Value, error) {
+	values, err := readDotenv(p.envPath)
+	if err != nil {
+		return credentials.Value{}, err
+	}
+
+	lookup := func(name string) string {
+		value := os.Getenv(name)
+		if value != "" {
+			return value
+		}
+
+		return values[name]
+	}
+
+	accessKeyID, err := resolveEnv("accesskeyid", lookup)
+	if err != nil {
+		return credentials.Value{}, err
+	}
+
+	secretAccessKey, err := resolveEnv("secretaccesskey", lookup)
+	if err != nil {
+		return credentials.Value{}, err
+	}
+
+	if accessKeyID == "" || secretAccessKey == "" {
+		return credentials.Value{}, fmt.Errorf("access key ID and secret access key required")
+	}
+
+	// Track the files the credentials were read from to detect rotations.
+	modTimes := map[string]time.Time{p.envPath: modTime(p.envPath)}
+	for _, name := range []string{"accesskeyid", "secretaccesskey"} {
+		for _, fileVar := range fileEnvNames(name) {
+			path := lookup(fileVar)
+			if path != "" {
+				modTimes[path] = modTime(path)
+			}
+		}
+	}
+
+	if p.modTimes != nil {
+		p.logger.Info().Msg("Reloaded rotated S3 credentials")
+	}
+	p.modTimes = modTimes
+	addSecrets(secretAccessKey)
+
+	return credentials.Value{
+		AccessKeyID:     accessKeyID,
+		SecretAccessKey: secretAccessKey,
+		SignerType:      credentials.SignatureV4,
+	}, nil
+}
+
+// Retrieve reads the access keys from their current sources.
+func (p *reloadingProvider) Retrieve() (credentials.Value, error) {
+	return p.RetrieveWithCredContext(nil)
+}
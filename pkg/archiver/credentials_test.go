@@ -0,0 +1,61 @@
+package archiver
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/peterldowns/testy/assert"
+	"github.com/rs/zerolog"
+)
+
+func TestReloadingProvider(t *testing.T) {
+	dir := t.TempDir()
+	envPath := filepath.Join(dir, ".env")
+	secretPath := filepath.Join(dir, "secret")
+
+	t.Setenv("accesskeyid", "")
+	t.Setenv("secretaccesskey", "")
+	t.Setenv("secretaccesskey_file", "")
+	t.Setenv("SECRETACCESSKEY_FILE", "")
+
+	err := os.WriteFile(envPath, []byte("accesskeyid=test-accesskeyid\nsecretaccesskey_file="+secretPath+"\n"), 0600)
+	assert.NoError(t, err)
+	err = os.WriteFile(secretPath, []byte("test-secretaccesskey\n"), 0600)
+	assert.NoError(t, err)
+
+	// Ensure the credentials are read from the .env and secret files.
+	logger := zerolog.Nop()
+	provider := newReloadingProvider(envPath, &logger)
+	assert.True(t, provider.IsExpired())
+
+	value, err := provider.Retrieve()
+	assert.NoError(t, err)
+	assert.Equal(t, "test-accesskeyid", value.AccessKeyID)
+	assert.Equal(t, "test-secretaccesskey", value.SecretAccessKey)
+	assert.False(t, provider.IsExpired())
+
+	// Ensure rotating the secret file expires and reloads the credentials.
+	err = os.WriteFile(secretPath, []byte("rotated-secretaccesskey\n"), 0600)
+	assert.NoError(t, err)
+	future := time.Now().Add(time.Minute)
+	err = os.Chtimes(secretPath, future, future)
+	assert.NoError(t, err)
+	assert.True(t, provider.IsExpired())
+
+	value, err = provider.Retrieve()
+	assert.NoError(t, err)
+	assert.Equal(t, "rotated-secretaccesskey", value.SecretAccessKey)
+	assert.False(t, provider.IsExpired())
+
+	// Ensure removing the credentials from the .env file is an error.
+	err = os.WriteFile(envPath, []byte("bucket=test-bucket\n"), 0600)
+	assert.NoError(t, err)
+	err = os.Chtimes(envPath, future, future)
+	assert.NoError(t, err)
+	assert.True(t, provider.IsExpired())
+
+	_, err = provider.Retrieve()
+	assert.Error(t, err)
+}
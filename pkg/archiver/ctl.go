@@ -0,0 +1,237 @@
+package archiver
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"text/tabwriter"
+	"time"
+
+	"github.com/dnldd/zdts3/controlpb"
+	"github.com/dustin/go-humanize"
+	"google.golang.org/grpc"
+	grpccreds "google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// ctlTimeout is the maximum duration of a control request.
+const ctlTimeout = 10 * time.Minute
+
+// ctlAddress returns the address the control client connects to by default, the control
+// listen address of the provided configuration on the local host.
+func ctlAddress(cfg *Config) string {
+	return localAddress(cfg.GRPCAddr)
+}
+
+// localAddress returns the address of the provided listen address on the local host, empty
+// for invalid addresses.
+func localAddress(listen string) string {
+	host, port, err := net.SplitHostPort(listen)
+	if err != nil {
+		return ""
+	}
+
+	if host == "" || host == "0.0.0.0" || host == "::" {
+		host = "localhost"
+	}
+
+	return net.JoinHostPort(host, port)
+}
+
+// formatTimestamp formats the provided protobuf timestamp, empty for unset timestamps.
+func formatTimestamp(ts *timestamppb.Timestamp) string {
+	if ts == nil {
+		return ""
+	}
+
+	return ts.AsTime().Local().Format(time.DateTime)
+}
+
+// printRun writes the provided triggered run.
+func printRun(out io.Writer, run *controlpb.TriggeredRun) {
+	fmt.Fprintf(out, "run %s of job %s: %s\n", run.GetId(), run.GetJob(), run.GetStatus())
+	if run.GetStart() != nil && run.GetStatus() != runRunning {
+		fmt.Fprintf(out, "  started %s, took %s, %d files, %s, %s\n",
+			formatTimestamp(run.GetStart()),
+			time.Duration(run.GetDurationSeconds()*float64(time.Second)).Round(time.Millisecond),
+			run.GetFiles(), humanize.IBytes(uint64(run.GetArchiveSize())), run.GetKey())
+	}
+	if run.GetError() != "" {
+		fmt.Fprintf(out, "  error: %s\n", run.GetError())
+	}
+}
+
+// printArchives writes the provided archives.
+func printArchives(out io.Writer, archives []*controlpb.Archive) error {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ARCHIVE\tSIZE\tUPLOADED")
+	for _, archive := range archives {
+		fmt.Fprintf(w, "%s\t%s\t%s\n", archive.GetKey(), humanize.IBytes(uint64(archive.GetSize())),
+			formatTimestamp(archive.GetModified()))
+	}
+
+	return w.Flush()
+}
+
+// runCtlCommand controls a running instance through its gRPC control service.
+func runCtlCommand(cfg *Config, args []string, out io.Writer) error {
+	fs := flag.NewFlagSet("ctl", flag.ContinueOnError)
+	addr := fs.String("addr", ctlAddress(cfg), "Address of the control service (defaults to the local grpcaddr)")
+	token := fs.String("token", cfg.APIToken, "Bearer token of the control service (defaults to apitoken)")
+	useTLS := fs.Bool("tls", cfg.GRPCCert != "", "Connect with TLS")
+	err := fs.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	if fs.NArg() == 0 {
+		return errors.New("ctl command required (run, status, list, prune, restore)")
+	}
+
+	if *addr == "" {
+		return errors.New("no control service address (-addr or grpcaddr)")
+	}
+
+	transport := insecure.NewCredentials()
+	if *useTLS {
+		transport = grpccreds.NewTLS(&tls.Config{MinVersion: tls.VersionTLS12})
+	}
+
+	conn, err := grpc.NewClient(*addr, grpc.WithTransportCredentials(transport))
+	if err != nil {
+		return fmt.Errorf("connecting to %s: %w", *addr, err)
+	}
+	defer conn.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), ctlTimeout)
+	defer cancel()
+	ctx = metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer "+*token)
+
+	return runCtl(ctx, controlpb.NewControlClient(conn), fs.Args(), out)
+}
+
+// runCtl executes the provided control command with the provided client.
+func runCtl(ctx context.Context, client controlpb.ControlClient, args []string, out io.Writer) error {
+	fs := flag.NewFlagSet("ctl "+args[0], flag.ContinueOnError)
+	job := fs.String("job", "", "Job to control, optional when a single job is configured")
+
+	switch args[0] {
+	case "run":
+		wait := fs.Bool("wait", false, "Wait for the run to finish, failing if the run fails")
+		err := fs.Parse(args[1:])
+		if err != nil {
+			return err
+		}
+
+		resp, err := client.Run(ctx, &controlpb.RunRequest{Job: *job})
+		if err != nil {
+			return err
+		}
+
+		run := resp.GetRun()
+		for *wait && (run.GetStatus() == runQueued || run.GetStatus() == runRunning) {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(time.Second):
+			}
+
+			status, err := client.Status(ctx, &controlpb.StatusRequest{RunId: run.GetId()})
+			if err != nil {
+				return err
+			}
+			run = status.GetRun()
+		}
+
+		printRun(out, run)
+		if run.GetStatus() == runFailed {
+			return fmt.Errorf("run %s failed", run.GetId())
+		}
+		return nil
+
+	case "status":
+		runID := fs.String("run", "", "ID of a triggered run to show")
+		err := fs.Parse(args[1:])
+		if err != nil {
+			return err
+		}
+
+		resp, err := client.Status(ctx, &controlpb.StatusRequest{RunId: *runID})
+		if err != nil {
+			return err
+		}
+
+		if resp.GetRun() != nil {
+			printRun(out, resp.GetRun())
+			return nil
+		}
+
+		w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "JOB\tLAST RUN\tRESULT\tFILES\tSIZE\tNEXT RUN\tERROR")
+		for _, status := range resp.GetJobs() {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%s\t%s\t%s\n", status.GetJob(), formatTimestamp(status.GetLastRun()),
+				status.GetResult(), status.GetFiles(), humanize.IBytes(uint64(status.GetArchiveSize())),
+				formatTimestamp(status.GetNextRun()), status.GetError())
+		}
+		return w.Flush()
+
+	case "list":
+		err := fs.Parse(args[1:])
+		if err != nil {
+			return err
+		}
+
+		resp, err := client.List(ctx, &controlpb.ListRequest{Job: *job})
+		if err != nil {
+			return err
+		}
+
+		return printArchives(out, resp.GetArchives())
+
+	case "prune":
+		olderThan := fs.String("older-than", "", "Delete archives older than the duration or number of days (e.g. 30d)")
+		keep := fs.Int("keep", 0, "Number of newest archives always kept")
+		dryRun := fs.Bool("dry-run", false, "List the archives which would be deleted without deleting them")
+		err := fs.Parse(args[1:])
+		if err != nil {
+			return err
+		}
+
+		resp, err := client.Prune(ctx, &controlpb.PruneRequest{
+			Job:       *job,
+			OlderThan: *olderThan,
+			Keep:      int32(*keep),
+			DryRun:    *dryRun,
+		})
+		if err != nil {
+			return err
+		}
+
+		return printArchives(out, resp.GetDeleted())
+
+	case "restore":
+		key := fs.String("key", "", "Key of the archive to restore (defaults to the newest archive)")
+		targetDir := fs.String("target", "", "Directory on the instance's host to extract the archive into (defaults to the job's source directory)")
+		err := fs.Parse(args[1:])
+		if err != nil {
+			return err
+		}
+
+		resp, err := client.Restore(ctx, &controlpb.RestoreRequest{Job: *job, Key: *key, TargetDir: *targetDir})
+		if err != nil {
+			return err
+		}
+
+		fmt.Fprintf(out, "Restored %s: %d files, %s\n", resp.GetKey(), resp.GetFiles(), humanize.IBytes(uint64(resp.GetBytes())))
+		return nil
+
+	default:
+		return fmt.Errorf("unknown ctl command %q", args[0])
+	}
+}
@@ -0,0 +1,234 @@
+package archiver
+
+import (
+	"context"
+	"crypto/subtle"
+	_ "embed"
+	"errors"
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/dnldd/zdts3/pkg/storage"
+	"github.com/dustin/go-humanize"
+	"github.com/go-co-op/gocron/v2"
+	"github.com/rs/zerolog"
+)
+
+// dashboardArchives is the maximum number of remote archives listed per job.
+const dashboardArchives = 20
+
+// dashboardLinkExpiry is the validity of presigned download links generated by the
+// dashboard.
+const dashboardLinkExpiry = time.Hour
+
+//go:embed dashboard.html
+var dashboardHTML string
+
+// dashboardTemplate renders the dashboard page.
+var dashboardTemplate = template.Must(template.New("dashboard").Funcs(template.FuncMap{
+	"bytes": func(size int64) string { return humanize.IBytes(uint64(size)) },
+	"time":  func(t time.Time) string { return t.Local().Format(time.DateTime) },
+}).Parse(dashboardHTML))
+
+// dashboardJob is a job listed by the dashboard.
+type dashboardJob struct {
+	jobStatus
+	Bucket   string
+	Archives []storage.Object
+	Error    string
+}
+
+// dashboardPage is the data of the dashboard page.
+type dashboardPage struct {
+	Version string
+	Jobs    []dashboardJob
+	History []historyEntry
+	Message string
+	Link    string
+}
+
+// dashboard is an embedded web UI showing the run history, the next scheduled runs and the
+// remote archives of every job, which can trigger runs and generate presigned download
+// links of archives.
+type dashboard struct {
+	s        gocron.Scheduler
+	tracker  *statusTracker
+	history  *runHistory
+	jobs     *jobResolver
+	username string
+	password string
+	logger   *zerolog.Logger
+}
+
+// newDashboard creates the dashboard of the jobs of the provided scheduler. The provided
+// function returns the active configuration, which changes on reloads. The run history is
+// optional. The dashboard requires HTTP basic authentication with the provided credentials.
+func newDashboard(s gocron.Scheduler, tracker *statusTracker, history *runHistory, config func() *Config, username string, password string, logger *zerolog.Logger) *dashboard {
+	return &dashboard{
+		s:        s,
+		tracker:  tracker,
+		history:  history,
+		jobs:     newJobResolver(config, logger),
+		username: username,
+		password: password,
+		logger:   logger,
+	}
+}
+
+// page returns the data of the dashboard page.
+func (d *dashboard) page(ctx context.Context) *dashboardPage {
+	page := &dashboardPage{Version: getBuildInfo().Version}
+
+	for _, status := range d.tracker.status(d.s) {
+		job := dashboardJob{jobStatus: status}
+
+		jobCfg, s3Cfg, err := d.jobs.job(status.Job)
+		if err == nil {
+			job.Bucket = jobCfg.Bucket
+			archives, err := listArchives(ctx, s3Cfg)
+			if err != nil {
+				job.Error = err.Error()
+			}
+			if len(archives) > dashboardArchives {
+				archives = archives[:dashboardArchives]
+			}
+			job.Archives = archives
+		}
+
+		page.Jobs = append(page.Jobs, job)
+	}
+
+	if d.history != nil {
+		history, err := d.history.list(ctx, "", defaultHistoryLimit)
+		if err != nil {
+			d.logger.Error().Err(err).Msg("Listing run history")
+		}
+		page.History = history
+	}
+
+	return page
+}
+
+// render writes the dashboard page with the provided message and download link.
+func (d *dashboard) render(w http.ResponseWriter, r *http.Request, message string, link string) {
+	page := d.page(r.Context())
+	page.Message = message
+	page.Link = link
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	err := dashboardTemplate.Execute(w, page)
+	if err != nil {
+		d.logger.Error().Err(err).Msg("Rendering dashboard")
+	}
+}
+
+// authorized returns whether the provided request is authenticated. Requests are never
+// authorized without a password.
+func (d *dashboard) authorized(r *http.Request) bool {
+	if d.password == "" {
+		return false
+	}
+
+	username, password, ok := r.BasicAuth()
+	userMatch := subtle.ConstantTimeCompare([]byte(username), []byte(d.username)) == 1
+	passwordMatch := subtle.ConstantTimeCompare([]byte(password), []byte(d.password)) == 1
+
+	return ok && userMatch && passwordMatch
+}
+
+// sameOrigin returns whether the provided request was sent by a page of the dashboard,
+// rejecting forms submitted by other sites with the browser's credentials.
+func sameOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return r.Header.Get("Sec-Fetch-Site") != "cross-site"
+	}
+
+	u, err := url.Parse(origin)
+	return err == nil && u.Host == r.Host
+}
+
+// protect wraps the provided handler with the authentication and origin checks.
+func (d *dashboard) protect(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !d.authorized(r) {
+			w.Header().Set("WWW-Authenticate", `Basic realm="zdts3", charset="UTF-8"`)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		if r.Method == http.MethodPost && !sameOrigin(r) {
+			http.Error(w, "cross-origin request rejected", http.StatusForbidden)
+			return
+		}
+
+		next(w, r)
+	}
+}
+
+// runJob triggers an immediate run of the job named by the submitted form.
+func (d *dashboard) runJob(w http.ResponseWriter, r *http.Request) {
+	name := r.FormValue("job")
+	job := findJob(d.s, name)
+	if job == nil {
+		w.WriteHeader(http.StatusNotFound)
+		d.render(w, r, fmt.Sprintf("Unknown job %s.", name), "")
+		return
+	}
+
+	err := job.RunNow()
+	if err != nil {
+		d.logger.Error().Err(err).Str("job", name).Msg("Triggering run from dashboard")
+		d.render(w, r, fmt.Sprintf("Triggering job %s failed: %s", name, err), "")
+		return
+	}
+
+	d.logger.Info().Str("job", name).Msg("Triggered run from dashboard")
+	d.render(w, r, fmt.Sprintf("Triggered a run of job %s.", name), "")
+}
+
+// presign generates a presigned download link of the archive named by the submitted form.
+func (d *dashboard) presign(w http.ResponseWriter, r *http.Request) {
+	name := r.FormValue("job")
+	key := r.FormValue("key")
+
+	_, s3Cfg, err := d.jobs.job(name)
+	// Only archives of the job can be shared, not arbitrary objects of its bucket.
+	if err != nil || !isArchiveKey(s3Cfg, key) {
+		w.WriteHeader(http.StatusNotFound)
+		d.render(w, r, fmt.Sprintf("Unknown archive %s of job %s.", key, name), "")
+		return
+	}
+
+	store, err := s3Cfg.openStorage(r.Context())
+	if err == nil {
+		defer store.Close()
+
+		var link string
+		link, err = store.Presign(r.Context(), key, dashboardLinkExpiry)
+		if err == nil {
+			d.render(w, r, fmt.Sprintf("Download link of %s, valid for %s:", key, dashboardLinkExpiry), link)
+			return
+		}
+	}
+
+	if errors.Is(err, errors.ErrUnsupported) {
+		d.render(w, r, fmt.Sprintf("Download links of %s are not available for the storage backend.", key), "")
+		return
+	}
+
+	d.logger.Error().Err(err).Str("job", name).Str("object", key).Msg("Presigning download link")
+	d.render(w, r, fmt.Sprintf("Generating a download link of %s failed: %s", key, err), "")
+}
+
+// register registers the dashboard routes with the provided mux.
+func (d *dashboard) register(mux *http.ServeMux) {
+	mux.HandleFunc("GET /dashboard", d.protect(func(w http.ResponseWriter, r *http.Request) {
+		d.render(w, r, "", "")
+	}))
+	mux.HandleFunc("POST /dashboard/run", d.protect(d.runJob))
+	mux.HandleFunc("POST /dashboard/link", d.protect(d.presign))
+}
@@ -0,0 +1,107 @@
+package archiver
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-co-op/gocron/v2"
+	"github.com/minio/minio-go/v7"
+	"github.com/peterldowns/testy/assert"
+	"github.com/rs/zerolog"
+)
+
+func TestDashboard(t *testing.T) {
+	fake := newFakeS3(t, "test-bucket")
+	s3Cfg := fake.s3Config("test-bucket")
+	mnc, err := minio.New(s3Cfg.Endpoint, s3Cfg.Options)
+	assert.NoError(t, err)
+	ctx := context.Background()
+	for _, key := range []string{"backups/dump-20260101235000.zip", "backups/dump-20260102235000.zip", "other/secret.zip"} {
+		_, err = mnc.PutObject(ctx, "test-bucket", key, strings.NewReader("zip"), 3, minio.PutObjectOptions{})
+		assert.NoError(t, err)
+	}
+
+	s, err := gocron.NewScheduler()
+	assert.NoError(t, err)
+	defer s.Shutdown()
+
+	ran := make(chan struct{}, 1)
+	_, err = s.NewJob(gocron.DurationJob(time.Hour), gocron.NewTask(func() { ran <- struct{}{} }), gocron.WithName("db"))
+	assert.NoError(t, err)
+	s.Start()
+
+	cfg := &Config{
+		Endpoint:        s3Cfg.Endpoint,
+		AccessKeyID:     "test-accesskeyid",
+		SecretAccessKey: "test-secretaccesskey",
+		Jobs:            []jobConfig{{Name: "db", Bucket: "test-bucket", Prefix: "backups"}},
+		staticCreds:     true,
+		transport:       s3Cfg.Options.Transport,
+	}
+	logger := zerolog.Nop()
+	dash := newDashboard(s, newStatusTracker(), nil, func() *Config { return cfg }, "admin", "test-password", &logger)
+	srv := httptest.NewServer(newHealthHandler(s, dash.tracker, nil, nil, dash, nil, false))
+	defer srv.Close()
+
+	do := func(method string, path string, form url.Values, auth bool) (int, string) {
+		req, err := http.NewRequest(method, srv.URL+path, strings.NewReader(form.Encode()))
+		assert.NoError(t, err)
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		if auth {
+			req.SetBasicAuth("admin", "test-password")
+		}
+
+		resp, err := http.DefaultClient.Do(req)
+		assert.NoError(t, err)
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		assert.NoError(t, err)
+		return resp.StatusCode, string(body)
+	}
+
+	// Ensure the dashboard requires authentication.
+	status, _ := do(http.MethodGet, "/dashboard", nil, false)
+	assert.Equal(t, http.StatusUnauthorized, status)
+
+	// Ensure jobs and their archives are listed, newest first.
+	status, body := do(http.MethodGet, "/dashboard", nil, true)
+	assert.Equal(t, http.StatusOK, status)
+	newest := strings.Index(body, "backups/dump-20260102235000.zip")
+	oldest := strings.Index(body, "backups/dump-20260101235000.zip")
+	assert.True(t, newest > 0 && oldest > newest)
+	assert.False(t, strings.Contains(body, "other/secret.zip"))
+
+	// Ensure runs can be triggered.
+	status, body = do(http.MethodPost, "/dashboard/run", url.Values{"job": {"db"}}, true)
+	assert.Equal(t, http.StatusOK, status)
+	assert.True(t, strings.Contains(body, "Triggered a run of job db"))
+	select {
+	case <-ran:
+	case <-time.After(5 * time.Second):
+		t.Fatal("job did not run")
+	}
+
+	// Ensure presigned download links are only generated for archives of the job.
+	status, body = do(http.MethodPost, "/dashboard/link", url.Values{"job": {"db"}, "key": {"backups/dump-20260101235000.zip"}}, true)
+	assert.Equal(t, http.StatusOK, status)
+	assert.True(t, strings.Contains(body, "X-Amz-Signature="))
+
+	status, _ = do(http.MethodPost, "/dashboard/link", url.Values{"job": {"db"}, "key": {"other/secret.zip"}}, true)
+	assert.Equal(t, http.StatusNotFound, status)
+
+	// Ensure forms submitted by other sites are rejected.
+	req, err := http.NewRequest(http.MethodPost, srv.URL+"/dashboard/run", strings.NewReader("job=db"))
+	assert.NoError(t, err)
+	req.SetBasicAuth("admin", "test-password")
+	req.Header.Set("Origin", "https://attacker.example.com")
+	resp, err := http.DefaultClient.Do(req)
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+}
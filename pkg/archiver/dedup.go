@@ -0,0 +1,414 @@
+package archiver
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/minio/minio-go/v7"
+	"github.com/rs/zerolog"
+)
+
+const (
+	// dedupChunkSize is the average size of the content-defined chunks of deduplicated
+	// archives. Chunks are between a quarter and four times the average size.
+	dedupChunkSize = 1 << 20
+	// recipeExt is the extension of the recipes of deduplicated archives, which take the
+	// place of their zip files.
+	recipeExt = ".recipe"
+)
+
+// gearTable maps bytes to the random values of the rolling gear hash finding chunk
+// boundaries. It is fixed so identical content is always split at the same offsets.
+var gearTable = newGearTable()
+
+// newGearTable derives the gear hash values with splitmix64 from a fixed seed.
+func newGearTable() [256]uint64 {
+	var table [256]uint64
+	seed := uint64(0x7a64747333)
+	for i := range table {
+		seed += 0x9e3779b97f4a7c15
+		z := seed
+		z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+		z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+		table[i] = z ^ (z >> 31)
+	}
+
+	return table
+}
+
+// chunker splits a stream into content-defined chunks. Boundaries depend on the content
+// preceding them only, so inserting or removing bytes only changes the chunks around the
+// edit.
+type chunker struct {
+	r    io.Reader
+	min  int
+	max  int
+	mask uint64
+	buf  []byte
+	eof  bool
+}
+
+// newChunker creates a chunker of the provided stream with the provided average chunk
+// size, which must be a power of two.
+func newChunker(r io.Reader, avg int) *chunker {
+	return &chunker{
+		r:    r,
+		min:  avg / 4,
+		max:  avg * 4,
+		mask: uint64(avg - 1),
+		buf:  make([]byte, 0, avg*4),
+	}
+}
+
+// cut returns the length of the chunk at the start of the provided data.
+func (c *chunker) cut(data []byte) int {
+	if len(data) <= c.min {
+		return len(data)
+	}
+
+	var hash uint64
+	end := min(len(data), c.max)
+	for i := c.min; i < end; i++ {
+		hash = hash<<1 + gearTable[data[i]]
+		if hash&c.mask == 0 {
+			return i + 1
+		}
+	}
+
+	return end
+}
+
+// next returns the next chunk of the stream, or io.EOF after the last chunk.
+func (c *chunker) next() ([]byte, error) {
+	if !c.eof && len(c.buf) < c.max {
+		n, err := io.ReadFull(c.r, c.buf[len(c.buf):c.max])
+		c.buf = c.buf[:len(c.buf)+n]
+		switch {
+		case errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF):
+			c.eof = true
+		case err != nil:
+			return nil, err
+		}
+	}
+
+	if len(c.buf) == 0 {
+		return nil, io.EOF
+	}
+
+	n := c.cut(c.buf)
+	chunk := bytes.Clone(c.buf[:n])
+	c.buf = c.buf[:copy(c.buf, c.buf[n:])]
+
+	return chunk, nil
+}
+
+// zipMethod returns the zip method of the job's archives. Deduplicated and delta archives
+// are stored uncompressed, compressed files differ entirely after the first change and would
+// share no chunks or blocks. Their chunks and deltas are compressed instead.
+func (j *jobConfig) zipMethod() uint16 {
+	if j.Dedup || j.Delta > 0 {
+		return zip.Store
+	}
+
+	return zip.Deflate
+}
+
+// compression returns the compression rules of the job's archives. Deduplicated and delta
+// archives are stored uncompressed whatever the rules, see zipMethod.
+func (j *jobConfig) compression() []compressionRule {
+	if j.zipMethod() != zip.Deflate {
+		return nil
+	}
+
+	return j.Compression
+}
+
+// maxFileSize returns the size of the largest files archived by the job, zero if files of
+// any size are archived.
+func (j *jobConfig) maxFileSize() int64 {
+	size, err := parseSize(j.MaxFileSize)
+	if j.MaxFileSize == "" || err != nil {
+		return 0
+	}
+
+	return size
+}
+
+// zipOptions returns the options of zipping the files of the job modified since the
+// provided time.
+func (j *jobConfig) zipOptions(since time.Time) zipOptions {
+	return zipOptions{
+		Since:       since,
+		Method:      j.zipMethod(),
+		Symlinks:    j.Symlinks,
+		Dirs:        j.EmptyDirs,
+		HardLinks:   j.HardLinks,
+		Xattrs:      j.Xattrs,
+		SQLite:      j.SQLite,
+		Checksums:   j.FileChecksums,
+		MaxFileSize: j.maxFileSize(),
+		Compression: j.compression(),
+		Workers:     runtime.GOMAXPROCS(0),
+		Readers:     zipReaders,
+	}
+}
+
+// recipeChunk is a chunk of a deduplicated archive.
+type recipeChunk struct {
+	Hash string `json:"hash"`
+	Size int64  `json:"size"`
+}
+
+// archiveRecipe lists the chunks a deduplicated archive is reassembled from, in order.
+type archiveRecipe struct {
+	Size   int64         `json:"size"`
+	Chunks []recipeChunk `json:"chunks"`
+}
+
+// isRecipeKey returns whether the provided archive key is the recipe of a deduplicated
+// archive.
+func isRecipeKey(key string) bool {
+	return strings.HasSuffix(key, recipeExt)
+}
+
+// chunkKey returns the object name of the chunk with the provided hash under the provided
+// prefix. Chunks are spread over subdirectories by the first byte of their hash.
+func chunkKey(prefix string, hash string) string {
+	return path.Join(prefix, "chunks", hash[:2], hash)
+}
+
+// listChunks returns the hashes of the chunks under the provided prefix and the time they
+// were uploaded.
+func listChunks(ctx context.Context, mnc *minio.Client, bucket string, prefix string) (map[string]time.Time, error) {
+	chunks := make(map[string]time.Time)
+	opts := minio.ListObjectsOptions{Prefix: path.Join(prefix, "chunks") + "/", Recursive: true}
+	for obj := range mnc.ListObjects(ctx, bucket, opts) {
+		if obj.Err != nil {
+			return nil, fmt.Errorf("listing chunks: %w", obj.Err)
+		}
+
+		chunks[path.Base(obj.Key)] = obj.LastModified
+	}
+
+	return chunks, nil
+}
+
+// uploadDedup splits the provided zip file into content-defined chunks, uploads the
+// chunks not yet in the bucket and uploads the archive's recipe. The returned upload
+// information holds the recipe's key and the number of bytes uploaded.
+func uploadDedup(ctx context.Context, zipPath string, cfg *s3Config, logger *zerolog.Logger) (minio.UploadInfo, error) {
+	mnc, err := minio.New(cfg.Endpoint, cfg.Options)
+	if err != nil {
+		logger.Error().Err(err).Msg("Creating minio client")
+		return minio.UploadInfo{}, err
+	}
+
+	objectName := path.Join(cfg.Prefix, strings.TrimSuffix(path.Base(zipPath), ".zip")+recipeExt)
+	info, err := uploadChunks(ctx, mnc, zipPath, objectName, cfg)
+	if err != nil {
+		logger.Error().Err(err).Str("bucket", cfg.Bucket).Str("object", objectName).Msg("Uploading deduplicated archive")
+		return minio.UploadInfo{}, err
+	}
+
+	logger.Info().Str("bucket", cfg.Bucket).Str("object", objectName).Int64("size", info.Size).
+		Msg("Uploaded deduplicated archive")
+
+	// Remove the zip file after uploading.
+	err = os.Remove(zipPath)
+	if err != nil {
+		logger.Error().Err(err).Str("path", zipPath).Msg("Removing zip file")
+	}
+
+	return info, nil
+}
+
+// uploadChunks uploads the chunks of the provided zip file missing from the bucket and the
+// recipe of the archive as the provided object.
+func uploadChunks(ctx context.Context, mnc *minio.Client, zipPath string, objectName string, cfg *s3Config) (minio.UploadInfo, error) {
+	file, err := os.Open(zipPath)
+	if err != nil {
+		return minio.UploadInfo{}, err
+	}
+	defer file.Close()
+
+	existing, err := listChunks(ctx, mnc, cfg.Bucket, cfg.Prefix)
+	if err != nil {
+		return minio.UploadInfo{}, err
+	}
+
+	enc, err := zstd.NewWriter(nil)
+	if err != nil {
+		return minio.UploadInfo{}, fmt.Errorf("creating compressor: %w", err)
+	}
+	defer enc.Close()
+
+	var recipe archiveRecipe
+	var uploaded int64
+	chunks := newChunker(progressFrom(ctx).reader(file), dedupChunkSize)
+	for {
+		chunk, err := chunks.next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return minio.UploadInfo{}, fmt.Errorf("reading %s: %w", zipPath, err)
+		}
+
+		sum := sha256.Sum256(chunk)
+		hash := hex.EncodeToString(sum[:])
+		recipe.Chunks = append(recipe.Chunks, recipeChunk{Hash: hash, Size: int64(len(chunk))})
+		recipe.Size += int64(len(chunk))
+		if _, ok := existing[hash]; ok {
+			continue
+		}
+
+		data := enc.EncodeAll(chunk, nil)
+		key := chunkKey(cfg.Prefix, hash)
+		opts := minio.PutObjectOptions{ContentType: "application/zstd"}
+		cfg.Checksum.setOptions(&opts)
+		_, err = mnc.PutObject(ctx, cfg.Bucket, key, bytes.NewReader(data), int64(len(data)), opts)
+		if err != nil {
+			return minio.UploadInfo{}, fmt.Errorf("uploading chunk %s: %w", key, err)
+		}
+
+		existing[hash] = time.Now()
+		uploaded += int64(len(data))
+	}
+
+	data, err := json.Marshal(recipe)
+	if err != nil {
+		return minio.UploadInfo{}, err
+	}
+
+	opts := minio.PutObjectOptions{ContentType: "application/json"}
+	cfg.Checksum.setOptions(&opts)
+	setInstanceMetadata(&opts)
+	info, err := mnc.PutObject(ctx, cfg.Bucket, objectName, bytes.NewReader(data), int64(len(data)), opts)
+	if err != nil {
+		return minio.UploadInfo{}, fmt.Errorf("uploading recipe %s: %w", objectName, err)
+	}
+	info.Size += uploaded
+
+	return info, nil
+}
+
+// readRecipe reads the recipe with the provided key.
+func readRecipe(ctx context.Context, mnc *minio.Client, bucket string, key string) (*archiveRecipe, error) {
+	obj, err := mnc.GetObject(ctx, bucket, key, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("reading recipe %s: %w", key, err)
+	}
+	defer obj.Close()
+
+	var recipe archiveRecipe
+	err = json.NewDecoder(obj).Decode(&recipe)
+	if err != nil {
+		return nil, fmt.Errorf("reading recipe %s: %w", key, err)
+	}
+
+	return &recipe, nil
+}
+
+// downloadRecipe reassembles the deduplicated archive with the provided recipe key from its
+// chunks into the provided writer. Chunks are verified against their hashes.
+func downloadRecipe(ctx context.Context, mnc *minio.Client, bucket string, key string, w io.Writer) error {
+	recipe, err := readRecipe(ctx, mnc, bucket, key)
+	if err != nil {
+		return err
+	}
+
+	dec, err := zstd.NewReader(nil)
+	if err != nil {
+		return fmt.Errorf("creating decompressor: %w", err)
+	}
+	defer dec.Close()
+
+	prefix := path.Dir(key)
+	for _, chunk := range recipe.Chunks {
+		chunkName := chunkKey(prefix, chunk.Hash)
+		obj, err := mnc.GetObject(ctx, bucket, chunkName, minio.GetObjectOptions{})
+		if err != nil {
+			return fmt.Errorf("downloading chunk %s: %w", chunkName, err)
+		}
+
+		data, err := io.ReadAll(obj)
+		obj.Close()
+		if err != nil {
+			return fmt.Errorf("downloading chunk %s: %w", chunkName, err)
+		}
+
+		data, err = dec.DecodeAll(data, nil)
+		if err != nil {
+			return fmt.Errorf("decompressing chunk %s: %w", chunkName, err)
+		}
+
+		sum := sha256.Sum256(data)
+		if hex.EncodeToString(sum[:]) != chunk.Hash {
+			return fmt.Errorf("chunk %s is corrupted", chunkName)
+		}
+
+		_, err = w.Write(data)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// pruneChunks deletes the chunks in the provided bucket uploaded before the provided time
+// which are not referenced by the recipe of a remaining archive.
+func pruneChunks(ctx context.Context, mnc *minio.Client, cfg *s3Config, before time.Time) error {
+	archives, err := listArchives(ctx, cfg)
+	if err != nil {
+		return err
+	}
+
+	referenced := make(map[string]bool)
+	for _, archive := range archives {
+		if !isRecipeKey(archive.Key) {
+			continue
+		}
+
+		recipe, err := readRecipe(ctx, mnc, cfg.Bucket, archive.Key)
+		if err != nil {
+			return err
+		}
+
+		for _, chunk := range recipe.Chunks {
+			referenced[chunk.Hash] = true
+		}
+	}
+
+	chunks, err := listChunks(ctx, mnc, cfg.Bucket, cfg.Prefix)
+	if err != nil {
+		return err
+	}
+
+	for hash, uploaded := range chunks {
+		if referenced[hash] || !uploaded.Before(before) {
+			continue
+		}
+
+		key := chunkKey(cfg.Prefix, hash)
+		err := mnc.RemoveObject(ctx, cfg.Bucket, key, minio.RemoveObjectOptions{})
+		if err != nil {
+			return fmt.Errorf("deleting chunk %s: %w", key, err)
+		}
+	}
+
+	return nil
+}
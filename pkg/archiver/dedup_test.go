@@ -0,0 +1,151 @@
+package archiver
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/peterldowns/testy/assert"
+	"github.com/rs/zerolog"
+)
+
+// chunkData returns the chunks of the provided data.
+func chunkData(t *testing.T, data []byte, avg int) [][]byte {
+	var chunks [][]byte
+	c := newChunker(bytes.NewReader(data), avg)
+	for {
+		chunk, err := c.next()
+		if errors.Is(err, io.EOF) {
+			return chunks
+		}
+		assert.NoError(t, err)
+		chunks = append(chunks, chunk)
+	}
+}
+
+func TestChunker(t *testing.T) {
+	data := make([]byte, 256<<10)
+	rand.New(rand.NewSource(1)).Read(data)
+
+	// Ensure chunks reassemble the data and respect the size bounds.
+	chunks := chunkData(t, data, 4096)
+	assert.True(t, bytes.Equal(data, bytes.Join(chunks, nil)))
+	for _, chunk := range chunks[:len(chunks)-1] {
+		assert.True(t, len(chunk) >= 1024 && len(chunk) <= 16384)
+	}
+
+	// Ensure inserted bytes only change the chunks around the insertion.
+	edited := append(append(bytes.Clone(data[:100<<10]), "INSERT INTO users VALUES (2);"...), data[100<<10:]...)
+	seen := make(map[string]bool)
+	for _, chunk := range chunks {
+		seen[string(chunk)] = true
+	}
+
+	var shared int
+	editedChunks := chunkData(t, edited, 4096)
+	for _, chunk := range editedChunks {
+		if seen[string(chunk)] {
+			shared++
+		}
+	}
+	assert.True(t, shared >= len(editedChunks)-3)
+}
+
+func TestUploadDedup(t *testing.T) {
+	fake := newFakeS3(t, "test-bucket")
+	s3Cfg := fake.s3Config("test-bucket")
+	s3Cfg.Prefix = "db"
+	logger := zerolog.Nop()
+	ctx := context.Background()
+	mnc, err := minio.New(s3Cfg.Endpoint, s3Cfg.Options)
+	assert.NoError(t, err)
+
+	data := make([]byte, 3*dedupChunkSize)
+	rand.New(rand.NewSource(1)).Read(data)
+	write := func(name string) string {
+		zipPath := filepath.Join(t.TempDir(), name)
+		assert.NoError(t, os.WriteFile(zipPath, data, 0644))
+		return zipPath
+	}
+
+	// Ensure the recipe takes the place of the archive.
+	info, err := uploadDedup(ctx, write("dump-20250310235000.zip"), s3Cfg, &logger)
+	assert.NoError(t, err)
+	assert.Equal(t, "db/dump-20250310235000.recipe", info.Key)
+	assert.True(t, isArchiveKey(s3Cfg, info.Key))
+	assert.Equal(t, "db/dump-20250310235000.manifest.json", manifestKey(info.Key))
+
+	chunks, err := listChunks(ctx, mnc, "test-bucket", "db")
+	assert.NoError(t, err)
+	assert.True(t, len(chunks) > 1)
+	for hash := range chunks {
+		assert.False(t, isArchiveKey(s3Cfg, chunkKey("db", hash)))
+	}
+
+	// Ensure unchanged chunks are not uploaded again.
+	copy(data[len(data)-10:], "0123456789")
+	info, err = uploadDedup(ctx, write("dump-20250311235000.zip"), s3Cfg, &logger)
+	assert.NoError(t, err)
+	assert.True(t, info.Size < 4*dedupChunkSize)
+
+	recipe, err := readRecipe(ctx, mnc, "test-bucket", info.Key)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(len(data)), recipe.Size)
+
+	after, err := listChunks(ctx, mnc, "test-bucket", "db")
+	assert.NoError(t, err)
+	assert.Equal(t, len(chunks)+1, len(after))
+
+	// Ensure archives are reassembled from their chunks.
+	var buf bytes.Buffer
+	assert.NoError(t, downloadRecipe(ctx, mnc, "test-bucket", info.Key, &buf))
+	assert.True(t, bytes.Equal(data, buf.Bytes()))
+
+	// Ensure corrupted chunks are detected.
+	for hash := range after {
+		_, err := mnc.PutObject(ctx, "test-bucket", chunkKey("db", hash), strings.NewReader("corrupted"), 9, minio.PutObjectOptions{})
+		assert.NoError(t, err)
+	}
+	assert.Error(t, downloadRecipe(ctx, mnc, "test-bucket", info.Key, io.Discard))
+}
+
+func TestArchiveDedup(t *testing.T) {
+	dir := t.TempDir()
+	logger := zerolog.Nop()
+	tracker := newStatusTracker()
+	fake := newFakeS3(t, "test-bucket")
+	s3Cfg := fake.s3Config("test-bucket")
+	job := jobConfig{Name: "db", SourceDir: dir, Retention: "720h", Dedup: true}
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "db.sql"), []byte(strings.Repeat("INSERT;\n", 1000)), 0644))
+
+	// Ensure deduplicated archives are restored.
+	archive(context.Background(), job, s3Cfg, []runReporter{tracker}, &logger)
+	result := tracker.runs["db"]
+	assert.NoError(t, result.Err)
+	assert.True(t, isRecipeKey(result.Key))
+
+	target := t.TempDir()
+	_, err := restoreArchive(context.Background(), s3Cfg, result.Key, target)
+	assert.NoError(t, err)
+	data, err := os.ReadFile(filepath.Join(target, "db.sql"))
+	assert.NoError(t, err)
+	assert.Equal(t, strings.Repeat("INSERT;\n", 1000), string(data))
+
+	// Ensure pruning deletes the chunks of pruned archives.
+	_, err = pruneArchives(context.Background(), s3Cfg, time.Now().Add(time.Hour), 0, false)
+	assert.NoError(t, err)
+
+	mnc, err := minio.New(s3Cfg.Endpoint, s3Cfg.Options)
+	assert.NoError(t, err)
+	chunks, err := listChunks(context.Background(), mnc, "test-bucket", "")
+	assert.NoError(t, err)
+	assert.Equal(t, 0, len(chunks))
+}
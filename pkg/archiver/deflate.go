@@ -0,0 +1,196 @@
+package archiver
+
+import (
+	"archive/zip"
+	"bytes"
+	"hash/crc32"
+	"io"
+	"math"
+	"sync"
+
+	"github.com/klauspost/compress/flate"
+)
+
+const (
+	// deflateBlockSize is the size of the blocks files are split into to be compressed in
+	// parallel. Smaller files are compressed by the zip writer.
+	deflateBlockSize = 1 << 20
+	// deflateDictSize is the window size of deflate. Blocks are compressed with the end of
+	// the preceding block as their dictionary, so matches span block boundaries.
+	deflateDictSize = 32 << 10
+	// zipDataDescriptor is the zip header flag of entries followed by their sizes and
+	// checksum.
+	zipDataDescriptor = 0x8
+)
+
+var (
+	// deflateBlocks are the buffers of the blocks being compressed.
+	deflateBlocks = newBufferPool(deflateBlockSize)
+	// deflateOutputs are the buffers of compressed blocks waiting to be written.
+	deflateOutputs = sync.Pool{New: func() any { return new(bytes.Buffer) }}
+	// deflateWriters are the compressors of blocks, which are expensive to allocate.
+	deflateWriters sync.Pool
+)
+
+// deflatedBlock is a block compressed by a worker.
+type deflatedBlock struct {
+	data *bytes.Buffer
+	err  error
+}
+
+// deflateBlock compresses the provided block with the provided dictionary into the provided
+// buffer. The compressed block is flushed to a byte boundary without ending the stream, so
+// blocks are concatenated into a single deflate stream.
+func deflateBlock(buf *bytes.Buffer, block []byte, dict []byte) error {
+	w, ok := deflateWriters.Get().(*flate.Writer)
+	if ok {
+		w.ResetDict(buf, dict)
+	} else {
+		var err error
+		w, err = flate.NewWriterDict(buf, flate.DefaultCompression, dict)
+		if err != nil {
+			return err
+		}
+	}
+	defer deflateWriters.Put(w)
+
+	_, err := w.Write(block)
+	if err != nil {
+		return err
+	}
+
+	return w.Flush()
+}
+
+// parallelDeflate compresses the provided stream into the provided writer as a deflate
+// stream, compressing up to the provided number of blocks concurrently. It returns the
+// CRC-32 checksum and the size of the stream.
+func parallelDeflate(w io.Writer, r io.Reader, workers int) (uint32, int64, error) {
+	crc := crc32.NewIEEE()
+	var size int64
+	var pending []chan deflatedBlock
+	var dict []byte
+
+	// flush writes the oldest pending block, keeping the blocks in order.
+	flush := func() error {
+		block := <-pending[0]
+		pending = pending[1:]
+		defer func() {
+			block.data.Reset()
+			deflateOutputs.Put(block.data)
+		}()
+		if block.err != nil {
+			return block.err
+		}
+
+		_, err := block.data.WriteTo(w)
+		return err
+	}
+
+	var err error
+	for {
+		buf := deflateBlocks.get()
+		n, readErr := io.ReadFull(r, *buf)
+		block := (*buf)[:n]
+		if n > 0 {
+			crc.Write(block)
+			size += int64(n)
+
+			// The dictionary is copied, the block is reused once it is compressed.
+			done := make(chan deflatedBlock, 1)
+			pending = append(pending, done)
+			blockDict := dict
+			dict = bytes.Clone(block[max(0, n-deflateDictSize):])
+			go func() {
+				data := deflateOutputs.Get().(*bytes.Buffer)
+				err := deflateBlock(data, block, blockDict)
+				deflateBlocks.put(buf)
+				done <- deflatedBlock{data: data, err: err}
+			}()
+
+			if len(pending) >= workers {
+				err = flush()
+				if err != nil {
+					break
+				}
+			}
+		} else {
+			deflateBlocks.put(buf)
+		}
+
+		if readErr == io.EOF || readErr == io.ErrUnexpectedEOF {
+			break
+		}
+		if readErr != nil {
+			err = readErr
+			break
+		}
+	}
+
+	// Wait for the remaining blocks, even after an error, so no worker is left behind.
+	for len(pending) > 0 {
+		flushErr := flush()
+		if err == nil {
+			err = flushErr
+		}
+	}
+	if err != nil {
+		return 0, 0, err
+	}
+
+	// End the stream with an empty final block.
+	end, err := flate.NewWriter(w, flate.DefaultCompression)
+	if err != nil {
+		return 0, 0, err
+	}
+	err = end.Close()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return crc.Sum32(), size, nil
+}
+
+// addDeflated adds the provided content to the zip as the provided entry, compressing it
+// on the zipper's workers. It returns the size of the content.
+func (z *dirZipper) addDeflated(header *zip.FileHeader, content io.Reader) (int64, error) {
+	// The sizes and checksum follow the content, they are only known once it is written.
+	header.Flags |= zipDataDescriptor
+	markUTF8(header)
+	header.CompressedSize64, header.UncompressedSize64 = 0, 0
+	w, err := z.w.CreateRaw(header)
+	if err != nil {
+		return 0, err
+	}
+
+	counter := &countingWriter{w: w}
+	sum, size, err := parallelDeflate(counter, content, z.opts.Workers)
+	if err != nil {
+		return size, err
+	}
+
+	header.CRC32 = sum
+	header.CompressedSize64 = uint64(counter.n)
+	header.UncompressedSize64 = uint64(size)
+	header.CompressedSize = uint32(min(header.CompressedSize64, math.MaxUint32))
+	header.UncompressedSize = uint32(min(header.UncompressedSize64, math.MaxUint32))
+	if header.CompressedSize64 >= math.MaxUint32 || header.UncompressedSize64 >= math.MaxUint32 {
+		// Zip64 extensions require version 4.5.
+		header.ReaderVersion = 45
+	}
+
+	return size, nil
+}
+
+// countingWriter counts the bytes written to the wrapped writer.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+// Write writes to the wrapped writer.
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,74 @@
+package archiver
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/flate"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/peterldowns/testy/assert"
+	"github.com/rs/zerolog"
+)
+
+// testDump returns a compressible dump of roughly the provided size.
+func testDump(size int) []byte {
+	var buf bytes.Buffer
+	for i := 0; buf.Len() < size; i++ {
+		fmt.Fprintf(&buf, "INSERT INTO users VALUES (%d, 'user-%d', 'user%d@example.com');\n", i, i*7, i%97)
+	}
+
+	return buf.Bytes()
+}
+
+func TestParallelDeflate(t *testing.T) {
+	for _, size := range []int{0, 100, deflateBlockSize, 5*deflateBlockSize + 123} {
+		data := testDump(size)[:size]
+
+		var buf bytes.Buffer
+		sum, n, err := parallelDeflate(&buf, bytes.NewReader(data), 4)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(size), n)
+		assert.Equal(t, crc32.ChecksumIEEE(data), sum)
+
+		// Ensure the blocks form a single deflate stream.
+		inflated, err := io.ReadAll(flate.NewReader(&buf))
+		assert.NoError(t, err)
+		assert.True(t, bytes.Equal(data, inflated))
+	}
+}
+
+func TestZipDirParallel(t *testing.T) {
+	dir := t.TempDir()
+	logger := zerolog.Nop()
+	data := testDump(5*deflateBlockSize + 123)
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "db.sql"), data, 0644))
+
+	zipPath := filepath.Join(t.TempDir(), "test.zip")
+	files, err := zipDir(context.Background(), dir, zipPath, zipOptions{Method: zip.Deflate, Workers: 4}, &logger)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(files))
+	sum := sha256.Sum256(data)
+	assert.Equal(t, hex.EncodeToString(sum[:]), files[0].SHA256)
+
+	// Ensure the parallel compression compresses.
+	info, err := os.Stat(zipPath)
+	assert.NoError(t, err)
+	assert.True(t, info.Size() < int64(len(data))/4)
+
+	// Ensure the entry is read back intact.
+	target := t.TempDir()
+	_, size, err := extractZip(zipPath, target, extractOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(len(data)), size)
+	restored, err := os.ReadFile(filepath.Join(target, "db.sql"))
+	assert.NoError(t, err)
+	assert.True(t, bytes.Equal(data, restored))
+}
@@ -0,0 +1,526 @@
+package archiver
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/minio/minio-go/v7"
+	"github.com/rs/zerolog"
+)
+
+const (
+	// deltaBlockSize is the size of the blocks of the previous archive a delta copies from.
+	deltaBlockSize = 32 << 10
+	// deltaMaxLiteral is the maximum size of the unmatched data buffered before it is
+	// written to a delta.
+	deltaMaxLiteral = 4 << 20
+	// deltaExt is the extension of delta archives.
+	deltaExt = ".delta"
+	// deltaMagic starts every delta.
+	deltaMagic = "ZDTSDLT1"
+)
+
+// Delta operations.
+const (
+	// deltaCopy copies a range of the previous archive.
+	deltaCopy = 'C'
+	// deltaInsert inserts the data following the operation.
+	deltaInsert = 'I'
+	// deltaEnd ends a delta, it is followed by the SHA-256 hash of the new archive.
+	deltaEnd = 'E'
+)
+
+// isDeltaKey returns whether the provided archive key is a delta archive.
+func isDeltaKey(key string) bool {
+	return strings.HasSuffix(key, deltaExt)
+}
+
+// deltaCacheDir returns the directory the job's last archive is kept in, the base of its
+// next delta.
+func deltaCacheDir(job jobConfig) string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		dir = os.TempDir()
+	}
+
+	return filepath.Join(dir, "zdts3", "delta", job.Name)
+}
+
+// deltaBase returns the path of the cached copy of the archive with the provided key, if
+// the job's cache holds it.
+func deltaBase(job jobConfig, key string) (string, bool) {
+	name := strings.TrimSuffix(path.Base(key), path.Ext(key)) + ".zip"
+	basePath := filepath.Join(deltaCacheDir(job), name)
+	_, err := os.Stat(basePath)
+
+	return basePath, err == nil
+}
+
+// rollingSum is the rsync rolling checksum of a window of bytes.
+type rollingSum struct {
+	a, b uint32
+	size uint32
+}
+
+// newRollingSum computes the checksum of the provided window.
+func newRollingSum(window []byte) rollingSum {
+	s := rollingSum{size: uint32(len(window))}
+	for i, c := range window {
+		s.a += uint32(c)
+		s.b += uint32(len(window)-i) * uint32(c)
+	}
+
+	return s
+}
+
+// roll moves the window by one byte.
+func (s *rollingSum) roll(out byte, in byte) {
+	s.a += uint32(in) - uint32(out)
+	s.b += s.a - s.size*uint32(out)
+}
+
+// sum returns the checksum.
+func (s *rollingSum) sum() uint32 {
+	return s.a&0xffff | s.b<<16
+}
+
+// deltaBlock is a block of the previous archive.
+type deltaBlock struct {
+	offset int64
+	hash   [sha256.Size]byte
+}
+
+// indexBlocks returns the blocks of the provided file by their rolling checksum.
+func indexBlocks(base io.Reader) (map[uint32][]deltaBlock, error) {
+	blocks := make(map[uint32][]deltaBlock)
+	block := make([]byte, deltaBlockSize)
+	for offset := int64(0); ; offset += deltaBlockSize {
+		_, err := io.ReadFull(base, block)
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			return blocks, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		sum := newRollingSum(block)
+		blocks[sum.sum()] = append(blocks[sum.sum()], deltaBlock{offset: offset, hash: sha256.Sum256(block)})
+	}
+}
+
+// deltaWriter writes the operations of a delta, merging adjacent copies.
+type deltaWriter struct {
+	w      *bufio.Writer
+	copyAt int64
+	copyN  int64
+	buf    [2 * binary.MaxVarintLen64]byte
+}
+
+// op writes an operation with the provided arguments.
+func (d *deltaWriter) op(op byte, args ...uint64) error {
+	n := 0
+	for _, arg := range args {
+		n += binary.PutUvarint(d.buf[n:], arg)
+	}
+
+	err := d.w.WriteByte(op)
+	if err != nil {
+		return err
+	}
+	_, err = d.w.Write(d.buf[:n])
+	return err
+}
+
+// flushCopy writes the pending copy.
+func (d *deltaWriter) flushCopy() error {
+	if d.copyN == 0 {
+		return nil
+	}
+
+	err := d.op(deltaCopy, uint64(d.copyAt), uint64(d.copyN))
+	d.copyN = 0
+	return err
+}
+
+// copy copies the provided range of the previous archive.
+func (d *deltaWriter) copy(offset int64, n int64) error {
+	if d.copyN > 0 && d.copyAt+d.copyN == offset {
+		d.copyN += n
+		return nil
+	}
+
+	err := d.flushCopy()
+	d.copyAt, d.copyN = offset, n
+	return err
+}
+
+// insert inserts the provided data.
+func (d *deltaWriter) insert(data []byte) error {
+	if len(data) == 0 {
+		return nil
+	}
+
+	err := d.flushCopy()
+	if err != nil {
+		return err
+	}
+
+	err = d.op(deltaInsert, uint64(len(data)))
+	if err != nil {
+		return err
+	}
+	_, err = d.w.Write(data)
+	return err
+}
+
+// writeDelta writes the delta turning the provided base file into the provided target to
+// the provided writer. The target is read as a stream, matching blocks of the base are found
+// at any offset with a rolling checksum.
+func writeDelta(base io.Reader, target io.Reader, w io.Writer) error {
+	blocks, err := indexBlocks(base)
+	if err != nil {
+		return fmt.Errorf("indexing base: %w", err)
+	}
+
+	d := &deltaWriter{w: bufio.NewWriter(w)}
+	_, err = d.w.WriteString(deltaMagic)
+	if err != nil {
+		return err
+	}
+
+	hash := sha256.New()
+	src := io.TeeReader(target, hash)
+	buf := make([]byte, 0, deltaMaxLiteral+2*deltaBlockSize)
+	var eof bool
+	var sum rollingSum
+	literal, pos, rolling := 0, 0, false
+	for {
+		// Keep a full window buffered, writing out literals to bound the buffer.
+		if !eof && len(buf)-pos < deltaBlockSize {
+			if pos-literal >= deltaMaxLiteral {
+				err := d.insert(buf[literal:pos])
+				if err != nil {
+					return err
+				}
+				literal = pos
+			}
+			if literal > 0 {
+				n := copy(buf, buf[literal:])
+				pos -= literal
+				literal = 0
+				buf = buf[:n]
+			}
+
+			n, err := io.ReadFull(src, buf[len(buf):cap(buf)])
+			buf = buf[:len(buf)+n]
+			if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+				eof = true
+			} else if err != nil {
+				return err
+			}
+		}
+
+		if len(buf)-pos < deltaBlockSize {
+			break
+		}
+
+		window := buf[pos : pos+deltaBlockSize]
+		if !rolling {
+			sum = newRollingSum(window)
+			rolling = true
+		}
+
+		if offset, ok := matchBlock(blocks, sum.sum(), window); ok {
+			err := d.insert(buf[literal:pos])
+			if err != nil {
+				return err
+			}
+			err = d.copy(offset, deltaBlockSize)
+			if err != nil {
+				return err
+			}
+
+			pos += deltaBlockSize
+			literal, rolling = pos, false
+			continue
+		}
+
+		if pos+deltaBlockSize < len(buf) {
+			sum.roll(buf[pos], buf[pos+deltaBlockSize])
+		} else {
+			rolling = false
+		}
+		pos++
+	}
+
+	err = d.insert(buf[literal:])
+	if err != nil {
+		return err
+	}
+	err = d.flushCopy()
+	if err != nil {
+		return err
+	}
+
+	err = d.w.WriteByte(deltaEnd)
+	if err != nil {
+		return err
+	}
+	_, err = d.w.Write(hash.Sum(nil))
+	if err != nil {
+		return err
+	}
+
+	return d.w.Flush()
+}
+
+// matchBlock returns the offset of the block of the previous archive matching the provided
+// window with the provided rolling checksum.
+func matchBlock(blocks map[uint32][]deltaBlock, sum uint32, window []byte) (int64, bool) {
+	candidates := blocks[sum]
+	if len(candidates) == 0 {
+		return 0, false
+	}
+
+	hash := sha256.Sum256(window)
+	for _, block := range candidates {
+		if block.hash == hash {
+			return block.offset, true
+		}
+	}
+
+	return 0, false
+}
+
+// applyDelta writes the archive described by the provided delta against the provided base
+// file to the provided writer, verifying its hash.
+func applyDelta(base io.ReaderAt, delta io.Reader, w io.Writer) error {
+	r := bufio.NewReader(delta)
+	magic := make([]byte, len(deltaMagic))
+	_, err := io.ReadFull(r, magic)
+	if err != nil || string(magic) != deltaMagic {
+		return errors.New("invalid delta")
+	}
+
+	hash := sha256.New()
+	out := io.MultiWriter(w, hash)
+	for {
+		op, err := r.ReadByte()
+		if err != nil {
+			return fmt.Errorf("reading delta: %w", err)
+		}
+
+		switch op {
+		case deltaCopy:
+			offset, err := binary.ReadUvarint(r)
+			if err != nil {
+				return fmt.Errorf("reading delta: %w", err)
+			}
+			n, err := binary.ReadUvarint(r)
+			if err != nil {
+				return fmt.Errorf("reading delta: %w", err)
+			}
+
+			_, err = copyBuffers().copy(out, io.NewSectionReader(base, int64(offset), int64(n)))
+			if err != nil {
+				return fmt.Errorf("copying from base: %w", err)
+			}
+
+		case deltaInsert:
+			n, err := binary.ReadUvarint(r)
+			if err != nil {
+				return fmt.Errorf("reading delta: %w", err)
+			}
+
+			copied, err := copyBuffers().copy(out, io.LimitReader(r, int64(n)))
+			if err == nil && copied < int64(n) {
+				err = io.ErrUnexpectedEOF
+			}
+			if err != nil {
+				return fmt.Errorf("reading delta: %w", err)
+			}
+
+		case deltaEnd:
+			expected := make([]byte, sha256.Size)
+			_, err := io.ReadFull(r, expected)
+			if err != nil {
+				return fmt.Errorf("reading delta: %w", err)
+			}
+
+			if !bytes.Equal(expected, hash.Sum(nil)) {
+				return errors.New("delta does not match its base")
+			}
+
+			return nil
+
+		default:
+			return fmt.Errorf("invalid delta operation %q", op)
+		}
+	}
+}
+
+// createDelta writes the zstd compressed delta of the provided zip file against the provided
+// base to a file next to the zip file and returns its path.
+func createDelta(basePath string, zipPath string) (string, error) {
+	base, err := os.Open(basePath)
+	if err != nil {
+		return "", err
+	}
+	defer base.Close()
+
+	target, err := os.Open(zipPath)
+	if err != nil {
+		return "", err
+	}
+	defer target.Close()
+
+	deltaPath := strings.TrimSuffix(zipPath, ".zip") + deltaExt
+	file, err := os.Create(deltaPath)
+	if err != nil {
+		return "", err
+	}
+
+	enc, err := zstd.NewWriter(file)
+	if err == nil {
+		err = writeDelta(base, target, enc)
+		err = errors.Join(err, enc.Close())
+	}
+	if err == nil {
+		err = syncFile(file)
+	}
+	err = errors.Join(err, file.Close())
+	if err != nil {
+		os.Remove(deltaPath)
+		return "", err
+	}
+
+	return deltaPath, nil
+}
+
+// cacheDeltaBase keeps the provided uploaded zip file as the base of the job's next delta,
+// replacing the previous one.
+func cacheDeltaBase(job jobConfig, zipPath string) error {
+	dir := deltaCacheDir(job)
+	err := os.RemoveAll(dir)
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(dir, 0700)
+	if err != nil {
+		return err
+	}
+
+	cached := filepath.Join(dir, filepath.Base(zipPath))
+	err = os.Rename(zipPath, cached)
+	if err == nil {
+		return nil
+	}
+
+	// The cache may be on another file system.
+	src, err := os.Open(zipPath)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := os.Create(cached)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(dst, src)
+	if err == nil {
+		err = syncFile(dst)
+	}
+	err = errors.Join(err, dst.Close())
+	if err != nil {
+		os.Remove(cached)
+		return err
+	}
+
+	return os.Remove(zipPath)
+}
+
+// uploadDelta uploads the provided zip file of a job making delta archives. Delta runs upload
+// the delta against the cached previous archive, other runs the zip file itself. The zip file
+// is kept as the base of the next delta.
+func uploadDelta(ctx context.Context, job jobConfig, plan backupPlan, zipPath string, cfg *s3Config, logger *zerolog.Logger) (minio.UploadInfo, error) {
+	mnc, err := minio.New(cfg.Endpoint, cfg.Options)
+	if err != nil {
+		logger.Error().Err(err).Msg("Creating minio client")
+		return minio.UploadInfo{}, err
+	}
+
+	uploadPath, contentType := zipPath, "application/zip"
+	if plan.Type == backupDelta {
+		basePath, _ := deltaBase(job, plan.Base)
+		uploadPath, err = createDelta(basePath, zipPath)
+		if err != nil {
+			logger.Error().Err(err).Str("path", zipPath).Msg("Creating delta")
+			return minio.UploadInfo{}, err
+		}
+		defer os.Remove(uploadPath)
+		contentType = "application/zstd"
+
+		// Only the delta is uploaded.
+		if deltaInfo, err := os.Stat(uploadPath); err == nil {
+			progressFrom(ctx).setPhase(phaseUpload, 0, deltaInfo.Size())
+		}
+	}
+
+	objectName := path.Join(cfg.Prefix, filepath.Base(uploadPath))
+	opts := minio.PutObjectOptions{
+		ContentType: contentType,
+		Progress:    progressFrom(ctx).uploadProgress(),
+	}
+	cfg.Retention.setOptions(&opts, time.Now())
+	cfg.Checksum.setOptions(&opts)
+	setInstanceMetadata(&opts)
+
+	info, err := mnc.FPutObject(ctx, cfg.Bucket, objectName, uploadPath, opts)
+	if err != nil {
+		logger.Error().Err(err).Str("bucket", cfg.Bucket).Str("object", objectName).Msg("Uploading archive")
+		return minio.UploadInfo{}, err
+	}
+
+	logger.Info().Str("bucket", cfg.Bucket).Str("object", objectName).Str("type", plan.Type).
+		Int64("size", info.Size).Msg("Uploaded archive")
+
+	err = cacheDeltaBase(job, zipPath)
+	if err != nil {
+		// The next run uploads a full archive without a base.
+		logger.Error().Err(err).Str("path", zipPath).Msg("Caching delta base")
+		os.Remove(zipPath)
+	}
+
+	return info, nil
+}
+
+// downloadDelta downloads the delta archive with the provided key and writes the archive it
+// describes against the provided base file to the provided writer.
+func downloadDelta(ctx context.Context, mnc *minio.Client, bucket string, key string, base io.ReaderAt, w io.Writer) error {
+	obj, err := mnc.GetObject(ctx, bucket, key, minio.GetObjectOptions{})
+	if err != nil {
+		return err
+	}
+	defer obj.Close()
+
+	dec, err := zstd.NewReader(obj)
+	if err != nil {
+		return err
+	}
+	defer dec.Close()
+
+	return applyDelta(base, dec, w)
+}
@@ -0,0 +1,111 @@
+package archiver
+
+import (
+	"bytes"
+	"context"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/peterldowns/testy/assert"
+	"github.com/rs/zerolog"
+)
+
+func TestDelta(t *testing.T) {
+	base := make([]byte, 4<<20)
+	rand.New(rand.NewSource(1)).Read(base)
+
+	// Edit the data: insert, overwrite and delete ranges.
+	target := bytes.Clone(base[:1<<20])
+	target = append(target, "INSERT INTO users VALUES (2);"...)
+	target = append(target, base[1<<20:2<<20]...)
+	target = append(target, bytes.Repeat([]byte{'x'}, 1000)...)
+	target = append(target, base[2<<20+1000:3<<20]...)
+	target = append(target, base[3<<20+5000:]...)
+
+	// Ensure deltas only carry the edits.
+	var delta bytes.Buffer
+	assert.NoError(t, writeDelta(bytes.NewReader(base), bytes.NewReader(target), &delta))
+	assert.True(t, delta.Len() < 4*deltaBlockSize)
+
+	// Ensure deltas reproduce the target.
+	var out bytes.Buffer
+	assert.NoError(t, applyDelta(bytes.NewReader(base), bytes.NewReader(delta.Bytes()), &out))
+	assert.True(t, bytes.Equal(target, out.Bytes()))
+
+	// Ensure deltas of unrelated data reproduce it as well.
+	unrelated := make([]byte, 100<<10)
+	rand.New(rand.NewSource(2)).Read(unrelated)
+	delta.Reset()
+	out.Reset()
+	assert.NoError(t, writeDelta(bytes.NewReader(base), bytes.NewReader(unrelated), &delta))
+	assert.NoError(t, applyDelta(bytes.NewReader(base), bytes.NewReader(delta.Bytes()), &out))
+	assert.True(t, bytes.Equal(unrelated, out.Bytes()))
+
+	// Ensure deltas applied to another base are rejected.
+	delta.Reset()
+	assert.NoError(t, writeDelta(bytes.NewReader(base), bytes.NewReader(target), &delta))
+	other := bytes.Clone(base)
+	other[0]++
+	assert.Error(t, applyDelta(bytes.NewReader(other), bytes.NewReader(delta.Bytes()), &out))
+	assert.Error(t, applyDelta(bytes.NewReader(base), strings.NewReader("garbage"), &out))
+}
+
+func TestArchiveDelta(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	t.Setenv("HOME", t.TempDir())
+
+	dir := t.TempDir()
+	logger := zerolog.Nop()
+	tracker := newStatusTracker()
+	fake := newFakeS3(t, "test-bucket")
+	s3Cfg := fake.s3Config("test-bucket")
+	job := jobConfig{Name: "db", SourceDir: dir, Retention: "720h", Delta: 1}
+
+	dump := make([]byte, 1<<20)
+	rand.New(rand.NewSource(1)).Read(dump)
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "db.sql"), dump, 0644))
+
+	// Ensure the first run uploads a full archive and caches it.
+	archive(context.Background(), job, s3Cfg, []runReporter{tracker}, &logger)
+	assert.NoError(t, tracker.runs["db"].Err)
+	full := tracker.runs["db"].Key
+	assert.True(t, strings.HasSuffix(full, ".zip"))
+	_, ok := deltaBase(job, full)
+	assert.True(t, ok)
+
+	// Ensure the next run uploads a delta against it.
+	time.Sleep(time.Second)
+	copy(dump[1000:], "UPDATE users SET name = 'b';")
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "db.sql"), dump, 0644))
+	archive(context.Background(), job, s3Cfg, []runReporter{tracker}, &logger)
+	result := tracker.runs["db"]
+	assert.NoError(t, result.Err)
+	assert.True(t, isDeltaKey(result.Key))
+	assert.True(t, result.Size < 4*deltaBlockSize)
+
+	// Ensure restores apply the delta to the full archive.
+	target := t.TempDir()
+	restored, err := restoreArchive(context.Background(), s3Cfg, result.Key, target)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{full, result.Key}, restored.Chain)
+	data, err := os.ReadFile(filepath.Join(target, "db.sql"))
+	assert.NoError(t, err)
+	assert.True(t, bytes.Equal(dump, data))
+
+	// Ensure a full archive is uploaded after the maximum number of deltas.
+	time.Sleep(time.Second)
+	archive(context.Background(), job, s3Cfg, []runReporter{tracker}, &logger)
+	assert.NoError(t, tracker.runs["db"].Err)
+	assert.True(t, strings.HasSuffix(tracker.runs["db"].Key, ".zip"))
+
+	// Ensure a full archive is uploaded when the base is not cached.
+	assert.NoError(t, os.RemoveAll(deltaCacheDir(job)))
+	time.Sleep(time.Second)
+	archive(context.Background(), job, s3Cfg, []runReporter{tracker}, &logger)
+	assert.NoError(t, tracker.runs["db"].Err)
+	assert.True(t, strings.HasSuffix(tracker.runs["db"].Key, ".zip"))
+}
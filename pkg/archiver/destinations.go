@@ -0,0 +1,248 @@
+package archiver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+	"github.com/rs/zerolog"
+)
+
+const (
+	// copyAttempts is the number of attempts of uploading an archive to an additional
+	// destination.
+	copyAttempts = 3
+	// copyRetryDelay is the delay before the first retry of a failed upload to an additional
+	// destination, doubled with every retry.
+	copyRetryDelay = 10 * time.Second
+)
+
+// destinationConfig is an additional S3 or S3-compatible bucket every archive is uploaded to,
+// e.g. an offsite copy at another provider.
+type destinationConfig struct {
+	Name            string `yaml:"name" toml:"name"`
+	Endpoint        string `yaml:"endpoint" toml:"endpoint"`
+	AccessKeyID     string `yaml:"accesskeyid" toml:"accesskeyid"`
+	SecretAccessKey string `yaml:"secretaccesskey" toml:"secretaccesskey"`
+	Bucket          string `yaml:"bucket" toml:"bucket"`
+	// Checksum is the checksum sent along uploads to the destination, the one of the bucket
+	// if empty.
+	Checksum string `yaml:"checksum,omitempty" toml:"checksum,omitempty"`
+}
+
+// validate validates the destination's access configuration.
+func (d *destinationConfig) validate() error {
+	var errs error
+	if d.Endpoint == "" || d.Bucket == "" {
+		errs = errors.Join(errs, fmt.Errorf("destination %s: endpoint and bucket required", d.Name))
+	} else if _, _, err := parseEndpoint(d.Endpoint); err != nil {
+		errs = errors.Join(errs, fmt.Errorf("destination %s: %w", d.Name, err))
+	}
+
+	if d.AccessKeyID == "" || d.SecretAccessKey == "" {
+		errs = errors.Join(errs, fmt.Errorf("destination %s: access key ID and secret access key required", d.Name))
+	}
+
+	err := validateChecksum(d.Checksum)
+	if err != nil {
+		errs = errors.Join(errs, fmt.Errorf("destination %s: %w", d.Name, err))
+	}
+
+	return errs
+}
+
+// validateDestinations validates the provided additional and fallback destinations of the
+// provided jobs. Deduplicated and delta archives are stored across several objects of their
+// bucket, so only jobs uploading plain archives can upload them to other destinations.
+func validateDestinations(destinations []destinationConfig, fallback *destinationConfig, jobs []jobConfig) error {
+	var errs error
+	names := make(map[string]bool, len(destinations))
+	for i, dest := range destinations {
+		if dest.Name == "" {
+			errs = errors.Join(errs, fmt.Errorf("destination %d: name required", i+1))
+		} else if names[dest.Name] {
+			errs = errors.Join(errs, fmt.Errorf("destination %s: duplicate name", dest.Name))
+		}
+		names[dest.Name] = true
+
+		errs = errors.Join(errs, dest.validate())
+	}
+
+	if fallback != nil {
+		errs = errors.Join(errs, fallback.validate())
+	}
+
+	if len(destinations) == 0 && fallback == nil {
+		return errs
+	}
+
+	for _, job := range jobs {
+		if job.Dedup || job.Delta > 0 {
+			errs = errors.Join(errs, fmt.Errorf("job %s: additional and fallback destinations require plain archives, not dedup or delta", job.Name))
+		}
+	}
+
+	return errs
+}
+
+// copyDestination is the access configuration of an additional destination. Copies are
+// stored under the key of the archive in the job's bucket.
+type copyDestination struct {
+	Name string
+	*s3Config
+}
+
+// copyError is the error of uploading the copies of an archive which was uploaded to its
+// bucket. It does not fail the run.
+type copyError struct {
+	err error
+}
+
+// Error returns the message of the error.
+func (e *copyError) Error() string {
+	return e.err.Error()
+}
+
+// Unwrap returns the errors of the destinations.
+func (e *copyError) Unwrap() error {
+	return e.err
+}
+
+// uploadCopies uploads the zip file at the provided path as the provided object to every
+// provided destination concurrently. Every destination is retried independently. It returns
+// the joined errors of the destinations the upload failed for.
+func uploadCopies(ctx context.Context, zipPath string, objectName string, destinations []copyDestination, logger *zerolog.Logger) error {
+	var mtx sync.Mutex
+	var errs error
+	var wg sync.WaitGroup
+	for _, dest := range destinations {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			_, err := uploadCopy(ctx, zipPath, objectName, dest, logger)
+			if err != nil {
+				mtx.Lock()
+				errs = errors.Join(errs, fmt.Errorf("destination %s: %w", dest.Name, err))
+				mtx.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	return errs
+}
+
+// uploadCopy uploads the zip file at the provided path as the provided object to the provided
+// destination, retrying failed uploads with an increasing delay.
+func uploadCopy(ctx context.Context, zipPath string, objectName string, dest copyDestination, logger *zerolog.Logger) (minio.UploadInfo, error) {
+	mnc, err := minio.New(dest.Endpoint, dest.Options)
+	if err != nil {
+		return minio.UploadInfo{}, fmt.Errorf("creating minio client: %w", err)
+	}
+
+	opts := minio.PutObjectOptions{ContentType: "application/zip"}
+	dest.Checksum.setOptions(&opts)
+	setInstanceMetadata(&opts)
+
+	delay := copyRetryDelay
+	for attempt := 1; ; attempt++ {
+		info, err := mnc.FPutObject(ctx, dest.Bucket, objectName, zipPath, opts)
+		if err == nil {
+			logger.Info().Str("destination", dest.Name).Str("bucket", dest.Bucket).Str("object", objectName).
+				Int64("size", info.Size).Msg("Uploaded zip file copy")
+			return info, nil
+		}
+
+		logger.Error().Err(err).Str("destination", dest.Name).Str("bucket", dest.Bucket).Str("object", objectName).
+			Int("attempt", attempt).Msg("Uploading zip file copy")
+		if attempt == copyAttempts {
+			return minio.UploadInfo{}, err
+		}
+
+		select {
+		case <-ctx.Done():
+			return minio.UploadInfo{}, err
+		case <-time.After(delay):
+		}
+		delay *= 2
+	}
+}
+
+// uploadFallback uploads the zip file at the provided path, which failed to upload to its
+// bucket, to the provided fallback destination. The zip file is removed once uploaded.
+func uploadFallback(ctx context.Context, zipPath string, cfg *s3Config, logger *zerolog.Logger) (minio.UploadInfo, error) {
+	objectName := path.Join(cfg.Prefix, filepath.Base(zipPath))
+	logger.Warn().Str("destination", cfg.Fallback.Name).Str("bucket", cfg.Fallback.Bucket).Str("object", objectName).
+		Msg("Uploading zip file to the fallback destination")
+
+	info, err := uploadCopy(ctx, zipPath, objectName, *cfg.Fallback, logger)
+	if err != nil {
+		return minio.UploadInfo{}, fmt.Errorf("fallback destination %s: %w", cfg.Fallback.Name, err)
+	}
+
+	err = os.Remove(zipPath)
+	if err != nil {
+		logger.Error().Err(err).Str("path", zipPath).Msg("Removing zip file")
+	}
+
+	return info, nil
+}
+
+// copyDestination returns the access configuration of the provided destination.
+func (c *Config) copyDestination(dest destinationConfig) copyDestination {
+	checksum := uploadChecksum(c.Checksum)
+	if dest.Checksum != "" {
+		checksum = uploadChecksum(dest.Checksum)
+	}
+
+	endpoint, secure := endpointHost(dest.Endpoint)
+	return copyDestination{
+		Name: dest.Name,
+		s3Config: &s3Config{
+			Endpoint: endpoint,
+			Bucket:   dest.Bucket,
+			Options: &minio.Options{
+				Creds:           credentials.NewStaticV4(dest.AccessKeyID, dest.SecretAccessKey, ""),
+				Secure:          secure,
+				Transport:       c.storageTransport(),
+				TrailingHeaders: checksum.trailingHeaders(),
+			},
+			Checksum: checksum,
+		},
+	}
+}
+
+// copyDestinations returns the access configurations of the additional destinations of the
+// configuration.
+func (c *Config) copyDestinations() []copyDestination {
+	copies := make([]copyDestination, 0, len(c.Destinations))
+	for _, dest := range c.Destinations {
+		copies = append(copies, c.copyDestination(dest))
+	}
+
+	return copies
+}
+
+// fallbackDestination returns the access configuration of the fallback destination of the
+// configuration, if any.
+func (c *Config) fallbackDestination() *copyDestination {
+	if c.Fallback == nil {
+		return nil
+	}
+
+	dest := *c.Fallback
+	if dest.Name == "" {
+		dest.Name = "fallback"
+	}
+
+	fallback := c.copyDestination(dest)
+	return &fallback
+}
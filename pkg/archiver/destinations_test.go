@@ -0,0 +1,96 @@
+package archiver
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/peterldowns/testy/assert"
+	"github.com/rs/zerolog"
+)
+
+func TestValidateDestinations(t *testing.T) {
+	dest := destinationConfig{
+		Name:            "offsite",
+		Endpoint:        "s3.example.com",
+		AccessKeyID:     "test-accesskeyid",
+		SecretAccessKey: "test-secretaccesskey",
+		Bucket:          "test-bucket",
+	}
+	jobs := []jobConfig{{Name: "db"}}
+	assert.NoError(t, validateDestinations([]destinationConfig{dest}, nil, jobs))
+	assert.NoError(t, validateDestinations(nil, nil, []jobConfig{{Name: "db", Dedup: true}}))
+
+	// Ensure destinations are complete and uniquely named.
+	incomplete := dest
+	incomplete.Bucket = ""
+	assert.Error(t, validateDestinations([]destinationConfig{incomplete}, nil, jobs))
+	assert.Error(t, validateDestinations([]destinationConfig{dest, dest}, nil, jobs))
+
+	// Ensure copies are only made of plain archives.
+	assert.Error(t, validateDestinations([]destinationConfig{dest}, nil, []jobConfig{{Name: "db", Dedup: true}}))
+	assert.Error(t, validateDestinations([]destinationConfig{dest}, nil, []jobConfig{{Name: "db", Delta: 7}}))
+}
+
+func TestUploadCopies(t *testing.T) {
+	s3 := newFakeS3(t, "test-bucket", "copy-bucket")
+	zipPath := filepath.Join(t.TempDir(), "dump-20260101000000.zip")
+	assert.NoError(t, os.WriteFile(zipPath, []byte("archive"), 0644))
+
+	cfg := s3.s3Config("test-bucket")
+	cfg.Prefix = "db"
+	cfg.Copies = []copyDestination{{Name: "offsite", s3Config: s3.s3Config("copy-bucket")}}
+
+	// Ensure the archive is uploaded to its bucket and copied under the same key.
+	logger := zerolog.Nop()
+	info, err := uploadZip(context.Background(), zipPath, cfg, &logger)
+	assert.NoError(t, err)
+	assert.Equal(t, "db/dump-20260101000000.zip", info.Key)
+	assert.NotEqual(t, nil, s3.object("test-bucket", "db/dump-20260101000000.zip"))
+	assert.Equal(t, "archive", string(s3.object("copy-bucket", "db/dump-20260101000000.zip").data))
+	_, err = os.Stat(zipPath)
+	assert.True(t, errors.Is(err, os.ErrNotExist))
+
+	// Ensure failed copies are reported without failing the upload.
+	assert.NoError(t, os.WriteFile(zipPath, []byte("archive"), 0644))
+	broken := *s3.s3Config("copy-bucket")
+	broken.Endpoint = ""
+	cfg.Copies = append(cfg.Copies, copyDestination{Name: "broken", s3Config: &broken})
+	info, err = uploadZip(context.Background(), zipPath, cfg, &logger)
+	var copyErr *copyError
+	assert.True(t, errors.As(err, &copyErr))
+	assert.True(t, strings.Contains(err.Error(), "destination broken"))
+	assert.False(t, strings.Contains(err.Error(), "destination offsite"))
+	assert.Equal(t, "db/dump-20260101000000.zip", info.Key)
+}
+
+func TestArchiveFallback(t *testing.T) {
+	dir := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "db.sql"), []byte("dump"), 0644))
+
+	// The job's bucket does not exist, failing every upload to it.
+	s3 := newFakeS3(t, "fallback-bucket")
+	cfg := s3.s3Config("test-bucket")
+	cfg.Fallback = &copyDestination{Name: "fallback", s3Config: s3.s3Config("fallback-bucket")}
+
+	// Ensure the archive is uploaded to the fallback destination and the failed upload is
+	// reported without failing the run.
+	logger := zerolog.Nop()
+	tracker := newStatusTracker()
+	job := jobConfig{Name: "db", SourceDir: dir, Retention: "24h"}
+	archive(context.Background(), job, cfg, []runReporter{tracker}, &logger)
+	result := tracker.runs["db"]
+	assert.NoError(t, result.Err)
+	assert.Equal(t, "fallback", result.Fallback)
+	assert.Equal(t, "fallback-bucket", result.Bucket)
+	assert.NotEqual(t, nil, s3.object("fallback-bucket", result.Key))
+	assert.Equal(t, 1, len(result.Errors))
+	assert.Equal(t, "upload", result.Errors[0].Stage)
+
+	report := newRunReport(&result)
+	assert.Equal(t, "fallback", report.Fallback)
+	assert.Equal(t, "fallback-bucket", report.Bucket)
+}
@@ -0,0 +1,77 @@
+package archiver
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+const (
+	// defaultDiskRatio is the expected ratio of the archive size to the size of the archived
+	// files unless configured, assuming the files do not compress.
+	defaultDiskRatio = 1.0
+	// defaultDiskMargin is the space left free on the staging filesystem unless configured.
+	defaultDiskMargin = 64 << 20
+)
+
+// diskRatio returns the job's expected ratio of the archive size to the size of the archived
+// files.
+func (j *jobConfig) diskRatio() float64 {
+	if j.DiskRatio <= 0 {
+		return defaultDiskRatio
+	}
+
+	return j.DiskRatio
+}
+
+// diskMargin returns the space the job leaves free on the staging filesystem.
+func (j *jobConfig) diskMargin() int64 {
+	margin, err := parseSize(j.DiskMargin)
+	if j.DiskMargin == "" || err != nil {
+		return defaultDiskMargin
+	}
+
+	return margin
+}
+
+// spaceNeeded returns the space the job's archive of files of the provided total size is
+// expected to take on the staging filesystem, including the margin.
+func (j *jobConfig) spaceNeeded(size int64) int64 {
+	return int64(float64(size)*j.diskRatio()) + j.diskMargin()
+}
+
+// checkDiskSpace ensures the filesystem of the provided directory has the provided space
+// available. The check is skipped where free space cannot be determined.
+func checkDiskSpace(dir string, needed int64) error {
+	free, err := freeSpace(dir)
+	if errors.Is(err, errors.ErrUnsupported) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("checking free space of %s: %w", dir, err)
+	}
+
+	if uint64(needed) > free {
+		return fmt.Errorf("insufficient disk space in %s: the archive needs an estimated %s including the margin, %s is available",
+			dir, formatSize(needed), formatSize(int64(free)))
+	}
+
+	return nil
+}
+
+// formatSize formats the provided number of bytes with a binary unit.
+func formatSize(size int64) string {
+	units := []string{"B", "KiB", "MiB", "GiB", "TiB"}
+	value := float64(size)
+	unit := 0
+	for value >= 1024 && unit < len(units)-1 {
+		value /= 1024
+		unit++
+	}
+
+	if unit == 0 {
+		return strconv.FormatInt(size, 10) + " B"
+	}
+
+	return strconv.FormatFloat(value, 'f', 1, 64) + " " + units[unit]
+}
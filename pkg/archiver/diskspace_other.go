@@ -0,0 +1,11 @@
+//go:build !linux && !darwin && !freebsd && !windows
+
+package archiver
+
+import "errors"
+
+// freeSpace returns the bytes available on the filesystem of the provided path. It is not
+// supported on this platform.
+func freeSpace(string) (uint64, error) {
+	return 0, errors.ErrUnsupported
+}
@@ -0,0 +1,17 @@
+//go:build linux || darwin || freebsd
+
+package archiver
+
+import "syscall"
+
+// freeSpace returns the bytes available to unprivileged users on the filesystem of the
+// provided path.
+func freeSpace(path string) (uint64, error) {
+	var stat syscall.Statfs_t
+	err := syscall.Statfs(path, &stat)
+	if err != nil {
+		return 0, err
+	}
+
+	return uint64(stat.Bavail) * uint64(stat.Bsize), nil
+}
@@ -0,0 +1,68 @@
+package archiver
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/peterldowns/testy/assert"
+	"github.com/rs/zerolog"
+)
+
+func TestSpaceNeeded(t *testing.T) {
+	// Ensure incompressible files and the default margin are assumed.
+	job := jobConfig{Name: "db"}
+	assert.Equal(t, int64(1000+defaultDiskMargin), job.spaceNeeded(1000))
+
+	job = jobConfig{Name: "db", DiskRatio: 0.5, DiskMargin: "1KiB"}
+	assert.Equal(t, int64(500+1024), job.spaceNeeded(1000))
+}
+
+func TestCheckDiskSpace(t *testing.T) {
+	if runtime.GOOS != "linux" && runtime.GOOS != "darwin" && runtime.GOOS != "freebsd" && runtime.GOOS != "windows" {
+		t.Skip("free space is not determined on this platform")
+	}
+
+	dir := t.TempDir()
+	assert.NoError(t, checkDiskSpace(dir, 1))
+
+	err := checkDiskSpace(dir, 1<<62)
+	assert.Error(t, err)
+	assert.True(t, strings.Contains(err.Error(), "insufficient disk space"))
+}
+
+func TestArchiveDiskSpace(t *testing.T) {
+	if runtime.GOOS != "linux" && runtime.GOOS != "darwin" && runtime.GOOS != "freebsd" && runtime.GOOS != "windows" {
+		t.Skip("free space is not determined on this platform")
+	}
+
+	dir := t.TempDir()
+	logger := zerolog.Nop()
+	tracker := newStatusTracker()
+	fake := newFakeS3(t, "test-bucket")
+	s3Cfg := fake.s3Config("test-bucket")
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "db.sql"), []byte("dump"), 0644))
+
+	// Ensure runs needing more space than available fail before zipping.
+	job := jobConfig{Name: "db", SourceDir: dir, Retention: "720h", DiskMargin: "100000000GiB"}
+	archive(context.Background(), job, s3Cfg, []runReporter{tracker}, &logger)
+	assert.Error(t, tracker.runs["db"].Err)
+
+	entries, err := os.ReadDir(dir)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(entries))
+
+	job.DiskMargin = ""
+	archive(context.Background(), job, s3Cfg, []runReporter{tracker}, &logger)
+	assert.NoError(t, tracker.runs["db"].Err)
+}
+
+func TestFormatSize(t *testing.T) {
+	assert.Equal(t, "512 B", formatSize(512))
+	assert.Equal(t, "1.5 KiB", formatSize(1536))
+	assert.Equal(t, "64.0 MiB", formatSize(64<<20))
+	assert.Equal(t, "2.0 TiB", formatSize(2<<40))
+}
@@ -0,0 +1,18 @@
+//go:build windows
+
+package archiver
+
+import "golang.org/x/sys/windows"
+
+// freeSpace returns the bytes available to the current user on the volume of the provided
+// path.
+func freeSpace(path string) (uint64, error) {
+	dir, err := windows.UTF16PtrFromString(path)
+	if err != nil {
+		return 0, err
+	}
+
+	var free uint64
+	err = windows.GetDiskFreeSpaceEx(dir, &free, nil, nil)
+	return free, err
+}
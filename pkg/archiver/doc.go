@@ -0,0 +1,23 @@
+// Package archiver implements zdts3: it zips directories, uploads the archives to S3 or
+// another storage backend, and lists, prunes and restores them.
+//
+// The zdts3 binary runs Main, which loads the configuration from the environment, command
+// line flags and config file and schedules the configured jobs. Services embedding the
+// archiving behavior instead create an Archiver from a Config and trigger runs themselves:
+//
+//	a, err := archiver.New(archiver.Config{
+//		Endpoint:        "s3.amazonaws.com",
+//		AccessKeyID:     accessKey,
+//		SecretAccessKey: secretKey,
+//		Bucket:          "backups",
+//		SourceDir:       "/var/lib/app/export",
+//	}, &logger)
+//	if err != nil {
+//		return err
+//	}
+//
+//	results, err := a.Run(ctx, "")
+//
+// Config fields hold the values of the environment variables of the same settings, jobs are
+// configured through the config file at ConfigPath.
+package archiver
@@ -0,0 +1,226 @@
+package archiver
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/dnldd/zdts3/pkg/storage"
+	"github.com/rs/zerolog"
+)
+
+// errChecksFailed is returned when checks of the doctor command failed.
+var errChecksFailed = errors.New("checks failed")
+
+const (
+	// doctorTimeout is the default maximum duration of the checks of the doctor command.
+	doctorTimeout = time.Minute
+	// doctorMaxSkew is the largest difference between the local clock and the clock of a
+	// storage the doctor command accepts. S3 rejects requests signed 15 minutes off.
+	doctorMaxSkew = 5 * time.Minute
+)
+
+// doctorCheck is the outcome of a check of the doctor command.
+type doctorCheck struct {
+	name string
+	err  error
+}
+
+// doctorReport collects the outcomes of the checks of the doctor command.
+type doctorReport struct {
+	checks []doctorCheck
+}
+
+// add records the outcome of the named check, failed if the provided error is not nil.
+func (r *doctorReport) add(name string, err error) {
+	r.checks = append(r.checks, doctorCheck{name: name, err: err})
+}
+
+// print writes the outcome of every check to the provided writer, followed by a summary. It
+// returns an error when a check failed.
+func (r *doctorReport) print(out io.Writer) error {
+	failed := 0
+	for _, check := range r.checks {
+		if check.err == nil {
+			fmt.Fprintf(out, "PASS  %s\n", check.name)
+			continue
+		}
+
+		failed++
+		fmt.Fprintf(out, "FAIL  %s: %s\n", check.name, strings.ReplaceAll(check.err.Error(), "\n", "; "))
+	}
+
+	if failed > 0 {
+		fmt.Fprintf(out, "%d of %d checks failed\n", failed, len(r.checks))
+		return fmt.Errorf("%d of %d %w", failed, len(r.checks), errChecksFailed)
+	}
+
+	fmt.Fprintf(out, "All %d checks passed\n", len(r.checks))
+	return nil
+}
+
+// runDoctorCommand checks the configuration, the source, staging and snapshot directories of
+// every job, and the endpoint, credentials, permissions and clock of every storage, and prints
+// a pass or fail report of the checks. The provided error of loading the configuration, if
+// any, is reported as a failed check, the other checks still run.
+func runDoctorCommand(cfg *Config, configErr error, args []string, out io.Writer) error {
+	fs := flag.NewFlagSet("doctor", flag.ContinueOnError)
+	timeout := fs.Duration("timeout", doctorTimeout, "Maximum duration of the checks")
+	err := fs.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	report := &doctorReport{}
+	report.add("configuration", configErr)
+	diagnose(ctx, cfg, report)
+
+	return report.print(out)
+}
+
+// diagnose runs the checks of the doctor command against the provided configuration,
+// recording their outcomes in the provided report. Every storage is checked once.
+func diagnose(ctx context.Context, cfg *Config, report *doctorReport) {
+	logger := zerolog.Nop()
+	creds := cfg.credentials(&logger)
+
+	checked := make(map[string]bool)
+	for _, job := range cfg.jobs() {
+		report.add(fmt.Sprintf("job %s: source directory %s", job.Name, job.SourceDir), checkSourceDir(job.SourceDir))
+		// Archives are zipped and staged in the source directory.
+		report.add(fmt.Sprintf("job %s: staging in %s", job.Name, job.SourceDir), checkWritableDir(job.SourceDir))
+		if job.SnapshotDir != "" {
+			report.add(fmt.Sprintf("job %s: snapshot directory %s", job.Name, job.SnapshotDir), checkWritableDir(job.SnapshotDir))
+		}
+
+		s3Cfg := cfg.s3Config(job, creds)
+		bucket := s3Cfg.Bucket + "/" + archivePrefix(s3Cfg)
+		if checked[bucket] {
+			continue
+		}
+		checked[bucket] = true
+		diagnoseStorage(ctx, "storage "+bucket, s3Cfg, report)
+	}
+
+	for _, dest := range cfg.copyDestinations() {
+		diagnoseStorage(ctx, "destination "+dest.Name, dest.s3Config, report)
+	}
+}
+
+// diagnoseStorage checks the storage of the provided access configuration, recording the
+// outcomes of its checks under the provided name in the provided report. S3 endpoints must
+// resolve and accept connections, the storage must be accessible with the configured
+// credentials, and a probe object must be put, listed and removed under the archive prefix.
+// The modification time of the probe object is compared with the local clock.
+func diagnoseStorage(ctx context.Context, name string, cfg *s3Config, report *doctorReport) {
+	if cfg.OpenStorage == nil {
+		err := checkEndpoint(ctx, cfg)
+		report.add(name+": endpoint "+cfg.Endpoint, err)
+		if err != nil {
+			return
+		}
+	}
+
+	err := checkBucket(ctx, cfg)
+	report.add(name+": credentials and access", err)
+	if err != nil {
+		return
+	}
+
+	skew, err := probePermissions(ctx, cfg)
+	report.add(name+": put, list and delete permissions", err)
+	if err != nil {
+		return
+	}
+
+	if skew > doctorMaxSkew || skew < -doctorMaxSkew {
+		err = fmt.Errorf("local clock is %s off the storage's clock, expected at most %s", skew.Round(time.Second), doctorMaxSkew)
+	}
+	report.add(name+": clock", err)
+}
+
+// checkWritableDir ensures files can be created in the provided directory.
+func checkWritableDir(dir string) error {
+	file, err := os.CreateTemp(dir, ".zdts3-doctor-*")
+	if err != nil {
+		return err
+	}
+	file.Close()
+
+	return os.Remove(file.Name())
+}
+
+// checkEndpoint ensures the S3 endpoint of the provided access configuration resolves and
+// accepts connections.
+func checkEndpoint(ctx context.Context, cfg *s3Config) error {
+	host, port, err := net.SplitHostPort(cfg.Endpoint)
+	if err != nil {
+		host, port = cfg.Endpoint, "80"
+		if cfg.Options == nil || cfg.Options.Secure {
+			port = "443"
+		}
+	}
+
+	addrs, err := net.DefaultResolver.LookupHost(ctx, host)
+	if err != nil {
+		return fmt.Errorf("resolving %s: %w", host, err)
+	}
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(host, port))
+	if err != nil {
+		return fmt.Errorf("connecting to %s (%s): %w", net.JoinHostPort(host, port), strings.Join(addrs, ", "), err)
+	}
+
+	return conn.Close()
+}
+
+// probePermissions puts a probe object under the archive prefix of the provided access
+// configuration, lists it and removes it. It returns the difference between the local
+// clock and the storage's clock, judged from the modification time of the probe object.
+func probePermissions(ctx context.Context, cfg *s3Config) (time.Duration, error) {
+	store, err := cfg.openStorage(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer store.Close()
+
+	prefix := archivePrefix(cfg)
+	key := prefix + ".zdts3-doctor-" + time.Now().UTC().Format("20060102150405")
+	err = store.Put(ctx, key, []byte("zdts3 doctor probe\n"))
+	if err != nil {
+		return 0, fmt.Errorf("putting %s: %w", key, err)
+	}
+	putAt := time.Now()
+
+	var skew time.Duration
+	files, err := store.List(ctx, prefix)
+	if err == nil {
+		i := slices.IndexFunc(files, func(file storage.Object) bool { return file.Key == key })
+		if i < 0 {
+			err = fmt.Errorf("%s not listed", key)
+		} else {
+			skew = putAt.Sub(files[i].Modified)
+		}
+	}
+
+	removeErr := store.Remove(ctx, key)
+	if removeErr != nil {
+		removeErr = fmt.Errorf("removing %s: %w", key, removeErr)
+	}
+	if err != nil {
+		err = fmt.Errorf("listing %q: %w", prefix, err)
+	}
+
+	return skew, errors.Join(err, removeErr)
+}
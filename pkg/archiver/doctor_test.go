@@ -0,0 +1,52 @@
+package archiver
+
+import (
+	"bytes"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/peterldowns/testy/assert"
+)
+
+func TestDoctorCommand(t *testing.T) {
+	fake := newFakeS3(t, "test-bucket")
+	s3Cfg := fake.s3Config("test-bucket")
+	sourceDir := t.TempDir()
+	cfg := &Config{
+		Endpoint:        s3Cfg.Endpoint,
+		AccessKeyID:     "test-accesskeyid",
+		SecretAccessKey: "test-secretaccesskey",
+		Jobs:            []jobConfig{{Name: "db", SourceDir: sourceDir, Bucket: "test-bucket"}},
+		staticCreds:     true,
+		transport:       s3Cfg.Options.Transport,
+	}
+
+	// Ensure healthy configurations pass every check, the probe object being removed.
+	var out bytes.Buffer
+	err := runCommand(cfg, []string{"doctor"}, &out)
+	assert.NoError(t, err)
+	assert.True(t, strings.Contains(out.String(), "PASS  storage test-bucket/: put, list and delete permissions"))
+	assert.True(t, strings.Contains(out.String(), "PASS  storage test-bucket/: clock"))
+	assert.True(t, strings.Contains(out.String(), "All 7 checks passed"))
+	assert.Equal(t, 0, len(fake.buckets["test-bucket"]))
+
+	// Ensure missing source directories and buckets fail their checks.
+	out.Reset()
+	cfg.Jobs[0].SourceDir = filepath.Join(sourceDir, "missing")
+	cfg.Jobs[0].Bucket = "missing-bucket"
+	err = runCommand(cfg, []string{"doctor"}, &out)
+	assert.True(t, errors.Is(err, errChecksFailed))
+	assert.True(t, strings.Contains(out.String(), "FAIL  job db: source directory"))
+	assert.True(t, strings.Contains(out.String(), "FAIL  storage missing-bucket/: credentials and access"))
+
+	// Ensure configuration errors are reported along with the other checks.
+	out.Reset()
+	cfg.Jobs[0].SourceDir = sourceDir
+	cfg.Jobs[0].Bucket = "test-bucket"
+	err = runDoctorCommand(cfg, errors.New("invalid retention"), nil, &out)
+	assert.Error(t, err)
+	assert.True(t, strings.Contains(out.String(), "FAIL  configuration: invalid retention"))
+	assert.True(t, strings.Contains(out.String(), "1 of 7 checks failed"))
+}
@@ -0,0 +1,344 @@
+package archiver
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/dustin/go-humanize"
+	"github.com/rs/zerolog"
+)
+
+// drillCheckInterval is the interval at which the restore drill interval of the active
+// configuration is checked.
+const drillCheckInterval = time.Minute
+
+// drillResult is the outcome of a restore drill of a job.
+type drillResult struct {
+	Job      string
+	Bucket   string
+	Key      string
+	Start    time.Time
+	Duration time.Duration
+	// Chain is the number of archives restored, the archive and those it builds on.
+	Chain int
+	Files int
+	Bytes int64
+	// Verified indicates the restored files were verified against the manifests of their
+	// archives, rather than only restored.
+	Verified bool
+	Err      error
+}
+
+// drillReporter is a run reporter that also reports restore drills.
+type drillReporter interface {
+	runReporter
+	// reportDrill reports the provided restore drill.
+	reportDrill(ctx context.Context, result *drillResult) error
+}
+
+// runDrill restores the newest archive of the provided job into a temporary directory and
+// verifies the restored files against the manifests of the restored archives. The
+// directory is removed afterwards.
+func runDrill(ctx context.Context, job jobConfig, cfg *s3Config) *drillResult {
+	result := &drillResult{Job: job.Name, Bucket: cfg.Bucket, Start: time.Now()}
+	defer func() { result.Duration = time.Since(result.Start) }()
+
+	archives, err := listArchives(ctx, cfg)
+	if err != nil {
+		result.Err = err
+		return result
+	}
+	if len(archives) == 0 {
+		result.Err = errors.New("no archives to restore")
+		return result
+	}
+	result.Key = archives[0].Key
+
+	dir, err := os.MkdirTemp("", "zdts3-drill-*")
+	if err != nil {
+		result.Err = fmt.Errorf("creating drill directory: %w", err)
+		return result
+	}
+	defer os.RemoveAll(dir)
+
+	restored, err := restoreArchive(ctx, cfg, result.Key, dir)
+	if err != nil {
+		result.Err = err
+		return result
+	}
+	result.Chain, result.Files, result.Bytes = len(restored.Chain), restored.Files, restored.Bytes
+
+	expected, err := chainFiles(ctx, cfg, restored.Chain)
+	if err != nil {
+		result.Err = err
+		return result
+	}
+	if expected == nil {
+		return result
+	}
+
+	result.Err = verifyRestored(dir, expected)
+	result.Verified = result.Err == nil
+	return result
+}
+
+// chainFiles returns the SHA-256 hashes of the files restored from the provided backup
+// chain by path, as recorded by the manifests of its archives. Later archives replace the
+// files of earlier ones, and the bases of delta archives are not extracted. It returns no
+// files when an archive of the chain has no manifest.
+func chainFiles(ctx context.Context, cfg *s3Config, chain []string) (map[string]string, error) {
+	store, err := cfg.openStorage(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer store.Close()
+
+	files := make(map[string]string)
+	for i, key := range chain {
+		if i+1 < len(chain) && isDeltaKey(chain[i+1]) {
+			continue
+		}
+
+		manifest, err := readStoreManifest(ctx, store, key)
+		if err != nil {
+			return nil, err
+		}
+		if manifest == nil {
+			return nil, nil
+		}
+
+		for _, file := range manifest.Files {
+			files[file.Path] = file.SHA256
+		}
+	}
+
+	return files, nil
+}
+
+// verifyRestored ensures the provided directory holds exactly the provided files, by slash
+// separated path, with the provided SHA-256 hashes. Symbolic links are hashed by their
+// target, the way they are archived.
+func verifyRestored(dir string, expected map[string]string) error {
+	var errs error
+	restored := 0
+	err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return err
+		}
+
+		name, err := entryName(dir, path, "")
+		if err != nil {
+			return err
+		}
+
+		want, ok := expected[name]
+		if !ok {
+			errs = errors.Join(errs, fmt.Errorf("%s restored but not in the manifest", name))
+			return nil
+		}
+		restored++
+
+		hash, err := hashRestored(path, entry)
+		if err != nil {
+			return err
+		}
+		if want != "" && hash != want {
+			errs = errors.Join(errs, fmt.Errorf("%s does not match its manifest checksum", name))
+		}
+
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("verifying restored files: %w", err)
+	}
+
+	if restored != len(expected) {
+		errs = errors.Join(errs, fmt.Errorf("restored %d of %d files", restored, len(expected)))
+	}
+
+	return errs
+}
+
+// hashRestored returns the hex encoded SHA-256 hash of the restored file at the provided
+// path, of its target for symbolic links.
+func hashRestored(path string, entry fs.DirEntry) (string, error) {
+	hash := sha256.New()
+	if entry.Type()&fs.ModeSymlink != 0 {
+		target, err := os.Readlink(path)
+		if err != nil {
+			return "", err
+		}
+		hash.Write([]byte(filepath.ToSlash(target)))
+		return hex.EncodeToString(hash.Sum(nil)), nil
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	_, err = io.Copy(hash, file)
+	if err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// drillJobs returns the jobs of the provided configuration to drill, the named job or every
+// job. Jobs sharing a bucket and prefix are drilled once, and jobs archiving subdirectories
+// separately are not drilled.
+func drillJobs(cfg *Config, name string) ([]jobConfig, error) {
+	var jobs []jobConfig
+	drilled := make(map[string]bool)
+	for _, job := range cfg.jobs() {
+		if name != "" && job.Name != name {
+			continue
+		}
+
+		bucket := job.Bucket + "/" + job.Prefix
+		if job.Subdirs || drilled[bucket] {
+			continue
+		}
+		drilled[bucket] = true
+
+		jobs = append(jobs, job)
+	}
+
+	if name != "" && len(jobs) == 0 {
+		return nil, fmt.Errorf("unknown job %q", name)
+	}
+
+	return jobs, nil
+}
+
+// drillSummary returns a one line, human readable summary of the provided restore drill.
+func drillSummary(result *drillResult) string {
+	instance := instanceName()
+
+	if result.Err != nil {
+		return fmt.Sprintf("zdts3 restore drill of job %s on %s failed: %s", result.Job, instance, result.Err)
+	}
+
+	verified := "restored"
+	if result.Verified {
+		verified = "restored and verified"
+	}
+
+	return fmt.Sprintf("zdts3 restore drill of job %s on %s %s %s from %d archives: %d files (%s) in %s",
+		result.Job, instance, verified, result.Key, result.Chain, result.Files,
+		humanize.IBytes(uint64(result.Bytes)), result.Duration.Round(time.Millisecond))
+}
+
+// reportDrill sends the provided restore drill to every reporter reporting restore drills.
+// Reporting failures are logged.
+func reportDrill(ctx context.Context, reporters []runReporter, result *drillResult, logger *zerolog.Logger) {
+	ctx, cancel := context.WithTimeout(ctx, reportTimeout)
+	defer cancel()
+
+	for _, reporter := range reporters {
+		drillReporter, ok := reporter.(drillReporter)
+		if !ok {
+			continue
+		}
+
+		err := drillReporter.reportDrill(ctx, result)
+		if err != nil {
+			logger.Error().Err(err).Str("reporter", reporter.name()).Msg("Reporting restore drill")
+		}
+	}
+}
+
+// runDrills drills the jobs of the active configuration every configured drill interval
+// until the context is cancelled. The first drill runs an interval after startup.
+func runDrills(ctx context.Context, active func() *Config, logger *zerolog.Logger, wg *sync.WaitGroup) {
+	defer wg.Done()
+
+	ticker := time.NewTicker(drillCheckInterval)
+	defer ticker.Stop()
+
+	last := time.Now()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+
+		case now := <-ticker.C:
+			cfg := active()
+			interval := cfg.drillInterval()
+			if interval == 0 || now.Sub(last) < interval {
+				continue
+			}
+			last = now
+
+			jobs, _ := drillJobs(cfg, "")
+			creds := cfg.credentials(logger)
+			for _, job := range jobs {
+				if ctx.Err() != nil {
+					return
+				}
+
+				result := runDrill(ctx, job, cfg.s3Config(job, creds))
+				if result.Err != nil {
+					logger.Error().Err(result.Err).Str("job", job.Name).Str("object", result.Key).Msg("Restore drill failed")
+				} else {
+					logger.Info().Str("job", job.Name).Str("object", result.Key).Int("files", result.Files).
+						Bool("verified", result.Verified).Dur("duration", result.Duration).Msg("Restore drill succeeded")
+				}
+				reportDrill(ctx, cfg.reporters(), result, logger)
+			}
+		}
+	}
+}
+
+// runDrillCommand runs a restore drill of a job, or of every job, failing when any drill
+// fails.
+func runDrillCommand(cfg *Config, args []string, out io.Writer) error {
+	fs := flag.NewFlagSet("drill", flag.ContinueOnError)
+	job := fs.String("job", "", "Job to drill (defaults to every job)")
+	err := fs.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	jobs, err := drillJobs(cfg, *job)
+	if err != nil {
+		return err
+	}
+
+	logger := zerolog.Nop()
+	creds := cfg.credentials(&logger)
+	failed := 0
+	for _, job := range jobs {
+		result := runDrill(context.Background(), job, cfg.s3Config(job, creds))
+		if result.Err != nil {
+			failed++
+			fmt.Fprintf(out, "FAILED %s: %v\n", job.Name, result.Err)
+			continue
+		}
+
+		status := "restored"
+		if result.Verified {
+			status = "verified"
+		}
+		fmt.Fprintf(out, "OK %s: %s %s from %d archives, %d files (%s)\n", job.Name, status, result.Key,
+			result.Chain, result.Files, humanize.IBytes(uint64(result.Bytes)))
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d failed restore drills", failed)
+	}
+
+	return nil
+}
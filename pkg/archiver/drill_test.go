@@ -0,0 +1,88 @@
+package archiver
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/peterldowns/testy/assert"
+)
+
+func TestDrillCommand(t *testing.T) {
+	fake := newFakeS3(t, "test-bucket")
+	s3Cfg := fake.s3Config("test-bucket")
+	full := map[string]string{"users.sql": "users", "orders.sql": "orders"}
+	incremental := map[string]string{"orders.sql": "orders 2"}
+
+	var manifest archiveManifest
+	assert.NoError(t, json.Unmarshal(manifestBytes(t, "backups/dump-20260102235000.zip", incremental), &manifest))
+	manifest.Type, manifest.Base = backupIncremental, "backups/dump-20260101235000.zip"
+	chained, err := json.Marshal(manifest)
+	assert.NoError(t, err)
+
+	putArchives(t, s3Cfg, map[string][]byte{
+		"backups/dump-20260101235000.zip":           zipBytes(t, full),
+		"backups/dump-20260101235000.manifest.json": manifestBytes(t, "backups/dump-20260101235000.zip", full),
+		"backups/dump-20260102235000.zip":           zipBytes(t, incremental),
+		"backups/dump-20260102235000.manifest.json": chained,
+		"logs/dump-20260101235000.zip":              zipBytes(t, map[string]string{"app.log": "log"}),
+	})
+
+	cfg := &Config{
+		Endpoint:        s3Cfg.Endpoint,
+		AccessKeyID:     "test-accesskeyid",
+		SecretAccessKey: "test-secretaccesskey",
+		Jobs: []jobConfig{
+			{Name: "db", SourceDir: t.TempDir(), Bucket: "test-bucket", Prefix: "backups"},
+			{Name: "logs", SourceDir: t.TempDir(), Bucket: "test-bucket", Prefix: "logs"},
+		},
+		staticCreds: true,
+		transport:   s3Cfg.Options.Transport,
+	}
+
+	// Ensure the newest archive is restored along with its chain and verified against the
+	// manifests, archives without a manifest are only restored.
+	var out bytes.Buffer
+	err = runCommand(cfg, []string{"drill"}, &out)
+	assert.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	assert.Equal(t, 2, len(lines))
+	assert.True(t, strings.HasPrefix(lines[0], "OK db: verified backups/dump-20260102235000.zip from 2 archives, 3 files ("))
+	assert.True(t, strings.HasPrefix(lines[1], "OK logs: restored logs/dump-20260101235000.zip from 1 archives, 1 files ("))
+
+	// Ensure restored files not matching their manifest fail the drill.
+	putArchives(t, s3Cfg, map[string][]byte{
+		"backups/dump-20260102235000.zip": zipBytes(t, map[string]string{"orders.sql": "tampered"}),
+	})
+
+	out.Reset()
+	err = runCommand(cfg, []string{"drill", "-job", "db"}, &out)
+	assert.Error(t, err)
+	assert.Equal(t, "FAILED db: orders.sql does not match its manifest checksum\n", out.String())
+
+	err = runCommand(cfg, []string{"drill", "-job", "missing"}, &out)
+	assert.Error(t, err)
+}
+
+func TestDrillMetrics(t *testing.T) {
+	start := time.Date(2026, time.January, 2, 3, 0, 0, 0, time.UTC)
+	result := &drillResult{Job: "db", Start: start, Duration: 2 * time.Second, Files: 3}
+
+	// Ensure successful drills record their success time.
+	metrics := string(newStatsd("localhost:8125", "", nil).drillMetrics(result))
+	assert.True(t, strings.Contains(metrics, "zdts3.drill.success:1|c|#job:db\n"))
+	assert.True(t, strings.Contains(metrics, "zdts3.last_drill_success_timestamp:1767322802|g|#job:db\n"))
+
+	metrics = string(newPushgateway("http://localhost:9091").drillMetrics(result))
+	assert.True(t, strings.Contains(metrics, "zdts3_last_drill_success 1\n"))
+	assert.True(t, strings.Contains(metrics, "zdts3_last_drill_files 3\n"))
+
+	// Ensure failed drills leave the last success time untouched.
+	result.Err = errors.New("restore failed")
+	metrics = string(newPushgateway("http://localhost:9091").drillMetrics(result))
+	assert.True(t, strings.Contains(metrics, "zdts3_last_drill_success 0\n"))
+	assert.False(t, strings.Contains(metrics, "zdts3_last_drill_success_timestamp_seconds"))
+}
@@ -0,0 +1,149 @@
+package archiver
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// defaultDumpFile is the file name template of database dumps when none is configured.
+const defaultDumpFile = "{{.Job}}-{{.Timestamp}}.sql"
+
+// dumpConfig is the configuration of the database dump stage of a job, which dumps a
+// database into the source directory right before it is zipped.
+type dumpConfig struct {
+	// Command is the template of the shell command writing the dump to its standard output,
+	// e.g. pg_dump or mysqldump.
+	Command string `yaml:"command" toml:"command"`
+	// File is the template of the dump's file name in the source directory.
+	File string `yaml:"file,omitempty" toml:"file,omitempty"`
+}
+
+// dumpVars are the values available to dump templates.
+type dumpVars struct {
+	Job       string
+	SourceDir string
+	Timestamp string
+	Date      string
+	File      string
+}
+
+// renderDumpTemplate renders the provided dump template with the provided values.
+func renderDumpTemplate(name string, text string, vars dumpVars) (string, error) {
+	tmpl, err := template.New(name).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return "", fmt.Errorf("parsing dump %s template: %w", name, err)
+	}
+
+	var buf bytes.Buffer
+	err = tmpl.Execute(&buf, vars)
+	if err != nil {
+		return "", fmt.Errorf("rendering dump %s template: %w", name, err)
+	}
+
+	return buf.String(), nil
+}
+
+// fileTemplate returns the file name template of the dump.
+func (d *dumpConfig) fileTemplate() string {
+	if d.File == "" {
+		return defaultDumpFile
+	}
+
+	return d.File
+}
+
+// render renders the dump's file name and command for a run of the provided job started at
+// the provided time.
+func (d *dumpConfig) render(job jobConfig, now time.Time) (string, string, error) {
+	vars := dumpVars{
+		Job:       job.Name,
+		SourceDir: job.SourceDir,
+		Timestamp: now.Format("20060102150405"),
+		Date:      now.Format(time.DateOnly),
+	}
+
+	file, err := renderDumpTemplate("file", d.fileTemplate(), vars)
+	if err != nil {
+		return "", "", err
+	}
+
+	// Dumps are archived with the source directory, they must be written into it.
+	if !filepath.IsLocal(file) {
+		return "", "", fmt.Errorf("dump file %q is not within the source directory", file)
+	}
+	vars.File = file
+
+	command, err := renderDumpTemplate("command", d.Command, vars)
+	if err != nil {
+		return "", "", err
+	}
+
+	return file, command, nil
+}
+
+// validate ensures that the dump configuration is valid.
+func (d *dumpConfig) validate() error {
+	if strings.TrimSpace(d.Command) == "" {
+		return errors.New("dump command required")
+	}
+
+	_, _, err := d.render(jobConfig{Name: "validate"}, time.Now())
+	return err
+}
+
+// runDump dumps the database of the provided job into its source directory, returning the
+// path of the dump. The standard output of the dump command is written to the dump file, its
+// standard error is captured in the run log. Partial dumps of failed commands are removed.
+func runDump(ctx context.Context, job jobConfig, now time.Time, logger *zerolog.Logger) (string, error) {
+	file, command, err := job.Dump.render(job, now)
+	if err != nil {
+		return "", err
+	}
+
+	dumpPath := filepath.Join(job.SourceDir, file)
+	err = os.MkdirAll(filepath.Dir(dumpPath), 0755)
+	if err != nil {
+		return "", fmt.Errorf("creating dump directory: %w", err)
+	}
+
+	out, err := os.Create(dumpPath)
+	if err != nil {
+		return "", fmt.Errorf("creating dump file: %w", err)
+	}
+
+	var stderr bytes.Buffer
+	cmd := hookCommand(ctx, command)
+	cmd.Dir = job.SourceDir
+	cmd.Env = hookEnv(job, &runResult{})
+	cmd.Stdout = out
+	cmd.Stderr = &stderr
+
+	start := time.Now()
+	err = cmd.Run()
+	err = errors.Join(err, out.Close())
+	if err != nil {
+		os.Remove(dumpPath)
+		logger.Error().Err(err).Str("output", strings.TrimRight(stderr.String(), "\r\n")).Msg("Dumping database")
+		return "", fmt.Errorf("dumping database: %w", err)
+	}
+
+	var size int64
+	info, err := os.Stat(dumpPath)
+	if err == nil {
+		size = info.Size()
+	}
+
+	logger.Info().Str("path", dumpPath).Int64("size", size).Dur("took", time.Since(start)).
+		Str("output", strings.TrimRight(stderr.String(), "\r\n")).Msg("Dumped database")
+
+	return dumpPath, nil
+}
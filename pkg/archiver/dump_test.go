@@ -0,0 +1,95 @@
+package archiver
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/peterldowns/testy/assert"
+	"github.com/rs/zerolog"
+)
+
+func TestDumpRender(t *testing.T) {
+	now := time.Date(2025, 3, 10, 23, 50, 0, 0, time.UTC)
+	job := jobConfig{Name: "db", SourceDir: "/dumps/db"}
+
+	// Ensure the default file name embeds the job and the run time.
+	dump := dumpConfig{Command: "pg_dump -Fc app --file-hint {{.File}}"}
+	file, command, err := dump.render(job, now)
+	assert.NoError(t, err)
+	assert.Equal(t, "db-20250310235000.sql", file)
+	assert.Equal(t, "pg_dump -Fc app --file-hint db-20250310235000.sql", command)
+
+	// Ensure custom file names are rendered.
+	dump.File = "{{.Date}}/app.dump"
+	file, _, err = dump.render(job, now)
+	assert.NoError(t, err)
+	assert.Equal(t, "2025-03-10/app.dump", file)
+
+	// Ensure invalid dump configurations are rejected.
+	assert.Error(t, (&dumpConfig{}).validate())
+	assert.Error(t, (&dumpConfig{Command: "pg_dump {{.Database}}"}).validate())
+	assert.Error(t, (&dumpConfig{Command: "pg_dump {{"}).validate())
+	assert.Error(t, (&dumpConfig{Command: "pg_dump", File: "../escape.sql"}).validate())
+	assert.NoError(t, (&dumpConfig{Command: "mysqldump app", File: "app.sql"}).validate())
+}
+
+func TestRunDump(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("dump commands are POSIX shell scripts")
+	}
+
+	dir := t.TempDir()
+	logger := zerolog.Nop()
+	now := time.Date(2025, 3, 10, 23, 50, 0, 0, time.UTC)
+
+	// Ensure the command's output is written to the dump file.
+	job := jobConfig{Name: "db", SourceDir: dir, Dump: &dumpConfig{Command: "echo 'CREATE TABLE {{.Job}};'"}}
+	path, err := runDump(context.Background(), job, now, &logger)
+	assert.NoError(t, err)
+	assert.Equal(t, filepath.Join(dir, "db-20250310235000.sql"), path)
+
+	data, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, "CREATE TABLE db;\n", string(data))
+
+	// Ensure partial dumps of failed commands are removed.
+	job.Dump = &dumpConfig{Command: "echo partial; exit 2", File: "failed.sql"}
+	_, err = runDump(context.Background(), job, now, &logger)
+	assert.Error(t, err)
+
+	_, err = os.Stat(filepath.Join(dir, "failed.sql"))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestArchiveDump(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("dump commands are POSIX shell scripts")
+	}
+
+	dir := t.TempDir()
+	logger := zerolog.Nop()
+	tracker := newStatusTracker()
+	s3 := newFakeS3(t, "test-bucket")
+
+	// Ensure the dump is archived.
+	job := jobConfig{Name: "db", SourceDir: dir, Retention: "24h", Dump: &dumpConfig{Command: "echo dump", File: "db.sql"}}
+	archive(context.Background(), job, s3.s3Config("test-bucket"), []runReporter{tracker}, &logger)
+	result := tracker.runs["db"]
+	assert.NoError(t, result.Err)
+
+	var dumped bool
+	for _, file := range result.Contents {
+		dumped = dumped || file.Path == "db.sql"
+	}
+	assert.True(t, dumped)
+
+	// Ensure a failed dump fails the run before anything is uploaded.
+	job.Dump.Command = "exit 1"
+	archive(context.Background(), job, s3.s3Config("test-bucket"), []runReporter{tracker}, &logger)
+	assert.Error(t, tracker.runs["db"].Err)
+	assert.Equal(t, "", tracker.runs["db"].Key)
+}
@@ -0,0 +1,24 @@
+package archiver
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// syncFile flushes the contents of the provided file and its directory entry to stable
+// storage, so a power loss can't leave a staged archive truncated or missing once uploads and
+// purges rely on it.
+func syncFile(file *os.File) error {
+	err := file.Sync()
+	if err != nil {
+		return fmt.Errorf("syncing %s: %w", file.Name(), err)
+	}
+
+	err = syncDir(filepath.Dir(file.Name()))
+	if err != nil {
+		return fmt.Errorf("syncing the directory of %s: %w", file.Name(), err)
+	}
+
+	return nil
+}
@@ -0,0 +1,25 @@
+package archiver
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/peterldowns/testy/assert"
+)
+
+func TestSyncFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dump.zip")
+	file, err := os.Create(path)
+	assert.NoError(t, err)
+	defer file.Close()
+
+	_, err = file.WriteString("zip")
+	assert.NoError(t, err)
+	assert.NoError(t, syncFile(file))
+
+	file.Close()
+	assert.Error(t, syncFile(file))
+
+	assert.NoError(t, syncDir(filepath.Dir(path)))
+}
@@ -0,0 +1,16 @@
+//go:build unix
+
+package archiver
+
+import "os"
+
+// syncDir flushes the entries of the provided directory to stable storage.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+
+	return d.Sync()
+}
@@ -0,0 +1,130 @@
+package archiver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"sync"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/rs/zerolog"
+)
+
+// electionObject is the name of the leader lease object within the lock prefix.
+const electionObject = "leader.election"
+
+// errNotLeader is returned when this instance is not the elected leader.
+var errNotLeader = errors.New("not the elected leader")
+
+// s3Elector is a gocron distributed elector backed by a leader lease object in an S3 bucket.
+// The instance holding the lease runs the scheduled jobs while the others stay on standby,
+// taking over the lease once the leader stops refreshing it.
+type s3Elector struct {
+	locker     *s3Locker
+	mnc        *minio.Client
+	objectName string
+
+	mtx     sync.Mutex
+	etag    string
+	expires time.Time
+}
+
+// newS3Elector creates a leader elector storing its lease in the provided bucket.
+func newS3Elector(cfg *s3Config, ttl time.Duration, logger *zerolog.Logger) (*s3Elector, error) {
+	mnc, err := minio.New(cfg.Endpoint, cfg.Options)
+	if err != nil {
+		return nil, fmt.Errorf("creating minio client: %w", err)
+	}
+
+	return &s3Elector{
+		locker:     newS3Locker(cfg, ttl, logger),
+		mnc:        mnc,
+		objectName: path.Join(cfg.Prefix, lockPrefix, electionObject),
+	}, nil
+}
+
+// IsLeader returns nil if this instance holds an unexpired leader lease.
+func (e *s3Elector) IsLeader(_ context.Context) error {
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+
+	if e.etag == "" || !time.Now().Before(e.expires) {
+		return errNotLeader
+	}
+
+	return nil
+}
+
+// campaign refreshes the leader lease when leading, otherwise it attempts to acquire it.
+func (e *s3Elector) campaign(ctx context.Context) {
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+
+	logger := e.locker.logger
+
+	if e.etag != "" {
+		etag, err := e.locker.put(ctx, e.mnc, e.objectName, e.etag)
+		switch {
+		case err == nil:
+			e.etag = etag
+			e.expires = time.Now().Add(e.locker.ttl)
+			return
+
+		case isPreconditionFailed(err) || !time.Now().Before(e.expires):
+			logger.Warn().Err(err).Msg("Lost leadership")
+			e.etag = ""
+
+		default:
+			// Keep leading until the lease expires, the refresh is retried on the next round.
+			logger.Error().Err(err).Msg("Refreshing leader lease")
+			return
+		}
+	}
+
+	etag, err := e.locker.acquire(ctx, e.mnc, e.objectName)
+	if err != nil {
+		logger.Debug().Err(err).Msg("Standing by as follower")
+		return
+	}
+
+	e.etag = etag
+	e.expires = time.Now().Add(e.locker.ttl)
+	logger.Info().Str("owner", e.locker.owner).Msg("Elected leader")
+}
+
+// run campaigns for the leader lease periodically until the provided context is cancelled.
+func (e *s3Elector) run(ctx context.Context, wg *sync.WaitGroup) {
+	defer wg.Done()
+
+	e.campaign(ctx)
+
+	ticker := time.NewTicker(e.locker.ttl / 3)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+
+		case <-ticker.C:
+			e.campaign(ctx)
+		}
+	}
+}
+
+// resign gives up the leader lease so a follower can take over without waiting for it to
+// expire.
+func (e *s3Elector) resign(ctx context.Context) error {
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+
+	if e.etag == "" {
+		return nil
+	}
+
+	etag := e.etag
+	e.etag = ""
+	return e.locker.release(ctx, e.mnc, e.objectName, etag)
+}
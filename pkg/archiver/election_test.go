@@ -0,0 +1,61 @@
+package archiver
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/peterldowns/testy/assert"
+	"github.com/rs/zerolog"
+)
+
+func TestS3Elector(t *testing.T) {
+	s3 := newFakeS3(t, "test-bucket")
+	cfg := s3.s3Config("test-bucket")
+	logger := zerolog.Nop()
+	ctx := context.Background()
+
+	leader, err := newS3Elector(cfg, time.Minute, &logger)
+	assert.NoError(t, err)
+	leader.locker.owner = "leader"
+	follower, err := newS3Elector(cfg, time.Minute, &logger)
+	assert.NoError(t, err)
+	follower.locker.owner = "follower"
+
+	// Ensure an instance is not the leader before campaigning.
+	assert.Error(t, leader.IsLeader(ctx))
+
+	// Ensure only the first instance to campaign is elected.
+	leader.campaign(ctx)
+	follower.campaign(ctx)
+	assert.NoError(t, leader.IsLeader(ctx))
+	assert.Error(t, follower.IsLeader(ctx))
+
+	// Ensure the leader keeps its lease when refreshing it.
+	leader.campaign(ctx)
+	assert.NoError(t, leader.IsLeader(ctx))
+
+	// Ensure the follower takes over an expired lease and the previous leader steps down.
+	obj := s3.object("test-bucket", "locks/leader.election")
+	expired, err := json.Marshal(lockRecord{Owner: "leader", Expires: time.Now().Add(-time.Minute)})
+	assert.NoError(t, err)
+	s3.mtx.Lock()
+	obj.data = expired
+	obj.etag = `"expired"`
+	s3.mtx.Unlock()
+
+	follower.campaign(ctx)
+	assert.NoError(t, follower.IsLeader(ctx))
+
+	leader.campaign(ctx)
+	assert.Error(t, leader.IsLeader(ctx))
+
+	// Ensure resigning removes the lease so the other instance is elected.
+	assert.NoError(t, follower.resign(ctx))
+	assert.Error(t, follower.IsLeader(ctx))
+	assert.Equal(t, (*fakeObject)(nil), s3.object("test-bucket", "locks/leader.election"))
+
+	leader.campaign(ctx)
+	assert.NoError(t, leader.IsLeader(ctx))
+}
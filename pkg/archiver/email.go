@@ -0,0 +1,238 @@
+package archiver
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/smtp"
+	"strings"
+	"time"
+)
+
+// SMTP connection security modes.
+const (
+	// smtpStartTLS upgrades the connection with STARTTLS.
+	smtpStartTLS = "starttls"
+	// smtpTLS connects with implicit TLS, usually on port 465.
+	smtpTLS = "tls"
+	// smtpNone sends the mail without TLS.
+	smtpNone = "none"
+)
+
+// defaultSMTPPort is the default SMTP submission port.
+const defaultSMTPPort = "587"
+
+// emailNotifier sends run reports by email over SMTP.
+type emailNotifier struct {
+	host     string
+	port     string
+	security string
+	username string
+	password string
+	from     string
+	to       []string
+	filter   *eventFilter
+}
+
+// parseAddressList parses a comma separated list of email addresses.
+func parseAddressList(value string) []string {
+	var addresses []string
+	for _, address := range strings.Split(value, ",") {
+		address = strings.TrimSpace(address)
+		if address != "" {
+			addresses = append(addresses, address)
+		}
+	}
+
+	return addresses
+}
+
+// name returns the name of the reporter.
+func (e *emailNotifier) name() string {
+	return "email"
+}
+
+// message returns the email message reporting the provided run.
+func (e *emailNotifier) message(result *runResult) []byte {
+	status := "succeeded"
+	if result.Err != nil {
+		status = "FAILED"
+	} else if result.hasErrors() {
+		status = "completed with ERRORS"
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "From: %s\r\n", e.from)
+	fmt.Fprintf(&buf, "To: %s\r\n", strings.Join(e.to, ", "))
+	fmt.Fprintf(&buf, "Subject: zdts3 job %s %s\r\n", result.Job, status)
+	fmt.Fprintf(&buf, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	buf.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	buf.WriteString("\r\n")
+	fmt.Fprintf(&buf, "%s\r\n\r\n", runSummary(result))
+	fmt.Fprintf(&buf, "Job: %s\r\n", result.Job)
+	fmt.Fprintf(&buf, "Started: %s\r\n", result.Start.Format(time.RFC3339))
+	fmt.Fprintf(&buf, "Duration: %s\r\n", result.Duration.Round(time.Millisecond))
+	fmt.Fprintf(&buf, "Files: %d\r\n", result.Files)
+	fmt.Fprintf(&buf, "Archive size: %d bytes\r\n", result.Size)
+	if result.Err != nil {
+		fmt.Fprintf(&buf, "Error: %s\r\n", result.Err)
+	}
+	for _, stageErr := range result.Errors {
+		fmt.Fprintf(&buf, "Stage error: %s: %s\r\n", stageErr.Stage, stageErr.Err)
+	}
+
+	return buf.Bytes()
+}
+
+// dial connects to the SMTP server according to the configured security mode.
+func (e *emailNotifier) dial(ctx context.Context) (*smtp.Client, error) {
+	address := net.JoinHostPort(e.host, e.port)
+	tlsCfg := &tls.Config{ServerName: e.host}
+
+	var conn net.Conn
+	var err error
+	if e.security == smtpTLS {
+		dialer := &tls.Dialer{Config: tlsCfg}
+		conn, err = dialer.DialContext(ctx, "tcp", address)
+	} else {
+		var dialer net.Dialer
+		conn, err = dialer.DialContext(ctx, "tcp", address)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("connecting to smtp server: %w", err)
+	}
+
+	deadline, ok := ctx.Deadline()
+	if ok {
+		conn.SetDeadline(deadline)
+	}
+
+	client, err := smtp.NewClient(conn, e.host)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("creating smtp client: %w", err)
+	}
+
+	if e.security == "" || e.security == smtpStartTLS {
+		err = client.StartTLS(tlsCfg)
+		if err != nil {
+			client.Close()
+			return nil, fmt.Errorf("starting tls: %w", err)
+		}
+	}
+
+	return client, nil
+}
+
+// report mails a report of the provided run, if the run matches the configured notification
+// events.
+func (e *emailNotifier) report(ctx context.Context, result *runResult) error {
+	if !e.filter.matches(result) {
+		return nil
+	}
+
+	return e.send(ctx, e.message(result))
+}
+
+// usageMessage returns the email message reporting the provided storage usage.
+func (e *emailNotifier) usageMessage(usage *storageUsage) []byte {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "From: %s\r\n", e.from)
+	fmt.Fprintf(&buf, "To: %s\r\n", strings.Join(e.to, ", "))
+	buf.WriteString("Subject: zdts3 storage usage\r\n")
+	fmt.Fprintf(&buf, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	buf.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	buf.WriteString("\r\n")
+	buf.WriteString(strings.ReplaceAll(usageSummary(usage), "\n", "\r\n"))
+	buf.WriteString("\r\n")
+
+	return buf.Bytes()
+}
+
+// reportUsage mails a report of the provided storage usage.
+func (e *emailNotifier) reportUsage(ctx context.Context, usage *storageUsage) error {
+	return e.send(ctx, e.usageMessage(usage))
+}
+
+// drillMessage returns the email message reporting the provided restore drill.
+func (e *emailNotifier) drillMessage(result *drillResult) []byte {
+	status := "succeeded"
+	if result.Err != nil {
+		status = "FAILED"
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "From: %s\r\n", e.from)
+	fmt.Fprintf(&buf, "To: %s\r\n", strings.Join(e.to, ", "))
+	fmt.Fprintf(&buf, "Subject: zdts3 restore drill of job %s %s\r\n", result.Job, status)
+	fmt.Fprintf(&buf, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	buf.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	buf.WriteString("\r\n")
+	fmt.Fprintf(&buf, "%s\r\n\r\n", drillSummary(result))
+	fmt.Fprintf(&buf, "Job: %s\r\n", result.Job)
+	fmt.Fprintf(&buf, "Archive: %s\r\n", result.Key)
+	fmt.Fprintf(&buf, "Started: %s\r\n", result.Start.Format(time.RFC3339))
+	fmt.Fprintf(&buf, "Duration: %s\r\n", result.Duration.Round(time.Millisecond))
+	fmt.Fprintf(&buf, "Files: %d\r\n", result.Files)
+	fmt.Fprintf(&buf, "Verified: %t\r\n", result.Verified)
+	if result.Err != nil {
+		fmt.Fprintf(&buf, "Error: %s\r\n", result.Err)
+	}
+
+	return buf.Bytes()
+}
+
+// reportDrill mails a report of the provided restore drill.
+func (e *emailNotifier) reportDrill(ctx context.Context, result *drillResult) error {
+	return e.send(ctx, e.drillMessage(result))
+}
+
+// send mails the provided message to the recipients.
+func (e *emailNotifier) send(ctx context.Context, msg []byte) error {
+	client, err := e.dial(ctx)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	if e.username != "" {
+		err = client.Auth(smtp.PlainAuth("", e.username, e.password, e.host))
+		if err != nil {
+			return fmt.Errorf("authenticating to smtp server: %w", err)
+		}
+	}
+
+	err = client.Mail(e.from)
+	if err != nil {
+		return fmt.Errorf("setting sender: %w", err)
+	}
+
+	for _, to := range e.to {
+		err = client.Rcpt(to)
+		if err != nil {
+			return fmt.Errorf("adding recipient %s: %w", to, err)
+		}
+	}
+
+	w, err := client.Data()
+	if err != nil {
+		return fmt.Errorf("starting message: %w", err)
+	}
+
+	_, err = w.Write(msg)
+	if err != nil {
+		return fmt.Errorf("writing message: %w", err)
+	}
+
+	err = w.Close()
+	if err != nil {
+		return fmt.Errorf("sending message: %w", err)
+	}
+
+	return client.Quit()
+}
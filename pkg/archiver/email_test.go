@@ -0,0 +1,110 @@
+package archiver
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/peterldowns/testy/assert"
+)
+
+// serveSMTP accepts a single SMTP session on the provided listener and sends the envelope
+// recipients and message data on the returned channel.
+func serveSMTP(ln net.Listener) <-chan []string {
+	received := make(chan []string, 1)
+
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		var session []string
+		reader := bufio.NewReader(conn)
+		reply := func(line string) { conn.Write([]byte(line + "\r\n")) }
+
+		reply("220 localhost ESMTP")
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				return
+			}
+			line = strings.TrimSpace(line)
+
+			switch {
+			case strings.HasPrefix(line, "EHLO"):
+				reply("250 localhost")
+			case strings.HasPrefix(line, "MAIL FROM"):
+				reply("250 OK")
+			case strings.HasPrefix(line, "RCPT TO"):
+				session = append(session, line)
+				reply("250 OK")
+			case line == "DATA":
+				reply("354 Go ahead")
+				var data strings.Builder
+				for {
+					line, err := reader.ReadString('\n')
+					if err != nil {
+						return
+					}
+					if line == ".\r\n" {
+						break
+					}
+					data.WriteString(line)
+				}
+				session = append(session, data.String())
+				reply("250 OK")
+			case line == "QUIT":
+				reply("221 Bye")
+				received <- session
+				return
+			default:
+				reply("502 Unsupported")
+			}
+		}
+	}()
+
+	return received
+}
+
+func TestEmailNotifier(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer ln.Close()
+	received := serveSMTP(ln)
+
+	host, port, err := net.SplitHostPort(ln.Addr().String())
+	assert.NoError(t, err)
+
+	filter, err := parseEventFilter("on-failure")
+	assert.NoError(t, err)
+
+	e := &emailNotifier{
+		host:     host,
+		port:     port,
+		security: smtpNone,
+		from:     "zdts3@example.com",
+		to:       parseAddressList("ops@example.com, oncall@example.com"),
+		filter:   filter,
+	}
+	ctx := context.Background()
+
+	// Ensure runs not matching the notification events are not mailed.
+	err = e.report(ctx, &runResult{Job: "db"})
+	assert.NoError(t, err)
+
+	// Ensure failures are mailed to every recipient.
+	err = e.report(ctx, &runResult{Job: "db", Err: errors.New("upload failed")})
+	assert.NoError(t, err)
+
+	session := <-received
+	assert.Equal(t, 3, len(session))
+	assert.Equal(t, "RCPT TO:<ops@example.com>", session[0])
+	assert.Equal(t, "RCPT TO:<oncall@example.com>", session[1])
+	assert.True(t, strings.Contains(session[2], "Subject: zdts3 job db FAILED\r\n"))
+	assert.True(t, strings.Contains(session[2], "Error: upload failed\r\n"))
+}
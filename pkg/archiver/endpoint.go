@@ -0,0 +1,91 @@
+package archiver
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// parseEndpoint parses the provided storage endpoint, either a host with an optional port or
+// an http or https URL, and returns its host, with its port if any, and whether it is
+// accessed over TLS. Hosts without a scheme are accessed over TLS. IPv6 literals are
+// returned bracketed, whether or not they were.
+func parseEndpoint(endpoint string) (string, bool, error) {
+	secure := true
+	host := endpoint
+	if strings.Contains(endpoint, "://") {
+		u, err := url.Parse(endpoint)
+		if err != nil {
+			return "", false, fmt.Errorf("invalid endpoint %q: %w", endpoint, err)
+		}
+
+		switch u.Scheme {
+		case "https":
+		case "http":
+			secure = false
+		default:
+			return "", false, fmt.Errorf("invalid endpoint %q, expected an http or https URL", endpoint)
+		}
+
+		if u.User != nil || (u.Path != "" && u.Path != "/") || u.RawQuery != "" || u.Fragment != "" {
+			return "", false, fmt.Errorf("invalid endpoint %q, expected a URL without credentials, path or query", endpoint)
+		}
+		host = u.Host
+	}
+
+	// Bracket bare IPv6 literals, which cannot carry a port.
+	ip := net.ParseIP(host)
+	if ip != nil && ip.To4() == nil {
+		return "[" + host + "]", secure, nil
+	}
+
+	name, port := host, ""
+	if strings.HasPrefix(host, "[") || strings.Count(host, ":") == 1 {
+		var err error
+		name, port, err = net.SplitHostPort(host)
+		if err != nil {
+			// Bracketed hosts without a port.
+			name = strings.TrimSuffix(strings.TrimPrefix(host, "["), "]")
+			if !strings.HasPrefix(host, "[") || !strings.HasSuffix(host, "]") || net.ParseIP(name) == nil {
+				return "", false, fmt.Errorf("invalid endpoint %q: %w", endpoint, err)
+			}
+		}
+	}
+
+	if name == "" || strings.ContainsAny(name, "/?#@ ") {
+		return "", false, fmt.Errorf("invalid endpoint %q, expected a host", endpoint)
+	}
+
+	if strings.Contains(name, ":") && net.ParseIP(name) == nil {
+		return "", false, fmt.Errorf("invalid endpoint %q, expected a host", endpoint)
+	}
+
+	if port != "" {
+		number, err := strconv.Atoi(port)
+		if err != nil || number < 1 || number > 65535 {
+			return "", false, fmt.Errorf("invalid endpoint %q, invalid port %q", endpoint, port)
+		}
+	}
+
+	if strings.Contains(name, ":") {
+		name = "[" + name + "]"
+	}
+	if port != "" {
+		return name + ":" + port, secure, nil
+	}
+
+	return name, secure, nil
+}
+
+// endpointHost returns the host and whether it is accessed over TLS of the provided
+// validated storage endpoint, see parseEndpoint.
+func endpointHost(endpoint string) (string, bool) {
+	host, secure, err := parseEndpoint(endpoint)
+	if err != nil {
+		return endpoint, true
+	}
+
+	return host, secure
+}
@@ -0,0 +1,176 @@
+package archiver
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/nats-io/nats.go"
+)
+
+// defaultEventsPrefix is the default subject or topic prefix of published run events.
+const defaultEventsPrefix = "zdts3"
+
+// Event bus protocols.
+const (
+	// protocolNATS publishes events to a NATS server.
+	protocolNATS = "nats"
+	// protocolMQTT publishes events to an MQTT broker.
+	protocolMQTT = "mqtt"
+)
+
+// eventBus publishes run events to a NATS server or MQTT broker so other services can
+// subscribe to them. Events are published on <prefix>.archive.<event> NATS subjects or
+// <prefix>/archive/<event> MQTT topics.
+type eventBus struct {
+	address  string
+	protocol string
+	prefix   string
+}
+
+// eventProtocol returns the event bus protocol of the provided address from its scheme.
+func eventProtocol(address string) (string, error) {
+	u, err := url.Parse(address)
+	if err != nil || u.Host == "" {
+		return "", fmt.Errorf("invalid events url %q", address)
+	}
+
+	switch u.Scheme {
+	case "nats", "tls":
+		return protocolNATS, nil
+	case "mqtt", "mqtts":
+		return protocolMQTT, nil
+	default:
+		return "", fmt.Errorf("unsupported events url scheme %q (nats, tls, mqtt, mqtts)", u.Scheme)
+	}
+}
+
+// newEventBus creates a reporter publishing run events to the provided address.
+func newEventBus(address string, prefix string) (*eventBus, error) {
+	protocol, err := eventProtocol(address)
+	if err != nil {
+		return nil, err
+	}
+
+	if prefix == "" {
+		prefix = defaultEventsPrefix
+	}
+
+	return &eventBus{
+		address:  address,
+		protocol: protocol,
+		prefix:   prefix,
+	}, nil
+}
+
+// name returns the name of the reporter.
+func (b *eventBus) name() string {
+	return "events"
+}
+
+// topic returns the subject or topic of the provided event type.
+func (b *eventBus) topic(event string) string {
+	if b.protocol == protocolMQTT {
+		return b.prefix + "/" + strings.ReplaceAll(event, ".", "/")
+	}
+
+	return b.prefix + "." + event
+}
+
+// publish publishes the provided event.
+func (b *eventBus) publish(ctx context.Context, event *runEvent) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("encoding event: %w", err)
+	}
+
+	if b.protocol == protocolMQTT {
+		return b.publishMQTT(ctx, b.topic(event.Event), data)
+	}
+
+	return b.publishNATS(ctx, b.topic(event.Event), data)
+}
+
+// publishNATS publishes the provided data on the provided NATS subject.
+func (b *eventBus) publishNATS(ctx context.Context, subject string, data []byte) error {
+	nc, err := nats.Connect(b.address, nats.Name("zdts3"), nats.NoReconnect())
+	if err != nil {
+		return fmt.Errorf("connecting to nats: %w", err)
+	}
+	defer nc.Close()
+
+	err = nc.Publish(subject, data)
+	if err != nil {
+		return fmt.Errorf("publishing to nats: %w", err)
+	}
+
+	// Ensure the server received the event before disconnecting.
+	err = nc.FlushWithContext(ctx)
+	if err != nil {
+		return fmt.Errorf("flushing nats connection: %w", err)
+	}
+
+	return nil
+}
+
+// waitToken waits for the provided MQTT token to complete or the context to be cancelled.
+func waitToken(ctx context.Context, token mqtt.Token) error {
+	select {
+	case <-token.Done():
+		return token.Error()
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// publishMQTT publishes the provided data on the provided MQTT topic with QoS 1.
+func (b *eventBus) publishMQTT(ctx context.Context, topic string, data []byte) error {
+	u, err := url.Parse(b.address)
+	if err != nil {
+		return fmt.Errorf("parsing events url: %w", err)
+	}
+
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "unknown"
+	}
+
+	opts := mqtt.NewClientOptions().
+		AddBroker(u.Scheme + "://" + u.Host).
+		SetClientID("zdts3-" + hostname + "-" + strconv.Itoa(os.Getpid())).
+		SetAutoReconnect(false)
+	if u.User != nil {
+		password, _ := u.User.Password()
+		opts.SetUsername(u.User.Username())
+		opts.SetPassword(password)
+	}
+
+	client := mqtt.NewClient(opts)
+	err = waitToken(ctx, client.Connect())
+	if err != nil {
+		return fmt.Errorf("connecting to mqtt: %w", err)
+	}
+	defer client.Disconnect(250)
+
+	err = waitToken(ctx, client.Publish(topic, 1, false, data))
+	if err != nil {
+		return fmt.Errorf("publishing to mqtt: %w", err)
+	}
+
+	return nil
+}
+
+// start publishes the started event of the provided run.
+func (b *eventBus) start(ctx context.Context, run *runResult) error {
+	return b.publish(ctx, newRunEvent(eventStarted, run))
+}
+
+// report publishes the succeeded or failed event of the provided run.
+func (b *eventBus) report(ctx context.Context, result *runResult) error {
+	return b.publish(ctx, newRunEvent(resultEvent(result), result))
+}
@@ -0,0 +1,258 @@
+package archiver
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/dnldd/zdts3/pkg/storage"
+)
+
+// execProtocolVersion is the version of the exec storage protocol, sent with every request
+// so plugins can reject requests they do not understand.
+const execProtocolVersion = 1
+
+// Exec storage operations.
+const (
+	execOpPut     = "put"
+	execOpGet     = "get"
+	execOpStat    = "stat"
+	execOpList    = "list"
+	execOpRemove  = "remove"
+	execOpPresign = "presign"
+	execOpCheck   = "check"
+)
+
+// Exec storage error codes.
+const (
+	// execCodeNotFound reports a missing file.
+	execCodeNotFound = "notfound"
+	// execCodeUnsupported reports an operation the plugin does not support.
+	execCodeUnsupported = "unsupported"
+)
+
+// execRequest is the request written to the stdin of an exec storage plugin. File content
+// is exchanged through local files rather than the pipes: put reads the file at Path, get
+// writes the file at Path.
+type execRequest struct {
+	Version int    `json:"version"`
+	Op      string `json:"op"`
+	Key     string `json:"key,omitempty"`
+	Prefix  string `json:"prefix,omitempty"`
+	Path    string `json:"path,omitempty"`
+	Expiry  int64  `json:"expiry,omitempty"`
+}
+
+// execFile is a stored file listed by an exec storage plugin.
+type execFile struct {
+	Key      string    `json:"key"`
+	Size     int64     `json:"size"`
+	Modified time.Time `json:"modified"`
+}
+
+// execResponse is the response an exec storage plugin writes to its stdout.
+type execResponse struct {
+	Size  int64      `json:"size"`
+	Files []execFile `json:"files"`
+	URL   string     `json:"url"`
+	Error string     `json:"error"`
+	Code  string     `json:"code"`
+}
+
+// execStore is a storage provided by an external plugin program. Every operation runs the
+// plugin command through the system shell with a JSON request on its stdin, and reads a
+// JSON response from its stdout.
+type execStore struct {
+	command string
+}
+
+// openExec opens the storage provided by the plugin run by the provided command line.
+func openExec(command string) storageOpener {
+	return func(context.Context) (storage.Storage, error) {
+		return &execStore{command: command}, nil
+	}
+}
+
+// run runs the plugin with the provided request and decodes its response. Plugins report
+// failures with an error message in the response or by exiting with a non-zero status.
+func (s *execStore) run(ctx context.Context, req execRequest) (*execResponse, error) {
+	req.Version = execProtocolVersion
+	input, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd := hookCommand(ctx, s.command)
+	cmd.Stdin = bytes.NewReader(input)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	err = cmd.Run()
+	if err != nil {
+		return nil, fmt.Errorf("exec storage %s: %w: %s", req.Op, err, strings.TrimSpace(stderr.String()))
+	}
+
+	var resp execResponse
+	err = json.Unmarshal(stdout.Bytes(), &resp)
+	if err != nil {
+		return nil, fmt.Errorf("exec storage %s: decoding response: %w", req.Op, err)
+	}
+
+	if resp.Error != "" || resp.Code != "" {
+		err := fmt.Errorf("exec storage %s: %s", req.Op, resp.Error)
+		switch resp.Code {
+		case execCodeNotFound:
+			err = fmt.Errorf("%w: %w", fs.ErrNotExist, err)
+		case execCodeUnsupported:
+			err = fmt.Errorf("%w: %w", errors.ErrUnsupported, err)
+		}
+		return nil, err
+	}
+
+	return &resp, nil
+}
+
+// PutFile uploads the file at the provided path as the provided key.
+func (s *execStore) PutFile(ctx context.Context, key string, path string) (int64, error) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return 0, err
+	}
+
+	resp, err := s.run(ctx, execRequest{Op: execOpPut, Key: key, Path: path})
+	if err != nil {
+		return 0, err
+	}
+	progressFrom(ctx).addBytes(resp.Size)
+
+	return resp.Size, nil
+}
+
+// Put uploads the provided data as the provided key through a temporary file.
+func (s *execStore) Put(ctx context.Context, key string, data []byte) error {
+	tmp, err := os.CreateTemp("", "zdts3-exec-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	_, err = s.PutFile(ctx, key, tmp.Name())
+	return err
+}
+
+// Get downloads the stored file with the provided key into a temporary file, removed once
+// the returned reader is closed.
+func (s *execStore) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	tmp, err := os.CreateTemp("", "zdts3-exec-*")
+	if err != nil {
+		return nil, err
+	}
+	tmp.Close()
+
+	_, err = s.run(ctx, execRequest{Op: execOpGet, Key: key, Path: tmp.Name()})
+	if err != nil {
+		os.Remove(tmp.Name())
+		return nil, err
+	}
+
+	f, err := os.Open(tmp.Name())
+	if err != nil {
+		os.Remove(tmp.Name())
+		return nil, err
+	}
+
+	return &tempFile{File: f}, nil
+}
+
+// Stat returns the size of the stored file with the provided key.
+func (s *execStore) Stat(ctx context.Context, key string) (int64, error) {
+	resp, err := s.run(ctx, execRequest{Op: execOpStat, Key: key})
+	if err != nil {
+		return 0, err
+	}
+
+	return resp.Size, nil
+}
+
+// List returns the files stored directly under the provided prefix.
+func (s *execStore) List(ctx context.Context, prefix string) ([]storage.Object, error) {
+	resp, err := s.run(ctx, execRequest{Op: execOpList, Prefix: prefix})
+	if err != nil {
+		return nil, err
+	}
+
+	files := make([]storage.Object, 0, len(resp.Files))
+	for _, file := range resp.Files {
+		files = append(files, storage.Object{Key: file.Key, Size: file.Size, Modified: file.Modified})
+	}
+
+	return files, nil
+}
+
+// Remove removes the stored file with the provided key, if any.
+func (s *execStore) Remove(ctx context.Context, key string) error {
+	_, err := s.run(ctx, execRequest{Op: execOpRemove, Key: key})
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+
+	return err
+}
+
+// Presign returns a download link of the stored file with the provided key,
+// storage.ErrNoLinks if the plugin does not support links.
+func (s *execStore) Presign(ctx context.Context, key string, expiry time.Duration) (string, error) {
+	resp, err := s.run(ctx, execRequest{Op: execOpPresign, Key: key, Expiry: int64(expiry.Seconds())})
+	if errors.Is(err, errors.ErrUnsupported) {
+		return "", storage.ErrNoLinks
+	}
+	if err != nil {
+		return "", err
+	}
+
+	if resp.URL == "" {
+		return "", storage.ErrNoLinks
+	}
+
+	return resp.URL, nil
+}
+
+// Check ensures the plugin runs and its storage is accessible.
+func (s *execStore) Check(ctx context.Context) error {
+	_, err := s.run(ctx, execRequest{Op: execOpCheck})
+	return err
+}
+
+// Close releases nothing, the plugin runs once per operation.
+func (s *execStore) Close() error {
+	return nil
+}
+
+// tempFile is a temporary file removed once closed.
+type tempFile struct {
+	*os.File
+}
+
+// Close closes and removes the file.
+func (f *tempFile) Close() error {
+	err := f.File.Close()
+	os.Remove(f.Name())
+	return err
+}
@@ -0,0 +1,194 @@
+package archiver
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/peterldowns/testy/assert"
+	"github.com/rs/zerolog"
+)
+
+// execPluginEnv is the environment variable of the directory the test plugin stores files
+// in. The test binary runs as the plugin when it is set.
+const execPluginEnv = "ZDTS3_TEST_EXEC_PLUGIN_DIR"
+
+// TestExecPlugin is the test plugin, a storage of the directory named by execPluginEnv
+// speaking the exec storage protocol. It does nothing unless run by the exec backend.
+func TestExecPlugin(t *testing.T) {
+	root := os.Getenv(execPluginEnv)
+	if root == "" {
+		return
+	}
+
+	var req execRequest
+	var resp execResponse
+	err := json.NewDecoder(os.Stdin).Decode(&req)
+	if err == nil {
+		resp, err = serveExecPlugin(root, req)
+	}
+	if errors.Is(err, fs.ErrNotExist) {
+		resp.Code = execCodeNotFound
+	}
+	if err != nil {
+		resp.Error = err.Error()
+	}
+
+	json.NewEncoder(os.Stdout).Encode(resp)
+	os.Exit(0)
+}
+
+// serveExecPlugin serves the provided request from the provided directory.
+func serveExecPlugin(root string, req execRequest) (execResponse, error) {
+	var resp execResponse
+	path := filepath.Join(root, filepath.FromSlash(req.Key))
+	switch req.Op {
+	case execOpPut:
+		data, err := os.ReadFile(req.Path)
+		if err != nil {
+			return resp, err
+		}
+		err = os.MkdirAll(filepath.Dir(path), 0755)
+		if err != nil {
+			return resp, err
+		}
+		resp.Size = int64(len(data))
+		return resp, os.WriteFile(path, data, 0600)
+
+	case execOpGet:
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return resp, err
+		}
+		return resp, os.WriteFile(req.Path, data, 0600)
+
+	case execOpStat:
+		info, err := os.Stat(path)
+		if err != nil {
+			return resp, err
+		}
+		resp.Size = info.Size()
+		return resp, nil
+
+	case execOpList:
+		entries, err := os.ReadDir(filepath.Join(root, filepath.FromSlash(req.Prefix)))
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return resp, err
+		}
+		for _, entry := range entries {
+			info, err := entry.Info()
+			if err != nil || entry.IsDir() {
+				continue
+			}
+			resp.Files = append(resp.Files, execFile{Key: req.Prefix + entry.Name(), Size: info.Size(), Modified: info.ModTime()})
+		}
+		return resp, nil
+
+	case execOpRemove:
+		return resp, os.Remove(path)
+
+	case execOpPresign:
+		resp.Code = execCodeUnsupported
+		return resp, errors.New("links are not supported")
+
+	case execOpCheck:
+		_, err := os.Stat(root)
+		return resp, err
+	}
+
+	return resp, fmt.Errorf("unknown operation %q", req.Op)
+}
+
+// execPluginCommand returns the command line running the test binary as the test plugin of
+// the provided directory.
+func execPluginCommand(t *testing.T, root string) string {
+	t.Setenv(execPluginEnv, root)
+	return fmt.Sprintf("%q -test.run=^TestExecPlugin$", os.Args[0])
+}
+
+func TestExecStore(t *testing.T) {
+	root := t.TempDir()
+	cfg := (&Config{Backend: backendExec, StorageCommand: execPluginCommand(t, root)}).s3Config(jobConfig{Name: "db", Prefix: "backups"}, nil)
+	ctx := context.Background()
+	logger := zerolog.Nop()
+
+	// Ensure archives are uploaded through the plugin and the zip file is removed.
+	for _, name := range []string{"dump-20260101235000.zip", "dump-20260102235000.zip"} {
+		zipPath := filepath.Join(t.TempDir(), name)
+		assert.NoError(t, os.WriteFile(zipPath, zipBytes(t, map[string]string{"users.sql": name}), 0600))
+
+		info, err := uploadZip(ctx, zipPath, cfg, &logger)
+		assert.NoError(t, err)
+		assert.Equal(t, "backups/"+name, info.Key)
+		_, err = os.Stat(zipPath)
+		assert.True(t, os.IsNotExist(err))
+	}
+
+	err := writeManifest(ctx, cfg, &archiveManifest{Key: "backups/dump-20260101235000.zip"})
+	assert.NoError(t, err)
+	assert.NoError(t, checkBucket(ctx, cfg))
+
+	archives, err := listArchives(ctx, cfg)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(archives))
+	assert.Equal(t, "backups/dump-20260102235000.zip", archives[0].Key)
+
+	// Ensure the newest archive is restored by default.
+	target := t.TempDir()
+	_, err = restoreArchive(ctx, cfg, "", target)
+	assert.NoError(t, err)
+	data, err := os.ReadFile(filepath.Join(target, "users.sql"))
+	assert.NoError(t, err)
+	assert.Equal(t, "dump-20260102235000.zip", string(data))
+
+	// Ensure pruning removes old archives along with their manifests.
+	pruned, err := pruneArchives(ctx, cfg, time.Now().Add(time.Hour), 1, false)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(pruned))
+	_, err = os.Stat(filepath.Join(root, "backups", "dump-20260101235000.zip"))
+	assert.True(t, os.IsNotExist(err))
+
+	store, err := cfg.openStorage(ctx)
+	assert.NoError(t, err)
+	defer store.Close()
+
+	// Ensure missing files and unsupported links are reported.
+	_, err = store.Get(ctx, "backups/missing.zip")
+	assert.True(t, errors.Is(err, fs.ErrNotExist))
+	assert.NoError(t, store.Remove(ctx, "backups/missing.zip"))
+	_, err = store.Presign(ctx, "backups/dump-20260102235000.zip", time.Hour)
+	assert.True(t, errors.Is(err, errors.ErrUnsupported))
+
+	// Ensure downloads are removed once closed.
+	src, err := store.Get(ctx, "backups/dump-20260102235000.zip")
+	assert.NoError(t, err)
+	_, err = io.Copy(io.Discard, src)
+	assert.NoError(t, err)
+	assert.NoError(t, src.Close())
+	_, err = os.Stat(src.(*tempFile).Name())
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestExecStoreFailure(t *testing.T) {
+	ctx := context.Background()
+
+	// Ensure failing plugins surface their output.
+	store := &execStore{command: "echo broken plugin >&2; exit 3"}
+	err := store.Check(ctx)
+	assert.Error(t, err)
+	assert.True(t, strings.Contains(err.Error(), "broken plugin"))
+
+	// Ensure malformed responses are reported.
+	store = &execStore{command: "echo not json"}
+	err = store.Check(ctx)
+	assert.Error(t, err)
+	assert.True(t, strings.Contains(err.Error(), "decoding response"))
+}
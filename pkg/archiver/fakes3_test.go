@@ -0,0 +1,514 @@
+package archiver
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+// fakeObject is an object stored by the fake S3 server.
+type fakeObject struct {
+	data     []byte
+	etag     string
+	modified time.Time
+	header   http.Header
+	// hold is the legal hold status of the object, empty if none was set.
+	hold string
+}
+
+// fakeUpload is a multipart upload in progress on the fake S3 server.
+type fakeUpload struct {
+	key    string
+	parts  map[int][]byte
+	header http.Header
+}
+
+// fakeS3 is an in-memory S3 server for hermetic tests. It implements the subset of the S3
+// API used by the service.
+type fakeS3 struct {
+	mtx     sync.Mutex
+	buckets map[string]map[string]*fakeObject
+	uploads map[string]*fakeUpload
+	// created holds the request headers of the buckets created through the API.
+	created map[string]http.Header
+	// lifecycles holds the lifecycle configurations of the buckets.
+	lifecycles map[string][]byte
+	// corrupt flips the first byte of uploaded objects, as if corrupted in transit.
+	corrupt bool
+	// served is the number of object bytes served by GET requests.
+	served int64
+	// throttled is the number of next requests answered with 503 Slow Down, asking clients
+	// to retry after a second.
+	throttled int
+	// requests is the number of requests served, identifying them.
+	requests atomic.Int64
+	srv      *httptest.Server
+}
+
+// newFakeS3 starts a fake S3 server with the provided buckets.
+func newFakeS3(t *testing.T, buckets ...string) *fakeS3 {
+	f := &fakeS3{
+		buckets:    make(map[string]map[string]*fakeObject),
+		uploads:    make(map[string]*fakeUpload),
+		created:    make(map[string]http.Header),
+		lifecycles: make(map[string][]byte),
+	}
+	for _, bucket := range buckets {
+		f.buckets[bucket] = make(map[string]*fakeObject)
+	}
+
+	f.srv = httptest.NewTLSServer(f)
+	t.Cleanup(f.srv.Close)
+
+	return f
+}
+
+// s3Config returns an access configuration for the provided bucket of the fake server.
+func (f *fakeS3) s3Config(bucket string) *s3Config {
+	endpoint, _ := url.Parse(f.srv.URL)
+
+	return &s3Config{
+		Endpoint: endpoint.Host,
+		Bucket:   bucket,
+		Options: &minio.Options{
+			Creds:     credentials.NewStaticV4("test-accesskeyid", "test-secretaccesskey", ""),
+			Secure:    true,
+			Transport: f.srv.Client().Transport,
+		},
+	}
+}
+
+// object returns the stored object, if any.
+func (f *fakeS3) object(bucket string, key string) *fakeObject {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+
+	return f.buckets[bucket][key]
+}
+
+// servedBytes returns the number of object bytes served by GET requests.
+func (f *fakeS3) servedBytes() int64 {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+
+	return f.served
+}
+
+// legalHold sets or gets the legal hold status of the provided object.
+func (f *fakeS3) legalHold(w http.ResponseWriter, r *http.Request, obj *fakeObject) {
+	if obj == nil {
+		writeError(w, http.StatusNotFound, "NoSuchKey")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPut:
+		data, err := readBody(r)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "IncompleteBody")
+			return
+		}
+
+		var hold struct {
+			Status string `xml:"Status"`
+		}
+		err = xml.Unmarshal(data, &hold)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "MalformedXML")
+			return
+		}
+		obj.hold = hold.Status
+
+	case http.MethodGet:
+		if obj.hold == "" {
+			writeError(w, http.StatusNotFound, "NoSuchObjectLockConfiguration")
+			return
+		}
+		fmt.Fprintf(w, "<LegalHold><Status>%s</Status></LegalHold>", obj.hold)
+	}
+}
+
+// writeError writes an S3 error response.
+func writeError(w http.ResponseWriter, status int, code string) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	fmt.Fprintf(w, "<Error><Code>%s</Code><Message>%s</Message></Error>", code, code)
+}
+
+// decodeAWSChunked decodes an aws-chunked encoded request body, adding its trailing headers
+// to the provided trailer.
+func decodeAWSChunked(body io.Reader, trailer http.Header) ([]byte, error) {
+	var data bytes.Buffer
+	reader := bufio.NewReader(body)
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+
+		sizeHex, _, _ := strings.Cut(strings.TrimSpace(line), ";")
+		size, err := strconv.ParseInt(sizeHex, 16, 64)
+		if err != nil {
+			return nil, err
+		}
+
+		if size == 0 {
+			for {
+				line, err := reader.ReadString('\n')
+				name, value, ok := strings.Cut(strings.TrimSpace(line), ":")
+				if err != nil || !ok {
+					return data.Bytes(), nil
+				}
+				trailer.Set(name, value)
+			}
+		}
+
+		_, err = io.CopyN(&data, reader, size)
+		if err != nil {
+			return nil, err
+		}
+
+		_, err = reader.Discard(2)
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// readBody reads the body of an upload request, decoding aws-chunked bodies.
+func readBody(r *http.Request) ([]byte, error) {
+	if strings.Contains(r.Header.Get("Content-Encoding"), "aws-chunked") ||
+		strings.HasPrefix(r.Header.Get("X-Amz-Content-Sha256"), "STREAMING-") {
+		r.Trailer = make(http.Header)
+		return decodeAWSChunked(r.Body, r.Trailer)
+	}
+
+	return io.ReadAll(r.Body)
+}
+
+// verifyChecksum verifies the provided data of an upload request against the MD5 digest and
+// SHA-256 checksum of the request, sent as a header or a trailing header. It returns the
+// SHA-256 checksum, empty if the request carries none.
+func verifyChecksum(r *http.Request, data []byte) (string, error) {
+	if digest := r.Header.Get("Content-Md5"); digest != "" {
+		sum := md5.Sum(data)
+		if digest != base64.StdEncoding.EncodeToString(sum[:]) {
+			return "", errors.New("digest mismatch")
+		}
+	}
+
+	checksum := r.Header.Get("X-Amz-Checksum-Sha256")
+	if checksum == "" {
+		checksum = r.Trailer.Get("X-Amz-Checksum-Sha256")
+	}
+	if checksum == "" {
+		return "", nil
+	}
+
+	sum := sha256.Sum256(data)
+	if checksum != base64.StdEncoding.EncodeToString(sum[:]) {
+		return "", errors.New("checksum mismatch")
+	}
+
+	return checksum, nil
+}
+
+// newFakeObject creates an object with the provided data and request headers.
+func newFakeObject(data []byte, header http.Header) *fakeObject {
+	sum := md5.Sum(data)
+	return &fakeObject{
+		data:     data,
+		etag:     "\"" + hex.EncodeToString(sum[:]) + "\"",
+		modified: time.Now().UTC(),
+		header:   header.Clone(),
+	}
+}
+
+// multipart handles the requests of the provided multipart upload of an object.
+func (f *fakeS3) multipart(w http.ResponseWriter, r *http.Request, bucket string, objects map[string]*fakeObject, id string) {
+	upload, ok := f.uploads[id]
+	if !ok {
+		writeError(w, http.StatusNotFound, "NoSuchUpload")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPut:
+		number, err := strconv.Atoi(r.URL.Query().Get("partNumber"))
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "InvalidArgument")
+			return
+		}
+
+		data, err := readBody(r)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "IncompleteBody")
+			return
+		}
+		upload.parts[number] = data
+
+		w.Header().Set("ETag", newFakeObject(data, r.Header).etag)
+
+	case http.MethodPost:
+		numbers := make([]int, 0, len(upload.parts))
+		for number := range upload.parts {
+			numbers = append(numbers, number)
+		}
+		sort.Ints(numbers)
+
+		var data []byte
+		for _, number := range numbers {
+			data = append(data, upload.parts[number]...)
+		}
+
+		obj := newFakeObject(data, upload.header)
+		objects[upload.key] = obj
+		delete(f.uploads, id)
+
+		w.Header().Set("Content-Type", "application/xml")
+		fmt.Fprintf(w, "<CompleteMultipartUploadResult><Bucket>%s</Bucket><Key>%s</Key><ETag>%s</ETag></CompleteMultipartUploadResult>",
+			bucket, upload.key, obj.etag)
+
+	case http.MethodDelete:
+		delete(f.uploads, id)
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		writeError(w, http.StatusNotImplemented, "NotImplemented")
+	}
+}
+
+// listObjects writes a ListObjectsV2 response of the provided objects with the provided
+// prefix. Keys containing the delimiter after the prefix are rolled up in common prefixes.
+func (f *fakeS3) listObjects(w http.ResponseWriter, objects map[string]*fakeObject, prefix string, delimiter string) {
+	keys := make([]string, 0, len(objects))
+	for key := range objects {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	var contents, prefixes strings.Builder
+	seen := make(map[string]bool)
+	for _, key := range keys {
+		if delimiter != "" {
+			i := strings.Index(key[len(prefix):], delimiter)
+			if i >= 0 {
+				common := key[:len(prefix)+i+len(delimiter)]
+				if !seen[common] {
+					seen[common] = true
+					fmt.Fprintf(&prefixes, "<CommonPrefixes><Prefix>%s</Prefix></CommonPrefixes>", common)
+				}
+				continue
+			}
+		}
+
+		obj := objects[key]
+		fmt.Fprintf(&contents, "<Contents><Key>%s</Key><LastModified>%s</LastModified><ETag>%s</ETag><Size>%d</Size><StorageClass>STANDARD</StorageClass></Contents>",
+			key, obj.modified.Format(time.RFC3339), obj.etag, len(obj.data))
+	}
+
+	w.Header().Set("Content-Type", "application/xml")
+	fmt.Fprintf(w, `<ListBucketResult><Prefix>%s</Prefix><KeyCount>%d</KeyCount><MaxKeys>1000</MaxKeys><IsTruncated>false</IsTruncated>%s%s</ListBucketResult>`,
+		prefix, len(keys), contents.String(), prefixes.String())
+}
+
+// ServeHTTP handles S3 API requests.
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("X-Amz-Request-Id", fmt.Sprintf("%016X", f.requests.Add(1)))
+
+	query := r.URL.Query()
+	if _, ok := query["location"]; ok {
+		w.Write([]byte(`<LocationConstraint>us-east-1</LocationConstraint>`))
+		return
+	}
+
+	bucket, key, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+
+	if f.throttled > 0 {
+		f.throttled--
+		w.Header().Set("Retry-After", "1")
+		writeError(w, http.StatusServiceUnavailable, "SlowDown")
+		return
+	}
+
+	objects, ok := f.buckets[bucket]
+	if !ok && key == "" && r.Method == http.MethodPut && len(query) == 0 {
+		f.buckets[bucket] = make(map[string]*fakeObject)
+		f.created[bucket] = r.Header.Clone()
+		return
+	}
+	if !ok {
+		writeError(w, http.StatusNotFound, "NoSuchBucket")
+		return
+	}
+
+	if _, ok := query["lifecycle"]; ok && key == "" {
+		switch r.Method {
+		case http.MethodPut:
+			data, err := readBody(r)
+			if err != nil {
+				writeError(w, http.StatusBadRequest, "IncompleteBody")
+				return
+			}
+			f.lifecycles[bucket] = data
+		case http.MethodGet:
+			if f.lifecycles[bucket] == nil {
+				writeError(w, http.StatusNotFound, "NoSuchLifecycleConfiguration")
+				return
+			}
+			w.Write(f.lifecycles[bucket])
+		case http.MethodDelete:
+			delete(f.lifecycles, bucket)
+			w.WriteHeader(http.StatusNoContent)
+		}
+		return
+	}
+
+	if key == "" {
+		switch r.Method {
+		case http.MethodPut:
+			writeError(w, http.StatusConflict, "BucketAlreadyOwnedByYou")
+			return
+		case http.MethodHead:
+			return
+		case http.MethodGet:
+			f.listObjects(w, objects, query.Get("prefix"), query.Get("delimiter"))
+			return
+		default:
+			writeError(w, http.StatusNotImplemented, "NotImplemented")
+			return
+		}
+	}
+
+	// Initiate multipart uploads and handle their parts.
+	if _, ok := query["uploads"]; ok && r.Method == http.MethodPost {
+		id := strconv.Itoa(len(f.uploads) + 1)
+		f.uploads[id] = &fakeUpload{key: key, parts: make(map[int][]byte), header: r.Header.Clone()}
+
+		w.Header().Set("Content-Type", "application/xml")
+		fmt.Fprintf(w, "<InitiateMultipartUploadResult><Bucket>%s</Bucket><Key>%s</Key><UploadId>%s</UploadId></InitiateMultipartUploadResult>",
+			bucket, key, id)
+		return
+	}
+
+	if id := query.Get("uploadId"); id != "" {
+		f.multipart(w, r, bucket, objects, id)
+		return
+	}
+
+	obj := objects[key]
+
+	if _, ok := query["legal-hold"]; ok {
+		f.legalHold(w, r, obj)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPut:
+		if r.Header.Get("If-None-Match") == "*" && obj != nil {
+			writeError(w, http.StatusPreconditionFailed, "PreconditionFailed")
+			return
+		}
+
+		match := r.Header.Get("If-Match")
+		if match != "" && (obj == nil || (match != "*" && match != obj.etag)) {
+			writeError(w, http.StatusPreconditionFailed, "PreconditionFailed")
+			return
+		}
+
+		data, err := readBody(r)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "IncompleteBody")
+			return
+		}
+
+		if f.corrupt && len(data) > 0 {
+			data[0] ^= 0xff
+		}
+
+		checksum, err := verifyChecksum(r, data)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "BadDigest")
+			return
+		}
+
+		obj = newFakeObject(data, r.Header)
+		objects[key] = obj
+
+		w.Header().Set("ETag", obj.etag)
+		if checksum != "" {
+			w.Header().Set("X-Amz-Checksum-Sha256", checksum)
+		}
+
+	case http.MethodGet, http.MethodHead:
+		if obj == nil {
+			if r.Method == http.MethodHead {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			writeError(w, http.StatusNotFound, "NoSuchKey")
+			return
+		}
+
+		w.Header().Set("ETag", obj.etag)
+		w.Header().Set("Last-Modified", obj.modified.Format(http.TimeFormat))
+		w.Header().Set("Content-Type", obj.header.Get("Content-Type"))
+
+		// Only the single byte ranges requested by the client are supported.
+		data := obj.data
+		var start, end int
+		_, err := fmt.Sscanf(r.Header.Get("Range"), "bytes=%d-%d", &start, &end)
+		if err == nil && start < len(obj.data) {
+			end = min(end, len(obj.data)-1)
+			data = obj.data[start : end+1]
+			w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end, len(obj.data)))
+			w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+			w.WriteHeader(http.StatusPartialContent)
+		} else {
+			w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+		}
+
+		if r.Method == http.MethodGet {
+			f.served += int64(len(data))
+			w.Write(data)
+		}
+
+	case http.MethodDelete:
+		match := r.Header.Get("If-Match")
+		if match != "" && (obj == nil || match != obj.etag) {
+			writeError(w, http.StatusPreconditionFailed, "PreconditionFailed")
+			return
+		}
+
+		delete(objects, key)
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		writeError(w, http.StatusNotImplemented, "NotImplemented")
+	}
+}
@@ -0,0 +1,94 @@
+package archiver
+
+import (
+	"archive/zip"
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"strings"
+	"time"
+)
+
+// checksumsName is the name of the zip entry listing the SHA-256 checksums of the archived
+// files, in the format of sha256sum, so restored files can be verified with
+// sha256sum -c without the manifest stored next to the archive.
+const checksumsName = "MANIFEST.sha256"
+
+// addChecksums adds an entry listing the SHA-256 checksums of the archived files to the zip.
+// Preserved symbolic links are left out, sha256sum would verify the files they point to.
+func (z *dirZipper) addChecksums() error {
+	header := &zip.FileHeader{
+		Name:     checksumsName,
+		Method:   zip.Deflate,
+		Modified: time.Now(),
+	}
+	header.SetMode(0644)
+
+	w, err := z.w.CreateHeader(header)
+	if err != nil {
+		return err
+	}
+
+	buf := bufio.NewWriter(w)
+	for _, file := range z.files {
+		if z.symlinks[file.Path] {
+			continue
+		}
+
+		_, err := fmt.Fprintf(buf, "%s  %s\n", file.SHA256, file.Path)
+		if err != nil {
+			return err
+		}
+	}
+
+	return buf.Flush()
+}
+
+// embeddedManifest returns a manifest of the files of the provided archive holding the
+// checksums it embeds, nil if it embeds none.
+func embeddedManifest(reader *zip.Reader) (*archiveManifest, error) {
+	src, err := reader.Open(checksumsName)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %w", checksumsName, err)
+	}
+	defer src.Close()
+
+	checksums, err := readChecksums(src)
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %w", checksumsName, err)
+	}
+
+	manifest := &archiveManifest{Files: make([]archivedFile, 0, len(checksums))}
+	for name, hash := range checksums {
+		manifest.Files = append(manifest.Files, archivedFile{Path: name, SHA256: hash})
+	}
+
+	return manifest, nil
+}
+
+// readChecksums reads the SHA-256 checksums listed in the format of sha256sum by the provided
+// reader, by file name.
+func readChecksums(r io.Reader) (map[string]string, error) {
+	checksums := make(map[string]string)
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			continue
+		}
+
+		// Binary mode lines separate the name with an asterisk instead of a space.
+		hash, name, ok := strings.Cut(line, " ")
+		if !ok || len(hash) != 64 || name == "" || (name[0] != ' ' && name[0] != '*') {
+			return nil, fmt.Errorf("invalid checksum line %q", line)
+		}
+		checksums[name[1:]] = hash
+	}
+
+	return checksums, scanner.Err()
+}
@@ -0,0 +1,71 @@
+package archiver
+
+import (
+	"archive/zip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/peterldowns/testy/assert"
+	"github.com/rs/zerolog"
+)
+
+func TestFileChecksums(t *testing.T) {
+	dir := t.TempDir()
+	err := os.MkdirAll(filepath.Join(dir, "orders"), 0755)
+	assert.NoError(t, err)
+	err = os.WriteFile(filepath.Join(dir, "users.sql"), []byte("users"), 0644)
+	assert.NoError(t, err)
+	err = os.WriteFile(filepath.Join(dir, "orders", "2026.csv"), []byte("1,2"), 0644)
+	assert.NoError(t, err)
+	err = os.Symlink("users.sql", filepath.Join(dir, "latest.sql"))
+	assert.NoError(t, err)
+	err = os.WriteFile(filepath.Join(dir, checksumsName), []byte("restored"), 0644)
+	assert.NoError(t, err)
+
+	// Ensure the archive embeds the checksums of its files, leaving out preserved links and
+	// a file named like the checksums.
+	logger := zerolog.Nop()
+	zipPath := filepath.Join(t.TempDir(), "dump.zip")
+	opts := zipOptions{Method: zip.Deflate, Symlinks: symlinksPreserve, Checksums: true}
+	files, err := zipDir(context.Background(), dir, zipPath, opts, &logger)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, len(files))
+
+	reader, err := zip.OpenReader(zipPath)
+	assert.NoError(t, err)
+	defer reader.Close()
+	src, err := reader.Open(checksumsName)
+	assert.NoError(t, err)
+	checksums, err := readChecksums(src)
+	assert.NoError(t, err)
+	src.Close()
+
+	sum := func(data string) string {
+		hash := sha256.Sum256([]byte(data))
+		return hex.EncodeToString(hash[:])
+	}
+	assert.Equal(t, map[string]string{"users.sql": sum("users"), "orders/2026.csv": sum("1,2")}, checksums)
+
+	// Ensure archives are verified against their embedded checksums without a manifest.
+	assert.NoError(t, verifyZip(zipPath, nil))
+
+	mismatched := filepath.Join(t.TempDir(), "mismatched.zip")
+	err = os.WriteFile(mismatched, zipBytes(t, map[string]string{
+		"users.sql":   "users",
+		checksumsName: sum("other") + "  users.sql\n",
+	}), 0644)
+	assert.NoError(t, err)
+	assert.Error(t, verifyZip(mismatched, nil))
+
+	// Ensure binary mode lines are read and invalid lines rejected.
+	checksums, err = readChecksums(strings.NewReader(sum("users") + " *users.sql\n"))
+	assert.NoError(t, err)
+	assert.Equal(t, sum("users"), checksums["users.sql"])
+	_, err = readChecksums(strings.NewReader("users.sql\n"))
+	assert.Error(t, err)
+}
@@ -0,0 +1,253 @@
+package archiver
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// fsSnapshot is a read-only snapshot of the filesystem of a source directory.
+type fsSnapshot interface {
+	// dir returns the path of the source directory within the snapshot.
+	dir() string
+	// remove removes the snapshot.
+	remove(ctx context.Context) error
+}
+
+// fsSnapshotProvider creates read-only snapshots of the filesystems of source directories.
+type fsSnapshotProvider interface {
+	// create creates a snapshot with the provided name of the filesystem of the provided
+	// directory. Snapshots needing a directory of their own, e.g. a mount point, are kept in
+	// the provided parent directory.
+	create(ctx context.Context, dir string, parent string, name string) (fsSnapshot, error)
+}
+
+// fsSnapshotProviders are the filesystem snapshot providers by name.
+var fsSnapshotProviders = map[string]fsSnapshotProvider{
+	"btrfs": btrfsProvider{},
+	"zfs":   zfsProvider{},
+	"lvm":   lvmProvider{},
+}
+
+// validateFSSnapshot validates the provided filesystem snapshot provider name.
+func validateFSSnapshot(provider string) error {
+	if _, ok := fsSnapshotProviders[provider]; provider == "" || ok {
+		return nil
+	}
+
+	names := make([]string, 0, len(fsSnapshotProviders))
+	for name := range fsSnapshotProviders {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	return fmt.Errorf("invalid filesystem snapshot provider %q, expected one of %s", provider, strings.Join(names, ", "))
+}
+
+// createFSSnapshot creates a read-only snapshot of the filesystem of the provided directory
+// with the job's filesystem snapshot provider, for a run at the provided time. Snapshots
+// needing a directory of their own are kept in the job's snapshot directory, next to the
+// source directory by default.
+func (j *jobConfig) createFSSnapshot(ctx context.Context, dir string, now time.Time, logger *zerolog.Logger) (fsSnapshot, error) {
+	parent := j.SnapshotDir
+	if parent == "" {
+		parent = filepath.Dir(filepath.Clean(dir))
+	}
+	name := "zdts3-" + nameLabel(j.Name) + "-" + now.Format("20060102150405")
+
+	snapshot, err := fsSnapshotProviders[j.FSSnapshot].create(ctx, dir, parent, name)
+	if err != nil {
+		return nil, fmt.Errorf("creating %s snapshot: %w", j.FSSnapshot, err)
+	}
+
+	logger.Info().Str("provider", j.FSSnapshot).Str("path", snapshot.dir()).Msg("Created filesystem snapshot")
+	return snapshot, nil
+}
+
+// runSnapshotCommand runs the provided command of a snapshot provider, returning its trimmed
+// standard output. The standard error of failed commands is part of the returned error.
+func runSnapshotCommand(ctx context.Context, name string, args ...string) (string, error) {
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Stderr = &stderr
+
+	output, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("%s %s: %w: %s", name, strings.Join(args, " "), err, strings.TrimSpace(stderr.String()))
+	}
+
+	return strings.TrimSpace(string(output)), nil
+}
+
+// btrfsProvider snapshots btrfs subvolumes. The source directory must be a subvolume, its
+// snapshots are created in the parent directory, on the same filesystem.
+type btrfsProvider struct{}
+
+// btrfsSnapshot is a read-only snapshot of a btrfs subvolume.
+type btrfsSnapshot struct {
+	path string
+}
+
+// create creates a read-only snapshot of the subvolume of the provided directory.
+func (btrfsProvider) create(ctx context.Context, dir string, parent string, name string) (fsSnapshot, error) {
+	path := filepath.Join(parent, name)
+	_, err := runSnapshotCommand(ctx, "btrfs", "subvolume", "snapshot", "-r", dir, path)
+	if err != nil {
+		return nil, err
+	}
+
+	return &btrfsSnapshot{path: path}, nil
+}
+
+// dir returns the path of the snapshot, the source directory is its subvolume.
+func (s *btrfsSnapshot) dir() string {
+	return s.path
+}
+
+// remove deletes the snapshot's subvolume.
+func (s *btrfsSnapshot) remove(ctx context.Context) error {
+	_, err := runSnapshotCommand(ctx, "btrfs", "subvolume", "delete", s.path)
+	return err
+}
+
+// zfsProvider snapshots ZFS datasets. Snapshots are read through the hidden .zfs directory
+// of the dataset's mount point.
+type zfsProvider struct{}
+
+// zfsSnapshot is a snapshot of a ZFS dataset.
+type zfsSnapshot struct {
+	name string
+	path string
+}
+
+// create snapshots the dataset holding the provided directory.
+func (zfsProvider) create(ctx context.Context, dir string, _ string, name string) (fsSnapshot, error) {
+	output, err := runSnapshotCommand(ctx, "zfs", "list", "-H", "-o", "name,mountpoint", dir)
+	if err != nil {
+		return nil, err
+	}
+	dataset, mountpoint, ok := strings.Cut(output, "\t")
+	if !ok {
+		return nil, fmt.Errorf("unexpected zfs list output %q", output)
+	}
+	rel, err := filepath.Rel(mountpoint, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	snapshot := &zfsSnapshot{
+		name: dataset + "@" + name,
+		path: filepath.Join(mountpoint, ".zfs", "snapshot", name, rel),
+	}
+	_, err = runSnapshotCommand(ctx, "zfs", "snapshot", snapshot.name)
+	if err != nil {
+		return nil, err
+	}
+
+	return snapshot, nil
+}
+
+// dir returns the path of the source directory within the snapshot.
+func (s *zfsSnapshot) dir() string {
+	return s.path
+}
+
+// remove destroys the snapshot.
+func (s *zfsSnapshot) remove(ctx context.Context) error {
+	_, err := runSnapshotCommand(ctx, "zfs", "destroy", s.name)
+	return err
+}
+
+// lvmSnapshotExtents is the size of LVM snapshots, which must hold the blocks of the origin
+// volume written while they exist.
+const lvmSnapshotExtents = "10%ORIGIN"
+
+// lvmProvider snapshots LVM logical volumes and mounts the snapshots read-only.
+type lvmProvider struct{}
+
+// lvmSnapshot is a mounted snapshot of an LVM logical volume.
+type lvmSnapshot struct {
+	volume string
+	mount  string
+	path   string
+}
+
+// create snapshots the logical volume mounted at the provided directory, and mounts the
+// snapshot read-only in a new directory within the provided parent directory.
+func (lvmProvider) create(ctx context.Context, dir string, parent string, name string) (fsSnapshot, error) {
+	output, err := runSnapshotCommand(ctx, "findmnt", "-n", "-r", "-o", "SOURCE,TARGET,FSTYPE", "--target", dir)
+	if err != nil {
+		return nil, err
+	}
+	fields := strings.Fields(output)
+	if len(fields) != 3 {
+		return nil, fmt.Errorf("unexpected findmnt output %q", output)
+	}
+	device, target, fsType := fields[0], strings.ReplaceAll(fields[1], `\x20`, " "), fields[2]
+	rel, err := filepath.Rel(target, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	output, err = runSnapshotCommand(ctx, "lvs", "--noheadings", "-o", "vg_name,lv_name", device)
+	if err != nil {
+		return nil, err
+	}
+	fields = strings.Fields(output)
+	if len(fields) != 2 {
+		return nil, fmt.Errorf("%s is not a logical volume", device)
+	}
+	group := fields[0]
+
+	_, err = runSnapshotCommand(ctx, "lvcreate", "--snapshot", "--extents", lvmSnapshotExtents,
+		"--name", name, group+"/"+fields[1])
+	if err != nil {
+		return nil, err
+	}
+	snapshot := &lvmSnapshot{volume: group + "/" + name}
+
+	// XFS refuses to mount a snapshot next to its origin with the same UUID.
+	options := "ro"
+	if fsType == "xfs" {
+		options += ",nouuid"
+	}
+	snapshot.mount, err = os.MkdirTemp(parent, name+"-*")
+	if err == nil {
+		_, err = runSnapshotCommand(ctx, "mount", "-o", options, "/dev/"+snapshot.volume, snapshot.mount)
+		if err != nil {
+			os.Remove(snapshot.mount)
+		}
+	}
+	if err != nil {
+		_, removeErr := runSnapshotCommand(context.WithoutCancel(ctx), "lvremove", "--yes", snapshot.volume)
+		return nil, errors.Join(err, removeErr)
+	}
+	snapshot.path = filepath.Join(snapshot.mount, rel)
+
+	return snapshot, nil
+}
+
+// dir returns the path of the source directory within the mounted snapshot.
+func (s *lvmSnapshot) dir() string {
+	return s.path
+}
+
+// remove unmounts and removes the snapshot.
+func (s *lvmSnapshot) remove(ctx context.Context) error {
+	_, err := runSnapshotCommand(ctx, "umount", s.mount)
+	if err != nil {
+		return err
+	}
+
+	_, err = runSnapshotCommand(ctx, "lvremove", "--yes", s.volume)
+	return errors.Join(err, os.Remove(s.mount))
+}
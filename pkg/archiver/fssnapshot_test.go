@@ -0,0 +1,97 @@
+package archiver
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/peterldowns/testy/assert"
+	"github.com/rs/zerolog"
+)
+
+// fakeSnapshotCommand installs a shell script with the provided name and body on the PATH,
+// standing in for a snapshot tool. It returns the path of the file its invocations are
+// logged to.
+func fakeSnapshotCommand(t *testing.T, name string, body string) string {
+	if runtime.GOOS == "windows" {
+		t.Skip("snapshot tools are faked with shell scripts")
+	}
+
+	bin := t.TempDir()
+	log := filepath.Join(bin, name+".log")
+	script := "#!/bin/sh\necho \"$@\" >> " + log + "\n" + body
+	assert.NoError(t, os.WriteFile(filepath.Join(bin, name), []byte(script), 0755))
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	return log
+}
+
+func TestValidateFSSnapshot(t *testing.T) {
+	assert.NoError(t, validateFSSnapshot(""))
+	assert.NoError(t, validateFSSnapshot("zfs"))
+	assert.Error(t, validateFSSnapshot("vss"))
+}
+
+func TestZFSSnapshot(t *testing.T) {
+	mountpoint := t.TempDir()
+	dir := filepath.Join(mountpoint, "db")
+	logger := zerolog.Nop()
+	log := fakeSnapshotCommand(t, "zfs", `case "$1" in
+list) printf 'tank/data\t%s\n' "`+mountpoint+`" ;;
+esac
+`)
+	job := jobConfig{Name: "db", FSSnapshot: "zfs"}
+	now := time.Date(2026, 1, 1, 23, 50, 0, 0, time.UTC)
+
+	// Ensure the dataset of the directory is snapshotted and read through its .zfs directory.
+	snapshot, err := job.createFSSnapshot(context.Background(), dir, now, &logger)
+	assert.NoError(t, err)
+	assert.Equal(t, filepath.Join(mountpoint, ".zfs", "snapshot", "zdts3-db-20260101235000", "db"), snapshot.dir())
+	assert.NoError(t, snapshot.remove(context.Background()))
+
+	data, err := os.ReadFile(log)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		"list -H -o name,mountpoint " + dir,
+		"snapshot tank/data@zdts3-db-20260101235000",
+		"destroy tank/data@zdts3-db-20260101235000",
+	}, strings.Split(strings.TrimSpace(string(data)), "\n"))
+}
+
+func TestArchiveFSSnapshot(t *testing.T) {
+	dir := t.TempDir()
+	snapshots := t.TempDir()
+	logger := zerolog.Nop()
+	tracker := newStatusTracker()
+	fake := newFakeS3(t, "test-bucket")
+	s3Cfg := fake.s3Config("test-bucket")
+	fakeSnapshotCommand(t, "btrfs", `case "$2" in
+snapshot) cp -R "$4" "$5" ;;
+delete) rm -rf "$3" ;;
+esac
+`)
+	job := jobConfig{Name: "db", SourceDir: dir, Retention: "720h", FSSnapshot: "btrfs", SnapshotDir: snapshots}
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "users.sql"), []byte("users"), 0644))
+
+	// Ensure archives are zipped from the snapshot, which is removed once zipped.
+	archive(context.Background(), job, s3Cfg, []runReporter{tracker}, &logger)
+	result := tracker.runs["db"]
+	assert.NoError(t, result.Err)
+	assert.Equal(t, 1, result.Files)
+
+	entries, err := os.ReadDir(snapshots)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, len(entries))
+
+	// Ensure failing snapshots fail the run.
+	fakeSnapshotCommand(t, "btrfs", "echo 'not a subvolume' >&2\nexit 1\n")
+	archive(context.Background(), job, s3Cfg, []runReporter{tracker}, &logger)
+	result = tracker.runs["db"]
+	assert.Error(t, result.Err)
+	assert.Equal(t, "snapshot", result.Errors[0].Stage)
+	assert.True(t, strings.Contains(result.Err.Error(), "not a subvolume"))
+}
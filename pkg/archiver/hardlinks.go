@@ -0,0 +1,83 @@
+package archiver
+
+import (
+	"archive/zip"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// hardLinkComment prefixes the comment of zip entries of hard links, followed by the name of
+// the entry holding their content.
+const hardLinkComment = "zdts3-hardlink:"
+
+// fileID identifies a file independent of its hard links.
+type fileID struct {
+	dev uint64
+	ino uint64
+}
+
+// addHardLink adds an entry without content for the provided hard link of the provided
+// archived file to the zip.
+func (z *dirZipper) addHardLink(name string, info os.FileInfo, first archivedFile) error {
+	header, err := zip.FileInfoHeader(info)
+	if err != nil {
+		return err
+	}
+	header.Name = name
+	header.Method = zip.Store
+	header.Comment = hardLinkComment + first.Path
+	header.Extra = ownerExtra(info)
+
+	_, err = z.w.CreateHeader(header)
+	if err != nil {
+		return err
+	}
+
+	first.Path = name
+	z.files = append(z.files, first)
+	z.opts.Progress.addFile()
+
+	return nil
+}
+
+// extractHardLink links the provided path in the provided directory to the extracted file
+// with the provided name, falling back to copying the file where links are unsupported.
+func extractHardLink(name string, target string, targetDir string) error {
+	if !filepath.IsLocal(name) {
+		return fmt.Errorf("hard link to %q escapes the target directory", name)
+	}
+	source := filepath.Join(targetDir, filepath.FromSlash(name))
+	err := checkNoLinks(targetDir, source)
+	if err != nil {
+		return err
+	}
+
+	err = os.Remove(target)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	err = os.Link(source, target)
+	if err == nil {
+		return nil
+	}
+
+	src, err := os.Open(source)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := os.Create(target)
+	if err != nil {
+		return err
+	}
+	_, err = copyBuffers().copy(dst, src)
+	if err != nil {
+		dst.Close()
+		return err
+	}
+
+	return dst.Close()
+}
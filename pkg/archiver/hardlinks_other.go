@@ -0,0 +1,11 @@
+//go:build !unix
+
+package archiver
+
+import "os"
+
+// hardLinkID returns the identity of the provided file shared by all of its hard links. Hard
+// links are not detected on this platform.
+func hardLinkID(os.FileInfo) (fileID, bool) {
+	return fileID{}, false
+}
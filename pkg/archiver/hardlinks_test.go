@@ -0,0 +1,72 @@
+package archiver
+
+import (
+	"archive/zip"
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/peterldowns/testy/assert"
+	"github.com/rs/zerolog"
+)
+
+func TestZipHardLinks(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("hard links are not detected on windows")
+	}
+
+	dir := t.TempDir()
+	logger := zerolog.Nop()
+	content := make([]byte, 64<<10)
+	for i := range content {
+		content[i] = byte(i * 7)
+	}
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "a.bin"), content, 0644))
+	assert.NoError(t, os.Link(filepath.Join(dir, "a.bin"), filepath.Join(dir, "b.bin")))
+
+	// Ensure linked files are archived in full without the option.
+	zipPath := filepath.Join(t.TempDir(), "copies.zip")
+	files, err := zipDir(context.Background(), dir, zipPath, zipOptions{Method: zip.Store}, &logger)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(files))
+	copies, err := os.Stat(zipPath)
+	assert.NoError(t, err)
+
+	// Ensure the content of linked files is archived once.
+	zipPath = filepath.Join(t.TempDir(), "links.zip")
+	files, err = zipDir(context.Background(), dir, zipPath, zipOptions{Method: zip.Store, HardLinks: true}, &logger)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(files))
+	assert.Equal(t, files[0].SHA256, files[1].SHA256)
+	assert.Equal(t, files[0].Size, files[1].Size)
+	links, err := os.Stat(zipPath)
+	assert.NoError(t, err)
+	assert.True(t, links.Size() < copies.Size()-int64(len(content))/2)
+
+	// Ensure linked files are restored as hard links.
+	target := t.TempDir()
+	count, _, err := extractZip(zipPath, target, extractOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, count)
+	first, err := os.Stat(filepath.Join(target, "a.bin"))
+	assert.NoError(t, err)
+	second, err := os.Stat(filepath.Join(target, "b.bin"))
+	assert.NoError(t, err)
+	assert.True(t, os.SameFile(first, second))
+	data, err := os.ReadFile(filepath.Join(target, "b.bin"))
+	assert.NoError(t, err)
+	assert.Equal(t, len(content), len(data))
+
+	// Ensure links restored without the file they link to get its content.
+	target = t.TempDir()
+	count, _, err = extractZip(zipPath, target, extractOptions{Include: includeFilter{"b.bin"}})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, count)
+	data, err = os.ReadFile(filepath.Join(target, "b.bin"))
+	assert.NoError(t, err)
+	assert.Equal(t, content, data)
+	_, err = os.Stat(filepath.Join(target, "a.bin"))
+	assert.True(t, os.IsNotExist(err))
+}
@@ -0,0 +1,19 @@
+//go:build unix
+
+package archiver
+
+import (
+	"os"
+	"syscall"
+)
+
+// hardLinkID returns the identity of the provided file shared by all of its hard links, if
+// the file has more than one.
+func hardLinkID(info os.FileInfo) (fileID, bool) {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok || stat.Nlink < 2 {
+		return fileID{}, false
+	}
+
+	return fileID{dev: uint64(stat.Dev), ino: uint64(stat.Ino)}, true
+}
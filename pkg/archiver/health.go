@@ -0,0 +1,229 @@
+package archiver
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-co-op/gocron/v2"
+	"github.com/rs/zerolog"
+)
+
+// healthShutdownTimeout is the maximum duration of waiting for in-flight health requests on
+// shutdown.
+const healthShutdownTimeout = 5 * time.Second
+
+// jobStatus is the status of an archive job reported by the status endpoint.
+type jobStatus struct {
+	Job         string     `json:"job"`
+	LastRun     *time.Time `json:"lastRun,omitempty"`
+	Result      string     `json:"result,omitempty"`
+	Error       string     `json:"error,omitempty"`
+	Duration    string     `json:"duration,omitempty"`
+	Files       int        `json:"files"`
+	ArchiveSize int64      `json:"archiveSize"`
+	NextRun     *time.Time `json:"nextRun,omitempty"`
+	// Progress is the progress of the job's current run, if it is running.
+	Progress *progressStatus `json:"progress,omitempty"`
+}
+
+// statusTracker is a run reporter keeping the last run result of every job and the
+// progress of running jobs.
+type statusTracker struct {
+	mtx     sync.Mutex
+	runs    map[string]runResult
+	running map[string]*runProgress
+}
+
+// newStatusTracker creates an empty status tracker.
+func newStatusTracker() *statusTracker {
+	return &statusTracker{runs: make(map[string]runResult), running: make(map[string]*runProgress)}
+}
+
+// name returns the name of the reporter.
+func (t *statusTracker) name() string {
+	return "status"
+}
+
+// start records the progress of the provided run until it is reported.
+func (t *statusTracker) start(_ context.Context, run *runResult) error {
+	if run.Progress == nil {
+		return nil
+	}
+
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
+	t.running[run.Job] = run.Progress
+	return nil
+}
+
+// report records the provided run result as the last run of its job.
+func (t *statusTracker) report(_ context.Context, result *runResult) error {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
+	t.runs[result.Job] = *result
+	delete(t.running, result.Job)
+	return nil
+}
+
+// status returns the status of the jobs registered with the provided scheduler, as well as
+// of jobs that ran before being removed by a reload.
+func (t *statusTracker) status(s gocron.Scheduler) []jobStatus {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
+	statuses := make(map[string]*jobStatus)
+	for _, job := range s.Jobs() {
+		status := &jobStatus{Job: job.Name()}
+		next, err := job.NextRun()
+		// Jobs which only run when triggered have no next run.
+		if err == nil && !next.IsZero() && next.Before(neverRun) {
+			status.NextRun = &next
+		}
+		statuses[job.Name()] = status
+	}
+
+	for name, run := range t.runs {
+		status, ok := statuses[name]
+		if !ok {
+			status = &jobStatus{Job: name}
+			statuses[name] = status
+		}
+
+		lastRun := run.Start
+		status.LastRun = &lastRun
+		status.Result = "success"
+		if run.Err != nil {
+			status.Result = "failure"
+			status.Error = run.Err.Error()
+		}
+		status.Duration = run.Duration.Round(time.Millisecond).String()
+		status.Files = run.Files
+		status.ArchiveSize = run.Size
+	}
+
+	now := time.Now()
+	for name, progress := range t.running {
+		status, ok := statuses[name]
+		if !ok {
+			status = &jobStatus{Job: name}
+			statuses[name] = status
+		}
+
+		current := progress.status(now)
+		status.Progress = &current
+	}
+
+	list := make([]jobStatus, 0, len(statuses))
+	for _, status := range statuses {
+		list = append(list, *status)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Job < list[j].Job })
+
+	return list
+}
+
+// newHealthHandler creates the handler of the health endpoints. /healthz reports process
+// liveness, unhealthy while the provided watchdog finds stale jobs, /livez whether the
+// scheduler is running, /readyz whether the instance is ready to archive according to the
+// provided readiness and /status the last and next run of every job. The dashboard and run
+// API are served when provided and the pprof endpoints when profiling is enabled.
+func newHealthHandler(s gocron.Scheduler, tracker *statusTracker, watchdog *staleWatchdog, ready *readiness, dash *dashboard, api *runAPI, profiling bool) http.Handler {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		if watchdog != nil {
+			stale := watchdog.staleJobs()
+			if len(stale) > 0 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				w.Write([]byte("stale: " + strings.Join(stale, ", ") + "\n"))
+				return
+			}
+		}
+
+		w.Write([]byte("ok\n"))
+	})
+
+	mux.HandleFunc("GET /livez", func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		if s != nil && !schedulerAlive(s, livenessTimeout) {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			w.Write([]byte("scheduler unresponsive\n"))
+			return
+		}
+
+		w.Write([]byte("ok\n"))
+	})
+
+	mux.HandleFunc("GET /readyz", func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		if ready != nil {
+			err := ready.check()
+			if err != nil {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				w.Write([]byte("not ready: " + strings.ReplaceAll(err.Error(), "\n", ". ") + "\n"))
+				return
+			}
+		}
+
+		w.Write([]byte("ok\n"))
+	})
+
+	mux.HandleFunc("GET /status", func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(struct {
+			Version string      `json:"version"`
+			Jobs    []jobStatus `json:"jobs"`
+		}{
+			Version: getBuildInfo().Version,
+			Jobs:    tracker.status(s),
+		})
+	})
+
+	if dash != nil {
+		dash.register(mux)
+	}
+
+	if api != nil {
+		api.register(mux)
+	}
+
+	if profiling {
+		registerProfiling(mux)
+	}
+
+	return mux
+}
+
+// serveHealth serves the health endpoints on the provided listener until the context is
+// cancelled.
+func serveHealth(ctx context.Context, ln net.Listener, handler http.Handler, logger *zerolog.Logger, wg *sync.WaitGroup) {
+	defer wg.Done()
+
+	srv := &http.Server{
+		Handler:           handler,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	go func() {
+		<-ctx.Done()
+
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), healthShutdownTimeout)
+		defer cancel()
+		srv.Shutdown(shutdownCtx)
+	}()
+
+	err := srv.Serve(ln)
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
+		logger.Error().Err(err).Msg("Serving health endpoints")
+	}
+}
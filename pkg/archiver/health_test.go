@@ -0,0 +1,109 @@
+package archiver
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-co-op/gocron/v2"
+	"github.com/peterldowns/testy/assert"
+)
+
+func TestHealthHandler(t *testing.T) {
+	s, err := gocron.NewScheduler()
+	assert.NoError(t, err)
+	defer s.Shutdown()
+
+	job := jobConfig{Name: "db", Schedule: "23:50"}
+	definition, err := job.jobDefinition(0)
+	assert.NoError(t, err)
+	_, err = s.NewJob(definition, gocron.NewTask(func() {}), gocron.WithName(job.Name))
+	assert.NoError(t, err)
+	s.Start()
+
+	tracker := newStatusTracker()
+	watchdog := newStaleWatchdog(time.Now().Add(-48 * time.Hour))
+	srv := httptest.NewServer(newHealthHandler(s, tracker, watchdog, nil, nil, nil, false))
+	defer srv.Close()
+
+	// Ensure liveness is reported.
+	resp, err := http.Get(srv.URL + "/healthz")
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	// Ensure jobs without a recent successful archive are reported unhealthy.
+	watchdog.check([]jobConfig{job}, 26*time.Hour, time.Now())
+	resp, err = http.Get(srv.URL + "/healthz")
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+
+	assert.NoError(t, watchdog.report(context.Background(), &runResult{Job: job.Name, Start: time.Now()}))
+	watchdog.check([]jobConfig{job}, 26*time.Hour, time.Now())
+	resp, err = http.Get(srv.URL + "/healthz")
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	getStatus := func() []jobStatus {
+		resp, err := http.Get(srv.URL + "/status")
+		assert.NoError(t, err)
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+		var status struct {
+			Jobs []jobStatus `json:"jobs"`
+		}
+		err = json.NewDecoder(resp.Body).Decode(&status)
+		assert.NoError(t, err)
+		return status.Jobs
+	}
+
+	// Ensure scheduled jobs are listed with their next run before running.
+	jobs := getStatus()
+	assert.Equal(t, 1, len(jobs))
+	assert.Equal(t, "db", jobs[0].Job)
+	assert.True(t, jobs[0].NextRun != nil)
+	assert.True(t, jobs[0].LastRun == nil)
+
+	// Ensure the last run result is reported.
+	err = tracker.report(context.Background(), &runResult{
+		Job:      "db",
+		Start:    time.Now(),
+		Duration: time.Second,
+		Files:    2,
+		Size:     1024,
+		Err:      errors.New("upload failed"),
+	})
+	assert.NoError(t, err)
+
+	jobs = getStatus()
+	assert.Equal(t, 1, len(jobs))
+	assert.True(t, jobs[0].LastRun != nil)
+	assert.Equal(t, "failure", jobs[0].Result)
+	assert.Equal(t, "upload failed", jobs[0].Error)
+	assert.Equal(t, 2, jobs[0].Files)
+	assert.Equal(t, int64(1024), jobs[0].ArchiveSize)
+	assert.True(t, jobs[0].Progress == nil)
+
+	// Ensure the progress of running jobs is reported until they finish.
+	run := &runResult{Job: "db", Start: time.Now(), Progress: &runProgress{}}
+	run.Progress.setPhase(phaseUpload, 0, 4096)
+	run.Progress.addBytes(1024)
+	assert.NoError(t, tracker.start(context.Background(), run))
+
+	jobs = getStatus()
+	assert.True(t, jobs[0].Progress != nil)
+	assert.Equal(t, phaseUpload, jobs[0].Progress.Phase)
+	assert.Equal(t, int64(1024), jobs[0].Progress.Bytes)
+	assert.Equal(t, 25.0, jobs[0].Progress.Percent)
+
+	assert.NoError(t, tracker.report(context.Background(), run))
+	jobs = getStatus()
+	assert.True(t, jobs[0].Progress == nil)
+}
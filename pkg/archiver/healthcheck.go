@@ -0,0 +1,103 @@
+package archiver
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+)
+
+// healthcheckTimeout is the default maximum duration of a health check.
+const healthcheckTimeout = 5 * time.Second
+
+// runHealthcheckCommand checks the health of the local instance and fails when it is
+// unhealthy, e.g. for the HEALTHCHECK of a container. The health endpoint is queried when
+// one is configured, otherwise the jobs of the state file are checked for stale backups.
+func runHealthcheckCommand(cfg *Config, args []string, out io.Writer) error {
+	fs := flag.NewFlagSet("healthcheck", flag.ContinueOnError)
+	addr := fs.String("addr", localAddress(cfg.HealthAddr), "Address of the health endpoints (defaults to the local healthaddr)")
+	timeout := fs.Duration("timeout", healthcheckTimeout, "Maximum duration of the health check")
+	err := fs.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case *addr != "":
+		ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+		defer cancel()
+
+		return checkHealthEndpoint(ctx, *addr, out)
+
+	case cfg.StateFile != "":
+		return checkStateFile(cfg, time.Now(), out)
+
+	default:
+		return errors.New("nothing to check, no health endpoint (-addr or healthaddr) or state file")
+	}
+}
+
+// checkHealthEndpoint queries the liveness endpoint served at the provided address and fails
+// unless it reports the instance healthy.
+func checkHealthEndpoint(ctx context.Context, addr string, out io.Writer) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://"+addr+"/healthz", nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("querying health endpoint: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	status := strings.TrimSpace(string(body))
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unhealthy (%s): %s", resp.Status, status)
+	}
+
+	fmt.Fprintln(out, status)
+	return nil
+}
+
+// checkStateFile fails when a job of the provided configuration has no successful run
+// recorded in the state file within the maximum backup age. Jobs without recorded runs are
+// not stale yet, runs of a job's subdirectories count as runs of the job.
+func checkStateFile(cfg *Config, now time.Time, out io.Writer) error {
+	state, err := openRunState(cfg.StateFile)
+	if err != nil {
+		return err
+	}
+
+	maxAge := cfg.maxBackupAge()
+	var stale []string
+	for _, job := range cfg.jobs() {
+		var lastSuccess time.Time
+		recorded := false
+		for name, jobState := range state.jobs {
+			if name == job.Name || strings.HasPrefix(name, job.Name+"/") {
+				recorded = true
+				if jobState.LastSuccess.After(lastSuccess) {
+					lastSuccess = jobState.LastSuccess
+				}
+			}
+		}
+
+		if recorded && maxAge > 0 && now.Sub(lastSuccess) > maxAge {
+			stale = append(stale, job.Name)
+		}
+	}
+	if len(stale) > 0 {
+		slices.Sort(stale)
+		return fmt.Errorf("unhealthy, stale: %s", strings.Join(stale, ", "))
+	}
+
+	fmt.Fprintln(out, "ok")
+	return nil
+}
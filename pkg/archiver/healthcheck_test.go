@@ -0,0 +1,61 @@
+package archiver
+
+import (
+	"bytes"
+	"context"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/peterldowns/testy/assert"
+)
+
+func TestHealthcheckCommand(t *testing.T) {
+	watchdog := newStaleWatchdog(time.Now().Add(-48 * time.Hour))
+	srv := httptest.NewServer(newHealthHandler(nil, newStatusTracker(), watchdog, nil, nil, nil, false))
+	defer srv.Close()
+	addr := strings.TrimPrefix(srv.URL, "http://")
+
+	// Ensure healthy instances pass the check.
+	var out bytes.Buffer
+	cfg := &Config{HealthAddr: addr}
+	assert.NoError(t, runHealthcheckCommand(cfg, nil, &out))
+	assert.Equal(t, "ok\n", out.String())
+
+	// Ensure instances with stale jobs fail it.
+	job := jobConfig{Name: "db"}
+	watchdog.check([]jobConfig{job}, 26*time.Hour, time.Now())
+	err := runHealthcheckCommand(cfg, nil, &out)
+	assert.Error(t, err)
+	assert.True(t, strings.Contains(err.Error(), "stale: db"))
+
+	// Ensure unreachable instances fail it.
+	srv.Close()
+	assert.Error(t, runHealthcheckCommand(cfg, []string{"-timeout", "1s"}, &out))
+	assert.Error(t, runHealthcheckCommand(&Config{}, nil, &out))
+}
+
+func TestCheckStateFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	cfg := &Config{SourceDir: t.TempDir(), MaxBackupAge: "26h", StateFile: path}
+	job := cfg.jobs()[0]
+	now := time.Date(2026, 1, 3, 12, 0, 0, 0, time.UTC)
+
+	// Ensure jobs without recorded runs are not stale yet.
+	var out bytes.Buffer
+	assert.NoError(t, checkStateFile(cfg, now, &out))
+	assert.Equal(t, "ok\n", out.String())
+
+	// Ensure jobs without a successful run within the maximum backup age are.
+	state, err := openRunState(path)
+	assert.NoError(t, err)
+	assert.NoError(t, state.report(context.Background(), &runResult{Job: job.Name, Start: now.Add(-48 * time.Hour)}))
+	err = checkStateFile(cfg, now, &out)
+	assert.Error(t, err)
+	assert.True(t, strings.Contains(err.Error(), job.Name))
+
+	assert.NoError(t, state.report(context.Background(), &runResult{Job: job.Name, Start: now.Add(-time.Hour)}))
+	assert.NoError(t, checkStateFile(cfg, now, &out))
+}
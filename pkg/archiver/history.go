@@ -0,0 +1,284 @@
+package archiver
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/dustin/go-humanize"
+	_ "modernc.org/sqlite"
+)
+
+// defaultHistoryLimit is the default number of runs listed by the history command.
+const defaultHistoryLimit = 20
+
+// historySchema creates the run history table.
+const historySchema = `CREATE TABLE IF NOT EXISTS runs (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	job TEXT NOT NULL,
+	host TEXT NOT NULL,
+	start TEXT NOT NULL,
+	end TEXT NOT NULL,
+	result TEXT NOT NULL,
+	files INTEGER NOT NULL,
+	bytes INTEGER NOT NULL,
+	object_key TEXT NOT NULL,
+	error TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS runs_job_start ON runs (job, start);
+CREATE TABLE IF NOT EXISTS catalog (
+	run_id INTEGER NOT NULL REFERENCES runs (id),
+	job TEXT NOT NULL,
+	bucket TEXT NOT NULL,
+	archive TEXT NOT NULL,
+	archived TEXT NOT NULL,
+	path TEXT NOT NULL,
+	size INTEGER NOT NULL,
+	mod_time TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS catalog_job ON catalog (job);`
+
+// historyEntry is a run recorded in the run history.
+type historyEntry struct {
+	ID        int64
+	Job       string
+	Host      string
+	Start     time.Time
+	End       time.Time
+	Result    string
+	Files     int
+	Bytes     int64
+	ObjectKey string
+	Error     string
+}
+
+// runHistory is a run reporter recording every run in a local SQLite database, keeping an
+// audit trail of runs which survives log rotation.
+type runHistory struct {
+	db *sql.DB
+}
+
+// openHistory opens the run history database at the provided path, creating it if needed.
+func openHistory(path string) (*runHistory, error) {
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, fmt.Errorf("opening history database: %w", err)
+	}
+
+	// Serialize writes through a single connection, SQLite does not allow concurrent writers.
+	db.SetMaxOpenConns(1)
+
+	_, err = db.Exec(historySchema)
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("creating history schema: %w", err)
+	}
+
+	return &runHistory{db: db}, nil
+}
+
+// Close closes the run history database.
+func (h *runHistory) Close() error {
+	return h.db.Close()
+}
+
+// name returns the name of the reporter.
+func (h *runHistory) name() string {
+	return "history"
+}
+
+// report records the provided run in the history, along with the catalog of the files of
+// its archive.
+func (h *runHistory) report(ctx context.Context, result *runResult) error {
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "unknown"
+	}
+
+	outcome := "success"
+	var runErr string
+	if result.Err != nil {
+		outcome = "failure"
+		runErr = result.Err.Error()
+	}
+
+	tx, err := h.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("starting history transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx, `INSERT INTO runs
+		(job, host, start, end, result, files, bytes, object_key, error)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		result.Job,
+		hostname,
+		result.Start.UTC().Format(time.RFC3339Nano),
+		result.Start.Add(result.Duration).UTC().Format(time.RFC3339Nano),
+		outcome,
+		result.Files,
+		result.Size,
+		result.Key,
+		runErr,
+	)
+	if err != nil {
+		return fmt.Errorf("recording run: %w", err)
+	}
+
+	runID, err := res.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("recording run: %w", err)
+	}
+
+	for _, entry := range catalogEntries(result) {
+		_, err = tx.ExecContext(ctx, `INSERT INTO catalog
+			(run_id, job, bucket, archive, archived, path, size, mod_time)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+			runID,
+			entry.Job,
+			entry.Bucket,
+			entry.Archive,
+			entry.Archived.Format(time.RFC3339Nano),
+			entry.Path,
+			entry.Size,
+			entry.ModTime.Format(time.RFC3339Nano),
+		)
+		if err != nil {
+			return fmt.Errorf("cataloging %s: %w", entry.Path, err)
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return fmt.Errorf("committing history transaction: %w", err)
+	}
+
+	return nil
+}
+
+// list returns the most recent runs, newest first. Runs are limited to the provided job,
+// if any.
+func (h *runHistory) list(ctx context.Context, job string, limit int) ([]historyEntry, error) {
+	rows, err := h.db.QueryContext(ctx, `SELECT
+		id, job, host, start, end, result, files, bytes, object_key, error
+		FROM runs WHERE ? = '' OR job = ? ORDER BY start DESC, id DESC LIMIT ?`,
+		job, job, limit)
+	if err != nil {
+		return nil, fmt.Errorf("querying runs: %w", err)
+	}
+	defer rows.Close()
+
+	var entries []historyEntry
+	for rows.Next() {
+		var entry historyEntry
+		var start, end string
+		err := rows.Scan(&entry.ID, &entry.Job, &entry.Host, &start, &end, &entry.Result,
+			&entry.Files, &entry.Bytes, &entry.ObjectKey, &entry.Error)
+		if err != nil {
+			return nil, fmt.Errorf("reading run: %w", err)
+		}
+
+		entry.Start, err = time.Parse(time.RFC3339Nano, start)
+		if err != nil {
+			return nil, fmt.Errorf("parsing run start: %w", err)
+		}
+		entry.End, err = time.Parse(time.RFC3339Nano, end)
+		if err != nil {
+			return nil, fmt.Errorf("parsing run end: %w", err)
+		}
+
+		entries = append(entries, entry)
+	}
+
+	return entries, rows.Err()
+}
+
+// find returns the catalog entries matching the provided pattern, newest first. Entries
+// are limited to the provided job, if any.
+func (h *runHistory) find(ctx context.Context, job string, pattern string) ([]catalogEntry, error) {
+	rows, err := h.db.QueryContext(ctx, `SELECT
+		job, bucket, archive, archived, path, size, mod_time
+		FROM catalog WHERE ? = '' OR job = ? ORDER BY archived DESC, path`,
+		job, job)
+	if err != nil {
+		return nil, fmt.Errorf("querying catalog: %w", err)
+	}
+	defer rows.Close()
+
+	var found []catalogEntry
+	for rows.Next() {
+		var entry catalogEntry
+		var archived, modTime string
+		err := rows.Scan(&entry.Job, &entry.Bucket, &entry.Archive, &archived, &entry.Path,
+			&entry.Size, &modTime)
+		if err != nil {
+			return nil, fmt.Errorf("reading catalog entry: %w", err)
+		}
+
+		if !matchCatalogPath(pattern, entry.Path) {
+			continue
+		}
+
+		entry.Archived, err = time.Parse(time.RFC3339Nano, archived)
+		if err != nil {
+			return nil, fmt.Errorf("parsing archive time: %w", err)
+		}
+		entry.ModTime, err = time.Parse(time.RFC3339Nano, modTime)
+		if err != nil {
+			return nil, fmt.Errorf("parsing file modification time: %w", err)
+		}
+
+		found = append(found, entry)
+	}
+
+	return found, rows.Err()
+}
+
+// runHistoryCommand lists the most recent runs recorded in the run history.
+func runHistoryCommand(cfg *Config, args []string, out io.Writer) error {
+	fs := flag.NewFlagSet("history", flag.ContinueOnError)
+	job := fs.String("job", "", "Only list runs of the provided job")
+	limit := fs.Int("limit", defaultHistoryLimit, "Maximum number of runs to list")
+	err := fs.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	if cfg.HistoryDB == "" {
+		return errors.New("no history database configured (historydb)")
+	}
+
+	history, err := openHistory(cfg.HistoryDB)
+	if err != nil {
+		return err
+	}
+	defer history.Close()
+
+	entries, err := history.list(context.Background(), *job, *limit)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "START\tJOB\tRESULT\tDURATION\tFILES\tSIZE\tOBJECT\tERROR")
+	for _, entry := range entries {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%d\t%s\t%s\t%s\n",
+			entry.Start.Local().Format(time.DateTime),
+			entry.Job,
+			entry.Result,
+			entry.End.Sub(entry.Start).Round(time.Millisecond),
+			entry.Files,
+			humanize.IBytes(uint64(entry.Bytes)),
+			entry.ObjectKey,
+			entry.Error,
+		)
+	}
+
+	return w.Flush()
+}
@@ -0,0 +1,64 @@
+package archiver
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/peterldowns/testy/assert"
+)
+
+func TestRunHistory(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.db")
+	history, err := openHistory(path)
+	assert.NoError(t, err)
+
+	ctx := context.Background()
+	start := time.Date(2026, 1, 1, 23, 50, 0, 0, time.UTC)
+	runs := []*runResult{
+		{Job: "db", Start: start, Duration: time.Minute, Files: 3, Size: 1024, Key: "backups/dump-20260101235000.zip"},
+		{Job: "logs", Start: start.Add(time.Hour), Duration: time.Second, Err: errors.New("zip failed")},
+		{Job: "db", Start: start.Add(24 * time.Hour), Duration: time.Minute, Files: 4, Size: 2048, Key: "backups/dump-20260102235000.zip"},
+	}
+	for _, run := range runs {
+		err = history.report(ctx, run)
+		assert.NoError(t, err)
+	}
+
+	// Ensure runs are listed newest first.
+	entries, err := history.list(ctx, "", defaultHistoryLimit)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, len(entries))
+	assert.Equal(t, "backups/dump-20260102235000.zip", entries[0].ObjectKey)
+	assert.Equal(t, "failure", entries[1].Result)
+	assert.Equal(t, "zip failed", entries[1].Error)
+	assert.Equal(t, "success", entries[2].Result)
+	assert.Equal(t, start, entries[2].Start)
+	assert.Equal(t, start.Add(time.Minute), entries[2].End)
+	assert.Equal(t, 3, entries[2].Files)
+	assert.Equal(t, int64(1024), entries[2].Bytes)
+
+	// Ensure runs can be limited to a job.
+	entries, err = history.list(ctx, "db", 1)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(entries))
+	assert.Equal(t, 4, entries[0].Files)
+	assert.NoError(t, history.Close())
+
+	// Ensure the history survives reopening and can be listed by the history command.
+	var out bytes.Buffer
+	cfg := &Config{HistoryDB: path}
+	err = runCommand(cfg, []string{"history", "-job", "logs"}, &out)
+	assert.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	assert.Equal(t, 2, len(lines))
+	assert.True(t, strings.Contains(lines[1], "zip failed"))
+
+	// Ensure the history command requires a database.
+	err = runCommand(&Config{}, []string{"history"}, &out)
+	assert.Error(t, err)
+}
@@ -0,0 +1,134 @@
+package archiver
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+
+	"github.com/rs/zerolog"
+)
+
+// Hook stages.
+const (
+	// hookPreRun is the stage of hooks running before the source directory is zipped.
+	hookPreRun = "prerun"
+	// hookPostRun is the stage of hooks running after the archive was uploaded.
+	hookPostRun = "postrun"
+)
+
+// hookCommand returns the command running the provided hook command line through the
+// system shell.
+func hookCommand(ctx context.Context, command string) *exec.Cmd {
+	if runtime.GOOS == "windows" {
+		return exec.CommandContext(ctx, "cmd", "/C", command)
+	}
+
+	return exec.CommandContext(ctx, "sh", "-c", command)
+}
+
+// maxHookOutput is the number of bytes of a hook's output captured in the run log.
+const maxHookOutput = 64 << 10
+
+// hookSecretSettings are the settings whose environment variables are withheld from hooks,
+// as they carry credentials or URLs embedding them.
+var hookSecretSettings = []string{
+	"secretaccesskey", "b2applicationkey", "dashboardpassword", "apitoken", "slackwebhook",
+	"discordwebhook", "smtppassword", "telegramtoken", "webhooksecret", "vaulttoken",
+	"vaultsecretid", "pingurl", "eventsurl",
+}
+
+// secretEnv reports whether the provided environment variable holds the value of a secret
+// setting.
+func secretEnv(name string) bool {
+	for _, setting := range hookSecretSettings {
+		for _, envName := range envNames(setting) {
+			if strings.EqualFold(name, envName) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// hookEnv returns the environment of the hooks of the provided run. Besides the service's
+// environment without its secrets, hooks receive the job name, its source directory and,
+// after the upload, the bucket and key of the archive.
+func hookEnv(job jobConfig, result *runResult) []string {
+	var env []string
+	for _, entry := range os.Environ() {
+		name, _, _ := strings.Cut(entry, "=")
+		if !secretEnv(name) {
+			env = append(env, entry)
+		}
+	}
+
+	env = append(env,
+		"ZDTS3_JOB="+job.Name,
+		"ZDTS3_SOURCEDIR="+job.SourceDir,
+	)
+
+	if result.Key != "" {
+		env = append(env,
+			"ZDTS3_BUCKET="+result.Bucket,
+			"ZDTS3_OBJECT="+result.Key,
+		)
+	}
+
+	return env
+}
+
+// cappedBuffer is a buffer keeping the first bytes written to it up to its limit and
+// discarding the rest.
+type cappedBuffer struct {
+	buf       bytes.Buffer
+	limit     int
+	truncated bool
+}
+
+// Write keeps what fits in the buffer, always reporting the whole input as written so the
+// writing command does not fail.
+func (b *cappedBuffer) Write(p []byte) (int, error) {
+	n := len(p)
+	if room := b.limit - b.buf.Len(); n > room {
+		p = p[:room]
+		b.truncated = true
+	}
+	b.buf.Write(p)
+
+	return n, nil
+}
+
+// runHook runs the provided hook command of a run in the job's source directory. The output
+// of the command is captured in the run log, up to maxHookOutput bytes. A command exiting with a non-zero status fails
+// the run.
+func runHook(ctx context.Context, stage string, command string, job jobConfig, result *runResult, logger *zerolog.Logger) error {
+	cmd := hookCommand(ctx, command)
+	cmd.Dir = job.SourceDir
+	cmd.Env = hookEnv(job, result)
+
+	output := &cappedBuffer{limit: maxHookOutput}
+	cmd.Stdout = output
+	cmd.Stderr = output
+
+	err := cmd.Run()
+	event := logger.Info()
+	if err != nil {
+		event = logger.Error().Err(err)
+	}
+	if output.truncated {
+		event = event.Bool("truncated", true)
+	}
+	event.Str("hook", stage).Str("command", command).
+		Str("output", strings.TrimRight(output.buf.String(), "\r\n")).Msg("Ran hook")
+
+	if err != nil {
+		return fmt.Errorf("%s hook: %w", stage, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,114 @@
+package archiver
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/peterldowns/testy/assert"
+	"github.com/rs/zerolog"
+)
+
+func TestRunHook(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("hook commands are POSIX shell scripts")
+	}
+
+	dir := t.TempDir()
+	logger := zerolog.Nop()
+	job := jobConfig{Name: "db", SourceDir: dir}
+	result := &runResult{Job: "db", Bucket: "test-bucket", Key: "dump.zip"}
+
+	// Ensure hooks run in the source directory with the run's environment.
+	err := runHook(context.Background(), hookPostRun, `echo "$ZDTS3_JOB $ZDTS3_BUCKET/$ZDTS3_OBJECT" > hook.txt`, job, result, &logger)
+	assert.NoError(t, err)
+
+	data, err := os.ReadFile(filepath.Join(dir, "hook.txt"))
+	assert.NoError(t, err)
+	assert.Equal(t, "db test-bucket/dump.zip\n", string(data))
+
+	// Ensure failing hooks return an error naming the stage.
+	err = runHook(context.Background(), hookPreRun, "exit 3", job, result, &logger)
+	assert.Error(t, err)
+	assert.True(t, strings.HasPrefix(err.Error(), "prerun hook: "))
+}
+
+func TestArchiveHooks(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("hook commands are POSIX shell scripts")
+	}
+
+	dir := t.TempDir()
+	logger := zerolog.Nop()
+	tracker := newStatusTracker()
+	reporters := []runReporter{tracker}
+	s3 := newFakeS3(t, "test-bucket")
+
+	// Ensure the pre-run hook output is archived and the post-run hook sees the upload.
+	job := jobConfig{
+		Name:      "db",
+		SourceDir: dir,
+		Retention: "24h",
+		PreRun:    "echo dump > db.sql",
+		PostRun:   `echo "$ZDTS3_OBJECT" > uploaded.txt`,
+	}
+	archive(context.Background(), job, s3.s3Config("test-bucket"), reporters, &logger)
+	result := tracker.runs["db"]
+	assert.NoError(t, result.Err)
+	var dumped bool
+	for _, file := range result.Contents {
+		dumped = dumped || file.Path == "db.sql"
+	}
+	assert.True(t, dumped)
+
+	data, err := os.ReadFile(filepath.Join(dir, "uploaded.txt"))
+	assert.NoError(t, err)
+	assert.Equal(t, result.Key+"\n", string(data))
+
+	// Ensure a failing pre-run hook aborts the run before anything is uploaded.
+	job.PreRun = "exit 1"
+	job.PostRun = "touch post.txt"
+	archive(context.Background(), job, s3.s3Config("test-bucket"), reporters, &logger)
+	result = tracker.runs["db"]
+	assert.Error(t, result.Err)
+	assert.Equal(t, "", result.Key)
+
+	_, err = os.Stat(filepath.Join(dir, "post.txt"))
+	assert.True(t, os.IsNotExist(err))
+
+	// Ensure a failing post-run hook fails the run.
+	job.PreRun = ""
+	job.PostRun = "exit 1"
+	archive(context.Background(), job, s3.s3Config("test-bucket"), reporters, &logger)
+	assert.Error(t, tracker.runs["db"].Err)
+}
+
+func TestHookEnv(t *testing.T) {
+	t.Setenv("ZDTS3_SECRETACCESSKEY", "test-secretaccesskey")
+	t.Setenv("apitoken", "test-apitoken")
+	t.Setenv("ZDTS3_ACCESSKEYID", "test-accesskeyid")
+
+	// Ensure secret settings are withheld from hooks while other variables are passed on.
+	env := strings.Join(hookEnv(jobConfig{Name: "db"}, &runResult{}), "\n")
+	assert.False(t, strings.Contains(env, "test-secretaccesskey"))
+	assert.False(t, strings.Contains(env, "test-apitoken"))
+	assert.True(t, strings.Contains(env, "ZDTS3_ACCESSKEYID=test-accesskeyid"))
+	assert.True(t, strings.Contains(env, "ZDTS3_JOB=db"))
+}
+
+func TestCappedBuffer(t *testing.T) {
+	buf := &cappedBuffer{limit: 4}
+
+	// Ensure writes past the limit are discarded without failing the writer.
+	n, err := buf.Write([]byte("abc"))
+	assert.NoError(t, err)
+	assert.Equal(t, 3, n)
+	n, err = buf.Write([]byte("def"))
+	assert.NoError(t, err)
+	assert.Equal(t, 3, n)
+	assert.Equal(t, "abcd", buf.buf.String())
+	assert.True(t, buf.truncated)
+}
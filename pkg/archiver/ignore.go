@@ -0,0 +1,151 @@
+package archiver
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/rs/zerolog"
+)
+
+// ignoreFileName is the name of the gitignore-style files listing the files of a directory
+// and its subdirectories left out of archives.
+const ignoreFileName = ".zdts3ignore"
+
+// ignoreRule is a pattern of an ignore file.
+type ignoreRule struct {
+	// base is the slash separated archive name of the directory of the ignore file, empty
+	// for the source directory. Rules only apply to the files below it.
+	base    string
+	pattern *regexp.Regexp
+	// negate indicates files matching the pattern are archived again.
+	negate bool
+	// dirOnly indicates the pattern only matches directories.
+	dirOnly bool
+}
+
+// ignoreRules are the rules of the ignore files found while walking a source directory, in
+// the order they were found. The last rule matching a file decides whether it is ignored, so
+// rules of subdirectories take precedence over those of their parents.
+type ignoreRules struct {
+	rules []ignoreRule
+}
+
+// load adds the rules of the ignore file of the directory at the provided path, if any,
+// which has the provided archive name. Invalid patterns are skipped with a warning.
+func (r *ignoreRules) load(dir string, name string, logger *zerolog.Logger) error {
+	file, err := os.Open(filepath.Join(dir, ignoreFileName))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	base := name
+	if base == "." {
+		base = ""
+	}
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), " \t\r")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		rule := ignoreRule{base: base}
+		if strings.HasPrefix(line, "!") {
+			rule.negate = true
+			line = line[1:]
+		}
+		if strings.HasSuffix(line, "/") {
+			rule.dirOnly = true
+			line = strings.TrimSuffix(line, "/")
+		}
+
+		rule.pattern, err = compileIgnorePattern(line)
+		if err != nil {
+			logger.Warn().Err(err).Str("path", filepath.Join(dir, ignoreFileName)).Str("pattern", scanner.Text()).
+				Msg("Skipping invalid ignore pattern")
+			continue
+		}
+		r.rules = append(r.rules, rule)
+	}
+
+	return scanner.Err()
+}
+
+// ignored returns whether the file or directory with the provided archive name is ignored.
+func (r *ignoreRules) ignored(name string, dir bool) bool {
+	ignored := false
+	for _, rule := range r.rules {
+		rel := name
+		if rule.base != "" {
+			var ok bool
+			rel, ok = strings.CutPrefix(name, rule.base+"/")
+			if !ok {
+				continue
+			}
+		}
+
+		if (!rule.dirOnly || dir) && rule.pattern.MatchString(rel) {
+			ignored = !rule.negate
+		}
+	}
+
+	return ignored
+}
+
+// compileIgnorePattern compiles the provided gitignore-style pattern, without its negation
+// and trailing slash, into a regular expression matching slash separated paths relative to
+// the directory of its ignore file. Patterns without a slash match files at any depth,
+// patterns with one are relative to the directory of their ignore file. `*` and `?` match
+// within a path segment and `**` across segments.
+func compileIgnorePattern(pattern string) (*regexp.Regexp, error) {
+	var expr strings.Builder
+	expr.WriteString("^")
+	if !strings.Contains(pattern, "/") {
+		expr.WriteString("(?:.*/)?")
+	}
+	pattern = strings.TrimPrefix(pattern, "/")
+
+	for i := 0; i < len(pattern); i++ {
+		c := pattern[i]
+		switch {
+		case strings.HasPrefix(pattern[i:], "**/") && (i == 0 || pattern[i-1] == '/'):
+			expr.WriteString("(?:.*/)?")
+			i += 2
+		case strings.HasPrefix(pattern[i:], "**"):
+			expr.WriteString(".*")
+			i++
+		case c == '*':
+			expr.WriteString("[^/]*")
+		case c == '?':
+			expr.WriteString("[^/]")
+		case c == '\\' && i+1 < len(pattern):
+			i++
+			expr.WriteString(regexp.QuoteMeta(pattern[i : i+1]))
+		case c == '[':
+			end := strings.IndexByte(pattern[i+1:], ']')
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated character class in %q", pattern)
+			}
+			class := pattern[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			expr.WriteString("[" + strings.ReplaceAll(class, `\`, `\\`) + "]")
+			i += end + 1
+		default:
+			expr.WriteString(regexp.QuoteMeta(pattern[i : i+1]))
+		}
+	}
+	expr.WriteString("$")
+
+	return regexp.Compile(expr.String())
+}
@@ -0,0 +1,92 @@
+package archiver
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/peterldowns/testy/assert"
+	"github.com/rs/zerolog"
+)
+
+func TestCompileIgnorePattern(t *testing.T) {
+	tests := []struct {
+		pattern string
+		path    string
+		matches bool
+	}{
+		{pattern: "*.log", path: "app.log", matches: true},
+		{pattern: "*.log", path: "logs/app.log", matches: true},
+		{pattern: "*.log", path: "app.logs", matches: false},
+		{pattern: "/cache", path: "cache", matches: true},
+		{pattern: "/cache", path: "app/cache", matches: false},
+		{pattern: "app/*.tmp", path: "app/a.tmp", matches: true},
+		{pattern: "app/*.tmp", path: "app/sub/a.tmp", matches: false},
+		{pattern: "**/build", path: "a/b/build", matches: true},
+		{pattern: "**/build", path: "build", matches: true},
+		{pattern: "logs/**", path: "logs/a/b.txt", matches: true},
+		{pattern: "a/**/z", path: "a/z", matches: true},
+		{pattern: "a/**/z", path: "a/b/c/z", matches: true},
+		{pattern: "file?.txt", path: "file1.txt", matches: true},
+		{pattern: "file?.txt", path: "file10.txt", matches: false},
+		{pattern: "[!a]*.sql", path: "b.sql", matches: true},
+		{pattern: "[!a]*.sql", path: "a.sql", matches: false},
+		{pattern: `\#notes`, path: "#notes", matches: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.pattern+" "+test.path, func(t *testing.T) {
+			pattern, err := compileIgnorePattern(test.pattern)
+			assert.NoError(t, err)
+			assert.Equal(t, test.matches, pattern.MatchString(test.path))
+		})
+	}
+
+	_, err := compileIgnorePattern("[abc")
+	assert.Error(t, err)
+}
+
+func TestZipDirIgnore(t *testing.T) {
+	dir := t.TempDir()
+	logger := zerolog.Nop()
+	files := map[string]string{
+		ignoreFileName:                           "# Scratch files\n*.tmp\ncache/\n!keep.tmp\n",
+		"users.sql":                              "users",
+		"scratch.tmp":                            "scratch",
+		"keep.tmp":                               "keep",
+		"cache/index":                            "index",
+		"reports/q1.csv":                         "q1",
+		"reports/draft.csv":                      "draft",
+		"reports/" + ignoreFileName:              "draft.csv\n!*.tmp\n",
+		"reports/notes.tmp":                      "notes",
+		"reports/old/" + ignoreFileName + ".bak": "old",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		assert.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		assert.NoError(t, os.WriteFile(path, []byte(content), 0644))
+	}
+
+	zipPath := filepath.Join(t.TempDir(), "archive.zip")
+	archived, err := zipDir(context.Background(), dir, zipPath, zipOptions{}, &logger)
+	assert.NoError(t, err)
+
+	// Ensure ignored files and directories are left out, the rules of subdirectories taking
+	// precedence.
+	var names []string
+	for _, file := range archived {
+		names = append(names, file.Path)
+	}
+	slices.Sort(names)
+	assert.Equal(t, []string{
+		ignoreFileName,
+		"keep.tmp",
+		"reports/" + ignoreFileName,
+		"reports/notes.tmp",
+		"reports/old/" + ignoreFileName + ".bak",
+		"reports/q1.csv",
+		"users.sql",
+	}, names)
+}
@@ -0,0 +1,66 @@
+package archiver
+
+import (
+	"fmt"
+	"os"
+	"sync/atomic"
+
+	"github.com/minio/minio-go/v7"
+)
+
+// instanceMetadata is the user metadata key of uploaded archives holding the name of the
+// instance which uploaded them, sent as the x-amz-meta-zdts3-instance header.
+const instanceMetadata = "Zdts3-Instance"
+
+// configuredInstance is the configured instance ID, empty if unset.
+var configuredInstance atomic.Pointer[string]
+
+// validateInstanceID validates the provided instance ID, which is included in archive names
+// and metrics labels.
+func validateInstanceID(id string) error {
+	if id != "" && !labelPattern.MatchString(id) {
+		return fmt.Errorf("invalid instance ID %q, expected letters, digits, dots, dashes and underscores", id)
+	}
+
+	return nil
+}
+
+// setInstanceID sets the instance ID identifying this instance, the hostname if empty.
+func setInstanceID(id string) {
+	configuredInstance.Store(&id)
+}
+
+// instanceID returns the configured instance ID, empty if unset.
+func instanceID() string {
+	id := configuredInstance.Load()
+	if id == nil {
+		return ""
+	}
+
+	return *id
+}
+
+// instanceName returns the name identifying this instance in archive names, metadata,
+// metrics and notifications: the configured instance ID, or the hostname. Fleets of
+// identical machines sharing a hostname set an instance ID to be told apart.
+func instanceName() string {
+	if id := instanceID(); id != "" {
+		return id
+	}
+
+	hostname, err := os.Hostname()
+	if err != nil {
+		return "unknown"
+	}
+
+	return hostname
+}
+
+// setInstanceMetadata records the name of this instance in the user metadata of the
+// provided upload.
+func setInstanceMetadata(opts *minio.PutObjectOptions) {
+	if opts.UserMetadata == nil {
+		opts.UserMetadata = make(map[string]string)
+	}
+	opts.UserMetadata[instanceMetadata] = instanceName()
+}
@@ -0,0 +1,55 @@
+package archiver
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/peterldowns/testy/assert"
+)
+
+func TestInstanceID(t *testing.T) {
+	hostname, err := os.Hostname()
+	assert.NoError(t, err)
+
+	// Ensure the hostname identifies instances without an instance ID.
+	setInstanceID("")
+	defer setInstanceID("")
+	assert.Equal(t, hostname, instanceName())
+	assert.Equal(t, "", newRunEvent(eventStarted, &runResult{Job: "db"}).Instance)
+
+	// Ensure the instance ID is surfaced in archive names, notifications, events and
+	// metrics labels.
+	setInstanceID("appliance-7")
+	now := time.Date(2026, time.January, 1, 23, 50, 0, 0, time.UTC)
+	assert.Equal(t, "dump-appliance-7-prod-20260101235000.zip", archiveFileName("dump", "prod", now))
+	summary := runSummary(&runResult{Job: "db", Duration: time.Second})
+	assert.True(t, strings.HasPrefix(summary, "zdts3 job db on appliance-7 "))
+	event := newRunEvent(eventStarted, &runResult{Job: "db"})
+	assert.Equal(t, hostname, event.Host)
+	assert.Equal(t, "appliance-7", event.Instance)
+	assert.Equal(t, "appliance-7", newRunReport(&runResult{Job: "db"}).Instance)
+	assert.Equal(t, "appliance-7", newPushgateway("http://localhost:9091").instance)
+
+	cfg := Config{Statsd: "localhost:8125", StatsdTags: "env:prod", InstanceID: "appliance-7"}
+	reporters := cfg.reporters()
+	assert.Equal(t, []string{"env:prod", "instance:appliance-7"}, reporters[0].(*statsd).tags)
+
+	// Ensure uploaded archives carry the instance in their metadata.
+	fake := newFakeS3(t, "test-bucket")
+	store, err := newS3Storage(fake.s3Config("test-bucket"))
+	assert.NoError(t, err)
+	zipPath := filepath.Join(t.TempDir(), "dump.zip")
+	err = os.WriteFile(zipPath, zipBytes(t, map[string]string{"users.sql": "users"}), 0644)
+	assert.NoError(t, err)
+	_, err = store.PutFile(context.Background(), "dump.zip", zipPath)
+	assert.NoError(t, err)
+	assert.Equal(t, "appliance-7", fake.object("test-bucket", "dump.zip").header.Get("X-Amz-Meta-Zdts3-Instance"))
+
+	// Ensure invalid instance IDs are rejected.
+	assert.NoError(t, validateInstanceID("appliance-7"))
+	assert.Error(t, validateInstanceID("appliance 7"))
+}
@@ -0,0 +1,838 @@
+package archiver
+
+import (
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-co-op/gocron/v2"
+)
+
+const (
+	// defaultJobName is the name of the job created from the flat configuration.
+	defaultJobName = "default"
+	// defaultSchedule is the daily time archive jobs run at when no schedule is configured.
+	defaultSchedule = "23:50"
+)
+
+// jobConfig is the configuration of a named archive job.
+type jobConfig struct {
+	Name           string            `yaml:"name" toml:"name"`
+	SourceDir      string            `yaml:"sourcedir" toml:"sourcedir"`
+	Schedule       string            `yaml:"schedule,omitempty" toml:"schedule,omitempty"`
+	Priority       int               `yaml:"priority,omitempty" toml:"priority,omitempty"`
+	Weekdays       string            `yaml:"weekdays,omitempty" toml:"weekdays,omitempty"`
+	MonthDays      string            `yaml:"monthdays,omitempty" toml:"monthdays,omitempty"`
+	Jitter         string            `yaml:"jitter,omitempty" toml:"jitter,omitempty"`
+	Environment    string            `yaml:"environment,omitempty" toml:"environment,omitempty"`
+	Catchup        bool              `yaml:"catchup,omitempty" toml:"catchup,omitempty"`
+	Bucket         string            `yaml:"bucket,omitempty" toml:"bucket,omitempty"`
+	Prefix         string            `yaml:"prefix,omitempty" toml:"prefix,omitempty"`
+	Retention      string            `yaml:"retention,omitempty" toml:"retention,omitempty"`
+	PingURL        string            `yaml:"pingurl,omitempty" toml:"pingurl,omitempty"`
+	WatchFiles     int               `yaml:"watchfiles,omitempty" toml:"watchfiles,omitempty"`
+	WatchQuiet     string            `yaml:"watchquiet,omitempty" toml:"watchquiet,omitempty"`
+	PreRun         string            `yaml:"prerun,omitempty" toml:"prerun,omitempty"`
+	PostRun        string            `yaml:"postrun,omitempty" toml:"postrun,omitempty"`
+	Dump           *dumpConfig       `yaml:"dump,omitempty" toml:"dump,omitempty"`
+	Incremental    bool              `yaml:"incremental,omitempty" toml:"incremental,omitempty"`
+	Differential   string            `yaml:"differential,omitempty" toml:"differential,omitempty"`
+	Dedup          bool              `yaml:"dedup,omitempty" toml:"dedup,omitempty"`
+	SkipUnchanged  bool              `yaml:"skipunchanged,omitempty" toml:"skipunchanged,omitempty"`
+	SkipEmpty      bool              `yaml:"skipempty,omitempty" toml:"skipempty,omitempty"`
+	Delta          int               `yaml:"delta,omitempty" toml:"delta,omitempty"`
+	Symlinks       string            `yaml:"symlinks,omitempty" toml:"symlinks,omitempty"`
+	EmptyDirs      bool              `yaml:"emptydirs,omitempty" toml:"emptydirs,omitempty"`
+	HardLinks      bool              `yaml:"hardlinks,omitempty" toml:"hardlinks,omitempty"`
+	Xattrs         bool              `yaml:"xattrs,omitempty" toml:"xattrs,omitempty"`
+	SQLite         bool              `yaml:"sqlite,omitempty" toml:"sqlite,omitempty"`
+	Snapshot       string            `yaml:"snapshot,omitempty" toml:"snapshot,omitempty"`
+	SnapshotDir    string            `yaml:"snapshotdir,omitempty" toml:"snapshotdir,omitempty"`
+	FSSnapshot     string            `yaml:"fssnapshot,omitempty" toml:"fssnapshot,omitempty"`
+	RequireMount   bool              `yaml:"requiremount,omitempty" toml:"requiremount,omitempty"`
+	Sentinel       string            `yaml:"sentinel,omitempty" toml:"sentinel,omitempty"`
+	FileChecksums  bool              `yaml:"filechecksums,omitempty" toml:"filechecksums,omitempty"`
+	Subdirs        bool              `yaml:"subdirs,omitempty" toml:"subdirs,omitempty"`
+	Workers        int               `yaml:"workers,omitempty" toml:"workers,omitempty"`
+	Parity         int               `yaml:"parity,omitempty" toml:"parity,omitempty"`
+	Compression    []compressionRule `yaml:"compression,omitempty" toml:"compression,omitempty"`
+	DiskRatio      float64           `yaml:"diskratio,omitempty" toml:"diskratio,omitempty"`
+	DiskMargin     string            `yaml:"diskmargin,omitempty" toml:"diskmargin,omitempty"`
+	MaxStagingSize string            `yaml:"maxstagingsize,omitempty" toml:"maxstagingsize,omitempty"`
+	MinFiles       int               `yaml:"minfiles,omitempty" toml:"minfiles,omitempty"`
+	MinBytes       string            `yaml:"minbytes,omitempty" toml:"minbytes,omitempty"`
+	VerifySample   int               `yaml:"verifysample,omitempty" toml:"verifysample,omitempty"`
+	MaxFileSize    string            `yaml:"maxfilesize,omitempty" toml:"maxfilesize,omitempty"`
+	MaxBucketUsage string            `yaml:"maxbucketusage,omitempty" toml:"maxbucketusage,omitempty"`
+	QuotaPolicy    string            `yaml:"quotapolicy,omitempty" toml:"quotapolicy,omitempty"`
+	StaleArchives  string            `yaml:"stalearchives,omitempty" toml:"stalearchives,omitempty"`
+	// ObjectLockMode and ObjectLockPeriod set the object lock retention of the job's
+	// archives.
+	ObjectLockMode   string `yaml:"objectlockmode,omitempty" toml:"objectlockmode,omitempty"`
+	ObjectLockPeriod string `yaml:"objectlockperiod,omitempty" toml:"objectlockperiod,omitempty"`
+}
+
+// neverRun is the start time of jobs which only run when triggered, such as watched jobs
+// without a schedule. It is far enough in the future to never be reached.
+var neverRun = time.Date(9999, time.December, 31, 0, 0, 0, 0, time.UTC)
+
+// purgeNothing is the purge filter of jobs without an archived run to purge the files of,
+// no file is modified before it.
+var purgeNothing = time.UnixMilli(0)
+
+// parseAtTime parses a daily time of the form HH:MM or HH:MM:SS into the time since midnight.
+func parseAtTime(value string) (time.Duration, error) {
+	parts := strings.Split(strings.TrimSpace(value), ":")
+	if len(parts) < 2 || len(parts) > 3 {
+		return 0, fmt.Errorf("invalid time %q, expected HH:MM or HH:MM:SS", value)
+	}
+
+	limits := []int{23, 59, 59}
+	units := []time.Duration{time.Hour, time.Minute, time.Second}
+	var atTime time.Duration
+	for i, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 || n > limits[i] {
+			return 0, fmt.Errorf("invalid time %q, expected HH:MM or HH:MM:SS", value)
+		}
+		atTime += time.Duration(n) * units[i]
+	}
+
+	return atTime, nil
+}
+
+// parseAtTimes parses a comma separated list of daily times of the form HH:MM or HH:MM:SS.
+func parseAtTimes(value string) ([]time.Duration, error) {
+	var atTimes []time.Duration
+	for _, part := range strings.Split(value, ",") {
+		atTime, err := parseAtTime(part)
+		if err != nil {
+			return nil, err
+		}
+		atTimes = append(atTimes, atTime)
+	}
+
+	return atTimes, nil
+}
+
+// parseWeekdays parses a comma separated list of weekdays.
+func parseWeekdays(value string) ([]time.Weekday, error) {
+	var weekdays []time.Weekday
+	for _, part := range strings.Split(value, ",") {
+		day, err := parseWeekday(part)
+		if err != nil {
+			return nil, err
+		}
+		weekdays = append(weekdays, day)
+	}
+
+	return weekdays, nil
+}
+
+// parseMonthDays parses a comma separated list of days of the month. Negative days count
+// back from the end of the month, -1 is the last day.
+func parseMonthDays(value string) ([]int, error) {
+	var days []int
+	for _, part := range strings.Split(value, ",") {
+		day, err := strconv.Atoi(strings.TrimSpace(part))
+		if err != nil || day == 0 || day < -31 || day > 31 {
+			return nil, fmt.Errorf("invalid day of the month %q, expected 1 to 31 or -31 to -1", part)
+		}
+		days = append(days, day)
+	}
+
+	return days, nil
+}
+
+// validateJitter validates the provided jitter window, which must be shorter than half a
+// day.
+func validateJitter(value string) error {
+	jitter, err := time.ParseDuration(value)
+	if err != nil || jitter < 0 || jitter >= 12*time.Hour {
+		return fmt.Errorf("invalid jitter %q, expected a duration below 12h", value)
+	}
+
+	return nil
+}
+
+// parseRetention parses a retention duration. In addition to Go durations, a number of days
+// can be provided with a d suffix (e.g. 7d).
+func parseRetention(value string) (time.Duration, error) {
+	if strings.HasSuffix(value, "d") {
+		days, err := strconv.Atoi(strings.TrimSuffix(value, "d"))
+		if err != nil || days < 0 {
+			return 0, fmt.Errorf("invalid retention %q", value)
+		}
+
+		return time.Duration(days) * 24 * time.Hour, nil
+	}
+
+	retention, err := time.ParseDuration(value)
+	if err != nil || retention < 0 {
+		return 0, fmt.Errorf("invalid retention %q", value)
+	}
+
+	return retention, nil
+}
+
+// schedule returns the configured daily run times of the job.
+func (j *jobConfig) schedule() string {
+	if j.Schedule == "" {
+		return defaultSchedule
+	}
+
+	return j.Schedule
+}
+
+// workers returns the number of subdirectories archived at a time by the job.
+func (j *jobConfig) workers() int {
+	return max(j.Workers, 1)
+}
+
+// watching returns whether runs of the job are triggered by changes of its source
+// directory.
+func (j *jobConfig) watching() bool {
+	return j.WatchFiles > 0 || j.WatchQuiet != ""
+}
+
+// watchQuiet returns the duration without changes of the source directory after which a
+// run is triggered, zero if runs are not triggered by quiet periods.
+func (j *jobConfig) watchQuiet() time.Duration {
+	quiet, err := time.ParseDuration(j.WatchQuiet)
+	if err != nil {
+		return 0
+	}
+
+	return quiet
+}
+
+// jitter returns the maximum offset of the job's run times from its schedule.
+func (j *jobConfig) jitter() time.Duration {
+	jitter, err := time.ParseDuration(j.Jitter)
+	if err != nil || jitter < 0 {
+		return 0
+	}
+
+	return jitter
+}
+
+// jitterOffset returns a random offset within the job's jitter window.
+func (j *jobConfig) jitterOffset() time.Duration {
+	jitter := j.jitter()
+	if jitter == 0 {
+		return 0
+	}
+
+	return rand.N(2*jitter+1) - jitter
+}
+
+// jobDefinition returns the gocron job definition for the job's schedule, daily unless
+// weekdays or days of the month are configured, with its run times moved by the provided
+// offset. Watched jobs without a schedule only run when triggered.
+func (j *jobConfig) jobDefinition(offset time.Duration) (gocron.JobDefinition, error) {
+	if j.watching() && j.Schedule == "" && j.Weekdays == "" && j.MonthDays == "" {
+		return gocron.OneTimeJob(gocron.OneTimeJobStartDateTime(neverRun)), nil
+	}
+
+	atTimes, err := parseAtTimes(j.schedule())
+	if err != nil {
+		return nil, err
+	}
+
+	// Daily run times wrap around midnight, the others stay on their day.
+	gocronTimes := make([]gocron.AtTime, len(atTimes))
+	for i, atTime := range atTimes {
+		atTime += offset
+		if j.Weekdays == "" && j.MonthDays == "" {
+			atTime = (atTime%(24*time.Hour) + 24*time.Hour) % (24 * time.Hour)
+		} else {
+			atTime = min(max(atTime, 0), 24*time.Hour-time.Second)
+		}
+
+		gocronTimes[i] = gocron.NewAtTime(uint(atTime/time.Hour), uint(atTime%time.Hour/time.Minute),
+			uint(atTime%time.Minute/time.Second))
+	}
+	at := gocron.NewAtTimes(gocronTimes[0], gocronTimes[1:]...)
+
+	switch {
+	case j.Weekdays != "":
+		weekdays, err := parseWeekdays(j.Weekdays)
+		if err != nil {
+			return nil, err
+		}
+
+		return gocron.WeeklyJob(1, gocron.NewWeekdays(weekdays[0], weekdays[1:]...), at), nil
+
+	case j.MonthDays != "":
+		days, err := parseMonthDays(j.MonthDays)
+		if err != nil {
+			return nil, err
+		}
+
+		return gocron.MonthlyJob(1, gocron.NewDaysOfTheMonth(days[0], days[1:]...), at), nil
+
+	default:
+		return gocron.DailyJob(1, at), nil
+	}
+}
+
+// runCalendar returns the sorted daily run times of the job's schedule and a function
+// reporting whether runs are scheduled on the provided day. It returns false for jobs
+// without a valid schedule, such as watched jobs without one.
+func (j *jobConfig) runCalendar() ([]time.Duration, func(day time.Time) bool, bool) {
+	if j.watching() && j.Schedule == "" && j.Weekdays == "" && j.MonthDays == "" {
+		return nil, nil, false
+	}
+
+	atTimes, err := parseAtTimes(j.schedule())
+	if err != nil {
+		return nil, nil, false
+	}
+	slices.Sort(atTimes)
+
+	var weekdays []time.Weekday
+	if j.Weekdays != "" {
+		weekdays, err = parseWeekdays(j.Weekdays)
+		if err != nil {
+			return nil, nil, false
+		}
+	}
+
+	var monthDays []int
+	if j.MonthDays != "" {
+		monthDays, err = parseMonthDays(j.MonthDays)
+		if err != nil {
+			return nil, nil, false
+		}
+	}
+
+	runDay := func(day time.Time) bool {
+		if len(weekdays) > 0 && !slices.Contains(weekdays, day.Weekday()) {
+			return false
+		}
+		if len(monthDays) > 0 {
+			last := time.Date(day.Year(), day.Month()+1, 0, 0, 0, 0, 0, day.Location()).Day()
+			if !slices.Contains(monthDays, day.Day()) && !slices.Contains(monthDays, day.Day()-last-1) {
+				return false
+			}
+		}
+
+		return true
+	}
+
+	return atTimes, runDay, true
+}
+
+// runAt returns the run time at the provided time since midnight of the provided day.
+func runAt(day time.Time, atTime time.Duration) time.Time {
+	return time.Date(day.Year(), day.Month(), day.Day(), int(atTime/time.Hour),
+		int(atTime%time.Hour/time.Minute), int(atTime%time.Minute/time.Second), 0, day.Location())
+}
+
+// nextRun returns the first run time of the job's schedule after the provided time, in the
+// provided timezone and without jitter. Watched jobs without a schedule never run.
+func (j *jobConfig) nextRun(after time.Time, loc *time.Location) time.Time {
+	atTimes, runDay, ok := j.runCalendar()
+	if !ok {
+		return neverRun
+	}
+
+	// Days of the month past the end of shorter months are skipped, so look up to a year
+	// ahead.
+	after = after.In(loc)
+	for i := 0; i <= 366; i++ {
+		day := time.Date(after.Year(), after.Month(), after.Day()+i, 0, 0, 0, 0, loc)
+		if !runDay(day) {
+			continue
+		}
+
+		for _, atTime := range atTimes {
+			run := runAt(day, atTime)
+			if run.After(after) {
+				return run
+			}
+		}
+	}
+
+	return neverRun
+}
+
+// prevRun returns the last run time of the job's schedule at or before the provided time, in the
+// provided timezone and without jitter. It returns the zero time for jobs which never run
+// on a schedule.
+func (j *jobConfig) prevRun(before time.Time, loc *time.Location) time.Time {
+	atTimes, runDay, ok := j.runCalendar()
+	if !ok {
+		return time.Time{}
+	}
+
+	before = before.In(loc)
+	for i := 0; i <= 366; i++ {
+		day := time.Date(before.Year(), before.Month(), before.Day()-i, 0, 0, 0, 0, loc)
+		if !runDay(day) {
+			continue
+		}
+
+		for k := len(atTimes) - 1; k >= 0; k-- {
+			run := runAt(day, atTimes[k])
+			if !run.After(before) {
+				return run
+			}
+		}
+	}
+
+	return time.Time{}
+}
+
+// missedRun returns whether a scheduled run of the job was missed between its last
+// successful run and the provided time. Runs moved by jitter count as on schedule.
+func (j *jobConfig) missedRun(lastSuccess time.Time, now time.Time) bool {
+	jitter := j.jitter()
+	next := j.nextRun(lastSuccess.Add(jitter), now.Location())
+
+	return next.Add(jitter).Before(now)
+}
+
+// purgeFilter returns the time before which files are purged from the job's source
+// directory. Without a configured retention, files are kept until a run archived them: the
+// filter is the start of the job's last successful run, provided as lastArchived, or
+// without one the scheduled run preceding the current one, widened by the job's jitter.
+// Jobs without either, such as watched jobs without a schedule, purge nothing until a run
+// succeeded.
+func (j *jobConfig) purgeFilter(now time.Time, lastArchived time.Time) time.Time {
+	if j.Retention != "" {
+		retention, err := parseRetention(j.Retention)
+		if err == nil {
+			return now.Add(-retention)
+		}
+	}
+
+	if !lastArchived.IsZero() {
+		return lastArchived
+	}
+
+	// The current run may have been moved ahead of its scheduled time by the jitter.
+	jitter := j.jitter()
+	current := j.prevRun(now.Add(jitter), now.Location())
+	if current.IsZero() {
+		return purgeNothing
+	}
+
+	prev := j.prevRun(current.Add(-time.Second), now.Location())
+	if prev.IsZero() {
+		return purgeNothing
+	}
+
+	return prev.Add(-jitter)
+}
+
+// validate ensures that the job configuration is valid.
+func (j *jobConfig) validate() error {
+	var errs error
+
+	if j.Name == "" {
+		errs = errors.Join(errs, fmt.Errorf("job name required"))
+	}
+
+	if j.SourceDir == "" {
+		errs = errors.Join(errs, fmt.Errorf("job %q: source directory required", j.Name))
+	}
+
+	_, err := parseAtTimes(j.schedule())
+	if err != nil {
+		errs = errors.Join(errs, fmt.Errorf("job %q: %w", j.Name, err))
+	}
+
+	if j.Weekdays != "" {
+		_, err := parseWeekdays(j.Weekdays)
+		if err != nil {
+			errs = errors.Join(errs, fmt.Errorf("job %q: weekly schedule: %w", j.Name, err))
+		}
+
+		if j.MonthDays != "" {
+			errs = errors.Join(errs, fmt.Errorf("job %q: weekly and monthly schedules are exclusive", j.Name))
+		}
+	}
+
+	if j.MonthDays != "" {
+		_, err := parseMonthDays(j.MonthDays)
+		if err != nil {
+			errs = errors.Join(errs, fmt.Errorf("job %q: monthly schedule: %w", j.Name, err))
+		}
+	}
+
+	if j.Retention != "" {
+		_, err := parseRetention(j.Retention)
+		if err != nil {
+			errs = errors.Join(errs, fmt.Errorf("job %q: %w", j.Name, err))
+		}
+	}
+
+	if j.PingURL != "" {
+		err := validateURL("ping", j.PingURL)
+		if err != nil {
+			errs = errors.Join(errs, fmt.Errorf("job %q: %w", j.Name, err))
+		}
+	}
+
+	if j.Dump != nil {
+		err := j.Dump.validate()
+		if err != nil {
+			errs = errors.Join(errs, fmt.Errorf("job %q: %w", j.Name, err))
+		}
+	}
+
+	if j.Differential != "" {
+		_, err := parseWeekday(j.Differential)
+		if err != nil {
+			errs = errors.Join(errs, fmt.Errorf("job %q: differential backups: %w", j.Name, err))
+		}
+
+		if j.Incremental {
+			errs = errors.Join(errs, fmt.Errorf("job %q: incremental and differential backups are exclusive", j.Name))
+		}
+	}
+
+	if j.Delta < 0 {
+		errs = errors.Join(errs, fmt.Errorf("job %q: invalid delta count %d", j.Name, j.Delta))
+	}
+
+	if j.Delta > 0 && (j.Incremental || j.Differential != "" || j.Dedup) {
+		errs = errors.Join(errs, fmt.Errorf("job %q: delta archives are exclusive with incremental, differential and deduplicated backups", j.Name))
+	}
+
+	err = validateSymlinks(j.Symlinks)
+	if err != nil {
+		errs = errors.Join(errs, fmt.Errorf("job %q: %w", j.Name, err))
+	}
+
+	err = validateSnapshot(j.Snapshot)
+	if err != nil {
+		errs = errors.Join(errs, fmt.Errorf("job %q: %w", j.Name, err))
+	}
+
+	err = validateFSSnapshot(j.FSSnapshot)
+	if err != nil {
+		errs = errors.Join(errs, fmt.Errorf("job %q: %w", j.Name, err))
+	}
+	if j.Snapshot != "" && j.FSSnapshot != "" {
+		errs = errors.Join(errs, fmt.Errorf("job %q: snapshot and fssnapshot are mutually exclusive", j.Name))
+	}
+
+	err = validateStaleArchives(j.StaleArchives)
+	if err != nil {
+		errs = errors.Join(errs, fmt.Errorf("job %q: %w", j.Name, err))
+	}
+
+	if j.DiskRatio < 0 {
+		errs = errors.Join(errs, fmt.Errorf("job %q: invalid disk ratio %g", j.Name, j.DiskRatio))
+	}
+
+	if j.DiskMargin != "" {
+		_, err := parseSize(j.DiskMargin)
+		if err != nil {
+			errs = errors.Join(errs, fmt.Errorf("job %q: disk margin: %w", j.Name, err))
+		}
+	}
+
+	if j.MaxStagingSize != "" {
+		_, err := parseSize(j.MaxStagingSize)
+		if err != nil {
+			errs = errors.Join(errs, fmt.Errorf("job %q: max staging size: %w", j.Name, err))
+		}
+	}
+
+	err = validateSentinel(j.Sentinel)
+	if err != nil {
+		errs = errors.Join(errs, fmt.Errorf("job %q: %w", j.Name, err))
+	}
+
+	if j.MinFiles < 0 {
+		errs = errors.Join(errs, fmt.Errorf("job %q: invalid minimum file count %d", j.Name, j.MinFiles))
+	}
+
+	if j.VerifySample < 0 {
+		errs = errors.Join(errs, fmt.Errorf("job %q: invalid verification sample %d", j.Name, j.VerifySample))
+	}
+
+	if j.MinBytes != "" {
+		_, err := parseSize(j.MinBytes)
+		if err != nil {
+			errs = errors.Join(errs, fmt.Errorf("job %q: minimum archive size: %w", j.Name, err))
+		}
+	}
+
+	if j.MaxFileSize != "" {
+		_, err := parseSize(j.MaxFileSize)
+		if err != nil {
+			errs = errors.Join(errs, fmt.Errorf("job %q: max file size: %w", j.Name, err))
+		}
+	}
+
+	if j.MaxBucketUsage != "" {
+		_, err := parseSize(j.MaxBucketUsage)
+		if err != nil {
+			errs = errors.Join(errs, fmt.Errorf("job %q: max bucket usage: %w", j.Name, err))
+		}
+
+		// The chunks of deduplicated archives are shared, their usage cannot be pruned per
+		// archive.
+		if j.Dedup {
+			errs = errors.Join(errs, fmt.Errorf("job %q: max bucket usage and deduplicated backups are exclusive", j.Name))
+		}
+	}
+
+	err = validateQuotaPolicy(j.QuotaPolicy)
+	if err != nil {
+		errs = errors.Join(errs, fmt.Errorf("job %q: %w", j.Name, err))
+	}
+
+	if j.Subdirs && j.Dump != nil {
+		errs = errors.Join(errs, fmt.Errorf("job %q: subdirectory archives and database dumps are exclusive", j.Name))
+	}
+
+	if j.WatchFiles < 0 {
+		errs = errors.Join(errs, fmt.Errorf("job %q: invalid watch file count %d", j.Name, j.WatchFiles))
+	}
+
+	if j.Workers < 0 {
+		errs = errors.Join(errs, fmt.Errorf("job %q: invalid worker count %d", j.Name, j.Workers))
+	}
+
+	if j.Parity < 0 || j.Parity > 100 {
+		errs = errors.Join(errs, fmt.Errorf("job %q: invalid parity percentage %d, expected 0 to 100", j.Name, j.Parity))
+	}
+
+	err = validateCompression(j.Compression)
+	if err != nil {
+		errs = errors.Join(errs, fmt.Errorf("job %q: %w", j.Name, err))
+	}
+
+	if j.WatchQuiet != "" {
+		err := validateWatchQuiet(j.WatchQuiet)
+		if err != nil {
+			errs = errors.Join(errs, fmt.Errorf("job %q: %w", j.Name, err))
+		}
+	}
+
+	if j.Jitter != "" {
+		err := validateJitter(j.Jitter)
+		if err != nil {
+			errs = errors.Join(errs, fmt.Errorf("job %q: %w", j.Name, err))
+		}
+	}
+
+	err = validateEnvironment(j.Environment)
+	if err != nil {
+		errs = errors.Join(errs, fmt.Errorf("job %q: %w", j.Name, err))
+	}
+
+	err = validateObjectLock(j.ObjectLockMode, j.ObjectLockPeriod)
+	if err != nil {
+		errs = errors.Join(errs, fmt.Errorf("job %q: %w", j.Name, err))
+	}
+
+	// Deduplicated chunks are shared by archives, they cannot be retained per archive.
+	if j.ObjectLockMode != "" && j.Dedup {
+		errs = errors.Join(errs, fmt.Errorf("job %q: object lock and deduplicated backups are exclusive", j.Name))
+	}
+
+	return errs
+}
+
+// objectRetention returns the object lock retention of the job's archives, nil if they are
+// not locked.
+func (j *jobConfig) objectRetention() *objectRetention {
+	if j.ObjectLockMode == "" {
+		return nil
+	}
+
+	mode, err := parseObjectLockMode(j.ObjectLockMode)
+	if err != nil {
+		return nil
+	}
+	period, err := parseRetention(j.ObjectLockPeriod)
+	if err != nil {
+		return nil
+	}
+
+	return &objectRetention{Mode: mode, Period: period}
+}
+
+// jobs returns the archive jobs of the configuration. Without configured jobs, a single
+// default job is created from the flat source directory and bucket settings.
+func (c *Config) jobs() []jobConfig {
+	// Invalid watch file counts are reported by validation.
+	watchFiles, _ := strconv.Atoi(c.WatchFiles)
+	workers, _ := strconv.Atoi(c.Workers)
+	minFiles, _ := strconv.Atoi(c.MinFiles)
+	verifySample, _ := strconv.Atoi(c.VerifySample)
+	parity, _ := strconv.Atoi(c.Parity)
+	deltas, _ := strconv.Atoi(c.Delta)
+	diskRatio, _ := strconv.ParseFloat(c.DiskRatio, 64)
+
+	if len(c.Jobs) == 0 {
+		var dump *dumpConfig
+		if c.DumpCommand != "" || c.DumpFile != "" {
+			dump = &dumpConfig{Command: c.DumpCommand, File: c.DumpFile}
+		}
+
+		return []jobConfig{{
+			Name:             defaultJobName,
+			SourceDir:        c.SourceDir,
+			Bucket:           c.Bucket,
+			PingURL:          c.PingURL,
+			WatchFiles:       watchFiles,
+			WatchQuiet:       c.WatchQuiet,
+			Jitter:           c.Jitter,
+			Environment:      c.Environment,
+			Catchup:          c.catchup(),
+			PreRun:           c.PreRun,
+			PostRun:          c.PostRun,
+			Dump:             dump,
+			Incremental:      c.incremental(),
+			Differential:     c.Differential,
+			Dedup:            c.dedup(),
+			SkipUnchanged:    c.skipUnchanged(),
+			SkipEmpty:        c.skipEmpty(),
+			Delta:            deltas,
+			Symlinks:         c.Symlinks,
+			EmptyDirs:        c.emptyDirs(),
+			HardLinks:        c.hardLinks(),
+			Xattrs:           c.xattrs(),
+			SQLite:           c.sqlite(),
+			Snapshot:         c.Snapshot,
+			SnapshotDir:      c.SnapshotDir,
+			FSSnapshot:       c.FSSnapshot,
+			RequireMount:     c.requireMount(),
+			Sentinel:         c.Sentinel,
+			FileChecksums:    c.fileChecksums(),
+			Subdirs:          c.subdirs(),
+			Workers:          workers,
+			Parity:           parity,
+			Compression:      c.Compression,
+			DiskRatio:        diskRatio,
+			DiskMargin:       c.DiskMargin,
+			MaxStagingSize:   c.MaxStagingSize,
+			MinFiles:         minFiles,
+			MinBytes:         c.MinBytes,
+			VerifySample:     verifySample,
+			MaxFileSize:      c.MaxFileSize,
+			MaxBucketUsage:   c.MaxBucketUsage,
+			QuotaPolicy:      c.QuotaPolicy,
+			StaleArchives:    c.StaleArchives,
+			ObjectLockMode:   c.ObjectLockMode,
+			ObjectLockPeriod: c.ObjectLockPeriod,
+		}}
+	}
+
+	jobs := make([]jobConfig, len(c.Jobs))
+	for i, job := range c.Jobs {
+		if job.Bucket == "" {
+			job.Bucket = c.Bucket
+		}
+		if job.PingURL == "" {
+			job.PingURL = c.PingURL
+		}
+		if job.WatchFiles == 0 {
+			job.WatchFiles = watchFiles
+		}
+		if job.WatchQuiet == "" {
+			job.WatchQuiet = c.WatchQuiet
+		}
+		if job.Jitter == "" {
+			job.Jitter = c.Jitter
+		}
+		if job.Environment == "" {
+			job.Environment = c.Environment
+		}
+		job.Catchup = job.Catchup || c.catchup()
+		if job.PreRun == "" {
+			job.PreRun = c.PreRun
+		}
+		if job.PostRun == "" {
+			job.PostRun = c.PostRun
+		}
+		job.Incremental = job.Incremental || c.incremental()
+		if job.Differential == "" && !job.Incremental {
+			job.Differential = c.Differential
+		}
+		job.Dedup = job.Dedup || c.dedup()
+		job.SkipUnchanged = job.SkipUnchanged || c.skipUnchanged()
+		job.SkipEmpty = job.SkipEmpty || c.skipEmpty()
+		if job.Delta == 0 && !job.chained() && !job.Dedup {
+			job.Delta = deltas
+		}
+		if job.Symlinks == "" {
+			job.Symlinks = c.Symlinks
+		}
+		job.EmptyDirs = job.EmptyDirs || c.emptyDirs()
+		job.HardLinks = job.HardLinks || c.hardLinks()
+		job.Xattrs = job.Xattrs || c.xattrs()
+		job.SQLite = job.SQLite || c.sqlite()
+		if job.Snapshot == "" {
+			job.Snapshot = c.Snapshot
+		}
+		if job.SnapshotDir == "" {
+			job.SnapshotDir = c.SnapshotDir
+		}
+		if job.FSSnapshot == "" {
+			job.FSSnapshot = c.FSSnapshot
+		}
+		job.RequireMount = job.RequireMount || c.requireMount()
+		if job.Sentinel == "" {
+			job.Sentinel = c.Sentinel
+		}
+		job.FileChecksums = job.FileChecksums || c.fileChecksums()
+		job.Subdirs = job.Subdirs || c.subdirs()
+		if job.Workers == 0 {
+			job.Workers = workers
+		}
+		if job.Parity == 0 {
+			job.Parity = parity
+		}
+		if job.Compression == nil {
+			job.Compression = c.Compression
+		}
+		if job.DiskRatio == 0 {
+			job.DiskRatio = diskRatio
+		}
+		if job.DiskMargin == "" {
+			job.DiskMargin = c.DiskMargin
+		}
+		if job.MaxStagingSize == "" {
+			job.MaxStagingSize = c.MaxStagingSize
+		}
+		if job.MinFiles == 0 {
+			job.MinFiles = minFiles
+		}
+		if job.MinBytes == "" {
+			job.MinBytes = c.MinBytes
+		}
+		if job.VerifySample == 0 {
+			job.VerifySample = verifySample
+		}
+		if job.MaxFileSize == "" {
+			job.MaxFileSize = c.MaxFileSize
+		}
+		if job.MaxBucketUsage == "" {
+			job.MaxBucketUsage = c.MaxBucketUsage
+		}
+		if job.QuotaPolicy == "" {
+			job.QuotaPolicy = c.QuotaPolicy
+		}
+		if job.StaleArchives == "" {
+			job.StaleArchives = c.StaleArchives
+		}
+		if job.ObjectLockMode == "" && job.ObjectLockPeriod == "" {
+			job.ObjectLockMode, job.ObjectLockPeriod = c.ObjectLockMode, c.ObjectLockPeriod
+		}
+		jobs[i] = job
+	}
+
+	return jobs
+}
@@ -0,0 +1,358 @@
+package archiver
+
+import (
+	"testing"
+	"time"
+
+	"github.com/go-co-op/gocron/v2"
+	"github.com/peterldowns/testy/assert"
+)
+
+func TestParseAtTime(t *testing.T) {
+	tests := []struct {
+		value    string
+		hasError bool
+	}{
+		{value: "23:50", hasError: false},
+		{value: "06:00:30", hasError: false},
+		{value: "24:00", hasError: true},
+		{value: "12:60", hasError: true},
+		{value: "12", hasError: true},
+		{value: "ab:cd", hasError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			_, err := parseAtTime(tt.value)
+			if tt.hasError {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestParseAtTimes(t *testing.T) {
+	atTimes, err := parseAtTimes("06:00, 14:00,23:50")
+	assert.NoError(t, err)
+	assert.Equal(t, 3, len(atTimes))
+
+	atTimes, err = parseAtTimes("23:50")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(atTimes))
+
+	_, err = parseAtTimes("06:00,25:00")
+	assert.Error(t, err)
+
+	_, err = parseAtTimes("06:00,")
+	assert.Error(t, err)
+}
+
+func TestParseWeekdays(t *testing.T) {
+	weekdays, err := parseWeekdays("sun, Wednesday")
+	assert.NoError(t, err)
+	assert.Equal(t, []time.Weekday{time.Sunday, time.Wednesday}, weekdays)
+
+	_, err = parseWeekdays("sun,someday")
+	assert.Error(t, err)
+}
+
+func TestParseMonthDays(t *testing.T) {
+	days, err := parseMonthDays("1, 15,-1")
+	assert.NoError(t, err)
+	assert.Equal(t, []int{1, 15, -1}, days)
+
+	for _, value := range []string{"0", "32", "-32", "first"} {
+		_, err := parseMonthDays(value)
+		assert.Error(t, err)
+	}
+}
+
+func TestParseRetention(t *testing.T) {
+	retention, err := parseRetention("7d")
+	assert.NoError(t, err)
+	assert.Equal(t, 7*24*time.Hour, retention)
+
+	retention, err = parseRetention("36h")
+	assert.NoError(t, err)
+	assert.Equal(t, 36*time.Hour, retention)
+
+	_, err = parseRetention("-1d")
+	assert.Error(t, err)
+
+	_, err = parseRetention("soon")
+	assert.Error(t, err)
+}
+
+func TestPurgeFilter(t *testing.T) {
+	now := time.Date(2025, 3, 10, 23, 50, 0, 0, time.UTC)
+
+	// Ensure the default filter is the previous scheduled run.
+	job := jobConfig{Name: "test"}
+	assert.Equal(t, time.Date(2025, 3, 9, 23, 50, 0, 0, time.UTC), job.purgeFilter(now, time.Time{}))
+
+	// Ensure the filter is the previous run in the timezone of the current time.
+	loc, err := time.LoadLocation("Asia/Tokyo")
+	assert.NoError(t, err)
+	runTime := time.Date(2025, 3, 11, 23, 50, 0, 0, loc)
+	assert.Equal(t, time.Date(2025, 3, 10, 23, 50, 0, 0, loc), job.purgeFilter(runTime, time.Time{}))
+
+	// Ensure other schedules keep the files written since their previous run.
+	job = jobConfig{Name: "test", Schedule: "02:00"}
+	runTime = time.Date(2025, 3, 10, 2, 0, 1, 0, time.UTC)
+	assert.Equal(t, time.Date(2025, 3, 9, 2, 0, 0, 0, time.UTC), job.purgeFilter(runTime, time.Time{}))
+	job = jobConfig{Name: "test", Schedule: "06:00,18:00"}
+	runTime = time.Date(2025, 3, 10, 18, 0, 0, 0, time.UTC)
+	assert.Equal(t, time.Date(2025, 3, 10, 6, 0, 0, 0, time.UTC), job.purgeFilter(runTime, time.Time{}))
+	runTime = time.Date(2025, 3, 10, 6, 0, 0, 0, time.UTC)
+	assert.Equal(t, time.Date(2025, 3, 9, 18, 0, 0, 0, time.UTC), job.purgeFilter(runTime, time.Time{}))
+
+	// Ensure weekly and monthly jobs keep the files of their period.
+	job = jobConfig{Name: "test", Weekdays: "sun"}
+	runTime = time.Date(2025, 3, 9, 23, 50, 0, 0, time.UTC)
+	assert.Equal(t, time.Date(2025, 3, 2, 23, 50, 0, 0, time.UTC), job.purgeFilter(runTime, time.Time{}))
+	job = jobConfig{Name: "test", MonthDays: "1"}
+	runTime = time.Date(2025, 3, 1, 23, 50, 0, 0, time.UTC)
+	assert.Equal(t, time.Date(2025, 2, 1, 23, 50, 0, 0, time.UTC), job.purgeFilter(runTime, time.Time{}))
+
+	// Ensure runs triggered between scheduled runs keep the files since the run before the
+	// last scheduled one, which may not have been archived yet.
+	assert.Equal(t, time.Date(2025, 2, 1, 23, 50, 0, 0, time.UTC), job.purgeFilter(now, time.Time{}))
+
+	// Ensure jittered runs keep the files of the whole jitter window, also past midnight.
+	job = jobConfig{Name: "test", Jitter: "10m"}
+	runTime = time.Date(2025, 3, 10, 23, 40, 0, 0, time.UTC)
+	assert.Equal(t, time.Date(2025, 3, 9, 23, 40, 0, 0, time.UTC), job.purgeFilter(runTime, time.Time{}))
+	runTime = time.Date(2025, 3, 11, 0, 0, 0, 0, time.UTC)
+	assert.Equal(t, time.Date(2025, 3, 9, 23, 40, 0, 0, time.UTC), job.purgeFilter(runTime, time.Time{}))
+
+	// Ensure the last archived run is used when known, e.g. for catch-up runs.
+	lastArchived := time.Date(2025, 3, 7, 23, 50, 0, 0, time.UTC)
+	assert.Equal(t, lastArchived, job.purgeFilter(now, lastArchived))
+
+	// Ensure watched jobs without a schedule purge nothing until a run archived their files.
+	job = jobConfig{Name: "test", WatchFiles: 10}
+	assert.Equal(t, purgeNothing, job.purgeFilter(now, time.Time{}))
+	assert.Equal(t, lastArchived, job.purgeFilter(now, lastArchived))
+
+	// Ensure a configured retention is used when set.
+	job.Retention = "3d"
+	assert.Equal(t, now.AddDate(0, 0, -3), job.purgeFilter(now, lastArchived))
+}
+
+func TestConfigJobs(t *testing.T) {
+	cfg := Config{
+		Endpoint:        "test-endpoint",
+		AccessKeyID:     "test-accesskeyid",
+		SecretAccessKey: "test-secretaccesskey",
+		Bucket:          "test-bucket",
+		SourceDir:       "test-sourcedir",
+		LogLevel:        "debug",
+	}
+
+	// Ensure a default job is created from the flat configuration.
+	jobs := cfg.jobs()
+	assert.Equal(t, 1, len(jobs))
+	assert.Equal(t, defaultJobName, jobs[0].Name)
+	assert.Equal(t, "test-sourcedir", jobs[0].SourceDir)
+	assert.Equal(t, "test-bucket", jobs[0].Bucket)
+	assert.Equal(t, defaultSchedule, jobs[0].schedule())
+
+	// Ensure configured jobs inherit the global bucket when they don't set one.
+	cfg.SourceDir = ""
+	cfg.Jobs = []jobConfig{
+		{Name: "db", SourceDir: "/dumps/db", Schedule: "01:00", Retention: "2d"},
+		{Name: "files", SourceDir: "/dumps/files", Bucket: "files-bucket", Prefix: "files"},
+	}
+	jobs = cfg.jobs()
+	assert.Equal(t, 2, len(jobs))
+	assert.Equal(t, "test-bucket", jobs[0].Bucket)
+	assert.Equal(t, "files-bucket", jobs[1].Bucket)
+	assert.NoError(t, cfg.validate())
+
+	// Ensure duplicate job names are rejected.
+	cfg.Jobs[1].Name = "db"
+	assert.Error(t, cfg.validate())
+
+	// Ensure invalid schedules are rejected.
+	cfg.Jobs[1].Name = "files"
+	cfg.Jobs[1].Schedule = "25:00"
+	assert.Error(t, cfg.validate())
+}
+
+func TestWeeklyMonthlyJobs(t *testing.T) {
+	cfg := Config{
+		Endpoint:        "test-endpoint",
+		AccessKeyID:     "test-accesskeyid",
+		SecretAccessKey: "test-secretaccesskey",
+		Bucket:          "test-bucket",
+		LogLevel:        "debug",
+		Jobs: []jobConfig{
+			{Name: "weekly", SourceDir: "/dumps/weekly", Weekdays: "sat", Schedule: "02:00"},
+			{Name: "monthly", SourceDir: "/dumps/monthly", MonthDays: "-1"},
+		},
+	}
+	assert.NoError(t, cfg.validate())
+
+	// Ensure the jobs run on their days.
+	s, err := gocron.NewScheduler()
+	assert.NoError(t, err)
+	defer s.Shutdown()
+
+	for _, job := range cfg.jobs() {
+		definition, err := job.jobDefinition(0)
+		assert.NoError(t, err)
+		_, err = s.NewJob(definition, gocron.NewTask(func() {}), gocron.WithName(job.Name))
+		assert.NoError(t, err)
+	}
+	s.Start()
+
+	next, err := findJob(s, "weekly").NextRun()
+	assert.NoError(t, err)
+	assert.Equal(t, time.Saturday, next.Weekday())
+	assert.Equal(t, 2, next.Hour())
+
+	next, err = findJob(s, "monthly").NextRun()
+	assert.NoError(t, err)
+	assert.Equal(t, 1, next.AddDate(0, 0, 1).Day())
+	assert.Equal(t, 23, next.Hour())
+
+	// Ensure weekly and monthly schedules are exclusive and validated.
+	cfg.Jobs[0].MonthDays = "1"
+	assert.Error(t, cfg.validate())
+	cfg.Jobs[0].MonthDays = ""
+	cfg.Jobs[1].MonthDays = "40"
+	assert.Error(t, cfg.validate())
+}
+
+func TestJobJitter(t *testing.T) {
+	job := jobConfig{Name: "db", SourceDir: "/dumps/db", Schedule: "23:50", Jitter: "15m"}
+	assert.NoError(t, job.validate())
+
+	// Ensure offsets stay within the jitter window.
+	for range 100 {
+		offset := job.jitterOffset()
+		assert.True(t, offset >= -15*time.Minute && offset <= 15*time.Minute)
+	}
+
+	// Ensure the offset picked for a job is kept across reloads until its window changes.
+	registry := &offsetRegistry{picks: make(map[string]jitterPick)}
+	offset := registry.offset(job)
+	for range 100 {
+		assert.Equal(t, offset, registry.offset(job))
+	}
+	resized := job
+	resized.Jitter = "1s"
+	offset = registry.offset(resized)
+	assert.True(t, offset >= -time.Second && offset <= time.Second)
+
+	// Ensure daily run times wrap around midnight and others stay on their day.
+	s, err := gocron.NewScheduler()
+	assert.NoError(t, err)
+	defer s.Shutdown()
+
+	definition, err := job.jobDefinition(15 * time.Minute)
+	assert.NoError(t, err)
+	_, err = s.NewJob(definition, gocron.NewTask(func() {}), gocron.WithName("daily"))
+	assert.NoError(t, err)
+
+	weekly := jobConfig{Name: "weekly", Schedule: "23:50", Weekdays: "sat"}
+	definition, err = weekly.jobDefinition(15 * time.Minute)
+	assert.NoError(t, err)
+	_, err = s.NewJob(definition, gocron.NewTask(func() {}), gocron.WithName("weekly"))
+	assert.NoError(t, err)
+	s.Start()
+
+	next, err := findJob(s, "daily").NextRun()
+	assert.NoError(t, err)
+	assert.Equal(t, 0, next.Hour())
+	assert.Equal(t, 5, next.Minute())
+
+	next, err = findJob(s, "weekly").NextRun()
+	assert.NoError(t, err)
+	assert.Equal(t, time.Saturday, next.Weekday())
+	assert.Equal(t, 23, next.Hour())
+	assert.Equal(t, 59, next.Minute())
+
+	// Ensure the jitter window is validated.
+	job.Jitter = "12h"
+	assert.Error(t, job.validate())
+	job.Jitter = "-5m"
+	assert.Error(t, job.validate())
+}
+
+func TestMissedRun(t *testing.T) {
+	loc := time.UTC
+	lastSuccess := time.Date(2026, 3, 2, 23, 50, 0, 0, loc)
+
+	tests := []struct {
+		name   string
+		job    jobConfig
+		now    time.Time
+		missed bool
+	}{
+		{name: "daily on time", job: jobConfig{}, now: time.Date(2026, 3, 3, 23, 0, 0, 0, loc), missed: false},
+		{name: "daily missed", job: jobConfig{}, now: time.Date(2026, 3, 4, 8, 0, 0, 0, loc), missed: true},
+		{name: "several times", job: jobConfig{Schedule: "06:00,23:50"}, now: time.Date(2026, 3, 3, 8, 0, 0, 0, loc), missed: true},
+		{name: "jitter", job: jobConfig{Jitter: "15m"}, now: time.Date(2026, 3, 4, 0, 0, 0, 0, loc), missed: false},
+		{name: "weekly on time", job: jobConfig{Weekdays: "sat"}, now: time.Date(2026, 3, 6, 8, 0, 0, 0, loc), missed: false},
+		{name: "weekly missed", job: jobConfig{Weekdays: "sat"}, now: time.Date(2026, 3, 8, 8, 0, 0, 0, loc), missed: true},
+		{name: "monthly missed", job: jobConfig{MonthDays: "-1"}, now: time.Date(2026, 4, 1, 8, 0, 0, 0, loc), missed: true},
+		{name: "monthly on time", job: jobConfig{MonthDays: "31"}, now: time.Date(2026, 3, 31, 20, 0, 0, 0, loc), missed: false},
+		{name: "watched", job: jobConfig{WatchFiles: 10}, now: time.Date(2026, 4, 1, 8, 0, 0, 0, loc), missed: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.missed, tt.job.missedRun(lastSuccess, tt.now))
+		})
+	}
+}
+
+func TestWatchedJobs(t *testing.T) {
+	cfg := Config{
+		Endpoint:        "test-endpoint",
+		AccessKeyID:     "test-accesskeyid",
+		SecretAccessKey: "test-secretaccesskey",
+		Bucket:          "test-bucket",
+		LogLevel:        "debug",
+		WatchQuiet:      "10m",
+		Jobs: []jobConfig{
+			{Name: "db", SourceDir: "/dumps/db", WatchFiles: 5},
+			{Name: "files", SourceDir: "/dumps/files", Schedule: "01:00"},
+		},
+	}
+	assert.NoError(t, cfg.validate())
+
+	// Ensure jobs inherit the global watch settings they don't set.
+	jobs := cfg.jobs()
+	assert.Equal(t, 5, jobs[0].WatchFiles)
+	assert.Equal(t, 10*time.Minute, jobs[0].watchQuiet())
+	assert.True(t, jobs[1].watching())
+
+	// Ensure watched jobs without a schedule only run when triggered.
+	s, err := gocron.NewScheduler()
+	assert.NoError(t, err)
+	defer s.Shutdown()
+
+	for _, job := range jobs {
+		definition, err := job.jobDefinition(0)
+		assert.NoError(t, err)
+		_, err = s.NewJob(definition, gocron.NewTask(func() {}), gocron.WithName(job.Name))
+		assert.NoError(t, err)
+	}
+	s.Start()
+
+	next, err := findJob(s, "db").NextRun()
+	assert.NoError(t, err)
+	assert.Equal(t, neverRun, next.UTC())
+
+	next, err = findJob(s, "files").NextRun()
+	assert.NoError(t, err)
+	assert.True(t, next.Before(neverRun))
+
+	// Ensure invalid watch settings are rejected.
+	cfg.Jobs[0].WatchFiles = -1
+	assert.Error(t, cfg.validate())
+}
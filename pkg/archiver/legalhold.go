@@ -0,0 +1,132 @@
+package archiver
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/rs/zerolog"
+)
+
+// setLegalHold places or removes the legal hold of the archive with the provided key in the
+// bucket of the provided access configuration. Archives under legal hold cannot be deleted
+// until the hold is removed, whatever their retention.
+func setLegalHold(ctx context.Context, cfg *s3Config, key string, hold bool) error {
+	mnc, err := minio.New(cfg.Endpoint, cfg.Options)
+	if err != nil {
+		return fmt.Errorf("creating minio client: %w", err)
+	}
+
+	_, err = mnc.StatObject(ctx, cfg.Bucket, key, minio.StatObjectOptions{})
+	if err != nil {
+		return fmt.Errorf("archive %s: %w", key, err)
+	}
+
+	status := minio.LegalHoldDisabled
+	if hold {
+		status = minio.LegalHoldEnabled
+	}
+
+	err = mnc.PutObjectLegalHold(ctx, cfg.Bucket, key, minio.PutObjectLegalHoldOptions{Status: &status})
+	if err != nil {
+		return fmt.Errorf("setting legal hold of %s: %w", key, err)
+	}
+
+	return nil
+}
+
+// legalHold returns whether the object with the provided key is under legal hold. Objects
+// of buckets without object lock are never held.
+func legalHold(ctx context.Context, mnc *minio.Client, bucket string, key string) (bool, error) {
+	status, err := mnc.GetObjectLegalHold(ctx, bucket, key, minio.GetObjectLegalHoldOptions{})
+	if err != nil {
+		switch minio.ToErrorResponse(err).Code {
+		case "NoSuchObjectLockConfiguration", "ObjectLockConfigurationNotFoundError", "InvalidRequest":
+			return false, nil
+		}
+		return false, fmt.Errorf("getting legal hold of %s: %w", key, err)
+	}
+
+	return status != nil && *status == minio.LegalHoldEnabled, nil
+}
+
+// runHoldCommand executes legal hold subcommands, placing, removing or reporting the legal
+// hold of an archive of a job.
+func runHoldCommand(cfg *Config, args []string, out io.Writer) error {
+	if len(args) == 0 {
+		return errors.New("hold command required (place, remove, status)")
+	}
+
+	command := args[0]
+	switch command {
+	case "place", "remove", "status":
+	default:
+		return fmt.Errorf("unknown hold command %q", command)
+	}
+
+	fs := flag.NewFlagSet("hold "+command, flag.ContinueOnError)
+	job := fs.String("job", "", "Job of the archive, optional when a single job is configured")
+	key := fs.String("key", "", "Key of the archive")
+	err := fs.Parse(args[1:])
+	if err != nil {
+		return err
+	}
+
+	if *key == "" {
+		return errors.New("archive key required (-key)")
+	}
+
+	logger := zerolog.Nop()
+	resolver := newJobResolver(func() *Config { return cfg }, &logger)
+	_, s3Cfg, err := resolver.job(*job)
+	if err != nil {
+		return err
+	}
+
+	if s3Cfg.OpenStorage != nil {
+		return errors.New("legal holds require the s3 backend")
+	}
+
+	if !isArchiveKey(s3Cfg, *key) {
+		return fmt.Errorf("%s is not an archive of the job", *key)
+	}
+
+	ctx := context.Background()
+	switch command {
+	case "place":
+		err = setLegalHold(ctx, s3Cfg, *key, true)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "Placed legal hold on %s\n", *key)
+
+	case "remove":
+		err = setLegalHold(ctx, s3Cfg, *key, false)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "Removed legal hold from %s\n", *key)
+
+	case "status":
+		mnc, err := minio.New(s3Cfg.Endpoint, s3Cfg.Options)
+		if err != nil {
+			return fmt.Errorf("creating minio client: %w", err)
+		}
+
+		held, err := legalHold(ctx, mnc, s3Cfg.Bucket, *key)
+		if err != nil {
+			return err
+		}
+
+		if held {
+			fmt.Fprintf(out, "%s is under legal hold\n", *key)
+		} else {
+			fmt.Fprintf(out, "%s is not under legal hold\n", *key)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,67 @@
+package archiver
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/peterldowns/testy/assert"
+)
+
+func TestLegalHold(t *testing.T) {
+	fake := newFakeS3(t, "test-bucket")
+	s3Cfg := fake.s3Config("test-bucket")
+	s3Cfg.Prefix = "backups"
+	putArchives(t, s3Cfg, map[string][]byte{
+		"backups/dump-20260101235000.zip": zipBytes(t, map[string]string{"users.sql": "old"}),
+		"backups/dump-20260102235000.zip": zipBytes(t, map[string]string{"users.sql": "new"}),
+	})
+
+	cfg := &Config{
+		Endpoint:        s3Cfg.Endpoint,
+		AccessKeyID:     "test-accesskeyid",
+		SecretAccessKey: "test-secretaccesskey",
+		Jobs:            []jobConfig{{Name: "db", SourceDir: t.TempDir(), Bucket: "test-bucket", Prefix: "backups"}},
+		staticCreds:     true,
+		transport:       s3Cfg.Options.Transport,
+	}
+	ctx := context.Background()
+
+	// Ensure holds are placed on archives.
+	var out bytes.Buffer
+	err := runCommand(cfg, []string{"hold", "place", "-key", "backups/dump-20260101235000.zip"}, &out)
+	assert.NoError(t, err)
+	assert.Equal(t, "ON", fake.object("test-bucket", "backups/dump-20260101235000.zip").hold)
+
+	out.Reset()
+	err = runCommand(cfg, []string{"hold", "status", "-job", "db", "-key", "backups/dump-20260101235000.zip"}, &out)
+	assert.NoError(t, err)
+	assert.Equal(t, "backups/dump-20260101235000.zip is under legal hold\n", out.String())
+
+	// Ensure pruning keeps held archives.
+	pruned, err := pruneArchives(ctx, s3Cfg, time.Now().Add(time.Hour), 0, false)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(pruned))
+	assert.Equal(t, "backups/dump-20260102235000.zip", pruned[0].Key)
+
+	// Ensure removed holds no longer keep archives.
+	err = runCommand(cfg, []string{"hold", "remove", "-key", "backups/dump-20260101235000.zip"}, &out)
+	assert.NoError(t, err)
+	assert.Equal(t, "OFF", fake.object("test-bucket", "backups/dump-20260101235000.zip").hold)
+
+	pruned, err = pruneArchives(ctx, s3Cfg, time.Now().Add(time.Hour), 0, false)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(pruned))
+
+	// Ensure missing archives, other objects and unknown commands are rejected.
+	err = runCommand(cfg, []string{"hold", "place", "-key", "backups/dump-20260103235000.zip"}, &out)
+	assert.Error(t, err)
+	err = runCommand(cfg, []string{"hold", "place", "-key", "other/dump-20260101235000.zip"}, &out)
+	assert.True(t, err != nil && strings.Contains(err.Error(), "not an archive"))
+	err = runCommand(cfg, []string{"hold", "place"}, &out)
+	assert.Error(t, err)
+	err = runCommand(cfg, []string{"hold", "lift", "-key", "backups/dump-20260101235000.zip"}, &out)
+	assert.Error(t, err)
+}
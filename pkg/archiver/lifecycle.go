@@ -0,0 +1,101 @@
+package archiver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/lifecycle"
+)
+
+// lifecycleRule is a desired lifecycle rule of the buckets, expiring or transitioning the
+// objects under its prefix once they reach the configured age.
+type lifecycleRule struct {
+	ID             string `yaml:"id" toml:"id"`
+	Prefix         string `yaml:"prefix,omitempty" toml:"prefix,omitempty"`
+	ExpireDays     int    `yaml:"expiredays,omitempty" toml:"expiredays,omitempty"`
+	TransitionDays int    `yaml:"transitiondays,omitempty" toml:"transitiondays,omitempty"`
+	StorageClass   string `yaml:"storageclass,omitempty" toml:"storageclass,omitempty"`
+}
+
+// validate validates the lifecycle rule.
+func (r *lifecycleRule) validate() error {
+	var errs error
+	if r.ExpireDays < 0 || r.TransitionDays < 0 {
+		errs = errors.Join(errs, fmt.Errorf("lifecycle rule %s: days must not be negative", r.ID))
+	}
+
+	if r.ExpireDays == 0 && r.TransitionDays == 0 {
+		errs = errors.Join(errs, fmt.Errorf("lifecycle rule %s: expiredays or transitiondays required", r.ID))
+	}
+
+	if (r.TransitionDays > 0) != (r.StorageClass != "") {
+		errs = errors.Join(errs, fmt.Errorf("lifecycle rule %s: transitiondays and storageclass must be set together", r.ID))
+	}
+
+	// Objects expiring before their transition would never transition.
+	if r.ExpireDays > 0 && r.TransitionDays > 0 && r.ExpireDays <= r.TransitionDays {
+		errs = errors.Join(errs, fmt.Errorf("lifecycle rule %s: expiredays must be after transitiondays", r.ID))
+	}
+
+	return errs
+}
+
+// validateLifecycle validates the provided lifecycle rules.
+func validateLifecycle(rules []lifecycleRule) error {
+	var errs error
+	ids := make(map[string]bool, len(rules))
+	for i, rule := range rules {
+		if rule.ID == "" {
+			errs = errors.Join(errs, fmt.Errorf("lifecycle rule %d: id required", i+1))
+		} else if ids[rule.ID] {
+			errs = errors.Join(errs, fmt.Errorf("lifecycle rule %s: duplicate id", rule.ID))
+		}
+		ids[rule.ID] = true
+
+		errs = errors.Join(errs, rule.validate())
+	}
+
+	return errs
+}
+
+// lifecycleConfiguration returns the bucket lifecycle configuration of the provided rules.
+func lifecycleConfiguration(rules []lifecycleRule) *lifecycle.Configuration {
+	config := lifecycle.NewConfiguration()
+	for _, rule := range rules {
+		lcRule := lifecycle.Rule{
+			ID:         rule.ID,
+			Status:     "Enabled",
+			RuleFilter: lifecycle.Filter{Prefix: rule.Prefix},
+		}
+		if rule.ExpireDays > 0 {
+			lcRule.Expiration.Days = lifecycle.ExpirationDays(rule.ExpireDays)
+		}
+		if rule.TransitionDays > 0 {
+			lcRule.Transition.Days = lifecycle.ExpirationDays(rule.TransitionDays)
+			lcRule.Transition.StorageClass = rule.StorageClass
+		}
+
+		config.Rules = append(config.Rules, lcRule)
+	}
+
+	return config
+}
+
+// applyLifecycle replaces the lifecycle configuration of the bucket of the provided access
+// configuration with the provided rules, so rules added through the provider's console do
+// not linger.
+func applyLifecycle(ctx context.Context, cfg *s3Config, rules []lifecycleRule) error {
+	mnc, err := minio.New(cfg.Endpoint, cfg.Options)
+	if err != nil {
+		return fmt.Errorf("creating minio client: %w", err)
+	}
+
+	err = mnc.SetBucketLifecycle(ctx, cfg.Bucket, lifecycleConfiguration(rules))
+	if err != nil {
+		return fmt.Errorf("applying lifecycle rules to bucket %s: %w", cfg.Bucket, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,90 @@
+package archiver
+
+import (
+	"context"
+	"encoding/xml"
+	"testing"
+
+	"github.com/minio/minio-go/v7/pkg/lifecycle"
+	"github.com/peterldowns/testy/assert"
+)
+
+func TestValidateLifecycle(t *testing.T) {
+	tests := []struct {
+		name     string
+		rules    []lifecycleRule
+		hasError bool
+	}{
+		{
+			name: "valid rules",
+			rules: []lifecycleRule{
+				{ID: "expire", Prefix: "backups/", ExpireDays: 90},
+				{ID: "archive", TransitionDays: 30, StorageClass: "GLACIER", ExpireDays: 365},
+			},
+			hasError: false,
+		},
+		{
+			name:     "missing id",
+			rules:    []lifecycleRule{{ExpireDays: 90}},
+			hasError: true,
+		},
+		{
+			name:     "duplicate id",
+			rules:    []lifecycleRule{{ID: "expire", ExpireDays: 90}, {ID: "expire", ExpireDays: 30}},
+			hasError: true,
+		},
+		{
+			name:     "no action",
+			rules:    []lifecycleRule{{ID: "expire", Prefix: "backups/"}},
+			hasError: true,
+		},
+		{
+			name:     "transition without storage class",
+			rules:    []lifecycleRule{{ID: "archive", TransitionDays: 30}},
+			hasError: true,
+		},
+		{
+			name:     "expiry before transition",
+			rules:    []lifecycleRule{{ID: "archive", TransitionDays: 30, StorageClass: "GLACIER", ExpireDays: 7}},
+			hasError: true,
+		},
+		{
+			name:     "negative days",
+			rules:    []lifecycleRule{{ID: "expire", ExpireDays: -1}},
+			hasError: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := validateLifecycle(test.rules)
+			assert.Equal(t, test.hasError, err != nil)
+		})
+	}
+}
+
+func TestApplyLifecycle(t *testing.T) {
+	fake := newFakeS3(t, "test-bucket")
+	ctx := context.Background()
+
+	rules := []lifecycleRule{
+		{ID: "expire", Prefix: "backups/", ExpireDays: 90},
+		{ID: "archive", Prefix: "archive/", TransitionDays: 30, StorageClass: "GLACIER"},
+	}
+	assert.NoError(t, applyLifecycle(ctx, fake.s3Config("test-bucket"), rules))
+
+	// Ensure the bucket's lifecycle configuration holds the rules.
+	var config lifecycle.Configuration
+	assert.NoError(t, xml.Unmarshal(fake.lifecycles["test-bucket"], &config))
+	assert.Equal(t, 2, len(config.Rules))
+	assert.Equal(t, "expire", config.Rules[0].ID)
+	assert.Equal(t, "Enabled", config.Rules[0].Status)
+	assert.Equal(t, "backups/", config.Rules[0].RuleFilter.Prefix)
+	assert.Equal(t, lifecycle.ExpirationDays(90), config.Rules[0].Expiration.Days)
+	assert.Equal(t, lifecycle.ExpirationDays(30), config.Rules[1].Transition.Days)
+	assert.Equal(t, "GLACIER", config.Rules[1].Transition.StorageClass)
+	assert.Equal(t, lifecycle.ExpirationDays(0), config.Rules[1].Expiration.Days)
+
+	// Ensure missing buckets are reported.
+	assert.Error(t, applyLifecycle(ctx, fake.s3Config("missing-bucket"), rules))
+}
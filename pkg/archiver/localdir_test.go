@@ -0,0 +1,78 @@
+package archiver
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/peterldowns/testy/assert"
+	"github.com/rs/zerolog"
+)
+
+func TestLocalDirStore(t *testing.T) {
+	root := t.TempDir()
+	cfg := (&Config{Backend: backendLocalDir, LocalDir: root}).s3Config(jobConfig{Name: "db", Prefix: "backups"}, nil)
+	ctx := context.Background()
+	logger := zerolog.Nop()
+
+	// Ensure archives are copied under the job's prefix and the zip file is removed.
+	for _, name := range []string{"dump-20260101235000.zip", "dump-20260102235000.zip"} {
+		zipPath := filepath.Join(t.TempDir(), name)
+		assert.NoError(t, os.WriteFile(zipPath, zipBytes(t, map[string]string{"users.sql": name}), 0600))
+
+		info, err := uploadZip(ctx, zipPath, cfg, &logger)
+		assert.NoError(t, err)
+		assert.Equal(t, "backups/"+name, info.Key)
+		_, err = os.Stat(zipPath)
+		assert.True(t, os.IsNotExist(err))
+		_, err = os.Stat(filepath.Join(root, "backups", name+".part"))
+		assert.True(t, os.IsNotExist(err))
+	}
+
+	err := writeManifest(ctx, cfg, &archiveManifest{Key: "backups/dump-20260101235000.zip"})
+	assert.NoError(t, err)
+
+	archives, err := listArchives(ctx, cfg)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(archives))
+	assert.Equal(t, "backups/dump-20260102235000.zip", archives[0].Key)
+
+	// Ensure the newest archive is restored by default.
+	target := t.TempDir()
+	result, err := restoreArchive(ctx, cfg, "", target)
+	assert.NoError(t, err)
+	data, err := os.ReadFile(filepath.Join(target, "users.sql"))
+	assert.NoError(t, err)
+	assert.Equal(t, "dump-20260102235000.zip", string(data))
+	assert.Equal(t, 1, result.Files)
+
+	// Ensure pruning removes old archives along with their manifests.
+	pruned, err := pruneArchives(ctx, cfg, time.Now().Add(time.Hour), 1, false)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(pruned))
+	_, err = os.Stat(filepath.Join(root, "backups", "dump-20260101235000.zip"))
+	assert.True(t, os.IsNotExist(err))
+	_, err = os.Stat(filepath.Join(root, manifestKey("backups/dump-20260101235000.zip")))
+	assert.True(t, os.IsNotExist(err))
+	_, err = os.Stat(filepath.Join(root, "backups", "dump-20260102235000.zip"))
+	assert.NoError(t, err)
+}
+
+func TestLocalDirMissing(t *testing.T) {
+	// Ensure archives are not copied into a missing directory, e.g. an unmounted share.
+	root := filepath.Join(t.TempDir(), "nas")
+	cfg := (&Config{Backend: backendLocalDir, LocalDir: root}).s3Config(jobConfig{Name: "db"}, nil)
+	assert.Error(t, checkBucket(context.Background(), cfg))
+
+	zipPath := filepath.Join(t.TempDir(), "dump-20260101235000.zip")
+	assert.NoError(t, os.WriteFile(zipPath, zipBytes(t, map[string]string{"users.sql": "data"}), 0600))
+	logger := zerolog.Nop()
+	_, err := uploadZip(context.Background(), zipPath, cfg, &logger)
+	assert.Error(t, err)
+	_, err = os.Stat(zipPath)
+	assert.NoError(t, err)
+	_, err = os.Stat(root)
+	assert.True(t, os.IsNotExist(err))
+}
@@ -0,0 +1,356 @@
+package archiver
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-co-op/gocron/v2"
+	"github.com/minio/minio-go/v7"
+	"github.com/rs/zerolog"
+)
+
+const (
+	// lockPrefix is the object name prefix of distributed lock objects.
+	lockPrefix = "locks"
+	// defaultLockTTL is how long a lock is held without being refreshed before another
+	// instance may take it over.
+	defaultLockTTL = 5 * time.Minute
+)
+
+// lockRecord is the content of a distributed lock object.
+type lockRecord struct {
+	Owner   string    `json:"owner"`
+	Expires time.Time `json:"expires"`
+}
+
+// s3Locker is a gocron distributed locker backed by lock objects in an S3 bucket. Only the
+// instance holding a job's lock object runs the job, so instances sharing a source
+// directory don't archive it concurrently. Locks are refreshed while held and can be taken
+// over once expired, so a dead holder does not block other instances.
+type s3Locker struct {
+	cfg    *s3Config
+	owner  string
+	ttl    time.Duration
+	logger *zerolog.Logger
+}
+
+// s3Lock is a held distributed lock.
+type s3Lock struct {
+	locker     *s3Locker
+	key        string
+	objectName string
+	etag       string
+	stop       chan struct{}
+	done       chan struct{}
+	// lost is cancelled with errLockLost once the lock is taken over or expires unrefreshed.
+	lost     context.Context
+	markLost context.CancelCauseFunc
+}
+
+// errLockLost is the cause of cancelled runs whose distributed lock was lost.
+var errLockLost = errors.New("distributed lock lost")
+
+// lockRegistry holds the distributed locks held by this instance by job.
+type lockRegistry struct {
+	mtx   sync.Mutex
+	locks map[string]*s3Lock
+}
+
+// heldLocks holds the distributed locks of the running archive jobs.
+var heldLocks = &lockRegistry{locks: make(map[string]*s3Lock)}
+
+// runContext returns a context of a run of the provided job, cancelled with errLockLost once
+// the distributed lock held for the job is lost, so the run stops instead of racing the
+// instance which took the lock over. Runs of jobs without a lock get a plain child context.
+func (r *lockRegistry) runContext(ctx context.Context, job string) (context.Context, context.CancelFunc) {
+	r.mtx.Lock()
+	lock := r.locks[job]
+	r.mtx.Unlock()
+
+	runCtx, cancel := context.WithCancelCause(ctx)
+	if lock == nil {
+		return runCtx, func() { cancel(nil) }
+	}
+
+	stop := context.AfterFunc(lock.lost, func() { cancel(context.Cause(lock.lost)) })
+	return runCtx, func() {
+		stop()
+		cancel(nil)
+	}
+}
+
+// lockOwner returns the identifier of this instance as a lock owner.
+func lockOwner() string {
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "unknown"
+	}
+
+	return hostname + ":" + strconv.Itoa(os.Getpid())
+}
+
+// newS3Locker creates a distributed locker storing lock objects in the provided bucket.
+func newS3Locker(cfg *s3Config, ttl time.Duration, logger *zerolog.Logger) *s3Locker {
+	if ttl <= 0 {
+		ttl = defaultLockTTL
+	}
+
+	return &s3Locker{
+		cfg:    cfg,
+		owner:  lockOwner(),
+		ttl:    ttl,
+		logger: logger,
+	}
+}
+
+// isPreconditionFailed returns whether the provided error is a failed conditional request.
+func isPreconditionFailed(err error) bool {
+	resp := minio.ToErrorResponse(err)
+	return resp.StatusCode == http.StatusPreconditionFailed || resp.Code == "PreconditionFailed"
+}
+
+// put writes a lock record to the lock object. Without a match etag the object must not
+// exist yet, otherwise it must still have the provided etag.
+func (l *s3Locker) put(ctx context.Context, mnc *minio.Client, objectName string, matchETag string) (string, error) {
+	record := lockRecord{Owner: l.owner, Expires: time.Now().Add(l.ttl)}
+	data, err := json.Marshal(record)
+	if err != nil {
+		return "", fmt.Errorf("encoding lock record: %w", err)
+	}
+
+	opts := minio.PutObjectOptions{ContentType: "application/json"}
+	if matchETag == "" {
+		opts.SetMatchETagExcept("*")
+	} else {
+		opts.SetMatchETag(matchETag)
+	}
+
+	info, err := mnc.PutObject(ctx, l.cfg.Bucket, objectName, bytes.NewReader(data), int64(len(data)), opts)
+	if err != nil {
+		return "", err
+	}
+
+	return info.ETag, nil
+}
+
+// read returns the current lock record of the lock object and its etag.
+func (l *s3Locker) read(ctx context.Context, mnc *minio.Client, objectName string) (*lockRecord, string, error) {
+	obj, err := mnc.GetObject(ctx, l.cfg.Bucket, objectName, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, "", err
+	}
+	defer obj.Close()
+
+	info, err := obj.Stat()
+	if err != nil {
+		return nil, "", err
+	}
+
+	var record lockRecord
+	err = json.NewDecoder(obj).Decode(&record)
+	if err != nil {
+		return nil, "", fmt.Errorf("decoding lock record %s: %w", objectName, err)
+	}
+
+	return &record, info.ETag, nil
+}
+
+// acquire creates the provided lock object, taking it over if its holder let it expire. It
+// returns the etag of the written lock object.
+func (l *s3Locker) acquire(ctx context.Context, mnc *minio.Client, objectName string) (string, error) {
+	etag, err := l.put(ctx, mnc, objectName, "")
+	if err == nil {
+		return etag, nil
+	}
+
+	if !isPreconditionFailed(err) {
+		return "", fmt.Errorf("creating lock %s: %w", objectName, err)
+	}
+
+	// The lock exists, take it over only if it expired.
+	record, currentETag, err := l.read(ctx, mnc, objectName)
+	if err != nil {
+		return "", fmt.Errorf("reading lock %s: %w", objectName, err)
+	}
+
+	if record.Owner != l.owner && time.Now().Before(record.Expires) {
+		return "", fmt.Errorf("lock %s held by %s until %s", objectName, record.Owner,
+			record.Expires.Format(time.RFC3339))
+	}
+
+	etag, err = l.put(ctx, mnc, objectName, currentETag)
+	if err != nil {
+		return "", fmt.Errorf("taking over lock %s: %w", objectName, err)
+	}
+
+	if record.Owner != l.owner {
+		l.logger.Warn().Str("lock", objectName).Str("previous owner", record.Owner).
+			Msg("Took over expired lock")
+	}
+
+	return etag, nil
+}
+
+// release removes the provided lock object written with the provided etag, unless another
+// instance took it over. The removal is conditional on the etag, so a lock taken over
+// between reading and removing it is kept.
+func (l *s3Locker) release(ctx context.Context, mnc *minio.Client, objectName string, etag string) error {
+	record, currentETag, err := l.read(ctx, mnc, objectName)
+	if err != nil {
+		if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+			return nil
+		}
+		return fmt.Errorf("reading lock %s: %w", objectName, err)
+	}
+
+	if record.Owner != l.owner || currentETag != etag {
+		return fmt.Errorf("lock %s was taken over by %s", objectName, record.Owner)
+	}
+
+	// The client does not support conditional removals, the condition is set by its
+	// transport.
+	opts := *l.cfg.Options
+	base := opts.Transport
+	if base == nil {
+		base = defaultTransport()
+	}
+	opts.Transport = &ifMatchTransport{base: base, etag: etag}
+	conditional, err := minio.New(l.cfg.Endpoint, &opts)
+	if err != nil {
+		return fmt.Errorf("creating minio client: %w", err)
+	}
+
+	err = conditional.RemoveObject(ctx, l.cfg.Bucket, objectName, minio.RemoveObjectOptions{})
+	if isPreconditionFailed(err) {
+		return fmt.Errorf("lock %s was taken over", objectName)
+	}
+	if err != nil {
+		return fmt.Errorf("removing lock %s: %w", objectName, err)
+	}
+
+	return nil
+}
+
+// ifMatchTransport makes the object removals it sends conditional on the object's etag.
+type ifMatchTransport struct {
+	base http.RoundTripper
+	etag string
+}
+
+// RoundTrip sends the provided request, with the etag condition if it removes an object.
+func (t *ifMatchTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Method == http.MethodDelete {
+		req = req.Clone(req.Context())
+		req.Header.Set("If-Match", `"`+t.etag+`"`)
+	}
+
+	return t.base.RoundTrip(req)
+}
+
+// Lock acquires the lock object of the provided job, taking it over if its holder let it
+// expire.
+func (l *s3Locker) Lock(ctx context.Context, key string) (gocron.Lock, error) {
+	mnc, err := minio.New(l.cfg.Endpoint, l.cfg.Options)
+	if err != nil {
+		return nil, fmt.Errorf("creating minio client: %w", err)
+	}
+
+	objectName := path.Join(l.cfg.Prefix, lockPrefix, key+".lock")
+
+	etag, err := l.acquire(ctx, mnc, objectName)
+	if err != nil {
+		return nil, err
+	}
+
+	lock := &s3Lock{
+		locker:     l,
+		key:        key,
+		objectName: objectName,
+		etag:       etag,
+		stop:       make(chan struct{}),
+		done:       make(chan struct{}),
+	}
+	lock.lost, lock.markLost = context.WithCancelCause(context.Background())
+	heldLocks.mtx.Lock()
+	heldLocks.locks[key] = lock
+	heldLocks.mtx.Unlock()
+	go lock.refresh(mnc)
+
+	return lock, nil
+}
+
+// refresh extends the lock's expiry periodically until it is unlocked. The lock is lost
+// once another instance took it over, or once it expired without being refreshed, after
+// which it is no longer refreshed.
+func (k *s3Lock) refresh(mnc *minio.Client) {
+	defer close(k.done)
+
+	interval := k.locker.ttl / 3
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	expires := time.Now().Add(k.locker.ttl)
+	for {
+		select {
+		case <-k.stop:
+			return
+
+		case <-ticker.C:
+			ctx, cancel := context.WithTimeout(k.lost, interval)
+			etag, err := k.locker.put(ctx, mnc, k.objectName, k.etag)
+			cancel()
+			switch {
+			case err == nil:
+				k.etag = etag
+				expires = time.Now().Add(k.locker.ttl)
+
+			case isPreconditionFailed(err) || !time.Now().Before(expires):
+				k.locker.logger.Error().Err(err).Str("lock", k.objectName).Msg("Lost lock")
+				k.markLost(fmt.Errorf("%w: %s", errLockLost, k.objectName))
+				return
+
+			default:
+				// Keep the lock until it expires, the refresh is retried on the next tick.
+				k.locker.logger.Error().Err(err).Str("lock", k.objectName).Msg("Refreshing lock")
+			}
+		}
+	}
+}
+
+// Unlock releases the lock by removing the lock object, unless another instance took it over.
+// The lock is released even if the provided context of its job was cancelled by a reload
+// removing the job.
+func (k *s3Lock) Unlock(ctx context.Context) error {
+	ctx = context.WithoutCancel(ctx)
+
+	close(k.stop)
+	<-k.done
+
+	heldLocks.mtx.Lock()
+	if heldLocks.locks[k.key] == k {
+		delete(heldLocks.locks, k.key)
+	}
+	heldLocks.mtx.Unlock()
+
+	lost := context.Cause(k.lost)
+	k.markLost(nil)
+	if lost != nil {
+		return lost
+	}
+
+	mnc, err := minio.New(k.locker.cfg.Endpoint, k.locker.cfg.Options)
+	if err != nil {
+		return fmt.Errorf("creating minio client: %w", err)
+	}
+
+	return k.locker.release(ctx, mnc, k.objectName, k.etag)
+}
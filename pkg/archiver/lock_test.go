@@ -0,0 +1,124 @@
+package archiver
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/peterldowns/testy/assert"
+	"github.com/rs/zerolog"
+)
+
+func TestS3Locker(t *testing.T) {
+	s3 := newFakeS3(t, "test-bucket")
+	cfg := s3.s3Config("test-bucket")
+	logger := zerolog.Nop()
+	ctx := context.Background()
+
+	first := newS3Locker(cfg, time.Minute, &logger)
+	first.owner = "first"
+	second := newS3Locker(cfg, time.Minute, &logger)
+	second.owner = "second"
+
+	// Ensure the lock object is created for the job.
+	lock, err := first.Lock(ctx, "db")
+	assert.NoError(t, err)
+	assert.NotEqual(t, nil, s3.object("test-bucket", "locks/db.lock"))
+
+	// Ensure another instance can't acquire a held lock.
+	_, err = second.Lock(ctx, "db")
+	assert.Error(t, err)
+
+	// Ensure locks of other jobs are independent.
+	other, err := second.Lock(ctx, "files")
+	assert.NoError(t, err)
+	assert.NoError(t, other.Unlock(ctx))
+
+	// Ensure unlocking removes the lock object so another instance can acquire it.
+	assert.NoError(t, lock.Unlock(ctx))
+	assert.Equal(t, (*fakeObject)(nil), s3.object("test-bucket", "locks/db.lock"))
+
+	lock, err = second.Lock(ctx, "db")
+	assert.NoError(t, err)
+
+	// Ensure an expired lock is taken over.
+	obj := s3.object("test-bucket", "locks/db.lock")
+	expired, err := json.Marshal(lockRecord{Owner: "second", Expires: time.Now().Add(-time.Minute)})
+	assert.NoError(t, err)
+	s3.mtx.Lock()
+	obj.data = expired
+	s3.mtx.Unlock()
+
+	takeover, err := first.Lock(ctx, "db")
+	assert.NoError(t, err)
+
+	// Ensure the previous holder doesn't remove a lock that was taken over.
+	assert.Error(t, lock.Unlock(ctx))
+	assert.NotEqual(t, nil, s3.object("test-bucket", "locks/db.lock"))
+	assert.NoError(t, takeover.Unlock(ctx))
+}
+
+func TestS3LockerConditionalRelease(t *testing.T) {
+	s3 := newFakeS3(t, "test-bucket")
+	cfg := s3.s3Config("test-bucket")
+	logger := zerolog.Nop()
+	ctx := context.Background()
+
+	locker := newS3Locker(cfg, time.Minute, &logger)
+	lock, err := locker.Lock(ctx, "db")
+	assert.NoError(t, err)
+
+	// Ensure removals are conditional on the etag of the lock object.
+	opts := *cfg.Options
+	opts.Transport = &ifMatchTransport{base: cfg.Options.Transport, etag: "other"}
+	mnc, err := minio.New(cfg.Endpoint, &opts)
+	assert.NoError(t, err)
+	err = mnc.RemoveObject(ctx, "test-bucket", "locks/db.lock", minio.RemoveObjectOptions{})
+	assert.True(t, isPreconditionFailed(err))
+	assert.NotEqual(t, nil, s3.object("test-bucket", "locks/db.lock"))
+
+	assert.NoError(t, lock.Unlock(ctx))
+	assert.Equal(t, (*fakeObject)(nil), s3.object("test-bucket", "locks/db.lock"))
+}
+
+func TestS3LockLost(t *testing.T) {
+	s3 := newFakeS3(t, "test-bucket")
+	cfg := s3.s3Config("test-bucket")
+	logger := zerolog.Nop()
+	ctx := context.Background()
+
+	first := newS3Locker(cfg, 300*time.Millisecond, &logger)
+	first.owner = "first"
+	second := newS3Locker(cfg, time.Minute, &logger)
+	second.owner = "second"
+
+	lock, err := first.Lock(ctx, "db")
+	assert.NoError(t, err)
+	runCtx, cancel := heldLocks.runContext(ctx, "db")
+	defer cancel()
+
+	// Another instance takes the lock over, e.g. after the holder stalled past its expiry.
+	mnc, err := minio.New(cfg.Endpoint, cfg.Options)
+	assert.NoError(t, err)
+	_, etag, err := second.read(ctx, mnc, "locks/db.lock")
+	assert.NoError(t, err)
+	_, err = second.put(ctx, mnc, "locks/db.lock", etag)
+	assert.NoError(t, err)
+
+	// Ensure the run is cancelled once the lock is lost, and the lock of the other instance
+	// is kept.
+	select {
+	case <-runCtx.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("run not cancelled")
+	}
+	assert.True(t, errors.Is(context.Cause(runCtx), errLockLost))
+	assert.Error(t, lock.Unlock(ctx))
+
+	record, _, err := second.read(ctx, mnc, "locks/db.lock")
+	assert.NoError(t, err)
+	assert.Equal(t, "second", record.Owner)
+}
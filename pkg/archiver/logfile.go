@@ -0,0 +1,111 @@
+package archiver
+
+import (
+	"fmt"
+	"os"
+	"sync"
+)
+
+const (
+	// defaultLogMaxSize is the default size of the log file at which it is rotated.
+	defaultLogMaxSize = 100 << 20
+	// defaultLogMaxBackups is the default number of rotated log files kept.
+	defaultLogMaxBackups = 5
+)
+
+// rotatingFile is a log file which is rotated once it reaches its maximum size. Rotated
+// files are renamed to <path>.1, <path>.2 and so on, newest first, and the oldest are
+// removed beyond the maximum number of backups.
+type rotatingFile struct {
+	mtx        sync.Mutex
+	path       string
+	maxSize    int64
+	maxBackups int
+	file       *os.File
+	size       int64
+}
+
+// openLogFile opens the log file at the provided path for appending, creating it if needed.
+func openLogFile(path string, maxSize int64, maxBackups int) (*rotatingFile, error) {
+	f := &rotatingFile{path: path, maxSize: maxSize, maxBackups: maxBackups}
+
+	err := f.open()
+	if err != nil {
+		return nil, err
+	}
+
+	return f, nil
+}
+
+// open opens the log file and records its current size.
+func (f *rotatingFile) open() error {
+	file, err := os.OpenFile(f.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("opening log file: %w", err)
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("opening log file: %w", err)
+	}
+
+	f.file, f.size = file, info.Size()
+	return nil
+}
+
+// backupPath returns the path of the rotated log file with the provided index.
+func (f *rotatingFile) backupPath(index int) string {
+	return fmt.Sprintf("%s.%d", f.path, index)
+}
+
+// rotate closes the log file, shifts the rotated files and opens a new log file.
+func (f *rotatingFile) rotate() error {
+	err := f.file.Close()
+	if err != nil {
+		return fmt.Errorf("closing log file: %w", err)
+	}
+
+	// Drop the oldest backup and shift the others, the current file becoming the first.
+	os.Remove(f.backupPath(f.maxBackups))
+	for i := f.maxBackups - 1; i >= 1; i-- {
+		os.Rename(f.backupPath(i), f.backupPath(i+1))
+	}
+
+	if f.maxBackups > 0 {
+		err = os.Rename(f.path, f.backupPath(1))
+	} else {
+		err = os.Remove(f.path)
+	}
+	if err != nil {
+		return fmt.Errorf("rotating log file: %w", err)
+	}
+
+	return f.open()
+}
+
+// Write writes the provided log entry, rotating the log file first if the entry would
+// exceed its maximum size. Entries are never split across files.
+func (f *rotatingFile) Write(p []byte) (int, error) {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+
+	if f.size > 0 && f.size+int64(len(p)) > f.maxSize {
+		err := f.rotate()
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	return n, err
+}
+
+// Close closes the log file.
+func (f *rotatingFile) Close() error {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+
+	return f.file.Close()
+}
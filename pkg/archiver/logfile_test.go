@@ -0,0 +1,45 @@
+package archiver
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/peterldowns/testy/assert"
+)
+
+func TestRotatingFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "zdts3.log")
+	f, err := openLogFile(path, 16, 2)
+	assert.NoError(t, err)
+
+	// Ensure the file is rotated before exceeding its size and old backups are removed.
+	for _, entry := range []string{"first entry\n", "second entry\n", "third entry\n", "fourth entry\n"} {
+		_, err := f.Write([]byte(entry))
+		assert.NoError(t, err)
+	}
+	assert.NoError(t, f.Close())
+
+	read := func(path string) string {
+		data, err := os.ReadFile(path)
+		assert.NoError(t, err)
+		return string(data)
+	}
+	assert.Equal(t, "fourth entry\n", read(path))
+	assert.Equal(t, "third entry\n", read(path+".1"))
+	assert.Equal(t, "second entry\n", read(path+".2"))
+	_, err = os.Stat(path + ".3")
+	assert.True(t, os.IsNotExist(err))
+
+	// Ensure an existing file is appended to, counting its size.
+	f, err = openLogFile(path, 32, 2)
+	assert.NoError(t, err)
+	_, err = f.Write([]byte("fifth entry\n"))
+	assert.NoError(t, err)
+	_, err = f.Write([]byte("sixth entry\n"))
+	assert.NoError(t, err)
+	assert.NoError(t, f.Close())
+	assert.Equal(t, "sixth entry\n", read(path))
+	assert.True(t, strings.HasPrefix(read(path+".1"), "fourth entry\nfifth"))
+}
@@ -0,0 +1,1449 @@
+package archiver
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"net"
+	"os"
+	"os/signal"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	"github.com/rs/zerolog/pkgerrors"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Process exit codes.
+const (
+	// exitOK indicates the process completed successfully.
+	exitOK = 0
+	// exitRuntime indicates a fatal runtime error, including a failed subcommand.
+	exitRuntime = 1
+	// exitConfig indicates the configuration could not be loaded or is invalid.
+	exitConfig = 2
+	// exitPreflight indicates the startup preflight checks failed.
+	exitPreflight = 3
+	// exitScheduler indicates the scheduler or its jobs could not be created.
+	exitScheduler = 4
+	// exitLocked indicates another instance holds the pid file.
+	exitLocked = 5
+	// exitChecks indicates checks of the doctor command failed.
+	exitChecks = 6
+)
+
+// purgeLogSample is the number of removed files purgeDir logs at info level, the others are
+// logged at debug level and summarized once the directory is purged.
+const purgeLogSample = 10
+
+// purgeDir removes files in the provided directory that are older than the provided timestamp filter.
+// It returns the errors of the files which could not be removed, the others are still removed.
+// Purging stops once the provided context is done.
+func purgeDir(ctx context.Context, dir string, filter uint64, logger *zerolog.Logger) error {
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		logger.Error().Err(err).Str("path", dir).Msg("Reading directory")
+		return err
+	}
+
+	removed := 0
+	var errs error
+	for _, file := range files {
+		if ctx.Err() != nil {
+			errs = errors.Join(errs, ctx.Err())
+			break
+		}
+
+		// Use the file's modification time to determine if it should be deleted.
+		fileName := file.Name()
+		info, err := file.Info()
+		if err != nil {
+			logger.Error().Err(err).Str("file", fileName).Msg("Getting file info")
+			errs = errors.Join(errs, err)
+			continue
+		}
+
+		modTime := uint64(info.ModTime().UnixMilli())
+
+		// If the file's modification timestamp is older than the filter, delete the file.
+		if modTime < filter {
+			// Log the first removals only, directories can hold a very large number of files.
+			event := logger.Info()
+			if removed >= purgeLogSample {
+				event = logger.Debug()
+			}
+			event.Uint64("modification time", modTime).Uint64("filter", filter).
+				Str("file", fileName).Msg("file is older than filter, removing")
+			err = os.Remove(filepath.Join(dir, fileName))
+			if err != nil {
+				logger.Error().Err(err).Str("file", fileName).Msg("Removing old file")
+				errs = errors.Join(errs, err)
+				continue
+			}
+			removed++
+		}
+	}
+
+	if removed > purgeLogSample {
+		logger.Info().Str("path", dir).Int("removed", removed).Int("unlogged", removed-purgeLogSample).
+			Msg("Removed old files")
+	}
+
+	return errs
+}
+
+// compressedExts are the extensions of compressed file types, which are stored in zip files
+// as is since compressing them again costs time without saving space.
+var compressedExts = map[string]bool{
+	".gz": true, ".tgz": true, ".bz2": true, ".xz": true, ".zst": true, ".lz4": true,
+	".zip": true, ".7z": true, ".rar": true,
+	".jpg": true, ".jpeg": true, ".png": true, ".gif": true, ".webp": true, ".heic": true,
+	".mp3": true, ".aac": true, ".ogg": true, ".flac": true,
+	".mp4": true, ".mkv": true, ".mov": true, ".webm": true, ".avi": true,
+	".pdf": true, ".docx": true, ".xlsx": true, ".pptx": true, ".jar": true, ".apk": true,
+}
+
+// zipOptions are the options of zipping a directory.
+type zipOptions struct {
+	// Since is the time files must be modified since to be zipped, all files are zipped
+	// when it is zero.
+	Since time.Time
+	// Method is the zip method files are compressed with, compressed file types are
+	// always stored.
+	Method uint16
+	// Symlinks is the policy of symbolic links, following them by default.
+	Symlinks string
+	// Dirs indicates directories are added to the zip, so empty directories are restored.
+	Dirs bool
+	// HardLinks indicates the content of hard linked files is only added once.
+	HardLinks bool
+	// Xattrs indicates the extended attributes of files are recorded in their entries.
+	Xattrs bool
+	// SQLite indicates SQLite databases are zipped from a consistent copy made with the
+	// SQLite backup API, without their journal files.
+	SQLite bool
+	// Compression holds the rules selecting the compression of files, which take precedence
+	// over the method and the stored compressed file types.
+	Compression []compressionRule
+	// Checksums indicates a MANIFEST.sha256 entry listing the SHA-256 checksums of the
+	// archived files is added to the zip.
+	Checksums bool
+	// MaxFileSize is the size of the largest files zipped, larger files are skipped. Files of
+	// any size are zipped when it is zero.
+	MaxFileSize int64
+	// Skipped is called with every file skipped for exceeding the maximum file size, if set.
+	Skipped func(archivedFile)
+	// Workers is the number of blocks of large files compressed concurrently.
+	Workers int
+	// Readers is the number of files read concurrently ahead of being zipped.
+	Readers int
+	// Comment is the comment of the zip file, if any.
+	Comment string
+	// Progress records the files and bytes zipped.
+	Progress *runProgress
+}
+
+// dirZipper adds the files of a directory to a zip file.
+type dirZipper struct {
+	ctx     context.Context
+	w       *zip.Writer
+	zipInfo os.FileInfo
+	opts    zipOptions
+	logger  *zerolog.Logger
+	visited map[string]bool
+	links   map[fileID]archivedFile
+	files   []archivedFile
+	// symlinks holds the names of the preserved symbolic links, which have no checksum.
+	symlinks map[string]bool
+	// ignore holds the rules of the ignore files found so far.
+	ignore  ignoreRules
+	pending []*prefetchedFile
+	readers chan struct{}
+}
+
+// zipDir zips contents of the provided directory into a zip file at the provided path. It
+// returns the archived files. Zipping stops once the provided context is done, and the zip
+// file is removed when zipping fails.
+func zipDir(ctx context.Context, dir string, zipPath string, opts zipOptions, logger *zerolog.Logger) ([]archivedFile, error) {
+	// Create the destination zip file.
+	zipFile, err := os.Create(zipPath)
+	if err != nil {
+		logger.Error().Err(err).Str("path", zipPath).Msg("Creating zip file")
+		return nil, err
+	}
+	defer zipFile.Close()
+
+	zipInfo, err := zipFile.Stat()
+	if err != nil {
+		logger.Error().Err(err).Str("path", zipPath).Msg("Creating zip file")
+		return nil, err
+	}
+
+	zipWriter := zip.NewWriter(zipFile)
+	defer zipWriter.Close()
+
+	// Walk the directory and add each file to the zip.
+	z := &dirZipper{
+		ctx:      ctx,
+		w:        zipWriter,
+		zipInfo:  zipInfo,
+		opts:     opts,
+		logger:   logger,
+		visited:  make(map[string]bool),
+		links:    make(map[fileID]archivedFile),
+		readers:  make(chan struct{}, max(opts.Readers, 1)),
+		symlinks: make(map[string]bool),
+	}
+	err = z.addDir(dir, "")
+	if err == nil {
+		err = z.flush()
+	}
+	if err == nil && opts.Checksums {
+		err = z.addChecksums()
+	}
+	if err == nil && opts.Comment != "" {
+		err = zipWriter.SetComment(opts.Comment)
+	}
+	if err != nil {
+		z.discard()
+		logger.Error().Err(err).Str("path", dir).Msg("Walking directory")
+		removePartial(zipFile, logger)
+		return z.files, err
+	}
+
+	err = zipWriter.Close()
+	if err != nil {
+		logger.Error().Err(err).Str("path", zipPath).Msg("Closing zip writer")
+		removePartial(zipFile, logger)
+		return z.files, err
+	}
+
+	err = syncFile(zipFile)
+	if err != nil {
+		logger.Error().Err(err).Str("path", zipPath).Msg("Syncing zip file")
+		removePartial(zipFile, logger)
+		return z.files, err
+	}
+
+	return z.files, nil
+}
+
+// removePartial closes and removes the provided partially written file.
+func removePartial(file *os.File, logger *zerolog.Logger) {
+	file.Close()
+	err := os.Remove(file.Name())
+	if err != nil {
+		logger.Error().Err(err).Str("path", file.Name()).Msg("Removing partial file")
+	}
+}
+
+// contextReader reads from the wrapped reader until its context is done, so long copies
+// can be interrupted.
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+// Read reads from the wrapped reader, failing with the error of the context once it is
+// done.
+func (c *contextReader) Read(p []byte) (int, error) {
+	if err := c.ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	return c.r.Read(p)
+}
+
+// addDir adds the files of the provided directory to the zip, their names prefixed with the
+// provided prefix.
+func (z *dirZipper) addDir(dir string, prefix string) error {
+	// Walk the resolved directory, guarding against links to a parent directory.
+	realDir, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return err
+	}
+	if z.visited[realDir] {
+		z.logger.Warn().Str("path", dir).Msg("Skipping symlink loop")
+		return nil
+	}
+	z.visited[realDir] = true
+	defer delete(z.visited, realDir)
+
+	return filepath.WalkDir(realDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := z.ctx.Err(); err != nil {
+			return err
+		}
+
+		// Get the archive name of the file.
+		name, err := entryName(realDir, path, prefix)
+		if err != nil {
+			return err
+		}
+
+		// Skip the files and directories listed by ignore files.
+		if path != realDir && z.ignore.ignored(name, d.IsDir()) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		if d.IsDir() {
+			err := z.ignore.load(path, name, z.logger)
+			if err != nil {
+				return err
+			}
+
+			if !z.opts.Dirs || name == "." {
+				return nil
+			}
+
+			err = z.flush()
+			if err != nil {
+				return err
+			}
+			return z.addDirEntry(path, name, d)
+		}
+
+		// Skip the zip file being written and the archives of previous runs.
+		if prefix == "" && isStagedArchive(name) {
+			return nil
+		}
+
+		// Skip a file taking the name of the embedded checksums.
+		if z.opts.Checksums && name == checksumsName {
+			z.logger.Warn().Str("path", path).Msg("Skipping file named like the embedded checksums")
+			return nil
+		}
+
+		if d.Type()&fs.ModeSymlink != 0 {
+			err := z.flush()
+			if err != nil {
+				return err
+			}
+			return z.addLink(path, name)
+		}
+
+		return z.queueFile(path, name, d)
+	})
+}
+
+// addDirEntry adds an entry for the directory at the provided path to the zip. Directories
+// are not archived files, only their entries are added.
+func (z *dirZipper) addDirEntry(path string, name string, d fs.DirEntry) error {
+	info, err := d.Info()
+	if err != nil {
+		return err
+	}
+
+	header, err := zip.FileInfoHeader(info)
+	if err != nil {
+		return err
+	}
+	header.Name = name + "/"
+	header.Method = zip.Store
+	header.Extra = z.entryExtra(path, info)
+
+	_, err = z.w.CreateHeader(header)
+	return err
+}
+
+// addLink adds the symbolic link at the provided path to the zip according to the symlink
+// policy.
+func (z *dirZipper) addLink(path string, name string) error {
+	switch z.opts.Symlinks {
+	case symlinksSkip:
+		return nil
+
+	case symlinksPreserve:
+		info, err := os.Lstat(path)
+		if err != nil {
+			return err
+		}
+
+		target, err := os.Readlink(path)
+		if err != nil {
+			return err
+		}
+
+		// Targets are slash separated like entry names, they are extracted on any platform.
+		z.symlinks[name] = true
+		return z.addEntry(path, name, info, strings.NewReader(filepath.ToSlash(target)))
+
+	default:
+		info, err := os.Stat(path)
+		if err != nil {
+			z.logger.Warn().Err(err).Str("path", path).Msg("Skipping broken symlink")
+			return nil
+		}
+
+		if info.IsDir() {
+			return z.addDir(path, name)
+		}
+
+		return z.addFile(path, name, info, nil)
+	}
+}
+
+// addFile adds the file at the provided path to the zip. The file is read from disk unless
+// its content is provided.
+func (z *dirZipper) addFile(path string, name string, info os.FileInfo, data []byte) error {
+	// Skip the zip file being written.
+	if os.SameFile(info, z.zipInfo) {
+		return nil
+	}
+
+	// Skip files over the maximum size, e.g. a stray core dump, rather than blowing up the
+	// archive.
+	if z.opts.MaxFileSize > 0 && info.Size() > z.opts.MaxFileSize && !info.ModTime().Before(z.opts.Since) {
+		z.logger.Warn().Str("path", path).Int64("size", info.Size()).Int64("maxFileSize", z.opts.MaxFileSize).
+			Msg("Skipping file over the maximum file size")
+		if z.opts.Skipped != nil {
+			z.opts.Skipped(archivedFile{Path: name, Size: info.Size(), ModTime: info.ModTime()})
+		}
+		return nil
+	}
+
+	// Add SQLite databases from a consistent copy, which includes their journal files.
+	if z.opts.SQLite {
+		if isSQLiteJournal(path) {
+			return nil
+		}
+		if info.Mode().IsRegular() && isSQLite(path, data) {
+			return z.addSQLite(path, name, info)
+		}
+	}
+
+	// Add the content of hard linked files once.
+	id, linked := hardLinkID(info)
+	linked = linked && z.opts.HardLinks && !info.ModTime().Before(z.opts.Since)
+	if first, ok := z.links[id]; linked && ok {
+		return z.addHardLink(name, info, first)
+	}
+
+	var content io.Reader = bytes.NewReader(data)
+	if data == nil {
+		// Open the current file.
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		content = file
+	}
+
+	err := z.addEntry(path, name, info, content)
+	if err != nil {
+		return err
+	}
+
+	if linked {
+		z.links[id] = z.files[len(z.files)-1]
+	}
+
+	return nil
+}
+
+// addEntry adds an entry with the provided name, file information and content of the file
+// at the provided path to the zip. Files unchanged since the provided time are skipped.
+func (z *dirZipper) addEntry(localPath string, name string, info os.FileInfo, content io.Reader) error {
+	if info.ModTime().Before(z.opts.Since) {
+		return nil
+	}
+
+	// Create a new zip file for the current file, keeping its modification time.
+	header, err := zip.FileInfoHeader(info)
+	if err != nil {
+		return err
+	}
+	header.Name = name
+	header.Method = z.opts.Method
+	header.Extra = z.entryExtra(localPath, info)
+	compression, ruled := compressionFor(z.opts.Compression, name)
+	switch {
+	case ruled:
+		header.Method = compression.Method
+	case compressedExts[strings.ToLower(path.Ext(name))]:
+		header.Method = zip.Store
+	}
+
+	// Copy the file into the zip, hashing its content. Large files are compressed in
+	// parallel, files compressed by a rule with their rule's method and level.
+	content = z.opts.Progress.reader(&contextReader{ctx: z.ctx, r: content})
+	hash := sha256.New()
+	var size int64
+	switch {
+	case header.Method == zipMethodZstd || (header.Method == zip.Deflate && compression.Level != 0):
+		size, err = z.addCompressed(header, compression, io.TeeReader(content, hash))
+	case header.Method == zip.Deflate && z.opts.Workers > 1 && info.Size() > deflateBlockSize:
+		size, err = z.addDeflated(header, io.TeeReader(content, hash))
+	default:
+		var zipFile io.Writer
+		zipFile, err = z.w.CreateHeader(header)
+		if err != nil {
+			return err
+		}
+		size, err = copyBuffers().copy(io.MultiWriter(zipFile, hash), content)
+	}
+	if err != nil {
+		return err
+	}
+
+	z.files = append(z.files, archivedFile{
+		Path:    name,
+		Size:    size,
+		ModTime: info.ModTime(),
+		SHA256:  hex.EncodeToString(hash.Sum(nil)),
+	})
+	z.opts.Progress.addFile()
+
+	return nil
+}
+
+// uploadZip uploads the zip file at the provided path to the storage of the provided access
+// configuration, and to its additional destinations concurrently, and verifies the stored
+// size. It returns the key and size of the uploaded archive. Failed copies are returned as a
+// *copyError, and failed parity data uploads as a *parityError, along with the upload
+// information.
+func uploadZip(ctx context.Context, zipPath string, cfg *s3Config, logger *zerolog.Logger) (minio.UploadInfo, error) {
+	store, err := cfg.openStorage(ctx)
+	if err != nil {
+		logger.Error().Err(err).Msg("Connecting to storage")
+		return minio.UploadInfo{}, err
+	}
+	defer store.Close()
+
+	bucketName := cfg.Bucket
+	objectName := path.Join(cfg.Prefix, filepath.Base(zipPath))
+
+	// Upload the copies alongside, the zip file is kept until every upload is done.
+	copies := make(chan error, 1)
+	go func() {
+		copies <- uploadCopies(ctx, zipPath, objectName, cfg.Copies, logger)
+	}()
+
+	put := chainUploads(storePut(store), cfg.Middleware, logger)
+	uploaded, err := put(ctx, objectName, zipPath)
+	size, checksum := uploaded.Size, uploaded.Checksum
+	copyErr := <-copies
+	if err != nil {
+		logger.Error().Err(err).Str("bucket", bucketName).Str("object", objectName).Msg("Uploading zip file")
+		return minio.UploadInfo{}, err
+	}
+
+	event := logger.Info().Str("bucket", bucketName).Str("object", objectName).Int64("size", size)
+	if checksum != "" {
+		event = event.Str("checksumSHA256", checksum)
+	}
+	event.Msg("Uploaded zip file")
+
+	// Upload the parity data of the archive, which is stored without it when this fails.
+	var errs error
+	if cfg.Parity > 0 {
+		err = uploadParity(ctx, store, objectName, zipPath, cfg.Parity, logger)
+		if err != nil {
+			logger.Error().Err(err).Str("bucket", bucketName).Str("object", objectName).Msg("Uploading parity data")
+			errs = &parityError{err: err}
+		}
+	}
+
+	// Remove the zip file after uploading.
+	err = os.Remove(zipPath)
+	if err != nil {
+		logger.Error().Err(err).Str("path", zipPath).Msg("Removing zip file")
+	}
+
+	info := minio.UploadInfo{Bucket: bucketName, Key: objectName, Size: size, ChecksumSHA256: checksum}
+	if copyErr != nil {
+		errs = errors.Join(&copyError{err: copyErr}, errs)
+	}
+
+	return info, errs
+}
+
+// uploadArchive uploads the provided zip file of the provided job the way the job stores its
+// archives.
+func uploadArchive(ctx context.Context, job jobConfig, plan backupPlan, zipPath string, cfg *s3Config, logger *zerolog.Logger) (minio.UploadInfo, error) {
+	switch {
+	case job.Dedup:
+		return uploadDedup(ctx, zipPath, cfg, logger)
+
+	case job.Delta > 0:
+		return uploadDelta(ctx, job, plan, zipPath, cfg, logger)
+
+	default:
+		return uploadZip(ctx, zipPath, cfg, logger)
+	}
+}
+
+// archive archives the contents of the provided job's source directory by purging old files
+// and zipping the recent files in the directory. The outcome of the run is sent to the
+// provided reporters. Every log entry of the run carries its run ID, so interleaved runs can
+// be told apart.
+func archive(ctx context.Context, job jobConfig, cfg *s3Config, reporters []runReporter, logger *zerolog.Logger) {
+	if job.Subdirs {
+		archiveSubdirs(ctx, job, cfg, reporters, logger)
+		return
+	}
+
+	runID := newRunID()
+	runLogger := logger.With().Str("run", runID).Logger()
+	archiveDir(ctx, job, "dump", runID, cfg, reporters, &runLogger)
+}
+
+// archiveSubdirs archives every immediate subdirectory of the provided job's source directory
+// separately, as many at a time as the job has workers. The archives are named after their
+// subdirectory and uploaded under its prefix, each run is reported as a job named after the
+// job and the subdirectory, with its own run ID.
+func archiveSubdirs(ctx context.Context, job jobConfig, cfg *s3Config, reporters []runReporter, logger *zerolog.Logger) {
+	reportSubdirs(reporters, job.Name, false)
+	defer reportSubdirs(reporters, job.Name, true)
+
+	// The source directory holds the subdirectories, check it once for all of them.
+	err := job.checkSource(job.SourceDir)
+	if err != nil {
+		result := &runResult{ID: newRunID(), Job: job.Name, Start: time.Now(), Bucket: cfg.Bucket, Err: err}
+		logger.Error().Err(err).Str("dir", job.SourceDir).Msg("Checking source directory")
+		result.stageFailed("source", err)
+		report(ctx, reporters, result, logger)
+		return
+	}
+
+	entries, err := os.ReadDir(job.SourceDir)
+	if err != nil {
+		result := &runResult{ID: newRunID(), Job: job.Name, Start: time.Now(), Bucket: cfg.Bucket, Err: err}
+		logger.Error().Err(err).Str("dir", job.SourceDir).Msg("Listing subdirectories")
+		report(ctx, reporters, result, logger)
+		return
+	}
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	workers := make(chan struct{}, job.workers())
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case workers <- struct{}{}:
+		}
+
+		name := entry.Name()
+		sub := job
+		sub.Name = job.Name + "/" + name
+		sub.SourceDir = filepath.Join(job.SourceDir, name)
+		sub.Prefix = path.Join(job.Prefix, name)
+		sub.Subdirs = false
+		sub.RequireMount, sub.Sentinel = false, ""
+
+		subCfg := *cfg
+		subCfg.Prefix = path.Join(cfg.Prefix, name)
+		// Creating a client fills in the region of its options, runs side by side need
+		// their own.
+		if cfg.Options != nil {
+			opts := *cfg.Options
+			subCfg.Options = &opts
+		}
+		runID := newRunID()
+		subLogger := logger.With().Str("run", runID).Str("subdir", name).Logger()
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-workers }()
+
+			archiveDir(ctx, sub, name, runID, &subCfg, reporters, &subLogger)
+		}()
+	}
+}
+
+// archiveDir archives the contents of the provided job's source directory into an archive
+// with the provided name, as the run with the provided ID.
+func archiveDir(ctx context.Context, job jobConfig, name string, runID string, cfg *s3Config, reporters []runReporter, logger *zerolog.Logger) {
+	dir := job.SourceDir
+
+	// The purge filter is derived from the job's retention or its last archived run.
+	now := scheduleNow()
+	filter := job.purgeFilter(now, archivedRuns.last(job.Name))
+	result := &runResult{ID: runID, Job: job.Name, Start: now, Bucket: cfg.Bucket, Progress: &runProgress{}}
+
+	reportStart(ctx, reporters, result, logger)
+	stopProgress := logProgress(result.Progress, progressLogInterval, logger)
+
+	ctx, span := tracer.Start(ctx, "archive", trace.WithAttributes(
+		attribute.String("job", job.Name),
+		attribute.String("dir", dir),
+	))
+	defer func() {
+		stopProgress()
+		result.Duration = time.Since(now)
+		result.logErrors(logger)
+		if result.Err == nil {
+			archivedRuns.record(job.Name, now)
+		}
+		// Interrupted runs are still reported.
+		report(context.WithoutCancel(ctx), reporters, result, logger)
+		endSpan(span, result.Err)
+	}()
+
+	// Ensure the directory holds the files to archive, e.g. that its network filesystem is
+	// mounted, before purging or zipping it.
+	result.Err = job.checkSource(dir)
+	if result.Err != nil {
+		logger.Error().Err(result.Err).Str("dir", dir).Msg("Checking source directory")
+		result.stageFailed("source", result.Err)
+		return
+	}
+
+	// Handle archives staged by crashed or failed runs before they are purged or zipped.
+	err := recoverStaleArchives(ctx, job, dir, cfg, logger)
+	if err != nil {
+		result.stageFailed("stale", err)
+	}
+
+	// Purge the directory of old files.
+	stageStart := time.Now()
+	_, purgeSpan := tracer.Start(ctx, "purge")
+	err = purgeDir(ctx, dir, uint64(filter.UnixMilli()), logger)
+	if err != nil {
+		result.stageFailed("purge", err)
+	}
+	capJobStaging(job, dir, result, logger)
+	purgeSpan.End()
+	result.endStage("purge", stageStart)
+	if ctx.Err() != nil {
+		result.Err = ctx.Err()
+		return
+	}
+
+	// Prepare the directory, e.g. by dumping a database into it.
+	if job.PreRun != "" {
+		stageStart := time.Now()
+		hookCtx, hookSpan := tracer.Start(ctx, hookPreRun)
+		result.Err = runHook(hookCtx, hookPreRun, job.PreRun, job, result, logger)
+		endSpan(hookSpan, result.Err)
+		result.endStage(hookPreRun, stageStart)
+		if result.Err != nil {
+			result.stageFailed(hookPreRun, result.Err)
+			return
+		}
+	}
+
+	// Dump the job's database into the directory.
+	if job.Dump != nil {
+		stageStart := time.Now()
+		dumpCtx, dumpSpan := tracer.Start(ctx, "dump")
+		_, result.Err = runDump(dumpCtx, job, now, logger)
+		endSpan(dumpSpan, result.Err)
+		result.endStage("dump", stageStart)
+		if result.Err != nil {
+			result.stageFailed("dump", result.Err)
+			return
+		}
+	}
+
+	// Incremental and differential jobs only archive the files modified since the archive
+	// they build on.
+	var state *backupState
+	if job.stateful() {
+		state, err = readBackupState(ctx, cfg, job.Name)
+		if err != nil {
+			logger.Warn().Err(err).Msg("Reading backup state, archiving all files")
+			result.stageFailed("state", err)
+		}
+	}
+	plan := job.planBackup(state, now)
+	if plan.Type == backupDelta {
+		if _, ok := deltaBase(job, plan.Base); !ok {
+			logger.Warn().Str("base", plan.Base).Msg("Delta base not cached, uploading a full archive")
+			plan = backupPlan{Type: backupFull}
+		}
+	}
+
+	// Ensure the zip file fits on the filesystem of the directory.
+	files, size := scanDir(dir, plan.Since)
+	result.Err = checkDiskSpace(dir, job.spaceNeeded(size))
+	if result.Err != nil {
+		logger.Error().Err(result.Err).Msg("Checking disk space")
+		result.stageFailed("diskspace", result.Err)
+		return
+	}
+
+	// Capture the files to archive in a snapshot zipped instead of the directory, so files
+	// modified while they are zipped do not yield torn archives.
+	zipSource := dir
+	var removeSnapshot func() error
+	switch {
+	case job.FSSnapshot != "":
+		stageStart = time.Now()
+		var snapshot fsSnapshot
+		snapshot, result.Err = job.createFSSnapshot(ctx, dir, now, logger)
+		result.endStage("snapshot", stageStart)
+		if result.Err != nil {
+			logger.Error().Err(result.Err).Msg("Creating filesystem snapshot")
+			result.stageFailed("snapshot", result.Err)
+			return
+		}
+		zipSource = snapshot.dir()
+		removeSnapshot = func() error { return snapshot.remove(context.WithoutCancel(ctx)) }
+
+	case job.Snapshot != "":
+		stageStart = time.Now()
+		zipSource, result.Err = job.snapshotDir(ctx, dir, plan.Since, logger)
+		result.endStage("snapshot", stageStart)
+		if result.Err != nil {
+			logger.Error().Err(result.Err).Msg("Capturing snapshot")
+			result.stageFailed("snapshot", result.Err)
+			return
+		}
+		removeSnapshot = func() error { return os.RemoveAll(zipSource) }
+	}
+
+	// Zip the directory.
+	zipPath := job.archivePath(dir, name, now)
+	stageStart = time.Now()
+	_, zipSpan := tracer.Start(ctx, "zip")
+	result.Progress.setPhase(phaseZip, files, size)
+	opts := job.zipOptions(plan.Since)
+	opts.Progress = result.Progress
+	opts.Comment = archiveComment(dir, runID, now)
+	opts.Skipped = func(file archivedFile) {
+		result.SkippedFiles = append(result.SkippedFiles, file)
+	}
+	if removeSnapshot != nil {
+		// The databases of snapshots are consistent already.
+		opts.SQLite = false
+	}
+	result.Contents, result.Err = zipDir(ctx, zipSource, zipPath, opts, logger)
+	if removeSnapshot != nil {
+		err := removeSnapshot()
+		if err != nil {
+			logger.Error().Err(err).Str("path", zipSource).Msg("Removing snapshot")
+			result.stageFailed("cleanup", err)
+		}
+	}
+	result.Files = len(result.Contents)
+	zipSpan.SetAttributes(attribute.Int("files", result.Files))
+	endSpan(zipSpan, result.Err)
+	result.endStage("zip", stageStart)
+	if result.Err != nil {
+		result.stageFailed("zip", result.Err)
+		return
+	}
+
+	// Fail runs archiving less than the job's minimum instead of uploading the archive, empty
+	// runs skipping the upload aside.
+	result.Skipped = job.SkipEmpty && result.Files == 0
+	if !result.Skipped {
+		result.Err = job.checkMinimum(result.Contents)
+		if result.Err != nil {
+			logger.Error().Err(result.Err).Msg("Checking archive minimum")
+			result.stageFailed("minimum", result.Err)
+			err := os.Remove(zipPath)
+			if err != nil {
+				logger.Error().Err(err).Str("path", zipPath).Msg("Removing zip file")
+				result.stageFailed("cleanup", err)
+			}
+			return
+		}
+	}
+
+	// Spot-check the archive against the files it was zipped from before anything is
+	// uploaded or purged.
+	if !result.Skipped && job.VerifySample > 0 {
+		result.Err = job.verifySample(dir, zipPath, result.Contents)
+		if result.Err != nil {
+			logger.Error().Err(result.Err).Msg("Verifying archive")
+			result.stageFailed("verify", result.Err)
+			err := os.Remove(zipPath)
+			if err != nil {
+				logger.Error().Err(err).Str("path", zipPath).Msg("Removing zip file")
+				result.stageFailed("cleanup", err)
+			}
+			return
+		}
+	}
+
+	// Skip the upload of empty archives and of archives identical to the previous one.
+	hash := contentHash(result.Contents)
+	result.Unchanged = !result.Skipped && job.unchanged(state, hash)
+	if result.Skipped || result.Unchanged {
+		if result.Skipped {
+			logger.Info().Msg("No files to archive, skipping upload")
+		} else {
+			logger.Info().Str("hash", hash).Msg("Archive unchanged, skipping upload")
+		}
+
+		err := os.Remove(zipPath)
+		if err != nil {
+			logger.Error().Err(err).Str("path", zipPath).Msg("Removing zip file")
+			result.stageFailed("cleanup", err)
+		}
+	} else {
+		// Upload the zip file to the S3/S3-compatible bucket.
+		stageStart := time.Now()
+		uploadCtx, uploadSpan := tracer.Start(ctx, "upload", trace.WithAttributes(
+			attribute.String("bucket", cfg.Bucket),
+		))
+		var zipSize int64
+		if zipInfo, err := os.Stat(zipPath); err == nil {
+			zipSize = zipInfo.Size()
+			result.Progress.setPhase(phaseUpload, 0, zipSize)
+		}
+		uploadCtx = withProgress(uploadCtx, result.Progress)
+
+		// Uploads to a storage which keeps failing are paused, the archive stays staged and
+		// is uploaded once the storage is accessible again.
+		circuit := circuitFor(cfg)
+		if circuit != nil {
+			spooled, err := circuit.admit(uploadCtx, cfg, time.Now(), logger)
+			if err != nil {
+				logger.Warn().Err(err).Str("path", zipPath).Msg("Uploads paused, spooling archive")
+				circuit.spool(spooledArchive{job: job, path: zipPath, cfg: cfg})
+				result.Err = err
+				result.stageFailed("circuit", err)
+				endSpan(uploadSpan, err)
+				capJobStaging(job, dir, result, logger)
+				return
+			}
+			uploadSpooled(uploadCtx, spooled, logger)
+		}
+
+		// Keep the archives under the job's prefix within its maximum bucket usage. Archives
+		// over it stay staged like failed uploads, and are not sent to the fallback.
+		err := enforceQuota(uploadCtx, job, cfg, zipSize, logger)
+		if err != nil {
+			logger.Error().Err(err).Msg("Enforcing bucket usage quota")
+			result.Err = err
+			result.stageFailed("quota", err)
+			endSpan(uploadSpan, err)
+			capJobStaging(job, dir, result, logger)
+			return
+		}
+
+		info, err := uploadArchive(uploadCtx, job, plan, zipPath, cfg, logger)
+		// Archives are kept in their bucket, failed copies and parity data do not fail the run.
+		var copyErr *copyError
+		var parityErr *parityError
+		if errors.As(err, &copyErr) {
+			result.stageFailed("copies", copyErr)
+		}
+		if errors.As(err, &parityErr) {
+			result.stageFailed("parity", parityErr)
+		}
+		if copyErr != nil || parityErr != nil {
+			err = nil
+		}
+		if circuit != nil && ctx.Err() == nil && circuit.record(cfg.Circuit, err, time.Now()) {
+			paused := fmt.Errorf("uploads paused after %d consecutive failed uploads, probing the storage every %s",
+				cfg.Circuit.Threshold, cfg.Circuit.Probe)
+			logger.WithLevel(zerolog.FatalLevel).Err(err).Str("bucket", cfg.Bucket).Int("threshold", cfg.Circuit.Threshold).
+				Msg("Storage failing, circuit open")
+			result.stageFailed("circuit", paused)
+			circuit.spool(spooledArchive{job: job, path: zipPath, cfg: cfg})
+		}
+		if err != nil && cfg.Fallback != nil && ctx.Err() == nil {
+			// Keep the backup of the run at the fallback destination, the failed upload
+			// still needs attention.
+			result.stageFailed("upload", err)
+			info, err = uploadFallback(uploadCtx, zipPath, cfg, logger)
+			if err == nil {
+				result.Bucket, result.Fallback = info.Bucket, cfg.Fallback.Name
+			}
+		}
+		result.Size, result.Key, result.Checksum, result.Err = info.Size, info.Key, info.ChecksumSHA256, err
+		uploadSpan.SetAttributes(attribute.Int64("size", result.Size))
+		endSpan(uploadSpan, result.Err)
+		result.endStage("upload", stageStart)
+		if result.Err != nil {
+			result.stageFailed("upload", result.Err)
+			// The zip file stays staged in the directory, keep the staging area within its cap.
+			capJobStaging(job, dir, result, logger)
+			return
+		}
+
+		// Record the backup chain of the archive for restores. Archives uploaded to the
+		// fallback destination are not chained, the next run builds on the previous archive
+		// again.
+		if result.Fallback == "" {
+			err = writeManifest(ctx, cfg, newArchiveManifest(result, plan))
+			if err != nil {
+				// Archives without a manifest cannot be chained, the next run builds on the
+				// previous archive again.
+				logger.Error().Err(err).Msg("Writing manifest")
+				result.stageFailed("manifest", err)
+			} else if job.stateful() {
+				err := writeBackupState(ctx, cfg, job.Name, state.next(plan, now, result.Key, hash))
+				if err != nil {
+					logger.Error().Err(err).Msg("Writing backup state")
+					result.stageFailed("state", err)
+				}
+			}
+		}
+	}
+
+	// Clean up after the upload, e.g. by rotating logs.
+	if job.PostRun != "" {
+		stageStart := time.Now()
+		hookCtx, hookSpan := tracer.Start(ctx, hookPostRun)
+		result.Err = runHook(hookCtx, hookPostRun, job.PostRun, job, result, logger)
+		endSpan(hookSpan, result.Err)
+		result.endStage(hookPostRun, stageStart)
+		if result.Err != nil {
+			result.stageFailed(hookPostRun, result.Err)
+		}
+	}
+}
+
+// handleReload invokes the provided reload function whenever a SIGHUP signal is received
+// from the OS, until the context is cancelled.
+func handleReload(ctx context.Context, reload func(), wg *sync.WaitGroup) {
+	defer wg.Done()
+
+	// Listen for hangup signals.
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+	defer signal.Stop(hangup)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+
+		case <-hangup:
+			reload()
+		}
+	}
+}
+
+// handleTermination processes context cancellation signals, interrupt, termination and quit
+// signals from the OS or stop requests of the Windows service manager. All of them take the
+// same graceful shutdown path.
+func handleTermination(ctx context.Context, cancel context.CancelFunc, wg *sync.WaitGroup) {
+	defer wg.Done()
+
+	// Listen for interrupt, termination (e.g. docker stop) and quit signals.
+	signals := []os.Signal{os.Interrupt, syscall.SIGTERM, syscall.SIGQUIT}
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, signals...)
+	defer signal.Stop(interrupt)
+
+	// Wait for the context to be cancelled or an interrupt signal.
+	for {
+		select {
+		case <-ctx.Done():
+			return
+
+		case <-interrupt:
+			cancel()
+
+		case <-serviceStop:
+			cancel()
+		}
+	}
+}
+
+// commandExitCode logs the provided error of a subcommand, if any, and returns the process
+// exit code of the subcommand.
+func commandExitCode(err error, logger *zerolog.Logger) int {
+	if err == nil {
+		return exitOK
+	}
+
+	logger.Error().Err(err).Msg("Running command")
+	if errors.Is(err, errChecksFailed) {
+		return exitChecks
+	}
+	return exitRuntime
+}
+
+// run runs the service and returns the process exit code.
+func run() int {
+	// Create the logger.
+	zerolog.TimeFieldFormat = zerolog.TimeFormatUnix
+	zerolog.ErrorStackMarshaler = pkgerrors.MarshalStack
+
+	logger := log.With().Caller().Logger().Output(newRedactingWriter(zerolog.MultiLevelWriter(os.Stderr)))
+
+	cfg := Config{}
+	err := loadConfig(&cfg, "")
+
+	// Print the build information when requested, regardless of the configuration.
+	if showVersion {
+		fmt.Println(getBuildInfo())
+		return exitOK
+	}
+
+	// The doctor reports an invalid configuration as a failed check along with its other
+	// checks.
+	if err != nil && flag.Arg(0) == "doctor" {
+		err = runDoctorCommand(&cfg, err, flag.Args()[1:], os.Stdout)
+		return commandExitCode(err, &logger)
+	}
+
+	if err != nil {
+		logger.Error().Msgf("Loading configuration: %s", strings.ReplaceAll(err.Error(), "\n", ". "))
+		return exitConfig
+	}
+	addSecrets(cfg.secrets()...)
+
+	setCopyBufferSize(cfg.copyBufferSize())
+	setLocation(cfg.location())
+	setInstanceID(cfg.InstanceID)
+	setMaxJobs(cfg.maxJobs())
+
+	// Run the requested subcommand instead of the daemon, if any.
+	if flag.NArg() > 0 {
+		err := runCommand(&cfg, flag.Args(), os.Stdout)
+		return commandExitCode(err, &logger)
+	}
+
+	setLogLevel(cfg.LogLevel)
+
+	// Write human readable log entries to stderr for interactive use, if requested.
+	var stderr io.Writer = os.Stderr
+	if cfg.LogFormat == logFormatConsole {
+		stderr = zerolog.ConsoleWriter{Out: os.Stderr, TimeFormat: time.DateTime}
+	}
+	writers := []io.Writer{stderr}
+
+	// Write the log to a rotating file as well, if configured. The file keeps JSON lines.
+	if cfg.LogFile != "" {
+		file, err := openLogFile(cfg.LogFile, cfg.logMaxSize(), cfg.logMaxBackups())
+		if err != nil {
+			logger.Error().Err(err).Msg("Opening log file")
+			return exitConfig
+		}
+		defer file.Close()
+
+		writers = append(writers, file)
+	}
+
+	// Send the log to syslog as well, if configured, with the priorities of the entry levels.
+	if cfg.Syslog != "" {
+		network, addr, err := parseSyslogAddr(cfg.Syslog)
+		if err != nil {
+			logger.Error().Err(err).Msg("Parsing syslog address")
+			return exitConfig
+		}
+
+		w, err := openSyslog(network, addr)
+		if err != nil {
+			logger.Error().Err(err).Msg("Connecting to syslog")
+			return exitConfig
+		}
+		defer w.Close()
+
+		writers = append(writers, w)
+	}
+
+	// Mask secrets in every log output.
+	logger = logger.Output(newRedactingWriter(zerolog.MultiLevelWriter(writers...)))
+	setRequestLogger(&logger)
+
+	// Export traces of the archive pipeline when an OTLP endpoint is configured.
+	if tracingEnabled() {
+		shutdown, err := setupTracing(context.Background())
+		if err != nil {
+			logger.Error().Err(err).Msg("Setting up tracing")
+			return exitConfig
+		}
+		defer func() {
+			ctx, cancel := context.WithTimeout(context.Background(), reportTimeout)
+			defer cancel()
+
+			err := shutdown(ctx)
+			if err != nil {
+				logger.Error().Err(err).Msg("Shutting down tracing")
+			}
+		}()
+	}
+
+	// Upload stdin instead of running the scheduler, if requested.
+	if streamStdin {
+		err := runStream(context.Background(), &cfg, os.Stdin, &logger)
+		if err != nil {
+			logger.Error().Err(err).Msg("Streaming stdin")
+			return exitRuntime
+		}
+		return exitOK
+	}
+
+	// Prevent concurrent instances from archiving the same directories.
+	if cfg.PIDFile != "" {
+		pid, err := acquirePIDFile(cfg.PIDFile)
+		if err != nil {
+			logger.Error().Err(err).Msg("Acquiring pid file")
+			return exitLocked
+		}
+		defer func() {
+			err := pid.release()
+			if err != nil {
+				logger.Error().Err(err).Msg("Releasing pid file")
+			}
+		}()
+	}
+
+	var wg sync.WaitGroup
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Ensure the source directories and buckets are accessible before scheduling jobs.
+	err = preflight(ctx, &cfg, &logger)
+	if err != nil {
+		logger.Error().Msgf("Preflight checks: %s", strings.ReplaceAll(err.Error(), "\n", ". "))
+		return exitPreflight
+	}
+
+	// Handle archives left staged by previous instances, runs may be hours away. Instances
+	// electing a leader leave them to the leader's runs.
+	if !cfg.leaderElection() {
+		creds := cfg.credentials(&logger)
+		for _, job := range cfg.jobs() {
+			jobLogger := logger.With().Str("job", job.Name).Logger()
+			// Failures are logged, and the stale archives recovered by the next run.
+			_ = recoverStaleJobArchives(ctx, job, cfg.s3Config(job, creds), &jobLogger)
+		}
+	}
+
+	// Campaign for leadership among the instances sharing the lock bucket, if enabled.
+	var elector *s3Elector
+	if cfg.leaderElection() {
+		lockCfg := cfg.s3Config(jobConfig{Bucket: cfg.lockBucket()}, cfg.credentials(&logger))
+		elector, err = newS3Elector(lockCfg, cfg.lockTTL(), &logger)
+		if err != nil {
+			logger.Error().Err(err).Msg("Creating leader elector")
+			return exitScheduler
+		}
+
+		wg.Add(1)
+		go elector.run(ctx, &wg)
+	}
+
+	// Create the cron scheduler.
+	s, err := newScheduler(&cfg, elector, &logger)
+	if err != nil {
+		logger.Error().Err(err).Msg("Creating scheduler")
+		return exitScheduler
+	}
+
+	build := getBuildInfo()
+	logger.Info().Str("version", build.Version).Str("commit", build.Commit).
+		Str("built", build.BuildDate).Msgf("zdts3 started.")
+
+	// Register a scheduled job per configured archive job.
+	tracker := newStatusTracker()
+	watchdog := newStaleWatchdog(time.Now())
+	extra := []runReporter{tracker, watchdog}
+
+	// Follow runs triggered through the API, if enabled.
+	var api *runAPI
+	if cfg.APIToken != "" {
+		api = newRunAPI(s, cfg.APIToken, &logger)
+		extra = append(extra, api)
+	}
+
+	// Record every run in the run history, if enabled.
+	var history *runHistory
+	if cfg.HistoryDB != "" {
+		history, err = openHistory(cfg.HistoryDB)
+		if err != nil {
+			logger.Error().Err(err).Msg("Opening run history")
+			return exitRuntime
+		}
+		defer history.Close()
+
+		extra = append(extra, history)
+	}
+
+	// Persist the run state of every job, if enabled.
+	var state *runState
+	if cfg.StateFile != "" {
+		state, err = openRunState(cfg.StateFile)
+		if err != nil {
+			logger.Error().Err(err).Msg("Opening run state")
+			return exitRuntime
+		}
+
+		extra = append(extra, state)
+
+		// Stale backups are noticed across restarts.
+		for _, job := range cfg.jobs() {
+			watchdog.record(job.Name, state.lastSuccess(job.Name))
+		}
+
+		// Files archived before the restart are purged, and only those.
+		for job, lastSuccess := range state.successes() {
+			archivedRuns.record(job, lastSuccess)
+		}
+	}
+
+	err = scheduleJobs(ctx, s, &cfg, extra, &logger)
+	if err != nil {
+		logger.Error().Err(err).Msg("Scheduling jobs")
+		return exitScheduler
+	}
+
+	s.Start()
+
+	// Run jobs which missed a scheduled run while the service was down.
+	if state != nil {
+		catchUp(s, &cfg, state, &logger)
+	}
+
+	// Keep track of the active configuration, which is swapped on reloads.
+	var active atomic.Pointer[Config]
+	active.Store(&cfg)
+
+	// Alert about jobs without a successful archive within the maximum backup age.
+	wg.Add(1)
+	go watchdog.run(ctx, active.Load, &logger, &wg)
+
+	// Report the storage usage of the archives, if enabled.
+	wg.Add(1)
+	go runUsageReports(ctx, active.Load, &logger, &wg)
+
+	// Verify the stored archives periodically, if enabled.
+	wg.Add(1)
+	go runScrubs(ctx, active.Load, &logger, &wg)
+
+	// Restore and verify the newest archives periodically, if enabled.
+	wg.Add(1)
+	go runDrills(ctx, active.Load, &logger, &wg)
+
+	// Check that the storage stays ready, for readiness probes.
+	ready := &readiness{}
+	wg.Add(1)
+	go ready.run(ctx, active.Load, &logger, &wg)
+
+	// Trigger runs of watched jobs on changes of their source directories.
+	var watchers jobWatchers
+	watchers.watch(ctx, s, &cfg, &logger)
+
+	// Serve the health endpoints, if enabled.
+	if cfg.HealthAddr != "" {
+		ln, err := net.Listen("tcp", cfg.HealthAddr)
+		if err != nil {
+			logger.Error().Err(err).Msg("Listening for health requests")
+			return exitRuntime
+		}
+
+		logger.Info().Str("address", ln.Addr().String()).Msg("Serving health endpoints")
+		wg.Add(1)
+		var dash *dashboard
+		if cfg.dashboard() {
+			dash = newDashboard(s, tracker, history, active.Load, cfg.DashboardUser, cfg.DashboardPass, &logger)
+		}
+
+		go serveHealth(ctx, ln, newHealthHandler(s, tracker, watchdog, ready, dash, api, cfg.profiling()), &logger, &wg)
+	}
+
+	// Serve the gRPC control service, if enabled.
+	if cfg.GRPCAddr != "" {
+		srv, err := newControlServer(s, tracker, api, active.Load, cfg.GRPCCert, cfg.GRPCKey, cfg.GRPCRestoreRoot, &logger)
+		if err != nil {
+			logger.Error().Err(err).Msg("Creating control service")
+			return exitRuntime
+		}
+
+		ln, err := net.Listen("tcp", cfg.GRPCAddr)
+		if err != nil {
+			logger.Error().Err(err).Msg("Listening for control requests")
+			return exitRuntime
+		}
+
+		logger.Info().Str("address", ln.Addr().String()).Msg("Serving control service")
+		wg.Add(1)
+		go serveControl(ctx, ln, srv, &logger, &wg)
+	}
+
+	// Notify systemd that startup completed and keep its watchdog fed, if enabled.
+	notify := func(state string) {
+		_, err := sdNotify(state)
+		if err != nil {
+			logger.Error().Err(err).Str("state", state).Msg("Notifying systemd")
+		}
+	}
+	notify(sdReady)
+
+	interval := watchdogInterval()
+	if interval > 0 {
+		wg.Add(1)
+		go handleWatchdog(ctx, s, interval, &logger, &wg)
+	}
+
+	// Reload the configuration on SIGHUP.
+	reload := func() {
+		logger.Info().Msg("Reloading configuration")
+		notify(sdReloading)
+		defer notify(sdReady)
+
+		reloaded, err := reloadConfig(ctx, s, "", extra, &logger)
+		ready.setConfigError(err)
+		if err != nil {
+			logger.Error().Err(err).Msg("Reloading configuration, keeping active configuration")
+			return
+		}
+		if reloaded.Timezone != active.Load().Timezone {
+			logger.Warn().Str("timezone", reloaded.Timezone).Msg("Timezone changes take effect on restart")
+		}
+		active.Store(reloaded)
+		watchers.watch(ctx, s, reloaded, &logger)
+	}
+
+	wg.Add(1)
+	go handleReload(ctx, reload, &wg)
+
+	wg.Add(1)
+	go handleTermination(ctx, cancel, &wg)
+	wg.Wait()
+
+	// Stop the scheduler, waiting for running jobs to observe the cancellation.
+	notify(sdStopping)
+	watchers.stop()
+	logger.Info().Msg("Shutting down scheduler")
+	err = s.Shutdown()
+	if err != nil {
+		logger.Error().Err(err).Msg("Shutting down scheduler")
+		return exitRuntime
+	}
+
+	// Hand over leadership once running jobs finished.
+	if elector != nil {
+		err = elector.resign(context.Background())
+		if err != nil {
+			logger.Error().Err(err).Msg("Resigning leadership")
+		}
+	}
+
+	return exitOK
+}
+
+// Main runs zdts3 with the command line arguments of the process, as a Windows service when
+// started by the service manager, and returns the exit code of the process.
+func Main() int {
+	return runAsService(run)
+}
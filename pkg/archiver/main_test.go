@@ -0,0 +1,475 @@
+package archiver
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/peterldowns/testy/assert"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+func TestPurgeDir(t *testing.T) {
+	dir := t.TempDir()
+	file, err := os.Create(filepath.Join(dir, "test.txt"))
+	assert.NoError(t, err)
+	file.Close()
+
+	// Purge the directory.
+	filter := uint64(time.Now().Add(time.Hour).UnixMilli())
+	logger := zerolog.Nop()
+	purgeDir(context.Background(), dir, filter, &logger)
+
+	// Assert the directory is now empty.
+	contents, err := os.ReadDir(dir)
+	assert.NoError(t, err)
+
+	assert.Equal(t, 0, len(contents))
+}
+
+func TestPurgeDirLogSample(t *testing.T) {
+	dir := t.TempDir()
+	for i := range purgeLogSample + 5 {
+		assert.NoError(t, os.WriteFile(filepath.Join(dir, strconv.Itoa(i)+".txt"), nil, 0644))
+	}
+
+	// Purge the directory.
+	var logs bytes.Buffer
+	filter := uint64(time.Now().Add(time.Hour).UnixMilli())
+	logger := zerolog.New(&logs).Level(zerolog.InfoLevel)
+	purgeDir(context.Background(), dir, filter, &logger)
+
+	contents, err := os.ReadDir(dir)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, len(contents))
+
+	// Ensure only the first removals are logged at info level, followed by a summary.
+	lines := strings.Split(strings.TrimSpace(logs.String()), "\n")
+	assert.Equal(t, purgeLogSample+1, len(lines))
+	var summary struct {
+		Removed  int `json:"removed"`
+		Unlogged int `json:"unlogged"`
+	}
+	assert.NoError(t, json.Unmarshal([]byte(lines[purgeLogSample]), &summary))
+	assert.Equal(t, purgeLogSample+5, summary.Removed)
+	assert.Equal(t, 5, summary.Unlogged)
+}
+
+func TestZipDir(t *testing.T) {
+	dir := t.TempDir()
+	file, err := os.Create(filepath.Join(dir, "test.txt"))
+	assert.NoError(t, err)
+	file.Close()
+
+	zipPath := filepath.Join(t.TempDir(), "test.zip")
+
+	// Zip the directory.
+	logger := zerolog.Nop()
+	files, err := zipDir(context.Background(), dir, zipPath, zipOptions{Method: zip.Deflate}, &logger)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(files))
+	assert.Equal(t, "test.txt", files[0].Path)
+	assert.Equal(t, "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855", files[0].SHA256)
+
+	// Ensure empty directories are only restored when added.
+	assert.NoError(t, os.Mkdir(filepath.Join(dir, "empty"), 0755))
+	dirsPath := filepath.Join(t.TempDir(), "dirs.zip")
+	for _, dirs := range []bool{false, true} {
+		files, err = zipDir(context.Background(), dir, dirsPath, zipOptions{Method: zip.Deflate, Dirs: dirs}, &logger)
+		assert.NoError(t, err)
+		assert.Equal(t, 1, len(files))
+
+		target := t.TempDir()
+		_, _, err = extractZip(dirsPath, target, extractOptions{})
+		assert.NoError(t, err)
+		_, err = os.Stat(filepath.Join(target, "empty"))
+		assert.Equal(t, dirs, err == nil)
+	}
+
+	// Ensure modification times survive the round trip.
+	modified := time.Date(2025, 3, 10, 23, 50, 0, 0, time.UTC)
+	assert.NoError(t, os.Chtimes(filepath.Join(dir, "test.txt"), modified, modified))
+	roundTrip := filepath.Join(t.TempDir(), "mtime.zip")
+	_, err = zipDir(context.Background(), dir, roundTrip, zipOptions{Method: zip.Deflate}, &logger)
+	assert.NoError(t, err)
+
+	target := t.TempDir()
+	_, _, err = extractZip(roundTrip, target, extractOptions{})
+	assert.NoError(t, err)
+	info, err := os.Stat(filepath.Join(target, "test.txt"))
+	assert.NoError(t, err)
+	assert.True(t, modified.Equal(info.ModTime()))
+
+	// Ensure permissions survive the round trip.
+	if runtime.GOOS != "windows" {
+		assert.NoError(t, os.Chmod(filepath.Join(dir, "test.txt"), 0600))
+		_, err = zipDir(context.Background(), dir, roundTrip, zipOptions{Method: zip.Deflate}, &logger)
+		assert.NoError(t, err)
+		_, _, err = extractZip(roundTrip, target, extractOptions{})
+		assert.NoError(t, err)
+		info, err = os.Stat(filepath.Join(target, "test.txt"))
+		assert.NoError(t, err)
+		assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+	}
+
+	// Ensure compressed file types are stored as is.
+	mixed := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(mixed, "db.sql"), []byte("dump"), 0644))
+	assert.NoError(t, os.WriteFile(filepath.Join(mixed, "db.sql.GZ"), []byte("dump"), 0644))
+	mixedPath := filepath.Join(t.TempDir(), "mixed.zip")
+	_, err = zipDir(context.Background(), mixed, mixedPath, zipOptions{Method: zip.Deflate}, &logger)
+	assert.NoError(t, err)
+	r, err := zip.OpenReader(mixedPath)
+	assert.NoError(t, err)
+	methods := make(map[string]uint16)
+	for _, entry := range r.File {
+		methods[entry.Name] = entry.Method
+	}
+	assert.NoError(t, r.Close())
+	assert.Equal(t, map[string]uint16{"db.sql": zip.Deflate, "db.sql.GZ": zip.Store}, methods)
+
+	// Ensure files modified before the provided time are skipped.
+	files, err = zipDir(context.Background(), dir, filepath.Join(t.TempDir(), "since.zip"), zipOptions{Since: time.Now().Add(time.Hour), Method: zip.Deflate}, &logger)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, len(files))
+
+	// Assert the zip file exists.
+	_, err = os.Stat(zipPath)
+	assert.NoError(t, err)
+
+	// Romove zip file.
+	err = os.Remove(zipPath)
+	assert.NoError(t, err)
+}
+
+func TestZipDirManyEntries(t *testing.T) {
+	// Zip archives of more than 65535 entries require Zip64 end of central directory records.
+	const count = 1<<16 + 100
+	dir := t.TempDir()
+	for i := range count {
+		sub := filepath.Join(dir, strconv.Itoa(i%100))
+		if i < 100 {
+			assert.NoError(t, os.Mkdir(sub, 0755))
+		}
+		assert.NoError(t, os.WriteFile(filepath.Join(sub, strconv.Itoa(i)), []byte(strconv.Itoa(i)), 0644))
+	}
+
+	// The last file zipped, in lexical order, is handed to another user when running as root.
+	const lastName = "99/9999"
+	uid, gid := os.Getuid(), os.Getgid()
+	if canChown() {
+		uid, gid = 1234, 5678
+		assert.NoError(t, os.Lchown(filepath.Join(dir, filepath.FromSlash(lastName)), uid, gid))
+	}
+
+	zipPath := filepath.Join(t.TempDir(), "many.zip")
+	logger := zerolog.Nop()
+	files, err := zipDir(context.Background(), dir, zipPath, zipOptions{Method: zip.Store}, &logger)
+	assert.NoError(t, err)
+	assert.Equal(t, count, len(files))
+
+	r, err := zip.OpenReader(zipPath)
+	assert.NoError(t, err)
+	defer r.Close()
+	assert.Equal(t, count, len(r.File))
+
+	// Ensure every entry is extracted, including those past the 16-bit entry count.
+	target := t.TempDir()
+	extracted, _, err := extractZip(zipPath, target, extractOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, count, extracted)
+	for _, i := range []int{0, 1<<16 - 1, 1 << 16, count - 1} {
+		data, err := os.ReadFile(filepath.Join(target, strconv.Itoa(i%100), strconv.Itoa(i)))
+		assert.NoError(t, err)
+		assert.Equal(t, strconv.Itoa(i), string(data))
+	}
+
+	// Ensure the owner recorded in the extra field of the last entry is restored.
+	info, err := os.Stat(filepath.Join(target, filepath.FromSlash(lastName)))
+	assert.NoError(t, err)
+	restoredUID, restoredGID, ok := fileOwner(info)
+	if ok {
+		assert.Equal(t, lastName, r.File[count-1].Name)
+		entryUID, entryGID, recorded := entryOwner(r.File[count-1].Extra)
+		assert.True(t, recorded)
+		assert.Equal(t, uid, entryUID)
+		assert.Equal(t, gid, entryGID)
+		assert.Equal(t, uint32(uid), restoredUID)
+		assert.Equal(t, uint32(gid), restoredGID)
+	}
+}
+
+func TestZipDirLargeFile(t *testing.T) {
+	// Zipping and reading back more than 4 GiB takes a while, run with ZDTS3_LARGE_TESTS=1.
+	if os.Getenv("ZDTS3_LARGE_TESTS") == "" {
+		t.Skip("large archive tests are disabled")
+	}
+
+	// Zip entries over 4 GiB require Zip64 sizes. The file is sparse, so it takes no space.
+	const size = 4<<30 + 1<<20
+	dir := t.TempDir()
+	file, err := os.Create(filepath.Join(dir, "large.img"))
+	assert.NoError(t, err)
+	_, err = file.WriteAt([]byte("end"), size-3)
+	assert.NoError(t, err)
+	assert.NoError(t, file.Close())
+
+	zipPath := filepath.Join(t.TempDir(), "large.zip")
+	logger := zerolog.Nop()
+	files, err := zipDir(context.Background(), dir, zipPath, zipOptions{Method: zip.Deflate}, &logger)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(files))
+	assert.Equal(t, int64(size), files[0].Size)
+
+	// Read the entry back without extracting it, which would not be sparse.
+	r, err := zip.OpenReader(zipPath)
+	assert.NoError(t, err)
+	defer r.Close()
+	assert.Equal(t, 1, len(r.File))
+	assert.Equal(t, uint64(size), r.File[0].UncompressedSize64)
+
+	entry, err := r.File[0].Open()
+	assert.NoError(t, err)
+	defer entry.Close()
+	hash := sha256.New()
+	n, err := io.Copy(hash, entry)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(size), n)
+	assert.Equal(t, files[0].SHA256, hex.EncodeToString(hash.Sum(nil)))
+}
+
+func TestArchiveMaxFileSize(t *testing.T) {
+	dir := t.TempDir()
+	logger := zerolog.Nop()
+	tracker := newStatusTracker()
+	fake := newFakeS3(t, "test-bucket")
+	s3Cfg := fake.s3Config("test-bucket")
+	job := jobConfig{Name: "db", SourceDir: dir, Retention: "720h", MaxFileSize: "1KiB"}
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "users.sql"), []byte("users"), 0644))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "core"), bytes.Repeat([]byte{0}, 2048), 0644))
+
+	// Ensure files over the maximum size are skipped and listed by the run and its manifest.
+	archive(context.Background(), job, s3Cfg, []runReporter{tracker}, &logger)
+	result := tracker.runs["db"]
+	assert.NoError(t, result.Err)
+	assert.Equal(t, 1, result.Files)
+	assert.Equal(t, "users.sql", result.Contents[0].Path)
+	assert.Equal(t, 1, len(result.SkippedFiles))
+	assert.Equal(t, "core", result.SkippedFiles[0].Path)
+	assert.Equal(t, int64(2048), result.SkippedFiles[0].Size)
+	assert.Equal(t, 1, len(newRunReport(&result).SkippedFiles))
+
+	var manifest archiveManifest
+	err := json.Unmarshal(fake.object("test-bucket", manifestKey(result.Key)).data, &manifest)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(manifest.Files))
+	assert.Equal(t, result.SkippedFiles[0].Path, manifest.SkippedFiles[0].Path)
+}
+
+func TestArchivePurgeArchived(t *testing.T) {
+	dir := t.TempDir()
+	logger := zerolog.Nop()
+	tracker := newStatusTracker()
+	fake := newFakeS3(t, "test-bucket")
+	s3Cfg := fake.s3Config("test-bucket")
+	job := jobConfig{Name: "purge-watched", SourceDir: dir, WatchFiles: 1}
+	old := time.Now().Add(-48 * time.Hour)
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "old.sql"), []byte("old"), 0644))
+	assert.NoError(t, os.Chtimes(filepath.Join(dir, "old.sql"), old, old))
+
+	// Ensure watched jobs archive old files instead of purging them before their first run.
+	archive(context.Background(), job, s3Cfg, []runReporter{tracker}, &logger)
+	result := tracker.runs[job.Name]
+	assert.NoError(t, result.Err)
+	assert.Equal(t, 1, result.Files)
+	assert.Equal(t, result.Start, archivedRuns.last(job.Name))
+
+	// Ensure the next run purges the archived files only.
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "new.sql"), []byte("new"), 0644))
+	archive(context.Background(), job, s3Cfg, []runReporter{tracker}, &logger)
+	result = tracker.runs[job.Name]
+	assert.NoError(t, result.Err)
+	assert.Equal(t, 1, result.Files)
+	assert.Equal(t, "new.sql", result.Contents[0].Path)
+
+	_, err := os.Stat(filepath.Join(dir, "old.sql"))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestPipelineCancel(t *testing.T) {
+	dir := t.TempDir()
+	logger := zerolog.Nop()
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "db.sql"), bytes.Repeat([]byte("dump"), 1<<16), 0644))
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	// Ensure purging stops once the context is done, leaving the files.
+	err := purgeDir(ctx, dir, uint64(time.Now().Add(time.Hour).UnixMilli()), &logger)
+	assert.True(t, errors.Is(err, context.Canceled))
+	_, err = os.Stat(filepath.Join(dir, "db.sql"))
+	assert.NoError(t, err)
+
+	// Ensure zipping stops once the context is done, removing the partial zip file.
+	zipPath := filepath.Join(t.TempDir(), "test.zip")
+	_, err = zipDir(ctx, dir, zipPath, zipOptions{Method: zip.Deflate}, &logger)
+	assert.True(t, errors.Is(err, context.Canceled))
+	_, err = os.Stat(zipPath)
+	assert.True(t, errors.Is(err, fs.ErrNotExist))
+
+	// Ensure copies stop in the middle of a file.
+	ctx, cancel = context.WithCancel(context.Background())
+	r := &contextReader{ctx: ctx, r: bytes.NewReader(make([]byte, 1<<20))}
+	_, err = io.CopyN(io.Discard, r, 1<<10)
+	assert.NoError(t, err)
+	cancel()
+	_, err = io.Copy(io.Discard, r)
+	assert.True(t, errors.Is(err, context.Canceled))
+
+	// Ensure interrupted runs are reported as failed, without leaving a zip file.
+	tracker := newStatusTracker()
+	fake := newFakeS3(t, "test-bucket")
+	job := jobConfig{Name: "db", SourceDir: dir, Retention: "720h"}
+	archive(ctx, job, fake.s3Config("test-bucket"), []runReporter{tracker}, &logger)
+	assert.True(t, errors.Is(tracker.runs["db"].Err, context.Canceled))
+	staged, err := listStagedArchives(dir)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, len(staged))
+}
+
+func TestArchiveSubdirs(t *testing.T) {
+	dir := t.TempDir()
+	var logs bytes.Buffer
+	logger := zerolog.New(&logs)
+	tracker := newStatusTracker()
+	fake := newFakeS3(t, "test-bucket")
+	s3Cfg := fake.s3Config("test-bucket")
+	s3Cfg.Prefix = "dumps"
+	job := jobConfig{Name: "db", SourceDir: dir, Prefix: "dumps", Retention: "720h", Subdirs: true}
+	for _, customer := range []string{"acme", "globex"} {
+		assert.NoError(t, os.Mkdir(filepath.Join(dir, customer), 0755))
+		assert.NoError(t, os.WriteFile(filepath.Join(dir, customer, "db.sql"), []byte(customer), 0644))
+	}
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("notes"), 0644))
+
+	// Ensure every subdirectory is archived separately under its own prefix.
+	archive(context.Background(), job, s3Cfg, []runReporter{tracker}, &logger)
+	for _, customer := range []string{"acme", "globex"} {
+		result := tracker.runs["db/"+customer]
+		assert.NoError(t, result.Err)
+		assert.Equal(t, 1, result.Files)
+		assert.True(t, strings.HasPrefix(result.Key, "dumps/"+customer+"/"+customer+"-"))
+
+		subCfg := *s3Cfg
+		subCfg.Prefix = "dumps/" + customer
+		archives, err := listArchives(context.Background(), &subCfg)
+		assert.NoError(t, err)
+		assert.Equal(t, 1, len(archives))
+	}
+	assert.Equal(t, 2, len(tracker.runs))
+
+	// Ensure every subdirectory run has its own run ID, carried by all its log entries.
+	runIDs := map[string]string{"acme": tracker.runs["db/acme"].ID, "globex": tracker.runs["db/globex"].ID}
+	assert.Equal(t, 16, len(runIDs["acme"]))
+	assert.NotEqual(t, runIDs["acme"], runIDs["globex"])
+	assert.True(t, logs.Len() > 0)
+	for _, line := range strings.Split(strings.TrimSpace(logs.String()), "\n") {
+		var entry struct {
+			Run    string `json:"run"`
+			Subdir string `json:"subdir"`
+		}
+		assert.NoError(t, json.Unmarshal([]byte(line), &entry))
+		assert.Equal(t, runIDs[entry.Subdir], entry.Run)
+	}
+
+	// Files outside of the subdirectories are not archived.
+	archives, err := listArchives(context.Background(), s3Cfg)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, len(archives))
+}
+
+func TestArchiveSubdirsWorkers(t *testing.T) {
+	dir := t.TempDir()
+	logger := zerolog.Nop()
+	tracker := newStatusTracker()
+	fake := newFakeS3(t, "test-bucket")
+	s3Cfg := fake.s3Config("test-bucket")
+	job := jobConfig{Name: "db", SourceDir: dir, Retention: "720h", Subdirs: true, Workers: 3}
+	customers := []string{"acme", "globex", "initech", "umbrella", "hooli"}
+	for _, customer := range customers {
+		assert.NoError(t, os.Mkdir(filepath.Join(dir, customer), 0755))
+		assert.NoError(t, os.WriteFile(filepath.Join(dir, customer, "db.sql"), []byte(customer), 0644))
+	}
+
+	// Ensure every subdirectory is archived when several are archived at a time.
+	archive(context.Background(), job, s3Cfg, []runReporter{tracker}, &logger)
+	assert.Equal(t, len(customers), len(tracker.runs))
+	for _, customer := range customers {
+		result := tracker.runs["db/"+customer]
+		assert.NoError(t, result.Err)
+		assert.Equal(t, 1, result.Files)
+		assert.True(t, fake.object("test-bucket", result.Key) != nil)
+	}
+
+	// Ensure no worker count archives one subdirectory at a time.
+	assert.Equal(t, 1, (&jobConfig{}).workers())
+}
+
+func TestUploadZip(t *testing.T) {
+	dir := t.TempDir()
+	err := os.WriteFile(filepath.Join(dir, "test.txt"), []byte("Hello!"), 0o644)
+	assert.NoError(t, err)
+
+	fake := newFakeS3(t, "backups")
+	logger := log.With().Caller().Logger()
+	ctx := context.Background()
+
+	zipPath := filepath.Join(t.TempDir(), "test.zip")
+	_, err = zipDir(ctx, dir, zipPath, zipOptions{Method: zip.Deflate}, &logger)
+	assert.NoError(t, err)
+	data, err := os.ReadFile(zipPath)
+	assert.NoError(t, err)
+
+	// Ensure the zip file is uploaded and removed once stored.
+	cfg := fake.s3Config("backups")
+	cfg.Prefix = "db"
+	info, err := uploadZip(ctx, zipPath, cfg, &logger)
+	assert.NoError(t, err)
+	assert.Equal(t, "db/test.zip", info.Key)
+	obj := fake.object("backups", "db/test.zip")
+	assert.NotEqual(t, nil, obj)
+	assert.Equal(t, data, obj.data)
+	_, err = os.Stat(zipPath)
+	assert.True(t, errors.Is(err, fs.ErrNotExist))
+
+	// Ensure throttled uploads are retried.
+	err = os.WriteFile(zipPath, data, 0o644)
+	assert.NoError(t, err)
+	fake.mtx.Lock()
+	fake.throttled = 1
+	fake.mtx.Unlock()
+	_, err = uploadZip(ctx, zipPath, fake.s3Config("backups"), &logger)
+	assert.NoError(t, err)
+	assert.NotEqual(t, nil, fake.object("backups", "test.zip"))
+
+	// Ensure failed uploads keep the zip file.
+	err = os.WriteFile(zipPath, data, 0o644)
+	assert.NoError(t, err)
+	_, err = uploadZip(ctx, zipPath, fake.s3Config("missing"), &logger)
+	assert.Error(t, err)
+	_, err = os.Stat(zipPath)
+	assert.NoError(t, err)
+}
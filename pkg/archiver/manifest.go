@@ -0,0 +1,141 @@
+package archiver
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/dnldd/zdts3/pkg/storage"
+	"github.com/minio/minio-go/v7"
+)
+
+// maxChainLength is the maximum number of archives of a backup chain, guarding against
+// cyclic manifests.
+const maxChainLength = 1000
+
+// archiveManifest describes an uploaded archive. It is stored as a sidecar object next to
+// the archive and records the backup chain the archive is part of.
+type archiveManifest struct {
+	Job          string         `json:"job"`
+	Key          string         `json:"key"`
+	Type         string         `json:"type"`
+	Base         string         `json:"base,omitempty"`
+	Since        *time.Time     `json:"since,omitempty"`
+	Created      time.Time      `json:"created"`
+	Files        []archivedFile `json:"files"`
+	SkippedFiles []archivedFile `json:"skippedFiles,omitempty"`
+}
+
+// manifestKey returns the object name of the manifest of the archive with the provided key.
+func manifestKey(key string) string {
+	return strings.TrimSuffix(key, path.Ext(key)) + ".manifest.json"
+}
+
+// newArchiveManifest creates the manifest of the archive uploaded by the provided run.
+func newArchiveManifest(result *runResult, plan backupPlan) *archiveManifest {
+	manifest := &archiveManifest{
+		Job:          result.Job,
+		Key:          result.Key,
+		Type:         plan.Type,
+		Base:         plan.Base,
+		Created:      result.Start,
+		Files:        result.Contents,
+		SkippedFiles: result.SkippedFiles,
+	}
+	if !plan.Since.IsZero() {
+		since := plan.Since
+		manifest.Since = &since
+	}
+
+	return manifest
+}
+
+// writeManifest uploads the provided manifest next to its archive.
+func writeManifest(ctx context.Context, cfg *s3Config, manifest *archiveManifest) error {
+	data, err := json.Marshal(manifest)
+	if err != nil {
+		return err
+	}
+
+	store, err := cfg.openStorage(ctx)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	key := manifestKey(manifest.Key)
+	err = store.Put(ctx, key, data)
+	if err != nil {
+		return fmt.Errorf("writing manifest %s: %w", key, err)
+	}
+
+	return nil
+}
+
+// readManifest reads the manifest of the archive with the provided key. It returns no
+// manifest for archives uploaded without one.
+func readManifest(ctx context.Context, mnc *minio.Client, bucket string, key string) (*archiveManifest, error) {
+	obj, err := mnc.GetObject(ctx, bucket, manifestKey(key), minio.GetObjectOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("reading manifest of %s: %w", key, err)
+	}
+	defer obj.Close()
+
+	var manifest archiveManifest
+	err = json.NewDecoder(obj).Decode(&manifest)
+	if err != nil {
+		if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("reading manifest of %s: %w", key, err)
+	}
+
+	return &manifest, nil
+}
+
+// readStoreManifest reads the manifest of the archive with the provided key from the
+// provided storage. It returns no manifest for archives uploaded without one.
+func readStoreManifest(ctx context.Context, store storage.Storage, key string) (*archiveManifest, error) {
+	src, err := store.Get(ctx, manifestKey(key))
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("reading manifest of %s: %w", key, err)
+	}
+	defer src.Close()
+
+	var manifest archiveManifest
+	err = json.NewDecoder(src).Decode(&manifest)
+	if err != nil {
+		return nil, fmt.Errorf("reading manifest of %s: %w", key, err)
+	}
+
+	return &manifest, nil
+}
+
+// backupChain returns the keys of the archives to extract, oldest first, to restore the
+// archive with the provided key: the full archive it builds on followed by the archives in
+// between. Archives without a manifest are restored on their own.
+func backupChain(ctx context.Context, mnc *minio.Client, bucket string, key string) ([]string, error) {
+	chain := []string{key}
+	for len(chain) <= maxChainLength {
+		manifest, err := readManifest(ctx, mnc, bucket, chain[0])
+		if err != nil {
+			return nil, err
+		}
+
+		if manifest == nil || manifest.Base == "" {
+			return chain, nil
+		}
+
+		chain = append([]string{manifest.Base}, chain...)
+	}
+
+	return nil, fmt.Errorf("backup chain of %s exceeds %d archives", key, maxChainLength)
+}
@@ -0,0 +1,60 @@
+package archiver
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/peterldowns/testy/assert"
+)
+
+func TestManifestKey(t *testing.T) {
+	assert.Equal(t, "db/dump-20250310235000.manifest.json", manifestKey("db/dump-20250310235000.zip"))
+}
+
+func TestBackupChain(t *testing.T) {
+	fake := newFakeS3(t, "test-bucket")
+	s3Cfg := fake.s3Config("test-bucket")
+	ctx := context.Background()
+	mnc, err := minio.New(s3Cfg.Endpoint, s3Cfg.Options)
+	assert.NoError(t, err)
+
+	created := time.Date(2025, 3, 10, 23, 50, 0, 0, time.UTC)
+	full := &archiveManifest{Job: "db", Key: "dump-20250310235000.zip", Type: backupFull, Created: created}
+	incr := &archiveManifest{Job: "db", Key: "dump-20250311235000.zip", Type: backupIncremental, Base: full.Key,
+		Since: &created, Created: created.Add(24 * time.Hour)}
+	for _, manifest := range []*archiveManifest{full, incr} {
+		assert.NoError(t, writeManifest(ctx, s3Cfg, manifest))
+	}
+
+	// Ensure written manifests are read back.
+	manifest, err := readManifest(ctx, mnc, "test-bucket", incr.Key)
+	assert.NoError(t, err)
+	assert.Equal(t, backupIncremental, manifest.Type)
+	assert.Equal(t, full.Key, manifest.Base)
+	assert.True(t, created.Equal(*manifest.Since))
+
+	// Ensure archives without a manifest have none.
+	manifest, err = readManifest(ctx, mnc, "test-bucket", "dump-20250301000000.zip")
+	assert.NoError(t, err)
+	assert.Equal(t, nil, manifest)
+
+	// Ensure chains are returned oldest first.
+	chain, err := backupChain(ctx, mnc, "test-bucket", incr.Key)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{full.Key, incr.Key}, chain)
+
+	chain, err = backupChain(ctx, mnc, "test-bucket", "dump-20250301000000.zip")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"dump-20250301000000.zip"}, chain)
+
+	// Ensure cyclic chains are rejected.
+	for i := range 2 {
+		cyclic := &archiveManifest{Key: fmt.Sprintf("cycle-%d.zip", i), Base: fmt.Sprintf("cycle-%d.zip", 1-i)}
+		assert.NoError(t, writeManifest(ctx, s3Cfg, cyclic))
+	}
+	_, err = backupChain(ctx, mnc, "test-bucket", "cycle-0.zip")
+	assert.Error(t, err)
+}
@@ -0,0 +1,170 @@
+package archiver
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/dnldd/zdts3/pkg/storage"
+	"github.com/rs/zerolog"
+)
+
+// Built-in upload middlewares.
+const (
+	// middlewareTiming logs the duration and throughput of every upload.
+	middlewareTiming = "timing"
+	// middlewareRetry retries failed uploads with a backoff.
+	middlewareRetry = "retry"
+)
+
+const (
+	// uploadRetries is the number of times the retry middleware retries a failed upload.
+	uploadRetries = 2
+	// uploadRetryBackoff is the delay before the first retry of a failed upload, doubled with
+	// every further retry.
+	uploadRetryBackoff = 10 * time.Second
+)
+
+// uploadedFile describes a file uploaded to the storage.
+type uploadedFile struct {
+	// Size is the number of bytes uploaded.
+	Size int64
+	// Checksum is the base64 encoded SHA-256 checksum the storage verified, empty if it
+	// verified none.
+	Checksum string
+}
+
+// putFunc uploads the file at the provided path as the provided key.
+type putFunc func(ctx context.Context, key string, path string) (uploadedFile, error)
+
+// uploadMiddleware wraps the upload of archives to the storage, composing cross-cutting
+// behaviors such as measuring or retrying uploads instead of hardcoding them into the upload.
+type uploadMiddleware interface {
+	// name returns the name of the middleware.
+	name() string
+	// wrap returns the provided put wrapped by the middleware, logging to the provided
+	// logger.
+	wrap(next putFunc, logger *zerolog.Logger) putFunc
+}
+
+// parseUploadMiddleware parses a comma separated list of built-in upload middlewares, e.g.
+// "timing,retry". The first middleware is the outermost.
+func parseUploadMiddleware(value string) ([]uploadMiddleware, error) {
+	if value == "" {
+		return nil, nil
+	}
+
+	var middlewares []uploadMiddleware
+	for _, name := range strings.Split(value, ",") {
+		switch strings.TrimSpace(name) {
+		case middlewareTiming:
+			middlewares = append(middlewares, timingMiddleware{})
+		case middlewareRetry:
+			middlewares = append(middlewares, retryMiddleware{retries: uploadRetries, backoff: uploadRetryBackoff})
+		default:
+			return nil, fmt.Errorf("unknown upload middleware %q (%s, %s)", name, middlewareTiming, middlewareRetry)
+		}
+	}
+
+	return middlewares, nil
+}
+
+// uploadMiddleware returns the upload middlewares of the configuration.
+func (c *Config) uploadMiddleware() []uploadMiddleware {
+	middlewares, _ := parseUploadMiddleware(c.UploadMiddleware)
+	return middlewares
+}
+
+// chainUploads wraps the provided put with the provided middlewares, the first being the
+// outermost.
+func chainUploads(put putFunc, middlewares []uploadMiddleware, logger *zerolog.Logger) putFunc {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		put = middlewares[i].wrap(put, logger)
+	}
+
+	return put
+}
+
+// storePut returns the put of the provided storage, which verifies the size of the stored
+// file.
+func storePut(store storage.Storage) putFunc {
+	return func(ctx context.Context, key string, path string) (uploadedFile, error) {
+		var uploaded uploadedFile
+		var err error
+		if checksummed, ok := store.(storage.ChecksumStorage); ok {
+			uploaded.Size, uploaded.Checksum, err = checksummed.PutFileChecksum(ctx, key, path)
+		} else {
+			uploaded.Size, err = store.PutFile(ctx, key, path)
+		}
+		if err != nil {
+			return uploadedFile{}, err
+		}
+
+		return uploaded, verifyStored(ctx, store, key, path)
+	}
+}
+
+// timingMiddleware logs the duration and throughput of every upload.
+type timingMiddleware struct{}
+
+// name returns the name of the middleware.
+func (timingMiddleware) name() string {
+	return middlewareTiming
+}
+
+// wrap returns the provided put, logging the duration and throughput of its uploads.
+func (timingMiddleware) wrap(next putFunc, logger *zerolog.Logger) putFunc {
+	return func(ctx context.Context, key string, path string) (uploadedFile, error) {
+		start := time.Now()
+		uploaded, err := next(ctx, key, path)
+		elapsed := time.Since(start)
+
+		event := logger.Info()
+		if err != nil {
+			event = logger.Warn().Err(err)
+		}
+		rate := float64(uploaded.Size) / max(elapsed.Seconds(), 1e-9)
+		event.Str("object", key).Int64("size", uploaded.Size).Dur("duration", elapsed).
+			Float64("bytesPerSecond", rate).Msg("Upload timing")
+
+		return uploaded, err
+	}
+}
+
+// retryMiddleware retries failed uploads with a backoff doubled with every retry. Uploads
+// are not retried once the context is done.
+type retryMiddleware struct {
+	retries int
+	backoff time.Duration
+}
+
+// name returns the name of the middleware.
+func (retryMiddleware) name() string {
+	return middlewareRetry
+}
+
+// wrap returns the provided put, retrying its failed uploads.
+func (m retryMiddleware) wrap(next putFunc, logger *zerolog.Logger) putFunc {
+	return func(ctx context.Context, key string, path string) (uploadedFile, error) {
+		backoff := m.backoff
+		for attempt := 0; ; attempt++ {
+			uploaded, err := next(ctx, key, path)
+			if err == nil || attempt == m.retries || ctx.Err() != nil {
+				return uploaded, err
+			}
+
+			logger.Warn().Err(err).Str("object", key).Dur("backoff", backoff).Int("retry", attempt+1).
+				Msg("Retrying upload")
+
+			timer := time.NewTimer(backoff)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return uploaded, err
+			case <-timer.C:
+			}
+			backoff *= 2
+		}
+	}
+}
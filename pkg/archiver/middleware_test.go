@@ -0,0 +1,95 @@
+package archiver
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/peterldowns/testy/assert"
+	"github.com/rs/zerolog"
+)
+
+// recordingMiddleware records the order its uploads are wrapped in.
+type recordingMiddleware struct {
+	label string
+	calls *[]string
+}
+
+// name returns the name of the middleware.
+func (m recordingMiddleware) name() string {
+	return m.label
+}
+
+// wrap returns the provided put, recording its calls.
+func (m recordingMiddleware) wrap(next putFunc, _ *zerolog.Logger) putFunc {
+	return func(ctx context.Context, key string, path string) (uploadedFile, error) {
+		*m.calls = append(*m.calls, m.label)
+		return next(ctx, key, path)
+	}
+}
+
+func TestUploadMiddleware(t *testing.T) {
+	middlewares, err := parseUploadMiddleware("timing, retry")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(middlewares))
+	assert.Equal(t, middlewareTiming, middlewares[0].name())
+	assert.Equal(t, middlewareRetry, middlewares[1].name())
+	_, err = parseUploadMiddleware("timing,encrypt")
+	assert.Error(t, err)
+
+	// Ensure middlewares wrap the put in order, the first being the outermost.
+	logger := zerolog.Nop()
+	var calls []string
+	put := chainUploads(func(context.Context, string, string) (uploadedFile, error) {
+		calls = append(calls, "put")
+		return uploadedFile{Size: 3}, nil
+	}, []uploadMiddleware{
+		recordingMiddleware{label: "outer", calls: &calls},
+		recordingMiddleware{label: "inner", calls: &calls},
+		timingMiddleware{},
+	}, &logger)
+	uploaded, err := put(context.Background(), "backups/dump.zip", "dump.zip")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), uploaded.Size)
+	assert.Equal(t, []string{"outer", "inner", "put"}, calls)
+
+	// Ensure failed uploads are retried up to the retry limit.
+	attempts := 0
+	failing := func(context.Context, string, string) (uploadedFile, error) {
+		attempts++
+		if attempts < 3 {
+			return uploadedFile{}, errors.New("connection reset")
+		}
+		return uploadedFile{Size: 3}, nil
+	}
+	retry := retryMiddleware{retries: 2, backoff: time.Millisecond}
+	_, err = retry.wrap(failing, &logger)(context.Background(), "backups/dump.zip", "dump.zip")
+	assert.NoError(t, err)
+	assert.Equal(t, 3, attempts)
+
+	attempts = -10
+	_, err = retry.wrap(failing, &logger)(context.Background(), "backups/dump.zip", "dump.zip")
+	assert.Error(t, err)
+	assert.Equal(t, -7, attempts)
+}
+
+func TestUploadZipMiddleware(t *testing.T) {
+	fake := newFakeS3(t, "test-bucket")
+	s3Cfg := fake.s3Config("test-bucket")
+	logger := zerolog.Nop()
+
+	// Ensure uploads of archives go through the configured middlewares.
+	var calls []string
+	s3Cfg.Middleware = []uploadMiddleware{recordingMiddleware{label: "recorded", calls: &calls}}
+	zipPath := filepath.Join(t.TempDir(), "dump-20260101235000.zip")
+	assert.NoError(t, os.WriteFile(zipPath, zipBytes(t, map[string]string{"db.sql": "dump"}), 0644))
+
+	info, err := uploadZip(context.Background(), zipPath, s3Cfg, &logger)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"recorded"}, calls)
+	assert.Equal(t, "dump-20260101235000.zip", info.Key)
+	assert.Equal(t, int64(len(fake.object("test-bucket", info.Key).data)), info.Size)
+}
@@ -0,0 +1,42 @@
+package archiver
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/dustin/go-humanize"
+)
+
+// errBelowMinimum indicates a run archived fewer files or bytes than its job's minimum.
+var errBelowMinimum = errors.New("archive below minimum")
+
+// minBytes returns the minimum total size of the files archived by the job's runs, zero if
+// there is none.
+func (j *jobConfig) minBytes() int64 {
+	size, err := parseSize(j.MinBytes)
+	if j.MinBytes == "" || err != nil {
+		return 0
+	}
+
+	return size
+}
+
+// checkMinimum ensures the provided archived files meet the job's minimum file count and
+// total size. An unusually small archive usually means the producer of the files, e.g. a
+// database dump, broke upstream.
+func (j *jobConfig) checkMinimum(files []archivedFile) error {
+	if len(files) < j.MinFiles {
+		return fmt.Errorf("%w: %d files archived, expected at least %d", errBelowMinimum, len(files), j.MinFiles)
+	}
+
+	var size int64
+	for _, file := range files {
+		size += file.Size
+	}
+	if minSize := j.minBytes(); size < minSize {
+		return fmt.Errorf("%w: %s archived, expected at least %s", errBelowMinimum,
+			humanize.IBytes(uint64(size)), humanize.IBytes(uint64(minSize)))
+	}
+
+	return nil
+}
@@ -0,0 +1,51 @@
+package archiver
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/peterldowns/testy/assert"
+	"github.com/rs/zerolog"
+)
+
+func TestArchiveMinimum(t *testing.T) {
+	dir := t.TempDir()
+	logger := zerolog.Nop()
+	tracker := newStatusTracker()
+	fake := newFakeS3(t, "test-bucket")
+	s3Cfg := fake.s3Config("test-bucket")
+	job := jobConfig{Name: "db", SourceDir: dir, Retention: "720h", MinFiles: 2, MinBytes: "1KiB"}
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "users.sql"), []byte(strings.Repeat("u", 600)), 0644))
+
+	// Ensure runs archiving fewer files than the minimum fail without uploading.
+	archive(context.Background(), job, s3Cfg, []runReporter{tracker}, &logger)
+	result := tracker.runs["db"]
+	assert.True(t, errors.Is(result.Err, errBelowMinimum))
+	assert.Equal(t, "minimum", result.Errors[0].Stage)
+
+	archives, err := listArchives(context.Background(), s3Cfg)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, len(archives))
+
+	entries, err := os.ReadDir(dir)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(entries))
+
+	// Ensure runs archiving fewer bytes than the minimum fail.
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "orders.sql"), []byte("o"), 0644))
+	archive(context.Background(), job, s3Cfg, []runReporter{tracker}, &logger)
+	assert.True(t, errors.Is(tracker.runs["db"].Err, errBelowMinimum))
+
+	// Ensure runs meeting the minimum are uploaded.
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "orders.sql"), []byte(strings.Repeat("o", 600)), 0644))
+	archive(context.Background(), job, s3Cfg, []runReporter{tracker}, &logger)
+	assert.NoError(t, tracker.runs["db"].Err)
+
+	archives, err = listArchives(context.Background(), s3Cfg)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(archives))
+}
@@ -0,0 +1,203 @@
+package archiver
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dustin/go-humanize"
+)
+
+// Notification events.
+const (
+	// notifyAlways notifies about every run.
+	notifyAlways = "always"
+	// notifyOnFailure notifies about failed runs.
+	notifyOnFailure = "on-failure"
+	// notifyOnRecovery notifies about the first successful run after a failure.
+	notifyOnRecovery = "on-recovery"
+)
+
+// defaultNotifyOn is the default notification events setting.
+const defaultNotifyOn = notifyAlways
+
+// eventFilter selects the runs notifications are sent for. It tracks the outcome of the last
+// run of every job to detect recoveries.
+type eventFilter struct {
+	always   bool
+	failure  bool
+	recovery bool
+
+	mtx    sync.Mutex
+	failed map[string]bool
+}
+
+// parseEventFilter parses a comma separated list of notification events, e.g.
+// "on-failure,on-recovery".
+func parseEventFilter(value string) (*eventFilter, error) {
+	if value == "" {
+		value = defaultNotifyOn
+	}
+
+	filter := &eventFilter{failed: make(map[string]bool)}
+	for _, event := range strings.Split(value, ",") {
+		switch strings.TrimSpace(event) {
+		case notifyAlways:
+			filter.always = true
+		case notifyOnFailure:
+			filter.failure = true
+		case notifyOnRecovery:
+			filter.recovery = true
+		default:
+			return nil, fmt.Errorf("unknown notification event %q (always, on-failure, on-recovery)", event)
+		}
+	}
+
+	return filter, nil
+}
+
+// matches records the outcome of the provided run and returns whether a notification should
+// be sent for it.
+func (f *eventFilter) matches(result *runResult) bool {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+
+	// Runs completing with stage errors need attention as much as failed runs.
+	failed := result.hasErrors()
+	recovered := !failed && f.failed[result.Job]
+	f.failed[result.Job] = failed
+
+	return f.always || (failed && f.failure) || (recovered && f.recovery)
+}
+
+// runSummary returns a one line, human readable summary of the provided run, listing the
+// errors of its stages.
+func runSummary(result *runResult) string {
+	instance := instanceName()
+
+	// Failures outside of runs, e.g. stale backups, have no duration.
+	if result.Err != nil && result.Duration == 0 {
+		return fmt.Sprintf("zdts3 job %s on %s failed: %s", result.Job, instance, result.errorSummary())
+	}
+
+	if result.Err != nil {
+		return fmt.Sprintf("zdts3 job %s on %s failed after %s: %s", result.Job, instance,
+			result.Duration.Round(time.Millisecond), result.errorSummary())
+	}
+
+	if result.Skipped {
+		return fmt.Sprintf("zdts3 job %s on %s found no files to archive, skipped the upload", result.Job, instance)
+	}
+
+	summary := fmt.Sprintf("zdts3 job %s on %s archived %d files (%s) in %s", result.Job, instance,
+		result.Files, humanize.IBytes(uint64(result.Size)), result.Duration.Round(time.Millisecond))
+	if len(result.Errors) > 0 {
+		summary += " with errors: " + result.errorSummary()
+	}
+
+	return summary
+}
+
+// postJSON posts the provided payload as JSON to the provided URL.
+func postJSON(ctx context.Context, client *http.Client, url string, payload any) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("encoding payload: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("creating request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("unexpected status %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+
+	return nil
+}
+
+// chatWebhook sends run notifications to a Slack or Discord incoming webhook.
+type chatWebhook struct {
+	service string
+	url     string
+	filter  *eventFilter
+	client  *http.Client
+}
+
+// newSlackWebhook creates a reporter notifying the provided Slack incoming webhook.
+func newSlackWebhook(url string, filter *eventFilter) *chatWebhook {
+	return &chatWebhook{service: "slack", url: url, filter: filter, client: &http.Client{}}
+}
+
+// newDiscordWebhook creates a reporter notifying the provided Discord webhook.
+func newDiscordWebhook(url string, filter *eventFilter) *chatWebhook {
+	return &chatWebhook{service: "discord", url: url, filter: filter, client: &http.Client{}}
+}
+
+// name returns the name of the reporter.
+func (c *chatWebhook) name() string {
+	return c.service
+}
+
+// report posts a summary of the provided run to the webhook, if the run matches the
+// configured notification events.
+func (c *chatWebhook) report(ctx context.Context, result *runResult) error {
+	if !c.filter.matches(result) {
+		return nil
+	}
+
+	icon := ":white_check_mark:"
+	if result.Err != nil {
+		icon = ":x:"
+	} else if result.hasErrors() {
+		icon = ":warning:"
+	}
+	return c.send(ctx, icon+" "+runSummary(result))
+}
+
+// reportUsage posts a summary of the provided storage usage to the webhook.
+func (c *chatWebhook) reportUsage(ctx context.Context, usage *storageUsage) error {
+	return c.send(ctx, ":bar_chart: "+usageSummary(usage))
+}
+
+// reportDrill posts a summary of the provided restore drill to the webhook.
+func (c *chatWebhook) reportDrill(ctx context.Context, result *drillResult) error {
+	icon := ":white_check_mark:"
+	if result.Err != nil {
+		icon = ":x:"
+	}
+	return c.send(ctx, icon+" "+drillSummary(result))
+}
+
+// send posts the provided text to the webhook.
+func (c *chatWebhook) send(ctx context.Context, text string) error {
+	var payload any
+	switch c.service {
+	case "discord":
+		payload = map[string]string{"content": text}
+	default:
+		payload = map[string]string{"text": text}
+	}
+
+	err := postJSON(ctx, c.client, c.url, payload)
+	if err != nil {
+		return fmt.Errorf("notifying %s: %w", c.service, err)
+	}
+
+	return nil
+}
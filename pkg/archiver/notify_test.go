@@ -0,0 +1,118 @@
+package archiver
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/peterldowns/testy/assert"
+	"github.com/rs/zerolog"
+)
+
+func TestEventFilter(t *testing.T) {
+	_, err := parseEventFilter("on-success")
+	assert.Error(t, err)
+
+	success := &runResult{Job: "db"}
+	failure := &runResult{Job: "db", Err: errors.New("upload failed")}
+
+	// Ensure every run matches by default.
+	filter, err := parseEventFilter("")
+	assert.NoError(t, err)
+	assert.True(t, filter.matches(success))
+	assert.True(t, filter.matches(failure))
+
+	// Ensure only failures and the first success after a failure match.
+	filter, err = parseEventFilter("on-failure, on-recovery")
+	assert.NoError(t, err)
+	assert.False(t, filter.matches(success))
+	assert.True(t, filter.matches(failure))
+	assert.True(t, filter.matches(failure))
+	assert.True(t, filter.matches(success))
+	assert.False(t, filter.matches(success))
+
+	// Ensure recoveries are tracked per job.
+	filter, err = parseEventFilter("on-recovery")
+	assert.NoError(t, err)
+	assert.False(t, filter.matches(failure))
+	assert.False(t, filter.matches(&runResult{Job: "files"}))
+	assert.True(t, filter.matches(success))
+
+	// Ensure runs completing with stage errors are treated as failures.
+	filter, err = parseEventFilter("on-failure")
+	assert.NoError(t, err)
+	withErrors := &runResult{Job: "db", Errors: []stageError{{Stage: "manifest", Err: errors.New("access denied")}}}
+	assert.True(t, filter.matches(withErrors))
+}
+
+func TestRunSummaryErrors(t *testing.T) {
+	// Ensure the summary lists the errors of every stage.
+	result := &runResult{Job: "db", Files: 3, Size: 2048, Duration: time.Second, Errors: []stageError{
+		{Stage: "purge", Err: errors.New("permission denied")},
+		{Stage: "manifest", Err: errors.New("access denied")},
+	}}
+	summary := runSummary(result)
+	assert.True(t, strings.Contains(summary, "archived 3 files"))
+	assert.True(t, strings.HasSuffix(summary, "with errors: purge: permission denied; manifest: access denied"))
+
+	// Ensure failed runs list the errors of their stages instead of the run error alone.
+	result.Err = errors.New("connection refused")
+	result.Errors = append(result.Errors, stageError{Stage: "upload", Err: result.Err})
+	summary = runSummary(result)
+	assert.True(t, strings.HasSuffix(summary,
+		"failed after 1s: purge: permission denied; manifest: access denied; upload: connection refused"))
+
+	// Ensure the errors are reported as a single structured log entry.
+	var logs bytes.Buffer
+	logger := zerolog.New(&logs)
+	result.logErrors(&logger)
+	var entry struct {
+		Level  string             `json:"level"`
+		Job    string             `json:"job"`
+		Errors []stageErrorReport `json:"errors"`
+	}
+	assert.NoError(t, json.Unmarshal(logs.Bytes(), &entry))
+	assert.Equal(t, "error", entry.Level)
+	assert.Equal(t, "db", entry.Job)
+	assert.Equal(t, stageErrorReports(result), entry.Errors)
+}
+
+func TestChatWebhook(t *testing.T) {
+	var payload map[string]string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		payload = nil
+		err := json.NewDecoder(r.Body).Decode(&payload)
+		assert.NoError(t, err)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	ctx := context.Background()
+	filter, err := parseEventFilter("on-failure")
+	assert.NoError(t, err)
+
+	// Ensure Slack messages are sent as text for matching runs only.
+	slack := newSlackWebhook(srv.URL, filter)
+	err = slack.report(ctx, &runResult{Job: "db"})
+	assert.NoError(t, err)
+	assert.Equal(t, 0, len(payload))
+
+	err = slack.report(ctx, &runResult{Job: "db", Err: errors.New("upload failed")})
+	assert.NoError(t, err)
+	assert.True(t, strings.Contains(payload["text"], "zdts3 job db"))
+	assert.True(t, strings.Contains(payload["text"], "upload failed"))
+
+	// Ensure Discord messages are sent as content.
+	filter, err = parseEventFilter("always")
+	assert.NoError(t, err)
+	discord := newDiscordWebhook(srv.URL, filter)
+	err = discord.report(ctx, &runResult{Job: "db", Files: 3, Size: 2048})
+	assert.NoError(t, err)
+	assert.True(t, strings.Contains(payload["content"], "archived 3 files (2.0 KiB)"))
+}
@@ -0,0 +1,71 @@
+package archiver
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+)
+
+// objectRetention is the object lock retention of uploaded archives, which cannot be
+// deleted or overwritten until their retention period has passed. A nil retention locks
+// nothing.
+type objectRetention struct {
+	Mode   minio.RetentionMode
+	Period time.Duration
+}
+
+// parseObjectLockMode parses an object lock retention mode, governance or compliance.
+func parseObjectLockMode(value string) (minio.RetentionMode, error) {
+	mode := minio.RetentionMode(strings.ToUpper(value))
+	if !mode.IsValid() {
+		return "", fmt.Errorf("invalid object lock mode %q (governance, compliance)", value)
+	}
+
+	return mode, nil
+}
+
+// validateObjectLock validates the provided object lock retention mode and period, which
+// must be set together.
+func validateObjectLock(mode string, period string) error {
+	if mode == "" && period == "" {
+		return nil
+	}
+
+	if mode == "" || period == "" {
+		return errors.New("object lock mode and period must be set together")
+	}
+
+	var errs error
+	_, err := parseObjectLockMode(mode)
+	if err != nil {
+		errs = errors.Join(errs, err)
+	}
+
+	retention, err := parseRetention(period)
+	if err != nil || retention <= 0 {
+		errs = errors.Join(errs, fmt.Errorf("invalid object lock period %q", period))
+	}
+
+	return errs
+}
+
+// setOptions sets the retention of an object uploaded at the provided time on the provided
+// upload options. Object lock uploads require a content checksum.
+func (r *objectRetention) setOptions(opts *minio.PutObjectOptions, now time.Time) {
+	if r == nil {
+		return
+	}
+
+	opts.Mode = r.Mode
+	opts.RetainUntilDate = now.Add(r.Period).UTC()
+	opts.SendContentMd5 = true
+}
+
+// locked returns whether an object modified at the provided time is still retained at the
+// provided time.
+func (r *objectRetention) locked(modified time.Time, now time.Time) bool {
+	return r != nil && now.Before(modified.Add(r.Period))
+}
@@ -0,0 +1,73 @@
+package archiver
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/peterldowns/testy/assert"
+	"github.com/rs/zerolog"
+)
+
+func TestValidateObjectLock(t *testing.T) {
+	tests := []struct {
+		name     string
+		mode     string
+		period   string
+		hasError bool
+	}{
+		{name: "unset", hasError: false},
+		{name: "governance", mode: "governance", period: "30d", hasError: false},
+		{name: "compliance", mode: "COMPLIANCE", period: "720h", hasError: false},
+		{name: "invalid mode", mode: "legal", period: "30d", hasError: true},
+		{name: "invalid period", mode: "governance", period: "month", hasError: true},
+		{name: "zero period", mode: "governance", period: "0d", hasError: true},
+		{name: "mode without period", mode: "governance", hasError: true},
+		{name: "period without mode", period: "30d", hasError: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := validateObjectLock(test.mode, test.period)
+			assert.Equal(t, test.hasError, err != nil)
+		})
+	}
+}
+
+func TestObjectLock(t *testing.T) {
+	fake := newFakeS3(t, "test-bucket")
+	job := jobConfig{Name: "db", ObjectLockMode: "governance", ObjectLockPeriod: "30d"}
+	cfg := fake.s3Config("test-bucket")
+	cfg.Prefix = "backups"
+	cfg.Retention = job.objectRetention()
+	ctx := context.Background()
+	logger := zerolog.Nop()
+
+	// Ensure archives are uploaded with their retention.
+	zipPath := filepath.Join(t.TempDir(), "dump-20260101235000.zip")
+	assert.NoError(t, os.WriteFile(zipPath, zipBytes(t, map[string]string{"users.sql": "data"}), 0600))
+	start := time.Now()
+	_, err := uploadZip(ctx, zipPath, cfg, &logger)
+	assert.NoError(t, err)
+
+	header := fake.object("test-bucket", "backups/dump-20260101235000.zip").header
+	assert.Equal(t, string(minio.Governance), header.Get("X-Amz-Object-Lock-Mode"))
+	until, err := time.Parse(time.RFC3339, header.Get("X-Amz-Object-Lock-Retain-Until-Date"))
+	assert.NoError(t, err)
+	assert.True(t, !until.Before(start.Add(30*24*time.Hour).Truncate(time.Second)))
+	assert.NotEqual(t, "", header.Get("Content-Md5"))
+
+	// Ensure pruning keeps archives under retention.
+	pruned, err := pruneArchives(ctx, cfg, time.Now().Add(time.Hour), 0, false)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, len(pruned))
+
+	// Ensure archives past their retention are pruned.
+	cfg.Retention.Period = time.Nanosecond
+	pruned, err = pruneArchives(ctx, cfg, time.Now().Add(time.Hour), 0, false)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(pruned))
+}
@@ -0,0 +1,87 @@
+package archiver
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// Overwrite policies, applied to restored files which already exist in the target directory.
+const (
+	// overwriteAlways replaces existing files.
+	overwriteAlways = "always"
+	// overwriteNewer replaces existing files modified before the archived file.
+	overwriteNewer = "newer"
+	// overwriteNever keeps existing files.
+	overwriteNever = "never"
+)
+
+// validateOverwritePolicy validates the provided overwrite policy.
+func validateOverwritePolicy(policy string) error {
+	switch policy {
+	case "", overwriteAlways, overwriteNewer, overwriteNever:
+		return nil
+
+	default:
+		return fmt.Errorf("invalid overwrite policy %q, expected %s, %s or %s", policy, overwriteNever,
+			overwriteNewer, overwriteAlways)
+	}
+}
+
+// extractOptions are the options of extracting archives.
+type extractOptions struct {
+	// Include selects the entries to extract, every entry when nil.
+	Include includeFilter
+	// Overwrite is the policy applied to existing files, overwriteAlways when empty.
+	Overwrite string
+	// StripPrefix is the leading directory removed from the names of extracted entries.
+	// Entries outside of it are not extracted.
+	StripPrefix string
+
+	// extracted holds the paths extracted by the restore. Later archives of a backup chain
+	// replace them regardless of the overwrite policy.
+	extracted map[string]bool
+}
+
+// selective returns whether only some entries of archives are extracted.
+func (o *extractOptions) selective() bool {
+	return o.Include != nil || o.StripPrefix != ""
+}
+
+// targetName returns the name the entry with the provided name is extracted as, and whether
+// it is extracted at all.
+func (o *extractOptions) targetName(name string) (string, bool) {
+	if !o.Include.matches(name) {
+		return name, false
+	}
+
+	if o.StripPrefix == "" {
+		return name, true
+	}
+
+	stripped, ok := strings.CutPrefix(name, o.StripPrefix+"/")
+	if !ok || stripped == "" {
+		return name, false
+	}
+
+	return stripped, true
+}
+
+// keep returns whether the existing file at the provided path is kept rather than replaced
+// by an archived file with the provided modification time.
+func (o *extractOptions) keep(target string, modified time.Time) (bool, error) {
+	if o.Overwrite == "" || o.Overwrite == overwriteAlways || o.extracted[target] {
+		return false, nil
+	}
+
+	info, err := os.Lstat(target)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	return o.Overwrite == overwriteNever || !modified.After(info.ModTime()), nil
+}
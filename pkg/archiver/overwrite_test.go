@@ -0,0 +1,126 @@
+package archiver
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/peterldowns/testy/assert"
+)
+
+func TestRestoreOverwrite(t *testing.T) {
+	fake := newFakeS3(t, "test-bucket")
+	s3Cfg := fake.s3Config("test-bucket")
+
+	archived := time.Date(2026, time.January, 1, 23, 50, 0, 0, time.UTC)
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	for name, content := range map[string]string{
+		"customers/acme/users.sql":   "archived",
+		"customers/acme/orders.sql":  "archived",
+		"customers/globex/users.sql": "archived",
+	} {
+		entry, err := w.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: archived})
+		assert.NoError(t, err)
+		_, err = entry.Write([]byte(content))
+		assert.NoError(t, err)
+	}
+	assert.NoError(t, w.Close())
+	putArchives(t, s3Cfg, map[string][]byte{"dump-20260101235000.zip": buf.Bytes()})
+
+	cfg := &Config{
+		Endpoint:        s3Cfg.Endpoint,
+		AccessKeyID:     "test-accesskeyid",
+		SecretAccessKey: "test-secretaccesskey",
+		Jobs:            []jobConfig{{Name: "db", SourceDir: t.TempDir(), Bucket: "test-bucket"}},
+		staticCreds:     true,
+		transport:       s3Cfg.Options.Transport,
+	}
+
+	// live creates a target directory holding a file older and a file newer than the archive.
+	live := func() string {
+		dir := t.TempDir()
+		assert.NoError(t, os.MkdirAll(filepath.Join(dir, "customers", "acme"), 0755))
+		for name, modified := range map[string]time.Time{
+			"users.sql":  archived.Add(-time.Hour),
+			"orders.sql": archived.Add(time.Hour),
+		} {
+			path := filepath.Join(dir, "customers", "acme", name)
+			assert.NoError(t, os.WriteFile(path, []byte("live"), 0644))
+			assert.NoError(t, os.Chtimes(path, modified, modified))
+		}
+		return dir
+	}
+	read := func(dir string, name string) string {
+		data, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(name)))
+		assert.NoError(t, err)
+		return string(data)
+	}
+
+	// Ensure existing files are replaced by default.
+	target := live()
+	var out bytes.Buffer
+	err := runCommand(cfg, []string{"restore", "-target-dir", target}, &out)
+	assert.NoError(t, err)
+	assert.Equal(t, "archived", read(target, "customers/acme/users.sql"))
+	assert.Equal(t, "archived", read(target, "customers/acme/orders.sql"))
+
+	// Ensure existing files are kept when never overwriting.
+	target = live()
+	out.Reset()
+	err = runCommand(cfg, []string{"restore", "-target-dir", target, "-overwrite", "never"}, &out)
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(out.String(), "Restored dump-20260101235000.zip from 1 archives: 1 files"))
+	assert.Equal(t, "live", read(target, "customers/acme/users.sql"))
+	assert.Equal(t, "live", read(target, "customers/acme/orders.sql"))
+	assert.Equal(t, "archived", read(target, "customers/globex/users.sql"))
+
+	// Ensure only files older than the archived ones are replaced when overwriting newer.
+	target = live()
+	err = runCommand(cfg, []string{"restore", "-target-dir", target, "-overwrite", "newer"}, &out)
+	assert.NoError(t, err)
+	assert.Equal(t, "archived", read(target, "customers/acme/users.sql"))
+	assert.Equal(t, "live", read(target, "customers/acme/orders.sql"))
+
+	// Ensure the prefix is stripped from restored paths and files outside of it are skipped.
+	target = t.TempDir()
+	out.Reset()
+	err = runCommand(cfg, []string{"restore", "-target-dir", target, "-strip-prefix", "customers/acme/"}, &out)
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(out.String(), "Restored dump-20260101235000.zip from 1 archives: 2 files"))
+	assert.Equal(t, "archived", read(target, "users.sql"))
+	assert.Equal(t, "archived", read(target, "orders.sql"))
+	_, err = os.Stat(filepath.Join(target, "customers"))
+	assert.True(t, os.IsNotExist(err))
+
+	// Ensure invalid policies and prefixes are rejected.
+	err = runCommand(cfg, []string{"restore", "-target-dir", t.TempDir(), "-overwrite", "sometimes"}, &out)
+	assert.Error(t, err)
+	err = runCommand(cfg, []string{"restore", "-target-dir", t.TempDir(), "-strip-prefix", "../customers"}, &out)
+	assert.Error(t, err)
+}
+
+func TestRestoreOverwriteChain(t *testing.T) {
+	fake := newFakeS3(t, "test-bucket")
+	s3Cfg := fake.s3Config("test-bucket")
+	incremental := []byte(`{"key":"dump-20260102235000.zip","type":"incremental","base":"dump-20260101235000.zip"}`)
+	putArchives(t, s3Cfg, map[string][]byte{
+		"dump-20260101235000.zip":           zipBytes(t, map[string]string{"users.sql": "v1"}),
+		"dump-20260102235000.zip":           zipBytes(t, map[string]string{"users.sql": "v2"}),
+		"dump-20260102235000.manifest.json": incremental,
+	})
+
+	// Ensure later archives of a chain replace the files of earlier ones regardless of the
+	// policy.
+	target := t.TempDir()
+	_, err := restoreArchiveFiles(context.Background(), s3Cfg, "dump-20260102235000.zip", target, extractOptions{Overwrite: overwriteNever})
+	assert.NoError(t, err)
+	data, err := os.ReadFile(filepath.Join(target, "users.sql"))
+	assert.NoError(t, err)
+	assert.Equal(t, "v2", string(data))
+}
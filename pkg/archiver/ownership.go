@@ -0,0 +1,85 @@
+package archiver
+
+import (
+	"archive/zip"
+	"encoding/binary"
+	"os"
+)
+
+// zipExtraUnixOwner is the ID of the Info-ZIP Unix extra field of zip entries, recording the
+// numeric owner and group of the archived file.
+const zipExtraUnixOwner = 0x7875
+
+// ownerExtra returns the extra field recording the owner and group of the provided file, nil
+// where file ownership is not available.
+func ownerExtra(info os.FileInfo) []byte {
+	uid, gid, ok := fileOwner(info)
+	if !ok {
+		return nil
+	}
+
+	// The field holds its version and the size prefixed owner and group.
+	extra := binary.LittleEndian.AppendUint16(nil, zipExtraUnixOwner)
+	extra = binary.LittleEndian.AppendUint16(extra, 11)
+	extra = append(extra, 1, 4)
+	extra = binary.LittleEndian.AppendUint32(extra, uid)
+	extra = append(extra, 4)
+	return binary.LittleEndian.AppendUint32(extra, gid)
+}
+
+// entryOwner returns the owner and group recorded in the provided extra fields of a zip
+// entry, if any.
+func entryOwner(extra []byte) (int, int, bool) {
+	for len(extra) >= 4 {
+		id := binary.LittleEndian.Uint16(extra)
+		size := int(binary.LittleEndian.Uint16(extra[2:]))
+		if len(extra) < 4+size {
+			return 0, 0, false
+		}
+		field := extra[4 : 4+size]
+		extra = extra[4+size:]
+		if id != zipExtraUnixOwner || len(field) == 0 || field[0] != 1 {
+			continue
+		}
+
+		uid, field, ok := readOwnerID(field[1:])
+		if !ok {
+			return 0, 0, false
+		}
+		gid, _, ok := readOwnerID(field)
+		return uid, gid, ok
+	}
+
+	return 0, 0, false
+}
+
+// readOwnerID reads a size prefixed little endian ID of the Info-ZIP Unix extra field, and
+// returns the rest of the field.
+func readOwnerID(field []byte) (int, []byte, bool) {
+	if len(field) == 0 {
+		return 0, nil, false
+	}
+	size := int(field[0])
+	if size > 4 || len(field) < 1+size {
+		return 0, nil, false
+	}
+
+	var id uint32
+	for i := size; i > 0; i-- {
+		id = id<<8 | uint32(field[i])
+	}
+
+	return int(id), field[1+size:], true
+}
+
+// restoreOwner sets the owner and group of the provided extracted path to those recorded in
+// the provided zip entry, if any. Only restores running as root can hand files to other
+// users, other restores keep owning the files they extract.
+func restoreOwner(target string, entry *zip.File) error {
+	uid, gid, ok := entryOwner(entry.Extra)
+	if !ok || !canChown() {
+		return nil
+	}
+
+	return os.Lchown(target, uid, gid)
+}
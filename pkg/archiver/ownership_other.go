@@ -0,0 +1,17 @@
+//go:build !unix
+
+package archiver
+
+import "os"
+
+// fileOwner returns the numeric owner and group of the provided file. File ownership is not
+// recorded on this platform.
+func fileOwner(os.FileInfo) (uint32, uint32, bool) {
+	return 0, 0, false
+}
+
+// canChown returns whether this process can change the owner of files. File ownership is not
+// restored on this platform.
+func canChown() bool {
+	return false
+}
@@ -0,0 +1,75 @@
+package archiver
+
+import (
+	"archive/zip"
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/peterldowns/testy/assert"
+	"github.com/rs/zerolog"
+)
+
+func TestEntryOwner(t *testing.T) {
+	// Ensure owners are read from the Info-ZIP Unix extra field among other fields.
+	extra := []byte{0x55, 0x54, 0x05, 0x00, 0x01, 0x00, 0x00, 0x00, 0x00}
+	extra = append(extra, 0x75, 0x78, 0x0b, 0x00, 0x01, 0x04, 0xe8, 0x03, 0x00, 0x00, 0x04, 0x64, 0x00, 0x00, 0x00)
+	uid, gid, ok := entryOwner(extra)
+	assert.True(t, ok)
+	assert.Equal(t, 1000, uid)
+	assert.Equal(t, 100, gid)
+
+	// Ensure truncated fields and unsupported versions are ignored.
+	_, _, ok = entryOwner(extra[:len(extra)-2])
+	assert.False(t, ok)
+	_, _, ok = entryOwner([]byte{0x75, 0x78, 0x03, 0x00, 0x02, 0x00, 0x00})
+	assert.False(t, ok)
+}
+
+func TestZipDirOwnership(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("file ownership is not recorded on windows")
+	}
+
+	dir := t.TempDir()
+	logger := zerolog.Nop()
+	assert.NoError(t, os.Mkdir(filepath.Join(dir, "data"), 0755))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "data", "users.sql"), []byte("users"), 0644))
+
+	// Files are handed to another user when running as root.
+	uid, gid := os.Getuid(), os.Getgid()
+	if canChown() {
+		uid, gid = 1234, 5678
+		assert.NoError(t, os.Lchown(filepath.Join(dir, "data", "users.sql"), uid, gid))
+	}
+
+	zipPath := filepath.Join(t.TempDir(), "archive.zip")
+	_, err := zipDir(context.Background(), dir, zipPath, zipOptions{Method: zip.Deflate}, &logger)
+	assert.NoError(t, err)
+
+	// Ensure the owner and group of every entry are recorded.
+	reader, err := zip.OpenReader(zipPath)
+	assert.NoError(t, err)
+	defer reader.Close()
+	for _, entry := range reader.File {
+		entryUID, entryGID, ok := entryOwner(entry.Extra)
+		assert.True(t, ok)
+		if entry.Name == "data/users.sql" {
+			assert.Equal(t, uid, entryUID)
+			assert.Equal(t, gid, entryGID)
+		}
+	}
+
+	// Ensure restores keep the recorded owners.
+	target := t.TempDir()
+	_, _, err = extractZip(zipPath, target, extractOptions{})
+	assert.NoError(t, err)
+	info, err := os.Stat(filepath.Join(target, "data", "users.sql"))
+	assert.NoError(t, err)
+	restoredUID, restoredGID, ok := fileOwner(info)
+	assert.True(t, ok)
+	assert.Equal(t, uint32(uid), restoredUID)
+	assert.Equal(t, uint32(gid), restoredGID)
+}
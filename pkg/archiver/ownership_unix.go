@@ -0,0 +1,24 @@
+//go:build unix
+
+package archiver
+
+import (
+	"os"
+	"syscall"
+)
+
+// fileOwner returns the numeric owner and group of the provided file.
+func fileOwner(info os.FileInfo) (uint32, uint32, bool) {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, 0, false
+	}
+
+	return stat.Uid, stat.Gid, true
+}
+
+// canChown returns whether this process can change the owner of files, which requires
+// running as root.
+func canChown() bool {
+	return os.Geteuid() == 0
+}
@@ -0,0 +1,405 @@
+package archiver
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/dnldd/zdts3/pkg/storage"
+	"github.com/klauspost/reedsolomon"
+	"github.com/rs/zerolog"
+)
+
+const (
+	// parityMaxShards is the maximum number of data shards archives are split into for their
+	// parity data.
+	parityMaxShards = 100
+	// parityMinShardSize is the minimum size of the data shards of archives.
+	parityMinShardSize = 64 << 10
+	// parityBlockSize is the size of the blocks of every shard encoded at a time, bounding
+	// the memory used by large archives.
+	parityBlockSize = 256 << 10
+)
+
+// parityKey returns the object name of the parity data of the archive with the provided key.
+func parityKey(key string) string {
+	return strings.TrimSuffix(key, path.Ext(key)) + ".parity"
+}
+
+// parityIndex describes the parity data of an archive. The archive is split into equally
+// sized data shards, the last one padded with zeros, and Reed-Solomon parity shards of the
+// same size are computed from them. The parity data holds the parity shards followed by the
+// JSON encoded index and its size as a big endian uint32.
+type parityIndex struct {
+	// Size is the size of the archive.
+	Size int64 `json:"size"`
+	// ShardSize is the size of every shard.
+	ShardSize int64 `json:"shardSize"`
+	// Data holds the hex encoded SHA-256 hashes of the data shards.
+	Data []string `json:"data"`
+	// Parity holds the hex encoded SHA-256 hashes of the parity shards.
+	Parity []string `json:"parity"`
+}
+
+// paritySharding returns the number of data and parity shards, and their size, of the
+// parity data of an archive of the provided size with the provided percentage of its size.
+func paritySharding(size int64, percent int) (int, int, int64) {
+	dataShards := int(min(max((size+parityMinShardSize-1)/parityMinShardSize, 1), parityMaxShards))
+	shardSize := max((size+int64(dataShards)-1)/int64(dataShards), 1)
+	parityShards := max((dataShards*percent+99)/100, 1)
+
+	return dataShards, parityShards, shardSize
+}
+
+// zeroReader reads zeros.
+type zeroReader struct{}
+
+// Read fills the provided buffer with zeros.
+func (zeroReader) Read(p []byte) (int, error) {
+	clear(p)
+	return len(p), nil
+}
+
+// shardReader returns a reader of the data shard with the provided index of the provided
+// archive, padded with zeros past the end of the archive.
+func shardReader(archive io.ReaderAt, index int, shardSize int64, size int64) io.Reader {
+	offset := int64(index) * shardSize
+	n := min(max(size-offset, 0), shardSize)
+
+	return io.MultiReader(io.NewSectionReader(archive, offset, n), io.LimitReader(zeroReader{}, shardSize-n))
+}
+
+// clippedWriter writes up to a number of bytes to the wrapped writer, and discards the rest.
+type clippedWriter struct {
+	w io.Writer
+	n int64
+}
+
+// Write writes the provided bytes which fit in the remaining bytes to the wrapped writer.
+func (c *clippedWriter) Write(p []byte) (int, error) {
+	n := min(int64(len(p)), c.n)
+	_, err := c.w.Write(p[:n])
+	if err != nil {
+		return 0, err
+	}
+	c.n -= n
+
+	return len(p), nil
+}
+
+// hexHashes returns the hex encoded sums of the provided hashes.
+func hexHashes(hashes []hash.Hash) []string {
+	sums := make([]string, len(hashes))
+	for i, h := range hashes {
+		sums[i] = hex.EncodeToString(h.Sum(nil))
+	}
+
+	return sums
+}
+
+// writeParity writes parity data of the zip file at the provided path to the provided file,
+// with the provided percentage of the size of the zip file.
+func writeParity(zipPath string, percent int, dst *os.File) error {
+	src, err := os.Open(zipPath)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	info, err := src.Stat()
+	if err != nil {
+		return err
+	}
+
+	dataShards, parityShards, shardSize := paritySharding(info.Size(), percent)
+	enc, err := reedsolomon.NewStream(dataShards, parityShards, reedsolomon.WithStreamBlockSize(parityBlockSize))
+	if err != nil {
+		return err
+	}
+
+	// Hash the shards while they are encoded, to find the damaged ones on repairs.
+	dataHashes := make([]hash.Hash, dataShards)
+	data := make([]io.Reader, dataShards)
+	for i := range data {
+		dataHashes[i] = sha256.New()
+		data[i] = io.TeeReader(shardReader(src, i, shardSize, info.Size()), dataHashes[i])
+	}
+
+	parityHashes := make([]hash.Hash, parityShards)
+	parity := make([]io.Writer, parityShards)
+	for i := range parity {
+		parityHashes[i] = sha256.New()
+		parity[i] = io.MultiWriter(io.NewOffsetWriter(dst, int64(i)*shardSize), parityHashes[i])
+	}
+
+	err = enc.Encode(data, parity)
+	if err != nil {
+		return fmt.Errorf("encoding parity data: %w", err)
+	}
+
+	index, err := json.Marshal(parityIndex{
+		Size:      info.Size(),
+		ShardSize: shardSize,
+		Data:      hexHashes(dataHashes),
+		Parity:    hexHashes(parityHashes),
+	})
+	if err != nil {
+		return err
+	}
+	index = binary.BigEndian.AppendUint32(index, uint32(len(index)))
+
+	_, err = dst.WriteAt(index, int64(parityShards)*shardSize)
+	return err
+}
+
+// readParityIndex reads the index of the provided parity data of the provided size.
+func readParityIndex(parity io.ReaderAt, size int64) (*parityIndex, error) {
+	var length [4]byte
+	if size < int64(len(length)) {
+		return nil, errors.New("invalid parity data")
+	}
+	_, err := parity.ReadAt(length[:], size-int64(len(length)))
+	if err != nil {
+		return nil, fmt.Errorf("reading parity index: %w", err)
+	}
+
+	n := int64(binary.BigEndian.Uint32(length[:]))
+	if n > size-int64(len(length)) {
+		return nil, errors.New("invalid parity data")
+	}
+
+	buf := make([]byte, n)
+	_, err = parity.ReadAt(buf, size-int64(len(length))-n)
+	if err != nil {
+		return nil, fmt.Errorf("reading parity index: %w", err)
+	}
+
+	var index parityIndex
+	err = json.Unmarshal(buf, &index)
+	if err != nil {
+		return nil, fmt.Errorf("decoding parity index: %w", err)
+	}
+
+	if len(index.Data) == 0 || len(index.Parity) == 0 || index.ShardSize <= 0 ||
+		int64(len(index.Parity))*index.ShardSize+n+int64(len(length)) != size {
+		return nil, errors.New("invalid parity data")
+	}
+
+	return &index, nil
+}
+
+// hashReader returns the hex encoded SHA-256 hash of the content of the provided reader.
+func hashReader(r io.Reader) (string, error) {
+	h := sha256.New()
+	_, err := io.Copy(h, r)
+	if err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// repairZip repairs the damaged data shards of the zip file at the provided path with the
+// parity data at the provided path, and returns the number of repaired shards. Archives with
+// more damaged shards than parity shards cannot be repaired.
+func repairZip(zipPath string, parityPath string) (int, error) {
+	parity, err := os.Open(parityPath)
+	if err != nil {
+		return 0, err
+	}
+	defer parity.Close()
+
+	info, err := parity.Stat()
+	if err != nil {
+		return 0, err
+	}
+
+	index, err := readParityIndex(parity, info.Size())
+	if err != nil {
+		return 0, err
+	}
+
+	archive, err := os.OpenFile(zipPath, os.O_RDWR, 0)
+	if err != nil {
+		return 0, err
+	}
+	defer archive.Close()
+
+	// Truncated or extended archives are damaged at their end.
+	err = archive.Truncate(index.Size)
+	if err != nil {
+		return 0, err
+	}
+
+	dataShards, parityShards := len(index.Data), len(index.Parity)
+	valid := make([]io.Reader, dataShards+parityShards)
+	fill := make([]io.Writer, dataShards+parityShards)
+	var damaged []int
+	for i, expected := range index.Data {
+		sum, err := hashReader(shardReader(archive, i, index.ShardSize, index.Size))
+		if err != nil {
+			return 0, err
+		}
+
+		if sum != expected {
+			damaged = append(damaged, i)
+			offset := int64(i) * index.ShardSize
+			fill[i] = &clippedWriter{w: io.NewOffsetWriter(archive, offset), n: max(index.Size-offset, 0)}
+			continue
+		}
+		valid[i] = shardReader(archive, i, index.ShardSize, index.Size)
+	}
+
+	if len(damaged) == 0 {
+		return 0, nil
+	}
+
+	missing := len(damaged)
+	for i, expected := range index.Parity {
+		offset := int64(i) * index.ShardSize
+		sum, err := hashReader(io.NewSectionReader(parity, offset, index.ShardSize))
+		if err != nil {
+			return 0, err
+		}
+
+		if sum != expected {
+			missing++
+			continue
+		}
+		valid[dataShards+i] = io.NewSectionReader(parity, offset, index.ShardSize)
+	}
+
+	if missing > parityShards {
+		return 0, fmt.Errorf("%d damaged shards, parity data repairs up to %d", missing, parityShards)
+	}
+
+	enc, err := reedsolomon.NewStream(dataShards, parityShards, reedsolomon.WithStreamBlockSize(parityBlockSize))
+	if err != nil {
+		return 0, err
+	}
+
+	err = enc.Reconstruct(valid, fill)
+	if err != nil {
+		return 0, fmt.Errorf("reconstructing damaged shards: %w", err)
+	}
+
+	// Ensure the repaired shards match their hashes.
+	for _, i := range damaged {
+		sum, err := hashReader(shardReader(archive, i, index.ShardSize, index.Size))
+		if err != nil {
+			return 0, err
+		}
+
+		if sum != index.Data[i] {
+			return 0, fmt.Errorf("repaired shard %d does not match its hash", i)
+		}
+	}
+
+	return len(damaged), nil
+}
+
+// downloadParity downloads the parity data of the archive with the provided key from the
+// provided storage next to the zip file at the provided path and returns its path, empty if
+// the archive has no parity data.
+func downloadParity(ctx context.Context, store storage.Storage, key string, zipPath string) (string, error) {
+	src, err := store.Get(ctx, parityKey(key))
+	if errors.Is(err, fs.ErrNotExist) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("downloading parity data of %s: %w", key, err)
+	}
+	defer src.Close()
+
+	tmp, err := os.CreateTemp(filepath.Dir(zipPath), ".parity-*")
+	if err != nil {
+		return "", fmt.Errorf("creating download file: %w", err)
+	}
+
+	_, err = copyBuffers().copy(tmp, src)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return "", fmt.Errorf("downloading parity data of %s: %w", key, err)
+	}
+
+	return tmp.Name(), nil
+}
+
+// repairDownload repairs the zip file at the provided path, downloaded from the archive with
+// the provided key of the provided storage, with the archive's parity data if it does not
+// read back. It returns the number of repaired shards, zero if the zip file was intact or
+// the archive has no parity data.
+func repairDownload(ctx context.Context, store storage.Storage, key string, zipPath string) (int, error) {
+	if verifyZip(zipPath, nil) == nil {
+		return 0, nil
+	}
+
+	parityPath, err := downloadParity(ctx, store, key, zipPath)
+	if err != nil || parityPath == "" {
+		return 0, err
+	}
+	defer os.Remove(parityPath)
+
+	repaired, err := repairZip(zipPath, parityPath)
+	if err != nil {
+		return 0, fmt.Errorf("repairing archive %s: %w", key, err)
+	}
+
+	return repaired, nil
+}
+
+// parityError is the error of uploading the parity data of an archive which was uploaded to
+// its bucket. It does not fail the run.
+type parityError struct {
+	err error
+}
+
+// Error returns the message of the error.
+func (e *parityError) Error() string {
+	return e.err.Error()
+}
+
+// Unwrap returns the error of the upload.
+func (e *parityError) Unwrap() error {
+	return e.err
+}
+
+// uploadParity uploads parity data of the zip file at the provided path, with the provided
+// percentage of its size, next to the archive with the provided key.
+func uploadParity(ctx context.Context, store storage.Storage, key string, zipPath string, percent int, logger *zerolog.Logger) error {
+	tmp, err := os.CreateTemp("", "zdts3-parity-*")
+	if err != nil {
+		return fmt.Errorf("creating parity file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	err = writeParity(zipPath, percent, tmp)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("writing parity data: %w", err)
+	}
+
+	size, err := store.PutFile(ctx, parityKey(key), tmp.Name())
+	if err != nil {
+		return fmt.Errorf("uploading parity data: %w", err)
+	}
+
+	logger.Info().Str("object", parityKey(key)).Int64("size", size).Int("percent", percent).Msg("Uploaded parity data")
+	return nil
+}
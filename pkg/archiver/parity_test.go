@@ -0,0 +1,137 @@
+package archiver
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/peterldowns/testy/assert"
+	"github.com/rs/zerolog"
+)
+
+// writeParityFile writes parity data of the file at the provided path with the provided
+// percentage of its size and returns its path.
+func writeParityFile(t *testing.T, path string, percent int) string {
+	parity, err := os.Create(path + ".parity")
+	assert.NoError(t, err)
+	defer parity.Close()
+
+	err = writeParity(path, percent, parity)
+	assert.NoError(t, err)
+
+	return parity.Name()
+}
+
+func TestParity(t *testing.T) {
+	data := make([]byte, 1<<20+123)
+	rand.New(rand.NewSource(1)).Read(data)
+	path := filepath.Join(t.TempDir(), "dump.zip")
+	err := os.WriteFile(path, data, 0644)
+	assert.NoError(t, err)
+
+	// Ensure the parity data has the requested share of shards.
+	dataShards, parityShards, shardSize := paritySharding(int64(len(data)), 10)
+	assert.Equal(t, 17, dataShards)
+	assert.Equal(t, 2, parityShards)
+	parityPath := writeParityFile(t, path, 10)
+
+	// Ensure intact archives are left as they are.
+	repaired, err := repairZip(path, parityPath)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, repaired)
+
+	// Ensure as many damaged shards as parity shards are repaired, including the last one.
+	damaged := bytes.Clone(data)
+	damaged[10] ^= 0xff
+	damaged[len(damaged)-1] ^= 0xff
+	err = os.WriteFile(path, damaged, 0644)
+	assert.NoError(t, err)
+	repaired, err = repairZip(path, parityPath)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, repaired)
+	restored, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.True(t, bytes.Equal(data, restored))
+
+	// Ensure truncated archives are repaired.
+	err = os.WriteFile(path, data[:len(data)-100], 0644)
+	assert.NoError(t, err)
+	repaired, err = repairZip(path, parityPath)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, repaired)
+	restored, err = os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.True(t, bytes.Equal(data, restored))
+
+	// Ensure more damaged shards than parity shards are not repaired.
+	damaged = bytes.Clone(data)
+	for i := range 3 {
+		damaged[int64(i)*shardSize] ^= 0xff
+	}
+	err = os.WriteFile(path, damaged, 0644)
+	assert.NoError(t, err)
+	_, err = repairZip(path, parityPath)
+	assert.Error(t, err)
+
+	// Ensure invalid parity data is rejected.
+	err = os.WriteFile(parityPath, []byte("parity"), 0644)
+	assert.NoError(t, err)
+	_, err = repairZip(path, parityPath)
+	assert.Error(t, err)
+}
+
+func TestParityRestore(t *testing.T) {
+	fake := newFakeS3(t, "test-bucket")
+	cfg := fake.s3Config("test-bucket")
+	cfg.Prefix = "backups"
+	cfg.Parity = 10
+	logger := zerolog.Nop()
+	ctx := context.Background()
+
+	dir := t.TempDir()
+	content := make([]byte, 256<<10)
+	rand.New(rand.NewSource(2)).Read(content)
+	err := os.WriteFile(filepath.Join(dir, "users.sql"), content, 0644)
+	assert.NoError(t, err)
+	zipPath := filepath.Join(t.TempDir(), "dump-20260101235000.zip")
+	_, err = zipDir(ctx, dir, zipPath, zipOptions{Method: zip.Store}, &logger)
+	assert.NoError(t, err)
+
+	// Ensure the parity data is uploaded next to the archive.
+	_, err = uploadZip(ctx, zipPath, cfg, &logger)
+	assert.NoError(t, err)
+	assert.NotEqual(t, nil, fake.object("test-bucket", "backups/dump-20260101235000.parity"))
+
+	// Ensure restores repair damaged archives with their parity data.
+	fake.mtx.Lock()
+	fake.buckets["test-bucket"]["backups/dump-20260101235000.zip"].data[1000] ^= 0xff
+	fake.mtx.Unlock()
+
+	target := t.TempDir()
+	result, err := restoreArchive(ctx, cfg, "backups/dump-20260101235000.zip", target)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"backups/dump-20260101235000.zip"}, result.Repaired)
+	restored, err := os.ReadFile(filepath.Join(target, "users.sql"))
+	assert.NoError(t, err)
+	assert.True(t, bytes.Equal(content, restored))
+
+	// Ensure scrubs report damaged archives as repairable.
+	store, err := cfg.openStorage(ctx)
+	assert.NoError(t, err)
+	defer store.Close()
+	archives, err := listArchives(ctx, cfg)
+	assert.NoError(t, err)
+	err = scrubArchive(ctx, store, archives[0])
+	assert.Error(t, err)
+	assert.True(t, strings.HasSuffix(err.Error(), ", repairable with its parity data"))
+
+	// Ensure removing the archive removes its parity data.
+	err = removeArchive(ctx, store, "backups/dump-20260101235000.zip")
+	assert.NoError(t, err)
+	assert.Equal(t, nil, fake.object("test-bucket", "backups/dump-20260101235000.parity"))
+}
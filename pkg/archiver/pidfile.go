@@ -0,0 +1,66 @@
+package archiver
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// pidFile is an exclusively locked file holding the process ID of the running instance. The
+// lock is released by the OS if the process dies, so a stale file never blocks a restart.
+type pidFile struct {
+	path string
+	file *os.File
+}
+
+// acquirePIDFile locks the pid file at the provided path and writes the process ID to it. It
+// fails if another instance holds the lock.
+func acquirePIDFile(path string) (*pidFile, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("opening pid file: %w", err)
+	}
+
+	err = lockFile(file)
+	if err != nil {
+		data, _ := os.ReadFile(path)
+		file.Close()
+
+		pid := strings.TrimSpace(string(data))
+		if pid == "" {
+			pid = "unknown"
+		}
+
+		return nil, fmt.Errorf("another instance (pid %s) holds pid file %s: %w", pid, path, err)
+	}
+
+	err = file.Truncate(0)
+	if err == nil {
+		_, err = file.WriteAt([]byte(strconv.Itoa(os.Getpid())+"\n"), 0)
+	}
+	if err == nil {
+		err = file.Sync()
+	}
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("writing pid file: %w", err)
+	}
+
+	return &pidFile{path: path, file: file}, nil
+}
+
+// release removes the pid file and releases its lock.
+func (p *pidFile) release() error {
+	// Open files can't be removed on some platforms, retry once the file is closed.
+	err := os.Remove(p.path)
+	closeErr := p.file.Close()
+	if err != nil && !os.IsNotExist(err) {
+		err = os.Remove(p.path)
+	}
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("removing pid file: %w", err)
+	}
+
+	return closeErr
+}
@@ -0,0 +1,37 @@
+package archiver
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/peterldowns/testy/assert"
+)
+
+func TestPIDFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "zdts3.pid")
+
+	// Ensure the pid file is created with the process ID.
+	pid, err := acquirePIDFile(path)
+	assert.NoError(t, err)
+
+	data, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, strconv.Itoa(os.Getpid())+"\n", string(data))
+
+	// Ensure a second instance can't acquire the pid file.
+	_, err = acquirePIDFile(path)
+	assert.Error(t, err)
+
+	// Ensure releasing removes the pid file and allows it to be acquired again.
+	err = pid.release()
+	assert.NoError(t, err)
+
+	_, err = os.Stat(path)
+	assert.True(t, os.IsNotExist(err))
+
+	pid, err = acquirePIDFile(path)
+	assert.NoError(t, err)
+	assert.NoError(t, pid.release())
+}
@@ -0,0 +1,13 @@
+//go:build unix
+
+package archiver
+
+import (
+	"os"
+	"syscall"
+)
+
+// lockFile acquires an exclusive, non-blocking lock on the provided file.
+func lockFile(file *os.File) error {
+	return syscall.Flock(int(file.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+}
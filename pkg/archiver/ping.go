@@ -0,0 +1,68 @@
+package archiver
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// pinger pings a dead man's switch URL when runs start, succeed and fail. The URL scheme is
+// compatible with healthchecks.io: <url>/start on start, <url> on success and <url>/fail on
+// failure. A monitor expecting regular pings alerts when backups silently stop happening.
+type pinger struct {
+	url    string
+	client *http.Client
+}
+
+// newPinger creates a reporter pinging the provided dead man's switch URL.
+func newPinger(url string) *pinger {
+	return &pinger{
+		url:    strings.TrimSuffix(url, "/"),
+		client: &http.Client{},
+	}
+}
+
+// name returns the name of the reporter.
+func (p *pinger) name() string {
+	return "ping"
+}
+
+// ping sends a ping to the provided URL with the provided body as diagnostics.
+func (p *pinger) ping(ctx context.Context, url string, body string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, strings.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("creating ping request: %w", err)
+	}
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("pinging %s: %w", url, err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("pinging %s: unexpected status %s", url, resp.Status)
+	}
+
+	return nil
+}
+
+// start pings the start URL of the switch.
+func (p *pinger) start(ctx context.Context, run *runResult) error {
+	return p.ping(ctx, p.url+"/start", fmt.Sprintf("job %s started", run.Job))
+}
+
+// report pings the success or failure URL of the switch.
+func (p *pinger) report(ctx context.Context, result *runResult) error {
+	if result.Err != nil {
+		return p.ping(ctx, p.url+"/fail", fmt.Sprintf("job %s failed after %s: %s", result.Job,
+			result.Duration, result.Err))
+	}
+
+	return p.ping(ctx, p.url, fmt.Sprintf("job %s archived %d files (%d bytes) in %s", result.Job,
+		result.Files, result.Size, result.Duration))
+}
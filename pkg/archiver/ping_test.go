@@ -0,0 +1,57 @@
+package archiver
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/peterldowns/testy/assert"
+	"github.com/rs/zerolog"
+)
+
+func TestPinger(t *testing.T) {
+	var paths []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+	}))
+	defer srv.Close()
+
+	p := newPinger(srv.URL + "/ping/abc/")
+	ctx := context.Background()
+
+	// Ensure starts, successes and failures ping their URLs.
+	assert.NoError(t, p.start(ctx, &runResult{Job: "db"}))
+	assert.NoError(t, p.report(ctx, &runResult{Job: "db"}))
+	assert.NoError(t, p.report(ctx, &runResult{Job: "db", Err: errors.New("upload failed")}))
+	assert.Equal(t, []string{"/ping/abc/start", "/ping/abc", "/ping/abc/fail"}, paths)
+}
+
+func TestArchivePings(t *testing.T) {
+	var paths []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+	}))
+	defer srv.Close()
+
+	dir := t.TempDir()
+	err := os.WriteFile(filepath.Join(dir, "test.txt"), []byte("Hello!"), 0o644)
+	assert.NoError(t, err)
+
+	logger := zerolog.Nop()
+	job := jobConfig{Name: "db", SourceDir: dir, Retention: "24h"}
+	reporters := []runReporter{newPinger(srv.URL + "/db")}
+
+	// Ensure a successful run pings the start and success URLs.
+	s3 := newFakeS3(t, "test-bucket")
+	archive(context.Background(), job, s3.s3Config("test-bucket"), reporters, &logger)
+	assert.Equal(t, []string{"/db/start", "/db"}, paths)
+
+	// Ensure a failed run pings the failure URL.
+	paths = nil
+	archive(context.Background(), job, s3.s3Config("missing-bucket"), reporters, &logger)
+	assert.Equal(t, []string{"/db/start", "/db/fail"}, paths)
+}
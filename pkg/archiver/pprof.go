@@ -0,0 +1,18 @@
+package archiver
+
+import (
+	"net/http"
+	"net/http/pprof"
+)
+
+// registerProfiling registers the net/http/pprof endpoints under /debug/pprof/ with the
+// provided mux, allowing CPU, heap and goroutine profiles of long or memory hungry runs to
+// be captured.
+func registerProfiling(mux *http.ServeMux) {
+	mux.HandleFunc("GET /debug/pprof/", pprof.Index)
+	mux.HandleFunc("GET /debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("GET /debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("GET /debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("POST /debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("GET /debug/pprof/trace", pprof.Trace)
+}
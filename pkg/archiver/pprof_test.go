@@ -0,0 +1,45 @@
+package archiver
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-co-op/gocron/v2"
+	"github.com/peterldowns/testy/assert"
+)
+
+func TestProfiling(t *testing.T) {
+	s, err := gocron.NewScheduler()
+	assert.NoError(t, err)
+	defer s.Shutdown()
+
+	get := func(url string) (int, string) {
+		resp, err := http.Get(url)
+		assert.NoError(t, err)
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		assert.NoError(t, err)
+		return resp.StatusCode, string(body)
+	}
+
+	// Ensure profiles are not exposed unless enabled.
+	srv := httptest.NewServer(newHealthHandler(s, newStatusTracker(), nil, nil, nil, nil, false))
+	status, _ := get(srv.URL + "/debug/pprof/heap")
+	srv.Close()
+	assert.Equal(t, http.StatusNotFound, status)
+
+	// Ensure profiles can be captured when enabled.
+	srv = httptest.NewServer(newHealthHandler(s, newStatusTracker(), nil, nil, nil, nil, true))
+	defer srv.Close()
+
+	status, body := get(srv.URL + "/debug/pprof/")
+	assert.Equal(t, http.StatusOK, status)
+	assert.True(t, strings.Contains(body, "goroutine"))
+
+	status, body = get(srv.URL + "/debug/pprof/heap?debug=1")
+	assert.Equal(t, http.StatusOK, status)
+	assert.True(t, strings.Contains(body, "heap profile"))
+}
@@ -0,0 +1,107 @@
+package archiver
+
+import (
+	"io/fs"
+	"os"
+)
+
+const (
+	// zipReaders is the number of files read concurrently ahead of being zipped, hiding the
+	// latency of network filesystems.
+	zipReaders = 16
+	// prefetchMaxSize is the size of the largest file read ahead into memory. Larger files
+	// are read while they are zipped.
+	prefetchMaxSize = 1 << 20
+)
+
+// prefetchedFile is a file whose metadata, and content if it is small, are read ahead of
+// being added to the zip.
+type prefetchedFile struct {
+	path string
+	name string
+	info os.FileInfo
+	data []byte
+	err  error
+	done chan struct{}
+}
+
+// fetch reads the metadata of the file of the provided directory entry and the content of
+// small files that will be zipped.
+func (z *dirZipper) fetch(f *prefetchedFile, d fs.DirEntry, content bool) {
+	defer close(f.done)
+
+	f.info, f.err = d.Info()
+	if f.err != nil || !content {
+		return
+	}
+
+	if !f.info.Mode().IsRegular() || f.info.Size() > prefetchMaxSize ||
+		f.info.ModTime().Before(z.opts.Since) || os.SameFile(f.info, z.zipInfo) {
+		return
+	}
+
+	// Files failing to be read are opened again when zipped, reporting the error there.
+	data, err := os.ReadFile(f.path)
+	if err == nil {
+		f.data = data
+	}
+}
+
+// queueFile queues the file of the provided directory entry to be added to the zip in order,
+// reading it ahead on the zipper's readers.
+func (z *dirZipper) queueFile(path string, name string, d fs.DirEntry) error {
+	f := &prefetchedFile{path: path, name: name, done: make(chan struct{})}
+	z.pending = append(z.pending, f)
+
+	if z.opts.Readers <= 1 {
+		z.fetch(f, d, false)
+	} else {
+		z.readers <- struct{}{}
+		go func() {
+			defer func() { <-z.readers }()
+			z.fetch(f, d, true)
+		}()
+	}
+
+	// Keep a bounded window of files read ahead.
+	for len(z.pending) > 4*z.opts.Readers {
+		err := z.addNext()
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// addNext adds the oldest queued file to the zip once it is read.
+func (z *dirZipper) addNext() error {
+	f := z.pending[0]
+	z.pending = z.pending[1:]
+	<-f.done
+	if f.err != nil {
+		return f.err
+	}
+
+	return z.addFile(f.path, f.name, f.info, f.data)
+}
+
+// flush adds the queued files to the zip, so entries added directly follow them.
+func (z *dirZipper) flush() error {
+	for len(z.pending) > 0 {
+		err := z.addNext()
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// discard waits for the queued files to be read without adding them to the zip.
+func (z *dirZipper) discard() {
+	for _, f := range z.pending {
+		<-f.done
+	}
+	z.pending = nil
+}
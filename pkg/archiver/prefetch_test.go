@@ -0,0 +1,54 @@
+package archiver
+
+import (
+	"archive/zip"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/peterldowns/testy/assert"
+	"github.com/rs/zerolog"
+)
+
+func TestZipDirReaders(t *testing.T) {
+	dir := t.TempDir()
+	logger := zerolog.Nop()
+	for i := range 300 {
+		sub := filepath.Join(dir, fmt.Sprintf("customer-%d", i%7))
+		assert.NoError(t, os.MkdirAll(sub, 0755))
+		assert.NoError(t, os.WriteFile(filepath.Join(sub, fmt.Sprintf("%d.sql", i)), []byte(fmt.Sprint(i)), 0644))
+	}
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "large.sql"), testDump(prefetchMaxSize+1), 0644))
+	assert.NoError(t, os.Mkdir(filepath.Join(dir, "empty"), 0755))
+	if runtime.GOOS != "windows" {
+		assert.NoError(t, os.Symlink("large.sql", filepath.Join(dir, "latest.sql")))
+	}
+
+	entries := func(readers int) ([]archivedFile, []string) {
+		zipPath := filepath.Join(t.TempDir(), "test.zip")
+		files, err := zipDir(context.Background(), dir, zipPath, zipOptions{Method: zip.Deflate, Dirs: true, Readers: readers}, &logger)
+		assert.NoError(t, err)
+
+		r, err := zip.OpenReader(zipPath)
+		assert.NoError(t, err)
+		defer r.Close()
+		var names []string
+		for _, entry := range r.File {
+			names = append(names, entry.Name)
+		}
+		return files, names
+	}
+
+	// Ensure reading ahead archives the same files in the same order.
+	files, names := entries(0)
+	prefetched, prefetchedNames := entries(8)
+	assert.Equal(t, len(files), len(prefetched))
+	for i := range files {
+		assert.Equal(t, files[i].Path, prefetched[i].Path)
+		assert.Equal(t, files[i].SHA256, prefetched[i].SHA256)
+	}
+	assert.Equal(t, names, prefetchedNames)
+}
@@ -0,0 +1,133 @@
+package archiver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/rs/zerolog"
+)
+
+// preflightTimeout bounds the time spent checking bucket access on startup.
+const preflightTimeout = 30 * time.Second
+
+// checkSourceDir ensures the provided source directory exists and is readable.
+func checkSourceDir(dir string) error {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return fmt.Errorf("source directory %s: %w", dir, err)
+	}
+
+	if !info.IsDir() {
+		return fmt.Errorf("source directory %s is not a directory", dir)
+	}
+
+	_, err = os.ReadDir(dir)
+	if err != nil {
+		return fmt.Errorf("source directory %s is not readable: %w", dir, err)
+	}
+
+	return nil
+}
+
+// checkBucket ensures the configured storage exists and is accessible with the configured
+// credentials.
+func checkBucket(ctx context.Context, cfg *s3Config) error {
+	store, err := cfg.openStorage(ctx)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	return store.Check(ctx)
+}
+
+// createBucket creates the bucket of the provided access configuration with its creation
+// options when it does not exist, and returns whether it was created.
+func createBucket(ctx context.Context, cfg *s3Config) (bool, error) {
+	mnc, err := minio.New(cfg.Endpoint, cfg.Options)
+	if err != nil {
+		return false, fmt.Errorf("creating minio client: %w", err)
+	}
+
+	exists, err := mnc.BucketExists(ctx, cfg.Bucket)
+	if err != nil {
+		return false, fmt.Errorf("checking bucket %s: %w", cfg.Bucket, err)
+	}
+	if exists {
+		return false, nil
+	}
+
+	err = mnc.MakeBucket(ctx, cfg.Bucket, *cfg.Create)
+	if err != nil {
+		// Another instance may have created the bucket in the meantime.
+		if minio.ToErrorResponse(err).Code == "BucketAlreadyOwnedByYou" {
+			return false, nil
+		}
+		return false, fmt.Errorf("creating bucket %s: %w", cfg.Bucket, err)
+	}
+
+	return true, nil
+}
+
+// preflight checks that every configured job can run, so problems are reported on startup
+// instead of at the first scheduled run.
+func preflight(ctx context.Context, cfg *Config, logger *zerolog.Logger) error {
+	ctx, cancel := context.WithTimeout(ctx, preflightTimeout)
+	defer cancel()
+
+	var errs error
+
+	creds := cfg.credentials(logger)
+	checked := make(map[string]bool)
+	for _, job := range cfg.jobs() {
+		err := checkSourceDir(job.SourceDir)
+		if err != nil {
+			errs = errors.Join(errs, fmt.Errorf("job %s: %w", job.Name, err))
+		}
+
+		if checked[job.Bucket] {
+			continue
+		}
+		checked[job.Bucket] = true
+
+		s3Cfg := cfg.s3Config(job, creds)
+		if s3Cfg.Create != nil {
+			created, err := createBucket(ctx, s3Cfg)
+			if err != nil {
+				errs = errors.Join(errs, fmt.Errorf("job %s: %w", job.Name, err))
+				continue
+			}
+			if created {
+				logger.Info().Str("bucket", job.Bucket).Bool("objectLock", s3Cfg.Create.ObjectLocking).Msg("Created bucket")
+			}
+		}
+
+		err = checkBucket(ctx, s3Cfg)
+		if err != nil {
+			errs = errors.Join(errs, fmt.Errorf("job %s: %w", job.Name, err))
+			continue
+		}
+
+		if len(cfg.Lifecycle) > 0 {
+			err = applyLifecycle(ctx, s3Cfg, cfg.Lifecycle)
+			if err != nil {
+				errs = errors.Join(errs, fmt.Errorf("job %s: %w", job.Name, err))
+				continue
+			}
+			logger.Info().Str("bucket", job.Bucket).Int("rules", len(cfg.Lifecycle)).Msg("Applied lifecycle rules")
+		}
+	}
+
+	for _, dest := range cfg.copyDestinations() {
+		err := checkBucket(ctx, dest.s3Config)
+		if err != nil {
+			errs = errors.Join(errs, fmt.Errorf("destination %s: %w", dest.Name, err))
+		}
+	}
+
+	return errs
+}
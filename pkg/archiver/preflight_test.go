@@ -0,0 +1,87 @@
+package archiver
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+	"github.com/peterldowns/testy/assert"
+)
+
+func TestCheckSourceDir(t *testing.T) {
+	dir := t.TempDir()
+	assert.NoError(t, checkSourceDir(dir))
+
+	// Ensure a missing directory is rejected.
+	assert.Error(t, checkSourceDir(filepath.Join(dir, "missing")))
+
+	// Ensure a file is rejected.
+	path := filepath.Join(dir, "test.txt")
+	err := os.WriteFile(path, []byte("Hello!"), 0600)
+	assert.NoError(t, err)
+	assert.Error(t, checkSourceDir(path))
+}
+
+func TestCheckBucket(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := r.URL.Query()["location"]; ok {
+			w.Write([]byte(`<LocationConstraint>us-east-1</LocationConstraint>`))
+			return
+		}
+
+		if r.URL.Path == "/test-bucket" || r.URL.Path == "/test-bucket/" {
+			return
+		}
+
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer srv.Close()
+
+	endpoint, err := url.Parse(srv.URL)
+	assert.NoError(t, err)
+
+	cfg := &s3Config{
+		Endpoint: endpoint.Host,
+		Bucket:   "test-bucket",
+		Options: &minio.Options{
+			Creds:     credentials.NewStaticV4("test-accesskeyid", "test-secretaccesskey", ""),
+			Secure:    true,
+			Transport: srv.Client().Transport,
+		},
+	}
+
+	// Ensure an existing bucket passes.
+	ctx := context.Background()
+	assert.NoError(t, checkBucket(ctx, cfg))
+
+	// Ensure a missing bucket is reported.
+	cfg.Bucket = "missing-bucket"
+	assert.Error(t, checkBucket(ctx, cfg))
+}
+
+func TestCreateBucket(t *testing.T) {
+	fake := newFakeS3(t, "test-bucket")
+	ctx := context.Background()
+
+	// Ensure existing buckets are left alone.
+	cfg := fake.s3Config("test-bucket")
+	cfg.Create = &minio.MakeBucketOptions{}
+	created, err := createBucket(ctx, cfg)
+	assert.NoError(t, err)
+	assert.False(t, created)
+
+	// Ensure missing buckets are created with their options.
+	cfg = fake.s3Config("new-bucket")
+	cfg.Create = &minio.MakeBucketOptions{Region: "us-east-1", ObjectLocking: true}
+	created, err = createBucket(ctx, cfg)
+	assert.NoError(t, err)
+	assert.True(t, created)
+	assert.Equal(t, "true", fake.created["new-bucket"].Get("X-Amz-Bucket-Object-Lock-Enabled"))
+	assert.NoError(t, checkBucket(ctx, cfg))
+}
@@ -0,0 +1,219 @@
+package archiver
+
+import (
+	"context"
+	"io"
+	"io/fs"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+const (
+	// progressLogInterval is the interval of logging the progress of running archive runs.
+	progressLogInterval = time.Minute
+	// Progress phases of archive runs.
+	phaseZip    = "zip"
+	phaseUpload = "upload"
+)
+
+// runProgress tracks the progress of the current phase of an archive run. A nil progress
+// tracks nothing.
+type runProgress struct {
+	mtx        sync.Mutex
+	phase      string
+	start      time.Time
+	files      int
+	totalFiles int
+	bytes      int64
+	totalBytes int64
+}
+
+// progressStatus is a snapshot of the progress of an archive run.
+type progressStatus struct {
+	Phase      string  `json:"phase"`
+	Files      int     `json:"files"`
+	TotalFiles int     `json:"totalFiles,omitempty"`
+	Bytes      int64   `json:"bytes"`
+	TotalBytes int64   `json:"totalBytes,omitempty"`
+	Percent    float64 `json:"percent"`
+	ETA        string  `json:"eta,omitempty"`
+}
+
+// setPhase starts the provided phase of the run with the provided totals, zero if unknown.
+func (p *runProgress) setPhase(phase string, totalFiles int, totalBytes int64) {
+	if p == nil {
+		return
+	}
+
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	p.phase, p.start = phase, time.Now()
+	p.files, p.totalFiles = 0, totalFiles
+	p.bytes, p.totalBytes = 0, totalBytes
+}
+
+// addFile records a processed file.
+func (p *runProgress) addFile() {
+	if p == nil {
+		return
+	}
+
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	p.files++
+}
+
+// addBytes records processed bytes.
+func (p *runProgress) addBytes(n int64) {
+	if p == nil {
+		return
+	}
+
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	p.bytes += n
+}
+
+// status returns a snapshot of the progress. The completed share of the phase is derived
+// from bytes when their total is known and from files otherwise, the remaining time from
+// the rate so far.
+func (p *runProgress) status(now time.Time) progressStatus {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	status := progressStatus{
+		Phase:      p.phase,
+		Files:      p.files,
+		TotalFiles: p.totalFiles,
+		Bytes:      p.bytes,
+		TotalBytes: p.totalBytes,
+	}
+
+	var done float64
+	switch {
+	case p.totalBytes > 0:
+		done = float64(p.bytes) / float64(p.totalBytes)
+	case p.totalFiles > 0:
+		done = float64(p.files) / float64(p.totalFiles)
+	}
+	done = min(done, 1)
+	status.Percent = float64(int(done*1000)) / 10
+
+	if done > 0 {
+		elapsed := now.Sub(p.start)
+		remaining := time.Duration(float64(elapsed) * (1 - done) / done)
+		status.ETA = remaining.Round(time.Second).String()
+	}
+
+	return status
+}
+
+// reader returns a reader of the provided reader recording the bytes read. The reader is
+// returned as is when there is no progress to track.
+func (p *runProgress) reader(r io.Reader) io.Reader {
+	if p == nil {
+		return r
+	}
+
+	return &progressReader{r: r, p: p}
+}
+
+// uploadProgress returns the progress reader of uploads, which minio reads as many bytes
+// from as it uploaded. It is nil when there is no progress to track.
+func (p *runProgress) uploadProgress() io.Reader {
+	if p == nil {
+		return nil
+	}
+
+	return &progressReader{p: p}
+}
+
+// progressReader records the bytes read from the wrapped reader, or the size of the reads
+// without a reader.
+type progressReader struct {
+	r io.Reader
+	p *runProgress
+}
+
+// Read reads from the wrapped reader.
+func (r *progressReader) Read(b []byte) (int, error) {
+	if r.r == nil {
+		r.p.addBytes(int64(len(b)))
+		return len(b), nil
+	}
+
+	n, err := r.r.Read(b)
+	r.p.addBytes(int64(n))
+	return n, err
+}
+
+// progressKey is the context key of the progress of a run.
+type progressKey struct{}
+
+// withProgress returns a context carrying the provided run progress.
+func withProgress(ctx context.Context, p *runProgress) context.Context {
+	return context.WithValue(ctx, progressKey{}, p)
+}
+
+// progressFrom returns the run progress of the provided context, nil if there is none.
+func progressFrom(ctx context.Context) *runProgress {
+	p, _ := ctx.Value(progressKey{}).(*runProgress)
+	return p
+}
+
+// scanDir returns the number of files in the provided directory and the total size of the
+// files modified since the provided time, the totals of the zip phase. Unreadable files and
+// directories are skipped, they fail the zip phase instead, as are staged archives.
+func scanDir(dir string, since time.Time) (int, int64) {
+	var count int
+	var size int64
+	filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return nil
+		}
+		if relPath, err := filepath.Rel(dir, path); err == nil && isStagedArchive(filepath.ToSlash(relPath)) {
+			return nil
+		}
+
+		count++
+		info, err := d.Info()
+		if err == nil && !info.ModTime().Before(since) {
+			size += info.Size()
+		}
+		return nil
+	})
+
+	return count, size
+}
+
+// logProgress logs the progress of the run every provided interval until the returned
+// function is called.
+func logProgress(p *runProgress, interval time.Duration, logger *zerolog.Logger) func() {
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-done:
+				return
+
+			case now := <-ticker.C:
+				status := p.status(now)
+				logger.Info().Str("phase", status.Phase).Int("files", status.Files).
+					Int("totalFiles", status.TotalFiles).Int64("bytes", status.Bytes).
+					Int64("totalBytes", status.TotalBytes).Float64("percent", status.Percent).
+					Str("eta", status.ETA).Msg("Progress")
+			}
+		}
+	}()
+
+	return func() { close(done) }
+}
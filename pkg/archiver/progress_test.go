@@ -0,0 +1,69 @@
+package archiver
+
+import (
+	"archive/zip"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/peterldowns/testy/assert"
+	"github.com/rs/zerolog"
+)
+
+func TestRunProgress(t *testing.T) {
+	p := &runProgress{}
+	p.setPhase(phaseZip, 4, 0)
+	p.addFile()
+	p.addBytes(100)
+
+	// Ensure the completed share is derived from files without a total size.
+	status := p.status(p.start.Add(10 * time.Second))
+	assert.Equal(t, progressStatus{Phase: phaseZip, Files: 1, TotalFiles: 4, Bytes: 100, Percent: 25, ETA: "30s"}, status)
+
+	// Ensure the completed share is derived from bytes with a total size.
+	p.setPhase(phaseUpload, 0, 1000)
+	_, err := io.Copy(io.Discard, p.reader(strings.NewReader(strings.Repeat("x", 750))))
+	assert.NoError(t, err)
+	status = p.status(p.start.Add(30 * time.Second))
+	assert.Equal(t, 75.0, status.Percent)
+	assert.Equal(t, "10s", status.ETA)
+
+	// Ensure minio's upload progress reads are recorded.
+	n, err := p.uploadProgress().Read(make([]byte, 250))
+	assert.NoError(t, err)
+	assert.Equal(t, 250, n)
+	assert.Equal(t, 100.0, p.status(time.Now()).Percent)
+
+	// Ensure runs without progress track nothing.
+	var untracked *runProgress
+	untracked.setPhase(phaseZip, 1, 0)
+	untracked.addFile()
+	assert.True(t, untracked.uploadProgress() == nil)
+	assert.True(t, progressFrom(context.Background()) == nil)
+	assert.True(t, progressFrom(withProgress(context.Background(), p)) == p)
+}
+
+func TestZipDirProgress(t *testing.T) {
+	dir := t.TempDir()
+	logger := zerolog.Nop()
+	assert.NoError(t, os.MkdirAll(filepath.Join(dir, "sub"), 0755))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "a.sql"), []byte("dump"), 0644))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "sub", "b.sql"), []byte("more dump"), 0644))
+	files, size := scanDir(dir, time.Time{})
+	assert.Equal(t, 2, files)
+	assert.Equal(t, int64(13), size)
+
+	p := &runProgress{}
+	p.setPhase(phaseZip, files, size)
+	_, err := zipDir(context.Background(), dir, filepath.Join(t.TempDir(), "test.zip"), zipOptions{Method: zip.Deflate, Progress: p}, &logger)
+	assert.NoError(t, err)
+
+	status := p.status(time.Now())
+	assert.Equal(t, 2, status.Files)
+	assert.Equal(t, int64(13), status.Bytes)
+	assert.Equal(t, 100.0, status.Percent)
+}
@@ -0,0 +1,190 @@
+package archiver
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// pushgatewayJob is the job grouping label of metrics pushed to the Pushgateway.
+const pushgatewayJob = "zdts3"
+
+// pushgateway pushes run metrics to a Prometheus Pushgateway.
+type pushgateway struct {
+	url      string
+	instance string
+	client   *http.Client
+}
+
+// newPushgateway creates a reporter pushing run metrics to the Pushgateway at the provided URL.
+func newPushgateway(address string) *pushgateway {
+	return &pushgateway{
+		url:      strings.TrimSuffix(address, "/"),
+		instance: instanceName(),
+		client:   &http.Client{},
+	}
+}
+
+// name returns the name of the reporter.
+func (p *pushgateway) name() string {
+	return "pushgateway"
+}
+
+// groupLabel returns the URL path segments of the provided grouping label. The Pushgateway
+// routes on the decoded path, so values with slashes, such as the names of subdirectory
+// runs, are base64 encoded.
+func groupLabel(name string, value string) string {
+	if strings.Contains(value, "/") {
+		return name + "@base64/" + base64.RawURLEncoding.EncodeToString([]byte(value))
+	}
+
+	return name + "/" + url.PathEscape(value)
+}
+
+// groupURL returns the URL of the metrics group of the provided archive job. Every archive
+// job has its own group so runs of different jobs don't replace each other's metrics.
+func (p *pushgateway) groupURL(job string) string {
+	return fmt.Sprintf("%s/metrics/job/%s/%s/%s", p.url, pushgatewayJob, groupLabel("instance", p.instance),
+		groupLabel("archive", job))
+}
+
+// writeMetric writes a gauge in the Prometheus text exposition format.
+func writeMetric(w io.Writer, name string, help string, value float64) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s gauge\n%s %s\n", name, help, name, name,
+		strconv.FormatFloat(value, 'f', -1, 64))
+}
+
+// metrics returns the metrics of the provided run in the Prometheus text exposition format.
+func (p *pushgateway) metrics(result *runResult) []byte {
+	var buf bytes.Buffer
+
+	success := 0.0
+	if result.Err == nil {
+		success = 1
+	}
+
+	end := result.Start.Add(result.Duration)
+	writeMetric(&buf, "zdts3_last_run_timestamp_seconds", "Time the last archive run finished.", float64(end.Unix()))
+	writeMetric(&buf, "zdts3_last_run_duration_seconds", "Duration of the last archive run.", result.Duration.Seconds())
+	writeMetric(&buf, "zdts3_last_run_success", "Whether the last archive run succeeded.", success)
+	writeMetric(&buf, "zdts3_last_run_files", "Number of files archived by the last archive run.", float64(result.Files))
+	writeMetric(&buf, "zdts3_last_run_archive_size_bytes", "Size of the archive uploaded by the last archive run.", float64(result.Size))
+	skipped := 0.0
+	if result.Skipped {
+		skipped = 1
+	}
+	writeMetric(&buf, "zdts3_last_run_skipped", "Whether the last archive run found no files to archive and uploaded nothing.", skipped)
+
+	// Failed runs leave the last success time of the group untouched.
+	if result.Err == nil {
+		writeMetric(&buf, "zdts3_last_success_timestamp_seconds", "Time the last successful archive run finished.", float64(end.Unix()))
+	}
+
+	return buf.Bytes()
+}
+
+// usageURL returns the URL of the metrics group of storage usage.
+func (p *pushgateway) usageURL() string {
+	return fmt.Sprintf("%s/metrics/job/%s/%s/report/usage", p.url, pushgatewayJob, groupLabel("instance", p.instance))
+}
+
+// usageMetrics returns the metrics of the provided storage usage in the Prometheus text
+// exposition format, labelled with the bucket and prefix.
+func (p *pushgateway) usageMetrics(usage *storageUsage) []byte {
+	var buf bytes.Buffer
+
+	gauges := []struct {
+		name  string
+		help  string
+		value func(entry prefixUsage) float64
+	}{
+		{"zdts3_storage_archives", "Number of stored archives.", func(entry prefixUsage) float64 { return float64(entry.Archives) }},
+		{"zdts3_storage_bytes", "Total size of the stored archives.", func(entry prefixUsage) float64 { return float64(entry.Bytes) }},
+		{"zdts3_storage_monthly_cost", "Estimated monthly cost of storing the archives.", func(entry prefixUsage) float64 { return entry.MonthlyCost }},
+	}
+	for _, gauge := range gauges {
+		fmt.Fprintf(&buf, "# HELP %s %s\n# TYPE %s gauge\n", gauge.name, gauge.help, gauge.name)
+		for _, entry := range usage.Prefixes {
+			fmt.Fprintf(&buf, "%s{bucket=%q,prefix=%q} %s\n", gauge.name, entry.Bucket, entry.Prefix,
+				strconv.FormatFloat(gauge.value(entry), 'f', -1, 64))
+		}
+	}
+
+	return buf.Bytes()
+}
+
+// drillURL returns the URL of the metrics group of restore drills of the provided archive
+// job.
+func (p *pushgateway) drillURL(job string) string {
+	return fmt.Sprintf("%s/metrics/job/%s/%s/%s/report/drill", p.url, pushgatewayJob,
+		groupLabel("instance", p.instance), groupLabel("archive", job))
+}
+
+// drillMetrics returns the metrics of the provided restore drill in the Prometheus text
+// exposition format.
+func (p *pushgateway) drillMetrics(result *drillResult) []byte {
+	var buf bytes.Buffer
+
+	success := 0.0
+	if result.Err == nil {
+		success = 1
+	}
+
+	end := result.Start.Add(result.Duration)
+	writeMetric(&buf, "zdts3_last_drill_timestamp_seconds", "Time the last restore drill finished.", float64(end.Unix()))
+	writeMetric(&buf, "zdts3_last_drill_duration_seconds", "Duration of the last restore drill.", result.Duration.Seconds())
+	writeMetric(&buf, "zdts3_last_drill_success", "Whether the last restore drill succeeded.", success)
+	writeMetric(&buf, "zdts3_last_drill_files", "Number of files restored by the last restore drill.", float64(result.Files))
+
+	// Failed drills leave the last success time of the group untouched.
+	if result.Err == nil {
+		writeMetric(&buf, "zdts3_last_drill_success_timestamp_seconds", "Time the last successful restore drill finished.", float64(end.Unix()))
+	}
+
+	return buf.Bytes()
+}
+
+// push pushes the provided metrics to the provided group URL with the provided method.
+func (p *pushgateway) push(ctx context.Context, method string, groupURL string, metrics []byte) error {
+	req, err := http.NewRequestWithContext(ctx, method, groupURL, bytes.NewReader(metrics))
+	if err != nil {
+		return fmt.Errorf("creating pushgateway request: %w", err)
+	}
+	req.Header.Set("Content-Type", "text/plain; version=0.0.4")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("pushing metrics: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("pushing metrics: unexpected status %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+
+	return nil
+}
+
+// report pushes the metrics of the provided run to the Pushgateway. Metrics are pushed with
+// POST so only the pushed metrics of the group are replaced.
+func (p *pushgateway) report(ctx context.Context, result *runResult) error {
+	return p.push(ctx, http.MethodPost, p.groupURL(result.Job), p.metrics(result))
+}
+
+// reportUsage pushes the metrics of the provided storage usage to the Pushgateway. Metrics
+// are pushed with PUT so prefixes no longer measured are dropped.
+func (p *pushgateway) reportUsage(ctx context.Context, usage *storageUsage) error {
+	return p.push(ctx, http.MethodPut, p.usageURL(), p.usageMetrics(usage))
+}
+
+// reportDrill pushes the metrics of the provided restore drill to the Pushgateway.
+func (p *pushgateway) reportDrill(ctx context.Context, result *drillResult) error {
+	return p.push(ctx, http.MethodPost, p.drillURL(result.Job), p.drillMetrics(result))
+}
@@ -0,0 +1,68 @@
+package archiver
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/peterldowns/testy/assert"
+)
+
+func TestPushgateway(t *testing.T) {
+	var method, path, body string
+	status := http.StatusOK
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		method, path, body = r.Method, r.URL.Path, string(data)
+		w.WriteHeader(status)
+	}))
+	defer srv.Close()
+
+	p := newPushgateway(srv.URL + "/")
+	p.instance = "test-host"
+	ctx := context.Background()
+
+	// Ensure the metrics of a successful run are pushed to the job's group.
+	result := &runResult{
+		Job:      "db",
+		Start:    time.Unix(1700000000, 0),
+		Duration: 90 * time.Second,
+		Files:    3,
+		Size:     2048,
+	}
+	err := p.report(ctx, result)
+	assert.NoError(t, err)
+	assert.Equal(t, http.MethodPost, method)
+	assert.Equal(t, "/metrics/job/zdts3/instance/test-host/archive/db", path)
+	assert.True(t, strings.Contains(body, "zdts3_last_run_success 1\n"))
+	assert.True(t, strings.Contains(body, "zdts3_last_run_duration_seconds 90\n"))
+	assert.True(t, strings.Contains(body, "zdts3_last_run_files 3\n"))
+	assert.True(t, strings.Contains(body, "zdts3_last_run_archive_size_bytes 2048\n"))
+	assert.True(t, strings.Contains(body, "zdts3_last_success_timestamp_seconds 1700000090\n"))
+
+	// Ensure failed runs don't update the last success time.
+	result.Err = errors.New("upload failed")
+	err = p.report(ctx, result)
+	assert.NoError(t, err)
+	assert.True(t, strings.Contains(body, "zdts3_last_run_success 0\n"))
+	assert.False(t, strings.Contains(body, "zdts3_last_success_timestamp_seconds"))
+
+	// Ensure the names of subdirectory runs are base64 encoded, the Pushgateway rejects
+	// slashes in label values.
+	result.Job = "db/customers"
+	err = p.report(ctx, result)
+	assert.NoError(t, err)
+	assert.Equal(t, "/metrics/job/zdts3/instance/test-host/archive@base64/ZGIvY3VzdG9tZXJz", path)
+	assert.Equal(t, "/metrics/job/zdts3/instance/test-host/archive@base64/ZGIvY3VzdG9tZXJz/report/drill",
+		strings.TrimPrefix(p.drillURL(result.Job), srv.URL))
+
+	// Ensure rejected pushes are reported.
+	status = http.StatusBadRequest
+	err = p.report(ctx, result)
+	assert.Error(t, err)
+}
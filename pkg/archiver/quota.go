@@ -0,0 +1,137 @@
+package archiver
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/dustin/go-humanize"
+	"github.com/minio/minio-go/v7"
+	"github.com/rs/zerolog"
+)
+
+// Quota policies, applied to uploads which would take the archives under a job's prefix over
+// its maximum bucket usage.
+const (
+	// quotaFail fails the upload.
+	quotaFail = "fail"
+	// quotaPrune deletes the oldest backup chains until the upload fits.
+	quotaPrune = "prune"
+)
+
+// validateQuotaPolicy validates the provided quota policy.
+func validateQuotaPolicy(policy string) error {
+	switch policy {
+	case "", quotaFail, quotaPrune:
+		return nil
+
+	default:
+		return fmt.Errorf("invalid quota policy %q, expected %s or %s", policy, quotaFail, quotaPrune)
+	}
+}
+
+// maxBucketUsage returns the maximum total size of the archives under the job's prefix, zero
+// if it is not limited.
+func (j *jobConfig) maxBucketUsage() int64 {
+	size, err := parseSize(j.MaxBucketUsage)
+	if j.MaxBucketUsage == "" || err != nil {
+		return 0
+	}
+
+	return size
+}
+
+// enforceQuota ensures an archive of the provided size fits under the provided job's maximum
+// bucket usage before it is uploaded. When it does not, the job's quota policy either fails
+// the upload or deletes the oldest backup chains until it fits. Archives under object lock
+// retention or legal hold are never deleted.
+func enforceQuota(ctx context.Context, job jobConfig, cfg *s3Config, size int64, logger *zerolog.Logger) error {
+	maxUsage := job.maxBucketUsage()
+	if maxUsage == 0 {
+		return nil
+	}
+
+	if size > maxUsage {
+		return fmt.Errorf("archive of %s exceeds the maximum bucket usage of %s",
+			humanize.IBytes(uint64(size)), humanize.IBytes(uint64(maxUsage)))
+	}
+
+	archives, err := listArchives(ctx, cfg)
+	if err != nil {
+		return err
+	}
+
+	var usage int64
+	for _, archive := range archives {
+		usage += archive.Size
+	}
+	if usage+size <= maxUsage {
+		return nil
+	}
+
+	if job.QuotaPolicy != quotaPrune {
+		return fmt.Errorf("upload of %s would take the usage of %s/%s from %s to %s, over the maximum of %s",
+			humanize.IBytes(uint64(size)), cfg.Bucket, archivePrefix(cfg), humanize.IBytes(uint64(usage)),
+			humanize.IBytes(uint64(usage+size)), humanize.IBytes(uint64(maxUsage)))
+	}
+
+	store, err := cfg.openStorage(ctx)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	var mnc *minio.Client
+	if cfg.OpenStorage == nil {
+		mnc, err = minio.New(cfg.Endpoint, cfg.Options)
+		if err != nil {
+			return fmt.Errorf("creating minio client: %w", err)
+		}
+	}
+
+	bases, err := archiveBases(ctx, store, archives)
+	if err != nil {
+		return err
+	}
+
+	// Delete whole backup chains, oldest first, so no remaining archive loses the archive it
+	// builds on. The newest chain is kept, the upload may build on it. Protected archives
+	// keep the archives they build on.
+	chains := archiveChains(archives, bases)
+	now := time.Now()
+	for i := 0; i < len(chains)-1 && usage+size > maxUsage; i++ {
+		kept := make(map[string]bool)
+		for _, archive := range chains[i] {
+			if kept[archive.Key] {
+				continue
+			}
+
+			protected, err := protectedArchive(ctx, mnc, cfg, archive, now)
+			if err != nil {
+				return err
+			}
+			if protected {
+				kept[archive.Key] = true
+				keepBases(kept, bases)
+				continue
+			}
+
+			err = removeArchive(ctx, store, archive.Key)
+			if err != nil {
+				return err
+			}
+			usage -= archive.Size
+
+			logger.Warn().Str("bucket", cfg.Bucket).Str("object", archive.Key).Int64("size", archive.Size).
+				Int64("maxUsage", maxUsage).Msg("Bucket usage over its maximum, deleted an archive of the oldest backup chain")
+		}
+	}
+
+	if usage+size > maxUsage {
+		return fmt.Errorf("upload of %s would take the usage of %s/%s to %s, over the maximum of %s, and the remaining archives are protected",
+			humanize.IBytes(uint64(size)), cfg.Bucket, archivePrefix(cfg), humanize.IBytes(uint64(usage+size)),
+			humanize.IBytes(uint64(maxUsage)))
+	}
+
+	return nil
+}
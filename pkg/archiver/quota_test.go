@@ -0,0 +1,92 @@
+package archiver
+
+import (
+	"bytes"
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/peterldowns/testy/assert"
+	"github.com/rs/zerolog"
+)
+
+func TestEnforceQuota(t *testing.T) {
+	fake := newFakeS3(t, "test-bucket")
+	cfg := fake.s3Config("test-bucket")
+	cfg.Prefix = "backups"
+	data := bytes.Repeat([]byte("a"), 1000)
+	putArchives(t, cfg, map[string][]byte{
+		"backups/dump-20260101235000.zip":           data,
+		"backups/dump-20260101235000.manifest.json": []byte("{}"),
+		"backups/dump-20260102235000.zip":           data,
+		"backups/dump-20260103235000.zip":           data,
+	})
+	job := jobConfig{Name: "db", MaxBucketUsage: "3500"}
+	ctx := context.Background()
+	logger := zerolog.Nop()
+
+	// Ensure uploads within the maximum usage, or without one, are allowed.
+	assert.NoError(t, enforceQuota(ctx, job, cfg, 500, &logger))
+	assert.NoError(t, enforceQuota(ctx, jobConfig{Name: "db"}, cfg, 5000, &logger))
+
+	// Ensure uploads over the maximum usage fail by default, without deleting archives.
+	err := enforceQuota(ctx, job, cfg, 1000, &logger)
+	assert.Error(t, err)
+	archives, err := listArchives(ctx, cfg)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, len(archives))
+
+	// Ensure archives larger than the maximum usage are rejected whatever the policy.
+	job.QuotaPolicy = quotaPrune
+	assert.Error(t, enforceQuota(ctx, job, cfg, 4000, &logger))
+
+	// Ensure the oldest archives are deleted along with their manifests until the upload fits.
+	assert.NoError(t, enforceQuota(ctx, job, cfg, 2000, &logger))
+	archives, err = listArchives(ctx, cfg)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(archives))
+	assert.Equal(t, "backups/dump-20260103235000.zip", archives[0].Key)
+	assert.Equal(t, (*fakeObject)(nil), fake.object("test-bucket", "backups/dump-20260101235000.manifest.json"))
+
+	// Ensure archives under object lock retention are never deleted.
+	cfg.Retention = &objectRetention{Mode: minio.Governance, Period: time.Hour}
+	assert.Error(t, enforceQuota(ctx, job, cfg, 3000, &logger))
+	archives, err = listArchives(ctx, cfg)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(archives))
+}
+
+func TestEnforceQuotaChains(t *testing.T) {
+	fake := newFakeS3(t, "test-bucket")
+	cfg := fake.s3Config("test-bucket")
+	putArchives(t, cfg, chainArchives(t, map[string]string{
+		"dump-20260104235000.zip": "",
+		"dump-20260105235000.zip": "dump-20260104235000.zip",
+		"dump-20260106235000.zip": "dump-20260104235000.zip",
+		"dump-20260111235000.zip": "",
+		"dump-20260112235000.zip": "dump-20260111235000.zip",
+	}))
+	archives, err := listArchives(context.Background(), cfg)
+	assert.NoError(t, err)
+	size := archives[0].Size
+	job := jobConfig{Name: "db", MaxBucketUsage: strconv.FormatInt(4*size, 10), QuotaPolicy: quotaPrune}
+	ctx := context.Background()
+	logger := zerolog.Nop()
+
+	// Ensure the oldest chain is deleted as a whole, never leaving the differentials without
+	// their full archive.
+	assert.NoError(t, enforceQuota(ctx, job, cfg, 1, &logger))
+	archives, err = listArchives(ctx, cfg)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(archives))
+	assert.Equal(t, "dump-20260112235000.zip", archives[0].Key)
+	assert.Equal(t, "dump-20260111235000.zip", archives[1].Key)
+
+	// Ensure the newest chain, which the upload may build on, is kept.
+	assert.Error(t, enforceQuota(ctx, job, cfg, 3*size, &logger))
+	archives, err = listArchives(ctx, cfg)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(archives))
+}
@@ -0,0 +1,138 @@
+package archiver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/go-co-op/gocron/v2"
+	"github.com/rs/zerolog"
+)
+
+const (
+	// readinessInterval is the interval at which the storage of the active configuration is
+	// checked for readiness.
+	readinessInterval = time.Minute
+	// readinessTimeout bounds the time spent checking the storage for readiness.
+	readinessTimeout = 30 * time.Second
+	// livenessTimeout is the maximum time the scheduler may take to respond to a liveness
+	// check.
+	livenessTimeout = 5 * time.Second
+)
+
+// readiness tracks whether the instance is ready to archive: its configuration is valid and
+// its buckets are reachable with working credentials. The storage is checked periodically
+// rather than on every probe, so frequent probes neither hit the storage nor time out.
+type readiness struct {
+	mtx       sync.Mutex
+	configErr error
+	storeErr  error
+}
+
+// setConfigError records the error of the last configuration reload, nil once the
+// configuration is reloaded successfully.
+func (r *readiness) setConfigError(err error) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	r.configErr = err
+}
+
+// check returns why the instance is not ready, nil when it is. Instances are ready until
+// checked otherwise, the startup preflight checks passed.
+func (r *readiness) check() error {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	var err error
+	if r.configErr != nil {
+		err = fmt.Errorf("invalid configuration: %w", r.configErr)
+	}
+	if r.storeErr != nil {
+		err = errors.Join(err, r.storeErr)
+	}
+
+	return err
+}
+
+// checkStorage checks that the buckets of the provided configuration are reachable with its
+// credentials, and records the outcome.
+func (r *readiness) checkStorage(ctx context.Context, cfg *Config, logger *zerolog.Logger) error {
+	ctx, cancel := context.WithTimeout(ctx, readinessTimeout)
+	defer cancel()
+
+	var errs error
+	creds := cfg.credentials(logger)
+	checked := make(map[string]bool)
+	for _, job := range cfg.jobs() {
+		if checked[job.Bucket] {
+			continue
+		}
+		checked[job.Bucket] = true
+
+		err := checkBucket(ctx, cfg.s3Config(job, creds))
+		if err != nil {
+			errs = errors.Join(errs, fmt.Errorf("job %s: %w", job.Name, err))
+		}
+	}
+
+	for _, dest := range cfg.copyDestinations() {
+		err := checkBucket(ctx, dest.s3Config)
+		if err != nil {
+			errs = errors.Join(errs, fmt.Errorf("destination %s: %w", dest.Name, err))
+		}
+	}
+
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	r.storeErr = errs
+	return errs
+}
+
+// run checks the storage of the active configuration every readiness interval until the
+// context is cancelled.
+func (r *readiness) run(ctx context.Context, active func() *Config, logger *zerolog.Logger, wg *sync.WaitGroup) {
+	defer wg.Done()
+
+	ticker := time.NewTicker(readinessInterval)
+	defer ticker.Stop()
+
+	ready := true
+	for {
+		select {
+		case <-ctx.Done():
+			return
+
+		case <-ticker.C:
+			err := r.checkStorage(ctx, active(), logger)
+			switch {
+			case err != nil && ctx.Err() == nil:
+				logger.Warn().Err(err).Msg("Storage not ready")
+			case err == nil && !ready:
+				logger.Info().Msg("Storage ready")
+			}
+			ready = err == nil
+		}
+	}
+}
+
+// schedulerAlive reports whether the provided scheduler responds within the provided time,
+// a wedged scheduler doesn't.
+func schedulerAlive(s gocron.Scheduler, timeout time.Duration) bool {
+	done := make(chan struct{})
+	go func() {
+		// Listing the jobs round trips through the scheduler's run loop.
+		s.Jobs()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
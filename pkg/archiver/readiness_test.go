@@ -0,0 +1,92 @@
+package archiver
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-co-op/gocron/v2"
+	"github.com/peterldowns/testy/assert"
+	"github.com/rs/zerolog"
+)
+
+// wedgedScheduler is a scheduler whose run loop never responds.
+type wedgedScheduler struct {
+	gocron.Scheduler
+	release chan struct{}
+}
+
+// Jobs blocks until the scheduler is released.
+func (s *wedgedScheduler) Jobs() []gocron.Job {
+	<-s.release
+	return nil
+}
+
+func TestLivenessAndReadiness(t *testing.T) {
+	s, err := gocron.NewScheduler()
+	assert.NoError(t, err)
+	defer s.Shutdown()
+	s.Start()
+
+	ready := &readiness{}
+	srv := httptest.NewServer(newHealthHandler(s, newStatusTracker(), nil, ready, nil, nil, false))
+	defer srv.Close()
+
+	get := func(path string) int {
+		resp, err := http.Get(srv.URL + path)
+		assert.NoError(t, err)
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	// Ensure running instances are alive and ready.
+	assert.Equal(t, http.StatusOK, get("/livez"))
+	assert.Equal(t, http.StatusOK, get("/readyz"))
+
+	// Ensure invalid reloaded configurations make the instance unready, not dead.
+	ready.setConfigError(errors.New("invalid retention"))
+	assert.Equal(t, http.StatusOK, get("/livez"))
+	assert.Equal(t, http.StatusServiceUnavailable, get("/readyz"))
+	ready.setConfigError(nil)
+	assert.Equal(t, http.StatusOK, get("/readyz"))
+
+	// Ensure wedged schedulers are reported.
+	wedged := &wedgedScheduler{release: make(chan struct{})}
+	defer close(wedged.release)
+	assert.True(t, schedulerAlive(s, time.Second))
+	assert.False(t, schedulerAlive(wedged, 10*time.Millisecond))
+}
+
+func TestReadinessStorage(t *testing.T) {
+	fake := newFakeS3(t, "test-bucket")
+	s3Cfg := fake.s3Config("test-bucket")
+	cfg := &Config{
+		Endpoint:        s3Cfg.Endpoint,
+		AccessKeyID:     "test-accesskeyid",
+		SecretAccessKey: "test-secretaccesskey",
+		Jobs:            []jobConfig{{Name: "db", SourceDir: t.TempDir(), Bucket: "test-bucket"}},
+		staticCreds:     true,
+		transport:       s3Cfg.Options.Transport,
+	}
+	logger := zerolog.Nop()
+	ready := &readiness{}
+
+	// Ensure reachable buckets are ready.
+	assert.NoError(t, ready.checkStorage(context.Background(), cfg, &logger))
+	assert.NoError(t, ready.check())
+
+	// Ensure unreachable buckets are not, until they are reachable again.
+	cfg.Jobs[0].Bucket = "missing-bucket"
+	assert.Error(t, ready.checkStorage(context.Background(), cfg, &logger))
+	err := ready.check()
+	assert.Error(t, err)
+	assert.True(t, strings.Contains(err.Error(), "job db"))
+
+	cfg.Jobs[0].Bucket = "test-bucket"
+	assert.NoError(t, ready.checkStorage(context.Background(), cfg, &logger))
+	assert.NoError(t, ready.check())
+}
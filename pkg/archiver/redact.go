@@ -0,0 +1,132 @@
+package archiver
+
+import (
+	"encoding/json"
+	"errors"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/rs/zerolog"
+)
+
+const (
+	// redacted replaces secrets in log output and reported errors.
+	redacted = "REDACTED"
+	// minSecretLength is the minimum length of the secrets redacted, shorter values would
+	// mask unrelated text.
+	minSecretLength = 4
+)
+
+// signedParam matches the credentials and signatures of presigned URLs and authorization
+// headers, e.g. X-Amz-Signature=… or Credential=….
+var signedParam = regexp.MustCompile(`(?i)\b((?:X-Amz-)?(?:Signature|Credential|Security-Token)|AWSAccessKeyId)=[^&\s",]+`)
+
+// secrets are the known secret values, e.g. the S3 secret access key or session tokens,
+// which are masked in log output and reported errors.
+var secrets struct {
+	mtx      sync.RWMutex
+	values   []string
+	replacer *strings.Replacer
+}
+
+// addSecrets registers the provided secret values for redaction. Empty and very short values
+// are ignored.
+func addSecrets(values ...string) {
+	secrets.mtx.Lock()
+	defer secrets.mtx.Unlock()
+
+	changed := false
+	for _, value := range values {
+		if len(value) < minSecretLength {
+			continue
+		}
+
+		// Mask the secrets as escaped in JSON log entries as well.
+		quoted, _ := json.Marshal(value)
+		for _, v := range []string{value, string(quoted[1 : len(quoted)-1])} {
+			if !slices.Contains(secrets.values, v) {
+				secrets.values = append(secrets.values, v)
+				changed = true
+			}
+		}
+	}
+	if !changed {
+		return
+	}
+
+	// Replace longer secrets first, so a secret containing another is masked in full.
+	slices.SortFunc(secrets.values, func(a, b string) int { return len(b) - len(a) })
+	pairs := make([]string, 0, len(secrets.values)*2)
+	for _, v := range secrets.values {
+		pairs = append(pairs, v, redacted)
+	}
+	secrets.replacer = strings.NewReplacer(pairs...)
+}
+
+// redact masks the known secrets and the credentials of presigned URLs in the provided text.
+func redact(s string) string {
+	secrets.mtx.RLock()
+	replacer := secrets.replacer
+	secrets.mtx.RUnlock()
+
+	if replacer != nil {
+		s = replacer.Replace(s)
+	}
+
+	return signedParam.ReplaceAllString(s, "$1="+redacted)
+}
+
+// redactedError is an error whose message has its secrets masked. It unwraps to the
+// original error, so the error chain can still be inspected.
+type redactedError struct {
+	err error
+}
+
+// Error returns the redacted message of the error.
+func (e *redactedError) Error() string {
+	return redact(e.err.Error())
+}
+
+// Unwrap returns the original error.
+func (e *redactedError) Unwrap() error {
+	return e.err
+}
+
+// redactError wraps the provided error so its message has its secrets masked.
+func redactError(err error) error {
+	var re *redactedError
+	if err == nil || errors.As(err, &re) {
+		return err
+	}
+
+	return &redactedError{err: err}
+}
+
+// redactingWriter is a log writer masking secrets in log entries before writing them.
+type redactingWriter struct {
+	w zerolog.LevelWriter
+}
+
+// newRedactingWriter creates a log writer masking secrets before writing to the provided
+// writer.
+func newRedactingWriter(w zerolog.LevelWriter) *redactingWriter {
+	return &redactingWriter{w: w}
+}
+
+// Write writes the provided log entry with its secrets masked.
+func (r *redactingWriter) Write(p []byte) (int, error) {
+	return r.WriteLevel(zerolog.NoLevel, p)
+}
+
+// WriteLevel writes the provided log entry with its secrets masked.
+func (r *redactingWriter) WriteLevel(level zerolog.Level, p []byte) (int, error) {
+	_, err := r.w.WriteLevel(level, []byte(redact(string(p))))
+	if err != nil {
+		return 0, err
+	}
+
+	// Report the entry as written in full, redaction changes its length.
+	return len(p), nil
+}
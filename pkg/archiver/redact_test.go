@@ -0,0 +1,83 @@
+package archiver
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/peterldowns/testy/assert"
+	"github.com/rs/zerolog"
+)
+
+// recordingReporter is a run reporter recording the reported runs.
+type recordingReporter struct {
+	results []*runResult
+}
+
+func (r *recordingReporter) name() string {
+	return "recording"
+}
+
+func (r *recordingReporter) report(_ context.Context, result *runResult) error {
+	r.results = append(r.results, result)
+	return nil
+}
+
+func TestRedact(t *testing.T) {
+	addSecrets("redact-secret-key", `redact"quoted\key`, "abc", "")
+
+	// Ensure known secrets are masked, in full even when they contain another one.
+	assert.Equal(t, "key REDACTED used", redact("key redact-secret-key used"))
+	addSecrets("redact-secret-key-2")
+	assert.Equal(t, "key REDACTED used", redact("key redact-secret-key-2 used"))
+
+	// Ensure secrets are masked as escaped in JSON log entries.
+	assert.Equal(t, `{"error":"REDACTED"}`, redact(`{"error":"redact\"quoted\\key"}`))
+
+	// Ensure very short values are not treated as secrets.
+	assert.Equal(t, "abc", redact("abc"))
+
+	// Ensure the credentials of presigned URLs are masked.
+	url := "https://s3.example.com/bucket/a.zip?X-Amz-Algorithm=AWS4-HMAC-SHA256" +
+		"&X-Amz-Credential=AKIA%2F20261017%2Fus-east-1&X-Amz-Security-Token=session" +
+		"&X-Amz-Signature=0123abcd&X-Amz-Expires=900"
+	assert.Equal(t, "https://s3.example.com/bucket/a.zip?X-Amz-Algorithm=AWS4-HMAC-SHA256"+
+		"&X-Amz-Credential=REDACTED&X-Amz-Security-Token=REDACTED"+
+		"&X-Amz-Signature=REDACTED&X-Amz-Expires=900", redact(url))
+	assert.Equal(t, "Authorization: AWS4-HMAC-SHA256 Credential=REDACTED, SignedHeaders=host, Signature=REDACTED",
+		redact("Authorization: AWS4-HMAC-SHA256 Credential=AKIA/20261017/s3, SignedHeaders=host, Signature=ff00"))
+}
+
+func TestRedactError(t *testing.T) {
+	addSecrets("redact-error-token")
+
+	cause := errors.New("access denied")
+	err := redactError(fmt.Errorf("uploading with token redact-error-token: %w", cause))
+	assert.Equal(t, "uploading with token REDACTED: access denied", err.Error())
+
+	// Ensure the error chain is kept and errors are only wrapped once.
+	assert.True(t, errors.Is(err, cause))
+	assert.True(t, redactError(err) == err)
+	assert.NoError(t, redactError(nil))
+
+	// Ensure reported run errors are masked.
+	reporter := &recordingReporter{}
+	logger := zerolog.Nop()
+	result := &runResult{Job: "job", Err: errors.New("signing with redact-error-token")}
+	report(context.Background(), []runReporter{reporter}, result, &logger)
+	assert.Equal(t, "signing with REDACTED", reporter.results[0].Err.Error())
+}
+
+func TestRedactingWriter(t *testing.T) {
+	addSecrets("redact-writer-secret")
+
+	var buf bytes.Buffer
+	logger := zerolog.New(newRedactingWriter(zerolog.MultiLevelWriter(&buf)))
+	logger.Error().Err(errors.New("request with redact-writer-secret failed")).Msg("Uploading")
+
+	assert.False(t, strings.Contains(buf.String(), "redact-writer-secret"))
+	assert.True(t, strings.Contains(buf.String(), `"error":"request with REDACTED failed"`))
+}
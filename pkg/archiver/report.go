@@ -0,0 +1,278 @@
+package archiver
+
+import (
+	"context"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// reportTimeout is the maximum duration of sending a run report to a reporter.
+const reportTimeout = 30 * time.Second
+
+// runResult is the outcome of an archive run.
+type runResult struct {
+	// ID is the ID of the run, shared by the runs of a job's subdirectories.
+	ID       string
+	Job      string
+	Start    time.Time
+	Duration time.Duration
+	Files    int
+	Size     int64
+	Bucket   string
+	Key      string
+	// Checksum is the base64 encoded SHA-256 checksum of the uploaded archive verified by the
+	// storage, empty if it verified none.
+	Checksum string
+	// Fallback is the name of the fallback destination the archive was uploaded to after the
+	// upload to its bucket failed, if any.
+	Fallback string
+	Contents []archivedFile
+	// SkippedFiles are the files not archived for exceeding the job's maximum file size.
+	SkippedFiles []archivedFile
+	// Unchanged indicates the archive was identical to the previous one and not uploaded.
+	Unchanged bool
+	// Skipped indicates the run found no files to archive and uploaded nothing.
+	Skipped bool
+	// Progress is the progress of the run while it is running, if tracked.
+	Progress *runProgress
+	// Stages are the durations of the stages the run went through, in order.
+	Stages []runStage
+	// Errors are the errors of the stages of the run, in order, including those which did
+	// not fail the run, e.g. a manifest which could not be written.
+	Errors []stageError
+	Err    error
+}
+
+// runStage is the duration of a stage of an archive run, e.g. zipping.
+type runStage struct {
+	Name     string
+	Duration time.Duration
+}
+
+// endStage records the duration of the provided stage, which started at the provided time.
+func (r *runResult) endStage(name string, start time.Time) {
+	r.Stages = append(r.Stages, runStage{Name: name, Duration: time.Since(start)})
+}
+
+// stageError is an error of a stage of an archive run.
+type stageError struct {
+	Stage string
+	Err   error
+}
+
+// stageFailed records the error of the provided stage.
+func (r *runResult) stageFailed(stage string, err error) {
+	r.Errors = append(r.Errors, stageError{Stage: stage, Err: err})
+}
+
+// hasErrors returns whether the run failed or any of its stages had an error.
+func (r *runResult) hasErrors() bool {
+	return r.Err != nil || len(r.Errors) > 0
+}
+
+// errorSummary returns the errors of the stages of the run on one line, or the error of the
+// run if no stage error was recorded.
+func (r *runResult) errorSummary() string {
+	if len(r.Errors) == 0 {
+		if r.Err == nil {
+			return ""
+		}
+		return r.Err.Error()
+	}
+
+	summary := make([]string, 0, len(r.Errors))
+	for _, e := range r.Errors {
+		summary = append(summary, e.Stage+": "+e.Err.Error())
+	}
+
+	return strings.Join(summary, "; ")
+}
+
+// logErrors logs a single entry summarizing the errors of the run's stages, if any, so the
+// outcome of a run is found in one place.
+func (r *runResult) logErrors(logger *zerolog.Logger) {
+	if len(r.Errors) == 0 {
+		return
+	}
+
+	errs := zerolog.Arr()
+	for _, e := range r.Errors {
+		errs.Dict(zerolog.Dict().Str("stage", e.Stage).Str("error", e.Err.Error()))
+	}
+
+	event, msg := logger.Warn(), "Run completed with errors"
+	if r.Err != nil {
+		event, msg = logger.Error(), "Run failed"
+	}
+	event.Str("job", r.Job).Array("errors", errs).Msg(msg)
+}
+
+// stageErrorReport is an error of a run stage in machine readable run reports.
+type stageErrorReport struct {
+	Stage string `json:"stage"`
+	Error string `json:"error"`
+}
+
+// stageErrorReports returns the machine readable reports of the errors of the provided run's
+// stages.
+func stageErrorReports(result *runResult) []stageErrorReport {
+	var reports []stageErrorReport
+	for _, e := range result.Errors {
+		reports = append(reports, stageErrorReport{Stage: e.Stage, Error: e.Err.Error()})
+	}
+
+	return reports
+}
+
+// Run event types.
+const (
+	// eventStarted is the event of a run that started.
+	eventStarted = "archive.started"
+	// eventSucceeded is the event of a run that succeeded.
+	eventSucceeded = "archive.succeeded"
+	// eventFailed is the event of a run that failed.
+	eventFailed = "archive.failed"
+)
+
+// runEvent is the machine readable report of a run event sent to external systems.
+type runEvent struct {
+	Event     string             `json:"event"`
+	Job       string             `json:"job"`
+	Host      string             `json:"host"`
+	Instance  string             `json:"instance,omitempty"`
+	Start     time.Time          `json:"start"`
+	Duration  float64            `json:"durationSeconds,omitempty"`
+	Files     int                `json:"files,omitempty"`
+	Size      int64              `json:"archiveSize,omitempty"`
+	Unchanged bool               `json:"unchanged,omitempty"`
+	Skipped   bool               `json:"skipped,omitempty"`
+	Error     string             `json:"error,omitempty"`
+	Errors    []stageErrorReport `json:"errors,omitempty"`
+}
+
+// newRunEvent creates the provided event of the provided run. Started runs have no
+// outcome yet.
+func newRunEvent(event string, result *runResult) *runEvent {
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "unknown"
+	}
+
+	e := &runEvent{
+		Event:    event,
+		Job:      result.Job,
+		Host:     hostname,
+		Instance: instanceID(),
+		Start:    result.Start,
+	}
+
+	if event == eventStarted {
+		return e
+	}
+
+	e.Duration = result.Duration.Seconds()
+	e.Files = result.Files
+	e.Size = result.Size
+	e.Unchanged = result.Unchanged
+	e.Skipped = result.Skipped
+	if result.Err != nil {
+		e.Error = result.Err.Error()
+	}
+	e.Errors = stageErrorReports(result)
+
+	return e
+}
+
+// resultEvent returns the event type of the outcome of the provided run.
+func resultEvent(result *runResult) string {
+	if result.Err != nil {
+		return eventFailed
+	}
+
+	return eventSucceeded
+}
+
+// runReporter sends the outcome of archive runs to an external system.
+type runReporter interface {
+	// name returns the name of the reporter for log entries.
+	name() string
+	// report sends the provided run result.
+	report(ctx context.Context, result *runResult) error
+}
+
+// runStarter is a run reporter that is also notified when archive runs start.
+type runStarter interface {
+	runReporter
+	// start reports that the provided run started.
+	start(ctx context.Context, run *runResult) error
+}
+
+// subdirsReporter is a run reporter that is also notified when the runs of the
+// subdirectories of a job start and finish as a whole.
+type subdirsReporter interface {
+	runReporter
+	// startSubdirs reports that the subdirectory runs of the provided job are starting.
+	startSubdirs(job string, start time.Time)
+	// finishSubdirs reports that every subdirectory run of the provided job finished.
+	finishSubdirs(job string)
+}
+
+// reportSubdirs notifies the reporters that are interested in the subdirectory runs of the
+// provided job as a whole that they are starting, or that they finished.
+func reportSubdirs(reporters []runReporter, job string, finished bool) {
+	for _, reporter := range reporters {
+		subdirs, ok := reporter.(subdirsReporter)
+		if !ok {
+			continue
+		}
+
+		if finished {
+			subdirs.finishSubdirs(job)
+		} else {
+			subdirs.startSubdirs(job, time.Now())
+		}
+	}
+}
+
+// reportStart notifies the reporters that are interested in run starts that the provided run
+// started. Failures are logged and do not affect the run.
+func reportStart(ctx context.Context, reporters []runReporter, run *runResult, logger *zerolog.Logger) {
+	ctx, cancel := context.WithTimeout(ctx, reportTimeout)
+	defer cancel()
+
+	for _, reporter := range reporters {
+		starter, ok := reporter.(runStarter)
+		if !ok {
+			continue
+		}
+
+		err := starter.start(ctx, run)
+		if err != nil {
+			logger.Error().Err(err).Str("reporter", reporter.name()).Msg("Reporting run start")
+		}
+	}
+}
+
+// report sends the provided run result to every reporter, with the secrets of its error
+// masked. Reporting failures are logged and do not affect the run.
+func report(ctx context.Context, reporters []runReporter, result *runResult, logger *zerolog.Logger) {
+	// Report runs interrupted by a shutdown as well.
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), reportTimeout)
+	defer cancel()
+
+	// Never send secrets echoed by errors, e.g. presigned URLs, to external systems.
+	result.Err = redactError(result.Err)
+	for i := range result.Errors {
+		result.Errors[i].Err = redactError(result.Errors[i].Err)
+	}
+
+	for _, reporter := range reporters {
+		err := reporter.report(ctx, result)
+		if err != nil {
+			logger.Error().Err(err).Str("reporter", reporter.name()).Msg("Reporting run")
+		}
+	}
+}
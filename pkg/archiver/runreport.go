@@ -0,0 +1,129 @@
+package archiver
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+)
+
+// runReportPrefix is the object prefix of the run reports.
+const runReportPrefix = "runs"
+
+// runReportStage is the duration of a run stage in a run report.
+type runReportStage struct {
+	Name     string  `json:"name"`
+	Duration float64 `json:"durationSeconds"`
+}
+
+// runReport is the summary of a run uploaded to its bucket, so backup health can be audited
+// from the bucket alone.
+type runReport struct {
+	RunID        string             `json:"runId"`
+	Job          string             `json:"job"`
+	Host         string             `json:"host"`
+	Instance     string             `json:"instance,omitempty"`
+	Version      string             `json:"version"`
+	Result       string             `json:"result"`
+	Start        time.Time          `json:"start"`
+	End          time.Time          `json:"end"`
+	Duration     float64            `json:"durationSeconds"`
+	Stages       []runReportStage   `json:"stages,omitempty"`
+	Files        int                `json:"files"`
+	Size         int64              `json:"archiveSize"`
+	Bucket       string             `json:"bucket,omitempty"`
+	Key          string             `json:"key,omitempty"`
+	Checksum     string             `json:"checksumSha256,omitempty"`
+	Fallback     string             `json:"fallback,omitempty"`
+	Unchanged    bool               `json:"unchanged,omitempty"`
+	Skipped      bool               `json:"skipped,omitempty"`
+	SkippedFiles []archivedFile     `json:"skippedFiles,omitempty"`
+	Error        string             `json:"error,omitempty"`
+	Errors       []stageErrorReport `json:"errors,omitempty"`
+}
+
+// newRunReport creates the report of the provided run.
+func newRunReport(result *runResult) *runReport {
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "unknown"
+	}
+
+	report := &runReport{
+		RunID:        result.ID,
+		Job:          result.Job,
+		Host:         hostname,
+		Instance:     instanceID(),
+		Version:      getBuildInfo().Version,
+		Result:       "success",
+		Start:        result.Start,
+		End:          result.Start.Add(result.Duration),
+		Duration:     result.Duration.Seconds(),
+		Files:        result.Files,
+		Size:         result.Size,
+		Bucket:       result.Bucket,
+		Key:          result.Key,
+		Checksum:     result.Checksum,
+		Fallback:     result.Fallback,
+		Unchanged:    result.Unchanged,
+		Skipped:      result.Skipped,
+		SkippedFiles: result.SkippedFiles,
+	}
+	for _, stage := range result.Stages {
+		report.Stages = append(report.Stages, runReportStage{Name: stage.Name, Duration: stage.Duration.Seconds()})
+	}
+	if result.Err != nil {
+		report.Result = "failure"
+		report.Error = result.Err.Error()
+	}
+	report.Errors = stageErrorReports(result)
+
+	return report
+}
+
+// runReports is a run reporter uploading the report of every run of a job to its bucket.
+type runReports struct {
+	cfg *s3Config
+}
+
+// newRunReports creates a reporter uploading run reports to the provided bucket.
+func newRunReports(cfg *s3Config) *runReports {
+	return &runReports{cfg: cfg}
+}
+
+// runReportName returns the name of the report object of the provided run.
+func runReportName(cfg *s3Config, result *runResult) string {
+	return path.Join(cfg.Prefix, runReportPrefix, result.Job, result.Start.Format("20060102150405")+".json")
+}
+
+// name returns the name of the reporter.
+func (r *runReports) name() string {
+	return "runreport"
+}
+
+// report uploads the report of the provided run.
+func (r *runReports) report(ctx context.Context, result *runResult) error {
+	mnc, err := minio.New(r.cfg.Endpoint, r.cfg.Options)
+	if err != nil {
+		return fmt.Errorf("creating minio client: %w", err)
+	}
+
+	data, err := json.Marshal(newRunReport(result))
+	if err != nil {
+		return err
+	}
+
+	objectName := runReportName(r.cfg, result)
+	_, err = mnc.PutObject(ctx, r.cfg.Bucket, objectName, bytes.NewReader(data), int64(len(data)),
+		minio.PutObjectOptions{ContentType: "application/json"})
+	if err != nil {
+		return fmt.Errorf("writing run report %s: %w", objectName, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,58 @@
+package archiver
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/peterldowns/testy/assert"
+)
+
+func TestRunReports(t *testing.T) {
+	fake := newFakeS3(t, "test-bucket")
+	cfg := fake.s3Config("test-bucket")
+	cfg.Prefix = "backups"
+	reports := newRunReports(cfg)
+
+	ctx := context.Background()
+	start := time.Date(2026, 1, 1, 23, 50, 0, 0, time.UTC)
+	result := &runResult{
+		Job:      "db",
+		Start:    start,
+		Duration: time.Minute,
+		Files:    3,
+		Size:     1024,
+		Key:      "backups/dump-20260101235000.zip",
+		Checksum: "n4bQgYhMfWWaL+qgxVrQFaO/TxsrC4Is0V1sFbDwCgg=",
+		Stages: []runStage{
+			{Name: "purge", Duration: time.Second},
+			{Name: "zip", Duration: 30 * time.Second},
+			{Name: "upload", Duration: 29 * time.Second},
+		},
+	}
+	assert.NoError(t, reports.report(ctx, result))
+
+	failed := &runResult{Job: "db/orders", Start: start.Add(time.Hour), Duration: time.Second, Err: errors.New("zip failed")}
+	assert.NoError(t, reports.report(ctx, failed))
+
+	// Ensure the report of every run is uploaded under the job's prefix.
+	obj := fake.object("test-bucket", "backups/runs/db/20260101235000.json")
+	assert.True(t, obj != nil)
+	var report runReport
+	assert.NoError(t, json.Unmarshal(obj.data, &report))
+	assert.Equal(t, "success", report.Result)
+	assert.Equal(t, start.Add(time.Minute), report.End)
+	assert.Equal(t, 3, len(report.Stages))
+	assert.Equal(t, "zip", report.Stages[1].Name)
+	assert.Equal(t, 30.0, report.Stages[1].Duration)
+	assert.Equal(t, "backups/dump-20260101235000.zip", report.Key)
+	assert.Equal(t, result.Checksum, report.Checksum)
+
+	obj = fake.object("test-bucket", "backups/runs/db/orders/20260102005000.json")
+	assert.True(t, obj != nil)
+	assert.NoError(t, json.Unmarshal(obj.data, &report))
+	assert.Equal(t, "failure", report.Result)
+	assert.Equal(t, "zip failed", report.Error)
+}
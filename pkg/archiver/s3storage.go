@@ -0,0 +1,158 @@
+package archiver
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"strings"
+	"time"
+
+	"github.com/dnldd/zdts3/pkg/storage"
+	"github.com/minio/minio-go/v7"
+)
+
+// s3Storage is the storage in an S3 or S3-compatible bucket.
+type s3Storage struct {
+	mnc       *minio.Client
+	bucket    string
+	retention *objectRetention
+	checksum  uploadChecksum
+}
+
+// newS3Storage creates the storage of the bucket of the provided access configuration.
+func newS3Storage(cfg *s3Config) (storage.Storage, error) {
+	mnc, err := minio.New(cfg.Endpoint, cfg.Options)
+	if err != nil {
+		return nil, fmt.Errorf("creating minio client: %w", err)
+	}
+
+	return &s3Storage{mnc: mnc, bucket: cfg.Bucket, retention: cfg.Retention, checksum: cfg.Checksum}, nil
+}
+
+// s3Error maps missing objects to fs.ErrNotExist.
+func s3Error(err error) error {
+	if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+		return fmt.Errorf("%w: %w", fs.ErrNotExist, err)
+	}
+
+	return err
+}
+
+// PutFile uploads the file at the provided path as the provided object with the configured
+// retention, recording the progress of the upload.
+func (s *s3Storage) PutFile(ctx context.Context, key string, path string) (int64, error) {
+	size, _, err := s.PutFileChecksum(ctx, key, path)
+	return size, err
+}
+
+// PutFileChecksum uploads the file at the provided path like PutFile, returning the SHA-256
+// checksum the bucket verified when the upload carried one.
+func (s *s3Storage) PutFileChecksum(ctx context.Context, key string, path string) (int64, string, error) {
+	opts := minio.PutObjectOptions{
+		ContentType: "application/zip",
+		Progress:    progressFrom(ctx).uploadProgress(),
+	}
+	s.retention.setOptions(&opts, time.Now())
+	s.checksum.setOptions(&opts)
+	setInstanceMetadata(&opts)
+
+	info, err := s.mnc.FPutObject(ctx, s.bucket, key, path, opts)
+	if err != nil {
+		return 0, "", err
+	}
+
+	return info.Size, info.ChecksumSHA256, nil
+}
+
+// Put uploads the provided JSON data as the provided object.
+func (s *s3Storage) Put(ctx context.Context, key string, data []byte) error {
+	_, err := s.mnc.PutObject(ctx, s.bucket, key, bytes.NewReader(data), int64(len(data)),
+		minio.PutObjectOptions{ContentType: "application/json"})
+	return err
+}
+
+// Get opens the object with the provided key.
+func (s *s3Storage) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	obj, err := s.mnc.GetObject(ctx, s.bucket, key, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, s3Error(err)
+	}
+
+	// Objects are requested lazily, surface missing objects before the first read.
+	_, err = obj.Stat()
+	if err != nil {
+		obj.Close()
+		return nil, s3Error(err)
+	}
+
+	return obj, nil
+}
+
+// Stat returns the size of the object with the provided key.
+func (s *s3Storage) Stat(ctx context.Context, key string) (int64, error) {
+	info, err := s.mnc.StatObject(ctx, s.bucket, key, minio.StatObjectOptions{})
+	if err != nil {
+		return 0, s3Error(err)
+	}
+
+	return info.Size, nil
+}
+
+// List returns the objects stored directly under the provided prefix.
+func (s *s3Storage) List(ctx context.Context, prefix string) ([]storage.Object, error) {
+	var files []storage.Object
+	for obj := range s.mnc.ListObjects(ctx, s.bucket, minio.ListObjectsOptions{Prefix: prefix}) {
+		if obj.Err != nil {
+			return nil, obj.Err
+		}
+
+		// Common prefixes of nested objects are listed as well.
+		if strings.HasSuffix(obj.Key, "/") {
+			continue
+		}
+
+		files = append(files, storage.Object{
+			Key:      obj.Key,
+			Size:     obj.Size,
+			Modified: obj.LastModified,
+		})
+	}
+
+	return files, nil
+}
+
+// Remove removes the object with the provided key, if any.
+func (s *s3Storage) Remove(ctx context.Context, key string) error {
+	return s.mnc.RemoveObject(ctx, s.bucket, key, minio.RemoveObjectOptions{})
+}
+
+// Presign returns a presigned download link of the object with the provided key.
+func (s *s3Storage) Presign(ctx context.Context, key string, expiry time.Duration) (string, error) {
+	link, err := s.mnc.PresignedGetObject(ctx, s.bucket, key, expiry, nil)
+	if err != nil {
+		return "", err
+	}
+
+	return link.String(), nil
+}
+
+// Check ensures the bucket exists and is accessible with the configured credentials.
+func (s *s3Storage) Check(ctx context.Context) error {
+	exists, err := s.mnc.BucketExists(ctx, s.bucket)
+	if err != nil {
+		return fmt.Errorf("checking bucket %s: %w", s.bucket, err)
+	}
+
+	if !exists {
+		return fmt.Errorf("bucket %s does not exist", s.bucket)
+	}
+
+	return nil
+}
+
+// Close releases nothing, minio clients hold no connection of their own.
+func (s *s3Storage) Close() error {
+	return nil
+}
@@ -0,0 +1,256 @@
+package archiver
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	// Embed the timezone database, container images may not ship one.
+	_ "time/tzdata"
+
+	"github.com/go-co-op/gocron/v2"
+	"github.com/rs/zerolog"
+)
+
+// setLogLevel sets the global log level from the provided level name.
+func setLogLevel(level string) {
+	switch level {
+	case "debug":
+		zerolog.SetGlobalLevel(zerolog.DebugLevel)
+	case "error":
+		zerolog.SetGlobalLevel(zerolog.ErrorLevel)
+	case "fatal":
+		zerolog.SetGlobalLevel(zerolog.FatalLevel)
+	case "warn":
+		zerolog.SetGlobalLevel(zerolog.WarnLevel)
+	default:
+		zerolog.SetGlobalLevel(zerolog.InfoLevel)
+	}
+}
+
+// scheduleLocation is the timezone of schedules and purge windows.
+var scheduleLocation atomic.Pointer[time.Location]
+
+// setLocation sets the timezone of schedules and purge windows.
+func setLocation(loc *time.Location) {
+	scheduleLocation.Store(loc)
+}
+
+// scheduleNow returns the current time in the timezone of schedules and purge windows.
+func scheduleNow() time.Time {
+	loc := scheduleLocation.Load()
+	if loc == nil {
+		return time.Now()
+	}
+
+	return time.Now().In(loc)
+}
+
+// newScheduler creates the cron scheduler. When the distributed lock is enabled, job runs are
+// coordinated with other instances through lock objects so only one of them runs each job.
+// When an elector is provided, jobs only run while this instance is the elected leader.
+func newScheduler(cfg *Config, elector *s3Elector, logger *zerolog.Logger) (gocron.Scheduler, error) {
+	opts := []gocron.SchedulerOption{gocron.WithLocation(cfg.location())}
+
+	if elector != nil {
+		opts = append(opts, gocron.WithDistributedElector(elector))
+	}
+
+	if cfg.distributedLock() {
+		lockCfg := cfg.s3Config(jobConfig{Bucket: cfg.lockBucket()}, cfg.credentials(logger))
+		opts = append(opts, gocron.WithDistributedLocker(newS3Locker(lockCfg, cfg.lockTTL(), logger)))
+	}
+
+	return gocron.NewScheduler(opts...)
+}
+
+// findJob returns the job of the provided scheduler with the provided name, nil if there is
+// none.
+func findJob(s gocron.Scheduler, name string) gocron.Job {
+	for _, job := range s.Jobs() {
+		if job.Name() == name {
+			return job
+		}
+	}
+
+	return nil
+}
+
+// jitterPick is the offset picked for a job within its jitter window.
+type jitterPick struct {
+	jitter time.Duration
+	offset time.Duration
+}
+
+// offsetRegistry keeps the jitter offsets picked for the jobs, so reloads keep moving their
+// runs by the same offset and runs stay a period apart.
+type offsetRegistry struct {
+	mtx   sync.Mutex
+	picks map[string]jitterPick
+}
+
+// jitterOffsets holds the jitter offsets of the scheduled jobs.
+var jitterOffsets = &offsetRegistry{picks: make(map[string]jitterPick)}
+
+// offset returns the jitter offset of the provided job. The offset picked when the job was
+// first scheduled is kept until its jitter window changes.
+func (r *offsetRegistry) offset(job jobConfig) time.Duration {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	pick, ok := r.picks[job.Name]
+	if ok && pick.jitter == job.jitter() {
+		return pick.offset
+	}
+
+	pick = jitterPick{jitter: job.jitter(), offset: job.jitterOffset()}
+	r.picks[job.Name] = pick
+
+	return pick.offset
+}
+
+// scheduledJob is an archive job ready to be registered with the scheduler.
+type scheduledJob struct {
+	job        jobConfig
+	definition gocron.JobDefinition
+	s3Cfg      *s3Config
+	reporters  []runReporter
+	logger     zerolog.Logger
+}
+
+// scheduleJobs replaces the jobs registered with the provided scheduler with the archive jobs
+// of the provided configuration. Every job is prepared before any active job is removed so an
+// invalid job definition leaves the active jobs untouched. Running archives of replaced jobs
+// complete. The provided context is passed to the archive tasks, cancelling it stops running
+// tasks and further scheduling. Run outcomes
+// are sent to the configured reporters and the provided ones, which outlive reloads.
+func scheduleJobs(ctx context.Context, s gocron.Scheduler, cfg *Config, extra []runReporter, logger *zerolog.Logger) error {
+	creds := cfg.credentials(logger)
+	reporters := append(cfg.reporters(), extra...)
+	jobs := cfg.jobs()
+
+	prepared := make([]scheduledJob, 0, len(jobs))
+	for _, job := range jobs {
+		offset := jitterOffsets.offset(job)
+		definition, err := job.jobDefinition(offset)
+		if err != nil {
+			return fmt.Errorf("creating job %s definition: %w", job.Name, err)
+		}
+		if offset != 0 {
+			logger.Info().Str("job", job.Name).Dur("offset", offset).Msg("Moving scheduled runs by jitter")
+		}
+
+		// Jobs report to their own dead man's switch, catalog index and run reports, if any.
+		s3Cfg := cfg.s3Config(job, creds)
+		jobReporters := reporters[:len(reporters):len(reporters)]
+		if job.PingURL != "" {
+			jobReporters = append(jobReporters, newPinger(job.PingURL))
+		}
+		if cfg.catalog() {
+			jobReporters = append(jobReporters, newCatalogIndex(job.Name, s3Cfg))
+		}
+		if cfg.runReports() {
+			jobReporters = append(jobReporters, newRunReports(s3Cfg))
+		}
+
+		prepared = append(prepared, scheduledJob{
+			job:        job,
+			definition: definition,
+			s3Cfg:      s3Cfg,
+			reporters:  jobReporters,
+			logger:     logger.With().Str("job", job.Name).Logger(),
+		})
+	}
+
+	// Swap the active jobs for the newly prepared ones.
+	for _, active := range s.Jobs() {
+		err := s.RemoveJob(active.ID())
+		if err != nil {
+			return fmt.Errorf("removing job %s: %w", active.Name(), err)
+		}
+	}
+
+	for i := range prepared {
+		p := &prepared[i]
+		_, err := s.NewJob(
+			p.definition,
+			// Runs get the provided context rather than the job's own, which is cancelled
+			// once a reload removes the job, so reloads let running archives complete.
+			gocron.NewTask(
+				runArchive,
+				ctx,
+				p.job,
+				p.s3Cfg,
+				p.reporters,
+				&p.logger,
+			),
+			gocron.WithName(p.job.Name),
+			gocron.WithContext(ctx),
+			// Skip a trigger while the previous run is still in progress, overlapping
+			// runs would archive each other's in-progress zip files.
+			gocron.WithSingletonMode(gocron.LimitModeReschedule),
+		)
+		if err != nil {
+			return fmt.Errorf("creating job %s: %w", p.job.Name, err)
+		}
+
+		logger.Info().Msgf("periodically and incrementally backing up %s dir to %s bucket (job %s).",
+			p.job.SourceDir, p.job.Bucket, p.job.Name)
+	}
+
+	return nil
+}
+
+// catchUp runs the jobs of the provided configuration with catch-up enabled which have
+// missed a scheduled run since their last successful run, e.g. while the host was down.
+// Jobs which have not completed a run yet are left to their schedule.
+func catchUp(s gocron.Scheduler, cfg *Config, state *runState, logger *zerolog.Logger) {
+	now := scheduleNow()
+	for _, job := range cfg.jobs() {
+		if !job.Catchup {
+			continue
+		}
+
+		lastSuccess := state.lastSuccess(job.Name)
+		if lastSuccess.IsZero() || !job.missedRun(lastSuccess, now) {
+			continue
+		}
+
+		scheduled := findJob(s, job.Name)
+		if scheduled == nil {
+			continue
+		}
+
+		logger.Info().Str("job", job.Name).Time("lastSuccess", lastSuccess).Msg("Catching up on missed run")
+		err := scheduled.RunNow()
+		if err != nil {
+			logger.Error().Err(err).Str("job", job.Name).Msg("Running missed run")
+		}
+	}
+}
+
+// reloadConfig loads and validates the configuration again and swaps the scheduled jobs for
+// the newly configured ones. It returns the new configuration. The active configuration is
+// kept if the new one is invalid.
+func reloadConfig(ctx context.Context, s gocron.Scheduler, envPath string, extra []runReporter, logger *zerolog.Logger) (*Config, error) {
+	cfg := Config{}
+	err := loadConfig(&cfg, envPath)
+	if err != nil {
+		return nil, fmt.Errorf("loading configuration: %s", strings.ReplaceAll(err.Error(), "\n", ". "))
+	}
+	addSecrets(cfg.secrets()...)
+	setInstanceID(cfg.InstanceID)
+
+	err = scheduleJobs(ctx, s, &cfg, extra, logger)
+	if err != nil {
+		return nil, err
+	}
+
+	setLogLevel(cfg.LogLevel)
+	setCopyBufferSize(cfg.copyBufferSize())
+	setMaxJobs(cfg.maxJobs())
+
+	return &cfg, nil
+}
@@ -0,0 +1,218 @@
+package archiver
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-co-op/gocron/v2"
+	"github.com/peterldowns/testy/assert"
+	"github.com/rs/zerolog"
+)
+
+// jobNames returns the names of the jobs registered with the provided scheduler.
+func jobNames(s gocron.Scheduler) map[string]bool {
+	names := make(map[string]bool)
+	for _, job := range s.Jobs() {
+		names[job.Name()] = true
+	}
+
+	return names
+}
+
+func TestScheduleJobs(t *testing.T) {
+	s, err := gocron.NewScheduler()
+	assert.NoError(t, err)
+	defer s.Shutdown()
+
+	logger := zerolog.Nop()
+	cfg := Config{
+		Endpoint:        "test-endpoint",
+		AccessKeyID:     "test-accesskeyid",
+		SecretAccessKey: "test-secretaccesskey",
+		Bucket:          "test-bucket",
+		LogLevel:        "debug",
+		Jobs: []jobConfig{
+			{Name: "db", SourceDir: "/dumps/db"},
+			{Name: "files", SourceDir: "/dumps/files", Schedule: "01:30"},
+		},
+	}
+
+	// Ensure a job is registered per configured job.
+	err = scheduleJobs(context.Background(), s, &cfg, nil, &logger)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]bool{"db": true, "files": true}, jobNames(s))
+
+	// Ensure scheduling again replaces the active jobs.
+	cfg.Jobs = cfg.Jobs[:1]
+	err = scheduleJobs(context.Background(), s, &cfg, nil, &logger)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]bool{"db": true}, jobNames(s))
+
+	// Ensure an invalid job leaves the active jobs untouched.
+	cfg.Jobs = []jobConfig{{Name: "broken", SourceDir: "/dumps/broken", Schedule: "99:00"}}
+	err = scheduleJobs(context.Background(), s, &cfg, nil, &logger)
+	assert.Error(t, err)
+	assert.Equal(t, map[string]bool{"db": true}, jobNames(s))
+}
+
+func TestSchedulerTimezone(t *testing.T) {
+	logger := zerolog.Nop()
+	cfg := Config{
+		Endpoint:        "test-endpoint",
+		AccessKeyID:     "test-accesskeyid",
+		SecretAccessKey: "test-secretaccesskey",
+		Bucket:          "test-bucket",
+		LogLevel:        "debug",
+		Timezone:        "Asia/Tokyo",
+		Jobs:            []jobConfig{{Name: "db", SourceDir: "/dumps/db", Schedule: "01:30"}},
+	}
+	s, err := newScheduler(&cfg, nil, &logger)
+	assert.NoError(t, err)
+	defer s.Shutdown()
+
+	// Ensure schedules run at their time in the configured timezone.
+	err = scheduleJobs(context.Background(), s, &cfg, nil, &logger)
+	assert.NoError(t, err)
+	s.Start()
+
+	next, err := findJob(s, "db").NextRun()
+	assert.NoError(t, err)
+	next = next.In(cfg.location())
+	assert.Equal(t, 1, next.Hour())
+	assert.Equal(t, 30, next.Minute())
+}
+
+func TestScheduleMultipleTimes(t *testing.T) {
+	logger := zerolog.Nop()
+	cfg := Config{
+		Endpoint:        "test-endpoint",
+		AccessKeyID:     "test-accesskeyid",
+		SecretAccessKey: "test-secretaccesskey",
+		Bucket:          "test-bucket",
+		LogLevel:        "debug",
+		Timezone:        "UTC",
+		Jobs:            []jobConfig{{Name: "db", SourceDir: "/dumps/db", Schedule: "06:00,14:00,23:50"}},
+	}
+	s, err := newScheduler(&cfg, nil, &logger)
+	assert.NoError(t, err)
+	defer s.Shutdown()
+
+	// Ensure jobs run at every configured time of the day.
+	err = scheduleJobs(context.Background(), s, &cfg, nil, &logger)
+	assert.NoError(t, err)
+	s.Start()
+
+	runs, err := findJob(s, "db").NextRuns(3)
+	assert.NoError(t, err)
+	times := make(map[string]bool)
+	for _, run := range runs {
+		times[run.UTC().Format("15:04")] = true
+	}
+	assert.Equal(t, map[string]bool{"06:00": true, "14:00": true, "23:50": true}, times)
+}
+
+func TestScheduleNow(t *testing.T) {
+	defer setLocation(nil)
+
+	// Ensure the current time is in the configured timezone.
+	loc, err := time.LoadLocation("America/New_York")
+	assert.NoError(t, err)
+	setLocation(loc)
+	assert.Equal(t, "America/New_York", scheduleNow().Location().String())
+}
+
+func TestReloadConfig(t *testing.T) {
+	s, err := gocron.NewScheduler()
+	assert.NoError(t, err)
+	defer s.Shutdown()
+
+	envPath := filepath.Join(t.TempDir(), ".env")
+	logger := zerolog.Nop()
+
+	// Ensure an invalid configuration is rejected.
+	err = os.WriteFile(envPath, []byte("endpoint=test-endpoint\n"), 0600)
+	assert.NoError(t, err)
+	_, err = reloadConfig(context.Background(), s, envPath, nil, &logger)
+	assert.Error(t, err)
+	assert.Equal(t, 0, len(s.Jobs()))
+
+	// Ensure a valid configuration replaces the scheduled jobs.
+	err = os.WriteFile(envPath, []byte("endpoint=test-endpoint\naccesskeyid=test-accesskeyid\n"+
+		"secretaccesskey=test-secretaccesskey\nbucket=test-bucket\nsourcedir=test-sourcedir\nloglevel=info\n"), 0600)
+	assert.NoError(t, err)
+	_, err = reloadConfig(context.Background(), s, envPath, nil, &logger)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]bool{defaultJobName: true}, jobNames(s))
+}
+
+func TestReloadDuringRun(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("hook commands are POSIX shell scripts")
+	}
+
+	s, err := gocron.NewScheduler()
+	assert.NoError(t, err)
+	defer s.Shutdown()
+	s.Start()
+
+	dir := t.TempDir()
+	logger := zerolog.Nop()
+	tracker := newStatusTracker()
+	fake := newFakeS3(t, "test-bucket")
+	s3Cfg := fake.s3Config("test-bucket")
+	cfg := Config{
+		Endpoint:        s3Cfg.Endpoint,
+		AccessKeyID:     "test-accesskeyid",
+		SecretAccessKey: "test-secretaccesskey",
+		Bucket:          "test-bucket",
+		Jobs:            []jobConfig{{Name: "reload-run", SourceDir: dir, PreRun: "touch started && sleep 1"}},
+		staticCreds:     true,
+		transport:       s3Cfg.Options.Transport,
+	}
+	err = scheduleJobs(context.Background(), s, &cfg, []runReporter{tracker}, &logger)
+	assert.NoError(t, err)
+	assert.NoError(t, findJob(s, "reload-run").RunNow())
+
+	// Ensure a reload during a run lets the run complete.
+	for {
+		_, err := os.Stat(filepath.Join(dir, "started"))
+		if err == nil {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	err = scheduleJobs(context.Background(), s, &cfg, []runReporter{tracker}, &logger)
+	assert.NoError(t, err)
+
+	// Ensure triggers of the replaced job are skipped while the run is in progress.
+	assert.NoError(t, findJob(s, "reload-run").RunNow())
+
+	var result runResult
+	for {
+		tracker.mtx.Lock()
+		result = tracker.runs["reload-run"]
+		tracker.mtx.Unlock()
+		if !result.Start.IsZero() {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.NoError(t, result.Err)
+	assert.NotEqual(t, "", result.Key)
+
+	time.Sleep(100 * time.Millisecond)
+	fake.mtx.Lock()
+	archives := 0
+	for key := range fake.buckets["test-bucket"] {
+		if strings.HasSuffix(key, ".zip") {
+			archives++
+		}
+	}
+	fake.mtx.Unlock()
+	assert.Equal(t, 1, archives)
+}
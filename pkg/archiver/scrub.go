@@ -0,0 +1,306 @@
+package archiver
+
+import (
+	"archive/zip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dnldd/zdts3/pkg/storage"
+	"github.com/dustin/go-humanize"
+	"github.com/rs/zerolog"
+)
+
+// scrubCheckInterval is the interval at which the scrub interval of the active configuration
+// is checked.
+const scrubCheckInterval = time.Minute
+
+// scrubFailure is an archive found corrupt by a scrub.
+type scrubFailure struct {
+	Job    string
+	Bucket string
+	Key    string
+	Err    error
+}
+
+// scrubResult is the outcome of scrubbing the archives of every job.
+type scrubResult struct {
+	// Archives is the number of archives read back and verified.
+	Archives int
+	Bytes    int64
+	// Skipped is the number of deduplicated and delta archives, which are not stored as
+	// zip files and are not verified.
+	Skipped  int
+	Failures []scrubFailure
+}
+
+// scrubArchives reads back every archive of every job of the provided configuration and
+// verifies it against its manifest. Jobs sharing a bucket and prefix are scrubbed once.
+// Corrupt archives are returned as failures of the result, prefixes which cannot be listed
+// in the returned error.
+func scrubArchives(ctx context.Context, cfg *Config, logger *zerolog.Logger) (*scrubResult, error) {
+	creds := cfg.credentials(logger)
+	result := &scrubResult{}
+
+	var errs error
+	scrubbed := make(map[string]bool)
+	for _, job := range cfg.jobs() {
+		s3Cfg := cfg.s3Config(job, creds)
+		if scrubbed[s3Cfg.Bucket+"/"+archivePrefix(s3Cfg)] {
+			continue
+		}
+		scrubbed[s3Cfg.Bucket+"/"+archivePrefix(s3Cfg)] = true
+
+		err := scrubPrefix(ctx, job, s3Cfg, result, logger)
+		if err != nil {
+			errs = errors.Join(errs, fmt.Errorf("job %s: %w", job.Name, err))
+		}
+	}
+
+	return result, errs
+}
+
+// scrubPrefix verifies the archives of the provided job, adding them to the provided result.
+func scrubPrefix(ctx context.Context, job jobConfig, cfg *s3Config, result *scrubResult, logger *zerolog.Logger) error {
+	archives, err := listArchives(ctx, cfg)
+	if err != nil {
+		return err
+	}
+
+	store, err := cfg.openStorage(ctx)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	for _, archive := range archives {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		if isRecipeKey(archive.Key) || isDeltaKey(archive.Key) {
+			result.Skipped++
+			continue
+		}
+
+		err := scrubArchive(ctx, store, archive)
+		if err != nil {
+			logger.Error().Err(err).Str("job", job.Name).Str("bucket", cfg.Bucket).Str("object", archive.Key).
+				Msg("Archive corrupt")
+			result.Failures = append(result.Failures, scrubFailure{Job: job.Name, Bucket: cfg.Bucket, Key: archive.Key, Err: err})
+			continue
+		}
+
+		result.Archives++
+		result.Bytes += archive.Size
+	}
+
+	return nil
+}
+
+// scrubArchive downloads the provided archive and verifies it has its listed size, reads
+// back as a zip file and holds the files recorded by its manifest.
+func scrubArchive(ctx context.Context, store storage.Storage, archive storage.Object) error {
+	src, err := store.Get(ctx, archive.Key)
+	if err != nil {
+		return fmt.Errorf("downloading archive: %w", err)
+	}
+	defer src.Close()
+
+	// The zip format requires random access.
+	tmp, err := os.CreateTemp("", "zdts3-scrub-*.zip")
+	if err != nil {
+		return fmt.Errorf("creating download file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	size, err := copyBuffers().copy(tmp, src)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("downloading archive: %w", err)
+	}
+
+	if size != archive.Size {
+		return fmt.Errorf("read %d bytes of %d", size, archive.Size)
+	}
+
+	manifest, err := readStoreManifest(ctx, store, archive.Key)
+	if err != nil {
+		return err
+	}
+
+	err = verifyZip(tmp.Name(), manifest)
+	if err == nil {
+		return nil
+	}
+
+	// Tell corrupt archives which restores repair apart.
+	parityPath, parityErr := downloadParity(ctx, store, archive.Key, tmp.Name())
+	if parityErr != nil || parityPath == "" {
+		return err
+	}
+	defer os.Remove(parityPath)
+
+	_, repairErr := repairZip(tmp.Name(), parityPath)
+	if repairErr != nil || verifyZip(tmp.Name(), manifest) != nil {
+		return fmt.Errorf("%w, not repairable with its parity data", err)
+	}
+
+	return fmt.Errorf("%w, repairable with its parity data", err)
+}
+
+// verifyZip reads every entry of the zip file at the provided path, verifying their CRC-32
+// checksums, and ensures it holds the files recorded by the provided manifest with their
+// SHA-256 hashes. Archives without a manifest are verified against the checksums they embed,
+// if any, and only verified to read back otherwise.
+func verifyZip(zipPath string, manifest *archiveManifest) error {
+	reader, err := zip.OpenReader(zipPath)
+	if err != nil {
+		return fmt.Errorf("opening archive: %w", err)
+	}
+	defer reader.Close()
+
+	hashes := make(map[string]string, len(reader.File))
+	for _, entry := range reader.File {
+		if entry.FileInfo().IsDir() {
+			continue
+		}
+
+		// Hard links share the content of the file they link to, added before them.
+		if strings.HasPrefix(entry.Comment, hardLinkComment) {
+			hashes[entry.Name] = hashes[strings.TrimPrefix(entry.Comment, hardLinkComment)]
+			continue
+		}
+
+		hash, err := hashZipEntry(entry)
+		if err != nil {
+			return fmt.Errorf("reading %s: %w", entry.Name, err)
+		}
+		hashes[entry.Name] = hash
+	}
+
+	if manifest == nil {
+		var err error
+		manifest, err = embeddedManifest(&reader.Reader)
+		if err != nil {
+			return err
+		}
+	}
+	if manifest == nil {
+		return nil
+	}
+
+	var errs error
+	for _, file := range manifest.Files {
+		hash, ok := hashes[file.Path]
+		switch {
+		case !ok:
+			errs = errors.Join(errs, fmt.Errorf("%s missing from the archive", file.Path))
+		case file.SHA256 != "" && hash != file.SHA256:
+			errs = errors.Join(errs, fmt.Errorf("%s does not match its manifest checksum", file.Path))
+		}
+	}
+
+	return errs
+}
+
+// hashZipEntry returns the hex encoded SHA-256 hash of the content of the provided zip
+// entry. Entries not matching their CRC-32 checksum fail with zip.ErrChecksum.
+func hashZipEntry(entry *zip.File) (string, error) {
+	src, err := entry.Open()
+	if err != nil {
+		return "", err
+	}
+	defer src.Close()
+
+	hash := sha256.New()
+	_, err = io.Copy(hash, src)
+	if err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// runScrubs scrubs the archives of the active configuration every configured scrub
+// interval until the context is cancelled, alerting the notification channels about every
+// corrupt archive. The first scrub runs an interval after startup.
+func runScrubs(ctx context.Context, active func() *Config, logger *zerolog.Logger, wg *sync.WaitGroup) {
+	defer wg.Done()
+
+	ticker := time.NewTicker(scrubCheckInterval)
+	defer ticker.Stop()
+
+	last := time.Now()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+
+		case now := <-ticker.C:
+			cfg := active()
+			interval := cfg.scrubInterval()
+			if interval == 0 || now.Sub(last) < interval {
+				continue
+			}
+			last = now
+
+			result, err := scrubArchives(ctx, cfg, logger)
+			if err != nil {
+				logger.Error().Err(err).Msg("Scrubbing archives")
+			}
+
+			logger.Info().Int("archives", result.Archives).Int64("bytes", result.Bytes).
+				Int("skipped", result.Skipped).Int("corrupt", len(result.Failures)).Msg("Scrubbed archives")
+
+			for _, failure := range result.Failures {
+				corrupt := &runResult{
+					Job:    failure.Job,
+					Start:  now,
+					Bucket: failure.Bucket,
+					Key:    failure.Key,
+					Err:    fmt.Errorf("archive %s corrupt: %w", failure.Key, failure.Err),
+				}
+				report(ctx, cfg.notifiers(), corrupt, logger)
+			}
+		}
+	}
+}
+
+// runScrubCommand reads back and verifies the archives of every job, failing when any is
+// corrupt.
+func runScrubCommand(cfg *Config, args []string, out io.Writer) error {
+	fs := flag.NewFlagSet("scrub", flag.ContinueOnError)
+	err := fs.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	logger := zerolog.Nop()
+	result, err := scrubArchives(context.Background(), cfg, &logger)
+	if err != nil {
+		return err
+	}
+
+	for _, failure := range result.Failures {
+		fmt.Fprintf(out, "CORRUPT %s/%s: %v\n", failure.Bucket, failure.Key, failure.Err)
+	}
+	fmt.Fprintf(out, "Verified %d archives (%s), skipped %d, %d corrupt\n", result.Archives,
+		humanize.IBytes(uint64(result.Bytes)), result.Skipped, len(result.Failures))
+
+	if len(result.Failures) > 0 {
+		return fmt.Errorf("%d corrupt archives", len(result.Failures))
+	}
+
+	return nil
+}
@@ -0,0 +1,105 @@
+package archiver
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/peterldowns/testy/assert"
+)
+
+// manifestBytes returns the encoded manifest of an archive of the provided files.
+func manifestBytes(t *testing.T, key string, files map[string]string) []byte {
+	manifest := archiveManifest{Job: "db", Key: key, Type: backupFull}
+	for name, content := range files {
+		hash := sha256.Sum256([]byte(content))
+		manifest.Files = append(manifest.Files, archivedFile{Path: name, Size: int64(len(content)), SHA256: hex.EncodeToString(hash[:])})
+	}
+
+	data, err := json.Marshal(manifest)
+	assert.NoError(t, err)
+	return data
+}
+
+func TestScrubCommand(t *testing.T) {
+	fake := newFakeS3(t, "test-bucket")
+	s3Cfg := fake.s3Config("test-bucket")
+	files := map[string]string{"users.sql": "users", "orders.sql": "orders"}
+	truncated := zipBytes(t, files)
+	truncated = truncated[:len(truncated)-10]
+	putArchives(t, s3Cfg, map[string][]byte{
+		"backups/dump-20260101235000.zip":           zipBytes(t, files),
+		"backups/dump-20260101235000.manifest.json": manifestBytes(t, "backups/dump-20260101235000.zip", files),
+		"backups/dump-20260102235000.zip":           zipBytes(t, map[string]string{"users.sql": "users"}),
+		"backups/dump-20260103235000.zip":           zipBytes(t, files),
+		"backups/dump-20251231235000.recipe":        []byte("{}"),
+	})
+
+	cfg := &Config{
+		Endpoint:        s3Cfg.Endpoint,
+		AccessKeyID:     "test-accesskeyid",
+		SecretAccessKey: "test-secretaccesskey",
+		Jobs:            []jobConfig{{Name: "db", SourceDir: t.TempDir(), Bucket: "test-bucket", Prefix: "backups"}},
+		staticCreds:     true,
+		transport:       s3Cfg.Options.Transport,
+	}
+
+	// Ensure intact archives, with or without a manifest, are verified.
+	var out bytes.Buffer
+	err := runCommand(cfg, []string{"scrub"}, &out)
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(out.String(), "Verified 3 archives ("))
+	assert.True(t, strings.HasSuffix(out.String(), "skipped 1, 0 corrupt\n"))
+
+	// Ensure archives missing files of their manifest and damaged archives are reported.
+	putArchives(t, s3Cfg, map[string][]byte{
+		"backups/dump-20260102235000.manifest.json": manifestBytes(t, "backups/dump-20260102235000.zip", files),
+		"backups/dump-20260103235000.zip":           truncated,
+	})
+
+	out.Reset()
+	err = runCommand(cfg, []string{"scrub"}, &out)
+	assert.Error(t, err)
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	assert.Equal(t, 3, len(lines))
+	assert.True(t, strings.HasPrefix(lines[0], "CORRUPT test-bucket/backups/dump-20260103235000.zip: "))
+	assert.Equal(t, "CORRUPT test-bucket/backups/dump-20260102235000.zip: orders.sql missing from the archive", lines[1])
+	assert.True(t, strings.HasPrefix(lines[2], "Verified 1 archives ("))
+	assert.True(t, strings.HasSuffix(lines[2], "skipped 1, 2 corrupt"))
+}
+
+func TestVerifyZip(t *testing.T) {
+	files := map[string]string{"users.sql": "users"}
+	zipPath := t.TempDir() + "/dump.zip"
+	assert.NoError(t, os.WriteFile(zipPath, zipBytes(t, files), 0600))
+
+	var manifest archiveManifest
+	assert.NoError(t, json.Unmarshal(manifestBytes(t, "dump.zip", files), &manifest))
+	assert.NoError(t, verifyZip(zipPath, &manifest))
+
+	// Ensure files not matching their manifest checksum are reported.
+	manifest.Files[0].SHA256 = strings.Repeat("0", 64)
+	err := verifyZip(zipPath, &manifest)
+	assert.Error(t, err)
+	assert.Equal(t, "users.sql does not match its manifest checksum", err.Error())
+
+	// Ensure damaged entries fail their CRC-32 checksum.
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	entry, err := w.CreateHeader(&zip.FileHeader{Name: "users.sql", Method: zip.Store})
+	assert.NoError(t, err)
+	_, err = entry.Write([]byte("alice"))
+	assert.NoError(t, err)
+	assert.NoError(t, w.Close())
+	data := bytes.Replace(buf.Bytes(), []byte("alice"), []byte("alicf"), 1)
+	assert.NoError(t, os.WriteFile(zipPath, data, 0600))
+
+	err = verifyZip(zipPath, nil)
+	assert.True(t, errors.Is(err, zip.ErrChecksum))
+}
@@ -0,0 +1,176 @@
+package archiver
+
+import (
+	"archive/zip"
+	"context"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"sync"
+
+	"github.com/minio/minio-go/v7"
+)
+
+const (
+	// minRangeSize is the size of the first ranged request of a read at a new offset of a
+	// remote archive.
+	minRangeSize = 64 << 10
+	// maxRangeSize is the size ranged requests of sequential reads of a remote archive grow
+	// up to.
+	maxRangeSize = 8 << 20
+)
+
+// includeFilter selects the entries of archives to restore by slash separated glob
+// patterns. A nil filter selects every entry.
+type includeFilter []string
+
+// String returns the patterns of the filter.
+func (f *includeFilter) String() string {
+	return strings.Join(*f, ",")
+}
+
+// Set adds a pattern to the filter.
+func (f *includeFilter) Set(pattern string) error {
+	_, err := path.Match(strings.ReplaceAll(pattern, "**", "*"), "")
+	if err != nil {
+		return fmt.Errorf("invalid pattern %q: %w", pattern, err)
+	}
+
+	*f = append(*f, strings.Trim(pattern, "/"))
+	return nil
+}
+
+// matches returns whether the entry with the provided name is selected, because a pattern
+// matches it or one of its parent directories.
+func (f includeFilter) matches(name string) bool {
+	if f == nil {
+		return true
+	}
+
+	name = strings.TrimSuffix(name, "/")
+	for _, pattern := range f {
+		for dir := name; dir != "."; dir = path.Dir(dir) {
+			if matchGlob(strings.Split(pattern, "/"), strings.Split(dir, "/")) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// matchGlob returns whether the provided path segments match the provided pattern segments.
+// A ** segment matches any number of segments, other segments are matched with path.Match.
+func matchGlob(pattern []string, segments []string) bool {
+	if len(pattern) == 0 {
+		return len(segments) == 0
+	}
+
+	if pattern[0] == "**" {
+		for i := 0; i <= len(segments); i++ {
+			if matchGlob(pattern[1:], segments[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+
+	if len(segments) == 0 {
+		return false
+	}
+
+	matched, _ := path.Match(pattern[0], segments[0])
+	return matched && matchGlob(pattern[1:], segments[1:])
+}
+
+// rangeReader reads a remote object with ranged requests, so only the parts of an archive
+// which are read are downloaded. The range requested grows while reads are sequential, and
+// the last range is kept to serve the reads within it.
+type rangeReader struct {
+	ctx    context.Context
+	mnc    *minio.Client
+	bucket string
+	key    string
+	size   int64
+
+	mtx    sync.Mutex
+	block  []byte
+	offset int64
+	next   int
+}
+
+// ReadAt reads the object at the provided offset.
+func (r *rangeReader) ReadAt(p []byte, off int64) (int, error) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	n := 0
+	for n < len(p) && off < r.size {
+		if off < r.offset || off >= r.offset+int64(len(r.block)) {
+			err := r.fetch(off)
+			if err != nil {
+				return n, err
+			}
+		}
+
+		copied := copy(p[n:], r.block[off-r.offset:])
+		n += copied
+		off += int64(copied)
+	}
+
+	if n < len(p) {
+		return n, io.EOF
+	}
+
+	return n, nil
+}
+
+// fetch requests the range of the object starting at the provided offset.
+func (r *rangeReader) fetch(off int64) error {
+	if off != r.offset+int64(len(r.block)) || r.next == 0 {
+		r.next = minRangeSize
+	}
+	end := min(off+int64(r.next), r.size) - 1
+
+	opts := minio.GetObjectOptions{}
+	err := opts.SetRange(off, end)
+	if err != nil {
+		return err
+	}
+
+	obj, err := r.mnc.GetObject(r.ctx, r.bucket, r.key, opts)
+	if err != nil {
+		return fmt.Errorf("reading %s: %w", r.key, err)
+	}
+	defer obj.Close()
+
+	block, err := io.ReadAll(obj)
+	if err != nil {
+		return fmt.Errorf("reading %s: %w", r.key, err)
+	}
+	if len(block) == 0 {
+		return io.ErrUnexpectedEOF
+	}
+
+	r.block, r.offset = block, off
+	r.next = min(r.next*2, maxRangeSize)
+	return nil
+}
+
+// extractRemoteZip extracts the entries of the remote zip archive with the provided key into
+// the provided directory with the provided options. Only the central directory of the
+// archive and the extracted entries are downloaded.
+func extractRemoteZip(ctx context.Context, mnc *minio.Client, bucket string, key string, targetDir string, opts extractOptions) (int, int64, error) {
+	info, err := mnc.StatObject(ctx, bucket, key, minio.StatObjectOptions{})
+	if err != nil {
+		return 0, 0, fmt.Errorf("downloading archive %s: %w", key, err)
+	}
+
+	reader, err := zip.NewReader(&rangeReader{ctx: ctx, mnc: mnc, bucket: bucket, key: key, size: info.Size}, info.Size)
+	if err != nil {
+		return 0, 0, fmt.Errorf("opening archive %s: %w", key, err)
+	}
+
+	return extractZipReader(reader, targetDir, opts)
+}
@@ -0,0 +1,106 @@
+package archiver
+
+import (
+	"archive/zip"
+	"bytes"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/peterldowns/testy/assert"
+)
+
+func TestIncludeFilter(t *testing.T) {
+	tests := []struct {
+		patterns []string
+		name     string
+		want     bool
+	}{
+		{nil, "users.sql", true},
+		{[]string{"customers/acme/**"}, "customers/acme/users.sql", true},
+		{[]string{"customers/acme/**"}, "customers/acme/2026/orders.csv", true},
+		{[]string{"customers/acme/**"}, "customers/globex/users.sql", false},
+		{[]string{"customers/acme/"}, "customers/acme/users.sql", true},
+		{[]string{"customers/acme"}, "customers/acme-old/users.sql", false},
+		{[]string{"**/*.sql"}, "users.sql", true},
+		{[]string{"**/*.sql"}, "customers/acme/users.sql", true},
+		{[]string{"**/*.sql"}, "customers/acme/orders.csv", false},
+		{[]string{"*.csv", "users.sql"}, "users.sql", true},
+	}
+
+	for _, test := range tests {
+		var filter includeFilter
+		for _, pattern := range test.patterns {
+			assert.NoError(t, filter.Set(pattern))
+		}
+		assert.Equal(t, test.want, filter.matches(test.name))
+	}
+
+	// Ensure malformed patterns are rejected.
+	var filter includeFilter
+	assert.Error(t, filter.Set("customers/[acme"))
+}
+
+func TestSelectiveRestore(t *testing.T) {
+	fake := newFakeS3(t, "test-bucket")
+	s3Cfg := fake.s3Config("test-bucket")
+
+	// Store a large incompressible file after the selected one.
+	large := make([]byte, 8<<20)
+	rand.New(rand.NewSource(1)).Read(large)
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	for _, file := range []struct {
+		name string
+		data []byte
+	}{
+		{"customers/acme/users.sql", []byte("acme")},
+		{"customers/globex/users.sql", []byte("globex")},
+		{"customers/globex/blobs.bin", large},
+	} {
+		entry, err := w.CreateHeader(&zip.FileHeader{Name: file.name, Method: zip.Store})
+		assert.NoError(t, err)
+		_, err = entry.Write(file.data)
+		assert.NoError(t, err)
+	}
+	assert.NoError(t, w.Close())
+	putArchives(t, s3Cfg, map[string][]byte{"dump-20260101235000.zip": buf.Bytes()})
+
+	cfg := &Config{
+		Endpoint:        s3Cfg.Endpoint,
+		AccessKeyID:     "test-accesskeyid",
+		SecretAccessKey: "test-secretaccesskey",
+		Jobs:            []jobConfig{{Name: "db", SourceDir: t.TempDir(), Bucket: "test-bucket"}},
+		staticCreds:     true,
+		transport:       s3Cfg.Options.Transport,
+	}
+
+	// Ensure only the selected entries are restored, without downloading the archive.
+	target := t.TempDir()
+	var out bytes.Buffer
+	err := runCommand(cfg, []string{"restore", "-include", "customers/acme/**", "-target", target}, &out)
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(out.String(), "Restored dump-20260101235000.zip from 1 archives"))
+	data, err := os.ReadFile(filepath.Join(target, "customers", "acme", "users.sql"))
+	assert.NoError(t, err)
+	assert.Equal(t, "acme", string(data))
+	_, err = os.Stat(filepath.Join(target, "customers", "globex"))
+	assert.True(t, os.IsNotExist(err))
+	assert.True(t, fake.servedBytes() < int64(len(large))/10)
+
+	// Ensure entries read past the first range are restored intact.
+	target = t.TempDir()
+	err = runCommand(cfg, []string{"restore", "-include", "**/*.bin", "-target", target}, &out)
+	assert.NoError(t, err)
+	data, err = os.ReadFile(filepath.Join(target, "customers", "globex", "blobs.bin"))
+	assert.NoError(t, err)
+	assert.Equal(t, large, data)
+	_, err = os.Stat(filepath.Join(target, "customers", "acme"))
+	assert.True(t, os.IsNotExist(err))
+
+	// Ensure malformed patterns are rejected.
+	err = runCommand(cfg, []string{"restore", "-include", "[", "-target", t.TempDir()}, &out)
+	assert.Error(t, err)
+}
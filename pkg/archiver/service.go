@@ -0,0 +1,69 @@
+package archiver
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+// defaultServiceName is the default name of the Windows service.
+const defaultServiceName = "zdts3"
+
+var (
+	// serviceStop is closed once the Windows service manager requests the service to stop.
+	serviceStop = make(chan struct{})
+	// serviceStopOnce guards the closing of serviceStop.
+	serviceStopOnce sync.Once
+)
+
+// requestServiceStop requests a graceful shutdown on behalf of the service manager, like a
+// termination signal.
+func requestServiceStop() {
+	serviceStopOnce.Do(func() { close(serviceStop) })
+}
+
+// serviceArgs returns the command-line flags the service is started with, the flags
+// preceding the service subcommand.
+func serviceArgs() []string {
+	return os.Args[1 : len(os.Args)-flag.NArg()]
+}
+
+// runServiceCommand executes Windows service subcommands.
+func runServiceCommand(args []string, out io.Writer) error {
+	if len(args) == 0 {
+		return fmt.Errorf("service command required (install, uninstall, start, stop)")
+	}
+
+	fs := flag.NewFlagSet("service "+args[0], flag.ContinueOnError)
+	name := fs.String("name", defaultServiceName, "Name of the Windows service")
+	err := fs.Parse(args[1:])
+	if err != nil {
+		return err
+	}
+
+	var done string
+	switch args[0] {
+	case "install":
+		err = installService(*name, serviceArgs())
+		done = "installed"
+	case "uninstall":
+		err = uninstallService(*name)
+		done = "uninstalled"
+	case "start":
+		err = startService(*name)
+		done = "started"
+	case "stop":
+		err = stopService(*name)
+		done = "stopping"
+	default:
+		return fmt.Errorf("unknown service command %q", args[0])
+	}
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(out, "service %s %s\n", *name, done)
+	return nil
+}
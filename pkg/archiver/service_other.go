@@ -0,0 +1,37 @@
+//go:build !windows
+
+package archiver
+
+import (
+	"errors"
+	"fmt"
+)
+
+// errNoService is returned by the service subcommands outside of Windows.
+var errNoService = fmt.Errorf("windows services %w on this platform, use systemd instead", errors.ErrUnsupported)
+
+// runAsService runs the provided daemon function, as a Windows service when started by the
+// service manager. Services are only supported on Windows, the function is run directly.
+func runAsService(run func() int) int {
+	return run()
+}
+
+// installService is not supported on this platform.
+func installService(string, []string) error {
+	return errNoService
+}
+
+// uninstallService is not supported on this platform.
+func uninstallService(string) error {
+	return errNoService
+}
+
+// startService is not supported on this platform.
+func startService(string) error {
+	return errNoService
+}
+
+// stopService is not supported on this platform.
+func stopService(string) error {
+	return errNoService
+}
@@ -0,0 +1,55 @@
+package archiver
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/peterldowns/testy/assert"
+)
+
+func TestServiceCommand(t *testing.T) {
+	var out bytes.Buffer
+	assert.Error(t, runServiceCommand(nil, &out))
+	assert.Error(t, runServiceCommand([]string{"restart"}, &out))
+
+	// Ensure services are unsupported outside of Windows.
+	if runtime.GOOS != "windows" {
+		for _, command := range []string{"install", "uninstall", "start", "stop"} {
+			err := runServiceCommand([]string{command, "-name", "zdts3-test"}, &out)
+			assert.True(t, errors.Is(err, errors.ErrUnsupported))
+		}
+		assert.Equal(t, 0, out.Len())
+	}
+}
+
+func TestServiceStop(t *testing.T) {
+	stop := serviceStop
+	serviceStop = make(chan struct{})
+	serviceStopOnce = sync.Once{}
+	defer func() {
+		serviceStop = stop
+		serviceStopOnce = sync.Once{}
+	}()
+
+	// Ensure stop requests of the service manager take the graceful shutdown path.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go handleTermination(ctx, cancel, &wg)
+
+	requestServiceStop()
+	requestServiceStop()
+
+	select {
+	case <-ctx.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("context not cancelled on service stop")
+	}
+	wg.Wait()
+}
@@ -0,0 +1,183 @@
+//go:build windows
+
+package archiver
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"golang.org/x/sys/windows/svc"
+	"golang.org/x/sys/windows/svc/mgr"
+)
+
+const (
+	// serviceStopWait is the time the service manager is told a graceful shutdown may take,
+	// running jobs observe the cancellation within it.
+	serviceStopWait = 30 * time.Second
+	// serviceRestartDelay is the delay before the service manager restarts a failed service.
+	serviceRestartDelay = time.Minute
+)
+
+// windowsService runs the daemon under the Windows service manager.
+type windowsService struct {
+	run  func() int
+	code int
+}
+
+// Execute runs the daemon, translating stop and shutdown requests of the service manager into
+// a graceful shutdown. It returns the daemon's exit code as a service specific exit code.
+func (s *windowsService) Execute(_ []string, requests <-chan svc.ChangeRequest, status chan<- svc.Status) (bool, uint32) {
+	status <- svc.Status{State: svc.StartPending}
+
+	done := make(chan int, 1)
+	go func() {
+		done <- s.run()
+	}()
+
+	status <- svc.Status{State: svc.Running, Accepts: svc.AcceptStop | svc.AcceptShutdown}
+	for {
+		select {
+		case s.code = <-done:
+			status <- svc.Status{State: svc.StopPending}
+			return s.code != exitOK, uint32(s.code)
+
+		case req := <-requests:
+			switch req.Cmd {
+			case svc.Interrogate:
+				status <- req.CurrentStatus
+
+			case svc.Stop, svc.Shutdown:
+				status <- svc.Status{State: svc.StopPending, WaitHint: uint32(serviceStopWait.Milliseconds())}
+				requestServiceStop()
+			}
+		}
+	}
+}
+
+// runAsService runs the provided daemon function, as a Windows service when started by the
+// service manager.
+func runAsService(run func() int) int {
+	isService, err := svc.IsWindowsService()
+	if err != nil || !isService {
+		return run()
+	}
+
+	service := &windowsService{run: run}
+	err = svc.Run(defaultServiceName, service)
+	if err != nil {
+		return exitRuntime
+	}
+
+	return service.code
+}
+
+// openService connects to the service manager and opens the service with the provided name.
+// The returned function closes both.
+func openService(name string) (*mgr.Service, func(), error) {
+	m, err := mgr.Connect()
+	if err != nil {
+		return nil, nil, fmt.Errorf("connecting to the service manager: %w", err)
+	}
+
+	s, err := m.OpenService(name)
+	if err != nil {
+		m.Disconnect()
+		return nil, nil, fmt.Errorf("opening service %s: %w", name, err)
+	}
+
+	return s, func() {
+		s.Close()
+		m.Disconnect()
+	}, nil
+}
+
+// installService installs the running executable as an automatically started service with
+// the provided name, started with the provided command-line flags. Failed services are
+// restarted by the service manager.
+func installService(name string, args []string) error {
+	exe, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("locating the executable: %w", err)
+	}
+	exe, err = filepath.Abs(exe)
+	if err != nil {
+		return fmt.Errorf("locating the executable: %w", err)
+	}
+
+	m, err := mgr.Connect()
+	if err != nil {
+		return fmt.Errorf("connecting to the service manager: %w", err)
+	}
+	defer m.Disconnect()
+
+	s, err := m.CreateService(name, exe, mgr.Config{
+		DisplayName: "zdts3",
+		Description: "Archives directories to S3 compatible storage on a schedule.",
+		StartType:   mgr.StartAutomatic,
+	}, args...)
+	if err != nil {
+		return fmt.Errorf("creating service %s: %w", name, err)
+	}
+	defer s.Close()
+
+	err = s.SetRecoveryActions([]mgr.RecoveryAction{
+		{Type: mgr.ServiceRestart, Delay: serviceRestartDelay},
+	}, uint32(24*time.Hour/time.Second))
+	if err != nil {
+		return fmt.Errorf("setting the recovery actions of service %s: %w", name, err)
+	}
+
+	return nil
+}
+
+// uninstallService removes the service with the provided name. A running service is removed
+// once it stops.
+func uninstallService(name string) error {
+	s, closeService, err := openService(name)
+	if err != nil {
+		return err
+	}
+	defer closeService()
+
+	err = s.Delete()
+	if err != nil {
+		return fmt.Errorf("removing service %s: %w", name, err)
+	}
+
+	return nil
+}
+
+// startService starts the service with the provided name.
+func startService(name string) error {
+	s, closeService, err := openService(name)
+	if err != nil {
+		return err
+	}
+	defer closeService()
+
+	err = s.Start()
+	if err != nil {
+		return fmt.Errorf("starting service %s: %w", name, err)
+	}
+
+	return nil
+}
+
+// stopService requests the service with the provided name to stop, without waiting for its
+// running jobs to finish.
+func stopService(name string) error {
+	s, closeService, err := openService(name)
+	if err != nil {
+		return err
+	}
+	defer closeService()
+
+	_, err = s.Control(svc.Stop)
+	if err != nil {
+		return fmt.Errorf("stopping service %s: %w", name, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,262 @@
+package archiver
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net"
+	"os"
+	"path"
+	"path/filepath"
+	"time"
+
+	"github.com/dnldd/zdts3/pkg/storage"
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+const (
+	// sftpPort is the default port of SFTP servers.
+	sftpPort = "22"
+	// sftpDialTimeout is the maximum duration of connecting to an SFTP server.
+	sftpDialTimeout = 30 * time.Second
+)
+
+// sftpConfig is the access configuration of a directory of an SFTP server.
+type sftpConfig struct {
+	// Host is the host of the server, with an optional port.
+	Host string
+	// User is the user authenticating with the private key.
+	User string
+	// Key is the path of the user's private key.
+	Key string
+	// KnownHosts is the path of the known hosts file the server's host key is verified with.
+	KnownHosts string
+	// Path is the directory archives are stored in.
+	Path string
+}
+
+// address returns the address of the server, with the default port if none is configured.
+func (c *sftpConfig) address() string {
+	if _, _, err := net.SplitHostPort(c.Host); err == nil {
+		return c.Host
+	}
+
+	return net.JoinHostPort(c.Host, sftpPort)
+}
+
+// open connects to the SFTP server. The connection is closed when the provided context is
+// cancelled.
+func (c *sftpConfig) open(ctx context.Context) (storage.Storage, error) {
+	key, err := os.ReadFile(c.Key)
+	if err != nil {
+		return nil, fmt.Errorf("reading sftp key: %w", err)
+	}
+
+	signer, err := ssh.ParsePrivateKey(key)
+	if err != nil {
+		return nil, fmt.Errorf("parsing sftp key %s: %w", c.Key, err)
+	}
+
+	hostKeys, err := knownhosts.New(c.KnownHosts)
+	if err != nil {
+		return nil, fmt.Errorf("reading known hosts: %w", err)
+	}
+
+	dialer := net.Dialer{Timeout: sftpDialTimeout}
+	conn, err := dialer.DialContext(ctx, "tcp", c.address())
+	if err != nil {
+		return nil, fmt.Errorf("connecting to sftp server: %w", err)
+	}
+
+	sshConn, chans, reqs, err := ssh.NewClientConn(conn, c.address(), &ssh.ClientConfig{
+		User:            c.User,
+		Auth:            []ssh.AuthMethod{ssh.PublicKeys(signer)},
+		HostKeyCallback: hostKeys,
+		Timeout:         sftpDialTimeout,
+	})
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("connecting to sftp server: %w", err)
+	}
+	sshClient := ssh.NewClient(sshConn, chans, reqs)
+
+	client, err := sftp.NewClient(sshClient)
+	if err != nil {
+		sshClient.Close()
+		return nil, fmt.Errorf("starting sftp session: %w", err)
+	}
+
+	// SFTP requests are not cancellable, interrupt them by closing the connection.
+	stop := context.AfterFunc(ctx, func() { sshClient.Close() })
+
+	return &sftpStore{ssh: sshClient, client: client, root: c.Path, stop: stop}, nil
+}
+
+// sftpStore is an archive store in a directory of an SFTP server.
+type sftpStore struct {
+	ssh    *ssh.Client
+	client *sftp.Client
+	root   string
+	stop   func() bool
+}
+
+// path returns the remote path of the provided key.
+func (s *sftpStore) path(key string) string {
+	return path.Join(s.root, key)
+}
+
+// write writes the provided reader to the provided key. The file is written under a
+// temporary name renamed once complete, so partial uploads never look like archives.
+func (s *sftpStore) write(key string, r io.Reader) (int64, error) {
+	target := s.path(key)
+	err := s.client.MkdirAll(path.Dir(target))
+	if err != nil {
+		return 0, err
+	}
+
+	tmp := target + ".part"
+	f, err := s.client.Create(tmp)
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := f.ReadFrom(r)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		s.client.Remove(tmp)
+		return n, err
+	}
+
+	// Servers without the posix rename extension refuse to rename over existing files.
+	err = s.client.PosixRename(tmp, target)
+	if err != nil {
+		s.client.Remove(target)
+		err = s.client.Rename(tmp, target)
+	}
+	if err != nil {
+		s.client.Remove(tmp)
+		return n, err
+	}
+
+	return n, nil
+}
+
+// PutFile uploads the file at the provided path as the provided key.
+func (s *sftpStore) PutFile(_ context.Context, key string, localPath string) (int64, error) {
+	f, err := os.Open(localPath)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	return s.write(key, f)
+}
+
+// Put uploads the provided data as the provided key.
+func (s *sftpStore) Put(_ context.Context, key string, data []byte) error {
+	_, err := s.write(key, bytes.NewReader(data))
+	return err
+}
+
+// Get opens the stored file with the provided key.
+func (s *sftpStore) Get(_ context.Context, key string) (io.ReadCloser, error) {
+	f, err := s.client.Open(s.path(key))
+	if err != nil {
+		return nil, sftpError(err)
+	}
+
+	return f, nil
+}
+
+// Stat returns the size of the stored file with the provided key.
+func (s *sftpStore) Stat(_ context.Context, key string) (int64, error) {
+	info, err := s.client.Stat(s.path(key))
+	if err != nil {
+		return 0, sftpError(err)
+	}
+
+	return info.Size(), nil
+}
+
+// List returns the files stored directly under the provided prefix. A missing directory
+// holds no files.
+func (s *sftpStore) List(ctx context.Context, prefix string) ([]storage.Object, error) {
+	entries, err := s.client.ReadDirContext(ctx, s.path(prefix))
+	if err != nil {
+		if errors.Is(sftpError(err), fs.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var files []storage.Object
+	for _, entry := range entries {
+		if !entry.Mode().IsRegular() {
+			continue
+		}
+
+		files = append(files, storage.Object{
+			Key:      prefix + entry.Name(),
+			Size:     entry.Size(),
+			Modified: entry.ModTime(),
+		})
+	}
+
+	return files, nil
+}
+
+// Remove removes the stored file with the provided key, if any.
+func (s *sftpStore) Remove(_ context.Context, key string) error {
+	err := s.client.Remove(s.path(key))
+	if err != nil && !errors.Is(sftpError(err), fs.ErrNotExist) {
+		return err
+	}
+
+	return nil
+}
+
+// Presign returns storage.ErrNoLinks, SFTP servers have no download links.
+func (s *sftpStore) Presign(context.Context, string, time.Duration) (string, error) {
+	return "", storage.ErrNoLinks
+}
+
+// Check ensures the directory can be listed. A missing directory is created by the first
+// upload.
+func (s *sftpStore) Check(ctx context.Context) error {
+	_, err := s.List(ctx, "")
+	return err
+}
+
+// Close closes the connection to the server.
+func (s *sftpStore) Close() error {
+	s.stop()
+	s.client.Close()
+	return s.ssh.Close()
+}
+
+// sftpError maps the missing file status of SFTP servers to fs.ErrNotExist.
+func sftpError(err error) error {
+	var status *sftp.StatusError
+	if errors.As(err, &status) && status.FxCode() == sftp.ErrSSHFxNoSuchFile {
+		return fmt.Errorf("%w: %w", fs.ErrNotExist, err)
+	}
+
+	return err
+}
+
+// defaultKnownHosts returns the path of the user's known hosts file.
+func defaultKnownHosts() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+
+	return filepath.Join(home, ".ssh", "known_hosts")
+}
@@ -0,0 +1,205 @@
+package archiver
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/peterldowns/testy/assert"
+	"github.com/pkg/sftp"
+	"github.com/rs/zerolog"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// fakeSFTP is an in-process SFTP server accepting a single user key.
+type fakeSFTP struct {
+	addr    string
+	hostKey ssh.PublicKey
+	userKey string
+}
+
+// newFakeSFTP starts an SFTP server for the duration of the test. The private key of its
+// user is written to a temporary file.
+func newFakeSFTP(t *testing.T) *fakeSFTP {
+	_, hostPriv, err := ed25519.GenerateKey(rand.Reader)
+	assert.NoError(t, err)
+	hostSigner, err := ssh.NewSignerFromKey(hostPriv)
+	assert.NoError(t, err)
+
+	userPub, userPriv, err := ed25519.GenerateKey(rand.Reader)
+	assert.NoError(t, err)
+	authorized, err := ssh.NewPublicKey(userPub)
+	assert.NoError(t, err)
+
+	block, err := ssh.MarshalPrivateKey(userPriv, "")
+	assert.NoError(t, err)
+	userKey := filepath.Join(t.TempDir(), "id_ed25519")
+	assert.NoError(t, os.WriteFile(userKey, pem.EncodeToMemory(block), 0600))
+
+	serverCfg := &ssh.ServerConfig{
+		PublicKeyCallback: func(conn ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			if conn.User() == "backup" && string(key.Marshal()) == string(authorized.Marshal()) {
+				return nil, nil
+			}
+			return nil, errors.New("unauthorized key")
+		},
+	}
+	serverCfg.AddHostKey(hostSigner)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	t.Cleanup(func() { ln.Close() })
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go serveSFTP(conn, serverCfg)
+		}
+	}()
+
+	return &fakeSFTP{addr: ln.Addr().String(), hostKey: hostSigner.PublicKey(), userKey: userKey}
+}
+
+// serveSFTP serves the sftp subsystem on the provided connection.
+func serveSFTP(conn net.Conn, cfg *ssh.ServerConfig) {
+	_, chans, reqs, err := ssh.NewServerConn(conn, cfg)
+	if err != nil {
+		conn.Close()
+		return
+	}
+	go ssh.DiscardRequests(reqs)
+
+	for newChan := range chans {
+		if newChan.ChannelType() != "session" {
+			newChan.Reject(ssh.UnknownChannelType, "unknown channel type")
+			continue
+		}
+
+		channel, requests, err := newChan.Accept()
+		if err != nil {
+			continue
+		}
+
+		go func() {
+			for req := range requests {
+				ok := req.Type == "subsystem" && string(req.Payload[4:]) == "sftp"
+				req.Reply(ok, nil)
+				if !ok {
+					continue
+				}
+
+				server, err := sftp.NewServer(channel)
+				if err != nil {
+					channel.Close()
+					return
+				}
+				server.Serve()
+				server.Close()
+				return
+			}
+		}()
+	}
+}
+
+// config returns a configuration storing archives in the provided directory of the server,
+// trusting its host key.
+func (f *fakeSFTP) config(t *testing.T, dir string) *Config {
+	knownHosts := filepath.Join(t.TempDir(), "known_hosts")
+	line := knownhosts.Line([]string{knownhosts.Normalize(f.addr)}, f.hostKey)
+	assert.NoError(t, os.WriteFile(knownHosts, []byte(line+"\n"), 0600))
+
+	return &Config{
+		Backend:        backendSFTP,
+		SFTPHost:       f.addr,
+		SFTPUser:       "backup",
+		SFTPKey:        f.userKey,
+		SFTPKnownHosts: knownHosts,
+		SFTPPath:       dir,
+	}
+}
+
+func TestSFTPStore(t *testing.T) {
+	server := newFakeSFTP(t)
+	remoteDir := filepath.Join(t.TempDir(), "upload")
+	cfg := server.config(t, remoteDir).s3Config(jobConfig{Name: "db", Prefix: "backups"}, nil)
+	ctx := context.Background()
+	logger := zerolog.Nop()
+
+	// Ensure archives are uploaded under the job's prefix and the zip file is removed.
+	for _, name := range []string{"dump-20260101235000.zip", "dump-20260102235000.zip"} {
+		zipPath := filepath.Join(t.TempDir(), name)
+		assert.NoError(t, os.WriteFile(zipPath, zipBytes(t, map[string]string{"users.sql": name}), 0600))
+
+		info, err := uploadZip(ctx, zipPath, cfg, &logger)
+		assert.NoError(t, err)
+		assert.Equal(t, "backups/"+name, info.Key)
+		_, err = os.Stat(zipPath)
+		assert.True(t, os.IsNotExist(err))
+		_, err = os.Stat(filepath.Join(remoteDir, "backups", name+".part"))
+		assert.True(t, os.IsNotExist(err))
+	}
+
+	// Ensure manifests are stored next to their archive and not listed as archives.
+	err := writeManifest(ctx, cfg, &archiveManifest{Key: "backups/dump-20260102235000.zip"})
+	assert.NoError(t, err)
+	_, err = os.Stat(filepath.Join(remoteDir, manifestKey("backups/dump-20260102235000.zip")))
+	assert.NoError(t, err)
+
+	archives, err := listArchives(ctx, cfg)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(archives))
+	assert.Equal(t, "backups/dump-20260102235000.zip", archives[0].Key)
+
+	// Ensure the newest archive is restored by default.
+	target := t.TempDir()
+	result, err := restoreArchive(ctx, cfg, "", target)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, result.Files)
+	data, err := os.ReadFile(filepath.Join(target, "users.sql"))
+	assert.NoError(t, err)
+	assert.Equal(t, "dump-20260102235000.zip", string(data))
+
+	// Ensure pruning keeps the newest archives.
+	pruned, err := pruneArchives(ctx, cfg, time.Now().Add(time.Hour), 1, false)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(pruned))
+	assert.Equal(t, "backups/dump-20260101235000.zip", pruned[0].Key)
+	_, err = os.Stat(filepath.Join(remoteDir, "backups", "dump-20260101235000.zip"))
+	assert.True(t, os.IsNotExist(err))
+
+	assert.NoError(t, checkBucket(ctx, cfg))
+
+	// Ensure listing a missing directory finds no archives.
+	empty := server.config(t, filepath.Join(t.TempDir(), "missing")).s3Config(jobConfig{Name: "db"}, nil)
+	archives, err = listArchives(ctx, empty)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, len(archives))
+}
+
+func TestSFTPHostKey(t *testing.T) {
+	server := newFakeSFTP(t)
+	cfg := server.config(t, t.TempDir())
+	ctx := context.Background()
+
+	// Ensure servers with unknown host keys are rejected.
+	other := newFakeSFTP(t)
+	cfg.SFTPHost = other.addr
+	assert.Error(t, checkBucket(ctx, cfg.s3Config(jobConfig{Name: "db"}, nil)))
+
+	// Ensure servers with changed host keys are rejected.
+	cfg.SFTPHost = server.addr
+	line := knownhosts.Line([]string{knownhosts.Normalize(server.addr)}, other.hostKey)
+	assert.NoError(t, os.WriteFile(cfg.SFTPKnownHosts, []byte(line+"\n"), 0600))
+	assert.Error(t, checkBucket(ctx, cfg.s3Config(jobConfig{Name: "db"}, nil)))
+}
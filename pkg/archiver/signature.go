@@ -0,0 +1,50 @@
+package archiver
+
+import (
+	"fmt"
+
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+// Request signatures.
+const (
+	// signatureV2 signs requests with AWS Signature Version 2, for legacy S3-compatibles
+	// rejecting version 4 signatures.
+	signatureV2 = "v2"
+	// signatureV4 signs requests with AWS Signature Version 4.
+	signatureV4 = "v4"
+)
+
+// validateSignature validates the provided request signature.
+func validateSignature(signature string) error {
+	switch signature {
+	case "", signatureV2, signatureV4:
+		return nil
+
+	default:
+		return fmt.Errorf("invalid request signature %q, expected %s or %s", signature, signatureV2, signatureV4)
+	}
+}
+
+// signerProvider is a credentials provider signing requests with the credentials of the
+// provider it wraps using a fixed signature version.
+type signerProvider struct {
+	credentials.Provider
+	signer credentials.SignatureType
+}
+
+// RetrieveWithCredContext retrieves the wrapped provider's credentials with the provider's
+// signature version.
+func (p *signerProvider) RetrieveWithCredContext(cc *credentials.CredContext) (credentials.Value, error) {
+	value, err := p.Provider.RetrieveWithCredContext(cc)
+	value.SignerType = p.signer
+	return value, err
+}
+
+// Retrieve retrieves the wrapped provider's credentials with the provider's signature
+// version.
+func (p *signerProvider) Retrieve() (credentials.Value, error) {
+	value, err := p.Provider.Retrieve()
+	value.SignerType = p.signer
+	return value, err
+}
@@ -0,0 +1,44 @@
+package archiver
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/minio/minio-go/v7/pkg/credentials"
+	"github.com/peterldowns/testy/assert"
+	"github.com/rs/zerolog"
+)
+
+func TestSignature(t *testing.T) {
+	fake := newFakeS3(t, "test-bucket")
+	logger := zerolog.Nop()
+
+	// Ensure requests are signed with version 4 signatures by default.
+	cfg := &Config{AccessKeyID: "test-accesskeyid", SecretAccessKey: "test-secretaccesskey", staticCreds: true}
+	s3Cfg := fake.s3Config("test-bucket")
+	s3Cfg.Options.Creds = cfg.credentials(&logger)
+	putArchives(t, s3Cfg, map[string][]byte{"v4.zip": []byte("archive")})
+	auth := fake.object("test-bucket", "v4.zip").header.Get("Authorization")
+	assert.True(t, strings.HasPrefix(auth, "AWS4-HMAC-SHA256 "))
+
+	// Ensure requests are signed with version 2 signatures when configured.
+	cfg.Signature = signatureV2
+	s3Cfg.Options.Creds = cfg.credentials(&logger)
+	putArchives(t, s3Cfg, map[string][]byte{"v2.zip": []byte("archive")})
+	auth = fake.object("test-bucket", "v2.zip").header.Get("Authorization")
+	assert.True(t, strings.HasPrefix(auth, "AWS test-accesskeyid:"))
+
+	// Ensure reloaded access keys keep the configured signature version.
+	t.Setenv("accesskeyid", "")
+	t.Setenv("secretaccesskey", "")
+	envPath := filepath.Join(t.TempDir(), ".env")
+	err := os.WriteFile(envPath, []byte("accesskeyid=test-accesskeyid\nsecretaccesskey=test-secretaccesskey\n"), 0600)
+	assert.NoError(t, err)
+	cfg = &Config{Signature: signatureV2, envPath: envPath}
+	value, err := cfg.credentials(&logger).GetWithContext(&credentials.CredContext{})
+	assert.NoError(t, err)
+	assert.Equal(t, credentials.SignatureV2, value.SignerType)
+	assert.Equal(t, "test-accesskeyid", value.AccessKeyID)
+}
@@ -0,0 +1,198 @@
+package archiver
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// slotSettle is how long runs wait for a run slot before the first one is handed out, so
+// runs triggered at the same time queue up and the slot goes to the highest priority one.
+const slotSettle = 100 * time.Millisecond
+
+// maxJobs returns the number of jobs running at a time, zero if it is not limited.
+func (c *Config) maxJobs() int {
+	jobs, err := strconv.Atoi(c.MaxJobs)
+	if err != nil || jobs < 0 {
+		return 0
+	}
+
+	return jobs
+}
+
+// slotWaiter is a run waiting for a run slot.
+type slotWaiter struct {
+	priority int
+	seq      uint64
+	ready    chan struct{}
+}
+
+// runSlots limits the number of jobs running at a time. Runs waiting for a slot are handed
+// one by priority, highest first, and in order of arrival among equal priorities.
+type runSlots struct {
+	mtx     sync.Mutex
+	limit   int
+	running int
+	seq     uint64
+	queue   []*slotWaiter
+}
+
+// jobSlots holds the run slots of the archive jobs.
+var jobSlots = &runSlots{}
+
+// setMaxJobs sets the number of jobs running at a time, zero for no limit. Raising the
+// limit hands the new slots to waiting runs, lowering it lets running jobs complete.
+func setMaxJobs(limit int) {
+	jobSlots.mtx.Lock()
+	defer jobSlots.mtx.Unlock()
+
+	jobSlots.limit = limit
+	jobSlots.dispatch()
+}
+
+// acquire waits for a run slot for a run with the provided priority, or for the provided
+// context to be done. The returned function releases the slot.
+func (s *runSlots) acquire(ctx context.Context, priority int, logger *zerolog.Logger) (func(), error) {
+	s.mtx.Lock()
+	if s.limit == 0 {
+		s.running++
+		s.mtx.Unlock()
+		return s.release, nil
+	}
+
+	s.seq++
+	waiter := &slotWaiter{priority: priority, seq: s.seq, ready: make(chan struct{})}
+	i, _ := slices.BinarySearchFunc(s.queue, waiter, func(a, b *slotWaiter) int {
+		return cmp.Or(cmp.Compare(b.priority, a.priority), cmp.Compare(a.seq, b.seq))
+	})
+	s.queue = slices.Insert(s.queue, i, waiter)
+	s.mtx.Unlock()
+
+	timer := time.NewTimer(slotSettle)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return nil, s.abandon(waiter, ctx.Err())
+	case <-timer.C:
+	}
+
+	s.mtx.Lock()
+	s.dispatch()
+	s.mtx.Unlock()
+
+	select {
+	case <-waiter.ready:
+		return s.release, nil
+	default:
+		logger.Info().Int("priority", priority).Msg("Job limit reached, waiting for a running job")
+	}
+
+	select {
+	case <-ctx.Done():
+		return nil, s.abandon(waiter, ctx.Err())
+	case <-waiter.ready:
+		return s.release, nil
+	}
+}
+
+// abandon removes the provided waiter from the queue and returns the provided error. A slot
+// handed to it meanwhile is released.
+func (s *runSlots) abandon(waiter *slotWaiter, err error) error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	i := slices.Index(s.queue, waiter)
+	if i >= 0 {
+		s.queue = slices.Delete(s.queue, i, i+1)
+		return err
+	}
+
+	s.running--
+	s.dispatch()
+	return err
+}
+
+// release releases a run slot, handing it to the next waiting run.
+func (s *runSlots) release() {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	s.running--
+	s.dispatch()
+}
+
+// dispatch hands the free run slots to the waiting runs, highest priority first. It must be
+// called with the mutex held.
+func (s *runSlots) dispatch() {
+	for len(s.queue) > 0 && (s.limit == 0 || s.running < s.limit) {
+		waiter := s.queue[0]
+		s.queue = s.queue[1:]
+		s.running++
+		close(waiter.ready)
+	}
+}
+
+// runningJobs tracks the jobs with a run in progress. Reloads replace the scheduled jobs while
+// their runs continue, the replacements must not start runs overlapping them.
+type runningJobs struct {
+	mtx  sync.Mutex
+	jobs map[string]bool
+}
+
+// activeRuns holds the archive jobs with a run in progress.
+var activeRuns = &runningJobs{jobs: make(map[string]bool)}
+
+// start marks the provided job as running. It returns false if it is running already, the
+// returned function marks the run as done.
+func (r *runningJobs) start(job string) (func(), bool) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	if r.jobs[job] {
+		return nil, false
+	}
+	r.jobs[job] = true
+
+	return func() {
+		r.mtx.Lock()
+		defer r.mtx.Unlock()
+
+		delete(r.jobs, job)
+	}, true
+}
+
+// errRunInProgress is returned when a job is triggered while its previous run is still in
+// progress.
+var errRunInProgress = errors.New("the previous run is still in progress")
+
+// runArchive archives the provided job once it gets a run slot, see archive. Triggers of a
+// job whose previous run is still in progress are skipped, errRunInProgress is returned.
+func runArchive(ctx context.Context, job jobConfig, cfg *s3Config, reporters []runReporter, logger *zerolog.Logger) error {
+	done, ok := activeRuns.start(job.Name)
+	if !ok {
+		logger.Info().Msg("Skipping run, the previous run is still in progress")
+		return errRunInProgress
+	}
+	defer done()
+
+	release, err := jobSlots.acquire(ctx, job.Priority, logger)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	// Runs stop once the distributed lock of the job is lost.
+	ctx, cancel := heldLocks.runContext(ctx, job.Name)
+	defer cancel()
+
+	archive(ctx, job, cfg, reporters, logger)
+
+	return nil
+}
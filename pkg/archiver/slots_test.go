@@ -0,0 +1,69 @@
+package archiver
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/peterldowns/testy/assert"
+	"github.com/rs/zerolog"
+)
+
+func TestRunSlots(t *testing.T) {
+	logger := zerolog.Nop()
+	slots := &runSlots{limit: 1}
+	queued := func() int {
+		slots.mtx.Lock()
+		defer slots.mtx.Unlock()
+		return len(slots.queue)
+	}
+
+	// Ensure waiting runs get the slot by priority, in order of arrival among equals.
+	release, err := slots.acquire(context.Background(), 0, &logger)
+	assert.NoError(t, err)
+
+	var mtx sync.Mutex
+	var order []string
+	var wg sync.WaitGroup
+	for i, run := range []struct {
+		name     string
+		priority int
+	}{{"low", 0}, {"critical", 10}, {"normal", 5}, {"normal-later", 5}} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			release, err := slots.acquire(context.Background(), run.priority, &logger)
+			assert.NoError(t, err)
+			mtx.Lock()
+			order = append(order, run.name)
+			mtx.Unlock()
+			release()
+		}()
+		for queued() <= i {
+			time.Sleep(time.Millisecond)
+		}
+	}
+	release()
+	wg.Wait()
+	assert.Equal(t, []string{"critical", "normal", "normal-later", "low"}, order)
+
+	// Ensure runs stop waiting when their context is done, leaving the queue.
+	release, err = slots.acquire(context.Background(), 0, &logger)
+	assert.NoError(t, err)
+	ctx, cancel := context.WithTimeout(context.Background(), 2*slotSettle)
+	defer cancel()
+	_, err = slots.acquire(ctx, 10, &logger)
+	assert.Error(t, err)
+	assert.Equal(t, 0, queued())
+	release()
+	assert.Equal(t, 0, slots.running)
+
+	// Ensure runs are not limited without a limit.
+	slots = &runSlots{}
+	for range 3 {
+		_, err := slots.acquire(context.Background(), 0, &logger)
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, 3, slots.running)
+}
@@ -0,0 +1,190 @@
+package archiver
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// Snapshot modes.
+const (
+	// snapshotLink hard links the files to archive into the snapshot, copying them where
+	// links are unsupported, e.g. across filesystems.
+	snapshotLink = "link"
+	// snapshotCopy copies the files to archive into the snapshot.
+	snapshotCopy = "copy"
+)
+
+// validateSnapshot validates the provided snapshot mode.
+func validateSnapshot(mode string) error {
+	switch mode {
+	case "", snapshotLink, snapshotCopy:
+		return nil
+
+	default:
+		return fmt.Errorf("invalid snapshot mode %q, expected %s or %s", mode, snapshotLink, snapshotCopy)
+	}
+}
+
+// snapshotDir captures the files of the provided directory modified since the provided time
+// in a new snapshot directory, within the job's snapshot directory or the system temporary
+// directory, in a single pass. Archives are zipped from the snapshot, so files modified during
+// the long compression phase do not yield torn archives. It returns the path of the snapshot,
+// which the caller removes once zipped.
+func (j *jobConfig) snapshotDir(ctx context.Context, dir string, since time.Time, logger *zerolog.Logger) (string, error) {
+	realDir, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return "", err
+	}
+
+	root, err := os.MkdirTemp(j.SnapshotDir, "zdts3-snapshot-*")
+	if err != nil {
+		return "", err
+	}
+
+	// Directories get their modification time back once their files are captured.
+	type snapshotted struct {
+		path    string
+		modTime time.Time
+	}
+	var dirs []snapshotted
+	var files int
+	err = filepath.WalkDir(realDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(realDir, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(root, rel)
+
+		switch {
+		case rel == ".":
+			return nil
+
+		// Skip the snapshot itself when it is kept in the source directory.
+		case path == root:
+			return filepath.SkipDir
+
+		case isStagedArchive(filepath.ToSlash(rel)):
+			return nil
+
+		case d.Type()&fs.ModeSymlink != 0:
+			return j.snapshotSymlink(path, target)
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case d.IsDir():
+			dirs = append(dirs, snapshotted{path: target, modTime: info.ModTime()})
+			return os.Mkdir(target, info.Mode().Perm()|0700)
+
+		case !info.Mode().IsRegular():
+			return nil
+
+		// SQLite databases are captured from a consistent copy, which includes their journal
+		// files.
+		case j.SQLite && isSQLiteJournal(path):
+			return nil
+
+		case j.SQLite && isSQLite(path, nil):
+			modTime := sqliteModTime(path, info)
+			if modTime.Before(since) {
+				return nil
+			}
+			err := backupSQLite(ctx, path, target)
+			if err != nil {
+				return fmt.Errorf("backing up SQLite database %s: %w", path, err)
+			}
+			files++
+			return os.Chtimes(target, modTime, modTime)
+
+		case info.ModTime().Before(since):
+			return nil
+		}
+
+		files++
+		return snapshotFile(path, target, info, j.Snapshot == snapshotLink)
+	})
+	if err != nil {
+		os.RemoveAll(root)
+		return "", err
+	}
+
+	for _, dir := range slices.Backward(dirs) {
+		err := os.Chtimes(dir.path, dir.modTime, dir.modTime)
+		if err != nil {
+			os.RemoveAll(root)
+			return "", err
+		}
+	}
+
+	logger.Debug().Str("path", root).Int("files", files).Msg("Captured snapshot")
+	return root, nil
+}
+
+// snapshotSymlink recreates the symbolic link at the provided path at the provided target
+// path in a snapshot. Relative links followed by the job's symlink policy are made absolute,
+// they still point to the same file from within the snapshot.
+func (j *jobConfig) snapshotSymlink(path string, target string) error {
+	if j.Symlinks == symlinksSkip {
+		return nil
+	}
+
+	link, err := os.Readlink(path)
+	if err != nil {
+		return err
+	}
+	if j.Symlinks != symlinksPreserve && !filepath.IsAbs(link) {
+		link = filepath.Join(filepath.Dir(path), link)
+	}
+
+	return os.Symlink(link, target)
+}
+
+// snapshotFile captures the file at the provided path with the provided file information at
+// the provided target path in a snapshot, hard linking it if requested and possible and
+// copying it otherwise. Copies keep the file's modification time.
+func snapshotFile(path string, target string, info os.FileInfo, link bool) error {
+	if link && os.Link(path, target) == nil {
+		return nil
+	}
+
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_EXCL, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	_, err = copyBuffers().copy(dst, src)
+	if err != nil {
+		dst.Close()
+		return err
+	}
+
+	err = dst.Close()
+	if err != nil {
+		return err
+	}
+
+	return os.Chtimes(target, info.ModTime(), info.ModTime())
+}
@@ -0,0 +1,85 @@
+package archiver
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/peterldowns/testy/assert"
+	"github.com/rs/zerolog"
+)
+
+func TestSnapshotDir(t *testing.T) {
+	dir := t.TempDir()
+	logger := zerolog.Nop()
+	old := time.Now().Add(-48 * time.Hour)
+	assert.NoError(t, os.MkdirAll(filepath.Join(dir, "logs"), 0755))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "users.sql"), []byte("users"), 0644))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "logs", "app.log"), []byte("log"), 0644))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "orders.sql"), []byte("orders"), 0644))
+	assert.NoError(t, os.Chtimes(filepath.Join(dir, "orders.sql"), old, old))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "dump-20260101235000.zip"), []byte("zip"), 0644))
+	assert.NoError(t, os.Symlink("users.sql", filepath.Join(dir, "current.sql")))
+
+	for _, mode := range []string{snapshotLink, snapshotCopy} {
+		job := jobConfig{Name: "db", Snapshot: mode, SnapshotDir: t.TempDir()}
+
+		// Ensure the files modified since the provided time are captured, staged archives
+		// left out.
+		snapshot, err := job.snapshotDir(context.Background(), dir, time.Now().Add(-time.Hour), &logger)
+		assert.NoError(t, err)
+		assert.Equal(t, job.SnapshotDir, filepath.Dir(snapshot))
+
+		data, err := os.ReadFile(filepath.Join(snapshot, "users.sql"))
+		assert.NoError(t, err)
+		assert.Equal(t, "users", string(data))
+		data, err = os.ReadFile(filepath.Join(snapshot, "logs", "app.log"))
+		assert.NoError(t, err)
+		assert.Equal(t, "log", string(data))
+		_, err = os.Stat(filepath.Join(snapshot, "orders.sql"))
+		assert.True(t, os.IsNotExist(err))
+		_, err = os.Stat(filepath.Join(snapshot, "dump-20260101235000.zip"))
+		assert.True(t, os.IsNotExist(err))
+
+		// Ensure followed relative symlinks still point to their file.
+		data, err = os.ReadFile(filepath.Join(snapshot, "current.sql"))
+		assert.NoError(t, err)
+		assert.Equal(t, "users", string(data))
+
+		// Ensure copies keep the modification time of their file.
+		source, err := os.Stat(filepath.Join(dir, "users.sql"))
+		assert.NoError(t, err)
+		captured, err := os.Stat(filepath.Join(snapshot, "users.sql"))
+		assert.NoError(t, err)
+		assert.True(t, captured.ModTime().Equal(source.ModTime()))
+		assert.Equal(t, mode == snapshotLink, os.SameFile(source, captured))
+	}
+}
+
+func TestArchiveSnapshot(t *testing.T) {
+	dir := t.TempDir()
+	snapshots := t.TempDir()
+	logger := zerolog.Nop()
+	tracker := newStatusTracker()
+	fake := newFakeS3(t, "test-bucket")
+	s3Cfg := fake.s3Config("test-bucket")
+	job := jobConfig{Name: "db", SourceDir: dir, Retention: "720h", Snapshot: snapshotCopy, SnapshotDir: snapshots}
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "users.sql"), []byte("users"), 0644))
+
+	// Ensure archives are zipped from the snapshot, which is removed once zipped.
+	archive(context.Background(), job, s3Cfg, []runReporter{tracker}, &logger)
+	result := tracker.runs["db"]
+	assert.NoError(t, result.Err)
+	assert.Equal(t, 1, result.Files)
+	assert.Equal(t, "users.sql", result.Contents[0].Path)
+
+	entries, err := os.ReadDir(snapshots)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, len(entries))
+
+	archives, err := listArchives(context.Background(), s3Cfg)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(archives))
+}
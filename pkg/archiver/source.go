@@ -0,0 +1,46 @@
+package archiver
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// errSourceMissing indicates the source directory of a job does not hold the files to
+// archive, e.g. because its network mount is down.
+var errSourceMissing = errors.New("source directory not available")
+
+// validateSentinel validates the provided sentinel file name, which must be a path within
+// the source directory.
+func validateSentinel(sentinel string) error {
+	if sentinel != "" && !filepath.IsLocal(sentinel) {
+		return fmt.Errorf("invalid sentinel %q, expected a path within the source directory", sentinel)
+	}
+
+	return nil
+}
+
+// checkSource ensures the provided source directory of the job is mounted and holds its
+// sentinel file, as configured. Runs on an empty mount point whose filesystem is down would
+// otherwise purge nothing and upload an empty archive as if everything was fine.
+func (j *jobConfig) checkSource(dir string) error {
+	if j.RequireMount {
+		mounted, err := isMountPoint(dir)
+		if err != nil {
+			return fmt.Errorf("%w: checking mount point %s: %w", errSourceMissing, dir, err)
+		}
+		if !mounted {
+			return fmt.Errorf("%w: %s is not a mount point", errSourceMissing, dir)
+		}
+	}
+
+	if j.Sentinel != "" {
+		_, err := os.Stat(filepath.Join(dir, j.Sentinel))
+		if err != nil {
+			return fmt.Errorf("%w: sentinel file: %w", errSourceMissing, err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,14 @@
+//go:build !unix
+
+package archiver
+
+import (
+	"errors"
+	"fmt"
+)
+
+// isMountPoint returns whether the provided directory is the root of a mounted filesystem.
+// Mount points are not detected on this platform, use a sentinel file instead.
+func isMountPoint(string) (bool, error) {
+	return false, fmt.Errorf("mount points %w on this platform", errors.ErrUnsupported)
+}
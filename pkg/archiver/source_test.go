@@ -0,0 +1,62 @@
+package archiver
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/peterldowns/testy/assert"
+	"github.com/rs/zerolog"
+)
+
+func TestCheckSource(t *testing.T) {
+	dir := t.TempDir()
+	logger := zerolog.Nop()
+	tracker := newStatusTracker()
+	fake := newFakeS3(t, "test-bucket")
+	s3Cfg := fake.s3Config("test-bucket")
+	job := jobConfig{Name: "db", SourceDir: dir, Retention: "720h", Sentinel: ".mounted"}
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "db.sql"), []byte("dump"), 0644))
+
+	// Ensure runs fail without touching the directory when its sentinel file is missing.
+	archive(context.Background(), job, s3Cfg, []runReporter{tracker}, &logger)
+	result := tracker.runs["db"]
+	assert.True(t, errors.Is(result.Err, errSourceMissing))
+	assert.Equal(t, "source", result.Errors[0].Stage)
+
+	archives, err := listArchives(context.Background(), s3Cfg)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, len(archives))
+
+	// Ensure runs proceed once the sentinel file exists.
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, ".mounted"), nil, 0644))
+	archive(context.Background(), job, s3Cfg, []runReporter{tracker}, &logger)
+	assert.NoError(t, tracker.runs["db"].Err)
+
+	// Ensure subdirectory runs check the source directory once, not every subdirectory.
+	assert.NoError(t, os.Mkdir(filepath.Join(dir, "acme"), 0755))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "acme", "db.sql"), []byte("dump"), 0644))
+	subJob := job
+	subJob.Subdirs = true
+	archive(context.Background(), subJob, s3Cfg, []runReporter{tracker}, &logger)
+	assert.NoError(t, tracker.runs["db/acme"].Err)
+
+	// Ensure directories which are not mount points are rejected when mounts are required.
+	if runtime.GOOS != "windows" {
+		mounted, err := isMountPoint("/")
+		assert.NoError(t, err)
+		assert.True(t, mounted)
+
+		job.RequireMount = true
+		archive(context.Background(), job, s3Cfg, []runReporter{tracker}, &logger)
+		assert.True(t, errors.Is(tracker.runs["db"].Err, errSourceMissing))
+	}
+
+	// Ensure sentinels outside the source directory are rejected.
+	assert.NoError(t, validateSentinel(".mounted"))
+	assert.Error(t, validateSentinel("../.mounted"))
+	assert.Error(t, validateSentinel("/mnt/.mounted"))
+}
@@ -0,0 +1,36 @@
+//go:build unix
+
+package archiver
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// isMountPoint returns whether the provided directory is the root of a mounted filesystem,
+// on another device than its parent directory.
+func isMountPoint(dir string) (bool, error) {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return false, err
+	}
+	if !info.IsDir() {
+		return false, fmt.Errorf("%s is not a directory", dir)
+	}
+
+	parent, err := os.Stat(filepath.Join(dir, ".."))
+	if err != nil {
+		return false, err
+	}
+
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	parentStat, parentOK := parent.Sys().(*syscall.Stat_t)
+	if !ok || !parentOK {
+		return false, fmt.Errorf("reading the device of %s", dir)
+	}
+
+	// The root directory is its own parent.
+	return stat.Dev != parentStat.Dev || stat.Ino == parentStat.Ino, nil
+}
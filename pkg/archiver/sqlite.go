@@ -0,0 +1,172 @@
+package archiver
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"modernc.org/sqlite"
+)
+
+// sqliteHeader is the header every SQLite database file starts with.
+const sqliteHeader = "SQLite format 3\x00"
+
+// sqliteJournals are the suffixes of the journal files SQLite keeps next to a database. They
+// are only consistent with the database while it is open, a copy of them is of no use.
+var sqliteJournals = []string{"-wal", "-shm", "-journal"}
+
+// sqliteFileInfo is the file information of a SQLite database, with the size of its
+// consistent copy and the latest modification time of the database and its write-ahead log.
+type sqliteFileInfo struct {
+	os.FileInfo
+	size    int64
+	modTime time.Time
+}
+
+// Size returns the size of the copy of the database.
+func (i sqliteFileInfo) Size() int64 {
+	return i.size
+}
+
+// ModTime returns the latest modification time of the database and its write-ahead log.
+func (i sqliteFileInfo) ModTime() time.Time {
+	return i.modTime
+}
+
+// isSQLite returns whether the file at the provided path is a SQLite database, judged from
+// its header. The content of the file is read from disk unless it is provided.
+func isSQLite(path string, data []byte) bool {
+	header := data
+	if data == nil {
+		file, err := os.Open(path)
+		if err != nil {
+			return false
+		}
+		defer file.Close()
+
+		header = make([]byte, len(sqliteHeader))
+		_, err = io.ReadFull(file, header)
+		if err != nil {
+			return false
+		}
+	}
+
+	return bytes.HasPrefix(header, []byte(sqliteHeader))
+}
+
+// isSQLiteJournal returns whether the file at the provided path is the journal of a SQLite
+// database next to it.
+func isSQLiteJournal(path string) bool {
+	for _, suffix := range sqliteJournals {
+		db, ok := strings.CutSuffix(path, suffix)
+		if ok && isSQLite(db, nil) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// sqliteURI returns the URI opening the SQLite database at the provided path read-only,
+// waiting for the locks of its writers.
+func sqliteURI(path string) string {
+	path = filepath.ToSlash(path)
+	if !strings.HasPrefix(path, "/") {
+		// Windows paths start with their volume, e.g. /C:/data.db.
+		path = "/" + path
+	}
+
+	uri := url.URL{Scheme: "file", Path: path, RawQuery: "mode=ro&_pragma=busy_timeout(5000)"}
+	return uri.String()
+}
+
+// sqliteModTime returns the modification time of the SQLite database at the provided path
+// with the provided file information. Databases in WAL mode are modified through their
+// write-ahead log, the latest modification time of both is returned.
+func sqliteModTime(path string, info os.FileInfo) time.Time {
+	modTime := info.ModTime()
+	wal, err := os.Stat(path + "-wal")
+	if err == nil && wal.ModTime().After(modTime) {
+		modTime = wal.ModTime()
+	}
+
+	return modTime
+}
+
+// backupSQLite copies the SQLite database at the provided path to the provided destination
+// with the SQLite online backup API. The copy is a consistent snapshot of the database,
+// including the transactions of its write-ahead log, even while it is being written to.
+func backupSQLite(ctx context.Context, path string, dst string) error {
+	db, err := sql.Open("sqlite", sqliteURI(path))
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	return conn.Raw(func(driverConn any) error {
+		backuper, ok := driverConn.(interface {
+			NewBackup(string) (*sqlite.Backup, error)
+		})
+		if !ok {
+			return errors.New("SQLite driver without backup support")
+		}
+
+		backup, err := backuper.NewBackup(dst)
+		if err != nil {
+			return err
+		}
+
+		_, err = backup.Step(-1)
+		return errors.Join(err, backup.Finish())
+	})
+}
+
+// addSQLite adds a consistent copy of the SQLite database at the provided path to the zip,
+// made with the SQLite online backup API. Copying a database being written to as any other
+// file yields a corrupt database.
+func (z *dirZipper) addSQLite(path string, name string, info os.FileInfo) error {
+	modTime := sqliteModTime(path, info)
+	if modTime.Before(z.opts.Since) {
+		return nil
+	}
+
+	tmp, err := os.CreateTemp("", "zdts3-sqlite-*.db")
+	if err != nil {
+		return err
+	}
+	tmp.Close()
+	defer os.Remove(tmp.Name())
+
+	err = backupSQLite(z.ctx, path, tmp.Name())
+	if err != nil {
+		return fmt.Errorf("backing up SQLite database %s: %w", path, err)
+	}
+
+	file, err := os.Open(tmp.Name())
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	copyInfo, err := file.Stat()
+	if err != nil {
+		return err
+	}
+
+	z.logger.Debug().Str("path", path).Int64("size", copyInfo.Size()).Msg("Zipping SQLite database backup")
+	return z.addEntry(path, name, sqliteFileInfo{FileInfo: info, size: copyInfo.Size(), modTime: modTime}, file)
+}
@@ -0,0 +1,76 @@
+package archiver
+
+import (
+	"archive/zip"
+	"context"
+	"database/sql"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/peterldowns/testy/assert"
+	"github.com/rs/zerolog"
+)
+
+func TestZipDirSQLite(t *testing.T) {
+	dir := t.TempDir()
+	logger := zerolog.Nop()
+	dbPath := filepath.Join(dir, "app.db")
+
+	// Keep a database in WAL mode open with uncheckpointed writes, like a live application.
+	db, err := sql.Open("sqlite", dbPath)
+	assert.NoError(t, err)
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+	_, err = db.Exec("PRAGMA journal_mode=WAL; PRAGMA wal_autocheckpoint=0")
+	assert.NoError(t, err)
+	_, err = db.Exec("CREATE TABLE users (name TEXT)")
+	assert.NoError(t, err)
+	for _, name := range []string{"ada", "grace", "linus"} {
+		_, err = db.Exec("INSERT INTO users (name) VALUES (?)", name)
+		assert.NoError(t, err)
+	}
+	_, err = os.Stat(dbPath + "-wal")
+	assert.NoError(t, err)
+	assert.True(t, isSQLiteJournal(dbPath+"-wal"))
+	assert.False(t, isSQLiteJournal(dbPath))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "notes-wal"), []byte("notes"), 0644))
+
+	zipPath := filepath.Join(t.TempDir(), "archive.zip")
+	files, err := zipDir(context.Background(), dir, zipPath, zipOptions{SQLite: true}, &logger)
+	assert.NoError(t, err)
+
+	// Ensure the journal files are left out, other files ending like them are not.
+	names := make(map[string]bool)
+	for _, file := range files {
+		names[file.Path] = true
+	}
+	assert.Equal(t, map[string]bool{"app.db": true, "notes-wal": true}, names)
+
+	// Ensure the archived database holds the transactions of the write-ahead log.
+	reader, err := zip.OpenReader(zipPath)
+	assert.NoError(t, err)
+	defer reader.Close()
+
+	restored := filepath.Join(t.TempDir(), "app.db")
+	for _, entry := range reader.File {
+		if entry.Name != "app.db" {
+			continue
+		}
+		src, err := entry.Open()
+		assert.NoError(t, err)
+		data, err := io.ReadAll(src)
+		src.Close()
+		assert.NoError(t, err)
+		assert.NoError(t, os.WriteFile(restored, data, 0644))
+	}
+
+	restoredDB, err := sql.Open("sqlite", restored)
+	assert.NoError(t, err)
+	defer restoredDB.Close()
+
+	var count int
+	assert.NoError(t, restoredDB.QueryRow("SELECT COUNT(*) FROM users").Scan(&count))
+	assert.Equal(t, 3, count)
+}
@@ -0,0 +1,246 @@
+package archiver
+
+import (
+	"archive/zip"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// Stale archive policies.
+const (
+	// staleKeep leaves stale archives in the source directory until retention purges them.
+	staleKeep = "keep"
+	// staleUpload uploads complete stale archives and removes incomplete ones.
+	staleUpload = "upload"
+	// staleDelete removes stale archives.
+	staleDelete = "delete"
+)
+
+// validateStaleArchives validates the provided stale archive policy.
+func validateStaleArchives(policy string) error {
+	switch policy {
+	case "", staleKeep, staleUpload, staleDelete:
+		return nil
+
+	default:
+		return fmt.Errorf("invalid stale archive policy %q, expected %s, %s or %s", policy,
+			staleKeep, staleUpload, staleDelete)
+	}
+}
+
+// stagedArchivePattern matches the names of the zip files and deltas runs create in their
+// source directory, followed by the run's timestamp.
+var stagedArchivePattern = regexp.MustCompile(`-\d{14}\.(zip|delta)$`)
+
+// isStagedArchive returns whether the file with the provided slash separated path, relative
+// to a source directory, is an archive staged by a run.
+func isStagedArchive(name string) bool {
+	return !strings.Contains(name, "/") && stagedArchivePattern.MatchString(name)
+}
+
+// stagedArchive is an archive staged in a job's source directory, left behind by a run whose
+// upload failed.
+type stagedArchive struct {
+	path    string
+	size    int64
+	modTime time.Time
+}
+
+// listStagedArchives returns the archives staged in the provided directory, oldest first.
+func listStagedArchives(dir string) ([]stagedArchive, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var staged []stagedArchive
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() || !stagedArchivePattern.MatchString(entry.Name()) {
+			continue
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+
+		staged = append(staged, stagedArchive{
+			path:    filepath.Join(dir, entry.Name()),
+			size:    info.Size(),
+			modTime: info.ModTime(),
+		})
+	}
+	sort.Slice(staged, func(i, j int) bool { return staged[i].modTime.Before(staged[j].modTime) })
+
+	return staged, nil
+}
+
+// capStaging deletes the oldest archives staged in the provided directory until their total
+// size is within the provided maximum. It returns the errors of the archives which could not
+// be removed, the others are still removed.
+func capStaging(dir string, maxSize int64, logger *zerolog.Logger) error {
+	staged, err := listStagedArchives(dir)
+	if err != nil {
+		logger.Error().Err(err).Str("path", dir).Msg("Listing staged archives")
+		return err
+	}
+
+	var total int64
+	for _, archive := range staged {
+		total += archive.size
+	}
+
+	var errs error
+	for _, archive := range staged {
+		if total <= maxSize {
+			break
+		}
+
+		err := os.Remove(archive.path)
+		if err != nil {
+			logger.Error().Err(err).Str("path", archive.path).Msg("Removing staged archive")
+			errs = errors.Join(errs, err)
+			continue
+		}
+		total -= archive.size
+
+		logger.Warn().Str("path", archive.path).Int64("size", archive.size).Int64("maxSize", maxSize).
+			Msg("Staging area over its size cap, removed the oldest staged archive")
+	}
+
+	return errs
+}
+
+// capJobStaging keeps the archives staged in the provided directory within the provided
+// job's staging size cap, if any, recording failures as stage errors of the provided run.
+func capJobStaging(job jobConfig, dir string, result *runResult, logger *zerolog.Logger) {
+	maxSize := job.maxStagingSize()
+	if maxSize == 0 {
+		return
+	}
+
+	err := capStaging(dir, maxSize, logger)
+	if err != nil {
+		result.stageFailed("staging", err)
+	}
+}
+
+// maxStagingSize returns the maximum total size of the archives staged in the job's source
+// directory, zero if it is not capped.
+func (j *jobConfig) maxStagingSize() int64 {
+	size, err := parseSize(j.MaxStagingSize)
+	if j.MaxStagingSize == "" || err != nil {
+		return 0
+	}
+
+	return size
+}
+
+// recoverStaleArchives applies the job's stale archive policy to the archives staged in the
+// provided directory by crashed or failed runs. Stale zip files are uploaded as they are,
+// without a manifest. Zip files cut short by a crash and deltas are never uploaded. It
+// returns the errors of the archives which could not be recovered, the others are still
+// recovered.
+func recoverStaleArchives(ctx context.Context, job jobConfig, dir string, cfg *s3Config, logger *zerolog.Logger) error {
+	if job.StaleArchives == "" || job.StaleArchives == staleKeep {
+		return nil
+	}
+
+	// Archives staged while uploads are paused are spooled, not stale.
+	if circuit := circuitFor(cfg); circuit != nil && circuit.open() {
+		return nil
+	}
+
+	staged, err := listStagedArchives(dir)
+	if err != nil {
+		logger.Error().Err(err).Str("path", dir).Msg("Listing staged archives")
+		return err
+	}
+
+	var errs error
+	for _, archive := range staged {
+		if ctx.Err() != nil {
+			return errors.Join(errs, ctx.Err())
+		}
+
+		if job.StaleArchives == staleUpload && strings.HasSuffix(archive.path, ".zip") {
+			if completeZip(archive.path) {
+				err := enforceQuota(ctx, job, cfg, archive.size, logger)
+				if err != nil {
+					logger.Error().Err(err).Str("path", archive.path).Msg("Enforcing bucket usage quota, keeping stale archive")
+					errs = errors.Join(errs, err)
+					continue
+				}
+
+				// Failed uploads keep the archive for the next run, uploads remove it.
+				logger.Info().Str("path", archive.path).Msg("Uploading stale archive")
+				_, err = uploadZip(ctx, archive.path, cfg, logger)
+				errs = errors.Join(errs, err)
+				continue
+			}
+
+			logger.Warn().Str("path", archive.path).Msg("Stale archive incomplete, removing it")
+		}
+
+		err := os.Remove(archive.path)
+		if err != nil {
+			logger.Error().Err(err).Str("path", archive.path).Msg("Removing stale archive")
+			errs = errors.Join(errs, err)
+			continue
+		}
+
+		logger.Info().Str("path", archive.path).Msg("Removed stale archive")
+	}
+
+	return errs
+}
+
+// recoverStaleJobArchives applies the stale archive policy of the provided job to its
+// staging directories, the source directory or every subdirectory of it. It returns the
+// errors of every directory.
+func recoverStaleJobArchives(ctx context.Context, job jobConfig, cfg *s3Config, logger *zerolog.Logger) error {
+	if !job.Subdirs {
+		return recoverStaleArchives(ctx, job, job.SourceDir, cfg, logger)
+	}
+
+	entries, err := os.ReadDir(job.SourceDir)
+	if err != nil {
+		logger.Error().Err(err).Str("dir", job.SourceDir).Msg("Listing subdirectories")
+		return err
+	}
+
+	var errs error
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+
+		subCfg := *cfg
+		subCfg.Prefix = path.Join(cfg.Prefix, entry.Name())
+		errs = errors.Join(errs, recoverStaleArchives(ctx, job, filepath.Join(job.SourceDir, entry.Name()), &subCfg, logger))
+	}
+
+	return errs
+}
+
+// completeZip returns whether the zip file at the provided path was written completely, its
+// central directory is only written when it is closed.
+func completeZip(path string) bool {
+	r, err := zip.OpenReader(path)
+	if err != nil {
+		return false
+	}
+	r.Close()
+
+	return true
+}
@@ -0,0 +1,202 @@
+package archiver
+
+import (
+	"archive/zip"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/peterldowns/testy/assert"
+	"github.com/rs/zerolog"
+)
+
+// writeStaged writes a staged archive of the provided size and age to the provided directory.
+func writeStaged(t *testing.T, dir string, name string, size int, age time.Duration) string {
+	t.Helper()
+
+	path := filepath.Join(dir, name)
+	assert.NoError(t, os.WriteFile(path, make([]byte, size), 0644))
+	modTime := time.Now().Add(-age)
+	assert.NoError(t, os.Chtimes(path, modTime, modTime))
+
+	return path
+}
+
+func TestListStagedArchives(t *testing.T) {
+	dir := t.TempDir()
+	newer := writeStaged(t, dir, "dump-20250102000000.zip", 10, time.Hour)
+	older := writeStaged(t, dir, "db-20250101000000.zip", 10, 2*time.Hour)
+	writeStaged(t, dir, "notes.zip", 10, 3*time.Hour)
+	writeStaged(t, dir, "db.sql", 10, 3*time.Hour)
+
+	// Ensure only the archives of runs are listed, oldest first.
+	staged, err := listStagedArchives(dir)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(staged))
+	assert.Equal(t, older, staged[0].path)
+	assert.Equal(t, newer, staged[1].path)
+}
+
+func TestCapStaging(t *testing.T) {
+	dir := t.TempDir()
+	logger := zerolog.Nop()
+	oldest := writeStaged(t, dir, "dump-20250101000000.zip", 1000, 3*time.Hour)
+	older := writeStaged(t, dir, "dump-20250102000000.zip", 1000, 2*time.Hour)
+	newest := writeStaged(t, dir, "dump-20250103000000.zip", 1000, time.Hour)
+	other := writeStaged(t, dir, "db.sql", 5000, 4*time.Hour)
+
+	// Ensure staging areas within their cap are left alone.
+	assert.NoError(t, capStaging(dir, 3000, &logger))
+	_, err := os.Stat(oldest)
+	assert.NoError(t, err)
+
+	// Ensure the oldest staged archives are removed first.
+	assert.NoError(t, capStaging(dir, 1500, &logger))
+	_, err = os.Stat(oldest)
+	assert.True(t, os.IsNotExist(err))
+	_, err = os.Stat(older)
+	assert.True(t, os.IsNotExist(err))
+	_, err = os.Stat(newest)
+	assert.NoError(t, err)
+	_, err = os.Stat(other)
+	assert.NoError(t, err)
+}
+
+func TestMaxStagingSize(t *testing.T) {
+	job := jobConfig{Name: "db"}
+	assert.Equal(t, int64(0), job.maxStagingSize())
+
+	job.MaxStagingSize = "2KiB"
+	assert.Equal(t, int64(2048), job.maxStagingSize())
+}
+
+func TestArchiveStagingCap(t *testing.T) {
+	dir := t.TempDir()
+	logger := zerolog.Nop()
+	tracker := newStatusTracker()
+	fake := newFakeS3(t, "test-bucket")
+	s3Cfg := fake.s3Config("missing-bucket")
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "db.sql"), []byte("dump"), 0644))
+	staged := writeStaged(t, dir, "dump-20250101000000.zip", 4096, time.Hour)
+
+	// Ensure failed uploads keep the staging area within its cap.
+	job := jobConfig{Name: "db", SourceDir: dir, Retention: "720h", MaxStagingSize: "2KiB"}
+	archive(context.Background(), job, s3Cfg, []runReporter{tracker}, &logger)
+	assert.Error(t, tracker.runs["db"].Err)
+
+	_, err := os.Stat(staged)
+	assert.True(t, os.IsNotExist(err))
+
+	remaining, err := listStagedArchives(dir)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(remaining))
+}
+
+// writeStaleZip writes a complete zip file named after a run to the provided directory.
+func writeStaleZip(t *testing.T, dir string, name string) string {
+	t.Helper()
+
+	path := filepath.Join(dir, name)
+	f, err := os.Create(path)
+	assert.NoError(t, err)
+	w := zip.NewWriter(f)
+	entry, err := w.Create("db.sql")
+	assert.NoError(t, err)
+	_, err = entry.Write([]byte("dump"))
+	assert.NoError(t, err)
+	assert.NoError(t, w.Close())
+	assert.NoError(t, f.Close())
+
+	return path
+}
+
+func TestValidateStaleArchives(t *testing.T) {
+	for _, policy := range []string{"", staleKeep, staleUpload, staleDelete} {
+		assert.NoError(t, validateStaleArchives(policy))
+	}
+	assert.Error(t, validateStaleArchives("retry"))
+}
+
+func TestRecoverStaleArchives(t *testing.T) {
+	logger := zerolog.Nop()
+	fake := newFakeS3(t, "test-bucket")
+	s3Cfg := fake.s3Config("test-bucket")
+	s3Cfg.Prefix = "dumps"
+
+	// Ensure stale archives are kept by default.
+	dir := t.TempDir()
+	stale := writeStaleZip(t, dir, "dump-20250101000000.zip")
+	assert.NoError(t, recoverStaleArchives(context.Background(), jobConfig{Name: "db"}, dir, s3Cfg, &logger))
+	_, err := os.Stat(stale)
+	assert.NoError(t, err)
+
+	// Ensure complete stale archives are uploaded and incomplete ones removed.
+	truncated := writeStaged(t, dir, "dump-20250102000000.zip", 100, 0)
+	delta := writeStaged(t, dir, "dump-20250103000000.delta", 100, 0)
+	job := jobConfig{Name: "db", StaleArchives: staleUpload}
+	assert.NoError(t, recoverStaleArchives(context.Background(), job, dir, s3Cfg, &logger))
+	assert.True(t, fake.object("test-bucket", "dumps/dump-20250101000000.zip") != nil)
+	assert.True(t, fake.object("test-bucket", "dumps/dump-20250102000000.zip") == nil)
+	for _, path := range []string{stale, truncated, delta} {
+		_, err := os.Stat(path)
+		assert.True(t, os.IsNotExist(err))
+	}
+
+	// Ensure failed uploads are returned, keeping stale archives for the next run.
+	stale = writeStaleZip(t, dir, "dump-20250104000000.zip")
+	err = recoverStaleArchives(context.Background(), job, dir, fake.s3Config("missing-bucket"), &logger)
+	assert.Error(t, err)
+	_, err = os.Stat(stale)
+	assert.NoError(t, err)
+
+	// Ensure stale archives are removed without being uploaded when deleting them.
+	job.StaleArchives = staleDelete
+	assert.NoError(t, recoverStaleArchives(context.Background(), job, dir, s3Cfg, &logger))
+	_, err = os.Stat(stale)
+	assert.True(t, os.IsNotExist(err))
+	assert.True(t, fake.object("test-bucket", "dumps/dump-20250104000000.zip") == nil)
+}
+
+func TestRecoverStaleJobArchives(t *testing.T) {
+	logger := zerolog.Nop()
+	fake := newFakeS3(t, "test-bucket")
+	s3Cfg := fake.s3Config("test-bucket")
+
+	// Ensure the staging directories of subdirectory archives are their subdirectories.
+	dir := t.TempDir()
+	assert.NoError(t, os.Mkdir(filepath.Join(dir, "app"), 0755))
+	writeStaleZip(t, filepath.Join(dir, "app"), "app-20250101000000.zip")
+	job := jobConfig{Name: "db", SourceDir: dir, Subdirs: true, StaleArchives: staleUpload}
+	recoverStaleJobArchives(context.Background(), job, s3Cfg, &logger)
+	assert.True(t, fake.object("test-bucket", "app/app-20250101000000.zip") != nil)
+}
+
+func TestZipDirSkipsStagedArchives(t *testing.T) {
+	dir := t.TempDir()
+	logger := zerolog.Nop()
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "db.sql"), []byte("dump"), 0644))
+	writeStaleZip(t, dir, "dump-20250101000000.zip")
+	writeStaged(t, dir, "dump-20250101000000.delta", 10, 0)
+	assert.NoError(t, os.Mkdir(filepath.Join(dir, "exports"), 0755))
+	writeStaleZip(t, filepath.Join(dir, "exports"), "report-20250101000000.zip")
+
+	// Ensure the archives of previous runs and the zip file being written are skipped, but
+	// not files deeper in the tree named like them.
+	zipPath := filepath.Join(dir, "dump-20250102000000.zip")
+	files, err := zipDir(context.Background(), dir, zipPath, zipOptions{Readers: 4}, &logger)
+	assert.NoError(t, err)
+	var names []string
+	for _, file := range files {
+		names = append(names, file.Path)
+	}
+	assert.Equal(t, []string{"db.sql", "exports/report-20250101000000.zip"}, names)
+
+	// Ensure staged archives are left out of the zip phase totals.
+	count, size := scanDir(dir, time.Time{})
+	info, err := os.Stat(filepath.Join(dir, "exports", "report-20250101000000.zip"))
+	assert.NoError(t, err)
+	assert.Equal(t, 2, count)
+	assert.Equal(t, 4+info.Size(), size)
+}
@@ -0,0 +1,133 @@
+package archiver
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// staleCheckInterval is the interval at which the age of the last successful archive of
+// every job is checked.
+const staleCheckInterval = time.Minute
+
+// staleWatchdog is a run reporter keeping the time of the last successful run of every job.
+// It alerts the notification channels about jobs without a successful archive for longer than
+// the maximum backup age, so a silently broken schedule gets noticed.
+type staleWatchdog struct {
+	mtx         sync.Mutex
+	started     time.Time
+	lastSuccess map[string]time.Time
+	stale       []string
+}
+
+// newStaleWatchdog creates a watchdog considering jobs without a successful run fresh as of
+// the provided time.
+func newStaleWatchdog(started time.Time) *staleWatchdog {
+	return &staleWatchdog{started: started, lastSuccess: make(map[string]time.Time)}
+}
+
+// name returns the name of the reporter.
+func (w *staleWatchdog) name() string {
+	return "stale"
+}
+
+// report records the start time of the provided run as the last successful run of its job.
+func (w *staleWatchdog) report(_ context.Context, result *runResult) error {
+	if result.Err != nil {
+		return nil
+	}
+
+	w.record(result.Job, result.Start)
+	return nil
+}
+
+// record records the provided time as the last successful run of the provided job, unless
+// a later one is known.
+func (w *staleWatchdog) record(job string, lastSuccess time.Time) {
+	w.mtx.Lock()
+	defer w.mtx.Unlock()
+
+	if lastSuccess.After(w.lastSuccess[job]) {
+		w.lastSuccess[job] = lastSuccess
+	}
+}
+
+// check returns the time of the last successful archive of every provided job which has no
+// successful archive within the provided maximum age, and records them as the stale jobs.
+// Runs of a job's subdirectories count as runs of the job.
+func (w *staleWatchdog) check(jobs []jobConfig, maxAge time.Duration, now time.Time) map[string]time.Time {
+	w.mtx.Lock()
+	defer w.mtx.Unlock()
+
+	w.stale = w.stale[:0]
+	if maxAge <= 0 {
+		return nil
+	}
+
+	stale := make(map[string]time.Time)
+	for _, job := range jobs {
+		lastSuccess := w.started
+		for name, t := range w.lastSuccess {
+			if (name == job.Name || strings.HasPrefix(name, job.Name+"/")) && t.After(lastSuccess) {
+				lastSuccess = t
+			}
+		}
+
+		if now.Sub(lastSuccess) > maxAge {
+			stale[job.Name] = lastSuccess
+			w.stale = append(w.stale, job.Name)
+		}
+	}
+	slices.Sort(w.stale)
+
+	return stale
+}
+
+// staleJobs returns the names of the jobs found stale by the last check.
+func (w *staleWatchdog) staleJobs() []string {
+	w.mtx.Lock()
+	defer w.mtx.Unlock()
+
+	return slices.Clone(w.stale)
+}
+
+// run checks the jobs of the active configuration periodically until the context is
+// cancelled. The notification channels are alerted once per stale job, and again when it
+// turns stale after a successful archive.
+func (w *staleWatchdog) run(ctx context.Context, active func() *Config, logger *zerolog.Logger, wg *sync.WaitGroup) {
+	defer wg.Done()
+
+	ticker := time.NewTicker(staleCheckInterval)
+	defer ticker.Stop()
+
+	alerted := make(map[string]time.Time)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+
+		case <-ticker.C:
+			cfg := active()
+			maxAge := cfg.maxBackupAge()
+			stale := w.check(cfg.jobs(), maxAge, time.Now())
+			for job, lastSuccess := range stale {
+				if at, ok := alerted[job]; ok && at.Equal(lastSuccess) {
+					continue
+				}
+				alerted[job] = lastSuccess
+
+				err := fmt.Errorf("no successful archive for %s, last one at %s",
+					time.Since(lastSuccess).Round(time.Minute), lastSuccess.Format(time.RFC3339))
+				logger.Error().Err(err).Str("job", job).Msg("Backups stale")
+
+				result := &runResult{Job: job, Start: lastSuccess, Err: err}
+				report(ctx, cfg.notifiers(), result, logger)
+			}
+		}
+	}
+}
@@ -0,0 +1,35 @@
+package archiver
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/peterldowns/testy/assert"
+)
+
+func TestStaleWatchdog(t *testing.T) {
+	now := time.Date(2026, 1, 3, 12, 0, 0, 0, time.UTC)
+	watchdog := newStaleWatchdog(now.Add(-48 * time.Hour))
+	jobs := []jobConfig{{Name: "db"}, {Name: "logs"}}
+
+	// Ensure jobs are fresh as of the watchdog's start and without a maximum age.
+	assert.Equal(t, 0, len(watchdog.check(jobs, 72*time.Hour, now)))
+	assert.Equal(t, 0, len(watchdog.check(jobs, 0, now)))
+
+	// Ensure failed runs do not refresh jobs while runs of subdirectories do.
+	ctx := context.Background()
+	assert.NoError(t, watchdog.report(ctx, &runResult{Job: "db", Start: now.Add(-time.Hour), Err: errors.New("zip failed")}))
+	assert.NoError(t, watchdog.report(ctx, &runResult{Job: "logs/nginx", Start: now.Add(-time.Hour)}))
+
+	stale := watchdog.check(jobs, 26*time.Hour, now)
+	assert.Equal(t, 1, len(stale))
+	assert.Equal(t, now.Add(-48*time.Hour), stale["db"])
+	assert.Equal(t, []string{"db"}, watchdog.staleJobs())
+
+	// Ensure a successful run clears the stale job.
+	assert.NoError(t, watchdog.report(ctx, &runResult{Job: "db", Start: now.Add(-time.Hour)}))
+	assert.Equal(t, 0, len(watchdog.check(jobs, 26*time.Hour, now)))
+	assert.Equal(t, 0, len(watchdog.staleJobs()))
+}
@@ -0,0 +1,167 @@
+package archiver
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// jobRunState is the locally persisted run state of an archive job.
+type jobRunState struct {
+	// LastRun is the start time of the job's last run, successful or not.
+	LastRun time.Time `json:"lastRun"`
+	// LastSuccess is the start time of the job's last successful run.
+	LastSuccess time.Time `json:"lastSuccess"`
+	// LastObject is the key of the last archive uploaded by the job.
+	LastObject string `json:"lastObject,omitempty"`
+	// ContentHash is the content hash of the job's last successfully archived files.
+	ContentHash string `json:"contentHash,omitempty"`
+}
+
+// runState is a run reporter persisting the run state of every job to a local file, so it
+// survives restarts of the service.
+type runState struct {
+	mtx  sync.Mutex
+	path string
+	jobs map[string]jobRunState
+}
+
+// openRunState reads the run state file at the provided path. A missing file is created by
+// the first reported run.
+func openRunState(path string) (*runState, error) {
+	state := &runState{path: path, jobs: make(map[string]jobRunState)}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return state, nil
+		}
+		return nil, fmt.Errorf("reading state file: %w", err)
+	}
+
+	err = json.Unmarshal(data, &state.jobs)
+	if err != nil {
+		return nil, fmt.Errorf("parsing state file %s: %w", path, err)
+	}
+
+	return state, nil
+}
+
+// name returns the name of the reporter.
+func (s *runState) name() string {
+	return "state"
+}
+
+// report records the provided run as the last run of its job. Successful runs also record
+// the archive they uploaded, runs skipping unchanged archives keep the previous one.
+func (s *runState) report(_ context.Context, result *runResult) error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	job := s.jobs[result.Job]
+	job.LastRun = result.Start
+	if result.Err == nil {
+		job.LastSuccess = result.Start
+		if result.Key != "" {
+			job.LastObject = result.Key
+		}
+		if len(result.Contents) > 0 {
+			job.ContentHash = contentHash(result.Contents)
+		}
+	}
+	s.jobs[result.Job] = job
+
+	return s.write()
+}
+
+// lastSuccess returns the start time of the last successful run of the provided job, zero if
+// it has not completed a run yet.
+func (s *runState) lastSuccess(job string) time.Time {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	return s.jobs[job].LastSuccess
+}
+
+// successes returns the start times of the last successful runs of every job.
+func (s *runState) successes() map[string]time.Time {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	successes := make(map[string]time.Time, len(s.jobs))
+	for job, state := range s.jobs {
+		successes[job] = state.LastSuccess
+	}
+
+	return successes
+}
+
+// write replaces the state file with the current state. The state is written to a temporary
+// file renamed over the state file, so a crash never leaves a partially written state.
+func (s *runState) write() error {
+	data, err := json.MarshalIndent(s.jobs, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), ".state-*.json")
+	if err != nil {
+		return fmt.Errorf("creating state file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = tmp.Write(data)
+	if err != nil {
+		tmp.Close()
+		return fmt.Errorf("writing state file: %w", err)
+	}
+
+	err = tmp.Close()
+	if err != nil {
+		return fmt.Errorf("writing state file: %w", err)
+	}
+
+	err = os.Rename(tmp.Name(), s.path)
+	if err != nil {
+		return fmt.Errorf("replacing state file: %w", err)
+	}
+
+	return nil
+}
+
+// archiveRegistry records the start times of the last successful runs of the jobs, before
+// which their files are archived.
+type archiveRegistry struct {
+	mtx  sync.Mutex
+	runs map[string]time.Time
+}
+
+// archivedRuns holds the last successful runs of the archive jobs, seeded from the run state
+// on startup.
+var archivedRuns = &archiveRegistry{runs: make(map[string]time.Time)}
+
+// record records a successful run of the provided job started at the provided time. Earlier
+// runs finishing late do not replace later ones.
+func (r *archiveRegistry) record(job string, start time.Time) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	if start.After(r.runs[job]) {
+		r.runs[job] = start
+	}
+}
+
+// last returns the start time of the last successful run of the provided job, zero if none
+// is known.
+func (r *archiveRegistry) last(job string) time.Time {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	return r.runs[job]
+}
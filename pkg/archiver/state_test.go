@@ -0,0 +1,47 @@
+package archiver
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/peterldowns/testy/assert"
+)
+
+func TestRunState(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	state, err := openRunState(path)
+	assert.NoError(t, err)
+	assert.True(t, state.lastSuccess("db").IsZero())
+
+	ctx := context.Background()
+	start := time.Date(2026, 1, 1, 23, 50, 0, 0, time.UTC)
+	contents := []archivedFile{{Path: "dump.sql", SHA256: "abc"}}
+	runs := []*runResult{
+		{Job: "db", Start: start, Key: "backups/dump-20260101235000.zip", Contents: contents},
+		{Job: "db", Start: start.Add(24 * time.Hour), Contents: contents, Unchanged: true},
+		{Job: "db", Start: start.Add(48 * time.Hour), Err: errors.New("zip failed")},
+	}
+	for _, run := range runs {
+		assert.NoError(t, state.report(ctx, run))
+	}
+	assert.Equal(t, start.Add(24*time.Hour), state.lastSuccess("db"))
+
+	// Ensure the state survives reopening.
+	state, err = openRunState(path)
+	assert.NoError(t, err)
+	job := state.jobs["db"]
+	assert.True(t, start.Add(48*time.Hour).Equal(job.LastRun))
+	assert.True(t, start.Add(24*time.Hour).Equal(job.LastSuccess))
+	assert.Equal(t, "backups/dump-20260101235000.zip", job.LastObject)
+	assert.Equal(t, contentHash(contents), job.ContentHash)
+	assert.True(t, state.lastSuccess("logs").IsZero())
+
+	// Ensure corrupt state files are reported.
+	assert.NoError(t, os.WriteFile(path, []byte("{"), 0o600))
+	_, err = openRunState(path)
+	assert.Error(t, err)
+}
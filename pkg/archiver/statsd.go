@@ -0,0 +1,153 @@
+package archiver
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"strings"
+)
+
+// defaultStatsdPrefix is the default name prefix of metrics sent to StatsD.
+const defaultStatsdPrefix = "zdts3."
+
+// statsd sends run metrics to a StatsD or DogStatsD agent over UDP. Tags are sent in the
+// DogStatsD format, which StatsD servers without tag support ignore or reject.
+type statsd struct {
+	address string
+	prefix  string
+	tags    []string
+}
+
+// parseStatsdTags parses a comma separated list of tags, e.g. "env:prod,team:ops".
+func parseStatsdTags(value string) []string {
+	var tags []string
+	for _, tag := range strings.Split(value, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+
+	return tags
+}
+
+// newStatsd creates a reporter sending run metrics to the StatsD agent at the provided
+// address.
+func newStatsd(address string, prefix string, tags []string) *statsd {
+	if prefix == "" {
+		prefix = defaultStatsdPrefix
+	}
+
+	return &statsd{
+		address: address,
+		prefix:  prefix,
+		tags:    tags,
+	}
+}
+
+// name returns the name of the reporter.
+func (s *statsd) name() string {
+	return "statsd"
+}
+
+// metrics returns the metrics of the provided run as newline separated StatsD lines.
+func (s *statsd) metrics(result *runResult) []byte {
+	var buf bytes.Buffer
+
+	tags := append([]string{"job:" + result.Job}, s.tags...)
+	suffix := "|#" + strings.Join(tags, ",")
+
+	write := func(name string, value string, kind string) {
+		fmt.Fprintf(&buf, "%s%s:%s|%s%s\n", s.prefix, name, value, kind, suffix)
+	}
+
+	write("run.duration", fmt.Sprint(result.Duration.Milliseconds()), "ms")
+	write("run.files", fmt.Sprint(result.Files), "g")
+	write("run.archive_size_bytes", fmt.Sprint(result.Size), "g")
+
+	if result.Skipped {
+		write("run.skipped", "1", "c")
+	}
+	if result.Err == nil {
+		write("run.success", "1", "c")
+		write("last_success_timestamp", fmt.Sprint(result.Start.Add(result.Duration).Unix()), "g")
+	} else {
+		write("run.failure", "1", "c")
+	}
+
+	return buf.Bytes()
+}
+
+// usageMetrics returns the metrics of the provided storage usage as newline separated StatsD
+// lines, tagged with the bucket and prefix.
+func (s *statsd) usageMetrics(usage *storageUsage) []byte {
+	var buf bytes.Buffer
+	for _, entry := range usage.Prefixes {
+		tags := append([]string{"bucket:" + entry.Bucket, "prefix:" + entry.Prefix}, s.tags...)
+		suffix := "|#" + strings.Join(tags, ",")
+
+		fmt.Fprintf(&buf, "%sstorage.archives:%d|g%s\n", s.prefix, entry.Archives, suffix)
+		fmt.Fprintf(&buf, "%sstorage.bytes:%d|g%s\n", s.prefix, entry.Bytes, suffix)
+		fmt.Fprintf(&buf, "%sstorage.monthly_cost:%g|g%s\n", s.prefix, entry.MonthlyCost, suffix)
+	}
+
+	return buf.Bytes()
+}
+
+// drillMetrics returns the metrics of the provided restore drill as newline separated StatsD
+// lines.
+func (s *statsd) drillMetrics(result *drillResult) []byte {
+	var buf bytes.Buffer
+
+	tags := append([]string{"job:" + result.Job}, s.tags...)
+	suffix := "|#" + strings.Join(tags, ",")
+
+	write := func(name string, value string, kind string) {
+		fmt.Fprintf(&buf, "%s%s:%s|%s%s\n", s.prefix, name, value, kind, suffix)
+	}
+
+	write("drill.duration", fmt.Sprint(result.Duration.Milliseconds()), "ms")
+	write("drill.files", fmt.Sprint(result.Files), "g")
+
+	if result.Err == nil {
+		write("drill.success", "1", "c")
+		write("last_drill_success_timestamp", fmt.Sprint(result.Start.Add(result.Duration).Unix()), "g")
+	} else {
+		write("drill.failure", "1", "c")
+	}
+
+	return buf.Bytes()
+}
+
+// send sends the provided metrics to the StatsD agent in a single datagram.
+func (s *statsd) send(ctx context.Context, metrics []byte) error {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "udp", s.address)
+	if err != nil {
+		return fmt.Errorf("connecting to statsd: %w", err)
+	}
+	defer conn.Close()
+
+	_, err = conn.Write(metrics)
+	if err != nil {
+		return fmt.Errorf("sending statsd metrics: %w", err)
+	}
+
+	return nil
+}
+
+// report sends the metrics of the provided run to the StatsD agent.
+func (s *statsd) report(ctx context.Context, result *runResult) error {
+	return s.send(ctx, s.metrics(result))
+}
+
+// reportUsage sends the metrics of the provided storage usage to the StatsD agent.
+func (s *statsd) reportUsage(ctx context.Context, usage *storageUsage) error {
+	return s.send(ctx, s.usageMetrics(usage))
+}
+
+// reportDrill sends the metrics of the provided restore drill to the StatsD agent.
+func (s *statsd) reportDrill(ctx context.Context, result *drillResult) error {
+	return s.send(ctx, s.drillMetrics(result))
+}
@@ -0,0 +1,59 @@
+package archiver
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/peterldowns/testy/assert"
+)
+
+func TestStatsd(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer conn.Close()
+
+	s := newStatsd(conn.LocalAddr().String(), "", parseStatsdTags("env:test, ,team:ops"))
+	ctx := context.Background()
+
+	read := func() string {
+		buf := make([]byte, 1024)
+		err := conn.SetReadDeadline(time.Now().Add(time.Second))
+		assert.NoError(t, err)
+		n, _, err := conn.ReadFrom(buf)
+		assert.NoError(t, err)
+		return string(buf[:n])
+	}
+
+	// Ensure the metrics of a successful run are sent with the job and configured tags.
+	result := &runResult{
+		Job:      "db",
+		Start:    time.Unix(1700000000, 0),
+		Duration: 1500 * time.Millisecond,
+		Files:    3,
+		Size:     2048,
+	}
+	err = s.report(ctx, result)
+	assert.NoError(t, err)
+
+	lines := strings.Split(strings.TrimSpace(read()), "\n")
+	assert.Equal(t, []string{
+		"zdts3.run.duration:1500|ms|#job:db,env:test,team:ops",
+		"zdts3.run.files:3|g|#job:db,env:test,team:ops",
+		"zdts3.run.archive_size_bytes:2048|g|#job:db,env:test,team:ops",
+		"zdts3.run.success:1|c|#job:db,env:test,team:ops",
+		"zdts3.last_success_timestamp:1700000001|g|#job:db,env:test,team:ops",
+	}, lines)
+
+	// Ensure failed runs are counted as failures.
+	result.Err = errors.New("upload failed")
+	err = s.report(ctx, result)
+	assert.NoError(t, err)
+
+	metrics := read()
+	assert.True(t, strings.Contains(metrics, "zdts3.run.failure:1|c"))
+	assert.False(t, strings.Contains(metrics, "last_success_timestamp"))
+}
@@ -0,0 +1,126 @@
+package archiver
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/dnldd/zdts3/pkg/storage"
+)
+
+// Storage backends.
+const (
+	// backendS3 stores archives in S3 or S3-compatible buckets.
+	backendS3 = "s3"
+	// backendSFTP stores archives in a directory of an SFTP server.
+	backendSFTP = "sftp"
+	// backendLocalDir copies archives into a local directory, e.g. a mounted NAS share.
+	backendLocalDir = "localdir"
+	// backendB2 stores archives in B2 buckets through the B2 native API.
+	backendB2 = "b2"
+	// backendExec stores archives through an external plugin program.
+	backendExec = "exec"
+)
+
+// storageOpener connects to a storage. The connection is closed when the provided context is
+// cancelled. Features storing further objects next to the archives, such as deduplicated
+// chunks or the catalog, use the S3 API directly.
+type storageOpener func(ctx context.Context) (storage.Storage, error)
+
+// openLocalDir opens the storage in the provided directory, which must exist. Files are
+// copied through the shared copy buffers.
+func openLocalDir(root string) storageOpener {
+	return func(context.Context) (storage.Storage, error) {
+		dir, err := storage.OpenLocalDir(root, copyBuffers().copy)
+		if err != nil {
+			return nil, err
+		}
+
+		return dir, nil
+	}
+}
+
+// openStorage connects to the storage of the access configuration, its S3 or S3-compatible
+// bucket unless another backend is configured.
+func (c *s3Config) openStorage(ctx context.Context) (storage.Storage, error) {
+	if c.OpenStorage != nil {
+		return c.OpenStorage(ctx)
+	}
+
+	return newS3Storage(c)
+}
+
+// verifyStored ensures the stored file with the provided key has the size of the local file
+// at the provided path, so truncated uploads are not mistaken for archives.
+func verifyStored(ctx context.Context, store storage.Storage, key string, localPath string) error {
+	info, err := os.Stat(localPath)
+	if err != nil {
+		return err
+	}
+
+	size, err := store.Stat(ctx, key)
+	if err != nil {
+		return fmt.Errorf("verifying %s: %w", key, err)
+	}
+
+	if size != info.Size() {
+		return fmt.Errorf("verifying %s: stored %d bytes of %d", key, size, info.Size())
+	}
+
+	return nil
+}
+
+// restoreStoreArchive downloads the archive with the provided key from the storage of the
+// provided access configuration and extracts it into the provided directory with the
+// provided options. Storages other than S3 only hold plain archives, there is no backup
+// chain to restore.
+func restoreStoreArchive(ctx context.Context, cfg *s3Config, key string, targetDir string, opts extractOptions) (*restoreResult, error) {
+	store, err := cfg.openStorage(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer store.Close()
+
+	err = os.MkdirAll(targetDir, 0755)
+	if err != nil {
+		return nil, fmt.Errorf("creating target directory: %w", err)
+	}
+
+	src, err := store.Get(ctx, key)
+	if err != nil {
+		return nil, fmt.Errorf("downloading archive %s: %w", key, err)
+	}
+	defer src.Close()
+
+	// Download next to the target directory, the zip format requires random access.
+	tmp, err := os.CreateTemp(targetDir, ".restore-*.zip")
+	if err != nil {
+		return nil, fmt.Errorf("creating download file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = copyBuffers().copy(tmp, src)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return nil, fmt.Errorf("downloading archive %s: %w", key, err)
+	}
+
+	// Damaged archives are repaired with their parity data.
+	result := &restoreResult{Key: key, Chain: []string{key}}
+	repaired, err := repairDownload(ctx, store, key, tmp.Name())
+	if err != nil {
+		return nil, err
+	}
+	if repaired > 0 {
+		result.Repaired = []string{key}
+	}
+
+	result.Files, result.Bytes, err = extractZip(tmp.Name(), targetDir, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
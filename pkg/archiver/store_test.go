@@ -0,0 +1,175 @@
+package archiver
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dnldd/zdts3/pkg/storage"
+	"github.com/peterldowns/testy/assert"
+	"github.com/rs/zerolog"
+)
+
+// memStorage is an in-memory storage test double.
+type memStorage struct {
+	mtx      sync.Mutex
+	files    map[string][]byte
+	modified map[string]time.Time
+	// truncate stores uploaded files without their last byte.
+	truncate bool
+}
+
+// newMemStorage creates an empty in-memory storage.
+func newMemStorage() *memStorage {
+	return &memStorage{files: make(map[string][]byte), modified: make(map[string]time.Time)}
+}
+
+// opener returns the opener of the storage.
+func (m *memStorage) opener() storageOpener {
+	return func(context.Context) (storage.Storage, error) { return m, nil }
+}
+
+// PutFile stores the content of the file at the provided path.
+func (m *memStorage) PutFile(ctx context.Context, key string, path string) (int64, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+
+	return int64(len(data)), m.Put(ctx, key, data)
+}
+
+// Put stores the provided data.
+func (m *memStorage) Put(_ context.Context, key string, data []byte) error {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	if m.truncate && len(data) > 0 {
+		data = data[:len(data)-1]
+	}
+	m.files[key] = data
+	m.modified[key] = time.Now()
+	return nil
+}
+
+// Get opens the stored data.
+func (m *memStorage) Get(_ context.Context, key string) (io.ReadCloser, error) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	data, ok := m.files[key]
+	if !ok {
+		return nil, fs.ErrNotExist
+	}
+
+	return io.NopCloser(bytes.NewReader(data)), nil
+}
+
+// Stat returns the size of the stored data.
+func (m *memStorage) Stat(_ context.Context, key string) (int64, error) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	data, ok := m.files[key]
+	if !ok {
+		return 0, fs.ErrNotExist
+	}
+
+	return int64(len(data)), nil
+}
+
+// List returns the files stored directly under the provided prefix.
+func (m *memStorage) List(_ context.Context, prefix string) ([]storage.Object, error) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	var files []storage.Object
+	for key, data := range m.files {
+		name, ok := strings.CutPrefix(key, prefix)
+		if ok && !strings.Contains(name, "/") {
+			files = append(files, storage.Object{Key: key, Size: int64(len(data)), Modified: m.modified[key]})
+		}
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].Key < files[j].Key })
+
+	return files, nil
+}
+
+// Remove removes the stored data, if any.
+func (m *memStorage) Remove(_ context.Context, key string) error {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	delete(m.files, key)
+	return nil
+}
+
+// Presign returns a fake download link.
+func (m *memStorage) Presign(_ context.Context, key string, expiry time.Duration) (string, error) {
+	return fmt.Sprintf("mem://%s?expiry=%s", key, expiry), nil
+}
+
+// Check always passes.
+func (m *memStorage) Check(context.Context) error {
+	return nil
+}
+
+// Close releases nothing.
+func (m *memStorage) Close() error {
+	return nil
+}
+
+func TestStorage(t *testing.T) {
+	mem := newMemStorage()
+	cfg := &s3Config{Bucket: "test-bucket", Prefix: "backups", OpenStorage: mem.opener()}
+	ctx := context.Background()
+	logger := zerolog.Nop()
+
+	// Ensure the pipeline uploads, lists and prunes archives through the storage.
+	for _, name := range []string{"dump-20260101235000.zip", "dump-20260102235000.zip"} {
+		zipPath := filepath.Join(t.TempDir(), name)
+		assert.NoError(t, os.WriteFile(zipPath, zipBytes(t, map[string]string{"users.sql": name}), 0600))
+
+		info, err := uploadZip(ctx, zipPath, cfg, &logger)
+		assert.NoError(t, err)
+		assert.Equal(t, "test-bucket", info.Bucket)
+		assert.Equal(t, "backups/"+name, info.Key)
+	}
+	assert.NoError(t, writeManifest(ctx, cfg, &archiveManifest{Key: "backups/dump-20260101235000.zip"}))
+	assert.NoError(t, checkBucket(ctx, cfg))
+
+	archives, err := listArchives(ctx, cfg)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(archives))
+	assert.Equal(t, "backups/dump-20260102235000.zip", archives[0].Key)
+
+	pruned, err := pruneArchives(ctx, cfg, time.Now().Add(time.Hour), 1, false)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(pruned))
+	assert.Equal(t, 1, len(mem.files))
+
+	// Ensure truncated uploads fail and keep the zip file.
+	mem.truncate = true
+	zipPath := filepath.Join(t.TempDir(), "dump-20260103235000.zip")
+	assert.NoError(t, os.WriteFile(zipPath, zipBytes(t, map[string]string{"users.sql": "data"}), 0600))
+	_, err = uploadZip(ctx, zipPath, cfg, &logger)
+	assert.Error(t, err)
+	_, err = os.Stat(zipPath)
+	assert.NoError(t, err)
+
+	// Ensure storages without download links report it.
+	store, err := (&s3Config{OpenStorage: openLocalDir(t.TempDir())}).openStorage(ctx)
+	assert.NoError(t, err)
+	_, err = store.Presign(ctx, "dump-20260101235000.zip", time.Hour)
+	assert.True(t, errors.Is(err, errors.ErrUnsupported))
+}
@@ -0,0 +1,155 @@
+package archiver
+
+import (
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/minio/minio-go/v7"
+	"github.com/rs/zerolog"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	// streamJobName is the job name of stream uploads in run reports.
+	streamJobName = "stream"
+	// streamPartSize is the part size of stream uploads, which bounds the memory buffering
+	// a stream of unknown size.
+	streamPartSize = 16 << 20
+)
+
+var (
+	// streamStdin indicates stdin should be uploaded instead of running the scheduler.
+	streamStdin bool
+	// streamObject is the object name of the stdin upload.
+	streamObject string
+)
+
+// countingReader counts the bytes read from the wrapped reader.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+// Read reads from the wrapped reader.
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// streamEncoder returns the object key and content type of the provided object name and a
+// writer compressing into the provided writer. The compression is selected by the object's
+// extension, zstd is used for names without a gzip (.gz) or zstd (.zst) extension, which
+// get the .zst extension appended.
+func streamEncoder(object string, w io.Writer) (string, string, io.WriteCloser, error) {
+	switch path.Ext(object) {
+	case ".gz":
+		return object, "application/gzip", gzip.NewWriter(w), nil
+
+	case ".zst":
+		enc, err := zstd.NewWriter(w)
+		return object, "application/zstd", enc, err
+
+	default:
+		enc, err := zstd.NewWriter(w)
+		return object + ".zst", "application/zstd", enc, err
+	}
+}
+
+// streamUpload compresses the provided stream and uploads it to the provided bucket as the
+// provided object. It returns the upload information and the number of bytes read from a
+// successfully uploaded stream.
+func streamUpload(ctx context.Context, in io.Reader, object string, cfg *s3Config, logger *zerolog.Logger) (minio.UploadInfo, int64, error) {
+	mnc, err := minio.New(cfg.Endpoint, cfg.Options)
+	if err != nil {
+		return minio.UploadInfo{}, 0, fmt.Errorf("creating minio client: %w", err)
+	}
+
+	pr, pw := io.Pipe()
+	key, contentType, enc, err := streamEncoder(path.Join(cfg.Prefix, object), pw)
+	if err != nil {
+		return minio.UploadInfo{}, 0, fmt.Errorf("creating compressor: %w", err)
+	}
+
+	// Compress the stream while it is uploaded.
+	src := &countingReader{r: in}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_, err := copyBuffers().copy(enc, src)
+		err = errors.Join(err, enc.Close())
+		pw.CloseWithError(err)
+	}()
+
+	opts := minio.PutObjectOptions{
+		ContentType: contentType,
+		PartSize:    streamPartSize,
+	}
+	cfg.Retention.setOptions(&opts, time.Now())
+	cfg.Checksum.setOptions(&opts)
+	setInstanceMetadata(&opts)
+
+	info, err := mnc.PutObject(ctx, cfg.Bucket, key, pr, -1, opts)
+	if err != nil {
+		// Unblock the compressor, it is not waited for as it may be blocked reading.
+		pr.CloseWithError(err)
+		logger.Error().Err(err).Str("bucket", cfg.Bucket).Str("object", key).Msg("Uploading stream")
+		return minio.UploadInfo{}, 0, err
+	}
+	<-done
+
+	logger.Info().Str("bucket", cfg.Bucket).Str("object", key).Int64("read", src.n).
+		Int64("size", info.Size).Msg("Uploaded stream")
+
+	return info, src.n, nil
+}
+
+// runStream compresses the provided stream and uploads it to the storage bucket as the
+// requested object. The outcome is sent to the configured reporters like a run of a job.
+func runStream(ctx context.Context, cfg *Config, in io.Reader, logger *zerolog.Logger) error {
+	object := strings.TrimPrefix(streamObject, "/")
+	if object == "" {
+		return errors.New("object name required (-object)")
+	}
+
+	if cfg.Bucket == "" {
+		return errors.New("bucket required")
+	}
+
+	s3Cfg := cfg.s3Config(jobConfig{
+		Bucket:           cfg.Bucket,
+		ObjectLockMode:   cfg.ObjectLockMode,
+		ObjectLockPeriod: cfg.ObjectLockPeriod,
+	}, cfg.credentials(logger))
+	reporters := cfg.reporters()
+	streamLogger := logger.With().Str("job", streamJobName).Logger()
+
+	now := time.Now()
+	result := &runResult{Job: streamJobName, Start: now, Bucket: s3Cfg.Bucket}
+	reportStart(ctx, reporters, result, &streamLogger)
+
+	ctx, span := tracer.Start(ctx, "stream", trace.WithAttributes(
+		attribute.String("bucket", s3Cfg.Bucket),
+	))
+
+	info, read, err := streamUpload(ctx, in, object, s3Cfg, &streamLogger)
+	result.Duration = time.Since(now)
+	result.Size, result.Key, result.Err = info.Size, info.Key, err
+	if err == nil {
+		result.Files = 1
+	}
+	span.SetAttributes(attribute.Int64("read", read), attribute.Int64("size", result.Size))
+	endSpan(span, result.Err)
+
+	report(ctx, reporters, result, &streamLogger)
+
+	return result.Err
+}
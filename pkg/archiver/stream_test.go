@@ -0,0 +1,86 @@
+package archiver
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/peterldowns/testy/assert"
+	"github.com/rs/zerolog"
+)
+
+func TestStreamUpload(t *testing.T) {
+	fake := newFakeS3(t, "test-bucket")
+	s3Cfg := fake.s3Config("test-bucket")
+	s3Cfg.Prefix = "streams"
+	logger := zerolog.Nop()
+	input := strings.Repeat("INSERT INTO users VALUES (1);\n", 1000)
+
+	// Ensure zstd streams are compressed with zstd.
+	info, read, err := streamUpload(context.Background(), strings.NewReader(input), "db.sql.zst", s3Cfg, &logger)
+	assert.NoError(t, err)
+	assert.Equal(t, "streams/db.sql.zst", info.Key)
+	assert.Equal(t, int64(len(input)), read)
+
+	obj := fake.object("test-bucket", "streams/db.sql.zst")
+	assert.NotEqual(t, nil, obj)
+	assert.Equal(t, "application/zstd", obj.header.Get("Content-Type"))
+	dec, err := zstd.NewReader(bytes.NewReader(obj.data))
+	assert.NoError(t, err)
+	data, err := io.ReadAll(dec)
+	assert.NoError(t, err)
+	assert.Equal(t, input, string(data))
+
+	// Ensure gzip streams are compressed with gzip.
+	_, _, err = streamUpload(context.Background(), strings.NewReader(input), "db.sql.gz", s3Cfg, &logger)
+	assert.NoError(t, err)
+
+	obj = fake.object("test-bucket", "streams/db.sql.gz")
+	assert.NotEqual(t, nil, obj)
+	gz, err := gzip.NewReader(bytes.NewReader(obj.data))
+	assert.NoError(t, err)
+	data, err = io.ReadAll(gz)
+	assert.NoError(t, err)
+	assert.Equal(t, input, string(data))
+
+	// Ensure names without a compression extension get the zstd extension.
+	info, _, err = streamUpload(context.Background(), strings.NewReader(input), "db.sql", s3Cfg, &logger)
+	assert.NoError(t, err)
+	assert.Equal(t, "streams/db.sql.zst", info.Key)
+}
+
+func TestRunStream(t *testing.T) {
+	fake := newFakeS3(t, "test-bucket")
+	s3Cfg := fake.s3Config("test-bucket")
+	logger := zerolog.Nop()
+
+	cfg := &Config{
+		Endpoint:        s3Cfg.Endpoint,
+		AccessKeyID:     "test-accesskeyid",
+		SecretAccessKey: "test-secretaccesskey",
+		Bucket:          "test-bucket",
+		staticCreds:     true,
+		transport:       s3Cfg.Options.Transport,
+	}
+
+	defer func() { streamObject = "" }()
+
+	// Ensure an object name is required.
+	err := runStream(context.Background(), cfg, strings.NewReader("dump"), &logger)
+	assert.Error(t, err)
+
+	// Ensure the stream is uploaded to the storage bucket.
+	streamObject = "db-2025-03-10.sql.zst"
+	err = runStream(context.Background(), cfg, strings.NewReader("dump"), &logger)
+	assert.NoError(t, err)
+	assert.NotEqual(t, nil, fake.object("test-bucket", "db-2025-03-10.sql.zst"))
+
+	// Ensure upload failures are returned.
+	cfg.Bucket = "missing-bucket"
+	err = runStream(context.Background(), cfg, strings.NewReader("dump"), &logger)
+	assert.Error(t, err)
+}
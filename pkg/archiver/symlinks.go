@@ -0,0 +1,88 @@
+package archiver
+
+import (
+	"archive/zip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Symlink policies.
+const (
+	// symlinksSkip leaves symbolic links out of archives.
+	symlinksSkip = "skip"
+	// symlinksFollow archives the files and directories symbolic links point to.
+	symlinksFollow = "follow"
+	// symlinksPreserve archives symbolic links as links.
+	symlinksPreserve = "preserve-as-link"
+)
+
+// validateSymlinks validates the provided symlink policy.
+func validateSymlinks(policy string) error {
+	switch policy {
+	case "", symlinksSkip, symlinksFollow, symlinksPreserve:
+		return nil
+
+	default:
+		return fmt.Errorf("invalid symlink policy %q, expected %s, %s or %s", policy,
+			symlinksSkip, symlinksFollow, symlinksPreserve)
+	}
+}
+
+// extractZipLink creates the symbolic link of the provided zip entry at the provided path
+// in the provided directory. Links pointing outside the directory are rejected, later
+// entries could otherwise be written through them.
+func extractZipLink(entry *zip.File, target string, targetDir string) error {
+	src, err := entry.Open()
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	link, err := io.ReadAll(io.LimitReader(src, 4096))
+	if err != nil {
+		return err
+	}
+
+	dest := filepath.FromSlash(string(link))
+	rel, err := filepath.Rel(targetDir, filepath.Join(filepath.Dir(target), dest))
+	if err != nil || filepath.IsAbs(dest) || !filepath.IsLocal(rel) || strings.ContainsRune(string(link), 0) {
+		return fmt.Errorf("link to %q escapes the target directory", link)
+	}
+
+	err = os.Remove(target)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	return os.Symlink(dest, target)
+}
+
+// checkNoLinks ensures no existing component of the provided path below the provided
+// directory is a symbolic link. Links are only checked textually when extracted, so later
+// entries could otherwise be written outside the directory through chains of them.
+func checkNoLinks(targetDir string, path string) error {
+	rel, err := filepath.Rel(targetDir, path)
+	if err != nil || rel == "." {
+		return err
+	}
+
+	current := targetDir
+	for _, part := range strings.Split(rel, string(filepath.Separator)) {
+		current = filepath.Join(current, part)
+		info, err := os.Lstat(current)
+		if os.IsNotExist(err) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if info.Mode()&os.ModeSymlink != 0 {
+			return fmt.Errorf("%s is a symbolic link", current)
+		}
+	}
+
+	return nil
+}
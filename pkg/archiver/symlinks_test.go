@@ -0,0 +1,136 @@
+package archiver
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/peterldowns/testy/assert"
+	"github.com/rs/zerolog"
+)
+
+func TestZipSymlinks(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("creating symlinks requires privileges on windows")
+	}
+
+	dir := t.TempDir()
+	outside := t.TempDir()
+	logger := zerolog.Nop()
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "db.sql"), []byte("dump"), 0644))
+	assert.NoError(t, os.WriteFile(filepath.Join(outside, "wal.log"), []byte("wal"), 0644))
+	assert.NoError(t, os.Symlink("db.sql", filepath.Join(dir, "latest.sql")))
+	assert.NoError(t, os.Symlink(outside, filepath.Join(dir, "wal")))
+	assert.NoError(t, os.Symlink(".", filepath.Join(dir, "loop")))
+	assert.NoError(t, os.Symlink("missing.sql", filepath.Join(dir, "broken.sql")))
+
+	zipped := func(policy string) map[string]bool {
+		files, err := zipDir(context.Background(), dir, filepath.Join(t.TempDir(), "test.zip"), zipOptions{Method: zip.Deflate, Symlinks: policy}, &logger)
+		assert.NoError(t, err)
+		return archivedPaths(runResult{Contents: files})
+	}
+
+	// Ensure skipped links are not archived.
+	assert.Equal(t, map[string]bool{"db.sql": true}, zipped(symlinksSkip))
+
+	// Ensure followed links archive their targets, skipping loops and broken links.
+	assert.Equal(t, map[string]bool{"db.sql": true, "latest.sql": true, "wal/wal.log": true}, zipped(""))
+
+	// Ensure preserved links are restored as links.
+	zipPath := filepath.Join(t.TempDir(), "links.zip")
+	files, err := zipDir(context.Background(), dir, zipPath, zipOptions{Method: zip.Deflate, Symlinks: symlinksPreserve}, &logger)
+	assert.NoError(t, err)
+	assert.Equal(t, 5, len(files))
+
+	// Links out of the target directory cannot be restored.
+	target := t.TempDir()
+	_, _, err = extractZip(zipPath, target, extractOptions{})
+	assert.Error(t, err)
+
+	assert.NoError(t, os.Remove(filepath.Join(dir, "wal")))
+	_, err = zipDir(context.Background(), dir, zipPath, zipOptions{Method: zip.Deflate, Symlinks: symlinksPreserve}, &logger)
+	assert.NoError(t, err)
+
+	target = t.TempDir()
+	_, _, err = extractZip(zipPath, target, extractOptions{})
+	assert.NoError(t, err)
+	link, err := os.Readlink(filepath.Join(target, "latest.sql"))
+	assert.NoError(t, err)
+	assert.Equal(t, "db.sql", link)
+	data, err := os.ReadFile(filepath.Join(target, "latest.sql"))
+	assert.NoError(t, err)
+	assert.Equal(t, "dump", string(data))
+}
+
+func TestExtractZipLink(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("creating symlinks requires privileges on windows")
+	}
+
+	for _, link := range []string{"../escape", "/etc/passwd", "sub/../../escape"} {
+		var buf bytes.Buffer
+		w := zip.NewWriter(&buf)
+		header := &zip.FileHeader{Name: "link"}
+		header.SetMode(os.ModeSymlink | 0777)
+		f, err := w.CreateHeader(header)
+		assert.NoError(t, err)
+		_, err = f.Write([]byte(link))
+		assert.NoError(t, err)
+		assert.NoError(t, w.Close())
+
+		zipPath := filepath.Join(t.TempDir(), "link.zip")
+		assert.NoError(t, os.WriteFile(zipPath, buf.Bytes(), 0644))
+
+		// Ensure links escaping the target directory are rejected.
+		_, _, err = extractZip(zipPath, t.TempDir(), extractOptions{})
+		assert.Error(t, err)
+	}
+}
+
+func TestValidateSymlinks(t *testing.T) {
+	assert.NoError(t, validateSymlinks(""))
+	assert.NoError(t, validateSymlinks(symlinksPreserve))
+	assert.Error(t, validateSymlinks("hardlink"))
+}
+
+func TestExtractZipLinkChain(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("creating symlinks requires privileges on windows")
+	}
+
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	for _, link := range [][2]string{{"d/l", ".."}, {"d/l/x", "../escape"}} {
+		header := &zip.FileHeader{Name: link[0]}
+		header.SetMode(os.ModeSymlink | 0777)
+		f, err := w.CreateHeader(header)
+		assert.NoError(t, err)
+		_, err = f.Write([]byte(link[1]))
+		assert.NoError(t, err)
+	}
+	f, err := w.Create("d/l/x/pwned")
+	assert.NoError(t, err)
+	_, err = f.Write([]byte("pwned"))
+	assert.NoError(t, err)
+	assert.NoError(t, w.Close())
+
+	zipPath := filepath.Join(t.TempDir(), "chain.zip")
+	assert.NoError(t, os.WriteFile(zipPath, buf.Bytes(), 0644))
+
+	// Ensure entries are not written through links extracted before them.
+	root := t.TempDir()
+	target := filepath.Join(root, "target")
+	assert.NoError(t, os.Mkdir(target, 0755))
+	assert.NoError(t, os.Mkdir(filepath.Join(root, "escape"), 0755))
+	_, _, err = extractZip(zipPath, target, extractOptions{})
+	assert.Error(t, err)
+	entries, err := os.ReadDir(root)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(entries))
+	_, err = os.Lstat(filepath.Join(root, "escape", "pwned"))
+	assert.True(t, os.IsNotExist(err))
+}
@@ -0,0 +1,28 @@
+package archiver
+
+import (
+	"fmt"
+	"net/url"
+)
+
+// syslogLocal is the syslog setting selecting the local syslog daemon, which is also read by
+// journald on systemd hosts.
+const syslogLocal = "local"
+
+// syslogTag is the tag of the entries sent to syslog.
+const syslogTag = "zdts3"
+
+// parseSyslogAddr parses the syslog setting, either local or a udp:// or tcp:// URL of a
+// remote syslog server. The network and address are empty for the local syslog daemon.
+func parseSyslogAddr(value string) (string, string, error) {
+	if value == syslogLocal {
+		return "", "", nil
+	}
+
+	u, err := url.Parse(value)
+	if err != nil || (u.Scheme != "udp" && u.Scheme != "tcp") || u.Port() == "" {
+		return "", "", fmt.Errorf("invalid syslog address %q, expected local or a udp:// or tcp:// URL with a port", value)
+	}
+
+	return u.Scheme, u.Host, nil
+}
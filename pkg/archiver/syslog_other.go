@@ -0,0 +1,32 @@
+//go:build !unix
+
+package archiver
+
+import (
+	"errors"
+
+	"github.com/rs/zerolog"
+)
+
+// syslogWriter writes log entries to syslog. It is not supported on this platform.
+type syslogWriter struct{}
+
+// openSyslog connects to syslog. It is not supported on this platform.
+func openSyslog(string, string) (*syslogWriter, error) {
+	return nil, errors.ErrUnsupported
+}
+
+// Write is not supported on this platform.
+func (s *syslogWriter) Write([]byte) (int, error) {
+	return 0, errors.ErrUnsupported
+}
+
+// WriteLevel is not supported on this platform.
+func (s *syslogWriter) WriteLevel(zerolog.Level, []byte) (int, error) {
+	return 0, errors.ErrUnsupported
+}
+
+// Close is not supported on this platform.
+func (s *syslogWriter) Close() error {
+	return errors.ErrUnsupported
+}
@@ -0,0 +1,81 @@
+package archiver
+
+import (
+	"net"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/peterldowns/testy/assert"
+	"github.com/rs/zerolog"
+)
+
+func TestParseSyslogAddr(t *testing.T) {
+	tests := []struct {
+		value   string
+		network string
+		addr    string
+		wantErr bool
+	}{
+		{value: "local"},
+		{value: "udp://logs.example.com:514", network: "udp", addr: "logs.example.com:514"},
+		{value: "tcp://10.0.0.1:601", network: "tcp", addr: "10.0.0.1:601"},
+		{value: "udp://logs.example.com", wantErr: true},
+		{value: "http://logs.example.com:514", wantErr: true},
+		{value: "logs.example.com:514", wantErr: true},
+	}
+
+	for _, test := range tests {
+		network, addr, err := parseSyslogAddr(test.value)
+		if test.wantErr {
+			assert.Error(t, err)
+			continue
+		}
+		assert.NoError(t, err)
+		assert.Equal(t, test.network, network)
+		assert.Equal(t, test.addr, addr)
+	}
+}
+
+func TestSyslogWriter(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("syslog is not supported on windows")
+	}
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer conn.Close()
+
+	w, err := openSyslog("udp", conn.LocalAddr().String())
+	assert.NoError(t, err)
+	defer w.Close()
+
+	buf := make([]byte, 4096)
+	read := func() string {
+		assert.NoError(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+		n, _, err := conn.ReadFrom(buf)
+		assert.NoError(t, err)
+		return string(buf[:n])
+	}
+
+	// Ensure entries carry the daemon facility (3) with the priority of their level.
+	_, err = w.WriteLevel(zerolog.InfoLevel, []byte(`{"level":"info","message":"archived"}`))
+	assert.NoError(t, err)
+	msg := read()
+	assert.True(t, strings.HasPrefix(msg, "<30>"))
+	assert.True(t, strings.Contains(msg, syslogTag))
+	assert.True(t, strings.Contains(msg, `"message":"archived"`))
+
+	_, err = w.WriteLevel(zerolog.WarnLevel, []byte("slow upload"))
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(read(), "<28>"))
+
+	_, err = w.WriteLevel(zerolog.ErrorLevel, []byte("upload failed"))
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(read(), "<27>"))
+
+	_, err = w.WriteLevel(zerolog.DebugLevel, []byte("zipped"))
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(read(), "<31>"))
+}
@@ -0,0 +1,60 @@
+//go:build unix
+
+package archiver
+
+import (
+	"fmt"
+	"log/syslog"
+
+	"github.com/rs/zerolog"
+)
+
+// syslogWriter writes log entries to syslog with the priorities of their levels.
+type syslogWriter struct {
+	w *syslog.Writer
+}
+
+// openSyslog connects to the syslog server at the provided address, the local syslog daemon
+// if the network is empty.
+func openSyslog(network string, addr string) (*syslogWriter, error) {
+	w, err := syslog.Dial(network, addr, syslog.LOG_INFO|syslog.LOG_DAEMON, syslogTag)
+	if err != nil {
+		return nil, fmt.Errorf("connecting to syslog: %w", err)
+	}
+
+	return &syslogWriter{w: w}, nil
+}
+
+// Write writes a log entry without a level as an informational message.
+func (s *syslogWriter) Write(p []byte) (int, error) {
+	return s.WriteLevel(zerolog.NoLevel, p)
+}
+
+// WriteLevel writes a log entry with the syslog priority of the provided level.
+func (s *syslogWriter) WriteLevel(level zerolog.Level, p []byte) (int, error) {
+	var err error
+	switch level {
+	case zerolog.TraceLevel, zerolog.DebugLevel:
+		err = s.w.Debug(string(p))
+	case zerolog.WarnLevel:
+		err = s.w.Warning(string(p))
+	case zerolog.ErrorLevel:
+		err = s.w.Err(string(p))
+	case zerolog.FatalLevel:
+		err = s.w.Crit(string(p))
+	case zerolog.PanicLevel:
+		err = s.w.Alert(string(p))
+	default:
+		err = s.w.Info(string(p))
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	return len(p), nil
+}
+
+// Close closes the connection to syslog.
+func (s *syslogWriter) Close() error {
+	return s.w.Close()
+}
@@ -0,0 +1,95 @@
+package archiver
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-co-op/gocron/v2"
+	"github.com/rs/zerolog"
+)
+
+const (
+	// sdReady notifies systemd that startup completed.
+	sdReady = "READY=1"
+	// sdReloading notifies systemd that the configuration is being reloaded.
+	sdReloading = "RELOADING=1"
+	// sdStopping notifies systemd that shutdown started.
+	sdStopping = "STOPPING=1"
+	// sdWatchdog is the systemd watchdog keepalive.
+	sdWatchdog = "WATCHDOG=1"
+)
+
+// sdNotify sends the provided state to the systemd notification socket. It reports whether
+// the state was sent, which is not the case when not running under systemd with
+// notifications enabled.
+func sdNotify(state string) (bool, error) {
+	socket := os.Getenv("NOTIFY_SOCKET")
+	if socket == "" {
+		return false, nil
+	}
+
+	// Abstract namespace sockets are prefixed with @ in the environment.
+	if socket[0] == '@' {
+		socket = "\x00" + socket[1:]
+	}
+
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		return false, fmt.Errorf("connecting to systemd notification socket: %w", err)
+	}
+	defer conn.Close()
+
+	_, err = conn.Write([]byte(state))
+	if err != nil {
+		return false, fmt.Errorf("sending systemd notification: %w", err)
+	}
+
+	return true, nil
+}
+
+// watchdogInterval returns the interval watchdog keepalives should be sent at, half of the
+// systemd watchdog timeout. It returns zero when the watchdog is not enabled for the process.
+func watchdogInterval() time.Duration {
+	usec, err := strconv.ParseInt(os.Getenv("WATCHDOG_USEC"), 10, 64)
+	if err != nil || usec <= 0 {
+		return 0
+	}
+
+	pid := os.Getenv("WATCHDOG_PID")
+	if pid != "" && pid != strconv.Itoa(os.Getpid()) {
+		return 0
+	}
+
+	return time.Duration(usec) * time.Microsecond / 2
+}
+
+// handleWatchdog sends systemd watchdog keepalives while the scheduler is responsive, until
+// the context is cancelled. A wedged scheduler stops the keepalives so systemd restarts the
+// service.
+func handleWatchdog(ctx context.Context, s gocron.Scheduler, interval time.Duration, logger *zerolog.Logger, wg *sync.WaitGroup) {
+	defer wg.Done()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+
+		case <-ticker.C:
+			// Listing the jobs round trips through the scheduler's run loop.
+			s.Jobs()
+
+			_, err := sdNotify(sdWatchdog)
+			if err != nil {
+				logger.Error().Err(err).Msg("Sending watchdog keepalive")
+			}
+		}
+	}
+}
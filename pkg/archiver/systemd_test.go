@@ -0,0 +1,57 @@
+package archiver
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/peterldowns/testy/assert"
+)
+
+func TestSdNotify(t *testing.T) {
+	// Ensure notifying is a no-op when not running under systemd.
+	t.Setenv("NOTIFY_SOCKET", "")
+	sent, err := sdNotify(sdReady)
+	assert.NoError(t, err)
+	assert.False(t, sent)
+
+	// Ensure the state is sent to the notification socket.
+	dir, err := os.MkdirTemp("", "sd")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	socket := filepath.Join(dir, "notify.sock")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: socket, Net: "unixgram"})
+	assert.NoError(t, err)
+	defer conn.Close()
+
+	t.Setenv("NOTIFY_SOCKET", socket)
+	sent, err = sdNotify(sdReady)
+	assert.NoError(t, err)
+	assert.True(t, sent)
+
+	buf := make([]byte, 64)
+	err = conn.SetReadDeadline(time.Now().Add(time.Second))
+	assert.NoError(t, err)
+	n, err := conn.Read(buf)
+	assert.NoError(t, err)
+	assert.Equal(t, sdReady, string(buf[:n]))
+}
+
+func TestWatchdogInterval(t *testing.T) {
+	// Ensure the watchdog is disabled without a timeout.
+	t.Setenv("WATCHDOG_USEC", "")
+	t.Setenv("WATCHDOG_PID", "")
+	assert.Equal(t, time.Duration(0), watchdogInterval())
+
+	// Ensure keepalives are sent at half the timeout.
+	t.Setenv("WATCHDOG_USEC", "30000000")
+	assert.Equal(t, 15*time.Second, watchdogInterval())
+
+	// Ensure the watchdog is disabled when it targets another process.
+	t.Setenv("WATCHDOG_PID", strconv.Itoa(os.Getpid()+1))
+	assert.Equal(t, time.Duration(0), watchdogInterval())
+}
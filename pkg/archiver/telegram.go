@@ -0,0 +1,83 @@
+package archiver
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// telegramAPI is the Telegram Bot API base URL.
+const telegramAPI = "https://api.telegram.org"
+
+// telegram sends run notifications to a Telegram chat through a bot.
+type telegram struct {
+	api    string
+	token  string
+	chatID string
+	filter *eventFilter
+	client *http.Client
+}
+
+// newTelegram creates a reporter notifying the provided chat through the bot with the
+// provided token.
+func newTelegram(token string, chatID string, filter *eventFilter) *telegram {
+	return &telegram{
+		api:    telegramAPI,
+		token:  token,
+		chatID: chatID,
+		filter: filter,
+		client: &http.Client{},
+	}
+}
+
+// name returns the name of the reporter.
+func (t *telegram) name() string {
+	return "telegram"
+}
+
+// report sends a summary of the provided run to the chat, if the run matches the configured
+// notification events.
+func (t *telegram) report(ctx context.Context, result *runResult) error {
+	if !t.filter.matches(result) {
+		return nil
+	}
+
+	icon := "✅"
+	if result.Err != nil {
+		icon = "❌"
+	} else if result.hasErrors() {
+		icon = "⚠️"
+	}
+
+	return t.send(ctx, icon+" "+runSummary(result))
+}
+
+// reportUsage sends a summary of the provided storage usage to the chat.
+func (t *telegram) reportUsage(ctx context.Context, usage *storageUsage) error {
+	return t.send(ctx, "📊 "+usageSummary(usage))
+}
+
+// reportDrill sends a summary of the provided restore drill to the chat.
+func (t *telegram) reportDrill(ctx context.Context, result *drillResult) error {
+	icon := "✅"
+	if result.Err != nil {
+		icon = "❌"
+	}
+
+	return t.send(ctx, icon+" "+drillSummary(result))
+}
+
+// send sends the provided text to the chat.
+func (t *telegram) send(ctx context.Context, text string) error {
+	err := postJSON(ctx, t.client, t.api+"/bot"+t.token+"/sendMessage", map[string]string{
+		"chat_id": t.chatID,
+		"text":    text,
+	})
+	if err != nil {
+		// The request URL embeds the bot token, keep it out of the logs.
+		return fmt.Errorf("notifying telegram: %s", strings.ReplaceAll(err.Error(), t.token, "<token>"))
+	}
+
+	return nil
+}
@@ -0,0 +1,44 @@
+package archiver
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/peterldowns/testy/assert"
+)
+
+func TestTelegram(t *testing.T) {
+	var path string
+	var message map[string]string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		err := json.NewDecoder(r.Body).Decode(&message)
+		assert.NoError(t, err)
+	}))
+	defer srv.Close()
+
+	filter, err := parseEventFilter("on-failure")
+	assert.NoError(t, err)
+
+	bot := newTelegram("123:test-token", "-100200", filter)
+	bot.api = srv.URL
+	ctx := context.Background()
+
+	// Ensure failures are sent to the chat.
+	err = bot.report(ctx, &runResult{Job: "db", Err: errors.New("upload failed")})
+	assert.NoError(t, err)
+	assert.Equal(t, "/bot123:test-token/sendMessage", path)
+	assert.Equal(t, "-100200", message["chat_id"])
+	assert.True(t, strings.Contains(message["text"], "upload failed"))
+
+	// Ensure the bot token is not leaked in errors.
+	bot.api = "http://127.0.0.1:0"
+	err = bot.report(ctx, &runResult{Job: "db", Err: errors.New("upload failed")})
+	assert.Error(t, err)
+	assert.False(t, strings.Contains(err.Error(), "test-token"))
+}
@@ -0,0 +1,125 @@
+package archiver
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// throttleMinBackoff is the backoff of the requests to a storage host after it throttled a
+	// request, doubled with every consecutive throttled request.
+	throttleMinBackoff = time.Second
+	// throttleMaxBackoff bounds the backoff of the requests to a throttling storage host,
+	// including the delays the host asks for.
+	throttleMaxBackoff = 2 * time.Minute
+)
+
+// throttles holds the hostThrottle of every storage host requests were sent to, by host.
+var throttles sync.Map
+
+// hostThrottle is the backoff of the requests to a storage host which throttled them.
+type hostThrottle struct {
+	mtx     sync.Mutex
+	until   time.Time
+	backoff time.Duration
+}
+
+// wait waits until requests may be sent to the host again, or the provided context is done.
+func (h *hostThrottle) wait(ctx context.Context) error {
+	h.mtx.Lock()
+	delay := time.Until(h.until)
+	h.mtx.Unlock()
+	if delay <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// update adapts the backoff of the host to the provided response at the provided time and
+// returns the delay of the next requests. Throttled responses hold the requests back by the
+// delay they ask for, or by a backoff doubled with every consecutive throttled response.
+// Other responses reset the backoff.
+func (h *hostThrottle) update(resp *http.Response, now time.Time) time.Duration {
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+
+	if resp.StatusCode != http.StatusTooManyRequests && resp.StatusCode != http.StatusServiceUnavailable {
+		h.backoff = 0
+		return 0
+	}
+
+	h.backoff = min(max(h.backoff*2, throttleMinBackoff), throttleMaxBackoff)
+	delay := h.backoff
+	if after, ok := parseRetryAfter(resp.Header.Get("Retry-After"), now); ok {
+		delay = min(after, throttleMaxBackoff)
+	}
+
+	if now.Add(delay).After(h.until) {
+		h.until = now.Add(delay)
+	}
+
+	return delay
+}
+
+// parseRetryAfter parses the provided Retry-After header value, a number of seconds or an
+// HTTP date, into the delay it asks for at the provided time.
+func parseRetryAfter(value string, now time.Time) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+
+	seconds, err := strconv.Atoi(value)
+	if err == nil {
+		return max(time.Duration(seconds)*time.Second, 0), true
+	}
+
+	date, err := http.ParseTime(value)
+	if err != nil {
+		return 0, false
+	}
+
+	return max(date.Sub(now), 0), true
+}
+
+// throttleTransport holds back the requests to storage hosts which throttle them, with 429
+// Too Many Requests or 503 Slow Down responses. The responses are returned as they are, the
+// retries of the S3 client wait for the backoff of the host like every other request to it.
+type throttleTransport struct {
+	base http.RoundTripper
+}
+
+// RoundTrip sends the provided request once its host accepts requests again.
+func (t *throttleTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	value, _ := throttles.LoadOrStore(req.URL.Host, &hostThrottle{})
+	throttle := value.(*hostThrottle)
+
+	err := throttle.wait(req.Context())
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	delay := throttle.update(resp, time.Now())
+	if logger := requestLogger.Load(); logger != nil && delay > 0 {
+		logger.Warn().Str("host", req.URL.Host).Int("status", resp.StatusCode).Dur("backoff", delay).
+			Msg("Storage throttling requests, backing off")
+	}
+
+	return resp, nil
+}
@@ -0,0 +1,69 @@
+package archiver
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/peterldowns/testy/assert"
+)
+
+func TestHostThrottle(t *testing.T) {
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	response := func(status int, retryAfter string) *http.Response {
+		resp := &http.Response{StatusCode: status, Header: http.Header{}}
+		if retryAfter != "" {
+			resp.Header.Set("Retry-After", retryAfter)
+		}
+		return resp
+	}
+
+	// Ensure the backoff doubles with consecutive throttled responses, up to its maximum.
+	throttle := &hostThrottle{}
+	assert.Equal(t, throttleMinBackoff, throttle.update(response(http.StatusServiceUnavailable, ""), now))
+	assert.Equal(t, 2*throttleMinBackoff, throttle.update(response(http.StatusTooManyRequests, ""), now))
+	assert.Equal(t, now.Add(2*throttleMinBackoff), throttle.until)
+	for range 10 {
+		throttle.update(response(http.StatusServiceUnavailable, ""), now)
+	}
+	assert.Equal(t, throttleMaxBackoff, throttle.backoff)
+
+	// Ensure other responses reset the backoff.
+	assert.Equal(t, time.Duration(0), throttle.update(response(http.StatusOK, ""), now))
+	assert.Equal(t, throttleMinBackoff, throttle.update(response(http.StatusServiceUnavailable, ""), now))
+
+	// Ensure Retry-After delays are honored, as seconds or dates, up to the maximum backoff.
+	throttle = &hostThrottle{}
+	assert.Equal(t, 5*time.Second, throttle.update(response(http.StatusServiceUnavailable, "5"), now))
+	assert.Equal(t, now.Add(5*time.Second), throttle.until)
+	date := now.Add(30 * time.Second).Format(http.TimeFormat)
+	assert.Equal(t, 30*time.Second, throttle.update(response(http.StatusTooManyRequests, date), now))
+	assert.Equal(t, throttleMaxBackoff, throttle.update(response(http.StatusServiceUnavailable, "3600"), now))
+
+	// Ensure invalid Retry-After headers fall back to the backoff.
+	throttle = &hostThrottle{}
+	assert.Equal(t, throttleMinBackoff, throttle.update(response(http.StatusServiceUnavailable, "soon"), now))
+
+	// Ensure waiting for a throttled host stops with its context.
+	throttle = &hostThrottle{until: time.Now().Add(time.Hour)}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.Error(t, throttle.wait(ctx))
+}
+
+func TestThrottleTransport(t *testing.T) {
+	fake := newFakeS3(t, "test-bucket")
+	cfg := &Config{transport: fake.srv.Client().Transport}
+	s3Cfg := fake.s3Config("test-bucket")
+	s3Cfg.Options.Transport = cfg.storageTransport()
+
+	// Ensure throttled requests are retried once the delay the bucket asked for passed.
+	fake.mtx.Lock()
+	fake.throttled = 1
+	fake.mtx.Unlock()
+	start := time.Now()
+	putArchives(t, s3Cfg, map[string][]byte{"dump-20260101000000.zip": []byte("archive")})
+	assert.True(t, time.Since(start) >= time.Second)
+	assert.Equal(t, "archive", string(fake.object("test-bucket", "dump-20260101000000.zip").data))
+}
@@ -0,0 +1,57 @@
+package archiver
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/peterldowns/testy/assert"
+	"github.com/rs/zerolog"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestTracingEnabled(t *testing.T) {
+	t.Setenv("OTEL_EXPORTER_OTLP_ENDPOINT", "")
+	t.Setenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT", "")
+	t.Setenv("OTEL_SDK_DISABLED", "")
+	assert.False(t, tracingEnabled())
+
+	t.Setenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT", "http://127.0.0.1:4318/v1/traces")
+	assert.True(t, tracingEnabled())
+
+	// Ensure the SDK can be disabled regardless of the endpoint.
+	t.Setenv("OTEL_SDK_DISABLED", "true")
+	assert.False(t, tracingEnabled())
+}
+
+func TestArchiveSpans(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+
+	dir := t.TempDir()
+	err := os.WriteFile(filepath.Join(dir, "test.txt"), []byte("Hello!"), 0o644)
+	assert.NoError(t, err)
+
+	s3 := newFakeS3(t, "test-bucket")
+	logger := zerolog.Nop()
+	job := jobConfig{Name: "db", SourceDir: dir, Retention: "24h"}
+	archive(context.Background(), job, s3.s3Config("test-bucket"), nil, &logger)
+
+	// Ensure every pipeline stage is a child span of the run.
+	spans := recorder.Ended()
+	assert.Equal(t, 4, len(spans))
+
+	names := make([]string, 0, len(spans))
+	root := spans[len(spans)-1]
+	for _, span := range spans[:len(spans)-1] {
+		names = append(names, span.Name())
+		assert.Equal(t, root.SpanContext().SpanID(), span.Parent().SpanID())
+	}
+	assert.Equal(t, "archive", root.Name())
+	assert.Equal(t, codes.Unset, root.Status().Code)
+	assert.Equal(t, []string{"purge", "zip", "upload"}, names)
+}
@@ -0,0 +1,107 @@
+package archiver
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/rs/zerolog"
+)
+
+// defaultTransport is the HTTP transport of storage requests when none is configured, shared
+// by every client so connections are reused across runs.
+var defaultTransport = sync.OnceValue(func() http.RoundTripper {
+	transport, err := minio.DefaultTransport(true)
+	if err != nil {
+		return http.DefaultTransport
+	}
+
+	return transport
+})
+
+// requestLogger is the logger of storage requests, nil until logging is set up.
+var requestLogger atomic.Pointer[zerolog.Logger]
+
+// setRequestLogger sets the logger storage requests are logged to at debug level.
+func setRequestLogger(logger *zerolog.Logger) {
+	requestLogger.Store(logger)
+}
+
+// tracingTransport logs every request it sends at debug level, with the request ID the
+// storage assigned it, so throttling and errors can be taken up with the provider.
+type tracingTransport struct {
+	base http.RoundTripper
+}
+
+// RoundTrip sends the provided request, logging its outcome when debug logging is enabled.
+func (t *tracingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	logger := requestLogger.Load()
+	if logger == nil || zerolog.GlobalLevel() > zerolog.DebugLevel {
+		return t.base.RoundTrip(req)
+	}
+
+	start := time.Now()
+	resp, err := t.base.RoundTrip(req)
+	event := logger.Debug().Str("method", req.Method).Str("host", req.URL.Host).Str("path", req.URL.Path).
+		Dur("duration", time.Since(start))
+	if err != nil {
+		event.Err(err).Msg("Storage request failed")
+		return nil, err
+	}
+
+	event.Int("status", resp.StatusCode).Str("requestId", resp.Header.Get("X-Amz-Request-Id")).
+		Str("hostId", resp.Header.Get("X-Amz-Id-2")).Msg("Storage request")
+	return resp, nil
+}
+
+// userAgentTransport sets the User-Agent header of the requests it sends.
+type userAgentTransport struct {
+	base  http.RoundTripper
+	agent string
+}
+
+// RoundTrip sends the provided request with the configured User-Agent.
+func (t *userAgentTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.Header.Set("User-Agent", t.agent)
+
+	return t.base.RoundTrip(req)
+}
+
+// userAgent returns the User-Agent of storage requests, identifying the tool, its version and
+// the host in access logs unless configured otherwise.
+func (c *Config) userAgent() string {
+	if c.UserAgent != "" {
+		return c.UserAgent
+	}
+
+	version := getBuildInfo().Version
+	if version == "" {
+		version = "dev"
+	}
+
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "unknown"
+	}
+
+	return fmt.Sprintf("zdts3/%s host=%s", version, hostname)
+}
+
+// storageTransport returns the HTTP transport of storage requests, backing off from
+// throttling hosts and tracing the requests at debug level.
+func (c *Config) storageTransport() http.RoundTripper {
+	base := c.transport
+	if base == nil {
+		base = defaultTransport()
+	}
+
+	return &userAgentTransport{
+		base:  &throttleTransport{base: &tracingTransport{base: base}},
+		agent: c.userAgent(),
+	}
+}
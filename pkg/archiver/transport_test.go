@@ -0,0 +1,84 @@
+package archiver
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/peterldowns/testy/assert"
+	"github.com/rs/zerolog"
+)
+
+func TestUserAgent(t *testing.T) {
+	fake := newFakeS3(t, "test-bucket")
+	s3Cfg := fake.s3Config("test-bucket")
+	cfg := &Config{
+		Endpoint:        s3Cfg.Endpoint,
+		AccessKeyID:     "test-accesskeyid",
+		SecretAccessKey: "test-secretaccesskey",
+		staticCreds:     true,
+		transport:       s3Cfg.Options.Transport,
+	}
+	logger := zerolog.Nop()
+	upload := func(name string) string {
+		zipPath := filepath.Join(t.TempDir(), name)
+		assert.NoError(t, os.WriteFile(zipPath, []byte("archive"), 0644))
+		_, err := uploadZip(context.Background(), zipPath, cfg.s3Config(jobConfig{Bucket: "test-bucket"}, cfg.credentials(&logger)), &logger)
+		assert.NoError(t, err)
+		return fake.object("test-bucket", name).header.Get("User-Agent")
+	}
+
+	// Ensure requests identify the tool and the host by default.
+	hostname, err := os.Hostname()
+	assert.NoError(t, err)
+	agent := upload("dump-20260101000000.zip")
+	assert.True(t, strings.HasPrefix(agent, "zdts3/"))
+	assert.True(t, strings.HasSuffix(agent, " host="+hostname))
+
+	// Ensure the User-Agent can be configured.
+	cfg.UserAgent = "backups-prod"
+	assert.Equal(t, "backups-prod", upload("dump-20260102000000.zip"))
+}
+
+func TestTracingTransport(t *testing.T) {
+	fake := newFakeS3(t, "test-bucket")
+	cfg := &Config{transport: fake.srv.Client().Transport}
+	s3Cfg := fake.s3Config("test-bucket")
+	s3Cfg.Options.Transport = cfg.storageTransport()
+	ctx := context.Background()
+
+	var out bytes.Buffer
+	logger := zerolog.New(&out)
+	setRequestLogger(&logger)
+	level := zerolog.GlobalLevel()
+	t.Cleanup(func() {
+		setRequestLogger(nil)
+		zerolog.SetGlobalLevel(level)
+	})
+
+	// Ensure requests are not logged above debug level.
+	zerolog.SetGlobalLevel(zerolog.InfoLevel)
+	_, err := listArchives(ctx, s3Cfg)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, out.Len())
+
+	// Ensure requests are logged with their outcome and request ID at debug level.
+	zerolog.SetGlobalLevel(zerolog.DebugLevel)
+	putArchives(t, s3Cfg, map[string][]byte{"dump-20260101000000.zip": []byte("archive")})
+	var entry struct {
+		Method    string `json:"method"`
+		Path      string `json:"path"`
+		Status    int    `json:"status"`
+		RequestID string `json:"requestId"`
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	assert.NoError(t, json.Unmarshal([]byte(lines[len(lines)-1]), &entry))
+	assert.Equal(t, "PUT", entry.Method)
+	assert.Equal(t, "/test-bucket/dump-20260101000000.zip", entry.Path)
+	assert.Equal(t, 200, entry.Status)
+	assert.NotEqual(t, "", entry.RequestID)
+}
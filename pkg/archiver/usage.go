@@ -0,0 +1,183 @@
+package archiver
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/dustin/go-humanize"
+	"github.com/rs/zerolog"
+)
+
+// usageCheckInterval is the interval at which the usage report interval of the active
+// configuration is checked.
+const usageCheckInterval = time.Minute
+
+// prefixUsage is the storage used by the archives under a prefix of a bucket.
+type prefixUsage struct {
+	Bucket   string
+	Prefix   string
+	Archives int
+	Bytes    int64
+	// MonthlyCost is the estimated monthly cost of storing the archives.
+	MonthlyCost float64
+}
+
+// storageUsage is the storage used by the archives of every job.
+type storageUsage struct {
+	Time     time.Time
+	Prefixes []prefixUsage
+	Archives int
+	Bytes    int64
+	// MonthlyCost is the estimated monthly cost of storing every archive.
+	MonthlyCost float64
+}
+
+// usageReporter is a run reporter that also reports storage usage.
+type usageReporter interface {
+	runReporter
+	// reportUsage reports the provided storage usage.
+	reportUsage(ctx context.Context, usage *storageUsage) error
+}
+
+// measureUsage sums the sizes of the archives of every job of the provided configuration per
+// bucket and prefix, and estimates their monthly cost at the configured price per GB. Jobs
+// sharing a bucket and prefix are counted once. Prefixes which cannot be listed are skipped
+// and reported in the returned error.
+func measureUsage(ctx context.Context, cfg *Config, logger *zerolog.Logger) (*storageUsage, error) {
+	creds := cfg.credentials(logger)
+	costPerGB := cfg.storageCost()
+	usage := &storageUsage{Time: time.Now()}
+
+	var errs error
+	measured := make(map[string]bool)
+	for _, job := range cfg.jobs() {
+		s3Cfg := cfg.s3Config(job, creds)
+		prefix := archivePrefix(s3Cfg)
+		if measured[s3Cfg.Bucket+"/"+prefix] {
+			continue
+		}
+		measured[s3Cfg.Bucket+"/"+prefix] = true
+
+		archives, err := listArchives(ctx, s3Cfg)
+		if err != nil {
+			errs = errors.Join(errs, fmt.Errorf("job %s: %w", job.Name, err))
+			continue
+		}
+
+		entry := prefixUsage{Bucket: s3Cfg.Bucket, Prefix: prefix, Archives: len(archives)}
+		for _, archive := range archives {
+			entry.Bytes += archive.Size
+		}
+		// Providers bill decimal gigabytes.
+		entry.MonthlyCost = float64(entry.Bytes) / 1e9 * costPerGB
+
+		usage.Prefixes = append(usage.Prefixes, entry)
+		usage.Archives += entry.Archives
+		usage.Bytes += entry.Bytes
+		usage.MonthlyCost += entry.MonthlyCost
+	}
+
+	return usage, errs
+}
+
+// usageSummary returns a human readable summary of the provided storage usage, a line per
+// prefix after the totals.
+func usageSummary(usage *storageUsage) string {
+	instance := instanceName()
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "zdts3 storage usage on %s: %d archives, %s, est. $%.2f/month", instance,
+		usage.Archives, humanize.IBytes(uint64(usage.Bytes)), usage.MonthlyCost)
+	for _, entry := range usage.Prefixes {
+		fmt.Fprintf(&b, "\n%s/%s: %d archives, %s, est. $%.2f/month", entry.Bucket, entry.Prefix,
+			entry.Archives, humanize.IBytes(uint64(entry.Bytes)), entry.MonthlyCost)
+	}
+
+	return b.String()
+}
+
+// reportUsage sends the provided storage usage to every reporter reporting storage usage.
+// Reporting failures are logged.
+func reportUsage(ctx context.Context, reporters []runReporter, usage *storageUsage, logger *zerolog.Logger) {
+	ctx, cancel := context.WithTimeout(ctx, reportTimeout)
+	defer cancel()
+
+	for _, reporter := range reporters {
+		usageReporter, ok := reporter.(usageReporter)
+		if !ok {
+			continue
+		}
+
+		err := usageReporter.reportUsage(ctx, usage)
+		if err != nil {
+			logger.Error().Err(err).Str("reporter", reporter.name()).Msg("Reporting storage usage")
+		}
+	}
+}
+
+// runUsageReports measures and reports the storage usage of the active configuration every
+// configured usage report interval until the context is cancelled. The first report is
+// sent an interval after startup.
+func runUsageReports(ctx context.Context, active func() *Config, logger *zerolog.Logger, wg *sync.WaitGroup) {
+	defer wg.Done()
+
+	ticker := time.NewTicker(usageCheckInterval)
+	defer ticker.Stop()
+
+	last := time.Now()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+
+		case now := <-ticker.C:
+			cfg := active()
+			interval := cfg.usageInterval()
+			if interval == 0 || now.Sub(last) < interval {
+				continue
+			}
+			last = now
+
+			usage, err := measureUsage(ctx, cfg, logger)
+			if err != nil {
+				logger.Error().Err(err).Msg("Measuring storage usage")
+			}
+
+			logger.Info().Int("archives", usage.Archives).Int64("bytes", usage.Bytes).
+				Float64("monthlyCost", usage.MonthlyCost).Msg("Storage usage")
+			reportUsage(ctx, cfg.reporters(), usage, logger)
+		}
+	}
+}
+
+// runReportCommand prints the storage usage of the archives of every job.
+func runReportCommand(cfg *Config, args []string, out io.Writer) error {
+	fs := flag.NewFlagSet("report", flag.ContinueOnError)
+	err := fs.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	logger := zerolog.Nop()
+	usage, err := measureUsage(context.Background(), cfg, &logger)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "BUCKET\tPREFIX\tARCHIVES\tSIZE\tCOST/MONTH")
+	for _, entry := range usage.Prefixes {
+		fmt.Fprintf(w, "%s\t%s\t%d\t%s\t$%.2f\n", entry.Bucket, entry.Prefix, entry.Archives,
+			humanize.IBytes(uint64(entry.Bytes)), entry.MonthlyCost)
+	}
+	fmt.Fprintf(w, "TOTAL\t\t%d\t%s\t$%.2f\n", usage.Archives, humanize.IBytes(uint64(usage.Bytes)), usage.MonthlyCost)
+
+	return w.Flush()
+}
@@ -0,0 +1,113 @@
+package archiver
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/peterldowns/testy/assert"
+	"github.com/rs/zerolog"
+)
+
+// usageConfig returns a configuration of two jobs of the provided fake server's test bucket
+// storing 3 archives of 1000 bytes, at a price per GB showing cents for such small archives.
+func usageConfig(t *testing.T, fake *fakeS3) *Config {
+	s3Cfg := fake.s3Config("test-bucket")
+	data := bytes.Repeat([]byte("a"), 1000)
+	putArchives(t, s3Cfg, map[string][]byte{
+		"db/dump-20260101235000.zip":   data,
+		"db/dump-20260102235000.zip":   data,
+		"logs/dump-20260101235000.zip": data,
+		"logs/catalog/logs.jsonl.gz":   data,
+	})
+
+	return &Config{
+		Endpoint:        s3Cfg.Endpoint,
+		AccessKeyID:     "test-accesskeyid",
+		SecretAccessKey: "test-secretaccesskey",
+		StorageCost:     "20000",
+		Jobs: []jobConfig{
+			{Name: "db", SourceDir: t.TempDir(), Bucket: "test-bucket", Prefix: "db"},
+			{Name: "db-replica", SourceDir: t.TempDir(), Bucket: "test-bucket", Prefix: "db"},
+			{Name: "logs", SourceDir: t.TempDir(), Bucket: "test-bucket", Prefix: "logs"},
+		},
+		staticCreds: true,
+		transport:   s3Cfg.Options.Transport,
+	}
+}
+
+func TestMeasureUsage(t *testing.T) {
+	cfg := usageConfig(t, newFakeS3(t, "test-bucket"))
+	logger := zerolog.Nop()
+
+	// Ensure archive sizes are summed per prefix, once per prefix.
+	usage, err := measureUsage(context.Background(), cfg, &logger)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(usage.Prefixes))
+	assert.Equal(t, "db/", usage.Prefixes[0].Prefix)
+	assert.Equal(t, 2, usage.Prefixes[0].Archives)
+	assert.Equal(t, int64(2000), usage.Prefixes[0].Bytes)
+	assert.True(t, usage.Prefixes[0].MonthlyCost > 0.0399 && usage.Prefixes[0].MonthlyCost < 0.0401)
+	assert.Equal(t, 3, usage.Archives)
+	assert.Equal(t, int64(3000), usage.Bytes)
+	assert.True(t, usage.MonthlyCost > 0.0599 && usage.MonthlyCost < 0.0601)
+
+	// Ensure missing buckets are reported along with the measured prefixes.
+	cfg.Jobs = append(cfg.Jobs, jobConfig{Name: "missing", SourceDir: t.TempDir(), Bucket: "missing-bucket"})
+	usage, err = measureUsage(context.Background(), cfg, &logger)
+	assert.Error(t, err)
+	assert.Equal(t, 2, len(usage.Prefixes))
+}
+
+func TestReportCommand(t *testing.T) {
+	cfg := usageConfig(t, newFakeS3(t, "test-bucket"))
+
+	var out bytes.Buffer
+	err := runCommand(cfg, []string{"report"}, &out)
+	assert.NoError(t, err)
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	assert.Equal(t, 4, len(lines))
+	assert.Equal(t, []string{"test-bucket", "db/", "2", "2.0", "KiB", "$0.04"}, strings.Fields(lines[1]))
+	assert.Equal(t, []string{"TOTAL", "3", "2.9", "KiB", "$0.06"}, strings.Fields(lines[3]))
+}
+
+func TestUsageMetrics(t *testing.T) {
+	usage := &storageUsage{Prefixes: []prefixUsage{{Bucket: "test-bucket", Prefix: "db/", Archives: 2, Bytes: 2000, MonthlyCost: 0.04}}}
+
+	// Ensure StatsD gauges are tagged with the bucket and prefix.
+	metrics := string(newStatsd("localhost:8125", "", []string{"env:test"}).usageMetrics(usage))
+	assert.True(t, strings.Contains(metrics, "zdts3.storage.bytes:2000|g|#bucket:test-bucket,prefix:db/,env:test\n"))
+	assert.True(t, strings.Contains(metrics, "zdts3.storage.monthly_cost:0.04|g|#"))
+
+	// Ensure Pushgateway gauges are labelled with the bucket and prefix.
+	metrics = string(newPushgateway("http://localhost:9091").usageMetrics(usage))
+	assert.True(t, strings.Contains(metrics, "# TYPE zdts3_storage_archives gauge\n"))
+	assert.True(t, strings.Contains(metrics, `zdts3_storage_bytes{bucket="test-bucket",prefix="db/"} 2000`))
+}
+
+func TestReportUsage(t *testing.T) {
+	var texts []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload map[string]string
+		json.NewDecoder(r.Body).Decode(&payload)
+		texts = append(texts, payload["text"])
+	}))
+	defer srv.Close()
+
+	filter, err := parseEventFilter(notifyOnFailure)
+	assert.NoError(t, err)
+
+	// Ensure usage is reported to notifiers whatever their notification events, and skipped
+	// by reporters without usage reports.
+	usage := &storageUsage{Archives: 2, Bytes: 2000, Prefixes: []prefixUsage{{Bucket: "test-bucket", Prefix: "db/", Archives: 2, Bytes: 2000}}}
+	logger := zerolog.Nop()
+	reportUsage(context.Background(), []runReporter{newSlackWebhook(srv.URL, filter), newStatusTracker()}, usage, &logger)
+	assert.Equal(t, 1, len(texts))
+	assert.True(t, strings.HasPrefix(texts[0], ":bar_chart: zdts3 storage usage on "))
+	assert.True(t, strings.Contains(texts[0], "\ntest-bucket/db/: 2 archives, 2.0 KiB, est. $0.00/month"))
+}
@@ -0,0 +1,246 @@
+package archiver
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+const (
+	// vaultAuthToken authenticates with vault using a provided token.
+	vaultAuthToken = "token"
+	// vaultAuthAppRole authenticates with vault using an approle role and secret ID.
+	vaultAuthAppRole = "approle"
+
+	// vaultRefreshInterval is how often credentials without a lease (e.g. kv secrets) are
+	// re-read so rotated values get picked up.
+	vaultRefreshInterval = time.Hour
+)
+
+// vaultResponse is the subset of a vault API response used to fetch credentials.
+type vaultResponse struct {
+	LeaseID       string          `json:"lease_id"`
+	LeaseDuration int64           `json:"lease_duration"`
+	Renewable     bool            `json:"renewable"`
+	Data          json.RawMessage `json:"data"`
+	Auth          *struct {
+		ClientToken   string `json:"client_token"`
+		LeaseDuration int64  `json:"lease_duration"`
+	} `json:"auth"`
+	Errors []string `json:"errors"`
+}
+
+// vaultSecret is the S3 credentials payload of a vault secret. Both the aws secrets engine
+// field names and the zdts3 config names (for kv secrets) are supported.
+type vaultSecret struct {
+	AccessKey       string          `json:"access_key"`
+	SecretKey       string          `json:"secret_key"`
+	SecurityToken   string          `json:"security_token"`
+	AccessKeyID     string          `json:"accesskeyid"`
+	SecretAccessKey string          `json:"secretaccesskey"`
+	Data            json.RawMessage `json:"data"`
+}
+
+// vaultProvider is a minio credentials provider which fetches and renews S3 credentials
+// from a HashiCorp Vault secret. Since a minio client is created for every upload, clients
+// always use the current credentials once a lease is rotated.
+type vaultProvider struct {
+	credentials.Expiry
+
+	address    string
+	auth       string
+	token      string
+	roleID     string
+	secretID   string
+	secretPath string
+	client     *http.Client
+
+	tokenExpiry time.Time
+	leaseID     string
+	renewable   bool
+	value       credentials.Value
+}
+
+// newVaultProvider creates a vault credentials provider from the provided configuration.
+func newVaultProvider(cfg *Config) *vaultProvider {
+	return &vaultProvider{
+		address:    strings.TrimRight(cfg.VaultAddr, "/"),
+		auth:       cfg.VaultAuth,
+		token:      cfg.VaultToken,
+		roleID:     cfg.VaultRoleID,
+		secretID:   cfg.VaultSecretID,
+		secretPath: strings.Trim(cfg.VaultSecretPath, "/"),
+		client:     &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// request performs a vault API request and decodes its response.
+func (p *vaultProvider) request(method string, path string, body any, token string) (*vaultResponse, error) {
+	var reqBody io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, fmt.Errorf("encoding vault request: %w", err)
+		}
+		reqBody = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequest(method, p.address+"/v1/"+path, reqBody)
+	if err != nil {
+		return nil, fmt.Errorf("creating vault request: %w", err)
+	}
+
+	if token != "" {
+		req.Header.Set("X-Vault-Token", token)
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("requesting vault %s: %w", path, err)
+	}
+	defer resp.Body.Close()
+
+	var vresp vaultResponse
+	err = json.NewDecoder(resp.Body).Decode(&vresp)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("decoding vault %s response: %w", path, err)
+	}
+
+	if resp.StatusCode/100 != 2 {
+		return nil, fmt.Errorf("vault %s returned %s: %s", path, resp.Status, strings.Join(vresp.Errors, ", "))
+	}
+
+	return &vresp, nil
+}
+
+// login returns a vault token for the configured auth method, logging in again when an
+// approle token has expired.
+func (p *vaultProvider) login() (string, error) {
+	switch p.auth {
+	case vaultAuthAppRole:
+		if p.token != "" && time.Now().Before(p.tokenExpiry) {
+			return p.token, nil
+		}
+
+		body := map[string]string{"role_id": p.roleID, "secret_id": p.secretID}
+		resp, err := p.request(http.MethodPost, "auth/approle/login", body, "")
+		if err != nil {
+			return "", err
+		}
+
+		if resp.Auth == nil || resp.Auth.ClientToken == "" {
+			return "", fmt.Errorf("vault approle login returned no token")
+		}
+
+		p.token = resp.Auth.ClientToken
+		p.tokenExpiry = time.Now().Add(time.Duration(resp.Auth.LeaseDuration) * time.Second * 9 / 10)
+		addSecrets(p.token)
+
+		return p.token, nil
+
+	default:
+		return p.token, nil
+	}
+}
+
+// renew attempts to extend the lease of the current credentials.
+func (p *vaultProvider) renew(token string) (time.Duration, error) {
+	body := map[string]string{"lease_id": p.leaseID}
+	resp, err := p.request(http.MethodPut, "sys/leases/renew", body, token)
+	if err != nil {
+		return 0, err
+	}
+
+	if resp.LeaseDuration <= 0 {
+		return 0, fmt.Errorf("vault lease %s was not extended", p.leaseID)
+	}
+
+	return time.Duration(resp.LeaseDuration) * time.Second, nil
+}
+
+// fetch reads fresh credentials from the configured secret path.
+func (p *vaultProvider) fetch(token string) (credentials.Value, time.Duration, error) {
+	resp, err := p.request(http.MethodGet, p.secretPath, nil, token)
+	if err != nil {
+		return credentials.Value{}, 0, err
+	}
+
+	var secret vaultSecret
+	err = json.Unmarshal(resp.Data, &secret)
+	if err != nil {
+		return credentials.Value{}, 0, fmt.Errorf("decoding vault secret: %w", err)
+	}
+
+	// Secrets from the kv version 2 engine are nested in an inner data object.
+	if len(secret.Data) > 0 {
+		err = json.Unmarshal(secret.Data, &secret)
+		if err != nil {
+			return credentials.Value{}, 0, fmt.Errorf("decoding vault kv secret: %w", err)
+		}
+	}
+
+	value := credentials.Value{
+		AccessKeyID:     secret.AccessKey,
+		SecretAccessKey: secret.SecretKey,
+		SessionToken:    secret.SecurityToken,
+		SignerType:      credentials.SignatureV4,
+	}
+	if value.AccessKeyID == "" {
+		value.AccessKeyID = secret.AccessKeyID
+		value.SecretAccessKey = secret.SecretAccessKey
+	}
+
+	if value.AccessKeyID == "" || value.SecretAccessKey == "" {
+		return credentials.Value{}, 0, fmt.Errorf("vault secret %s has no S3 credentials", p.secretPath)
+	}
+	addSecrets(value.SecretAccessKey, value.SessionToken)
+
+	p.leaseID = resp.LeaseID
+	p.renewable = resp.Renewable
+
+	return value, time.Duration(resp.LeaseDuration) * time.Second, nil
+}
+
+// RetrieveWithCredContext returns the current credentials, renewing the lease or fetching
+// new credentials from vault as needed.
+func (p *vaultProvider) RetrieveWithCredContext(_ *credentials.CredContext) (credentials.Value, error) {
+	token, err := p.login()
+	if err != nil {
+		return credentials.Value{}, err
+	}
+
+	// Prefer extending the current lease, falling back to fetching new credentials.
+	if p.renewable && p.leaseID != "" && p.value.AccessKeyID != "" {
+		ttl, err := p.renew(token)
+		if err == nil {
+			p.SetExpiration(time.Now().Add(ttl), -1)
+			return p.value, nil
+		}
+	}
+
+	value, ttl, err := p.fetch(token)
+	if err != nil {
+		return credentials.Value{}, err
+	}
+
+	if ttl <= 0 {
+		ttl = vaultRefreshInterval
+	}
+
+	p.value = value
+	p.SetExpiration(time.Now().Add(ttl), -1)
+
+	return p.value, nil
+}
+
+// Retrieve returns the current credentials.
+func (p *vaultProvider) Retrieve() (credentials.Value, error) {
+	return p.RetrieveWithCredContext(nil)
+}
@@ -0,0 +1,100 @@
+package archiver
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/peterldowns/testy/assert"
+)
+
+func TestVaultProvider(t *testing.T) {
+	logins := 0
+	reads := 0
+	renewals := 0
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v1/auth/approle/login":
+			logins++
+			json.NewEncoder(w).Encode(map[string]any{
+				"auth": map[string]any{"client_token": "test-token", "lease_duration": 3600},
+			})
+
+		case "/v1/aws/creds/backup":
+			reads++
+			assert.Equal(t, "test-token", r.Header.Get("X-Vault-Token"))
+			json.NewEncoder(w).Encode(map[string]any{
+				"lease_id":       "aws/creds/backup/1",
+				"lease_duration": 0,
+				"renewable":      true,
+				"data": map[string]any{
+					"access_key":     "test-accesskeyid",
+					"secret_key":     "test-secretaccesskey",
+					"security_token": "test-session",
+				},
+			})
+
+		case "/v1/sys/leases/renew":
+			renewals++
+			json.NewEncoder(w).Encode(map[string]any{"lease_id": "aws/creds/backup/1", "lease_duration": 600})
+
+		case "/v1/secret/data/zdts3":
+			json.NewEncoder(w).Encode(map[string]any{
+				"data": map[string]any{
+					"data": map[string]any{
+						"accesskeyid":     "kv-accesskeyid",
+						"secretaccesskey": "kv-secretaccesskey",
+					},
+				},
+			})
+
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(map[string]any{"errors": []string{"not found"}})
+		}
+	}))
+	defer srv.Close()
+
+	cfg := Config{
+		VaultAddr:       srv.URL,
+		VaultAuth:       vaultAuthAppRole,
+		VaultRoleID:     "test-role",
+		VaultSecretID:   "test-secret",
+		VaultSecretPath: "aws/creds/backup",
+	}
+
+	// Ensure credentials from the aws secrets engine are fetched after an approle login.
+	provider := newVaultProvider(&cfg)
+	value, err := provider.Retrieve()
+	assert.NoError(t, err)
+	assert.Equal(t, "test-accesskeyid", value.AccessKeyID)
+	assert.Equal(t, "test-secretaccesskey", value.SecretAccessKey)
+	assert.Equal(t, "test-session", value.SessionToken)
+	assert.Equal(t, 1, logins)
+	assert.Equal(t, 1, reads)
+	assert.False(t, provider.IsExpired())
+
+	// Ensure a renewable lease is renewed rather than fetching new credentials.
+	value, err = provider.Retrieve()
+	assert.NoError(t, err)
+	assert.Equal(t, "test-accesskeyid", value.AccessKeyID)
+	assert.Equal(t, 1, logins)
+	assert.Equal(t, 1, reads)
+	assert.Equal(t, 1, renewals)
+
+	// Ensure kv version 2 secrets using config names are supported with token auth.
+	cfg.VaultAuth = vaultAuthToken
+	cfg.VaultToken = "test-token"
+	cfg.VaultSecretPath = "secret/data/zdts3"
+	value, err = newVaultProvider(&cfg).Retrieve()
+	assert.NoError(t, err)
+	assert.Equal(t, "kv-accesskeyid", value.AccessKeyID)
+	assert.Equal(t, "kv-secretaccesskey", value.SecretAccessKey)
+
+	// Ensure vault errors are surfaced.
+	cfg.VaultSecretPath = "secret/data/missing"
+	_, err = newVaultProvider(&cfg).Retrieve()
+	assert.Error(t, err)
+}
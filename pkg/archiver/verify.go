@@ -0,0 +1,119 @@
+package archiver
+
+import (
+	"archive/zip"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// errVerification indicates a zipped archive does not match the files it was zipped from.
+var errVerification = errors.New("archive verification failed")
+
+// verifySample re-opens the zip file at the provided path, zipped from the provided directory,
+// and ensures its central directory lists every provided archived file with its size. A random
+// sample of the job's verification sample size of the archived files is then read back,
+// verifying their CRC-32 checksums and SHA-256 hashes, and compared with their source files
+// unless those were modified since being zipped. This catches silent compression and
+// filesystem read errors before the source files are purged.
+func (j *jobConfig) verifySample(dir string, zipPath string, files []archivedFile) error {
+	reader, err := zip.OpenReader(zipPath)
+	if err != nil {
+		return fmt.Errorf("%w: opening archive: %w", errVerification, err)
+	}
+	defer reader.Close()
+
+	entries := make(map[string]*zip.File, len(reader.File))
+	for _, entry := range reader.File {
+		entries[entry.Name] = entry
+	}
+
+	// Hard links and preserved symbolic links hold no content of their own to compare.
+	var errs error
+	var candidates []archivedFile
+	for _, file := range files {
+		entry, ok := entries[file.Path]
+		switch {
+		case !ok:
+			errs = errors.Join(errs, fmt.Errorf("%s missing from the archive", file.Path))
+		case strings.HasPrefix(entry.Comment, hardLinkComment), entry.Mode()&fs.ModeSymlink != 0:
+		case entry.UncompressedSize64 != uint64(file.Size):
+			errs = errors.Join(errs, fmt.Errorf("%s is %d bytes in the archive, %d bytes were zipped",
+				file.Path, entry.UncompressedSize64, file.Size))
+		default:
+			candidates = append(candidates, file)
+		}
+	}
+	if errs != nil {
+		return fmt.Errorf("%w: %w", errVerification, errs)
+	}
+
+	rand.Shuffle(len(candidates), func(a, b int) {
+		candidates[a], candidates[b] = candidates[b], candidates[a]
+	})
+	for _, file := range candidates[:min(j.VerifySample, len(candidates))] {
+		err := verifyEntry(dir, entries[file.Path], file)
+		if err != nil {
+			errs = errors.Join(errs, err)
+		}
+	}
+	if errs != nil {
+		return fmt.Errorf("%w: %w", errVerification, errs)
+	}
+
+	return nil
+}
+
+// verifyEntry reads back the provided zip entry of the provided archived file, ensuring its
+// content matches the hash recorded while zipping and the source file in the provided
+// directory. Source files modified since being zipped are not compared.
+func verifyEntry(dir string, entry *zip.File, file archivedFile) error {
+	hash, err := hashZipEntry(entry)
+	if err != nil {
+		return fmt.Errorf("reading %s: %w", file.Path, err)
+	}
+	if hash != file.SHA256 {
+		return fmt.Errorf("%s does not match the content zipped", file.Path)
+	}
+
+	path := filepath.Join(dir, filepath.FromSlash(file.Path))
+	info, err := os.Stat(path)
+	if err != nil || info.Size() != file.Size || !info.ModTime().Equal(file.ModTime) {
+		return nil
+	}
+
+	source, err := hashSource(path)
+	if err != nil {
+		return fmt.Errorf("reading source file %s: %w", file.Path, err)
+	}
+	if source != hash {
+		return fmt.Errorf("%s does not match its source file", file.Path)
+	}
+
+	return nil
+}
+
+// hashSource returns the hex encoded SHA-256 hash of the content of the file at the provided
+// path.
+func hashSource(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	_, err = io.Copy(hash, file)
+	if err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
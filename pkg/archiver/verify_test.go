@@ -0,0 +1,73 @@
+package archiver
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/peterldowns/testy/assert"
+	"github.com/rs/zerolog"
+)
+
+func TestVerifySample(t *testing.T) {
+	dir := t.TempDir()
+	logger := zerolog.Nop()
+	zipPath := filepath.Join(t.TempDir(), "archive.zip")
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "users.sql"), []byte("users"), 0644))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "orders.sql"), []byte("orders"), 0644))
+
+	files, err := zipDir(context.Background(), dir, zipPath, zipOptions{}, &logger)
+	assert.NoError(t, err)
+	job := jobConfig{Name: "db", VerifySample: 10}
+
+	// Ensure archives matching their source files are verified.
+	assert.NoError(t, job.verifySample(dir, zipPath, files))
+
+	// Ensure archived files missing from the central directory fail verification.
+	missing := append(files, archivedFile{Path: "payments.sql", Size: 8})
+	err = job.verifySample(dir, zipPath, missing)
+	assert.True(t, errors.Is(err, errVerification))
+
+	// Ensure archived files with another size fail verification.
+	resized := append([]archivedFile(nil), files...)
+	resized[0].Size++
+	err = job.verifySample(dir, zipPath, resized)
+	assert.True(t, errors.Is(err, errVerification))
+
+	// Ensure source files differing from the archive with the same size and modification
+	// time fail verification.
+	path := filepath.Join(dir, "users.sql")
+	info, err := os.Stat(path)
+	assert.NoError(t, err)
+	assert.NoError(t, os.WriteFile(path, []byte("USERS"), 0644))
+	assert.NoError(t, os.Chtimes(path, info.ModTime(), info.ModTime()))
+	err = job.verifySample(dir, zipPath, files)
+	assert.True(t, errors.Is(err, errVerification))
+
+	// Ensure source files modified since being zipped are not compared.
+	modified := info.ModTime().Add(time.Minute)
+	assert.NoError(t, os.Chtimes(path, modified, modified))
+	assert.NoError(t, job.verifySample(dir, zipPath, files))
+}
+
+func TestArchiveVerifySample(t *testing.T) {
+	dir := t.TempDir()
+	logger := zerolog.Nop()
+	tracker := newStatusTracker()
+	fake := newFakeS3(t, "test-bucket")
+	s3Cfg := fake.s3Config("test-bucket")
+	job := jobConfig{Name: "db", SourceDir: dir, Retention: "720h", VerifySample: 5}
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "users.sql"), []byte("users"), 0644))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "orders.sql"), []byte("orders"), 0644))
+
+	// Ensure verified archives are uploaded.
+	archive(context.Background(), job, s3Cfg, []runReporter{tracker}, &logger)
+	assert.NoError(t, tracker.runs["db"].Err)
+
+	archives, err := listArchives(context.Background(), s3Cfg)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(archives))
+}
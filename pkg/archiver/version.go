@@ -0,0 +1,76 @@
+package archiver
+
+import (
+	"fmt"
+	"runtime/debug"
+)
+
+// Build information, set by the zdts3 binary with SetBuildInfo from its link time values.
+// Values not set are taken from the build information embedded by the go tool.
+var (
+	version   = ""
+	commit    = ""
+	buildDate = ""
+)
+
+// SetBuildInfo sets the version, commit and build date reported by the binary. Empty values
+// are taken from the build information embedded by the go tool.
+func SetBuildInfo(v string, c string, date string) {
+	version, commit, buildDate = v, c, date
+}
+
+// buildInfo describes the build of the running binary.
+type buildInfo struct {
+	Version   string
+	Commit    string
+	BuildDate string
+	GoVersion string
+}
+
+// getBuildInfo returns the build information of the running binary.
+func getBuildInfo() buildInfo {
+	info := buildInfo{
+		Version:   version,
+		Commit:    commit,
+		BuildDate: buildDate,
+	}
+
+	embedded, ok := debug.ReadBuildInfo()
+	if ok {
+		info.GoVersion = embedded.GoVersion
+
+		if info.Version == "" && embedded.Main.Version != "(devel)" {
+			info.Version = embedded.Main.Version
+		}
+
+		for _, setting := range embedded.Settings {
+			switch setting.Key {
+			case "vcs.revision":
+				if info.Commit == "" {
+					info.Commit = setting.Value
+				}
+			case "vcs.time":
+				if info.BuildDate == "" {
+					info.BuildDate = setting.Value
+				}
+			}
+		}
+	}
+
+	if info.Version == "" {
+		info.Version = "dev"
+	}
+	if info.Commit == "" {
+		info.Commit = "unknown"
+	}
+	if info.BuildDate == "" {
+		info.BuildDate = "unknown"
+	}
+
+	return info
+}
+
+// String returns a human readable description of the build.
+func (b buildInfo) String() string {
+	return fmt.Sprintf("zdts3 %s (commit %s, built %s, %s)", b.Version, b.Commit, b.BuildDate, b.GoVersion)
+}
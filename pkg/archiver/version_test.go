@@ -0,0 +1,28 @@
+package archiver
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/peterldowns/testy/assert"
+)
+
+func TestGetBuildInfo(t *testing.T) {
+	// Ensure defaults are provided when no build information is set.
+	info := getBuildInfo()
+	assert.NotEqual(t, "", info.Version)
+	assert.NotEqual(t, "", info.Commit)
+	assert.NotEqual(t, "", info.BuildDate)
+
+	// Ensure link time values take precedence.
+	version, commit, buildDate = "v1.2.3", "abc123", "2025-01-02"
+	defer func() {
+		version, commit, buildDate = "", "", ""
+	}()
+
+	info = getBuildInfo()
+	assert.Equal(t, "v1.2.3", info.Version)
+	assert.Equal(t, "abc123", info.Commit)
+	assert.Equal(t, "2025-01-02", info.BuildDate)
+	assert.True(t, strings.HasPrefix(info.String(), "zdts3 v1.2.3 (commit abc123, built 2025-01-02"))
+}
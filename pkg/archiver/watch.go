@@ -0,0 +1,241 @@
+package archiver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/go-co-op/gocron/v2"
+	"github.com/rs/zerolog"
+)
+
+// archiveNamePattern matches the zip files written to source directories by archive runs,
+// which must not trigger further runs.
+const archiveNamePattern = "dump-*.zip"
+
+// validateWatchQuiet ensures that the provided quiet period of a watched directory is a
+// positive duration.
+func validateWatchQuiet(value string) error {
+	quiet, err := time.ParseDuration(value)
+	if err != nil || quiet <= 0 {
+		return fmt.Errorf("invalid watch quiet period %q", value)
+	}
+
+	return nil
+}
+
+// dirWatcher triggers runs of a job when its source directory changes: once a number of
+// files were added or once the directory saw no changes for a quiet period.
+type dirWatcher struct {
+	job     jobConfig
+	trigger func() error
+	logger  *zerolog.Logger
+}
+
+// ignored returns whether changes of the provided path are ignored, which is the case for
+// the archives written by runs.
+func (w *dirWatcher) ignored(path string) bool {
+	if filepath.Dir(path) != filepath.Clean(w.job.SourceDir) {
+		return false
+	}
+
+	match, _ := filepath.Match(archiveNamePattern, filepath.Base(path))
+	return match
+}
+
+// add watches the provided directory and its subdirectories. It returns the number of files
+// found in them.
+func (w *dirWatcher) add(watcher *fsnotify.Watcher, dir string) (int, error) {
+	var files int
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if !d.IsDir() {
+			if !w.ignored(path) {
+				files++
+			}
+			return nil
+		}
+
+		return watcher.Add(path)
+	})
+
+	return files, err
+}
+
+// fire triggers a run of the job for the provided reason.
+func (w *dirWatcher) fire(reason string) {
+	err := w.trigger()
+	if err != nil {
+		w.logger.Error().Err(err).Str("reason", reason).Msg("Triggering watched run")
+		return
+	}
+
+	w.logger.Info().Str("reason", reason).Msg("Triggered watched run")
+}
+
+// run watches the job's source directory until the context is cancelled.
+func (w *dirWatcher) run(ctx context.Context) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("creating watcher: %w", err)
+	}
+	defer watcher.Close()
+
+	_, err = w.add(watcher, w.job.SourceDir)
+	if err != nil {
+		return fmt.Errorf("watching %s: %w", w.job.SourceDir, err)
+	}
+
+	quiet := w.job.watchQuiet()
+	timer := time.NewTimer(quiet)
+	timer.Stop()
+	defer timer.Stop()
+
+	// Changes since the last triggered run.
+	var added int
+	var changed bool
+	reset := func() {
+		added, changed = 0, false
+		timer.Stop()
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return nil
+			}
+			w.logger.Error().Err(err).Msg("Watching source directory")
+
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return nil
+			}
+
+			if w.ignored(event.Name) {
+				continue
+			}
+
+			switch {
+			case event.Has(fsnotify.Create):
+				info, err := os.Stat(event.Name)
+				if err != nil {
+					continue
+				}
+
+				// Watch new subdirectories, counting the files created in them before
+				// they were watched.
+				if info.IsDir() {
+					files, err := w.add(watcher, event.Name)
+					if err != nil && !errors.Is(err, fs.ErrNotExist) {
+						w.logger.Error().Err(err).Str("path", event.Name).Msg("Watching directory")
+					}
+					added += files
+				} else {
+					added++
+				}
+
+			case event.Has(fsnotify.Write):
+				// Modified files are archived as well, without counting as added.
+
+			default:
+				// Removals, such as purged files, are not worth archiving.
+				continue
+			}
+
+			changed = true
+			if w.job.WatchFiles > 0 && added >= w.job.WatchFiles {
+				reset()
+				w.fire("files")
+				continue
+			}
+
+			if quiet > 0 {
+				timer.Reset(quiet)
+			}
+
+		case <-timer.C:
+			if changed {
+				reset()
+				w.fire("quiet")
+			}
+		}
+	}
+}
+
+// jobWatchers watches the source directories of the watched jobs of the active
+// configuration, which changes on reloads.
+type jobWatchers struct {
+	mtx    sync.Mutex
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// watch replaces the active watchers with watchers of the watched jobs of the provided
+// configuration, triggering runs of the jobs of the provided scheduler. Watchers stop when
+// the provided context is cancelled.
+func (w *jobWatchers) watch(ctx context.Context, s gocron.Scheduler, cfg *Config, logger *zerolog.Logger) {
+	w.stop()
+
+	w.mtx.Lock()
+	defer w.mtx.Unlock()
+
+	ctx, w.cancel = context.WithCancel(ctx)
+	for _, job := range cfg.jobs() {
+		if !job.watching() {
+			continue
+		}
+
+		jobLogger := logger.With().Str("job", job.Name).Logger()
+		watcher := &dirWatcher{
+			job: job,
+			trigger: func() error {
+				scheduled := findJob(s, job.Name)
+				if scheduled == nil {
+					return fmt.Errorf("%w %q", errUnknownJob, job.Name)
+				}
+
+				return scheduled.RunNow()
+			},
+			logger: &jobLogger,
+		}
+
+		w.wg.Add(1)
+		go func() {
+			defer w.wg.Done()
+
+			jobLogger.Info().Str("path", job.SourceDir).Int("files", job.WatchFiles).
+				Str("quiet", job.WatchQuiet).Msg("Watching source directory")
+
+			err := watcher.run(ctx)
+			if err != nil {
+				jobLogger.Error().Err(err).Msg("Watching source directory")
+			}
+		}()
+	}
+}
+
+// stop stops the active watchers and waits for them to return.
+func (w *jobWatchers) stop() {
+	w.mtx.Lock()
+	defer w.mtx.Unlock()
+
+	if w.cancel != nil {
+		w.cancel()
+		w.cancel = nil
+	}
+
+	w.wg.Wait()
+}
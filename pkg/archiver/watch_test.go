@@ -0,0 +1,146 @@
+package archiver
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-co-op/gocron/v2"
+	"github.com/peterldowns/testy/assert"
+	"github.com/rs/zerolog"
+)
+
+// startWatcher runs a watcher of the provided job, returning a channel receiving its
+// triggers.
+func startWatcher(t *testing.T, job jobConfig) <-chan struct{} {
+	t.Helper()
+
+	triggers := make(chan struct{}, 10)
+	logger := zerolog.Nop()
+	watcher := &dirWatcher{
+		job: job,
+		trigger: func() error {
+			triggers <- struct{}{}
+			return nil
+		},
+		logger: &logger,
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- watcher.run(ctx) }()
+	t.Cleanup(func() {
+		cancel()
+		assert.NoError(t, <-done)
+	})
+
+	// Give the watcher time to watch the directory.
+	time.Sleep(100 * time.Millisecond)
+
+	return triggers
+}
+
+// writeFile writes a file with the provided name to the provided directory.
+func writeFile(t *testing.T, dir string, name string) {
+	t.Helper()
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(name), 0644))
+}
+
+// triggered returns whether a trigger is received within the provided duration.
+func triggered(triggers <-chan struct{}, wait time.Duration) bool {
+	select {
+	case <-triggers:
+		return true
+	case <-time.After(wait):
+		return false
+	}
+}
+
+func TestDirWatcherFiles(t *testing.T) {
+	dir := t.TempDir()
+	triggers := startWatcher(t, jobConfig{Name: "test", SourceDir: dir, WatchFiles: 3})
+
+	// Ensure archives written by runs are ignored.
+	writeFile(t, dir, "dump-20250310235000.zip")
+	writeFile(t, dir, "a.sql")
+	writeFile(t, dir, "b.sql")
+	assert.False(t, triggered(triggers, 200*time.Millisecond))
+
+	// Ensure a run is triggered once enough files were added, including files of new
+	// subdirectories.
+	assert.NoError(t, os.Mkdir(filepath.Join(dir, "nested"), 0755))
+	writeFile(t, filepath.Join(dir, "nested"), "c.sql")
+	assert.True(t, triggered(triggers, time.Second))
+
+	// Ensure the count restarts after a trigger.
+	writeFile(t, dir, "d.sql")
+	assert.False(t, triggered(triggers, 200*time.Millisecond))
+}
+
+func TestDirWatcherQuiet(t *testing.T) {
+	dir := t.TempDir()
+	triggers := startWatcher(t, jobConfig{Name: "test", SourceDir: dir, WatchQuiet: "300ms"})
+
+	// Ensure no run is triggered without changes.
+	assert.False(t, triggered(triggers, 500*time.Millisecond))
+
+	// Ensure a run is triggered once changes stop for the quiet period.
+	writeFile(t, dir, "a.sql")
+	time.Sleep(150 * time.Millisecond)
+	writeFile(t, dir, "a.sql")
+	assert.False(t, triggered(triggers, 200*time.Millisecond))
+	assert.True(t, triggered(triggers, time.Second))
+
+	// Ensure removals do not trigger runs.
+	assert.NoError(t, os.Remove(filepath.Join(dir, "a.sql")))
+	assert.False(t, triggered(triggers, 500*time.Millisecond))
+}
+
+func TestJobWatchers(t *testing.T) {
+	dir := t.TempDir()
+	cfg := Config{
+		Bucket: "test-bucket",
+		Jobs: []jobConfig{
+			{Name: "watched", SourceDir: dir, WatchFiles: 1},
+			{Name: "scheduled", SourceDir: t.TempDir()},
+		},
+	}
+
+	s, err := gocron.NewScheduler()
+	assert.NoError(t, err)
+	defer s.Shutdown()
+
+	runs := make(chan string, 10)
+	for _, job := range cfg.jobs() {
+		definition, err := job.jobDefinition(0)
+		assert.NoError(t, err)
+		_, err = s.NewJob(definition, gocron.NewTask(func() { runs <- job.Name }), gocron.WithName(job.Name))
+		assert.NoError(t, err)
+	}
+	s.Start()
+
+	logger := zerolog.Nop()
+	var watchers jobWatchers
+	watchers.watch(context.Background(), s, &cfg, &logger)
+	time.Sleep(100 * time.Millisecond)
+
+	// Ensure adding a file runs the watched job.
+	writeFile(t, dir, "a.sql")
+	select {
+	case name := <-runs:
+		assert.Equal(t, "watched", name)
+	case <-time.After(time.Second):
+		t.Fatal("watched job did not run")
+	}
+
+	// Ensure stopped watchers no longer trigger runs.
+	watchers.stop()
+	writeFile(t, dir, "b.sql")
+	select {
+	case name := <-runs:
+		t.Fatalf("unexpected run of job %s", name)
+	case <-time.After(200 * time.Millisecond):
+	}
+}
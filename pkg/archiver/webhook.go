@@ -0,0 +1,97 @@
+package archiver
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// webhookSignatureHeader is the header carrying the HMAC signature of webhook requests.
+	webhookSignatureHeader = "X-Zdts3-Signature"
+	// webhookTimestampHeader is the header carrying the signed timestamp of webhook requests.
+	webhookTimestampHeader = "X-Zdts3-Timestamp"
+)
+
+// webhook posts JSON run events to a URL for downstream automation. Requests are signed with
+// an HMAC-SHA256 of the timestamp and body keyed with a shared secret, so receivers can
+// verify their authenticity and reject replays.
+type webhook struct {
+	url    string
+	secret string
+	client *http.Client
+}
+
+// newWebhook creates a reporter posting run events to the provided URL.
+func newWebhook(url string, secret string) *webhook {
+	return &webhook{url: url, secret: secret, client: &http.Client{}}
+}
+
+// name returns the name of the reporter.
+func (w *webhook) name() string {
+	return "webhook"
+}
+
+// webhookSignature returns the signature of a webhook request with the provided timestamp
+// and body, formatted as sha256=<hex>.
+func webhookSignature(secret string, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// post sends the provided event to the webhook.
+func (w *webhook) post(ctx context.Context, event *runEvent) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("encoding webhook event: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("creating webhook request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	if w.secret != "" {
+		timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+		req.Header.Set(webhookTimestampHeader, timestamp)
+		req.Header.Set(webhookSignatureHeader, webhookSignature(w.secret, timestamp, body))
+	}
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("posting webhook event: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("posting webhook event: unexpected status %s: %s", resp.Status,
+			strings.TrimSpace(string(data)))
+	}
+
+	return nil
+}
+
+// start posts the started event of the provided run.
+func (w *webhook) start(ctx context.Context, run *runResult) error {
+	return w.post(ctx, newRunEvent(eventStarted, run))
+}
+
+// report posts the succeeded or failed event of the provided run.
+func (w *webhook) report(ctx context.Context, result *runResult) error {
+	return w.post(ctx, newRunEvent(resultEvent(result), result))
+}
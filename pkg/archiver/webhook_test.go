@@ -0,0 +1,60 @@
+package archiver
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/peterldowns/testy/assert"
+)
+
+func TestWebhook(t *testing.T) {
+	var events []runEvent
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		assert.NoError(t, err)
+
+		// Verify the signature like a receiver would.
+		timestamp := r.Header.Get(webhookTimestampHeader)
+		expected := webhookSignature("test-secret", timestamp, body)
+		if r.Header.Get(webhookSignatureHeader) != expected {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		var event runEvent
+		err = json.Unmarshal(body, &event)
+		assert.NoError(t, err)
+		events = append(events, event)
+	}))
+	defer srv.Close()
+
+	ctx := context.Background()
+	run := &runResult{Job: "db", Start: time.Now()}
+
+	// Ensure signed events are posted for the start and outcome of runs.
+	w := newWebhook(srv.URL, "test-secret")
+	assert.NoError(t, w.start(ctx, run))
+
+	run.Duration = time.Second
+	run.Files = 3
+	run.Err = errors.New("upload failed")
+	assert.NoError(t, w.report(ctx, run))
+
+	assert.Equal(t, 2, len(events))
+	assert.Equal(t, eventStarted, events[0].Event)
+	assert.Equal(t, "db", events[0].Job)
+	assert.Equal(t, 0, events[0].Files)
+	assert.Equal(t, eventFailed, events[1].Event)
+	assert.Equal(t, 3, events[1].Files)
+	assert.Equal(t, "upload failed", events[1].Error)
+
+	// Ensure receivers can reject events signed with another secret.
+	w = newWebhook(srv.URL, "other-secret")
+	assert.Error(t, w.report(ctx, run))
+}
@@ -0,0 +1,136 @@
+package archiver
+
+import (
+	"archive/zip"
+	"encoding/binary"
+	"fmt"
+	"os"
+)
+
+const (
+	// zipExtraXattrs is the ID of the private extra field of zip entries recording the
+	// extended attributes of the archived file, including POSIX ACLs and SELinux contexts.
+	zipExtraXattrs = 0x7a78
+	// maxXattrsExtra is the size of the largest extended attributes field, leaving room in
+	// the extra fields of an entry for its owner, timestamps and Zip64 sizes.
+	maxXattrsExtra = 60 << 10
+)
+
+// xattr is an extended attribute of a file.
+type xattr struct {
+	Name  string
+	Value []byte
+}
+
+// xattrsExtra returns the extra field recording the extended attributes of the file at the
+// provided path, nil if it has none. Links are not followed.
+func xattrsExtra(path string) ([]byte, error) {
+	attrs, err := listXattrs(path)
+	if err != nil || len(attrs) == 0 {
+		return nil, err
+	}
+
+	// The field holds its version and the size prefixed names and values.
+	field := []byte{1}
+	for _, attr := range attrs {
+		field = binary.LittleEndian.AppendUint16(field, uint16(len(attr.Name)))
+		field = append(field, attr.Name...)
+		field = binary.LittleEndian.AppendUint16(field, uint16(len(attr.Value)))
+		field = append(field, attr.Value...)
+		if len(field) > maxXattrsExtra {
+			return nil, fmt.Errorf("extended attributes exceed %d bytes", maxXattrsExtra)
+		}
+	}
+
+	extra := binary.LittleEndian.AppendUint16(nil, zipExtraXattrs)
+	extra = binary.LittleEndian.AppendUint16(extra, uint16(len(field)))
+	return append(extra, field...), nil
+}
+
+// entryXattrs returns the extended attributes recorded in the provided extra fields of a zip
+// entry, if any.
+func entryXattrs(extra []byte) ([]xattr, bool) {
+	for len(extra) >= 4 {
+		id := binary.LittleEndian.Uint16(extra)
+		size := int(binary.LittleEndian.Uint16(extra[2:]))
+		if len(extra) < 4+size {
+			return nil, false
+		}
+		field := extra[4 : 4+size]
+		extra = extra[4+size:]
+		if id != zipExtraXattrs || len(field) == 0 || field[0] != 1 {
+			continue
+		}
+
+		var attrs []xattr
+		field = field[1:]
+		for len(field) > 0 {
+			name, rest, ok := readXattrValue(field)
+			if !ok {
+				return nil, false
+			}
+			value, rest, ok := readXattrValue(rest)
+			if !ok {
+				return nil, false
+			}
+			attrs = append(attrs, xattr{Name: string(name), Value: value})
+			field = rest
+		}
+
+		return attrs, true
+	}
+
+	return nil, false
+}
+
+// readXattrValue reads a size prefixed name or value of the extended attributes field, and
+// returns the rest of the field.
+func readXattrValue(field []byte) ([]byte, []byte, bool) {
+	if len(field) < 2 {
+		return nil, nil, false
+	}
+	size := int(binary.LittleEndian.Uint16(field))
+	if len(field) < 2+size {
+		return nil, nil, false
+	}
+
+	return field[2 : 2+size], field[2+size:], true
+}
+
+// restoreXattrs sets the extended attributes of the provided extracted path to those
+// recorded in the provided zip entry, if any. Attributes the target filesystem does not
+// support, or this process may not set, such as the trusted namespace of restores not
+// running as root, are skipped.
+func restoreXattrs(target string, entry *zip.File) error {
+	attrs, ok := entryXattrs(entry.Extra)
+	if !ok {
+		return nil
+	}
+
+	for _, attr := range attrs {
+		err := setXattr(target, attr)
+		if err != nil && !xattrSkipped(err) {
+			return fmt.Errorf("setting extended attribute %s: %w", attr.Name, err)
+		}
+	}
+
+	return nil
+}
+
+// entryExtra returns the extra fields of the entry of the file at the provided path: its
+// owner, and its extended attributes when they are recorded. Files whose extended attributes
+// cannot be read are archived without them.
+func (z *dirZipper) entryExtra(path string, info os.FileInfo) []byte {
+	extra := ownerExtra(info)
+	if !z.opts.Xattrs {
+		return extra
+	}
+
+	attrs, err := xattrsExtra(path)
+	if err != nil {
+		z.logger.Warn().Err(err).Str("path", path).Msg("Skipping extended attributes")
+		return extra
+	}
+
+	return append(extra, attrs...)
+}
@@ -0,0 +1,23 @@
+//go:build !(linux || darwin || freebsd || netbsd)
+
+package archiver
+
+import "errors"
+
+// listXattrs returns the extended attributes of the file at the provided path. Extended
+// attributes are not recorded on this platform.
+func listXattrs(string) ([]xattr, error) {
+	return nil, nil
+}
+
+// setXattr sets the provided extended attribute of the file at the provided path. Extended
+// attributes are not restored on this platform.
+func setXattr(string, xattr) error {
+	return errors.ErrUnsupported
+}
+
+// xattrSkipped returns whether the provided error of setting an extended attribute means the
+// attribute cannot be restored here, rather than that the restore failed.
+func xattrSkipped(err error) bool {
+	return errors.Is(err, errors.ErrUnsupported)
+}
@@ -0,0 +1,87 @@
+package archiver
+
+import (
+	"archive/zip"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/peterldowns/testy/assert"
+	"github.com/rs/zerolog"
+)
+
+func TestEntryXattrs(t *testing.T) {
+	// Ensure extended attributes are read from their field among other fields.
+	extra := []byte{0x55, 0x54, 0x05, 0x00, 0x01, 0x00, 0x00, 0x00, 0x00}
+	extra = append(extra, 0x78, 0x7a, 0x0e, 0x00, 0x01, 0x06, 0x00)
+	extra = append(extra, "user.a"...)
+	extra = append(extra, 0x03, 0x00)
+	extra = append(extra, "one"...)
+	attrs, ok := entryXattrs(extra)
+	assert.True(t, ok)
+	assert.Equal(t, []xattr{{Name: "user.a", Value: []byte("one")}}, attrs)
+
+	// Ensure truncated fields and unsupported versions are ignored.
+	_, ok = entryXattrs(extra[:len(extra)-2])
+	assert.False(t, ok)
+	_, ok = entryXattrs([]byte{0x78, 0x7a, 0x01, 0x00, 0x02})
+	assert.False(t, ok)
+	_, ok = entryXattrs([]byte{0x78, 0x7a, 0x04, 0x00, 0x01, 0x06, 0x00, 0x75})
+	assert.False(t, ok)
+}
+
+func TestZipDirXattrs(t *testing.T) {
+	dir := t.TempDir()
+	logger := zerolog.Nop()
+	path := filepath.Join(dir, "users.sql")
+	assert.NoError(t, os.WriteFile(path, []byte("users"), 0644))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "plain.sql"), []byte("plain"), 0644))
+	attr := xattr{Name: "user.zdts3.test", Value: []byte("labelled")}
+	err := setXattr(path, attr)
+	if err != nil && xattrSkipped(err) {
+		t.Skipf("extended attributes are not supported here: %v", err)
+	}
+	assert.NoError(t, err)
+
+	// Ensure extended attributes are only recorded when enabled.
+	zipPath := filepath.Join(t.TempDir(), "archive.zip")
+	_, err = zipDir(context.Background(), dir, zipPath, zipOptions{Method: zip.Deflate}, &logger)
+	assert.NoError(t, err)
+	reader, err := zip.OpenReader(zipPath)
+	assert.NoError(t, err)
+	for _, entry := range reader.File {
+		_, ok := entryXattrs(entry.Extra)
+		assert.False(t, ok)
+	}
+	assert.NoError(t, reader.Close())
+
+	zipPath = filepath.Join(t.TempDir(), "archive.zip")
+	_, err = zipDir(context.Background(), dir, zipPath, zipOptions{Method: zip.Deflate, Xattrs: true}, &logger)
+	assert.NoError(t, err)
+
+	// Ensure restores set the recorded extended attributes.
+	target := t.TempDir()
+	_, _, err = extractZip(zipPath, target, extractOptions{})
+	assert.NoError(t, err)
+	attrs, err := listXattrs(filepath.Join(target, "users.sql"))
+	assert.NoError(t, err)
+	assert.Equal(t, []xattr{attr}, userXattrs(attrs))
+	attrs, err = listXattrs(filepath.Join(target, "plain.sql"))
+	assert.NoError(t, err)
+	assert.Equal(t, 0, len(userXattrs(attrs)))
+}
+
+// userXattrs returns the provided extended attributes of the user namespace, leaving out
+// those the system sets, e.g. SELinux contexts.
+func userXattrs(attrs []xattr) []xattr {
+	var user []xattr
+	for _, attr := range attrs {
+		if strings.HasPrefix(attr.Name, "user.") {
+			user = append(user, attr)
+		}
+	}
+
+	return user
+}
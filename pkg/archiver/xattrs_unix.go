@@ -0,0 +1,75 @@
+//go:build linux || darwin || freebsd || netbsd
+
+package archiver
+
+import (
+	"bytes"
+	"errors"
+
+	"golang.org/x/sys/unix"
+)
+
+// listXattrs returns the extended attributes of the file at the provided path, without
+// following links. Files on filesystems without extended attributes have none.
+func listXattrs(path string) ([]xattr, error) {
+	names, err := readXattr(func(dest []byte) (int, error) { return unix.Llistxattr(path, dest) })
+	if err != nil {
+		if errors.Is(err, unix.ENOTSUP) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var attrs []xattr
+	for _, name := range bytes.Split(names, []byte{0}) {
+		if len(name) == 0 {
+			continue
+		}
+
+		value, err := readXattr(func(dest []byte) (int, error) { return unix.Lgetxattr(path, string(name), dest) })
+		if err != nil {
+			return nil, err
+		}
+		attrs = append(attrs, xattr{Name: string(name), Value: value})
+	}
+
+	return attrs, nil
+}
+
+// readXattr reads an extended attribute value or name list with the provided call, which
+// returns the size of the value when passed no buffer. Values growing between sizing and
+// reading them are read again.
+func readXattr(read func(dest []byte) (int, error)) ([]byte, error) {
+	for {
+		size, err := read(nil)
+		if err != nil {
+			return nil, err
+		}
+		if size == 0 {
+			return nil, nil
+		}
+
+		dest := make([]byte, size)
+		n, err := read(dest)
+		if errors.Is(err, unix.ERANGE) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		return dest[:n], nil
+	}
+}
+
+// setXattr sets the provided extended attribute of the file at the provided path, without
+// following links.
+func setXattr(path string, attr xattr) error {
+	return unix.Lsetxattr(path, attr.Name, attr.Value, 0)
+}
+
+// xattrSkipped returns whether the provided error of setting an extended attribute means the
+// attribute cannot be restored here, rather than that the restore failed.
+func xattrSkipped(err error) bool {
+	return errors.Is(err, unix.ENOTSUP) || errors.Is(err, unix.EPERM) || errors.Is(err, unix.EACCES)
+}
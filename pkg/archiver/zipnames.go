@@ -0,0 +1,52 @@
+package archiver
+
+import (
+	"archive/zip"
+	"fmt"
+	"path"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+)
+
+// zipUTF8 is the zip header flag of entries whose name and comment are UTF-8 encoded. Names
+// of entries without it are decoded as CP437, or the system's code page, by unzip tools.
+const zipUTF8 = 0x800
+
+// markUTF8 flags the name of the provided header as UTF-8 encoded if it holds characters
+// outside of ASCII. The zip writer flags the entries it creates itself, but not raw entries,
+// whose non-ASCII names would be garbled in Windows Explorer and other unzip tools. Names
+// which are not valid UTF-8, e.g. Latin-1 file names, are left unflagged.
+func markUTF8(header *zip.FileHeader) {
+	if header.NonUTF8 || !utf8.ValidString(header.Name) || !utf8.ValidString(header.Comment) {
+		return
+	}
+
+	for i := 0; i < len(header.Name); i++ {
+		if header.Name[i] >= utf8.RuneSelf {
+			header.Flags |= zipUTF8
+			return
+		}
+	}
+}
+
+// entryName returns the zip entry name of the provided file within the provided root
+// directory, prefixed with the provided slash separated prefix, or "." for the root itself.
+// Entry names are relative and slash separated on every platform, the backslashes and drive
+// letters of Windows paths never end up in archives, so they extract with the same structure
+// everywhere.
+func entryName(root, file, prefix string) (string, error) {
+	rel, err := filepath.Rel(root, file)
+	if err != nil {
+		return "", err
+	}
+
+	// Paths outside of the root, e.g. reached through Windows short names, would extract
+	// outside of the target directory.
+	name := filepath.ToSlash(rel)
+	if filepath.IsAbs(rel) || filepath.VolumeName(rel) != "" || name == ".." || strings.HasPrefix(name, "../") {
+		return "", fmt.Errorf("%s is not within %s", file, root)
+	}
+
+	return path.Join(prefix, name), nil
+}
@@ -0,0 +1,104 @@
+package archiver
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/peterldowns/testy/assert"
+	"github.com/rs/zerolog"
+)
+
+func TestZipDirUTF8Names(t *testing.T) {
+	dir := t.TempDir()
+	large := bytes.Repeat([]byte("données "), 2*deflateBlockSize/8)
+	files := map[string][]byte{
+		"café.txt":            []byte("crème brûlée"),
+		"日本語/報告.sql":          []byte("SELECT 1;"),
+		"données/journal.log": large,
+		"plain.txt":           []byte("ascii"),
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		assert.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		assert.NoError(t, os.WriteFile(path, content, 0644))
+	}
+
+	// Zip entries written by the zip writer, compressed by a rule and deflated in parallel.
+	logger := zerolog.Nop()
+	zipPath := filepath.Join(t.TempDir(), "utf8.zip")
+	opts := zipOptions{
+		Method:      zip.Deflate,
+		Compression: []compressionRule{{Pattern: "*.sql", Method: "zstd"}},
+		Workers:     2,
+	}
+	_, err := zipDir(context.Background(), dir, zipPath, opts, &logger)
+	assert.NoError(t, err)
+
+	// Ensure non-ASCII names, and only them, are flagged as UTF-8.
+	r, err := zip.OpenReader(zipPath)
+	assert.NoError(t, err)
+	flagged := make(map[string]bool)
+	for _, entry := range r.File {
+		flagged[entry.Name] = entry.Flags&zipUTF8 != 0
+	}
+	assert.NoError(t, r.Close())
+	assert.Equal(t, map[string]bool{
+		"café.txt":            true,
+		"日本語/報告.sql":          true,
+		"données/journal.log": true,
+		"plain.txt":           false,
+	}, flagged)
+
+	// Ensure the files extract under their names.
+	target := t.TempDir()
+	_, _, err = extractZip(zipPath, target, extractOptions{})
+	assert.NoError(t, err)
+	for name, content := range files {
+		extracted, err := os.ReadFile(filepath.Join(target, filepath.FromSlash(name)))
+		assert.NoError(t, err)
+		assert.True(t, bytes.Equal(content, extracted))
+	}
+
+	// Ensure names which are not valid UTF-8 are left unflagged.
+	header := &zip.FileHeader{Name: "caf\xe9.txt"}
+	markUTF8(header)
+	assert.Equal(t, uint16(0), header.Flags&zipUTF8)
+}
+
+func TestEntryName(t *testing.T) {
+	root := filepath.Join(t.TempDir(), "data")
+	tests := []struct {
+		root    string
+		file    string
+		prefix  string
+		name    string
+		err     bool
+		windows bool
+	}{
+		{root: root, file: root, name: "."},
+		{root: root, file: filepath.Join(root, "db.sql"), name: "db.sql"},
+		{root: root, file: filepath.Join(root, "logs", "2026", "app.log"), name: "logs/2026/app.log"},
+		{root: root, file: filepath.Join(root, "app.log"), prefix: "linked/logs", name: "linked/logs/app.log"},
+		{root: root, file: root, prefix: "linked", name: "linked"},
+		{root: root, file: filepath.Join(root, "..", "other", "db.sql"), err: true},
+		{root: root, file: filepath.Dir(root), err: true},
+		// Ensure backslashes and drive letters never end up in entry names.
+		{root: `C:\`, file: `C:\data\logs\app.log`, name: "data/logs/app.log", windows: true},
+		{root: `C:\data`, file: `c:\data\app.log`, name: "app.log", windows: true},
+		{root: `C:\data`, file: `D:\data\app.log`, err: true, windows: true},
+	}
+
+	for _, test := range tests {
+		if test.windows && runtime.GOOS != "windows" {
+			continue
+		}
+		name, err := entryName(test.root, test.file, test.prefix)
+		assert.Equal(t, test.err, err != nil)
+		assert.Equal(t, test.name, name)
+	}
+}
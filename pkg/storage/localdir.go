@@ -0,0 +1,172 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// CopyFunc copies the provided reader to the provided writer and returns the number of bytes
+// copied, like io.Copy.
+type CopyFunc func(dst io.Writer, src io.Reader) (int64, error)
+
+// LocalDir is a storage in a local directory, e.g. a mounted NAS share.
+type LocalDir struct {
+	root string
+	copy CopyFunc
+}
+
+// OpenLocalDir opens the storage in the provided directory, copying files with the provided
+// function, io.Copy if nil. The directory must exist, so archives of an unmounted share are
+// not silently written to the local disk instead.
+func OpenLocalDir(root string, copy CopyFunc) (*LocalDir, error) {
+	info, err := os.Stat(root)
+	if err != nil {
+		return nil, fmt.Errorf("opening archive directory: %w", err)
+	}
+
+	if !info.IsDir() {
+		return nil, fmt.Errorf("archive directory %s is not a directory", root)
+	}
+
+	if copy == nil {
+		copy = io.Copy
+	}
+
+	return &LocalDir{root: root, copy: copy}, nil
+}
+
+// path returns the local path of the provided key.
+func (s *LocalDir) path(key string) string {
+	return filepath.Join(s.root, filepath.FromSlash(key))
+}
+
+// write writes the provided reader to the provided key. The file is written under a
+// temporary name renamed once synced, so partial copies never look like archives.
+func (s *LocalDir) write(key string, r io.Reader) (int64, error) {
+	target := s.path(key)
+	err := os.MkdirAll(filepath.Dir(target), 0755)
+	if err != nil {
+		return 0, err
+	}
+
+	tmp := target + ".part"
+	f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := s.copy(f, r)
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp, target)
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return n, err
+	}
+
+	return n, nil
+}
+
+// PutFile copies the file at the provided path as the provided key.
+func (s *LocalDir) PutFile(_ context.Context, key string, localPath string) (int64, error) {
+	f, err := os.Open(localPath)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	return s.write(key, f)
+}
+
+// Put writes the provided data as the provided key.
+func (s *LocalDir) Put(_ context.Context, key string, data []byte) error {
+	_, err := s.write(key, bytes.NewReader(data))
+	return err
+}
+
+// Get opens the stored file with the provided key.
+func (s *LocalDir) Get(_ context.Context, key string) (io.ReadCloser, error) {
+	return os.Open(s.path(key))
+}
+
+// Stat returns the size of the stored file with the provided key.
+func (s *LocalDir) Stat(_ context.Context, key string) (int64, error) {
+	info, err := os.Stat(s.path(key))
+	if err != nil {
+		return 0, err
+	}
+
+	return info.Size(), nil
+}
+
+// List returns the files stored directly under the provided prefix. A missing directory
+// holds no files.
+func (s *LocalDir) List(_ context.Context, prefix string) ([]Object, error) {
+	entries, err := os.ReadDir(s.path(prefix))
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var files []Object
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() {
+			continue
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			// Files removed since reading the directory are not stored anymore.
+			continue
+		}
+
+		files = append(files, Object{
+			Key:      prefix + entry.Name(),
+			Size:     info.Size(),
+			Modified: info.ModTime(),
+		})
+	}
+
+	return files, nil
+}
+
+// Remove removes the stored file with the provided key, if any.
+func (s *LocalDir) Remove(_ context.Context, key string) error {
+	err := os.Remove(s.path(key))
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+
+	return nil
+}
+
+// Presign returns ErrNoLinks, local directories have no download links.
+func (s *LocalDir) Presign(context.Context, string, time.Duration) (string, error) {
+	return "", ErrNoLinks
+}
+
+// Check ensures the directory can be listed.
+func (s *LocalDir) Check(ctx context.Context) error {
+	_, err := s.List(ctx, "")
+	return err
+}
+
+// Close releases nothing, local directories hold no connection.
+func (s *LocalDir) Close() error {
+	return nil
+}
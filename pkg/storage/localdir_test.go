@@ -0,0 +1,63 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/peterldowns/testy/assert"
+)
+
+func TestLocalDir(t *testing.T) {
+	root := t.TempDir()
+	ctx := context.Background()
+
+	// Ensure missing directories, e.g. unmounted shares, are not opened.
+	_, err := OpenLocalDir(filepath.Join(root, "missing"), nil)
+	assert.Error(t, err)
+
+	dir, err := OpenLocalDir(root, nil)
+	assert.NoError(t, err)
+	assert.NoError(t, dir.Check(ctx))
+
+	src := filepath.Join(t.TempDir(), "dump.zip")
+	assert.NoError(t, os.WriteFile(src, []byte("archive"), 0600))
+	n, err := dir.PutFile(ctx, "backups/dump.zip", src)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(7), n)
+	assert.NoError(t, dir.Put(ctx, "backups/dump.zip.json", []byte("{}")))
+
+	size, err := dir.Stat(ctx, "backups/dump.zip")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(7), size)
+
+	r, err := dir.Get(ctx, "backups/dump.zip")
+	assert.NoError(t, err)
+	data, err := io.ReadAll(r)
+	assert.NoError(t, err)
+	assert.NoError(t, r.Close())
+	assert.Equal(t, "archive", string(data))
+
+	// Ensure only the files directly under the prefix are listed.
+	files, err := dir.List(ctx, "backups/")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(files))
+	files, err = dir.List(ctx, "")
+	assert.NoError(t, err)
+	assert.Equal(t, 0, len(files))
+
+	_, err = dir.Presign(ctx, "backups/dump.zip", 0)
+	assert.True(t, errors.Is(err, ErrNoLinks))
+	assert.True(t, errors.Is(err, errors.ErrUnsupported))
+
+	// Ensure removing missing files succeeds.
+	assert.NoError(t, dir.Remove(ctx, "backups/dump.zip"))
+	assert.NoError(t, dir.Remove(ctx, "backups/dump.zip"))
+	_, err = dir.Get(ctx, "backups/dump.zip")
+	assert.True(t, errors.Is(err, fs.ErrNotExist))
+	assert.NoError(t, dir.Close())
+}
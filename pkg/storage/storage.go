@@ -0,0 +1,60 @@
+// Package storage defines the storage backends zdts3 uploads archives to, lists, prunes and
+// restores them from. The archiver package implements the S3, SFTP, B2 and exec backends on
+// top of its configuration; backends without configuration of their own, such as local
+// directories, live here.
+//
+// Keys are slash separated paths relative to the root of the storage, like object keys.
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+// Storage is the storage backend archives are uploaded to, listed, pruned and restored from.
+// Implementations are safe for concurrent use.
+type Storage interface {
+	// PutFile uploads the file at the provided path as the provided key and returns the
+	// number of bytes uploaded.
+	PutFile(ctx context.Context, key string, path string) (int64, error)
+	// Put uploads the provided data as the provided key.
+	Put(ctx context.Context, key string, data []byte) error
+	// Get opens the stored file with the provided key, fs.ErrNotExist if there is none.
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	// Stat returns the size of the stored file with the provided key.
+	Stat(ctx context.Context, key string) (int64, error)
+	// List returns the files stored directly under the provided prefix, which is empty or
+	// ends with a slash.
+	List(ctx context.Context, prefix string) ([]Object, error)
+	// Remove removes the stored file with the provided key, if any.
+	Remove(ctx context.Context, key string) error
+	// Presign returns a download link of the stored file with the provided key valid for the
+	// provided duration, errors.ErrUnsupported if the storage has no links.
+	Presign(ctx context.Context, key string, expiry time.Duration) (string, error)
+	// Check ensures the storage exists and is accessible.
+	Check(ctx context.Context) error
+	// Close closes the connection to the storage.
+	Close() error
+}
+
+// ChecksumStorage is a storage that also returns the checksums of uploads it verified.
+type ChecksumStorage interface {
+	Storage
+	// PutFileChecksum uploads the file at the provided path as the provided key and returns
+	// the number of bytes uploaded and the base64 encoded SHA-256 checksum the storage
+	// verified, empty if it verified none.
+	PutFileChecksum(ctx context.Context, key string, path string) (int64, string, error)
+}
+
+// Object is a file stored in a storage, e.g. an archive uploaded to a bucket.
+type Object struct {
+	Key      string
+	Size     int64
+	Modified time.Time
+}
+
+// ErrNoLinks is returned by storages which cannot generate download links.
+var ErrNoLinks = fmt.Errorf("download links %w", errors.ErrUnsupported)